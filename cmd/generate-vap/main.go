@@ -0,0 +1,122 @@
+// Command generate-vap prints the ValidatingAdmissionPolicy and binding enforcing
+// the UID mapping, for clusters on Kubernetes 1.30+ that don't need the webhook
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/vap"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+func main() {
+	var (
+		kubeconfig = flag.String("kubeconfig", "", "path to the kubeconfig file, the default loading rules apply when empty")
+		namespace  = flag.String("namespace", "", "namespace of the UID mapping object, the namespace of the kubeconfig context when empty")
+		kind       = flag.String("source-kind", mapping.ConfigMapKind, "kind of the UID mapping object, ConfigMap or Secret")
+		uidName    = flag.String("uid-mapping-name", mapping.UIDConfigMapName, "name of the UID mapping object")
+		name       = flag.String("name", vap.DefaultName, "name of the generated policy and binding")
+		actions    = flag.String("validation-actions", string(admissionregistrationv1.Deny), "comma separated validation actions of the binding: Deny, Warn or Audit")
+		excluded   = flag.String("exclude-namespaces", "", "comma separated namespaces the policy doesn't apply to")
+		output     = flag.String("output", "-", "file to write the objects to, - for stdout")
+	)
+	flag.Parse()
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = *kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{})
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		logrus.Fatalf("Error getting kubeconfig: %s\n", err)
+	}
+	if *namespace == "" {
+		if *namespace, _, err = clientConfig.Namespace(); err != nil {
+			logrus.Fatalf("Error getting namespace: %s\n", err)
+		}
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		logrus.Fatalf("Error creating client: %s\n", err)
+	}
+
+	store, err := mapping.NewStoreFromSource(client, mapping.Source{Kind: *kind, Namespace: *namespace, UIDName: *uidName})
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if err := store.Start(stopCh); err != nil {
+		logrus.Fatal(err)
+	}
+	uids, err := loadUIDs(store)
+	if err != nil {
+		logrus.Fatalf("Error reading UID mapping: %s\n", err)
+	}
+
+	opts := vap.Options{Name: *name}
+	for _, action := range splitList(*actions) {
+		opts.Actions = append(opts.Actions, admissionregistrationv1.ValidationAction(action))
+	}
+	opts.ExcludedNamespaces = splitList(*excluded)
+	policy, binding := vap.Generate(uids, opts)
+
+	var out io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		defer f.Close()
+		out = f
+	}
+	for i, obj := range []interface{}{policy, binding} {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if i > 0 {
+			fmt.Fprintln(out, "---")
+		}
+		if _, err := out.Write(data); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+}
+
+// loadUIDs returns the UIDs of every subject of the UID mapping
+func loadUIDs(store *mapping.Store) (map[string]mapping.IDRanges, error) {
+	subjects, err := store.Subjects()
+	if err != nil {
+		return nil, err
+	}
+	uids := make(map[string]mapping.IDRanges, len(subjects))
+	for _, subject := range subjects {
+		ranges, found, err := store.UIDs(subject)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			uids[subject] = ranges
+		}
+	}
+	return uids, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/xml"
+	"os"
+)
+
+// junitSuite is the JUnit XML report of validate, a test case per object
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes the JUnit XML report of results to file, objects being the
+// test cases of the classes named after their files
+func writeJUnit(file string, results []checked) error {
+	suite := junitSuite{Name: "nfs-access", Tests: len(results)}
+	for _, c := range results {
+		tc := junitCase{Name: c.object, ClassName: c.source}
+		switch {
+		case c.skipped:
+			suite.Skipped++
+			tc.Skipped = &struct{}{}
+		case !c.allowed:
+			suite.Failures++
+			tc.Failure = &junitFailure{Message: "denied", Text: c.message}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	out, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append([]byte(xml.Header), append(out, '\n')...), 0o644)
+}
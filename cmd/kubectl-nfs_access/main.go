@@ -0,0 +1,706 @@
+// Command kubectl-nfs_access is a kubectl plugin checking pods and workloads
+// against the mappings offline, with the validators of the webhook, so that
+// manifests can be validated in CI before they are applied, and replaying the
+// admission requests recorded by the webhook against new mappings:
+//
+//	kubectl nfs-access check -f pod.yaml --as system:serviceaccount:team-a:builder
+//	helm template ./chart | kubectl nfs-access validate --mapping-file mapping.yaml
+//	kubectl nfs-access replay --mapping-file new-mapping.yaml recordings/
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/admission"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/exports"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/recording"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/validation"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+const usage = `Check pods and workloads against the NFS UID and GID mappings offline.
+
+Usage:
+  kubectl nfs-access check -f FILE --as USER [flags]
+  kubectl nfs-access validate --mapping-file FILE [flags] [PATH...]
+  kubectl nfs-access replay [flags] [RECORDING...]
+
+check validates the objects of FILE, - for stdin, as created by USER. The
+mappings are read from the cluster of the kubeconfig, or from the mapping
+ConfigMaps or Secrets of --mapping-file without any cluster.
+
+validate validates every manifest of the PATH files and directories, or of
+stdin without any, e.g. the output of helm template, against the mappings of
+--mapping-file and prints a report of the violations. Pods are validated as
+created by the workload controllers unless --as is set, so that the subject of
+every pod is its serviceAccount.
+
+replay validates again the admission requests recorded by the webhook with
+ENABLE_RECORDING, read from the RECORDING files and directories or from stdin
+without any, with the policy of the flags and the mappings of --mapping-file or
+of the cluster, and prints the requests whose decision changed.
+
+Objects other than pods, Deployments, StatefulSets, DaemonSets, Jobs and
+CronJobs are skipped. The exit code is 1 when any object is denied, or for
+replay when any recorded request that was allowed is denied.
+
+Flags:
+`
+
+// checked is the outcome of the check of an object
+type checked struct {
+	object  string
+	source  string
+	allowed bool
+	skipped bool
+	message string
+}
+
+func main() {
+	if len(os.Args) < 2 || (os.Args[1] != "check" && os.Args[1] != "validate" && os.Args[1] != "replay") {
+		fmt.Fprint(os.Stderr, usage)
+		newFlagSet(os.Args[0]).PrintDefaults()
+		os.Exit(2)
+	}
+	command := os.Args[1]
+	flags := newFlagSet(command)
+	if err := flags.Parse(os.Args[2:]); err != nil {
+		os.Exit(2)
+	}
+	logrus.SetLevel(logrus.WarnLevel)
+	if opts.verbose {
+		logrus.SetLevel(logrus.DebugLevel)
+	}
+
+	var paths []string
+	switch command {
+	case "check":
+		if opts.file == "" || opts.as == "" {
+			logrus.Fatal("-f and --as are required")
+		}
+		paths = []string{opts.file}
+	case "validate", "replay":
+		if command == "validate" && opts.mappingFile == "" {
+			logrus.Fatal("--mapping-file is required")
+		}
+		if opts.file != "" {
+			paths = append(paths, opts.file)
+		}
+		paths = append(paths, flags.Args()...)
+		if len(paths) == 0 {
+			paths = []string{"-"}
+		}
+	}
+
+	policy, err := opts.policy()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	uidResolver, err := opts.resolver()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	if command == "replay" {
+		os.Exit(replay(paths, policy, uidResolver))
+	}
+	files, err := manifestFiles(paths)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	var results []checked
+	for _, file := range files {
+		objects, err := readObjects(file)
+		if err != nil {
+			logrus.Fatalf("Error reading %s: %s\n", file, err)
+		}
+		for _, obj := range objects {
+			c, err := check(obj, policy, uidResolver)
+			if err != nil {
+				logrus.Fatalf("cannot check %s of %s: %v", c.object, file, err)
+			}
+			results = append(results, c)
+		}
+	}
+
+	if command == "validate" {
+		printReport(os.Stdout, results)
+		if opts.junit != "" {
+			if err := writeJUnit(opts.junit, results); err != nil {
+				logrus.Fatalf("Error writing %s: %s\n", opts.junit, err)
+			}
+		}
+	} else {
+		for _, c := range results {
+			printResult(os.Stdout, c, "")
+		}
+	}
+	for _, c := range results {
+		if !c.allowed && !c.skipped {
+			os.Exit(1)
+		}
+	}
+}
+
+// printResult prints the outcome of the check of an object and its denial
+// reasons, prefixed by prefix
+func printResult(w io.Writer, c checked, prefix string) {
+	switch {
+	case c.skipped:
+		fmt.Fprintf(w, "SKIP  %s%s\n", prefix, c.object)
+	case c.allowed:
+		fmt.Fprintf(w, "ALLOW %s%s\n", prefix, c.object)
+	default:
+		fmt.Fprintf(w, "DENY  %s%s\n", prefix, c.object)
+		for _, line := range strings.Split(strings.TrimSpace(c.message), "\n") {
+			fmt.Fprintf(w, "      %s\n", line)
+		}
+	}
+}
+
+// printReport prints the violations of results by file, followed by a summary
+func printReport(w io.Writer, results []checked) {
+	var allowed, denied, skipped int
+	for _, c := range results {
+		switch {
+		case c.skipped:
+			skipped++
+		case c.allowed:
+			allowed++
+		default:
+			denied++
+			printResult(w, c, c.source+": ")
+		}
+	}
+	fmt.Fprintf(w, "%d objects checked: %d allowed, %d denied, %d skipped\n", allowed+denied, allowed, denied, skipped)
+}
+
+// manifestFiles returns the files of paths, the YAML and JSON files of the
+// directories being walked recursively
+func manifestFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		if path == "-" {
+			files = append(files, path)
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			switch filepath.Ext(file) {
+			case ".yaml", ".yml", ".json":
+				if !d.IsDir() {
+					files = append(files, file)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// options are the flags of the check command
+type options struct {
+	file, as, namespace string
+	groups              string
+	verbose             bool
+	junit               string
+
+	kubeconfig, mappingFile, mappingNamespace string
+	kind, uidName, gidName                    string
+
+	requireRunAsUser, requireRunAsNonRoot bool
+	minUID                                int64
+	blockRootUID                          bool
+	exportPolicyFile                      string
+	validators, modes                     string
+}
+
+var opts options
+
+// newFlagSet returns the flags of the command, set into opts
+func newFlagSet(command string) *flag.FlagSet {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.StringVar(&opts.file, "f", "", "file or directory holding the manifests to check, - for stdin")
+	flags.StringVar(&opts.as, "as", "", "user or serviceAccount (system:serviceaccount:<namespace>:<name>) creating the objects, the workload controllers for validate when empty")
+	flags.StringVar(&opts.groups, "as-group", "", "comma separated groups of the user, for group mappings")
+	flags.StringVar(&opts.namespace, "namespace", "", "namespace of objects without namespace, the namespace of the serviceAccount or default when empty")
+	flags.BoolVar(&opts.verbose, "v", false, "log the validation")
+	flags.StringVar(&opts.junit, "junit", "", "file the JUnit XML report of validate is written to, e.g. for the test reports of CI pipelines")
+
+	flags.StringVar(&opts.kubeconfig, "kubeconfig", "", "path to the kubeconfig file, the default loading rules apply when empty")
+	flags.StringVar(&opts.mappingFile, "mapping-file", "", "file holding the mapping ConfigMaps or Secrets, read from the cluster when empty")
+	flags.StringVar(&opts.mappingNamespace, "mapping-namespace", "nfs-pod-access-control", "namespace of the mapping objects")
+	flags.StringVar(&opts.kind, "source-kind", mapping.ConfigMapKind, "kind of the mapping objects, ConfigMap or Secret")
+	flags.StringVar(&opts.uidName, "uid-mapping-name", mapping.UIDConfigMapName, "name of the UID mapping object")
+	flags.StringVar(&opts.gidName, "gid-mapping-name", mapping.GIDConfigMapName, "name of the GID mapping object")
+
+	flags.BoolVar(&opts.requireRunAsUser, "require-run-as-user", false, "deny pods that don't set runAsUser, like REQUIRE_RUN_AS_USER")
+	flags.BoolVar(&opts.requireRunAsNonRoot, "require-run-as-non-root", false, "deny pods that don't set runAsNonRoot, like REQUIRE_RUN_AS_NON_ROOT")
+	flags.Int64Var(&opts.minUID, "min-uid", 1000, "lowest UID pods may run as, like MIN_UID")
+	flags.BoolVar(&opts.blockRootUID, "block-root-uid", true, "deny pods running as UID 0, like BLOCK_ROOT_UID")
+	flags.StringVar(&opts.exportPolicyFile, "export-policy-file", "", "export policy file, like EXPORT_POLICY_FILE")
+	flags.StringVar(&opts.validators, "validators", "", "comma separated validators applied, like VALIDATOR_CHAIN")
+	flags.StringVar(&opts.modes, "validator-modes", "", "comma separated modes of validators, like VALIDATOR_MODES")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// policy returns the validation policy set by the flags, every denial being
+// collected so that all of them are reported at once
+func (o options) policy() (validation.Policy, error) {
+	policy := validation.Policy{
+		RequireRunAsUser:    o.requireRunAsUser,
+		RequireRunAsNonRoot: o.requireRunAsNonRoot,
+		MinUID:              o.minUID,
+		BlockRootUID:        o.blockRootUID,
+		Aggregation:         validation.AggregateAll,
+	}
+	if o.minUID < 0 || o.minUID > mapping.MaxID {
+		return policy, fmt.Errorf("--min-uid %d is out of [0, %d]", o.minUID, int64(mapping.MaxID))
+	}
+	var err error
+	if policy.Chain, err = validation.ParseChain(o.validators, o.modes); err != nil {
+		return policy, err
+	}
+	if o.exportPolicyFile != "" {
+		if policy.Exports, err = exports.LoadFile(o.exportPolicyFile); err != nil {
+			return policy, err
+		}
+	}
+	return policy, nil
+}
+
+// resolver returns the configmap resolver of the mappings of the cluster, or of
+// the mapping file served by a fake client
+func (o options) resolver() (resolver.UIDResolver, error) {
+	var client kubernetes.Interface
+	if o.mappingFile != "" {
+		objects, err := readObjects(o.mappingFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading mapping file: %s\n", err)
+		}
+		mappings, err := mappingObjects(objects, o.mappingNamespace)
+		if err != nil {
+			return nil, err
+		}
+		client = fake.NewSimpleClientset(mappings...)
+	} else {
+		rules := clientcmd.NewDefaultClientConfigLoadingRules()
+		rules.ExplicitPath = o.kubeconfig
+		config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("Error getting kubeconfig: %s\n", err)
+		}
+		if client, err = kubernetes.NewForConfig(config); err != nil {
+			return nil, fmt.Errorf("Error creating client: %s\n", err)
+		}
+	}
+
+	store, err := mapping.NewStoreFromSource(client, mapping.Source{Kind: o.kind, Namespace: o.mappingNamespace, UIDName: o.uidName, GIDName: o.gidName})
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Start(make(chan struct{})); err != nil {
+		return nil, err
+	}
+	return resolver.New("configmap", resolver.Options{Mappings: store, Client: client, Namespace: o.mappingNamespace})
+}
+
+// object is a manifest read from a file
+type object struct {
+	source    string
+	gvk       schema.GroupVersionKind
+	name      string
+	namespace string
+	raw       []byte
+}
+
+// String describes the object, e.g. "Deployment team-a/web"
+func (o object) String() string {
+	return fmt.Sprintf("%s %s/%s", o.gvk.Kind, o.namespace, o.name)
+}
+
+// readObjects reads the YAML or JSON manifests of a file, - for stdin
+func readObjects(name string) ([]object, error) {
+	var r io.Reader = os.Stdin
+	source := "stdin"
+	if name != "-" {
+		source = name
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var objects []object
+	reader := k8syaml.NewYAMLReader(bufio.NewReader(r))
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		raw, err := yaml.YAMLToJSON(doc)
+		if err != nil {
+			return nil, err
+		}
+		if string(raw) == "null" {
+			continue
+		}
+		var meta struct {
+			metav1.TypeMeta   `json:",inline"`
+			metav1.ObjectMeta `json:"metadata,omitempty"`
+		}
+		if err := json.Unmarshal(raw, &meta); err != nil {
+			return nil, err
+		}
+		objects = append(objects, object{
+			source:    source,
+			gvk:       schema.FromAPIVersionAndKind(meta.APIVersion, meta.Kind),
+			name:      meta.Name,
+			namespace: meta.Namespace,
+			raw:       raw,
+		})
+	}
+}
+
+// mappingObjects decodes the ConfigMaps and Secrets of objects, in namespace
+// unless they set their own
+func mappingObjects(objects []object, namespace string) ([]runtime.Object, error) {
+	var mappings []runtime.Object
+	for _, obj := range objects {
+		switch obj.gvk.Kind {
+		case mapping.ConfigMapKind:
+			var cm corev1.ConfigMap
+			if err := json.Unmarshal(obj.raw, &cm); err != nil {
+				return nil, err
+			}
+			if cm.Namespace == "" {
+				cm.Namespace = namespace
+			}
+			mappings = append(mappings, &cm)
+		case mapping.SecretKind:
+			var s corev1.Secret
+			if err := json.Unmarshal(obj.raw, &s); err != nil {
+				return nil, err
+			}
+			if s.Namespace == "" {
+				s.Namespace = namespace
+			}
+			// stringData is merged into data by the API server
+			for k, v := range s.StringData {
+				if s.Data == nil {
+					s.Data = map[string][]byte{}
+				}
+				s.Data[k] = []byte(v)
+			}
+			mappings = append(mappings, &s)
+		}
+	}
+	return mappings, nil
+}
+
+// checkedKinds are the kinds validated by the webhook, by API group
+var checkedKinds = map[string]map[string]string{
+	"":      {"Pod": "pods"},
+	"apps":  {"Deployment": "deployments", "StatefulSet": "statefulsets", "DaemonSet": "daemonsets"},
+	"batch": {"Job": "jobs", "CronJob": "cronjobs"},
+}
+
+// controllers are the serviceAccounts of the controllers creating the pods of
+// the workloads, by kind
+var controllers = map[string]string{
+	"Pod":         "system:serviceaccount:kube-system:default",
+	"Deployment":  "system:serviceaccount:kube-system:replicaset-controller",
+	"StatefulSet": "system:serviceaccount:kube-system:statefulset-controller",
+	"DaemonSet":   "system:serviceaccount:kube-system:daemon-set-controller",
+	"Job":         "system:serviceaccount:kube-system:job-controller",
+	"CronJob":     "system:serviceaccount:kube-system:job-controller",
+}
+
+// check validates obj like the validating webhook would when created by opts.as,
+// or by the controller creating its pods when unset
+func check(obj object, policy validation.Policy, uidResolver resolver.UIDResolver) (checked, error) {
+	namespace := obj.namespace
+	if namespace == "" {
+		namespace = opts.namespace
+	}
+	if parts := strings.Split(opts.as, ":"); namespace == "" && len(parts) == 4 && parts[1] == "serviceaccount" {
+		namespace = parts[2]
+	}
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	obj.namespace = namespace
+	c := checked{object: obj.String(), source: obj.source}
+
+	resource, ok := checkedKinds[obj.gvk.Group][obj.gvk.Kind]
+	if !ok {
+		c.skipped = true
+		return c, nil
+	}
+	raw := obj.raw
+	if obj.gvk.Kind == "Pod" {
+		var err error
+		if raw, err = defaultServiceAccount(raw); err != nil {
+			return c, err
+		}
+	}
+
+	user := opts.as
+	if user == "" {
+		user = controllers[obj.gvk.Kind]
+	}
+	var groups []string
+	if opts.groups != "" {
+		groups = strings.Split(opts.groups, ",")
+	}
+	a := admission.Admitter{
+		Logger: logrus.WithField("object", c.object),
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("kubectl-nfs-access"),
+			Kind:      metav1.GroupVersionKind{Group: obj.gvk.Group, Version: obj.gvk.Version, Kind: obj.gvk.Kind},
+			Resource:  metav1.GroupVersionResource{Group: obj.gvk.Group, Version: obj.gvk.Version, Resource: resource},
+			Name:      obj.name,
+			Namespace: namespace,
+			Operation: admissionv1.Create,
+			UserInfo:  authenticationv1.UserInfo{Username: user, Groups: groups},
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+		ValidationPolicy: policy,
+		Resolver:         uidResolver,
+		RemediationHints: true,
+	}
+	review, err := a.ValidatePodReview(context.Background())
+	if err != nil {
+		return c, err
+	}
+	c.allowed = review.Response.Allowed
+	c.message = review.Response.Result.Message
+	return c, nil
+}
+
+// defaultServiceAccount sets the serviceAccountName of a pod to default when
+// unset, like the API server does before calling the webhook
+func defaultServiceAccount(raw []byte) ([]byte, error) {
+	var pod corev1.Pod
+	if err := json.Unmarshal(raw, &pod); err != nil {
+		return nil, err
+	}
+	if pod.Spec.ServiceAccountName != "" {
+		return raw, nil
+	}
+	pod.Spec.ServiceAccountName = "default"
+	return json.Marshal(&pod)
+}
+
+// replayed is the outcome of the replay of a recorded admission request
+type replayed struct {
+	object   string
+	time     time.Time
+	recorded bool
+	allowed  bool
+	skipped  bool
+	message  string
+}
+
+// replay validates again the admission requests recorded in paths and prints the
+// ones whose decision changed, it returns 1 when any allowed request is denied
+func replay(paths []string, policy validation.Policy, uidResolver resolver.UIDResolver) int {
+	files, err := recordingFiles(paths)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	var results []replayed
+	for _, file := range files {
+		entries, err := readRecording(file)
+		if err != nil {
+			logrus.Fatalf("Error reading %s: %s\n", file, err)
+		}
+		for _, entry := range entries {
+			r, err := replayEntry(entry, policy, uidResolver)
+			if err != nil {
+				logrus.Fatalf("cannot replay %s of %s: %v", r.object, file, err)
+			}
+			results = append(results, r)
+		}
+	}
+
+	printReplay(os.Stdout, results)
+	for _, r := range results {
+		if !r.skipped && r.recorded && !r.allowed {
+			return 1
+		}
+	}
+	return 0
+}
+
+// recordingFiles returns the files of paths, the recording files of the
+// directories being listed
+func recordingFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		if path == "-" {
+			files = append(files, path)
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		recordings, err := recording.Files(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, recordings...)
+	}
+	return files, nil
+}
+
+// readRecording reads the entries of a recording file, - for stdin
+func readRecording(name string) ([]recording.Entry, error) {
+	if name == "-" {
+		return recording.Read(os.Stdin)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return recording.Read(f)
+}
+
+// replayEntry validates the recorded request of entry again. The requests of the
+// mutating webhook and the ones rejected by the rate limits, which aren't
+// decisions of the policy, are skipped.
+func replayEntry(entry recording.Entry, policy validation.Policy, uidResolver resolver.UIDResolver) (replayed, error) {
+	req := *entry.Request
+	r := replayed{
+		object: fmt.Sprintf("%s %s/%s by %s", req.Kind.Kind, req.Namespace, requestName(req), req.UserInfo.Username),
+		time:   entry.Time,
+	}
+	if entry.Webhook != "validate" || entry.Response == nil {
+		r.skipped = true
+		return r, nil
+	}
+	if entry.Response.Result != nil && entry.Response.Result.Code == http.StatusTooManyRequests {
+		r.skipped = true
+		return r, nil
+	}
+	r.recorded = entry.Response.Allowed
+
+	a := admission.Admitter{
+		Logger:           logrus.WithField("object", r.object),
+		Request:          &req,
+		ValidationPolicy: policy,
+		Resolver:         uidResolver,
+		RemediationHints: true,
+	}
+	review, err := a.ValidatePodReview(context.Background())
+	if err != nil {
+		return r, err
+	}
+	r.allowed = review.Response.Allowed
+	if review.Response.Result != nil {
+		r.message = review.Response.Result.Message
+	}
+	return r, nil
+}
+
+// requestName returns the name of the object of req, its generateName followed
+// by * for the pods named by the API server
+func requestName(req admissionv1.AdmissionRequest) string {
+	if req.Name != "" {
+		return req.Name
+	}
+	var meta struct {
+		metav1.ObjectMeta `json:"metadata,omitempty"`
+	}
+	if err := json.Unmarshal(req.Object.Raw, &meta); err == nil {
+		if meta.Name != "" {
+			return meta.Name
+		}
+		if meta.GenerateName != "" {
+			return meta.GenerateName + "*"
+		}
+	}
+	return "*"
+}
+
+// printReplay prints the replayed requests whose decision changed, with the
+// denial reasons of the newly denied ones, followed by a summary
+func printReplay(w io.Writer, results []replayed) {
+	var unchanged, denied, allowed, skipped int
+	for _, r := range results {
+		switch {
+		case r.skipped:
+			skipped++
+		case r.recorded == r.allowed:
+			unchanged++
+		case r.allowed:
+			allowed++
+			fmt.Fprintf(w, "DENY  -> ALLOW %s (recorded %s)\n", r.object, r.time.Format(time.RFC3339))
+		default:
+			denied++
+			fmt.Fprintf(w, "ALLOW -> DENY  %s (recorded %s)\n", r.object, r.time.Format(time.RFC3339))
+			for _, line := range strings.Split(strings.TrimSpace(r.message), "\n") {
+				fmt.Fprintf(w, "      %s\n", line)
+			}
+		}
+	}
+	fmt.Fprintf(w, "%d requests replayed: %d unchanged, %d newly denied, %d newly allowed, %d skipped\n", unchanged+denied+allowed, unchanged, denied, allowed, skipped)
+}
@@ -0,0 +1,129 @@
+// Command migrate-mapping prints the UID mapping object holding the structured
+// mapping.yaml document converted from the flat UID and GID mapping objects
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+func main() {
+	var (
+		kubeconfig = flag.String("kubeconfig", "", "path to the kubeconfig file, the default loading rules apply when empty")
+		namespace  = flag.String("namespace", "", "namespace of the mapping objects, the namespace of the kubeconfig context when empty")
+		kind       = flag.String("source-kind", mapping.ConfigMapKind, "kind of the mapping objects, ConfigMap or Secret")
+		uidName    = flag.String("uid-mapping-name", mapping.UIDConfigMapName, "name of the UID mapping object")
+		gidName    = flag.String("gid-mapping-name", mapping.GIDConfigMapName, "name of the GID mapping object")
+		output     = flag.String("output", "-", "file to write the object to, - for stdout")
+	)
+	flag.Parse()
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = *kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{})
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		logrus.Fatalf("Error getting kubeconfig: %s\n", err)
+	}
+	if *namespace == "" {
+		if *namespace, _, err = clientConfig.Namespace(); err != nil {
+			logrus.Fatalf("Error getting namespace: %s\n", err)
+		}
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		logrus.Fatalf("Error creating client: %s\n", err)
+	}
+
+	store, err := mapping.NewStoreFromSource(client, mapping.Source{Kind: *kind, Namespace: *namespace, UIDName: *uidName, GIDName: *gidName})
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if err := store.Start(stopCh); err != nil {
+		logrus.Fatal(err)
+	}
+	document, err := loadDocument(store)
+	if err != nil {
+		logrus.Fatalf("Error converting mappings: %s\n", err)
+	}
+	data, err := yaml.Marshal(document)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	meta := metav1.ObjectMeta{Name: *uidName, Namespace: *namespace}
+	var obj interface{} = &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: mapping.ConfigMapKind},
+		ObjectMeta: meta,
+		Data:       map[string]string{mapping.DocumentKey: string(data)},
+	}
+	if *kind == mapping.SecretKind {
+		obj = &corev1.Secret{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: mapping.SecretKind},
+			ObjectMeta: meta,
+			StringData: map[string]string{mapping.DocumentKey: string(data)},
+		}
+	}
+	manifest, err := yaml.Marshal(obj)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		defer f.Close()
+		out = f
+	}
+	if _, err := out.Write(manifest); err != nil {
+		logrus.Fatal(err)
+	}
+}
+
+// loadDocument returns the Document holding the UIDs and GIDs of every subject of
+// the UID mapping
+func loadDocument(store *mapping.Store) (*mapping.Document, error) {
+	subjects, err := store.Subjects()
+	if err != nil {
+		return nil, err
+	}
+	uids := make(map[string]string, len(subjects))
+	gids := make(map[string]string, len(subjects))
+	for _, subject := range subjects {
+		ranges, found, err := store.UIDs(subject)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			uids[subject] = ranges.String()
+		}
+		ids, found, err := store.GIDs(subject)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			fields := make([]string, len(ids))
+			for i, id := range ids {
+				fields[i] = strconv.FormatInt(id, 10)
+			}
+			gids[subject] = strings.Join(fields, ",")
+		}
+	}
+	return mapping.NewDocument(uids, gids)
+}
@@ -2,35 +2,481 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
+	"log/syslog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	// time zones of the time windows, the image has no zoneinfo
+	_ "time/tzdata"
 
 	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/accesspolicy"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/admin"
 	"github.com/tensorchord/nfs-pod-access-control/pkg/admission"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/allocator"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/auditlog"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/certs"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/collision"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/compliance"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/config"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/diagnostics"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/evaluation"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/evaluation/evaluationpb"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/events"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/exemption"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/expiry"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/exports"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/ganesha"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/health"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/idmap"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/messages"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/metrics"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mutation"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/nfs"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/notify"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/ontap"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/opa"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/recording"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/registration"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/report"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/serving"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/sharedcache"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/tracing"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/uidrange"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/validation"
+	"go.opentelemetry.io/otel/codes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
 	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
+// reloadMu guards the settings reloaded from the config file: namespaceScope,
+// modePolicy, uidResolver and failOpen
+var reloadMu sync.RWMutex
+
+// validationPolicy, mutationPolicy, namespaceScope and modePolicy hold the settings
+// read from env vars at startup
+var (
+	validationPolicy validation.Policy
+	mutationPolicy   mutation.Policy
+	namespaceScope   admission.NamespaceScope
+	modePolicy       admission.ModePolicy
+)
+
+// uidResolver resolves the identity of users and serviceAccounts, it is shared by all requests
+var uidResolver resolver.UIDResolver
+
+// resolverOptions are the options uidResolver is created with
+var resolverOptions resolver.Options
+
+// exemptions checks the exemption labels of pods and namespaces, nil when disabled
+var exemptions *exemption.Checker
+
+// eventRecorder emits Events about rejected pods, nil when disabled
+var eventRecorder *events.Recorder
+
+// namespaceDefaults holds the default identity of the namespaces, nil when disabled
+var namespaceDefaults resolver.NamespaceDefaults
+
+// accessReports records rejected pods in the NFSAccessReport of their namespace,
+// nil when disabled
+var accessReports *report.Writer
+
+// notifier posts summaries of the rejected pods to a chat or generic webhook,
+// nil when disabled
+var notifier *notify.Notifier
+
+// auditLog writes an audit record of every decision for the SIEM, nil when
+// disabled
+var auditLog *auditlog.Logger
+
+// nfsDetector restricts enforcement to pods mounting NFS storage, nil when disabled
+var nfsDetector *nfs.Detector
+
+// failOpen admits pods while the identity backend is unavailable, nil when pods
+// are always rejected on backend errors
+var failOpen *resolver.CircuitBreaker
+
+// denialMessages renders the messages of denied pods, nil when the messages of
+// the validators are returned as is
+var denialMessages *messages.Templates
+
+// remediationHints adds the pod spec fields fixing the denials to the messages of denied pods
+var remediationHints bool
+
+// mappingAdmitter is the template of the admitters validating the mapping objects
+// written to the API server, nil when disabled
+var mappingAdmitter *admission.MappingAdmitter
+
+// decisionCache remembers the allowed pods to skip the validation of identical
+// ones, nil when disabled
+var decisionCache *admission.DecisionCache
+
+// rateLimits bounds the rate of the admission requests of every namespace, nil
+// when disabled
+var rateLimits *admission.RateLimiter
+
+// recorder records the sanitized admission requests of pods and their responses,
+// nil when disabled
+var recorder *recording.Recorder
+
+// shadow evaluates the validated pods against a candidate policy and mappings,
+// nil when disabled
+var shadow *admission.Shadow
+
+// sharedCache shares the cached identities and decisions between the replicas,
+// nil when disabled
+var sharedCache *sharedcache.Redis
+
+// mappingVersion holds the hash of the version of the mappings served
+var mappingVersion atomic.Value
+
+// healthChecker holds the readiness checks served on /readyz
+var healthChecker = health.NewChecker()
+
+// Default TLS serving certificate and key, used when the TLS env var is "true"
+const (
+	tlsCertFile = "/etc/admission-webhook/tls/tls.crt"
+	tlsKeyFile  = "/etc/admission-webhook/tls/tls.key"
+)
+
+// settingFlags are the command line flags overriding the env var of a setting
+var settingFlags = []struct {
+	name, env, usage string
+}{
+	{"config", "CONFIG_FILE", "path to the YAML configuration file, its settings are overridden by env vars and flags"},
+	{"namespace", mapping.NamespaceEnv, "namespace of the webhook when running outside of the cluster"},
+	{"listen-address", "LISTEN_ADDR", "address of the admission server, :443 with TLS and :8080 otherwise by default"},
+	{"metrics-address", "METRICS_ADDR", "address of the metrics server, :9090 by default"},
+	{"log-level", "LOG_LEVEL", "log level, info by default"},
+	{"tls-cert-file", "TLS_CERT_FILE", "serving certificate used when TLS is true, " + tlsCertFile + " by default"},
+	{"tls-key-file", "TLS_KEY_FILE", "key of the serving certificate used when TLS is true, " + tlsKeyFile + " by default"},
+	{"mapping-backend", "MAPPING_BACKEND", "resolver backend, configmap by default"},
+	{"mapping-source-kind", "MAPPING_SOURCE_KIND", "kind of the mapping objects, ConfigMap or Secret"},
+	{"enforcement-mode", "ENFORCEMENT_MODE", "enforce, audit or warn"},
+	{"enforced-namespaces", "ENFORCED_NAMESPACES", "comma separated patterns of the namespaces validated and mutated"},
+	{"excluded-namespaces", "EXCLUDED_NAMESPACES", "comma separated patterns of the namespaces never validated nor mutated"},
+}
+
 func main() {
-	setLogger()
+	kubeconfig := flag.String("kubeconfig", "", "path to the kubeconfig file to run outside of the cluster, the KUBECONFIG env var applies when empty")
+	values := make(map[string]*string, len(settingFlags))
+	for _, f := range settingFlags {
+		values[f.name] = flag.String(f.name, "", fmt.Sprintf("%s, overrides the %s env var", f.usage, f.env))
+	}
+	flag.Parse()
+	for _, f := range settingFlags {
+		if *values[f.name] != "" {
+			os.Setenv(f.env, *values[f.name])
+		}
+	}
 
-	// handle our core application
-	http.HandleFunc("/validate-pods", ServeValidatePods)
-	http.HandleFunc("/mutate-pods", ServeMutatePods)
-	http.HandleFunc("/health", ServeHealth)
+	c := setConfig()
+	setLogger()
+	flushTraces := setTracing()
+	setPolicy()
+	config, client := setClient(*kubeconfig)
+	setNamespaceDefaults(client)
+	setSharedCache()
+	mappings := setResolver(config, client)
+	serveVersion := setMappingVersion(mappings)
+	setDecisionCache()
+	setRateLimits()
+	setRecording()
+	setAccessPolicies(config)
+	setOPA()
+	setIdmapController(client, mappings)
+	setAllocator(client, mappings)
+	setMappingValidation(mappings)
+	setExemptions(client)
+	setNamespaceUIDRanges(client)
+	setEvents(client)
+	setAccessReports(config)
+	setNotifications()
+	setAuditLog()
+	setCollisionDetection(mappings)
+	setExpiryReporting(mappings)
+	detector := setNFSDetector(client)
+	setGanesha(client, detector)
+	setONTAP(client, detector)
+	setComplianceScan(client, detector)
+	setShadow(config, client, mappings)
+	setRegistration(client)
+	certManager := setCertManagement(client)
+	setSelfTest()
+	serveMetrics()
+	serveDiagnostics(mappings)
+	watchConfig(c)
 
 	// start the server
-	// listens to clear text http on port 8080 unless TLS env var is set to "true"
-	if os.Getenv("TLS") == "true" {
-		cert := "/etc/admission-webhook/tls/tls.crt"
-		key := "/etc/admission-webhook/tls/tls.key"
-		logrus.Print("Listening on port 443...")
-		logrus.Fatal(http.ListenAndServeTLS(":443", cert, key, nil))
-	} else {
-		logrus.Print("Listening on port 8080...")
-		logrus.Fatal(http.ListenAndServe(":8080", nil))
+	// listens to clear text http on port 8080 unless TLS env var is set to "true",
+	// or on the address set by the LISTEN_ADDR env var
+	addr := os.Getenv("LISTEN_ADDR")
+	server := &http.Server{Addr: addr}
+	if certManager != nil {
+		if addr == "" {
+			server.Addr = ":443"
+		}
+		server.TLSConfig = serverTLSConfig(certManager.GetCertificate)
+	} else if os.Getenv("TLS") == "true" {
+		if addr == "" {
+			server.Addr = ":443"
+		}
+		certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+		if certFile == "" {
+			certFile = tlsCertFile
+		}
+		if keyFile == "" {
+			keyFile = tlsKeyFile
+		}
+		// the mounted certificate is reloaded whenever it is rotated, e.g. by cert-manager
+		reloader, err := certs.NewReloader(certFile, keyFile)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if err := reloader.Run(make(chan struct{})); err != nil {
+			logrus.Fatal(err)
+		}
+		healthChecker.AddReadinessCheck("certificate", reloader.Ready)
+		server.TLSConfig = serverTLSConfig(reloader.GetCertificate)
+	} else if addr == "" {
+		server.Addr = ":8080"
+	}
+
+	limiter := setServing(server)
+	server.Handler = admissionHandler(server.TLSConfig, limiter, serveVersion)
+
+	// the clients of the admin API and the evaluation service authenticate otherwise
+	var apiTLSConfig *tls.Config
+	if server.TLSConfig != nil {
+		apiTLSConfig = server.TLSConfig.Clone()
+		apiTLSConfig.ClientAuth, apiTLSConfig.ClientCAs = tls.NoClientCert, nil
+	}
+	adminServer := serveAdmin(client, mappings, apiTLSConfig)
+	evaluationServer := serveEvaluation(client, apiTLSConfig)
+	delay, timeout := shutdownDelays()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	errs := make(chan error, 1)
+	go func() {
+		logrus.Printf("Listening on %s...", server.Addr)
+		if server.TLSConfig != nil {
+			errs <- server.ListenAndServeTLS("", "")
+			return
+		}
+		errs <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		logrus.Fatal(err)
+	case <-ctx.Done():
+		stop()
+	}
+	shutdown(delay, timeout, server, adminServer, evaluationServer)
+	if notifier != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := notifier.Flush(ctx); err != nil {
+			logrus.Warnf("cannot post denial notification: %v", err)
+		}
+		cancel()
+	}
+	if auditLog != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := auditLog.Close(ctx); err != nil {
+			logrus.Warnf("cannot write audit records: %v", err)
+		}
+		cancel()
+	}
+	if recorder != nil {
+		if err := recorder.Close(); err != nil {
+			logrus.Warnf("cannot close recording: %v", err)
+		}
+	}
+	if flushTraces != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := flushTraces(ctx); err != nil {
+			logrus.Warnf("cannot flush traces: %v", err)
+		}
+	}
+	logrus.Info("Shut down")
+}
+
+// admissionHandler returns the handler of the webhooks and of the health
+// endpoints, serveVersion answering /version. Only the API server is allowed to
+// call the webhooks when its client certificate is verified with tlsConfig. It
+// has its own mux rather than http.DefaultServeMux, on which importing
+// net/http/pprof and expvar registers the diagnostics endpoints.
+func admissionHandler(tlsConfig *tls.Config, limiter *serving.Limiter, serveVersion http.HandlerFunc) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/validate-pods", limiter.Limit("validate", certs.RequireClientCert(tlsConfig, ServeValidatePods)))
+	mux.HandleFunc("/mutate-pods", limiter.Limit("mutate", certs.RequireClientCert(tlsConfig, ServeMutatePods)))
+	if mappingAdmitter != nil {
+		mux.HandleFunc("/validate-mappings", limiter.Limit("validate-mappings", certs.RequireClientCert(tlsConfig, ServeValidateMappings)))
+	}
+	mux.HandleFunc("/health", ServeHealth)
+	mux.HandleFunc("/version", serveVersion)
+	mux.HandleFunc("/healthz", healthChecker.ServeHealthz)
+	mux.HandleFunc("/readyz", healthChecker.ServeReadyz)
+	return mux
+}
+
+// setServing tunes server with the SERVER_READ_TIMEOUT (10s by default),
+// SERVER_WRITE_TIMEOUT (30s), SERVER_IDLE_TIMEOUT (90s) and SERVER_MAX_HEADER_BYTES
+// (1MiB) env vars, and serves HTTP/1.1 only when DISABLE_HTTP2 is "true". It
+// returns the limiter of the admission requests answered concurrently, set by the
+// MAX_CONCURRENT_REQUESTS env var, nil when unlimited.
+func setServing(server *http.Server) *serving.Limiter {
+	opts := serving.DefaultOptions()
+	for env, value := range map[string]*time.Duration{
+		"SERVER_READ_TIMEOUT":  &opts.ReadTimeout,
+		"SERVER_WRITE_TIMEOUT": &opts.WriteTimeout,
+		"SERVER_IDLE_TIMEOUT":  &opts.IdleTimeout,
+	} {
+		if s := os.Getenv(env); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				logrus.Fatalf("invalid %s %q, expected a positive duration", env, s)
+			}
+			*value = d
+		}
+	}
+	if value := os.Getenv("SERVER_MAX_HEADER_BYTES"); value != "" {
+		var err error
+		if opts.MaxHeaderBytes, err = strconv.Atoi(value); err != nil || opts.MaxHeaderBytes <= 0 {
+			logrus.Fatalf("invalid SERVER_MAX_HEADER_BYTES %q, expected a positive integer", value)
+		}
+	}
+	opts.DisableHTTP2 = os.Getenv("DISABLE_HTTP2") == "true"
+	opts.Apply(server)
+
+	max := 0
+	if value := os.Getenv("MAX_CONCURRENT_REQUESTS"); value != "" {
+		var err error
+		if max, err = strconv.Atoi(value); err != nil || max < 0 {
+			logrus.Fatalf("invalid MAX_CONCURRENT_REQUESTS %q, expected a positive integer or 0 (unlimited)", value)
+		}
+	}
+	if max > 0 {
+		logrus.Infof("Answering up to %d admission requests concurrently", max)
+	}
+	return serving.NewLimiter(max)
+}
+
+// serverTLSConfig returns the TLS configuration of the admission server serving
+// the certificate of getCertificate, with the minimum version and the TLS 1.2
+// cipher suites set by the TLS_MIN_VERSION (1.2 by default) and TLS_CIPHER_SUITES
+// env vars. The client certificates of the API server are verified against the
+// TLS_CLIENT_CA_FILE CA bundle when set.
+func serverTLSConfig(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) *tls.Config {
+	opts := certs.TLSOptions{
+		MinVersion:   os.Getenv("TLS_MIN_VERSION"),
+		ClientCAFile: os.Getenv("TLS_CLIENT_CA_FILE"),
+	}
+	if suites := os.Getenv("TLS_CIPHER_SUITES"); suites != "" {
+		opts.CipherSuites = strings.Split(suites, ",")
+	}
+	config, err := certs.ServerConfig(getCertificate, opts)
+	if err != nil {
+		logrus.Fatalf("cannot set TLS parameters: %v", err)
+	}
+	if config.ClientCAs != nil {
+		logrus.Infof("Verifying the client certificates of the API server against %s", opts.ClientCAFile)
+	}
+	return config
+}
+
+// Default delays of the graceful shutdown, see shutdown
+const (
+	defaultShutdownDelay   = 5 * time.Second
+	defaultShutdownTimeout = 30 * time.Second
+)
+
+// shutdownDelays returns the delays of the graceful shutdown, set by the
+// SHUTDOWN_DELAY and SHUTDOWN_TIMEOUT env vars
+func shutdownDelays() (delay, timeout time.Duration) {
+	delay, timeout = defaultShutdownDelay, defaultShutdownTimeout
+	if value := os.Getenv("SHUTDOWN_DELAY"); value != "" {
+		var err error
+		if delay, err = time.ParseDuration(value); err != nil || delay < 0 {
+			logrus.Fatalf("invalid SHUTDOWN_DELAY %q, expected a duration", value)
+		}
+	}
+	if value := os.Getenv("SHUTDOWN_TIMEOUT"); value != "" {
+		var err error
+		if timeout, err = time.ParseDuration(value); err != nil || timeout <= 0 {
+			logrus.Fatalf("invalid SHUTDOWN_TIMEOUT %q, expected a positive duration", value)
+		}
+	}
+	return delay, timeout
+}
+
+// shutdown drains the servers of the webhook on SIGTERM: the webhook gets unready
+// and keeps answering the admission requests for delay, the time for its endpoint
+// to be removed from the Service, then stops accepting new connections and waits
+// up to timeout for the requests in flight before the process exits. Otherwise a
+// rolling restart times out the requests routed to the terminating replica.
+func shutdown(delay, timeout time.Duration, server, adminServer *http.Server, evaluationServer *grpc.Server) {
+	logrus.Infof("Shutting down, draining admission requests for %s", delay)
+	healthChecker.Shutdown()
+	// connections are closed after each response so that the API server reconnects
+	// to the endpoints left
+	server.SetKeepAlivesEnabled(false)
+	time.Sleep(delay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	if evaluationServer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stopped := make(chan struct{})
+			go func() {
+				evaluationServer.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+				evaluationServer.Stop()
+			}
+		}()
+	}
+	for _, s := range []*http.Server{server, adminServer} {
+		if s == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(s *http.Server) {
+			defer wg.Done()
+			if err := s.Shutdown(ctx); err != nil {
+				logrus.Warnf("cannot drain the requests in flight on %s within %s: %v", s.Addr, timeout, err)
+			}
+		}(s)
 	}
+	wg.Wait()
 }
 
 // ServeHealth returns 200 when things are good
@@ -39,31 +485,78 @@ func ServeHealth(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, "OK")
 }
 
+// admissionDeadline bounds ctx by the timeout the API server waits for the answer,
+// passed in the timeout query parameter, keeping a tenth of it to write the answer
+func admissionDeadline(ctx context.Context, r *http.Request) (context.Context, context.CancelFunc) {
+	timeout, err := time.ParseDuration(r.URL.Query().Get("timeout"))
+	if err != nil || timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout*9/10)
+}
+
+// newAdmitter returns an Admitter of request with the settings in effect, which
+// may be reloaded concurrently
+func newAdmitter(logger *logrus.Entry, request *admissionv1.AdmissionRequest) admission.Admitter {
+	reloadMu.RLock()
+	defer reloadMu.RUnlock()
+
+	return admission.Admitter{
+		Logger:  logger,
+		Request: request,
+
+		ValidationPolicy: validationPolicy,
+		MutationPolicy:   mutationPolicy,
+		Resolver:         uidResolver,
+		Scope:            namespaceScope,
+		Exemptions:       exemptions,
+		Modes:            modePolicy,
+		Events:           eventRecorder,
+		Reports:          accessReports,
+		Notifier:         notifier,
+		AuditLog:         auditLog,
+		NFS:              nfsDetector,
+		FailOpen:         failOpen,
+		Messages:         denialMessages,
+		RemediationHints: remediationHints,
+		Decisions:        decisionCache,
+		RateLimits:       rateLimits,
+		Shadow:           shadow,
+	}
+}
+
 // ServeValidatePods validates an admission request and then writes an admission
 // review to `w`
 func ServeValidatePods(w http.ResponseWriter, r *http.Request) {
+	defer metrics.ObserveRequestDuration("validate", time.Now())
+	ctx, span := tracing.StartAdmission(r, "validate")
+	defer span.End()
+	ctx, cancel := admissionDeadline(ctx, r)
+	defer cancel()
 	logger := logrus.WithField("uri", r.RequestURI)
 	logger.Debug("received validation request")
 
 	in, err := parseRequest(*r)
 	if err != nil {
 		logger.Error(err)
+		span.SetStatus(codes.Error, err.Error())
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	logger = requestLogger(logger, in.Request)
+	span.SetAttributes(tracing.AdmissionAttributes(in.Request)...)
 
-	adm := admission.Admitter{
-		Logger:  logger,
-		Request: in.Request,
-	}
-
-	out, err := adm.ValidatePodReview()
+	adm := newAdmitter(logger, in.Request)
+	out, err := adm.ValidatePodReview(ctx)
 	if err != nil {
 		e := fmt.Sprintf("could not generate admission response: %v", err)
 		logger.Error(e)
 		http.Error(w, e, http.StatusInternalServerError)
 		return
 	}
+	if recorder != nil {
+		recorder.Record("validate", currentMappingVersion(), in.Request, out.Response)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	jout, err := json.Marshal(out)
@@ -74,30 +567,75 @@ func ServeValidatePods(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	logger.Debug("sending response")
-	logger.Debugf("%s", jout)
+	logger.WithField("response", string(jout)).Debug("sending response")
 	fmt.Fprintf(w, "%s", jout)
 }
 
 // ServeMutatePods returns an admission review with pod mutations as a json patch
 // in the review response
 func ServeMutatePods(w http.ResponseWriter, r *http.Request) {
+	defer metrics.ObserveRequestDuration("mutate", time.Now())
+	ctx, span := tracing.StartAdmission(r, "mutate")
+	defer span.End()
+	ctx, cancel := admissionDeadline(ctx, r)
+	defer cancel()
 	logger := logrus.WithField("uri", r.RequestURI)
 	logger.Debug("received mutation request")
 
 	in, err := parseRequest(*r)
 	if err != nil {
 		logger.Error(err)
+		span.SetStatus(codes.Error, err.Error())
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	logger = requestLogger(logger, in.Request)
+	span.SetAttributes(tracing.AdmissionAttributes(in.Request)...)
 
-	adm := admission.Admitter{
-		Logger:  logger,
-		Request: in.Request,
+	adm := newAdmitter(logger, in.Request)
+	out, err := adm.MutatePodReview(ctx)
+	if err != nil {
+		e := fmt.Sprintf("could not generate admission response: %v", err)
+		logger.Error(e)
+		http.Error(w, e, http.StatusInternalServerError)
+		return
+	}
+	if recorder != nil {
+		recorder.Record("mutate", currentMappingVersion(), in.Request, out.Response)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	jout, err := json.Marshal(out)
+	if err != nil {
+		e := fmt.Sprintf("could not parse admission response: %v", err)
+		logger.Error(e)
+		http.Error(w, e, http.StatusInternalServerError)
+		return
+	}
+
+	logger.WithField("response", string(jout)).Debug("sending response")
+	fmt.Fprintf(w, "%s", jout)
+}
+
+// ServeValidateMappings validates a mapping object written to the API server and
+// then writes an admission review to `w`
+func ServeValidateMappings(w http.ResponseWriter, r *http.Request) {
+	defer metrics.ObserveRequestDuration("validate-mappings", time.Now())
+	logger := logrus.WithField("uri", r.RequestURI)
+	logger.Debug("received mapping validation request")
+
+	in, err := parseRequest(*r)
+	if err != nil {
+		logger.Error(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	logger = requestLogger(logger, in.Request)
 
-	out, err := adm.MutatePodReview()
+	adm := *mappingAdmitter
+	adm.Logger = logger
+	adm.Request = in.Request
+	out, err := adm.ValidateMappingReview()
 	if err != nil {
 		e := fmt.Sprintf("could not generate admission response: %v", err)
 		logger.Error(e)
@@ -114,15 +652,155 @@ func ServeMutatePods(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	logger.Debug("sending response")
-	logger.Debugf("%s", jout)
+	logger.WithField("response", string(jout)).Debug("sending response")
 	fmt.Fprintf(w, "%s", jout)
 }
 
+// requestLogger returns logger with the fields identifying an admission request
+func requestLogger(logger *logrus.Entry, req *admissionv1.AdmissionRequest) *logrus.Entry {
+	return logger.WithFields(logrus.Fields{
+		"request_uid": req.UID,
+		"namespace":   req.Namespace,
+		"operation":   req.Operation,
+		"user":        req.UserInfo.Username,
+	})
+}
+
+// setConfig loads the configuration file named by the CONFIG_FILE env var, if
+// any, its settings apply to the env vars that are not set. Every setting of the
+// file is validated before any is applied. It returns the loaded configuration.
+func setConfig() *config.Config {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return nil
+	}
+	c, err := config.Load(path)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		logrus.Fatalf("invalid config file %s: %v", path, err)
+	}
+	names, err := c.Apply()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	for _, name := range names {
+		configEnv[name] = true
+	}
+	return c
+}
+
+// configEnv holds the names of the env vars set by the config file, only these
+// follow the changes of the file
+var configEnv = map[string]bool{}
+
+// watchConfig applies the changes of the config file loaded at startup, if
+// any, without restarting the webhook: the log level, the namespace scope and
+// enforcement modes, and the resolver backend settings. Other changes are logged
+// and take effect on the next restart.
+func watchConfig(c *config.Config) {
+	if c == nil {
+		return
+	}
+	watcher := config.NewWatcher(os.Getenv("CONFIG_FILE"), c, reloadConfig)
+	if err := watcher.Run(make(chan struct{})); err != nil {
+		logrus.Fatal(err)
+	}
+	logrus.Infof("Watching config file %s", os.Getenv("CONFIG_FILE"))
+}
+
+// reloadConfig applies the changed settings of the config file, settings
+// overridden by env vars or flags are left untouched. Invalid settings are logged
+// and the previous ones stay in effect.
+func reloadConfig(changes []config.Change) {
+	logger := logrus.WithField("component", "config")
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	var enforcement, backend bool
+	var restart []string
+	for _, c := range changes {
+		if !configEnv[c.Name] && os.Getenv(c.Name) != "" {
+			logger.Infof("%s changed from %q to %q but is set by an env var or flag, ignoring it", c.Name, c.Old, c.New)
+			continue
+		}
+		logger.Infof("%s changed from %q to %q", c.Name, c.Old, c.New)
+		configEnv[c.Name] = true
+		if c.New == "" {
+			os.Unsetenv(c.Name)
+		} else {
+			os.Setenv(c.Name, c.New)
+		}
+
+		switch {
+		case c.Name == "LOG_LEVEL":
+			level, err := logrus.ParseLevel(c.New)
+			if c.New == "" {
+				level, err = logrus.InfoLevel, nil
+			}
+			if err != nil {
+				logger.Errorf("cannot set LOG_LEVEL to %q", c.New)
+				continue
+			}
+			logrus.SetLevel(level)
+		case c.Name == "ENFORCED_NAMESPACES" || c.Name == "EXCLUDED_NAMESPACES" ||
+			c.Name == "ENFORCEMENT_MODE" || c.Name == "NAMESPACE_ENFORCEMENT_MODES":
+			enforcement = true
+		case backendSetting(c.Name):
+			backend = true
+		default:
+			restart = append(restart, c.Name)
+		}
+	}
+
+	if enforcement {
+		scope, modes, err := parseEnforcement()
+		if err != nil {
+			logger.Errorf("keeping the previous enforcement settings: %v", err)
+		} else {
+			namespaceScope, modePolicy = scope, modes
+			logger.Info("Reloaded the namespace scope and enforcement modes")
+			if os.Getenv("ENABLE_WEBHOOK_REGISTRATION") == "true" && os.Getenv("GENERATE_MATCH_CONDITIONS") == "true" {
+				logger.Warn("the generated matchConditions follow the namespace scope on the next restart")
+			}
+		}
+	}
+	if backend {
+		r, breaker, err := newResolver(resolverOptions)
+		if err != nil {
+			logger.Errorf("keeping the previous resolver backend: %v", err)
+		} else {
+			// the new circuit breaker, if any, starts closed
+			uidResolver, failOpen = r, breaker
+			metrics.SetFailOpen(false)
+			decisionCache.Purge()
+		}
+	}
+	if len(restart) > 0 {
+		logger.Warnf("%s changed, restart the webhook to apply the change", strings.Join(restart, ", "))
+	}
+}
+
+// backendSetting returns true if the env var named name configures the resolver
+// backend, which is created again when it changes
+func backendSetting(name string) bool {
+	switch name {
+	case "MAPPING_BACKEND", "TRANSIENT_ERROR_RETRIES", "TRANSIENT_ERROR_BACKOFF", "FAILURE_POLICY", "FAIL_OPEN_WINDOW":
+		return true
+	}
+	for _, prefix := range []string{"LDAP_", "REST_", "VAULT_"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // setLogger sets the logger using env vars, it defaults to text logs on
-// debug level unless otherwise specified
+// info level unless otherwise specified
 func setLogger() {
-	logrus.SetLevel(logrus.DebugLevel)
+	logrus.SetLevel(logrus.InfoLevel)
 
 	lev := os.Getenv("LOG_LEVEL")
 	if lev != "" {
@@ -138,6 +816,1401 @@ func setLogger() {
 	}
 }
 
+// setTracing exports OpenTelemetry spans of admission requests over OTLP when
+// the ENABLE_TRACING env var is "true", the exporter is configured by the
+// standard OTEL_EXPORTER_OTLP_* env vars. It returns the function flushing the
+// pending spans on shutdown, nil when disabled.
+func setTracing() func(context.Context) error {
+	if os.Getenv("ENABLE_TRACING") != "true" {
+		return nil
+	}
+	flush, err := tracing.Setup(context.Background(), os.Getenv)
+	if err != nil {
+		logrus.Fatalf("cannot set up tracing: %v", err)
+	}
+	logrus.Info("Exporting traces over OTLP")
+	return flush
+}
+
+// parseEnforcement returns the namespaces validated and mutated, set by the
+// ENFORCED_NAMESPACES and EXCLUDED_NAMESPACES env vars, and their enforcement
+// modes, set by the ENFORCEMENT_MODE and NAMESPACE_ENFORCEMENT_MODES env vars
+func parseEnforcement() (admission.NamespaceScope, admission.ModePolicy, error) {
+	scope, err := admission.ParseNamespaceScope(os.Getenv("ENFORCED_NAMESPACES"), os.Getenv("EXCLUDED_NAMESPACES"))
+	if err != nil {
+		return scope, admission.ModePolicy{}, fmt.Errorf("cannot set namespace scope: %v", err)
+	}
+	modes, err := admission.ParseModePolicy(os.Getenv("ENFORCEMENT_MODE"), os.Getenv("NAMESPACE_ENFORCEMENT_MODES"))
+	if err != nil {
+		return scope, modes, fmt.Errorf("cannot set enforcement mode: %v", err)
+	}
+	return scope, modes, nil
+}
+
+// setPolicy sets the validation and mutation policies using env vars, by default
+// pods that don't set runAsUser are allowed, fsGroupChangePolicy is not injected
+// and pods of every namespace are validated and mutated in enforce mode. The NFS
+// exports mounted by pods are validated against the export policy file named by
+// the EXPORT_POLICY_FILE env var, if any, and the exports matching the patterns of
+// the READ_ONLY_EXPORTS env var must be mounted read-only. Pods running as root
+// are denied unless the BLOCK_ROOT_UID env var is "false", and pods running as a
+// UID below the MIN_UID env var (1000 by default) are denied, even if mapped.
+// Pods that don't set runAsNonRoot to true are denied when the
+// REQUIRE_RUN_AS_NON_ROOT env var is "true", and pods that don't set hostUsers to
+// false when the REQUIRE_USER_NAMESPACES env var is "true". The UIDs and GIDs of
+// pods running in a user namespace are not validated against the mappings when the
+// RELAX_USER_NAMESPACES env var is "true". Pods targeting Windows nodes are handled
+// as set by the WINDOWS_POD_POLICY env var: skip (default), validate or deny. Pods
+// mounting NFS with hostNetwork, hostPID or hostIPC are denied when the
+// DENY_HOST_NAMESPACES env var is "true". The validators applied and their order
+// are set by the VALIDATOR_CHAIN env var, e.g. "uid_validator,gid_validator", all
+// of them by default, and their mode by the VALIDATOR_MODES env var, e.g.
+// "gid_validator=audit", enforce by default. Validators are applied concurrently
+// unless the PARALLEL_VALIDATION env var is "false", and either the first denial
+// or all of them are returned as set by the VALIDATOR_AGGREGATION env var:
+// first-deny (default) or collect-all.
+func setPolicy() {
+	validationPolicy.RequireRunAsUser = os.Getenv("REQUIRE_RUN_AS_USER") == "true"
+	validationPolicy.RequireRunAsNonRoot = os.Getenv("REQUIRE_RUN_AS_NON_ROOT") == "true"
+	validationPolicy.RequireUserNamespaces = os.Getenv("REQUIRE_USER_NAMESPACES") == "true"
+	validationPolicy.RelaxUserNamespaces = os.Getenv("RELAX_USER_NAMESPACES") == "true"
+	validationPolicy.DenyHostNamespaces = os.Getenv("DENY_HOST_NAMESPACES") == "true"
+	validationPolicy.BlockRootUID = os.Getenv("BLOCK_ROOT_UID") != "false"
+	minUID, err := parseMinUID()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	validationPolicy.MinUID = minUID
+	validationPolicy.WindowsPods, err = validation.ParseWindowsPolicy(os.Getenv("WINDOWS_POD_POLICY"))
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	validationPolicy.Chain, err = validation.ParseChain(os.Getenv("VALIDATOR_CHAIN"), os.Getenv("VALIDATOR_MODES"))
+	if err != nil {
+		logrus.Fatalf("cannot parse the validator chain: %v", err)
+	}
+	validationPolicy.Parallel = os.Getenv("PARALLEL_VALIDATION") != "false"
+	validationPolicy.Aggregation, err = validation.ParseAggregation(os.Getenv("VALIDATOR_AGGREGATION"))
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	changePolicy := corev1.PodFSGroupChangePolicy(os.Getenv("FS_GROUP_CHANGE_POLICY"))
+	switch changePolicy {
+	case "", corev1.FSGroupChangeOnRootMismatch, corev1.FSGroupChangeAlways:
+		mutationPolicy.FSGroupChangePolicy = changePolicy
+	default:
+		logrus.Fatalf("cannot set FS_GROUP_CHANGE_POLICY to %q", changePolicy)
+	}
+
+	namespaceScope, modePolicy, err = parseEnforcement()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	remediationHints = os.Getenv("REMEDIATION_HINTS") != "false"
+	if name := os.Getenv("DENIAL_MESSAGES_FILE"); name != "" {
+		denialMessages, err = messages.LoadFile(name)
+		if err != nil {
+			logrus.Fatalf("cannot set denial messages: %v", err)
+		}
+		logrus.Infof("Rendering denial messages with %d code templates", len(denialMessages.Codes))
+	}
+	if name := os.Getenv("EXPORT_POLICY_FILE"); name != "" {
+		validationPolicy.Exports, err = exports.LoadFile(name)
+		if err != nil {
+			logrus.Fatalf("cannot set export policy: %v", err)
+		}
+		logrus.Infof("Validating NFS exports with %d export rules", len(validationPolicy.Exports.Rules))
+	}
+	if value := os.Getenv("READ_ONLY_EXPORTS"); value != "" {
+		patterns, err := exports.ParseReadOnlyPatterns(value)
+		if err != nil {
+			logrus.Fatalf("cannot set read-only exports: %v", err)
+		}
+		if validationPolicy.Exports == nil {
+			validationPolicy.Exports = &exports.Policy{}
+		}
+		validationPolicy.Exports.ReadOnlyPatterns = patterns
+		logrus.Infof("Requiring read-only mounts of NFS exports matching %v", patterns)
+	}
+}
+
+// setClient initializes the Kubernetes client from the in-cluster configuration,
+// or from the kubeconfig file outside of the cluster
+func setClient(kubeconfig string) (*rest.Config, kubernetes.Interface) {
+	config, err := mapping.NewConfig(kubeconfig)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		logrus.Fatalf("cannot create Kubernetes client: %v", err)
+	}
+	return config, client
+}
+
+// setResolver starts watching the mapping ConfigMaps in the webhook namespace
+// (or the objects described by the MAPPING_SOURCE_KIND, MAPPING_SOURCE_NAMESPACE,
+// UID_MAPPING_NAME and GID_MAPPING_NAME env vars), the mapping objects of every
+// namespace when the ENABLE_NAMESPACE_MAPPINGS env var is "true", as well as
+// UIDMapping resources when the ENABLE_UIDMAPPING_CRD env var is "true". It blocks
+// until the cache is synced, then creates the resolver backend named by the
+// MAPPING_BACKEND env var (configmap by default). The configmap backend is only
+// ready while the UID mapping object exists. The Kerberos credentials of pods are
+// validated against the Kerberos mapping object (named by the KRB5_MAPPING_NAME
+// env var) when the ENABLE_KRB5_VALIDATION env var is "true", and the runAsUserName
+// of Windows pods against the Windows mapping object (named by the
+// WINDOWS_MAPPING_NAME env var) when the WINDOWS_POD_POLICY env var is "validate".
+// The seLinuxOptions of pods mounting NFS are validated against the seLinux of the
+// entries of the mapping document when the ENABLE_SELINUX_VALIDATION env var is "true",
+// and their creation time against the windows of these entries when the
+// ENABLE_TIME_WINDOWS env var is "true". The mappings are persisted to the
+// MAPPING_SNAPSHOT_FILE file, if set, and served from it when the API server is
+// unreachable at startup, unless older than MAPPING_SNAPSHOT_MAX_AGE (24h by default).
+// It returns the mapping cache.
+func setResolver(config *rest.Config, client kubernetes.Interface) *mapping.Store {
+	namespace, err := mapping.Namespace()
+	if err != nil {
+		logrus.Fatalf("cannot read webhook namespace: %v", err)
+	}
+
+	source := mapping.Source{
+		Kind:        os.Getenv("MAPPING_SOURCE_KIND"),
+		Namespace:   os.Getenv("MAPPING_SOURCE_NAMESPACE"),
+		UIDName:     os.Getenv("UID_MAPPING_NAME"),
+		GIDName:     os.Getenv("GID_MAPPING_NAME"),
+		Krb5Name:    os.Getenv("KRB5_MAPPING_NAME"),
+		WindowsName: os.Getenv("WINDOWS_MAPPING_NAME"),
+	}
+	if source.Namespace == "" {
+		source.Namespace = namespace
+	}
+	mappings, err := mapping.NewStoreFromSource(client, source)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	enableMappingSources(config, client, mappings)
+
+	if path := os.Getenv("MAPPING_SNAPSHOT_FILE"); path != "" {
+		maxAge := mapping.DefaultSnapshotMaxAge
+		if value := os.Getenv("MAPPING_SNAPSHOT_MAX_AGE"); value != "" {
+			if maxAge, err = time.ParseDuration(value); err != nil || maxAge <= 0 {
+				logrus.Fatalf("invalid MAPPING_SNAPSHOT_MAX_AGE %q, expected a positive duration", value)
+			}
+		}
+		if err := mappings.EnableSnapshot(path, maxAge); err != nil {
+			logrus.Fatal(err)
+		}
+		logrus.Infof("Persisting the mappings to snapshot %s, served for up to %s when the API server is unreachable at startup", path, maxAge)
+	}
+
+	if err := mappings.Start(make(chan struct{})); err != nil {
+		logrus.Fatal(err)
+	}
+	source = mappings.Source()
+	logrus.Infof("Watching mapping %ss %s and %s in namespace %s", source.Kind, source.UIDName, source.GIDName, source.Namespace)
+
+	if os.Getenv("ENABLE_KRB5_VALIDATION") == "true" {
+		validationPolicy.Principals = mappings
+		logrus.Infof("Validating Kerberos credentials with mapping %s %s", source.Kind, source.Krb5Name)
+	}
+	if os.Getenv("ENABLE_SELINUX_VALIDATION") == "true" {
+		validationPolicy.SELinux = mappings
+		logrus.Infof("Validating the seLinuxOptions of pods mounting NFS with the %s document of mapping %s %s", mapping.DocumentKey, source.Kind, source.UIDName)
+	}
+	if os.Getenv("ENABLE_TIME_WINDOWS") == "true" {
+		validationPolicy.TimeWindows = mappings
+		logrus.Infof("Restricting pods mounting NFS to the time windows of the %s document of mapping %s %s", mapping.DocumentKey, source.Kind, source.UIDName)
+	}
+	if validationPolicy.WindowsPods == validation.WindowsValidate {
+		validationPolicy.WindowsUserNames = mappings
+		logrus.Infof("Validating Windows user names with mapping %s %s", source.Kind, source.WindowsName)
+	}
+
+	resolverOptions = resolver.Options{
+		Mappings:  mappings,
+		Client:    client,
+		Namespace: namespace,
+		Getenv:    os.Getenv,
+	}
+	if sharedCache != nil {
+		resolverOptions.SharedCache = sharedCache
+	}
+	uidResolver, failOpen, err = newResolver(resolverOptions)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	healthChecker.AddReadinessCheck("mapping", func() error {
+		// only the configmap backend depends on the mapping objects
+		if mappingBackend() != "configmap" {
+			return nil
+		}
+		return mappings.Ready()
+	})
+	return mappings
+}
+
+// enableMappingSources watches the namespace mapping objects, the serviceAccount
+// annotations and the UIDMapping resources with mappings, when enabled by the
+// ENABLE_NAMESPACE_MAPPINGS, SERVICEACCOUNT_ANNOTATIONS and ENABLE_UIDMAPPING_CRD
+// env vars
+func enableMappingSources(config *rest.Config, client kubernetes.Interface, mappings *mapping.Store) {
+	if os.Getenv("ENABLE_NAMESPACE_MAPPINGS") == "true" {
+		mappings.EnableNamespaceMappings(client)
+		logrus.Info("Watching mapping objects of every namespace")
+	}
+
+	switch annotations := os.Getenv("SERVICEACCOUNT_ANNOTATIONS"); annotations {
+	case "", "disabled":
+	case "fallback", "override":
+		mappings.EnableServiceAccountAnnotations(client, annotations == "override")
+		logrus.Infof("Mapping serviceAccounts with their %s and %s annotations (%s)",
+			mapping.ServiceAccountUIDAnnotation, mapping.ServiceAccountGIDAnnotation, annotations)
+	default:
+		logrus.Fatalf("invalid SERVICEACCOUNT_ANNOTATIONS %q, expected disabled, fallback or override", annotations)
+	}
+
+	if os.Getenv("ENABLE_UIDMAPPING_CRD") == "true" {
+		dynamicClient, err := dynamic.NewForConfig(config)
+		if err != nil {
+			logrus.Fatalf("cannot create dynamic Kubernetes client: %v", err)
+		}
+		if err := mappings.EnableUIDMappings(dynamicClient); err != nil {
+			logrus.Fatal(err)
+		}
+		logrus.Info("Watching UIDMapping resources")
+	}
+}
+
+// setShadow evaluates the validated pods against a candidate policy and mappings
+// besides the enforced ones when the ENABLE_SHADOW_EVALUATION env var is "true",
+// logging and counting the disagreements without changing any decision. The
+// candidate mappings are read from the CANDIDATE_UID_MAPPING_NAME and
+// CANDIDATE_GID_MAPPING_NAME mapping objects, next to the enforced ones, and the
+// candidate validators are set by the CANDIDATE_VALIDATOR_CHAIN and
+// CANDIDATE_VALIDATOR_MODES env vars. Unset, they are the enforced ones.
+func setShadow(config *rest.Config, client kubernetes.Interface, mappings *mapping.Store) {
+	if os.Getenv("ENABLE_SHADOW_EVALUATION") != "true" {
+		return
+	}
+	uidName, gidName := os.Getenv("CANDIDATE_UID_MAPPING_NAME"), os.Getenv("CANDIDATE_GID_MAPPING_NAME")
+	chain, modes := os.Getenv("CANDIDATE_VALIDATOR_CHAIN"), os.Getenv("CANDIDATE_VALIDATOR_MODES")
+	if uidName == "" && gidName == "" && chain == "" && modes == "" {
+		logrus.Fatal("cannot enable shadow evaluation: no candidate mapping nor validator chain is set")
+	}
+
+	shadow = &admission.Shadow{ValidationPolicy: validationPolicy}
+	if chain != "" || modes != "" {
+		if chain == "" {
+			chain = os.Getenv("VALIDATOR_CHAIN")
+		}
+		var err error
+		if shadow.ValidationPolicy.Chain, err = validation.ParseChain(chain, modes); err != nil {
+			logrus.Fatalf("invalid candidate validator chain: %v", err)
+		}
+		logrus.Infof("Evaluating pods against the candidate validators %q with modes %q", chain, modes)
+	}
+
+	if uidName != "" || gidName != "" {
+		if mappingBackend() != "configmap" {
+			logrus.Fatal("cannot enable shadow evaluation: candidate mappings require the configmap backend")
+		}
+		source := mappings.Source()
+		if uidName != "" {
+			source.UIDName = uidName
+		}
+		if gidName != "" {
+			source.GIDName = gidName
+		}
+		candidate, err := mapping.NewStoreFromSource(client, source)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		enableMappingSources(config, client, candidate)
+		if err := candidate.Start(make(chan struct{})); err != nil {
+			logrus.Fatal(err)
+		}
+		// the documents of the enforced UID mapping object are replaced too
+		policy := &shadow.ValidationPolicy
+		if policy.Principals != nil {
+			policy.Principals = candidate
+		}
+		if policy.SELinux != nil {
+			policy.SELinux = candidate
+		}
+		if policy.TimeWindows != nil {
+			policy.TimeWindows = candidate
+		}
+		if policy.WindowsUserNames != nil {
+			policy.WindowsUserNames = candidate
+		}
+		if shadow.Resolver, err = resolver.New("configmap", resolver.Options{Mappings: candidate, Client: client, Namespace: resolverOptions.Namespace, Getenv: os.Getenv}); err != nil {
+			logrus.Fatal(err)
+		}
+		shadow.Ready = candidate.Ready
+		logrus.Infof("Evaluating pods against candidate mapping %ss %s and %s", source.Kind, source.UIDName, source.GIDName)
+	}
+}
+
+// setMappingValidation serves /validate-mappings, rejecting malformed entries of
+// the mapping objects when they are written, when the ENABLE_MAPPING_VALIDATION
+// env var is "true". The mapping objects of every namespace are validated when the
+// ENABLE_NAMESPACE_MAPPINGS env var is "true".
+func setMappingValidation(mappings *mapping.Store) {
+	if os.Getenv("ENABLE_MAPPING_VALIDATION") != "true" {
+		return
+	}
+	mappingAdmitter = &admission.MappingAdmitter{
+		Source:            mappings.Source(),
+		NamespaceMappings: os.Getenv("ENABLE_NAMESPACE_MAPPINGS") == "true",
+	}
+	logrus.Infof("Validating writes of mapping %ss %s and %s", mappingAdmitter.Source.Kind, mappingAdmitter.Source.UIDName, mappingAdmitter.Source.GIDName)
+}
+
+// mappingBackend returns the resolver backend named by the MAPPING_BACKEND env
+// var, configmap by default
+func mappingBackend() string {
+	if backend := os.Getenv("MAPPING_BACKEND"); backend != "" {
+		return backend
+	}
+	return "configmap"
+}
+
+// newResolver creates the resolver backend named by the MAPPING_BACKEND env var,
+// retrying transient errors as set by retrySettings. When the FAILURE_POLICY env
+// var is Ignore, the backend is wrapped by the returned circuit breaker (nil
+// otherwise), see parseFailurePolicy.
+func newResolver(opts resolver.Options) (resolver.UIDResolver, *resolver.CircuitBreaker, error) {
+	backend := mappingBackend()
+	r, err := resolver.New(backend, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot set MAPPING_BACKEND to %q: %v", backend, err)
+	}
+	logrus.Infof("Resolving identities with the %s backend", backend)
+
+	retries, delay, err := parseRetrySettings()
+	if err != nil {
+		return nil, nil, err
+	}
+	r = resolver.NewRetryResolver(r, retries, delay)
+
+	window, err := parseFailurePolicy()
+	if err != nil {
+		return nil, nil, err
+	}
+	var breaker *resolver.CircuitBreaker
+	if window > 0 {
+		breaker = resolver.NewCircuitBreaker(r, window)
+		r = breaker
+		logrus.Warnf("Failing open when the identity backend is unavailable for more than %s", window)
+	}
+	if namespaceDefaults != nil {
+		r = resolver.NewNamespaceDefaultResolver(r, namespaceDefaults)
+	}
+	return r, breaker, nil
+}
+
+// retrySettings is parseRetrySettings exiting on invalid settings
+func retrySettings() (int, time.Duration) {
+	retries, delay, err := parseRetrySettings()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	return retries, delay
+}
+
+// parseMinUID returns the lowest UID pods may run as, set by the MIN_UID env var
+// (1000 by default), 0 disables the threshold
+func parseMinUID() (int64, error) {
+	value := os.Getenv("MIN_UID")
+	if value == "" {
+		return 1000, nil
+	}
+	minUID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || minUID < 0 || minUID > mapping.MaxID {
+		return 0, fmt.Errorf("invalid MIN_UID %q, expected a UID", value)
+	}
+	return minUID, nil
+}
+
+// parseRetrySettings returns how many times identity lookups and SubjectAccessReviews
+// failing with a transient error (timeouts, throttling, connection resets) are
+// retried within the admission deadline, set by the TRANSIENT_ERROR_RETRIES env var
+// (2 by default), and the delay before the first retry, doubled after each retry,
+// set by the TRANSIENT_ERROR_BACKOFF env var (50ms by default)
+func parseRetrySettings() (int, time.Duration, error) {
+	retries := 2
+	if value := os.Getenv("TRANSIENT_ERROR_RETRIES"); value != "" {
+		var err error
+		if retries, err = strconv.Atoi(value); err != nil || retries < 0 {
+			return 0, 0, fmt.Errorf("invalid TRANSIENT_ERROR_RETRIES %q, expected a number of retries", value)
+		}
+	}
+	delay := 50 * time.Millisecond
+	if value := os.Getenv("TRANSIENT_ERROR_BACKOFF"); value != "" {
+		var err error
+		if delay, err = time.ParseDuration(value); err != nil {
+			return 0, 0, fmt.Errorf("invalid TRANSIENT_ERROR_BACKOFF %q: %v", value, err)
+		}
+	}
+	return retries, delay, nil
+}
+
+// parseFailurePolicy returns how pods are admitted when the identity backend
+// fails, with the FAILURE_POLICY env var: Fail (default) rejects them and returns
+// a zero window, Ignore admits them without enforcement once every lookup has
+// failed for the returned window, set by FAIL_OPEN_WINDOW (1m by default), until
+// the backend answers again.
+func parseFailurePolicy() (time.Duration, error) {
+	switch policy := os.Getenv("FAILURE_POLICY"); policy {
+	case "", "Fail":
+		return 0, nil
+	case "Ignore":
+	default:
+		return 0, fmt.Errorf("invalid FAILURE_POLICY %q, expected Fail or Ignore", policy)
+	}
+
+	window := time.Minute
+	if value := os.Getenv("FAIL_OPEN_WINDOW"); value != "" {
+		var err error
+		if window, err = time.ParseDuration(value); err != nil || window <= 0 {
+			return 0, fmt.Errorf("invalid FAIL_OPEN_WINDOW %q, expected a positive duration", value)
+		}
+	}
+	return window, nil
+}
+
+// setIdmapController renders the mappings into the nfs-pod-access-control-idmap
+// ConfigMap of the webhook namespace (or the one named by the IDMAP_CONFIGMAP_NAME
+// env var) when the ENABLE_IDMAP_CONTROLLER env var is "true", as idmapd.conf
+// static entries and nfsidmap keyring entries of the NFSv4 domain set by the
+// IDMAP_DOMAIN env var
+func setIdmapController(client kubernetes.Interface, mappings *mapping.Store) {
+	if os.Getenv("ENABLE_IDMAP_CONTROLLER") != "true" {
+		return
+	}
+	domain := os.Getenv("IDMAP_DOMAIN")
+	if domain == "" {
+		logrus.Fatal("cannot render idmap ConfigMap: IDMAP_DOMAIN is not set")
+	}
+	namespace, err := mapping.Namespace()
+	if err != nil {
+		logrus.Fatalf("cannot read webhook namespace: %v", err)
+	}
+
+	controller := idmap.NewController(client, mappings, namespace, domain)
+	if name := os.Getenv("IDMAP_CONFIGMAP_NAME"); name != "" {
+		controller.Name = name
+	}
+	if err := controller.Run(make(chan struct{})); err != nil {
+		logrus.Fatal(err)
+	}
+	logrus.Infof("Rendering the mappings into ConfigMap %s for NFSv4 domain %s", controller.Name, domain)
+}
+
+// setAllocator allocates the next free UID of the range set by the
+// UID_ALLOCATION_RANGE env var to every serviceAccount labeled
+// nfs-access-control/allocate=true that isn't mapped yet, writing it to the UID
+// mapping object, when the ENABLE_UID_ALLOCATION env var is "true". It requires
+// the configmap backend and blocks until the serviceAccount cache is synced.
+func setAllocator(client kubernetes.Interface, mappings *mapping.Store) {
+	if os.Getenv("ENABLE_UID_ALLOCATION") != "true" {
+		return
+	}
+	if mappingBackend() != "configmap" {
+		logrus.Fatalf("cannot allocate UIDs with the %s backend, only the configmap backend reads them", mappingBackend())
+	}
+	uids, err := allocator.ParseRange(os.Getenv("UID_ALLOCATION_RANGE"))
+	if err != nil {
+		logrus.Fatalf("invalid UID_ALLOCATION_RANGE: %v", err)
+	}
+
+	a := allocator.NewAllocator(client, mappings, uids)
+	if err := a.Run(make(chan struct{})); err != nil {
+		logrus.Fatal(err)
+	}
+	logrus.Infof("Allocating UIDs %s to serviceAccounts labeled %s=true", mapping.IDRanges{uids}, allocator.AllocateLabel)
+}
+
+// setExemptions enables the exemption label or annotation of pods and namespaces
+// when the ENABLE_EXEMPTIONS env var is "true", exemptions are only honored for
+// requesters allowed to use the exemptions.nfsaccess.io resource unless the
+// EXEMPTIONS_REQUIRE_AUTHORIZATION env var is "false". Break-glass overrides,
+// honored for requesters allowed to use the uidoverride.nfsaccess.io resource,
+// are enabled when the ENABLE_BREAK_GLASS env var is "true".
+func setExemptions(client kubernetes.Interface) {
+	labels := os.Getenv("ENABLE_EXEMPTIONS") == "true"
+	breakGlass := os.Getenv("ENABLE_BREAK_GLASS") == "true"
+	if !labels && !breakGlass {
+		return
+	}
+
+	exemptions = exemption.NewChecker(client)
+	exemptions.Labels = labels
+	exemptions.RequireAuthorization = os.Getenv("EXEMPTIONS_REQUIRE_AUTHORIZATION") != "false"
+	exemptions.BreakGlass = breakGlass
+	exemptions.Backoff.Retries, exemptions.Backoff.Delay = retrySettings()
+	if err := exemptions.Start(make(chan struct{})); err != nil {
+		logrus.Fatal(err)
+	}
+	if labels {
+		logrus.Infof("Honoring %s exemptions (authorization required: %t)", exemption.EnforceKey, exemptions.RequireAuthorization)
+	}
+	if breakGlass {
+		logrus.Infof("Honoring %s break-glass overrides", exemption.OverrideKey)
+	}
+}
+
+// setNamespaceDefaults resolves the users and serviceAccounts without a mapping
+// to the nfs-access-control/default-uid and nfs-access-control/default-gids
+// annotations of the namespace of their pods when the ENABLE_NAMESPACE_DEFAULTS
+// env var is "true". It must be called before setResolver.
+func setNamespaceDefaults(client kubernetes.Interface) {
+	if os.Getenv("ENABLE_NAMESPACE_DEFAULTS") != "true" {
+		return
+	}
+	ranges := uidrange.NewRanges(client)
+	if err := ranges.Start(make(chan struct{})); err != nil {
+		logrus.Fatal(err)
+	}
+	namespaceDefaults = ranges
+	logrus.Infof("Defaulting unmapped users and serviceAccounts to the %s and %s annotations of namespaces",
+		uidrange.DefaultUIDAnnotation, uidrange.DefaultGIDAnnotation)
+}
+
+// setNamespaceUIDRanges restricts the runAsUser of pods to the UID range set by the
+// nfs-access-control/uid-range annotation of their namespace when the
+// ENABLE_NAMESPACE_UID_RANGES env var is "true", whether the UID is mapped or not.
+// When the ENABLE_OPENSHIFT_UID_RANGES env var is "true", users and serviceAccounts
+// without a UID mapping may run as the UIDs of the openshift.io/sa.scc.uid-range
+// annotation of their namespace, i.e. the UIDs assigned by SecurityContextConstraints.
+func setNamespaceUIDRanges(client kubernetes.Interface) {
+	namespaceRanges := os.Getenv("ENABLE_NAMESPACE_UID_RANGES") == "true"
+	openShiftRanges := os.Getenv("ENABLE_OPENSHIFT_UID_RANGES") == "true"
+	if !namespaceRanges && !openShiftRanges {
+		return
+	}
+	ranges := uidrange.NewRanges(client)
+	if err := ranges.Start(make(chan struct{})); err != nil {
+		logrus.Fatal(err)
+	}
+	if namespaceRanges {
+		validationPolicy.NamespaceRanges = ranges
+		logrus.Infof("Restricting runAsUser to the %s annotation of namespaces", uidrange.Annotation)
+	}
+	if openShiftRanges {
+		validationPolicy.SCCRanges = ranges
+		logrus.Infof("Allowing unmapped users the UIDs of the %s annotation of namespaces", uidrange.OpenShiftAnnotation)
+	}
+}
+
+// serveMetrics serves the Prometheus metrics on /metrics in the background, over
+// clear text http on the address set by the METRICS_ADDR env var (:9090 by default)
+func serveMetrics() {
+	addr := os.Getenv("METRICS_ADDR")
+	if addr == "" {
+		addr = ":9090"
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	go func() {
+		logrus.Printf("Serving metrics on %s...", addr)
+		logrus.Fatal(http.ListenAndServe(addr, mux))
+	}()
+}
+
+// serveDiagnostics serves pprof profiles, expvar variables, the effective
+// configuration and the content of the caches in the background on the address
+// set by the DEBUG_ADDR env var, disabled when empty. The address must be bound to
+// the loopback interface, e.g. localhost:6060, as the endpoints are not
+// authenticated.
+func serveDiagnostics(mappings *mapping.Store) {
+	addr := os.Getenv("DEBUG_ADDR")
+	if addr == "" {
+		return
+	}
+	if err := diagnostics.CheckLoopback(addr); err != nil {
+		logrus.Fatalf("invalid DEBUG_ADDR: %v", err)
+	}
+
+	s := &diagnostics.Server{
+		Environ: os.Environ,
+		Caches: func() interface{} {
+			reloadMu.RLock()
+			defer reloadMu.RUnlock()
+			return diagnosticCaches{
+				MappingVersion: mappings.Version(),
+				Identities:     resolver.CachedIdentities(uidResolver),
+				AllowedPods:    decisionCache.Len(),
+				FailingOpen:    failOpen != nil && failOpen.Open(),
+			}
+		},
+		Logger: logrus.WithField("component", "diagnostics"),
+	}
+	go func() {
+		logrus.Printf("Serving diagnostics on %s...", addr)
+		logrus.Fatal(http.ListenAndServe(addr, s.Handler()))
+	}()
+}
+
+// diagnosticCaches is the content of the caches served by the diagnostics server
+type diagnosticCaches struct {
+	MappingVersion mapping.Version           `json:"mappingVersion"`
+	Identities     []resolver.CachedIdentity `json:"identities"`
+	AllowedPods    int                       `json:"allowedPods"`
+	FailingOpen    bool                      `json:"failingOpen"`
+}
+
+// serveAdmin serves the admin API managing the mapping entries, and answering
+// the identity of its requesters, in the background on the address set by the
+// ADMIN_ADDR env var, disabled when empty. The mapping entries are only served
+// with the configmap backend. It is served over https with the serving certificate
+// of the admission server unless TLS is disabled, tlsConfig being nil. The server
+// is returned to be shut down, nil when disabled.
+func serveAdmin(client kubernetes.Interface, mappings *mapping.Store, tlsConfig *tls.Config) *http.Server {
+	addr := os.Getenv("ADMIN_ADDR")
+	if addr == "" {
+		return nil
+	}
+
+	api := admin.NewServer(client, mappings.Source())
+	api.Mappings = mappingBackend() == "configmap"
+	if !api.Mappings {
+		logrus.Warnf("Not serving the mapping entries of the admin API with the %s backend, only the configmap backend reads the mapping objects", mappingBackend())
+	}
+	api.Resolver = func() resolver.UIDResolver {
+		reloadMu.RLock()
+		defer reloadMu.RUnlock()
+		return uidResolver
+	}
+	server := &http.Server{Addr: addr, Handler: api.Handler(), TLSConfig: tlsConfig}
+	go func() {
+		logrus.Printf("Serving the admin API on %s...", addr)
+		if tlsConfig == nil {
+			logrus.Warn("Serving the admin API over clear text http, bearer tokens are not protected")
+			if err := server.ListenAndServe(); err != http.ErrServerClosed {
+				logrus.Fatal(err)
+			}
+			return
+		}
+		err := server.ListenAndServeTLS("", "")
+		if err != http.ErrServerClosed {
+			logrus.Fatal(err)
+		}
+	}()
+	return server
+}
+
+// serveEvaluation serves the PolicyEvaluation gRPC service in the background on
+// the address set by the EVALUATION_ADDR env var, disabled when empty. Pods are
+// evaluated with the settings of the admission server, over TLS with its serving
+// certificate unless TLS is disabled, tlsConfig being nil. Callers are
+// authenticated and authorized with client. The server is returned to be shut
+// down, nil when disabled.
+func serveEvaluation(client kubernetes.Interface, tlsConfig *tls.Config) *grpc.Server {
+	addr := os.Getenv("EVALUATION_ADDR")
+	if addr == "" {
+		return nil
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		logrus.Fatalf("cannot listen on EVALUATION_ADDR %s: %v", addr, err)
+	}
+
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(opts...)
+	evaluationpb.RegisterPolicyEvaluationServer(server, evaluation.NewServer(client, newAdmitter))
+	reflection.Register(server)
+	go func() {
+		logrus.Printf("Serving the policy evaluation gRPC service on %s...", addr)
+		if err := server.Serve(listener); err != nil {
+			logrus.Fatal(err)
+		}
+	}()
+	return server
+}
+
+// setEvents emits an Event about every rejected pod, attached to its owning
+// workload, unless the ENABLE_EVENTS env var is "false"
+func setEvents(client kubernetes.Interface) {
+	if os.Getenv("ENABLE_EVENTS") == "false" {
+		return
+	}
+	eventRecorder = events.NewRecorder(client)
+	logrus.Infof("Emitting %s Events on rejected pods", events.ReasonDenied)
+}
+
+// setAccessReports records the pods rejected by the webhook and the violations
+// found by the compliance scan in the NFSAccessReport named by the
+// ACCESS_REPORT_NAME env var (nfs-access by default) of their namespace when the
+// ENABLE_ACCESS_REPORTS env var is "true", written every ACCESS_REPORT_INTERVAL
+// (30s by default).
+func setAccessReports(config *rest.Config) {
+	if os.Getenv("ENABLE_ACCESS_REPORTS") != "true" {
+		return
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		logrus.Fatalf("cannot create dynamic Kubernetes client: %v", err)
+	}
+	accessReports = report.NewWriter(dynamicClient)
+	if name := os.Getenv("ACCESS_REPORT_NAME"); name != "" {
+		accessReports.Name = name
+	}
+	if value := os.Getenv("ACCESS_REPORT_INTERVAL"); value != "" {
+		if accessReports.FlushInterval, err = time.ParseDuration(value); err != nil || accessReports.FlushInterval <= 0 {
+			logrus.Fatalf("invalid ACCESS_REPORT_INTERVAL %q, expected a positive duration", value)
+		}
+	}
+	accessReports.Run(make(chan struct{}))
+	logrus.Infof("Recording rejected pods in the %s NFSAccessReport of their namespace", accessReports.Name)
+}
+
+// setNotifications posts summaries of the rejected pods to the Slack, Teams or
+// generic webhook at the NOTIFY_WEBHOOK_URL env var when the
+// ENABLE_DENIAL_NOTIFICATIONS env var is "true". NOTIFY_FORMAT sets the payload
+// (slack by default, teams or json) and NOTIFY_TEMPLATE the text/template of the
+// line of every denial. Identical denials are merged and a summary of up to
+// NOTIFY_MAX_DENIALS (20 by default) denials is posted every NOTIFY_INTERVAL
+// (1m by default) at most.
+func setNotifications() {
+	if os.Getenv("ENABLE_DENIAL_NOTIFICATIONS") != "true" {
+		return
+	}
+	endpoint := os.Getenv("NOTIFY_WEBHOOK_URL")
+	if endpoint == "" {
+		logrus.Fatal("cannot enable denial notifications: NOTIFY_WEBHOOK_URL is not set")
+	}
+	var err error
+	if notifier, err = notify.New(endpoint, os.Getenv("NOTIFY_FORMAT"), os.Getenv("NOTIFY_TEMPLATE")); err != nil {
+		logrus.Fatal(err)
+	}
+	if value := os.Getenv("NOTIFY_INTERVAL"); value != "" {
+		if notifier.Interval, err = time.ParseDuration(value); err != nil || notifier.Interval <= 0 {
+			logrus.Fatalf("invalid NOTIFY_INTERVAL %q, expected a positive duration", value)
+		}
+	}
+	if value := os.Getenv("NOTIFY_MAX_DENIALS"); value != "" {
+		if notifier.MaxDenials, err = strconv.Atoi(value); err != nil || notifier.MaxDenials <= 0 {
+			logrus.Fatalf("invalid NOTIFY_MAX_DENIALS %q, expected a positive integer", value)
+		}
+	}
+	go notifier.Run(context.Background())
+	logrus.Infof("Posting %s notifications of rejected pods every %s at most", notifier.Format, notifier.Interval)
+}
+
+// setAuditLog writes an audit record of every decision, with the subject, the
+// UIDs and GIDs of the pod and the version of the mappings, when the
+// ENABLE_AUDIT_LOG env var is "true". AUDIT_LOG_FORMAT sets the format (json by
+// default or cef) and AUDIT_LOG_OUTPUT the output: stdout by default, the logs
+// being written to stderr, file to append to AUDIT_LOG_FILE, or syslog to send
+// them to the syslog server at AUDIT_LOG_SYSLOG_ADDR over
+// AUDIT_LOG_SYSLOG_NETWORK (udp by default or tcp), the local one when empty.
+func setAuditLog() {
+	if os.Getenv("ENABLE_AUDIT_LOG") != "true" {
+		return
+	}
+	var out io.Writer
+	output := os.Getenv("AUDIT_LOG_OUTPUT")
+	switch output {
+	case "", "stdout":
+		output = "stdout"
+		out = os.Stdout
+	case "file":
+		path := os.Getenv("AUDIT_LOG_FILE")
+		if path == "" {
+			logrus.Fatal("cannot enable the audit log: AUDIT_LOG_FILE is not set")
+		}
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			logrus.Fatalf("cannot open audit log: %v", err)
+		}
+		output = path
+		out = file
+	case "syslog":
+		network, addr := os.Getenv("AUDIT_LOG_SYSLOG_NETWORK"), os.Getenv("AUDIT_LOG_SYSLOG_ADDR")
+		if network == "" && addr != "" {
+			network = "udp"
+		}
+		writer, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_AUTH, "nfs-pod-access-control")
+		if err != nil {
+			logrus.Fatalf("cannot connect to syslog: %v", err)
+		}
+		if addr != "" {
+			output = fmt.Sprintf("syslog %s://%s", network, addr)
+		}
+		out = writer
+	default:
+		logrus.Fatalf("invalid AUDIT_LOG_OUTPUT %q, expected stdout, file or syslog", output)
+	}
+
+	var err error
+	if auditLog, err = auditlog.New(out, os.Getenv("AUDIT_LOG_FORMAT")); err != nil {
+		logrus.Fatal(err)
+	}
+	auditLog.MappingVersion = currentMappingVersion
+	logrus.Infof("Writing %s audit records to %s", auditLog.Format, output)
+}
+
+// setCollisionDetection checks the mappings for UIDs mapped to several users or
+// serviceAccounts whenever they change when the ENABLE_UID_COLLISION_DETECTION env
+// var is "true", reporting them in the logs, the uid_collisions metric and an Event
+// on the UID mapping object. When the REFUSE_UID_COLLISIONS env var is "true", the
+// pods of the colliding subjects are denied until the mappings are fixed.
+func setCollisionDetection(mappings *mapping.Store) {
+	if os.Getenv("ENABLE_UID_COLLISION_DETECTION") != "true" {
+		return
+	}
+	detector := collision.NewDetector(mappings)
+	detector.Events = eventRecorder
+	if err := detector.Sync(context.Background()); err != nil {
+		logrus.Fatalf("cannot check UID collisions: %v", err)
+	}
+	if err := detector.Run(make(chan struct{})); err != nil {
+		logrus.Fatal(err)
+	}
+	if os.Getenv("REFUSE_UID_COLLISIONS") == "true" {
+		validationPolicy.Collisions = detector
+		logrus.Info("Refusing pods of subjects with colliding UIDs")
+	}
+	logrus.Info("Detecting UID collisions in the mappings")
+}
+
+// setMappingVersion records the version of the mappings served by this replica, a
+// hash of the resourceVersions of the watched mapping objects, in the
+// mapping_version_info metric whenever it changes. It returns the handler of the
+// /version endpoint answering the version as JSON.
+func setMappingVersion(mappings *mapping.Store) http.HandlerFunc {
+	err := mappings.OnVersionChange(func(v mapping.Version) {
+		metrics.SetMappingVersion(v.Hash)
+		mappingVersion.Store(v.Hash)
+		logrus.WithField("version", v.Hash).Debug("Serving new mapping version")
+	})
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(mappings.Version()); err != nil {
+			logrus.Errorf("Error writing mapping version: %s", err)
+		}
+	}
+}
+
+// currentMappingVersion returns the hash of the version of the mappings served
+func currentMappingVersion() string {
+	version, _ := mappingVersion.Load().(string)
+	return version
+}
+
+// setSharedCache shares the identities cached by the ldap, rest and vault
+// backends and the allowed pods of the decision cache between the replicas
+// through the Redis server at REDIS_ADDR when the ENABLE_SHARED_CACHE env var is
+// "true". Its keys are prefixed by REDIS_KEY_PREFIX and scoped to the version of
+// the mappings. An unavailable Redis server doesn't fail admissions, the replicas
+// then resolve identities on their own.
+func setSharedCache() {
+	if os.Getenv("ENABLE_SHARED_CACHE") != "true" {
+		return
+	}
+	opts := sharedcache.Options{
+		Addr:     os.Getenv("REDIS_ADDR"),
+		Password: os.Getenv("REDIS_PASSWORD"),
+		TLS:      os.Getenv("REDIS_TLS") == "true",
+		CAFile:   os.Getenv("REDIS_CA_FILE"),
+		Prefix:   os.Getenv("REDIS_KEY_PREFIX"),
+	}
+	var err error
+	if value := os.Getenv("REDIS_DB"); value != "" {
+		if opts.DB, err = strconv.Atoi(value); err != nil || opts.DB < 0 {
+			logrus.Fatalf("invalid REDIS_DB %q, expected a database number", value)
+		}
+	}
+	if value := os.Getenv("REDIS_TIMEOUT"); value != "" {
+		if opts.Timeout, err = time.ParseDuration(value); err != nil || opts.Timeout <= 0 {
+			logrus.Fatalf("invalid REDIS_TIMEOUT %q, expected a positive duration", value)
+		}
+	}
+	if sharedCache, err = sharedcache.NewRedis(opts); err != nil {
+		logrus.Fatalf("cannot set up shared cache: %v", err)
+	}
+	sharedCache.Version = currentMappingVersion
+	if err := sharedCache.Ping(context.Background()); err != nil {
+		logrus.Warnf("Redis server %s unavailable, identities are resolved by every replica until it answers: %v", opts.Addr, err)
+	}
+	logrus.Infof("Sharing cached identities and decisions through Redis server %s", opts.Addr)
+}
+
+// setDecisionCache remembers the pods allowed by the validators for
+// DECISION_CACHE_TTL (10s by default) when the ENABLE_DECISION_CACHE env var is
+// "true", so that the identical pods of a scale-up are validated once. At most
+// DECISION_CACHE_SIZE pods (10000 by default) are remembered, the least recently
+// used first evicted. A new version of the mappings invalidates them. They are
+// shared with the other replicas when the shared cache is enabled.
+func setDecisionCache() {
+	if os.Getenv("ENABLE_DECISION_CACHE") != "true" {
+		return
+	}
+	size := admission.DefaultDecisionCacheSize
+	if value := os.Getenv("DECISION_CACHE_SIZE"); value != "" {
+		var err error
+		if size, err = strconv.Atoi(value); err != nil || size <= 0 {
+			logrus.Fatalf("invalid DECISION_CACHE_SIZE %q, expected a positive integer", value)
+		}
+	}
+	ttl := admission.DefaultDecisionCacheTTL
+	if value := os.Getenv("DECISION_CACHE_TTL"); value != "" {
+		var err error
+		if ttl, err = time.ParseDuration(value); err != nil || ttl <= 0 {
+			logrus.Fatalf("invalid DECISION_CACHE_TTL %q, expected a positive duration", value)
+		}
+	}
+	decisionCache = admission.NewDecisionCache(size, ttl)
+	decisionCache.Version = currentMappingVersion
+	if sharedCache != nil {
+		decisionCache.Shared = sharedCache
+	}
+	logrus.Infof("Caching allowed pods for %s, up to %d pods", ttl, size)
+}
+
+// setRateLimits bounds the rate of the admission requests of pods mounting NFS in
+// every namespace to RATE_LIMIT_QPS per second (10 by default), with bursts of
+// RATE_LIMIT_BURST requests (50), when the ENABLE_RATE_LIMITS env var is "true".
+// Every namespace has its own token bucket per webhook, requests beyond the rate
+// are rejected with a 429 and the delay to retry after.
+func setRateLimits() {
+	if os.Getenv("ENABLE_RATE_LIMITS") != "true" {
+		return
+	}
+	qps := float64(admission.DefaultRateLimitQPS)
+	if value := os.Getenv("RATE_LIMIT_QPS"); value != "" {
+		var err error
+		if qps, err = strconv.ParseFloat(value, 64); err != nil || qps <= 0 {
+			logrus.Fatalf("invalid RATE_LIMIT_QPS %q, expected a positive number", value)
+		}
+	}
+	burst := admission.DefaultRateLimitBurst
+	if value := os.Getenv("RATE_LIMIT_BURST"); value != "" {
+		var err error
+		if burst, err = strconv.Atoi(value); err != nil || burst <= 0 {
+			logrus.Fatalf("invalid RATE_LIMIT_BURST %q, expected a positive integer", value)
+		}
+	}
+	rateLimits = admission.NewRateLimiter(qps, burst)
+	logrus.Infof("Admitting up to %g pods per second in every namespace, with bursts of %d", qps, burst)
+}
+
+// setRecording records the sanitized admission requests of pods and the responses
+// of the webhook to daily files in the RECORD_DIR directory
+// (/var/log/nfs-pod-access-control by default) when the ENABLE_RECORDING env var
+// is "true", keeping the files of the last RECORD_MAX_FILES days (7 by default).
+// They are replayed against new policies or mappings with kubectl nfs-access replay.
+func setRecording() {
+	if os.Getenv("ENABLE_RECORDING") != "true" {
+		return
+	}
+	dir := os.Getenv("RECORD_DIR")
+	if dir == "" {
+		dir = "/var/log/nfs-pod-access-control"
+	}
+	maxFiles := recording.DefaultMaxFiles
+	if value := os.Getenv("RECORD_MAX_FILES"); value != "" {
+		var err error
+		if maxFiles, err = strconv.Atoi(value); err != nil || maxFiles <= 0 {
+			logrus.Fatalf("invalid RECORD_MAX_FILES %q, expected a positive integer", value)
+		}
+	}
+	var err error
+	if recorder, err = recording.NewRecorder(dir, maxFiles); err != nil {
+		logrus.Fatalf("cannot enable recording: %v", err)
+	}
+	logrus.Infof("Recording admission requests to %s for %d days", dir, maxFiles)
+}
+
+// setSelfTest gates the readiness of the webhook on the evaluation of a synthetic
+// pod created by the SELF_TEST_USER user in the SELF_TEST_NAMESPACE namespace
+// (default) when the ENABLE_SELF_TEST env var is "true", after the readiness
+// checks of the mappings and caches. The pod is read from the SELF_TEST_POD env
+// var, or mounts an NFS volume of SELF_TEST_NFS_SERVER and runs as SELF_TEST_UID,
+// and must be admitted unless SELF_TEST_EXPECT is "denied". Each evaluation times
+// out after SELF_TEST_TIMEOUT.
+func setSelfTest() {
+	if os.Getenv("ENABLE_SELF_TEST") != "true" {
+		return
+	}
+	user := os.Getenv("SELF_TEST_USER")
+	if user == "" {
+		logrus.Fatal("cannot enable self-test: SELF_TEST_USER is not set")
+	}
+	namespace := os.Getenv("SELF_TEST_NAMESPACE")
+	if namespace == "" {
+		namespace = "default"
+	}
+	pod := []byte(os.Getenv("SELF_TEST_POD"))
+	if len(pod) == 0 {
+		uid, err := strconv.ParseInt(os.Getenv("SELF_TEST_UID"), 10, 64)
+		if err != nil {
+			logrus.Fatalf("invalid SELF_TEST_UID %q, expected an integer when SELF_TEST_POD is not set", os.Getenv("SELF_TEST_UID"))
+		}
+		server := os.Getenv("SELF_TEST_NFS_SERVER")
+		if server == "" {
+			server = "nfs.invalid"
+		}
+		pod = evaluation.SyntheticPod(server, uid)
+	}
+	allowed := true
+	switch expect := os.Getenv("SELF_TEST_EXPECT"); expect {
+	case "", "allowed":
+	case "denied":
+		allowed = false
+	default:
+		logrus.Fatalf("invalid SELF_TEST_EXPECT %q, expected allowed or denied", expect)
+	}
+	timeout := evaluation.DefaultSelfTestTimeout
+	if value := os.Getenv("SELF_TEST_TIMEOUT"); value != "" {
+		var err error
+		if timeout, err = time.ParseDuration(value); err != nil || timeout <= 0 {
+			logrus.Fatalf("invalid SELF_TEST_TIMEOUT %q, expected a positive duration", value)
+		}
+	}
+
+	selfTest := &evaluation.SelfTest{
+		// the self-test evaluates its pod directly, without authenticating a caller
+		Server: evaluation.NewServer(nil, newAdmitter),
+		Request: &evaluationpb.EvaluatePodRequest{
+			Object:    pod,
+			Namespace: namespace,
+			User:      &evaluationpb.UserInfo{Username: user},
+		},
+		Allowed: allowed,
+		Timeout: timeout,
+	}
+	selfTest.Server.Logger = logrus.WithField("component", "self-test")
+	// registered after the checks of the mappings and caches, which are evaluated first
+	healthChecker.AddReadinessCheck("self-test", selfTest.Check)
+	logrus.Infof("Gating readiness on the evaluation of a self-test pod created by %s", user)
+}
+
+// setExpiryReporting reports the expired entries of the mapping document and the
+// expired UIDMappings, which are ignored, in the logs, the expired_mappings metric
+// and an Event on the object holding them when the ENABLE_EXPIRY_REPORTING env var
+// is "true", so that they get pruned
+func setExpiryReporting(mappings *mapping.Store) {
+	if os.Getenv("ENABLE_EXPIRY_REPORTING") != "true" {
+		return
+	}
+	reporter := expiry.NewReporter(mappings)
+	reporter.Events = eventRecorder
+	if err := reporter.Run(make(chan struct{})); err != nil {
+		logrus.Fatal(err)
+	}
+	logrus.Info("Reporting expired mapping entries")
+}
+
+// setComplianceScan periodically re-evaluates the running pods mounting NFS with
+// the current settings when the ENABLE_COMPLIANCE_SCAN env var is "true", every
+// COMPLIANCE_SCAN_INTERVAL (1h by default). Violations are reported in the logs,
+// the noncompliant_pods metric, Events attached to the pods and the report of the
+// COMPLIANCE_REPORT_NAME ConfigMap of the webhook namespace
+// (nfs-pod-access-control-compliance-report by default). When the
+// COMPLIANCE_REMEDIATION env var is annotate or evict, the pods of the namespaces
+// labeled nfs-access-control/remediate=true in violation for longer than
+// COMPLIANCE_REMEDIATION_GRACE_PERIOD (24h by default) are annotated or evicted.
+func setComplianceScan(client kubernetes.Interface, detector *nfs.Detector) {
+	if os.Getenv("ENABLE_COMPLIANCE_SCAN") != "true" {
+		return
+	}
+	namespace, err := mapping.Namespace()
+	if err != nil {
+		logrus.Fatalf("cannot read webhook namespace: %v", err)
+	}
+	if detector == nil {
+		detector = nfs.NewDetector(client)
+		detector.CSIDrivers = nfs.ParseCSIDrivers(os.Getenv("NFS_CSI_DRIVERS"))
+		if err := detector.Start(make(chan struct{})); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+
+	scanner := compliance.NewScanner(client, detector, func(logger *logrus.Entry) *validation.Validator {
+		reloadMu.RLock()
+		defer reloadMu.RUnlock()
+		return validation.NewValidator(logger, validationPolicy, uidResolver)
+	})
+	if value := os.Getenv("COMPLIANCE_SCAN_INTERVAL"); value != "" {
+		if scanner.Interval, err = time.ParseDuration(value); err != nil || scanner.Interval <= 0 {
+			logrus.Fatalf("invalid COMPLIANCE_SCAN_INTERVAL %q, expected a positive duration", value)
+		}
+	}
+	scanner.Scope = func(namespace string) bool {
+		reloadMu.RLock()
+		defer reloadMu.RUnlock()
+		return namespaceScope.Contains(namespace)
+	}
+	scanner.ReportNamespace = namespace
+	scanner.ReportName = os.Getenv("COMPLIANCE_REPORT_NAME")
+	if scanner.ReportName == "" {
+		scanner.ReportName = "nfs-pod-access-control-compliance-report"
+	}
+	scanner.Events = eventRecorder
+	scanner.Reports = accessReports
+	if action := os.Getenv("COMPLIANCE_REMEDIATION"); action != "" && action != "none" {
+		if scanner.Remediator, err = compliance.NewRemediator(client, action); err != nil {
+			logrus.Fatal(err)
+		}
+		if value := os.Getenv("COMPLIANCE_REMEDIATION_GRACE_PERIOD"); value != "" {
+			if scanner.Remediator.GracePeriod, err = time.ParseDuration(value); err != nil || scanner.Remediator.GracePeriod <= 0 {
+				logrus.Fatalf("invalid COMPLIANCE_REMEDIATION_GRACE_PERIOD %q, expected a positive duration", value)
+			}
+		}
+		scanner.Remediator.Events = eventRecorder
+		logrus.Infof("Remediating pods in violation for longer than %s with action %s in the namespaces labeled %s=true",
+			scanner.Remediator.GracePeriod, action, compliance.RemediateLabel)
+	}
+	scanner.Run(make(chan struct{}))
+	logrus.Infof("Scanning running pods mounting NFS every %s, reporting to ConfigMap %s", scanner.Interval, scanner.ReportName)
+}
+
+// setNFSDetector restricts validation and mutation to pods mounting NFS storage
+// when the ENFORCE_NFS_ONLY env var is "true", other pods are admitted untouched.
+// It also resolves the exports of PersistentVolumeClaims and CSI volumes for the
+// export policies, the Kerberos, SELinux, time window and host namespace validations and the
+// Ganesha integration, if enabled. Volumes of the CSI drivers listed in the NFS_CSI_DRIVERS env var
+// (nfs.csi.k8s.io by default) are considered NFS volumes. It blocks until the
+// PersistentVolumeClaim, PersistentVolume and StorageClass caches are synced and
+// returns the detector, nil when none of them is enabled.
+func setNFSDetector(client kubernetes.Interface) *nfs.Detector {
+	enforceNFSOnly := os.Getenv("ENFORCE_NFS_ONLY") == "true"
+	ganesha := os.Getenv("ENABLE_GANESHA_INTEGRATION") == "true"
+	ontap := os.Getenv("ENABLE_ONTAP_INTEGRATION") == "true"
+	if !enforceNFSOnly && !ganesha && !ontap && validationPolicy.Exports == nil && validationPolicy.Principals == nil &&
+		validationPolicy.SELinux == nil && validationPolicy.TimeWindows == nil && !validationPolicy.DenyHostNamespaces {
+		return nil
+	}
+
+	detector := nfs.NewDetector(client)
+	detector.CSIDrivers = nfs.ParseCSIDrivers(os.Getenv("NFS_CSI_DRIVERS"))
+	if err := detector.Start(make(chan struct{})); err != nil {
+		logrus.Fatal(err)
+	}
+	healthChecker.AddReadinessCheck("nfs", detector.Ready)
+	validationPolicy.Volumes = detector
+
+	if enforceNFSOnly {
+		nfsDetector = detector
+		logrus.Infof("Only enforcing pods mounting NFS volumes (CSI drivers: %v)", detector.CSIDrivers)
+	}
+	return detector
+}
+
+// setGanesha grants the nodes running pods that mount the NFS-Ganesha exports of
+// the file named by the GANESHA_CONFIG_FILE env var access to them, when the
+// ENABLE_GANESHA_INTEGRATION env var is "true". Export blocks are written to the
+// GANESHA_EXPORT_DIR directory, shared with NFS-Ganesha, which is told to reload
+// them through its D-Bus at GANESHA_DBUS_ADDRESS.
+func setGanesha(client kubernetes.Interface, detector *nfs.Detector) {
+	if os.Getenv("ENABLE_GANESHA_INTEGRATION") != "true" {
+		return
+	}
+	config, err := ganesha.LoadConfig(os.Getenv("GANESHA_CONFIG_FILE"))
+	if err != nil {
+		logrus.Fatalf("cannot set Ganesha integration: %v", err)
+	}
+	manager, err := ganesha.NewDBusManager(os.Getenv("GANESHA_DBUS_ADDRESS"), os.Getenv("GANESHA_EXPORT_DIR"))
+	if err != nil {
+		logrus.Fatalf("cannot set Ganesha integration: %v", err)
+	}
+
+	controller := ganesha.NewController(client, detector, manager, config)
+	if err := controller.Run(make(chan struct{})); err != nil {
+		logrus.Fatal(err)
+	}
+	logrus.Infof("Managing %d Ganesha exports of %s", len(config.Exports), config.Server)
+}
+
+// setAccessPolicies starts watching NFSAccessPolicy resources, whose CEL rules pods
+// are validated against, when the ENABLE_ACCESS_POLICIES env var is "true". It
+// blocks until the cache is synced.
+func setAccessPolicies(config *rest.Config) {
+	if os.Getenv("ENABLE_ACCESS_POLICIES") != "true" {
+		return
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		logrus.Fatalf("cannot create dynamic Kubernetes client: %v", err)
+	}
+	policies, err := accesspolicy.NewStore(dynamicClient)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	if err := policies.Start(make(chan struct{})); err != nil {
+		logrus.Fatal(err)
+	}
+	healthChecker.AddReadinessCheck("access-policies", policies.Ready)
+	validationPolicy.AccessPolicies = policies
+	logrus.Info("Watching NFSAccessPolicy resources")
+}
+
+// setOPA validates pods with the Open Policy Agent decision at OPA_DECISION_PATH
+// (nfs/admission by default) when the ENABLE_OPA env var is "true": with the OPA
+// server at OPA_URL if set, giving up after OPA_TIMEOUT, or with an embedded OPA
+// configured by the OPA config file named by OPA_CONFIG_FILE.
+func setOPA() {
+	if os.Getenv("ENABLE_OPA") != "true" {
+		return
+	}
+	path := os.Getenv("OPA_DECISION_PATH")
+	if path == "" {
+		path = opa.DefaultDecisionPath
+	}
+
+	if url := os.Getenv("OPA_URL"); url != "" {
+		timeout := 2 * time.Second
+		if value := os.Getenv("OPA_TIMEOUT"); value != "" {
+			var err error
+			if timeout, err = time.ParseDuration(value); err != nil {
+				logrus.Fatalf("invalid OPA_TIMEOUT %q: %v", value, err)
+			}
+		}
+		validationPolicy.OPA = opa.NewRemoteEngine(url, path, timeout)
+		logrus.Infof("Validating pods with OPA decision %s of %s", path, url)
+		return
+	}
+
+	engine, err := opa.NewEmbeddedEngine(context.Background(), os.Getenv("OPA_CONFIG_FILE"), path)
+	if err != nil {
+		logrus.Fatalf("cannot set OPA: %v", err)
+	}
+	healthChecker.AddReadinessCheck("opa", engine.Ready)
+	validationPolicy.OPA = engine
+	logrus.Infof("Validating pods with embedded OPA decision %s", path)
+}
+
+// setRegistration creates and updates the ValidatingWebhookConfiguration of the
+// webhook from the config file named by the WEBHOOK_REGISTRATION_FILE env var when
+// the ENABLE_WEBHOOK_REGISTRATION env var is "true", so that it can't drift apart
+// from the deployment. Manual changes are reverted every 10 minutes. When the
+// GENERATE_MATCH_CONDITIONS env var is "true", matchConditions skipping the pods
+// out of the namespace scope, and the pods without NFS volumes with ENFORCE_NFS_ONLY,
+// are added to the ones of the config file.
+func setRegistration(client kubernetes.Interface) {
+	if os.Getenv("ENABLE_WEBHOOK_REGISTRATION") != "true" {
+		return
+	}
+	config, err := registration.LoadConfig(os.Getenv("WEBHOOK_REGISTRATION_FILE"))
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	if os.Getenv("GENERATE_MATCH_CONDITIONS") == "true" {
+		opts := registration.MatchOptions{
+			EnforcedNamespaces: namespaceScope.Enforced,
+			ExcludedNamespaces: namespaceScope.Excluded,
+		}
+		if nfsDetector != nil {
+			opts.NFSOnly = true
+			opts.CSIDrivers = nfsDetector.CSIDrivers
+		}
+		conditions := registration.MatchConditions(opts)
+		config.MatchConditions = append(config.MatchConditions, conditions...)
+		logrus.Infof("Pre-filtering requests with %d generated matchConditions", len(conditions))
+	}
+	reconciler := registration.NewReconciler(client, config)
+	if err := reconciler.Reconcile(context.Background()); err != nil {
+		logrus.Fatalf("cannot register webhook: %v", err)
+	}
+	reconciler.Run(make(chan struct{}))
+	logrus.Infof("Registered ValidatingWebhookConfiguration %s", config.Name)
+}
+
+// setCertManagement issues the TLS serving certificate of the webhook when the
+// ENABLE_CERT_MANAGEMENT env var is "true", instead of reading it from files: a
+// self-signed CA and a serving certificate for the WEBHOOK_SERVICE_NAME Service
+// are kept in the CERT_SECRET_NAME Secret of the webhook namespace, renewed
+// CERT_RENEW_BEFORE before expiry (serving certificates are valid for
+// CERT_VALIDITY), and the CA bundle is patched into the webhook configurations
+// named by the VALIDATING_WEBHOOK_CONFIGURATION (comma separated) and
+// MUTATING_WEBHOOK_CONFIGURATION env vars. The webhook then always listens with TLS on port 443.
+func setCertManagement(client kubernetes.Interface) *certs.Manager {
+	if os.Getenv("ENABLE_CERT_MANAGEMENT") != "true" {
+		return nil
+	}
+	namespace, err := mapping.Namespace()
+	if err != nil {
+		logrus.Fatalf("cannot read webhook namespace: %v", err)
+	}
+	service := os.Getenv("WEBHOOK_SERVICE_NAME")
+	if service == "" {
+		logrus.Fatal("cannot manage TLS certificate: WEBHOOK_SERVICE_NAME is not set")
+	}
+	secretName := os.Getenv("CERT_SECRET_NAME")
+	if secretName == "" {
+		secretName = "nfs-pod-access-control-tls"
+	}
+
+	manager := certs.NewManager(client, namespace, secretName, service)
+	if names := os.Getenv("VALIDATING_WEBHOOK_CONFIGURATION"); names != "" {
+		manager.ValidatingWebhooks = strings.Split(names, ",")
+	}
+	if name := os.Getenv("MUTATING_WEBHOOK_CONFIGURATION"); name != "" {
+		manager.MutatingWebhooks = []string{name}
+	}
+	for env, duration := range map[string]*time.Duration{
+		"CERT_VALIDITY":     &manager.Validity,
+		"CERT_RENEW_BEFORE": &manager.RenewBefore,
+	} {
+		if value := os.Getenv(env); value != "" {
+			if *duration, err = time.ParseDuration(value); err != nil {
+				logrus.Fatalf("invalid %s %q: %v", env, value, err)
+			}
+		}
+	}
+	if manager.RenewBefore >= manager.Validity {
+		logrus.Fatalf("CERT_RENEW_BEFORE %s must be shorter than CERT_VALIDITY %s", manager.RenewBefore, manager.Validity)
+	}
+
+	if err := manager.Sync(context.Background()); err != nil {
+		logrus.Fatalf("cannot set TLS certificate: %v", err)
+	}
+	manager.Run(make(chan struct{}))
+	healthChecker.AddReadinessCheck("certificate", manager.Ready)
+	logrus.Infof("Managing TLS certificate in Secret %s for Service %s", secretName, service)
+	return manager
+}
+
+// setONTAP grants the nodes running pods that mount the ONTAP exports of the file
+// named by the ONTAP_CONFIG_FILE env var access to them through their export
+// policies, when the ENABLE_ONTAP_INTEGRATION env var is "true". The ONTAP REST API
+// is called with the credentials of the ONTAP_USERNAME_FILE and ONTAP_PASSWORD_FILE
+// files, trusting the ONTAP_CA_FILE certificates.
+func setONTAP(client kubernetes.Interface, detector *nfs.Detector) {
+	if os.Getenv("ENABLE_ONTAP_INTEGRATION") != "true" {
+		return
+	}
+	config, err := ontap.LoadConfig(os.Getenv("ONTAP_CONFIG_FILE"))
+	if err != nil {
+		logrus.Fatalf("cannot set ONTAP integration: %v", err)
+	}
+	tlsConfig, err := ontap.TLSConfig(os.Getenv("ONTAP_CA_FILE"), os.Getenv("ONTAP_INSECURE_SKIP_VERIFY") == "true")
+	if err != nil {
+		logrus.Fatalf("cannot set ONTAP integration: %v", err)
+	}
+	manager := ontap.NewClient(config.URL, config.SVM, tlsConfig)
+	manager.UsernameFile = os.Getenv("ONTAP_USERNAME_FILE")
+	manager.PasswordFile = os.Getenv("ONTAP_PASSWORD_FILE")
+
+	controller := ontap.NewController(client, detector, manager, config)
+	if err := controller.Run(make(chan struct{})); err != nil {
+		logrus.Fatal(err)
+	}
+	logrus.Infof("Managing %d ONTAP export policies of SVM %s", len(config.Exports), config.SVM)
+}
+
 // parseRequest extracts an AdmissionReview from an http.Request if possible
 func parseRequest(r http.Request) (*admissionv1.AdmissionReview, error) {
 	if r.Header.Get("Content-Type") != "application/json" {
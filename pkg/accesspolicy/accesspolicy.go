@@ -0,0 +1,177 @@
+// Package accesspolicy evaluates the CEL rules of NFSAccessPolicy resources against
+// pods, the subject creating them and the mapping entry of that subject, so that
+// new conditions don't require changes to the validators
+package accesspolicy
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/apis/nfsaccess/v1alpha1"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Input is what the rules of policies are evaluated against
+type Input struct {
+	Pod       *corev1.Pod
+	Namespace string
+	// Subject is the user or serviceAccount the pod is created for, Groups are
+	// the groups of the user
+	Subject string
+	Groups  []string
+	// Identity is the mapping entry of Subject, nil when it has none
+	Identity *resolver.IdentitySpec
+}
+
+// Store is a container for NFSAccessPolicies, read from an in-memory cache kept
+// up to date by an informer. Rules are compiled on first use and recompiled when
+// their policy changes.
+type Store struct {
+	factory  dynamicinformer.DynamicSharedInformerFactory
+	informer cache.SharedIndexInformer
+	env      *environment
+
+	mu sync.Mutex
+	// compiled are the compiled policies, by name
+	compiled map[string]*compiledPolicy
+
+	Logger logrus.FieldLogger
+}
+
+// compiledPolicy is an NFSAccessPolicy with compiled rules
+type compiledPolicy struct {
+	resourceVersion string
+	namespaces      []string
+	rules           []*compiledRule
+}
+
+// NewStore returns a Store watching NFSAccessPolicies with client. The cache is
+// only filled once Start is called.
+func NewStore(client dynamic.Interface) (*Store, error) {
+	env, err := newEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	return &Store{
+		factory:  factory,
+		informer: factory.ForResource(v1alpha1.NFSAccessPoliciesResource).Informer(),
+		env:      env,
+		compiled: map[string]*compiledPolicy{},
+		Logger:   logrus.StandardLogger(),
+	}, nil
+}
+
+// Start starts watching NFSAccessPolicies and blocks until the cache is synced
+func (s *Store) Start(stopCh <-chan struct{}) error {
+	s.factory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, s.informer.HasSynced) {
+		return fmt.Errorf("failed to sync NFSAccessPolicy cache")
+	}
+	return nil
+}
+
+// Ready returns an error until the cache is synced
+func (s *Store) Ready() error {
+	if !s.informer.HasSynced() {
+		return fmt.Errorf("NFSAccessPolicy cache not synced")
+	}
+	return nil
+}
+
+// Evaluate returns true if in satisfies every rule of the policies of its namespace,
+// policies are evaluated by name. Rules that don't compile or fail to evaluate deny
+// the pod, so that a broken policy isn't silently ignored.
+func (s *Store) Evaluate(ctx context.Context, in Input) (allowed bool, reason string) {
+	policies, err := s.policies()
+	if err != nil {
+		return false, err.Error()
+	}
+
+	var vars map[string]interface{}
+	for _, p := range policies {
+		compiled := s.compile(p)
+		if len(compiled.namespaces) > 0 && !matchNamespace(compiled.namespaces, in.Namespace) {
+			continue
+		}
+		if vars == nil {
+			if vars, err = variables(in); err != nil {
+				return false, err.Error()
+			}
+		}
+
+		for _, rule := range compiled.rules {
+			ok, err := rule.eval(ctx, vars)
+			if err != nil {
+				s.Logger.Warnf("rule %s of NFSAccessPolicy %s failed: %v", rule.name, p.Name, err)
+				return false, fmt.Sprintf("Rule %s of NFSAccessPolicy %s failed: %s\n", rule.name, p.Name, err)
+			}
+			if !ok {
+				if rule.message != "" {
+					return false, rule.message
+				}
+				return false, fmt.Sprintf("Pod violates rule %s of NFSAccessPolicy %s\n", rule.name, p.Name)
+			}
+		}
+	}
+	return true, ""
+}
+
+// policies returns the cached NFSAccessPolicies sorted by name
+func (s *Store) policies() ([]*v1alpha1.NFSAccessPolicy, error) {
+	var policies []*v1alpha1.NFSAccessPolicy
+	for _, obj := range s.informer.GetStore().List() {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return nil, fmt.Errorf("unexpected NFSAccessPolicy object type %T", obj)
+		}
+		p := &v1alpha1.NFSAccessPolicy{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, p); err != nil {
+			return nil, fmt.Errorf("failed to parse NFSAccessPolicy %s: %v", u.GetName(), err)
+		}
+		policies = append(policies, p)
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+	return policies, nil
+}
+
+// compile returns the compiled rules of p, compiling them if p changed since they
+// were last compiled
+func (s *Store) compile(p *v1alpha1.NFSAccessPolicy) *compiledPolicy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.compiled[p.Name]; ok && c.resourceVersion == p.ResourceVersion {
+		return c
+	}
+
+	c := &compiledPolicy{resourceVersion: p.ResourceVersion, namespaces: p.Spec.Namespaces}
+	for _, rule := range p.Spec.Rules {
+		compiled := s.env.compile(rule)
+		if compiled.err != nil {
+			s.Logger.Errorf("cannot compile rule %s of NFSAccessPolicy %s: %v", rule.Name, p.Name, compiled.err)
+		}
+		c.rules = append(c.rules, compiled)
+	}
+	s.compiled[p.Name] = c
+	return c
+}
+
+// matchNamespace returns true if namespace matches one of patterns
+func matchNamespace(patterns []string, namespace string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return true
+		}
+	}
+	return false
+}
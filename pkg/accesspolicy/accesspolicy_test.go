@@ -0,0 +1,116 @@
+package accesspolicy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/apis/nfsaccess/v1alpha1"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestEvaluate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	policy := func(name string, namespaces []string, rules ...v1alpha1.NFSAccessRule) *v1alpha1.NFSAccessPolicy {
+		return &v1alpha1.NFSAccessPolicy{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "nfsaccess.io/v1alpha1", Kind: "NFSAccessPolicy"},
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       v1alpha1.NFSAccessPolicySpec{Namespaces: namespaces, Rules: rules},
+		}
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme,
+		map[schema.GroupVersionResource]string{v1alpha1.NFSAccessPoliciesResource: "NFSAccessPolicyList"},
+		policy("mapped-uid", nil, v1alpha1.NFSAccessRule{
+			Name:       "mapped-uid",
+			Expression: "has(subject.uid) && subject.uid in entry.allowedUids && !pod.spec.hostNetwork",
+		}),
+		policy("ci", []string{"ci-*"}, v1alpha1.NFSAccessRule{
+			Name:       "no-privileged",
+			Expression: "pod.spec.containers.all(c, !has(c.securityContext) || !has(c.securityContext.privileged) || !c.securityContext.privileged)",
+			Message:    "CI pods can't be privileged",
+		}),
+		policy("broken", []string{"broken"}, v1alpha1.NFSAccessRule{Name: "typo", Expression: "pod.spec.hostNetwork &&"}),
+	)
+	s, err := NewStore(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Logger = logrus.New()
+	stop := make(chan struct{})
+	defer close(stop)
+	if err := s.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, s.Ready())
+
+	uid, privileged := int64(1001), true
+	identity := &resolver.IdentitySpec{UIDs: mapping.IDRanges{{Min: 1000, Max: 1009}}}
+	pod := func(hostNetwork bool, privileged *bool) *corev1.Pod {
+		return &corev1.Pod{Spec: corev1.PodSpec{
+			HostNetwork:     hostNetwork,
+			SecurityContext: &corev1.PodSecurityContext{RunAsUser: &uid},
+			Containers: []corev1.Container{{
+				Name:            "app",
+				SecurityContext: &corev1.SecurityContext{Privileged: privileged},
+				Resources:       corev1.ResourceRequirements{Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")}},
+			}},
+		}}
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		pod       *corev1.Pod
+		identity  *resolver.IdentitySpec
+		allowed   bool
+		reason    string
+	}{
+		{name: "mapped uid", namespace: "team-a", pod: pod(false, nil), identity: identity, allowed: true},
+		{name: "host network", namespace: "team-a", pod: pod(true, nil), identity: identity, reason: "Pod violates rule mapped-uid of NFSAccessPolicy mapped-uid\n"},
+		{name: "unmapped subject", namespace: "team-a", pod: pod(false, nil), reason: "Pod violates rule mapped-uid of NFSAccessPolicy mapped-uid\n"},
+		{name: "privileged outside ci", namespace: "team-a", pod: pod(false, &privileged), identity: identity, allowed: true},
+		{name: "privileged in ci", namespace: "ci-1", pod: pod(false, &privileged), identity: identity, reason: "CI pods can't be privileged"},
+		{name: "broken policy denies", namespace: "broken", pod: pod(false, nil), identity: identity, reason: "Rule typo of NFSAccessPolicy broken failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, reason := s.Evaluate(context.TODO(), Input{Pod: tt.pod, Namespace: tt.namespace, Subject: "user1", Identity: tt.identity})
+			assert.Equal(t, tt.allowed, allowed)
+			assert.Contains(t, reason, tt.reason)
+		})
+	}
+}
+
+func TestVariables(t *testing.T) {
+	uid, other := int64(1001), int64(1002)
+	in := Input{
+		Pod: &corev1.Pod{Spec: corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{RunAsUser: &uid},
+			Containers:      []corev1.Container{{Name: "app"}, {Name: "sidecar"}},
+		}},
+		Subject:  "user1",
+		Identity: &resolver.IdentitySpec{UID: &uid, GIDs: []int64{3000}},
+	}
+	vars, err := variables(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]interface{}{"name": "user1", "groups": []string{}, "uids": []int64{1001, 1001}, "uid": int64(1001)}, vars["subject"])
+	assert.Equal(t, []int64{1001}, vars["entry"].(map[string]interface{})["allowedUids"])
+	assert.Equal(t, false, vars["pod"].(map[string]interface{})["spec"].(map[string]interface{})["hostNetwork"])
+
+	in.Pod.Spec.Containers[1].SecurityContext = &corev1.SecurityContext{RunAsUser: &other}
+	assert.NotContains(t, subject(in), "uid")
+	assert.Equal(t, []int64{}, expand(mapping.IDRanges{{Min: 0, Max: 1 << 20}}))
+}
@@ -0,0 +1,73 @@
+package accesspolicy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/apis/nfsaccess/v1alpha1"
+)
+
+// costLimit bounds the cost of evaluating a single rule, so that a rule can't
+// stall admission
+const costLimit = 1000000
+
+// environment is the CEL environment rules are compiled in, declaring the pod,
+// namespace, subject and entry variables
+type environment struct {
+	env *cel.Env
+}
+
+// compiledRule is a rule ready to be evaluated, err is set when it doesn't compile
+type compiledRule struct {
+	name    string
+	message string
+	program cel.Program
+	err     error
+}
+
+// newEnvironment returns the environment rules are compiled in
+func newEnvironment() (*environment, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("pod", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("namespace", cel.StringType),
+		cel.Variable("subject", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("entry", cel.MapType(cel.StringType, cel.DynType)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CEL environment: %v", err)
+	}
+	return &environment{env: env}, nil
+}
+
+// compile compiles the expression of rule, which must return a bool
+func (e *environment) compile(rule v1alpha1.NFSAccessRule) *compiledRule {
+	c := &compiledRule{name: rule.Name, message: rule.Message}
+	ast, issues := e.env.Compile(rule.Expression)
+	if issues.Err() != nil {
+		c.err = fmt.Errorf("invalid expression: %v", issues.Err())
+		return c
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		c.err = fmt.Errorf("expression returns %s, expected bool", ast.OutputType())
+		return c
+	}
+	c.program, c.err = e.env.Program(ast, cel.CostLimit(costLimit), cel.InterruptCheckFrequency(100))
+	return c
+}
+
+// eval evaluates the rule against vars
+func (c *compiledRule) eval(ctx context.Context, vars map[string]interface{}) (bool, error) {
+	if c.err != nil {
+		return false, c.err
+	}
+	out, _, err := c.program.ContextEval(ctx, vars)
+	if err != nil {
+		return false, err
+	}
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returned %v, expected bool", out.Value())
+	}
+	return result, nil
+}
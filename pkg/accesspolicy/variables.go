@@ -0,0 +1,223 @@
+package accesspolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// maxExpandedIDs is the maximum number of IDs of the allowedUids list of entries,
+// larger UID ranges are only described by uidRanges
+const maxExpandedIDs = 65536
+
+// variables returns the CEL variables of in:
+//   - pod: the pod, with every field of its spec set, pointers excepted
+//   - namespace: the namespace of the pod
+//   - subject: {name, groups, uids, uid} where uids are the runAsUser values of
+//     the containers of the pod, uid is only set when they all run as the same UID
+//   - entry: {found, uid, allowedUids, uidRanges, gids} the mapping entry of the
+//     subject, uid is only set when the entry has one
+func variables(in Input) (map[string]interface{}, error) {
+	pod, err := toValue(reflect.ValueOf(in.Pod))
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert pod for access policies: %v", err)
+	}
+	return map[string]interface{}{
+		"pod":       pod,
+		"namespace": in.Namespace,
+		"subject":   subject(in),
+		"entry":     entry(in),
+	}, nil
+}
+
+// subject returns the subject variable of in
+func subject(in Input) map[string]interface{} {
+	groups := in.Groups
+	if groups == nil {
+		groups = []string{}
+	}
+	s := map[string]interface{}{"name": in.Subject, "groups": groups}
+
+	var podUID *int64
+	if sc := in.Pod.Spec.SecurityContext; sc != nil {
+		podUID = sc.RunAsUser
+	}
+	var contexts []*corev1.SecurityContext
+	for _, c := range in.Pod.Spec.InitContainers {
+		contexts = append(contexts, c.SecurityContext)
+	}
+	for _, c := range in.Pod.Spec.Containers {
+		contexts = append(contexts, c.SecurityContext)
+	}
+	for _, c := range in.Pod.Spec.EphemeralContainers {
+		contexts = append(contexts, c.SecurityContext)
+	}
+
+	// uid is only set when every container runs with the same runAsUser
+	uids := []int64{}
+	agreed := len(contexts) > 0
+	for _, sc := range contexts {
+		uid := podUID
+		if sc != nil && sc.RunAsUser != nil {
+			uid = sc.RunAsUser
+		}
+		if uid == nil {
+			agreed = false
+			continue
+		}
+		if len(uids) > 0 && uids[0] != *uid {
+			agreed = false
+		}
+		uids = append(uids, *uid)
+	}
+	s["uids"] = uids
+	if agreed {
+		s["uid"] = uids[0]
+	}
+	return s
+}
+
+// entry returns the entry variable of in
+func entry(in Input) map[string]interface{} {
+	e := map[string]interface{}{"found": in.Identity != nil, "allowedUids": []int64{}, "uidRanges": []interface{}{}, "gids": []int64{}}
+	if in.Identity == nil {
+		return e
+	}
+	if in.Identity.UID != nil {
+		e["uid"] = *in.Identity.UID
+	}
+	allowed := in.Identity.AllowedUIDs()
+	e["allowedUids"] = expand(allowed)
+	ranges := []interface{}{}
+	for _, r := range allowed {
+		ranges = append(ranges, map[string]interface{}{"min": r.Min, "max": r.Max})
+	}
+	e["uidRanges"] = ranges
+	if in.Identity.GIDs != nil {
+		e["gids"] = in.Identity.GIDs
+	}
+	return e
+}
+
+// expand returns the IDs of ranges, skipping ranges once maxExpandedIDs is reached
+func expand(ranges mapping.IDRanges) []int64 {
+	ids := []int64{}
+	for _, r := range ranges {
+		if int64(len(ids))+r.Max-r.Min+1 > maxExpandedIDs {
+			continue
+		}
+		for id := r.Min; id <= r.Max; id++ {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// jsonMarshaler is implemented by types with their own JSON representation,
+// e.g. metav1.Time, resource.Quantity and intstr.IntOrString
+var jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// toValue converts v into CEL friendly values the way it is serialized to JSON,
+// except that fields with zero values are kept so that e.g. pod.spec.hostNetwork
+// can be used without has(). Nil pointers are left out, so has() tells whether
+// optional fields are set.
+func toValue(v reflect.Value) (interface{}, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		if !v.Type().Implements(jsonMarshaler) {
+			return toValue(v.Elem())
+		}
+	}
+	if v.Type().Implements(jsonMarshaler) {
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return nil, err
+		}
+		var out interface{}
+		return out, json.Unmarshal(data, &out)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		m := map[string]interface{}{}
+		return m, addFields(m, v)
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil
+		}
+		list := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			item, err := toValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, nil
+	case reflect.Map:
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			item, err := toValue(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(iter.Key().Interface())] = item
+		}
+		return m, nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return toValue(v.Elem())
+	}
+	return nil, fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// addFields adds the exported fields of the struct v to m by JSON name, inlining
+// embedded structs and skipping nil values
+func addFields(m map[string]interface{}, v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && (name == "" || strings.Contains(opts, "inline")) {
+			if err := addFields(m, v.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		value, err := toValue(v.Field(i))
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		if value != nil {
+			m[name] = value
+		}
+	}
+	return nil
+}
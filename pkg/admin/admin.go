@@ -0,0 +1,478 @@
+// Package admin serves an API managing the entries of the mapping objects, so
+// that mappings are changed through validated and audited requests rather than
+// by editing the ConfigMaps or Secrets by hand
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// Group and Resource describe the virtual resource the requesters must be
+	// allowed to get, list, create, update or delete, e.g. by a Role granting
+	// `list` on `mappings.nfsaccess.io` in the namespace of the mapping objects
+	Group    = "nfsaccess.io"
+	Resource = "mappings"
+
+	// Prefix is the path of the mapping entries
+	Prefix = "/api/v1/mappings"
+	// WhoAmIPath is the path answering the identity of the requester
+	WhoAmIPath = "/api/v1/whoami"
+)
+
+// Entry is the mapping entry of a user or serviceAccount, as flat entries of the
+// UID and GID mapping objects
+type Entry struct {
+	Subject string `json:"subject"`
+	// UIDs are the UIDs of the subject, e.g. "1001" or "2000-2099,2500"
+	UIDs string `json:"uids,omitempty"`
+	// GIDs are the GIDs of the subject
+	GIDs []int64 `json:"gids,omitempty"`
+}
+
+// Server serves the mapping entries of the mapping objects of source on Prefix,
+// and the identity of the requesters on WhoAmIPath. Requests are authenticated
+// by their bearer token with a TokenReview, the ones of the mapping entries are
+// authorized on the Group Resource with a SubjectAccessReview.
+type Server struct {
+	client kubernetes.Interface
+	source mapping.Source
+
+	// Mappings serves the mapping entries, which are only read from the mapping
+	// objects by the configmap backend
+	Mappings bool
+	// Resolver returns the resolver of the identities answered on WhoAmIPath,
+	// nil disables it
+	Resolver func() resolver.UIDResolver
+	Logger   *logrus.Entry
+}
+
+// NewServer returns a Server writing the entries to the mapping objects of source
+func NewServer(client kubernetes.Interface, source mapping.Source) *Server {
+	return &Server{
+		client:   client,
+		source:   source,
+		Mappings: true,
+		Logger:   logrus.WithField("component", "admin"),
+	}
+}
+
+// statusError is an error answered with its HTTP status code
+type statusError struct {
+	code int
+	err  error
+}
+
+func (e *statusError) Error() string { return e.err.Error() }
+
+// errorf returns a statusError of the given code
+func errorf(code int, format string, args ...interface{}) error {
+	return &statusError{code: code, err: fmt.Errorf(format, args...)}
+}
+
+// Handler returns the handler of the mapping entries
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	if s.Mappings {
+		mux.HandleFunc("GET "+Prefix, s.handle("list", s.list))
+		mux.HandleFunc("POST "+Prefix, s.handle("create", s.create))
+		mux.HandleFunc("GET "+Prefix+"/{subject}", s.handle("get", s.get))
+		mux.HandleFunc("PUT "+Prefix+"/{subject}", s.handle("update", s.update))
+		mux.HandleFunc("DELETE "+Prefix+"/{subject}", s.handle("delete", s.delete))
+	}
+	if s.Resolver != nil {
+		mux.HandleFunc("GET "+WhoAmIPath, s.handle("", s.whoami))
+	}
+	return mux
+}
+
+// handler answers an authorized request of user, with the status and the body
+// of the response
+type handler func(ctx context.Context, r *http.Request, user authenticationv1.UserInfo) (int, interface{}, error)
+
+// handle authenticates and authorizes the requests for verb before calling h,
+// requests are only authenticated without verb
+func (s *Server) handle(verb string, h handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		user, err := s.authenticate(ctx, r)
+		if err == nil && verb != "" {
+			err = s.authorize(ctx, user, verb, r.PathValue("subject"))
+		}
+		status, body := http.StatusOK, interface{}(nil)
+		if err == nil {
+			status, body, err = h(ctx, r, user)
+		}
+		if err != nil {
+			status = http.StatusInternalServerError
+			var se *statusError
+			if errors.As(err, &se) {
+				status = se.code
+			} else {
+				s.Logger.Errorf("cannot answer %s %s: %v", r.Method, r.URL.Path, err)
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if body != nil {
+			if err := json.NewEncoder(w).Encode(body); err != nil {
+				s.Logger.Errorf("cannot write response: %v", err)
+			}
+		}
+	}
+}
+
+// authenticate returns the user of the bearer token of r, checked with a TokenReview
+func (s *Server) authenticate(ctx context.Context, r *http.Request) (authenticationv1.UserInfo, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || strings.TrimSpace(token) == "" {
+		return authenticationv1.UserInfo{}, errorf(http.StatusUnauthorized, "missing bearer token")
+	}
+	review := &authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: strings.TrimSpace(token)}}
+	res, err := s.client.AuthenticationV1().TokenReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return authenticationv1.UserInfo{}, fmt.Errorf("TokenReview failed: %w", err)
+	}
+	if !res.Status.Authenticated {
+		return authenticationv1.UserInfo{}, errorf(http.StatusUnauthorized, "invalid bearer token")
+	}
+	return res.Status.User, nil
+}
+
+// authorize checks with a SubjectAccessReview that user may use verb on the
+// mapping entry of subject, or on every mapping entry without subject
+func (s *Server) authorize(ctx context.Context, user authenticationv1.UserInfo, verb, subject string) error {
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: s.source.Namespace,
+				Verb:      verb,
+				Group:     Group,
+				Resource:  Resource,
+				Name:      subject,
+			},
+		},
+	}
+	res, err := s.client.AuthorizationV1().SubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("SubjectAccessReview failed: %w", err)
+	}
+	if !res.Status.Allowed {
+		return errorf(http.StatusForbidden, "%s cannot %s %s.%s", user.Username, verb, Resource, Group)
+	}
+	return nil
+}
+
+// list returns the entries of every subject, sorted by subject
+func (s *Server) list(ctx context.Context, _ *http.Request, _ authenticationv1.UserInfo) (int, interface{}, error) {
+	entries, err := s.entries(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	list := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Subject < list[j].Subject })
+	return http.StatusOK, list, nil
+}
+
+// get returns the entry of a subject
+func (s *Server) get(ctx context.Context, r *http.Request, _ authenticationv1.UserInfo) (int, interface{}, error) {
+	entries, err := s.entries(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	e, ok := entries[r.PathValue("subject")]
+	if !ok {
+		return 0, nil, errorf(http.StatusNotFound, "no mapping entry for %s", r.PathValue("subject"))
+	}
+	return http.StatusOK, e, nil
+}
+
+// create adds the entry of a subject not mapped yet
+func (s *Server) create(ctx context.Context, r *http.Request, user authenticationv1.UserInfo) (int, interface{}, error) {
+	e, err := decodeEntry(r, "")
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := s.write(ctx, user, "create", e.Subject, &e); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, e, nil
+}
+
+// update sets the entry of a subject, mapped or not
+func (s *Server) update(ctx context.Context, r *http.Request, user authenticationv1.UserInfo) (int, interface{}, error) {
+	e, err := decodeEntry(r, r.PathValue("subject"))
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := s.write(ctx, user, "update", e.Subject, &e); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, e, nil
+}
+
+// delete removes the entry of a mapped subject
+func (s *Server) delete(ctx context.Context, r *http.Request, user authenticationv1.UserInfo) (int, interface{}, error) {
+	if err := s.write(ctx, user, "delete", r.PathValue("subject"), nil); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+// decodeEntry decodes the entry of the body of r, whose subject must be subject
+// when set
+func decodeEntry(r *http.Request, subject string) (Entry, error) {
+	var e Entry
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&e); err != nil {
+		return e, errorf(http.StatusBadRequest, "invalid mapping entry: %v", err)
+	}
+	if subject != "" {
+		if e.Subject != "" && e.Subject != subject {
+			return e, errorf(http.StatusBadRequest, "subject %q of the entry doesn't match %q", e.Subject, subject)
+		}
+		e.Subject = subject
+	}
+	if e.Subject == "" || e.Subject == mapping.DocumentKey {
+		return e, errorf(http.StatusBadRequest, "invalid subject %q", e.Subject)
+	}
+	if e.UIDs == "" {
+		return e, errorf(http.StatusBadRequest, "the entry of %s has no uids", e.Subject)
+	}
+	return e, nil
+}
+
+// entries returns the flat entries of the UID and GID mapping objects by subject
+func (s *Server) entries(ctx context.Context) (map[string]Entry, error) {
+	uids, err := s.data(ctx, s.source.UIDName)
+	if err != nil {
+		return nil, err
+	}
+	gids, err := s.data(ctx, s.source.GIDName)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := map[string]Entry{}
+	for subject, value := range uids {
+		if subject != mapping.DocumentKey {
+			entries[subject] = Entry{Subject: subject, UIDs: value}
+		}
+	}
+	for subject, value := range gids {
+		e, ok := entries[subject]
+		if !ok || subject == mapping.DocumentKey {
+			continue
+		}
+		for _, gid := range strings.Split(value, ",") {
+			if id, err := strconv.ParseInt(strings.TrimSpace(gid), 10, 64); err == nil {
+				e.GIDs = append(e.GIDs, id)
+			}
+		}
+		entries[subject] = e
+	}
+	return entries, nil
+}
+
+// write sets the entry of subject, or deletes it when e is nil, in the UID then
+// the GID mapping object. The changes are validated like the writes of the
+// mapping objects by the validating webhook and audit logged.
+func (s *Server) write(ctx context.Context, user authenticationv1.UserInfo, verb, subject string, e *Entry) error {
+	var old string
+	err := s.updateObject(ctx, s.source.UIDName, func(data map[string]string) error {
+		if err := s.checkDocument(data, subject); err != nil {
+			return err
+		}
+		value, mapped := data[subject]
+		switch {
+		case verb == "create" && mapped:
+			return errorf(http.StatusConflict, "%s is already mapped", subject)
+		case verb == "delete" && !mapped:
+			return errorf(http.StatusNotFound, "no mapping entry for %s", subject)
+		}
+		old = value
+		if e == nil {
+			delete(data, subject)
+		} else {
+			data[subject] = e.UIDs
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	gids, err := s.data(ctx, s.source.GIDName)
+	if err != nil {
+		return err
+	}
+	oldGIDs, mapped := gids[subject]
+	if !mapped && (e == nil || len(e.GIDs) == 0) {
+		s.audit(user, verb, subject, old, oldGIDs, e)
+		return nil
+	}
+	err = s.updateObject(ctx, s.source.GIDName, func(data map[string]string) error {
+		oldGIDs = data[subject]
+		if e == nil || len(e.GIDs) == 0 {
+			delete(data, subject)
+			return nil
+		}
+		gids := make([]string, len(e.GIDs))
+		for i, gid := range e.GIDs {
+			gids[i] = strconv.FormatInt(gid, 10)
+		}
+		data[subject] = strings.Join(gids, ",")
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("UIDs of %s written but not its GIDs: %w", subject, err)
+	}
+
+	s.audit(user, verb, subject, old, oldGIDs, e)
+	return nil
+}
+
+// audit logs the change of the entry of subject by user, e being nil when deleted
+func (s *Server) audit(user authenticationv1.UserInfo, verb, subject, oldUIDs, oldGIDs string, e *Entry) {
+	fields := logrus.Fields{
+		"audit":   "admin",
+		"verb":    verb,
+		"subject": subject,
+		"user":    user.Username,
+		"oldUIDs": oldUIDs,
+		"oldGIDs": oldGIDs,
+	}
+	if e != nil {
+		fields["uids"] = e.UIDs
+		fields["gids"] = e.GIDs
+	}
+	s.Logger.WithFields(fields).Info("Mapping entry changed")
+}
+
+// checkDocument refuses changes of the subjects of the mapping document, whose
+// entries win over the flat entries managed by the API
+func (s *Server) checkDocument(data map[string]string, subject string) error {
+	value, ok := data[mapping.DocumentKey]
+	if !ok {
+		return nil
+	}
+	document, err := mapping.ParseDocument([]byte(value))
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", mapping.DocumentKey, err)
+	}
+	if _, ok := document.Subjects[subject]; ok {
+		return errorf(http.StatusConflict, "%s is mapped by the %s document, edit it instead", subject, mapping.DocumentKey)
+	}
+	return nil
+}
+
+// data returns the data of the mapping object name, empty if it doesn't exist
+func (s *Server) data(ctx context.Context, name string) (map[string]string, error) {
+	if s.source.Kind == mapping.SecretKind {
+		secret, err := s.client.CoreV1().Secrets(s.source.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error getting Secret: %s\n", err)
+		}
+		data := make(map[string]string, len(secret.Data))
+		for k, v := range secret.Data {
+			data[k] = string(v)
+		}
+		return data, nil
+	}
+
+	configMap, err := s.client.CoreV1().ConfigMaps(s.source.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error getting ConfigMap: %s\n", err)
+	}
+	return configMap.Data, nil
+}
+
+// updateObject applies update to the data of the mapping object name, which must
+// exist, and writes it if still valid. The object is read again and the update
+// retried on conflicts.
+func (s *Server) updateObject(ctx context.Context, name string, update func(map[string]string) error) error {
+	apply := func(data map[string]string) error {
+		if err := update(data); err != nil {
+			return err
+		}
+		if _, err := s.source.Validate(name, data); err != nil {
+			return errorf(http.StatusUnprocessableEntity, "invalid mapping: %v", err)
+		}
+		return nil
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if s.source.Kind == mapping.SecretKind {
+			secrets := s.client.CoreV1().Secrets(s.source.Namespace)
+			secret, err := secrets.Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return fmt.Errorf("Error getting Secret: %s\n", err)
+			}
+			data := make(map[string]string, len(secret.Data))
+			for k, v := range secret.Data {
+				data[k] = string(v)
+			}
+			if err := apply(data); err != nil {
+				return err
+			}
+			secret.Data = make(map[string][]byte, len(data))
+			for k, v := range data {
+				secret.Data[k] = []byte(v)
+			}
+			_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+			return err
+		}
+
+		configMaps := s.client.CoreV1().ConfigMaps(s.source.Namespace)
+		configMap, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("Error getting ConfigMap: %s\n", err)
+		}
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		if err := apply(configMap.Data); err != nil {
+			return err
+		}
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+		return err
+	})
+}
@@ -0,0 +1,106 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestServer(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: mapping.UIDConfigMapName, Namespace: "nfs"},
+			Data: map[string]string{
+				"user1":             "1001",
+				mapping.DocumentKey: "schemaVersion: v1\nsubjects:\n  user2:\n    uid: 1002",
+			},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: mapping.GIDConfigMapName, Namespace: "nfs"},
+			Data:       map[string]string{"user1": "1001,3000"},
+		},
+	)
+	// the tokens are the user names, the viewer may only get and list
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		review.Status.Authenticated = review.Spec.Token != "invalid"
+		review.Status.User = authenticationv1.UserInfo{Username: review.Spec.Token}
+		return true, review, nil
+	})
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attrs := review.Spec.ResourceAttributes
+		review.Status.Allowed = attrs.Group == Group && attrs.Resource == Resource && attrs.Namespace == "nfs" &&
+			(review.Spec.User == "admin" || attrs.Verb == "get" || attrs.Verb == "list")
+		return true, review, nil
+	})
+
+	source := mapping.Source{Kind: mapping.ConfigMapKind, Namespace: "nfs", UIDName: mapping.UIDConfigMapName, GIDName: mapping.GIDConfigMapName}
+	handler := NewServer(client, source).Handler()
+	do := func(method, path, token, body string) (int, string) {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code, strings.TrimSpace(w.Body.String())
+	}
+	data := func(name string) map[string]string {
+		cm, err := client.CoreV1().ConfigMaps("nfs").Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cm.Data
+	}
+
+	tests := []struct {
+		name                string
+		method, path, token string
+		body                string
+		code                int
+		response            string
+	}{
+		{name: "no token", method: "GET", path: Prefix, code: http.StatusUnauthorized},
+		{name: "invalid token", method: "GET", path: Prefix, token: "invalid", code: http.StatusUnauthorized},
+		{name: "list", method: "GET", path: Prefix, token: "viewer", code: http.StatusOK, response: `[{"subject":"user1","uids":"1001","gids":[1001,3000]}]`},
+		{name: "get", method: "GET", path: Prefix + "/user1", token: "viewer", code: http.StatusOK, response: `{"subject":"user1","uids":"1001","gids":[1001,3000]}`},
+		{name: "get unmapped", method: "GET", path: Prefix + "/user3", token: "viewer", code: http.StatusNotFound},
+		{name: "forbidden", method: "POST", path: Prefix, token: "viewer", body: `{"subject":"user3","uids":"1003"}`, code: http.StatusForbidden},
+		{name: "create", method: "POST", path: Prefix, token: "admin", body: `{"subject":"user3","uids":"1003","gids":[1003]}`, code: http.StatusCreated},
+		{name: "create mapped", method: "POST", path: Prefix, token: "admin", body: `{"subject":"user1","uids":"1004"}`, code: http.StatusConflict},
+		{name: "create invalid", method: "POST", path: Prefix, token: "admin", body: `{"subject":"user4","uids":"1OO4"}`, code: http.StatusUnprocessableEntity},
+		{name: "unknown field", method: "POST", path: Prefix, token: "admin", body: `{"subject":"user4","uid":1004}`, code: http.StatusBadRequest},
+		{name: "document subject", method: "PUT", path: Prefix + "/user2", token: "admin", body: `{"uids":"1005"}`, code: http.StatusConflict},
+		{name: "subject mismatch", method: "PUT", path: Prefix + "/user1", token: "admin", body: `{"subject":"user3","uids":"1005"}`, code: http.StatusBadRequest},
+		{name: "update", method: "PUT", path: Prefix + "/user1", token: "admin", body: `{"uids":"2000-2099"}`, code: http.StatusOK},
+		{name: "delete", method: "DELETE", path: Prefix + "/user3", token: "admin", code: http.StatusNoContent},
+		{name: "delete unmapped", method: "DELETE", path: Prefix + "/user3", token: "admin", code: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		code, response := do(tt.method, tt.path, tt.token, tt.body)
+		assert.Equal(t, tt.code, code, "%s: %s", tt.name, response)
+		if tt.response != "" {
+			assert.Equal(t, tt.response, response, tt.name)
+		}
+	}
+
+	assert.Equal(t, map[string]string{
+		"user1":             "2000-2099",
+		mapping.DocumentKey: "schemaVersion: v1\nsubjects:\n  user2:\n    uid: 1002",
+	}, data(mapping.UIDConfigMapName))
+	// the GIDs of user1 were dropped by the update, the ones of user3 by the delete
+	assert.Empty(t, data(mapping.GIDConfigMapName))
+}
@@ -0,0 +1,59 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+// Identity is the identity the pods of a user or serviceAccount must use
+type Identity struct {
+	// User is the name of the requester
+	User string `json:"user"`
+	// Subject is the subject of the mappings, the name of a serviceAccount
+	Subject string `json:"subject"`
+	// Namespace is the namespace the identity was resolved in
+	Namespace string `json:"namespace,omitempty"`
+	// UID is the runAsUser injected by the mutating webhook
+	UID *int64 `json:"uid,omitempty"`
+	// UIDs are the runAsUser values allowed, e.g. "1001" or "2000-2099"
+	UIDs string `json:"uids,omitempty"`
+	// GIDs are the runAsGroup, fsGroup and supplementalGroups values allowed
+	GIDs []int64 `json:"gids,omitempty"`
+}
+
+// whoami returns the identity of the requester, resolved like the webhook does
+// for the pods it creates. ServiceAccounts are resolved in their namespace, users
+// through the mappings of their groups in the namespace query parameter if any.
+func (s *Server) whoami(ctx context.Context, r *http.Request, user authenticationv1.UserInfo) (int, interface{}, error) {
+	identity := Identity{User: user.Username, Subject: user.Username, Namespace: r.URL.Query().Get("namespace")}
+	subject := user.Username
+	var groups []string
+	if parts := strings.Split(user.Username, ":"); len(parts) == 4 && strings.HasPrefix(user.Username, "system:serviceaccount:") {
+		identity.Namespace, identity.Subject = parts[2], parts[3]
+	} else {
+		for _, group := range user.Groups {
+			if !strings.HasPrefix(group, "system:") {
+				groups = append(groups, group)
+			}
+		}
+	}
+
+	spec, err := resolver.ResolveUser(ctx, s.Resolver(), identity.Namespace, subject, groups)
+	if errors.Is(err, resolver.ErrNotFound) {
+		return 0, nil, errorf(http.StatusNotFound, "no identity is mapped to %s, ask the administrators of the mappings", identity.Subject)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	identity.UID = spec.UID
+	if uids := spec.AllowedUIDs(); len(uids) > 0 {
+		identity.UIDs = uids.String()
+	}
+	identity.GIDs = spec.GIDs
+	return http.StatusOK, identity, nil
+}
@@ -0,0 +1,75 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// mapResolver resolves the identities of its subjects
+type mapResolver map[string]resolver.IdentitySpec
+
+func (r mapResolver) Resolve(_ context.Context, subject string) (resolver.IdentitySpec, error) {
+	if id, ok := r[subject]; ok {
+		return id, nil
+	}
+	return resolver.IdentitySpec{}, resolver.ErrNotFound
+}
+
+func TestWhoAmI(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	// the tokens are the user names, members of the eng group
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		review.Status.Authenticated = true
+		review.Status.User = authenticationv1.UserInfo{Username: review.Spec.Token, Groups: []string{"system:authenticated", "eng"}}
+		return true, review, nil
+	})
+	uid := int64(1001)
+	groupUID := int64(3000)
+	identities := mapResolver{
+		"builder":   {UID: &uid, GIDs: []int64{1001, 4000}},
+		"group.eng": {UID: &groupUID, UIDs: mapping.IDRanges{{Min: 3000, Max: 3099}}},
+	}
+
+	s := NewServer(client, mapping.Source{Namespace: "nfs"})
+	s.Mappings = false
+	s.Resolver = func() resolver.UIDResolver { return identities }
+	handler := s.Handler()
+	do := func(path, token string) (int, string) {
+		r := httptest.NewRequest("GET", path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code, strings.TrimSpace(w.Body.String())
+	}
+
+	code, body := do(WhoAmIPath, "system:serviceaccount:team-a:builder")
+	assert.Equal(t, http.StatusOK, code, body)
+	assert.Equal(t, `{"user":"system:serviceaccount:team-a:builder","subject":"builder","namespace":"team-a","uid":1001,"uids":"1001","gids":[1001,4000]}`, body)
+
+	// users are resolved through the mappings of their groups
+	code, body = do(WhoAmIPath+"?namespace=team-b", "alice")
+	assert.Equal(t, http.StatusOK, code, body)
+	assert.Equal(t, `{"user":"alice","subject":"alice","namespace":"team-b","uid":3000,"uids":"3000-3099"}`, body)
+
+	code, _ = do(WhoAmIPath, "system:serviceaccount:team-a:unmapped")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = do(WhoAmIPath, "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	// the mapping entries are not served
+	code, _ = do(Prefix, "alice")
+	assert.Equal(t, http.StatusNotFound, code)
+}
@@ -4,14 +4,30 @@
 package admission
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
 
 	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/auditlog"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/events"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/exemption"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/messages"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/metrics"
 	"github.com/tensorchord/nfs-pod-access-control/pkg/mutation"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/nfs"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/notify"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/report"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
 	"github.com/tensorchord/nfs-pod-access-control/pkg/validation"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	types "k8s.io/apimachinery/pkg/types"
@@ -21,47 +37,634 @@ import (
 type Admitter struct {
 	Logger  *logrus.Entry
 	Request *admissionv1.AdmissionRequest
+
+	ValidationPolicy validation.Policy
+	MutationPolicy   mutation.Policy
+	Resolver         resolver.UIDResolver
+	// Scope selects the namespaces whose pods are validated and mutated
+	Scope NamespaceScope
+	// Exemptions checks the exemption labels of pods and namespaces, nil disables them
+	Exemptions *exemption.Checker
+	// Modes tells whether pods are enforced, audited or warned about, per namespace
+	Modes ModePolicy
+	// Events emits an Event about every rejected pod, nil disables them
+	Events *events.Recorder
+	// Reports records every rejected pod in the NFSAccessReport of its namespace,
+	// nil disables them
+	Reports *report.Writer
+	// Notifier posts summaries of the rejected pods to a chat or generic webhook,
+	// nil disables them
+	Notifier *notify.Notifier
+	// AuditLog writes an audit record of every decision, nil disables them
+	AuditLog *auditlog.Logger
+	// NFS restricts enforcement to pods mounting NFS storage, nil enforces every pod
+	NFS *nfs.Detector
+	// FailOpen admits the pods that would be rejected while its circuit is open,
+	// i.e. the identity backend is unavailable, nil always fails closed
+	FailOpen *resolver.CircuitBreaker
+	// Messages renders the messages of denied pods, nil returns the messages of
+	// the validators
+	Messages *messages.Templates
+	// RemediationHints adds the pod spec fields fixing the denials of pods to their
+	// message, and to the warnings of the warn mode
+	RemediationHints bool
+	// Decisions remembers the allowed pods to skip the validation of identical
+	// ones, nil validates every pod
+	Decisions *DecisionCache
+	// RateLimits bounds the rate of the admission requests of every namespace,
+	// nil admits them at any rate
+	RateLimits *RateLimiter
+	// Shadow evaluates the validated pods against a candidate policy and mappings
+	// as well, nil disables it
+	Shadow *Shadow
 }
 
 // MutatePodReview takes an admission request and mutates the pod within,
-// it returns an admission review with mutations as a json patch (if any)
-func (a Admitter) MutatePodReview() (*admissionv1.AdmissionReview, error) {
+// it returns an admission review with mutations as a json patch (if any).
+// The decision is recorded on the span of ctx.
+func (a Admitter) MutatePodReview(ctx context.Context) (review *admissionv1.AdmissionReview, err error) {
+	if a.DryRun() {
+		a.Logger = a.Logger.WithField("dry_run", true)
+	}
+	decision := metrics.DecisionError
+	defer func() { a.observe(ctx, "mutate", review, decision, "") }()
+	a.logRequest()
+
 	pod, err := a.Pod()
 	if err != nil {
 		e := fmt.Sprintf("could not parse pod in admission review request: %v", err)
 		return reviewResponse(a.Request.UID, false, http.StatusBadRequest, e), err
 	}
-	m := mutation.NewMutator(a.Logger)
-	patch, err := m.MutatePodPatch(pod, a.Request)
+	if !a.Scope.Contains(a.Request.Namespace) {
+		a.Logger.Debugf("namespace %s is not enforced, skipping mutation", a.Request.Namespace)
+		decision = metrics.DecisionOutOfScope
+		return reviewResponse(a.Request.UID, true, http.StatusAccepted, "namespace not enforced"), nil
+	}
+	if !a.mountsNFS(ctx, pod) {
+		a.Logger.Debugf("pod doesn't mount NFS, skipping mutation")
+		decision = metrics.DecisionOutOfScope
+		return reviewResponse(a.Request.UID, true, http.StatusAccepted, "pod doesn't mount NFS"), nil
+	}
+	if review, limitedDecision, limited := a.rateLimited("mutate"); limited {
+		decision = limitedDecision
+		return review, nil
+	}
+	exempt, reason, err := a.exempt(ctx, pod)
+	if err != nil {
+		e := fmt.Sprintf("could not check pod exemption: %v", err)
+		return reviewResponse(a.Request.UID, false, http.StatusInternalServerError, e), err
+	}
+	if exempt {
+		a.Logger.Infof("pod exempted, skipping mutation: %s", reason)
+		decision = metrics.DecisionExempted
+		return reviewResponse(a.Request.UID, true, http.StatusAccepted, reason), nil
+	}
+
+	mode := a.Modes.For(a.Request.Namespace)
+	m := mutation.NewMutator(a.Logger, a.MutationPolicy, a.Resolver)
+	m.NFS = a.NFS
+	patch, err := m.MutatePodPatch(ctx, pod, a.Request)
 	if err != nil {
 		e := fmt.Sprintf("could not mutate pod: %v", err)
+		if mode != ModeEnforce {
+			decision = modeDecision(mode)
+			return a.admitUnenforced(mode, outcomeDeny, e), nil
+		}
+		if a.failingOpen() {
+			decision = metrics.DecisionFailedOpen
+			return a.admitFailedOpen(ctx, pod, e), nil
+		}
+		a.denied(ctx, pod, e, nil)
 		return reviewResponse(a.Request.UID, false, http.StatusBadRequest, e), err
 	}
 
+	paths := patchPaths(patch)
+	if mode != ModeEnforce {
+		if len(paths) == 0 {
+			decision = metrics.DecisionAllowed
+			return reviewResponse(a.Request.UID, true, http.StatusAccepted, "no mutation"), nil
+		}
+		decision = modeDecision(mode)
+		return a.admitUnenforced(mode, outcomeMutate, strings.Join(paths, ", ")), nil
+	}
+
+	decision = metrics.DecisionMutated
+	if len(paths) == 0 {
+		decision = metrics.DecisionAllowed
+	}
 	return patchReviewResponse(a.Request.UID, patch)
 }
 
-// MutatePodReview takes an admission request and validates the pod within
-// it returns an admission review
-func (a Admitter) ValidatePodReview() (*admissionv1.AdmissionReview, error) {
-	pod, err := a.Pod()
+// ValidatePodReview takes an admission request and validates the pod within,
+// or the pod template of a workload, it returns an admission review.
+// The decision is recorded on the span of ctx.
+func (a Admitter) ValidatePodReview(ctx context.Context) (review *admissionv1.AdmissionReview, err error) {
+	if a.DryRun() {
+		a.Logger = a.Logger.WithField("dry_run", true)
+	}
+	decision, validator := metrics.DecisionError, ""
+	defer func() { a.observe(ctx, "validate", review, decision, validator) }()
+	a.logRequest()
+
+	pod, changed, err := a.WorkloadPod()
 	if err != nil {
 		e := fmt.Sprintf("could not parse pod in admission review request: %v", err)
 		return reviewResponse(a.Request.UID, false, http.StatusBadRequest, e), err
 	}
+	if !changed {
+		decision = metrics.DecisionAllowed
+		return reviewResponse(a.Request.UID, true, http.StatusAccepted, "pod template unchanged"), nil
+	}
+	if !a.Scope.Contains(a.Request.Namespace) {
+		a.Logger.Debugf("namespace %s is not enforced, skipping validation", a.Request.Namespace)
+		decision = metrics.DecisionOutOfScope
+		return reviewResponse(a.Request.UID, true, http.StatusAccepted, "namespace not enforced"), nil
+	}
+	if !a.mountsNFS(ctx, pod) {
+		a.Logger.Debugf("pod doesn't mount NFS, skipping validation")
+		decision = metrics.DecisionOutOfScope
+		return reviewResponse(a.Request.UID, true, http.StatusAccepted, "pod doesn't mount NFS"), nil
+	}
+	if review, limitedDecision, limited := a.rateLimited("validate"); limited {
+		decision = limitedDecision
+		return review, nil
+	}
+	exempt, reason, err := a.exempt(ctx, pod)
+	if err != nil {
+		e := fmt.Sprintf("could not check pod exemption: %v", err)
+		return reviewResponse(a.Request.UID, false, http.StatusInternalServerError, e), err
+	}
+	if exempt {
+		a.Logger.Infof("pod exempted, skipping validation: %s", reason)
+		decision = metrics.DecisionExempted
+		return reviewResponse(a.Request.UID, true, http.StatusAccepted, reason), nil
+	}
 
-	v := validation.NewValidator(a.Logger)
-	val, err := v.ValidatePod(pod, a.Request)
+	if a.Decisions != nil {
+		cached := a.Decisions.Allowed(ctx, a.podRequest(pod), pod)
+		metrics.ObserveDecisionCache(cached)
+		if cached {
+			a.Logger.Debug("identical pod allowed recently, skipping validation")
+			decision = metrics.DecisionAllowed
+			return a.allowed(), nil
+		}
+	}
+
+	mode := a.Modes.For(a.Request.Namespace)
+	policy := a.ValidationPolicy
+	if a.isWorkload() {
+		// runAsUser is injected by the mutating webhook when pods are created
+		policy.RequireRunAsUser = false
+	}
+	v := validation.NewValidator(a.Logger, policy, a.Resolver)
+	val, err := v.ValidatePod(ctx, pod, a.podRequest(pod))
+	validator = val.Validator
+	a.audited(val.Audited)
+	if err == nil {
+		a.Shadow.compare(ctx, a, pod, val.Valid, val.Validator)
+	}
 	if err != nil {
 		e := fmt.Sprintf("could not validate pod: %v", err)
+		if mode != ModeEnforce {
+			decision = modeDecision(mode)
+			return a.admitUnenforced(mode, outcomeDeny, e), nil
+		}
+		if a.failingOpen() && lookupFailures(val.Denied) {
+			decision = metrics.DecisionFailedOpen
+			return a.admitFailedOpen(ctx, pod, e), nil
+		}
+		a.denied(ctx, pod, e, nil)
 		return reviewResponse(a.Request.UID, false, http.StatusBadRequest, e), err
 	}
 
 	if !val.Valid {
-		return reviewResponse(a.Request.UID, false, http.StatusForbidden, val.Reason), nil
+		message := a.denialMessage(pod, val.Reason, val.Denied)
+		var hint []string
+		if a.RemediationHints {
+			hint = validation.Remediation(val.Denied)
+		}
+		if mode != ModeEnforce {
+			decision = modeDecision(mode)
+			review = a.admitUnenforced(mode, outcomeDeny, message)
+			if mode == ModeWarn && len(hint) > 0 {
+				review.Response.Warnings = append(review.Response.Warnings, "suggested fix in the pod spec: "+strings.Join(hint, "; "))
+			}
+			return review, nil
+		}
+		if len(hint) > 0 {
+			message += "Suggested fix in the pod spec:\n  " + strings.Join(hint, "\n  ") + "\n"
+		}
+		if a.failingOpen() && a.onlyLookupFailures(ctx, policy, pod, val.Denied) {
+			decision = metrics.DecisionFailedOpen
+			return a.admitFailedOpen(ctx, pod, val.Reason), nil
+		}
+		decision = metrics.DecisionDenied
+		a.denied(ctx, pod, message, val.Denied)
+		review = reviewResponse(a.Request.UID, false, http.StatusForbidden, message)
+		a.setDenialStatus(review.Response.Result, pod, val.Code, val.Denied)
+		return review, nil
+	}
+
+	decision = metrics.DecisionAllowed
+	if len(val.Audited) == 0 {
+		// pods denied by validators in audit mode are validated every time to record them
+		a.Decisions.Allow(ctx, a.podRequest(pod), pod)
+	}
+	return a.allowed(), nil
+}
+
+// allowed returns the review of a valid pod or pod template
+func (a Admitter) allowed() *admissionv1.AdmissionReview {
+	if a.isWorkload() {
+		return reviewResponse(a.Request.UID, true, http.StatusAccepted, "valid pod template")
+	}
+	return reviewResponse(a.Request.UID, true, http.StatusAccepted, "valid pod")
+}
+
+// audited records the denials of the validators in audit mode, which don't
+// affect the admission of the pod
+func (a Admitter) audited(findings []validation.Finding) {
+	for _, f := range findings {
+		a.Logger.WithFields(logrus.Fields{
+			"audit":     outcomeDeny,
+			"validator": f.Validator,
+			"namespace": a.Request.Namespace,
+			"user":      a.Request.UserInfo.Username,
+		}).Warn(strings.TrimSpace(f.Reason))
+		metrics.ObserveValidatorAudit(f.Validator, a.DryRun())
+	}
+}
+
+// denialMessage returns the message of a pod denied for reason, rendering the
+// templates of Messages for every denial
+func (a Admitter) denialMessage(pod *corev1.Pod, reason string, denied []validation.Finding) string {
+	if a.Messages == nil || len(denied) == 0 {
+		return reason
+	}
+	name := pod.Name
+	if name == "" {
+		name = pod.GenerateName
+	}
+	var message strings.Builder
+	for i, d := range denied {
+		if i > 0 && !strings.HasSuffix(message.String(), "\n") {
+			message.WriteString("\n")
+		}
+		subject := d.Details["subject"]
+		if subject == "" {
+			subject = a.Request.UserInfo.Username
+		}
+		rendered, err := a.Messages.Render(messages.Data{
+			Code:      d.Code,
+			Validator: d.Validator,
+			Message:   d.Reason,
+			Subject:   subject,
+			Namespace: a.Request.Namespace,
+			Pod:       name,
+			Details:   d.Details,
+		})
+		if err != nil {
+			a.Logger.Error(err)
+		}
+		message.WriteString(rendered)
+	}
+	return message.String()
+}
+
+// setDenialStatus makes the status of a denied pod machine-readable: its reason
+// is the code of the first denial, e.g. UIDMismatch, and its causes describe every
+// denial. Each denial gets a cause with its message and a cause per detail, e.g.
+// with the expectedUID field, all of them typed with the code of the denial.
+func (a Admitter) setDenialStatus(status *metav1.Status, pod *corev1.Pod, code string, denied []validation.Finding) {
+	name := pod.Name
+	if name == "" {
+		name = pod.GenerateName
+	}
+	status.Reason = metav1.StatusReason(code)
+	status.Details = &metav1.StatusDetails{Name: name, Group: a.Request.Resource.Group, Kind: a.Request.Resource.Resource}
+	for _, d := range denied {
+		causeType := metav1.CauseType(d.Code)
+		status.Details.Causes = append(status.Details.Causes,
+			metav1.StatusCause{Type: causeType, Message: strings.TrimSpace(d.Reason)},
+			metav1.StatusCause{Type: causeType, Field: "validator", Message: d.Validator},
+		)
+		fields := make([]string, 0, len(d.Details))
+		for field := range d.Details {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			status.Details.Causes = append(status.Details.Causes, metav1.StatusCause{Type: causeType, Field: field, Message: d.Details[field]})
+		}
+	}
+}
+
+// denied emits an Event about a rejected pod, records its findings in the report
+// of its namespace and queues its notification, unless the request is a dry-run
+func (a Admitter) denied(ctx context.Context, pod *corev1.Pod, message string, findings []validation.Finding) {
+	if a.DryRun() {
+		return
+	}
+	if a.Events != nil {
+		a.Events.Denied(ctx, pod, a.Request.Namespace, message)
+	}
+	if a.Reports != nil {
+		name := pod.Name
+		if name == "" {
+			name = pod.GenerateName
+		}
+		if name == "" {
+			name = a.Request.Name
+		}
+		a.Reports.Denied(a.Request.Namespace, a.Request.UserInfo.Username, name, message, findings)
+	}
+	if a.Notifier != nil {
+		a.Notifier.Denied(a.notification(pod, message, findings))
+	}
+}
+
+// notification describes a rejected pod for the denial notifications: the
+// workload is the object denied or the controller of the pod, and the reason
+// lists the reasons of the findings, without the remediation hints of message
+func (a Admitter) notification(pod *corev1.Pod, message string, findings []validation.Finding) notify.Denial {
+	d := notify.Denial{
+		Namespace: a.Request.Namespace,
+		Subject:   a.Request.UserInfo.Username,
+		Reason:    message,
+	}
+	if len(findings) > 0 {
+		d.Validator = findings[0].Validator
+		if subject := findings[0].Details["subject"]; subject != "" {
+			d.Subject = subject
+		}
+		reasons := make([]string, 0, len(findings))
+		for _, f := range findings {
+			reasons = append(reasons, strings.TrimSpace(f.Reason))
+		}
+		d.Reason = strings.Join(reasons, "; ")
+	}
+
+	controller := metav1.GetControllerOf(pod)
+	switch {
+	case a.isWorkload():
+		d.Workload = a.Request.Kind.Kind + "/" + a.Request.Name
+	case controller != nil:
+		d.Workload = controller.Kind + "/" + controller.Name
+	default:
+		name := pod.Name
+		if name == "" {
+			name = pod.GenerateName
+		}
+		d.Workload = "Pod/" + name
+	}
+	return d
+}
+
+// observe records the metrics and span attributes of an admission review answered by webhook
+func (a Admitter) observe(ctx context.Context, webhook string, review *admissionv1.AdmissionReview, decision, validator string) {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		// the answer is too late to count on, the API server may already have
+		// applied the failurePolicy of the webhook instead
+		a.Logger.Warnf("admission deadline exceeded, the %s decision may not be enforced", decision)
+		decision = metrics.DecisionTimedOut
 	}
+	allowed := review != nil && review.Response != nil && review.Response.Allowed
+	metrics.ObserveAdmission(webhook, allowed, a.DryRun(), decision, validator)
 
-	return reviewResponse(a.Request.UID, true, http.StatusAccepted, "valid pod"), nil
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.Bool("nfs.allowed", allowed),
+		attribute.String("nfs.decision", decision),
+	)
+	if validator != "" {
+		span.SetAttributes(attribute.String("nfs.validator", validator))
+	}
+
+	if a.AuditLog != nil {
+		a.AuditLog.Log(a.auditRecord(webhook, review, decision, validator))
+	}
+}
+
+// auditRecord returns the audit record of the decision about the request, the
+// subject and the expected IDs being read from the status of denied pods
+func (a Admitter) auditRecord(webhook string, review *admissionv1.AdmissionReview, decision, validator string) auditlog.Record {
+	r := auditlog.Record{
+		RequestUID: string(a.Request.UID),
+		Webhook:    webhook,
+		Decision:   decision,
+		DryRun:     a.DryRun(),
+		Operation:  string(a.Request.Operation),
+		Namespace:  a.Request.Namespace,
+		Kind:       a.Request.Kind.Kind,
+		Name:       a.Request.Name,
+		User:       a.Request.UserInfo.Username,
+		Validator:  validator,
+	}
+	if pod, _, err := a.WorkloadPod(); err == nil && pod != nil {
+		if r.Name == "" {
+			r.Name = pod.Name
+		}
+		if r.Name == "" {
+			r.Name = pod.GenerateName
+		}
+		r.Subject = validation.Subject(a.Request, pod)
+		r.IDs = auditlog.PodIDs(pod)
+	}
+	if review == nil || review.Response == nil {
+		return r
+	}
+	r.Allowed = review.Response.Allowed
+	if status := review.Response.Result; status != nil {
+		if !r.Allowed || decision != metrics.DecisionAllowed {
+			r.Reason = strings.TrimSpace(status.Message)
+		}
+		if status.Details != nil {
+			// the details of the first denial win over the subject inferred
+			subject := ""
+			for _, cause := range status.Details.Causes {
+				switch {
+				case cause.Field == "subject" && subject == "":
+					subject = cause.Message
+				case cause.Field == "expectedUID" && r.IDs.ExpectedUID == "":
+					r.IDs.ExpectedUID = cause.Message
+				case cause.Field == "expectedGIDs" && r.IDs.ExpectedGIDs == "":
+					r.IDs.ExpectedGIDs = cause.Message
+				}
+			}
+			if subject != "" {
+				r.Subject = subject
+			}
+		}
+	}
+	return r
+}
+
+// modeDecision returns the metrics decision of pods admitted in a non-enforce mode
+func modeDecision(mode Mode) string {
+	if mode == ModeWarn {
+		return metrics.DecisionWarned
+	}
+	return metrics.DecisionAudited
+}
+
+// outcomeDeny and outcomeMutate are what the webhook would have done to pods
+// admitted in audit and warn modes
+const (
+	outcomeDeny   = "would-deny"
+	outcomeMutate = "would-mutate"
+)
+
+// admitUnenforced admits a pod in audit or warn mode, recording what the webhook
+// would have done to it in enforce mode. In warn mode the outcome is also returned
+// as an admission warning, shown to the requester e.g. by kubectl.
+func (a Admitter) admitUnenforced(mode Mode, outcome, detail string) *admissionv1.AdmissionReview {
+	detail = strings.TrimSpace(detail)
+	a.Logger.WithFields(logrus.Fields{
+		"audit":     outcome,
+		"mode":      mode,
+		"namespace": a.Request.Namespace,
+		"user":      a.Request.UserInfo.Username,
+	}).Warn(detail)
+
+	message := "pod would be rejected: " + detail
+	if outcome == outcomeMutate {
+		message = "pod would be mutated: " + detail
+	}
+	review := reviewResponse(a.Request.UID, true, http.StatusAccepted, fmt.Sprintf("%s mode, %s", mode, message))
+	if mode == ModeWarn {
+		// warnings can't span several lines
+		review.Response.Warnings = []string{strings.ReplaceAll(message, "\n", " ")}
+	}
+	return review
+}
+
+// failingOpen returns true if pods that would be rejected are admitted because
+// the identity backend is unavailable
+func (a Admitter) failingOpen() bool {
+	return a.FailOpen != nil && a.FailOpen.Open()
+}
+
+// onlyLookupFailures returns true if the only denials of pod are failures to
+// resolve identities, which the pod may be admitted despite while failing open.
+// The validators skipped after the first denial are applied as well, so that a
+// lookup failure never hides e.g. a host namespace or root UID denial.
+func (a Admitter) onlyLookupFailures(ctx context.Context, policy validation.Policy, pod *corev1.Pod, denied []validation.Finding) bool {
+	if len(denied) == 0 || !lookupFailures(denied) {
+		return false
+	}
+	if policy.Aggregation == validation.AggregateAll {
+		return true
+	}
+	policy.Aggregation = validation.AggregateAll
+	val, err := validation.NewValidator(a.Logger, policy, a.Resolver).ValidatePod(ctx, pod, a.podRequest(pod))
+	if err != nil {
+		a.Logger.Warnf("could not validate pod with every validator: %v", err)
+		return false
+	}
+	return lookupFailures(val.Denied)
+}
+
+// lookupFailures returns true if every denial is a failure to resolve identities
+func lookupFailures(denied []validation.Finding) bool {
+	for _, f := range denied {
+		if f.Code != validation.CodeLookupFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// admitFailedOpen admits a pod that would be rejected while the identity backend
+// is unavailable, loudly: the pod is logged at error level, an Event is emitted
+// and the requester gets a warning
+func (a Admitter) admitFailedOpen(ctx context.Context, pod *corev1.Pod, detail string) *admissionv1.AdmissionReview {
+	detail = strings.TrimSpace(detail)
+	a.Logger.WithFields(logrus.Fields{
+		"namespace": a.Request.Namespace,
+		"user":      a.Request.UserInfo.Username,
+	}).Errorf("identity backend unavailable, admitting pod that would be rejected: %s", detail)
+	if a.Events != nil && !a.DryRun() {
+		a.Events.FailedOpen(ctx, pod, a.Request.Namespace, detail)
+	}
+
+	message := "pod admitted without enforcement while the identity backend is unavailable, it would be rejected: " + detail
+	review := reviewResponse(a.Request.UID, true, http.StatusAccepted, message)
+	review.Response.Warnings = []string{strings.ReplaceAll(message, "\n", " ")}
+	return review
+}
+
+// redactedValue replaces the values of redacted fields in logs
+const redactedValue = "[REDACTED]"
+
+// logRequest dumps the admission request at debug level, with the extra fields
+// of the requester redacted as they may hold credentials or personal data
+func (a Admitter) logRequest() {
+	if !a.Logger.Logger.IsLevelEnabled(logrus.DebugLevel) {
+		return
+	}
+	request, err := json.Marshal(redactRequest(a.Request))
+	if err != nil {
+		a.Logger.Debugf("could not serialize admission request: %v", err)
+		return
+	}
+	a.Logger.WithField("request", string(request)).Debug("admission request")
+}
+
+// redactRequest returns a copy of the admission request with the values of the
+// UserInfo extra fields redacted, their keys are kept
+func redactRequest(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionRequest {
+	if len(req.UserInfo.Extra) == 0 {
+		return req
+	}
+	redacted := *req
+	redacted.UserInfo.Extra = make(map[string]authenticationv1.ExtraValue, len(req.UserInfo.Extra))
+	for key := range req.UserInfo.Extra {
+		redacted.UserInfo.Extra[key] = authenticationv1.ExtraValue{redactedValue}
+	}
+	return &redacted
+}
+
+// DryRun returns true for dry-run requests, whose side effects (events,
+// notifications, metrics of real admissions) must be skipped as the webhook
+// is registered with sideEffects: NoneOnDryRun
+func (a Admitter) DryRun() bool {
+	return a.Request.DryRun != nil && *a.Request.DryRun
+}
+
+// patchPaths returns the "op path" of every operation of a json patch
+func patchPaths(patch []byte) []string {
+	var operations []struct {
+		Op   string `json:"op"`
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil
+	}
+	paths := make([]string, 0, len(operations))
+	for _, o := range operations {
+		paths = append(paths, o.Op+" "+o.Path)
+	}
+	return paths
+}
+
+// mountsNFS returns true if the pod mounts NFS storage or NFS detection is disabled
+func (a Admitter) mountsNFS(ctx context.Context, pod *corev1.Pod) bool {
+	if a.NFS == nil {
+		return true
+	}
+	mounts, volume := a.NFS.MountsNFS(ctx, pod, a.Request.Namespace)
+	if mounts {
+		a.Logger.Debugf("pod mounts NFS volume %s", volume)
+	}
+	return mounts
+}
+
+// exempt returns true with a reason if the pod is exempted from validation and mutation
+func (a Admitter) exempt(ctx context.Context, pod *corev1.Pod) (bool, string, error) {
+	if a.Exemptions == nil {
+		return false, "", nil
+	}
+	return a.Exemptions.Exempt(ctx, pod, a.Request)
 }
 
 // Pod extracts a pod from an admission request
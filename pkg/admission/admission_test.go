@@ -1,16 +1,36 @@
 package admission
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"testing"
+	"time"
 
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/auditlog"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/messages"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/metrics"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/nfs"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/tracing"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/validation"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 func TestPod(t *testing.T) {
@@ -96,3 +116,694 @@ func TestPatchReviewResponse(t *testing.T) {
 	}
 	assert.Equal(t, want, got)
 }
+
+func TestNamespaceScope(t *testing.T) {
+	scope, err := ParseNamespaceScope("", "kube-system, monitoring,ci-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, scope.Contains("kube-system"))
+	assert.False(t, scope.Contains("ci-1234"))
+	assert.True(t, scope.Contains("team-a"))
+
+	scope, err = ParseNamespaceScope("team-*", "team-ops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, scope.Contains("team-a"))
+	assert.False(t, scope.Contains("team-ops"))
+	assert.False(t, scope.Contains("default"))
+
+	_, err = ParseNamespaceScope("[", "")
+	assert.Error(t, err)
+}
+
+func TestValidatePodReviewOutOfScope(t *testing.T) {
+	raw, err := json.Marshal(&corev1.Pod{
+		Spec: corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{RunAsUser: new(int64)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := Admitter{
+		Logger: logrus.NewEntry(logrus.New()),
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("test"),
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Namespace: "kube-system",
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+		Scope: NamespaceScope{Excluded: []string{"kube-system"}},
+	}
+
+	// the resolver is never called for namespaces out of scope
+	review, err := a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, review.Response.Allowed)
+
+	review, err = a.MutatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, review.Response.Allowed)
+	assert.Nil(t, review.Response.Patch)
+}
+
+func TestPodReviewWithoutNFS(t *testing.T) {
+	raw, err := json.Marshal(&corev1.Pod{
+		Spec: corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{RunAsUser: new(int64)},
+			Volumes: []corev1.Volume{
+				{Name: "cache", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := Admitter{
+		Logger: logrus.NewEntry(logrus.New()),
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("test"),
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Namespace: "team-a",
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+		NFS: nfs.NewDetector(fake.NewSimpleClientset()),
+	}
+
+	// the resolver is never called for pods without NFS volumes
+	review, err := a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, review.Response.Allowed)
+	assert.Equal(t, "pod doesn't mount NFS", review.Response.Result.Message)
+
+	review, err = a.MutatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, review.Response.Allowed)
+	assert.Nil(t, review.Response.Patch)
+}
+
+func TestMutatePodReviewPersistentVolumeClaim(t *testing.T) {
+	detector := nfs.NewDetector(fake.NewSimpleClientset(
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "home", Namespace: "team-a"},
+			Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: "pv-nfs"},
+		},
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-nfs"},
+			Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{
+				NFS: &corev1.NFSVolumeSource{Server: "nfs.example.com", Path: "/exports/home"},
+			}},
+		},
+	))
+	stop := make(chan struct{})
+	defer close(stop)
+	if err := detector.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := json.Marshal(&corev1.Pod{
+		Spec: corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{RunAsUser: new(int64)},
+			Volumes: []corev1.Volume{{Name: "home", VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "home"},
+			}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := Admitter{
+		Logger: logrus.NewEntry(logrus.New()),
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("test"),
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Namespace: "team-a",
+			UserInfo:  authenticationv1.UserInfo{Username: "user1"},
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+		Resolver: uidResolver(1001),
+		NFS:      detector,
+	}
+
+	// fsGroup is injected into pods mounting NFS through a PersistentVolumeClaim
+	review, err := a.MutatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, review.Response.Allowed)
+	assert.JSONEq(t, `[{"op":"add","path":"/spec/securityContext/fsGroup","value":1001}]`, string(review.Response.Patch))
+}
+
+func TestParseModePolicy(t *testing.T) {
+	policy, err := ParseModePolicy("", "team-a=audit, ci-*=enforce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ModeEnforce, policy.For("default"))
+	assert.Equal(t, ModeAudit, policy.For("team-a"))
+	assert.Equal(t, ModeEnforce, policy.For("ci-1"))
+
+	policy, err = ParseModePolicy("audit", "team-a=enforce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ModeAudit, policy.For("default"))
+	assert.Equal(t, ModeEnforce, policy.For("team-a"))
+
+	_, err = ParseModePolicy("block", "")
+	assert.Error(t, err)
+	_, err = ParseModePolicy("", "team-a")
+	assert.Error(t, err)
+}
+
+// notFoundResolver has no identity mapped to any subject
+type notFoundResolver struct{}
+
+func (notFoundResolver) Resolve(context.Context, string) (resolver.IdentitySpec, error) {
+	return resolver.IdentitySpec{}, resolver.ErrNotFound
+}
+
+func TestValidatePodReviewAudit(t *testing.T) {
+	raw, err := json.Marshal(&corev1.Pod{
+		Spec: corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{RunAsUser: new(int64)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := Admitter{
+		Logger: logrus.NewEntry(logrus.New()),
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("test"),
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Namespace: "team-a",
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+		Resolver: notFoundResolver{},
+	}
+
+	review, err := a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, review.Response.Allowed)
+
+	// invalid pods are admitted in audit mode
+	a.Modes = ModePolicy{Namespaces: []NamespaceMode{{Pattern: "team-*", Mode: ModeAudit}}}
+	review, err = a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, review.Response.Allowed)
+	assert.Contains(t, review.Response.Result.Message, "would be rejected")
+
+	assert.Empty(t, review.Response.Warnings)
+
+	// and mutations are never applied
+	review, err = a.MutatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, review.Response.Allowed)
+	assert.Nil(t, review.Response.Patch)
+
+	// warn mode returns would-be denials as warnings
+	a.Modes = ModePolicy{Default: ModeWarn}
+	review, err = a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, review.Response.Allowed)
+	if assert.Len(t, review.Response.Warnings, 1) {
+		assert.Contains(t, review.Response.Warnings[0], "pod would be rejected: ")
+		assert.NotContains(t, review.Response.Warnings[0], "\n")
+	}
+}
+
+// uidResolver maps every subject to the same UID and GID
+type uidResolver int64
+
+func (r uidResolver) Resolve(context.Context, string) (resolver.IdentitySpec, error) {
+	uid := int64(r)
+	return resolver.IdentitySpec{UID: &uid, GIDs: []int64{uid}}, nil
+}
+
+func TestValidatePodReviewDenialStatus(t *testing.T) {
+	uid := int64(2000)
+	raw, err := json.Marshal(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app"},
+		Spec:       corev1.PodSpec{SecurityContext: &corev1.PodSecurityContext{RunAsUser: &uid}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := Admitter{
+		Logger: logrus.NewEntry(logrus.New()),
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("test"),
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+			Namespace: "team-a",
+			UserInfo:  authenticationv1.UserInfo{Username: "user1"},
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+		Resolver: uidResolver(1001),
+	}
+
+	review, err := a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, review.Response.Allowed)
+	status := review.Response.Result
+	assert.Equal(t, metav1.StatusReason("UIDMismatch"), status.Reason)
+	if assert.NotNil(t, status.Details) {
+		assert.Equal(t, "app", status.Details.Name)
+		assert.Equal(t, "pods", status.Details.Kind)
+		assert.Equal(t, []metav1.StatusCause{
+			{Type: "UIDMismatch", Message: "Invalid uid in pod, expected: 1001, found: 2000"},
+			{Type: "UIDMismatch", Field: "validator", Message: "uid_validator"},
+			{Type: "UIDMismatch", Field: "expectedUID", Message: "1001"},
+			{Type: "UIDMismatch", Field: "foundUID", Message: "2000"},
+			{Type: "UIDMismatch", Field: "source", Message: "pod"},
+			{Type: "UIDMismatch", Field: "subject", Message: "user1"},
+		}, status.Details.Causes)
+	}
+}
+
+func TestValidatePodReviewDenialMessage(t *testing.T) {
+	uid := int64(2000)
+	raw, err := json.Marshal(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app"},
+		Spec:       corev1.PodSpec{SecurityContext: &corev1.PodSecurityContext{RunAsUser: &uid}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates, err := messages.Parse([]byte(`
+docsURL: https://runbooks.example.com/nfs
+codes:
+  UIDMismatch: "{{ .Subject }} may only run {{ .Pod }} as UID {{ .Details.expectedUID }}, see {{ .DocsURL }}"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := Admitter{
+		Logger: logrus.NewEntry(logrus.New()),
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("test"),
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Namespace: "team-a",
+			UserInfo:  authenticationv1.UserInfo{Username: "user1"},
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+		Resolver: uidResolver(1001),
+		Messages: templates,
+	}
+
+	review, err := a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, review.Response.Allowed)
+	assert.Equal(t, "user1 may only run app as UID 1001, see https://runbooks.example.com/nfs\n", review.Response.Result.Message)
+	assert.Equal(t, metav1.StatusReason("UIDMismatch"), review.Response.Result.Reason)
+}
+
+func TestValidatePodReviewRemediation(t *testing.T) {
+	uid := int64(2000)
+	raw, err := json.Marshal(&corev1.Pod{
+		Spec: corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{RunAsUser: &uid},
+			Containers:      []corev1.Container{{Name: "app", SecurityContext: &corev1.SecurityContext{RunAsGroup: &uid}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := Admitter{
+		Logger: logrus.NewEntry(logrus.New()),
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("test"),
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Namespace: "team-a",
+			UserInfo:  authenticationv1.UserInfo{Username: "user1"},
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+		ValidationPolicy: validation.Policy{Aggregation: validation.AggregateAll},
+		Resolver:         uidResolver(1001),
+		RemediationHints: true,
+	}
+
+	review, err := a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, review.Response.Allowed)
+	assert.Equal(t, "Invalid uid in pod, expected: 1001, found: 2000\n"+
+		"Invalid gid in container app, expected one of: [1001], found: 2000\n"+
+		"Suggested fix in the pod spec:\n"+
+		"  securityContext: {runAsUser: 1001}\n"+
+		"  containers: [{name: app, securityContext: {runAsGroup: 1001}}]\n", review.Response.Result.Message)
+
+	a.Modes = ModePolicy{Default: ModeWarn}
+	review, err = a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, review.Response.Allowed)
+	if assert.Len(t, review.Response.Warnings, 2) {
+		assert.Equal(t, "suggested fix in the pod spec: securityContext: {runAsUser: 1001}; containers: [{name: app, securityContext: {runAsGroup: 1001}}]", review.Response.Warnings[1])
+	}
+}
+
+// failingResolver fails every lookup, like an unreachable backend
+type failingResolver struct{}
+
+func (failingResolver) Resolve(context.Context, string) (resolver.IdentitySpec, error) {
+	return resolver.IdentitySpec{}, errors.New("connection refused")
+}
+
+func TestValidatePodReviewFailOpen(t *testing.T) {
+	raw, err := json.Marshal(&corev1.Pod{
+		Spec: corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{RunAsUser: new(int64)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	breaker := resolver.NewCircuitBreaker(failingResolver{}, 50*time.Millisecond)
+	breaker.Logger, _ = test.NewNullLogger()
+	a := Admitter{
+		Logger: logrus.NewEntry(logrus.New()),
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("test"),
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Namespace: "team-a",
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+		Resolver: breaker,
+		FailOpen: breaker,
+	}
+
+	// the first failure is denied, the backend is not failing for longer than the window yet
+	review, err := a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, review.Response.Allowed)
+
+	time.Sleep(60 * time.Millisecond)
+	review, err = a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, review.Response.Allowed)
+	assert.Contains(t, review.Response.Result.Message, "identity backend is unavailable")
+	if assert.Len(t, review.Response.Warnings, 1) {
+		assert.NotContains(t, review.Response.Warnings[0], "\n")
+	}
+
+	// pods are still denied without a circuit breaker
+	a.FailOpen = nil
+	review, err = a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, review.Response.Allowed)
+}
+
+func TestValidatePodReviewFailOpenHostNamespace(t *testing.T) {
+	raw, err := json.Marshal(&corev1.Pod{
+		Spec: corev1.PodSpec{
+			HostNetwork:     true,
+			SecurityContext: &corev1.PodSecurityContext{RunAsUser: new(int64)},
+			Volumes: []corev1.Volume{{Name: "home", VolumeSource: corev1.VolumeSource{
+				NFS: &corev1.NFSVolumeSource{Server: "nfs.example.com", Path: "/exports/home"},
+			}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	breaker := resolver.NewCircuitBreaker(failingResolver{}, 0)
+	breaker.Logger, _ = test.NewNullLogger()
+	a := Admitter{
+		Logger: logrus.NewEntry(logrus.New()),
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("test"),
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Namespace: "team-a",
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+		ValidationPolicy: validation.Policy{DenyHostNamespaces: true},
+		Resolver:         breaker,
+		FailOpen:         breaker,
+	}
+
+	// the host namespace denial, after the lookup failure in the chain, still
+	// applies while failing open
+	for _, aggregation := range []validation.Aggregation{validation.AggregateFirstDeny, validation.AggregateAll} {
+		a.ValidationPolicy.Aggregation = aggregation
+		review, err := a.ValidatePodReview(context.TODO())
+		assert.NoError(t, err)
+		assert.True(t, breaker.Open())
+		assert.False(t, review.Response.Allowed, aggregation)
+		if aggregation == validation.AggregateAll {
+			assert.Contains(t, review.Response.Result.Message, "hostNetwork is not allowed")
+		}
+	}
+}
+
+func TestDryRunAudit(t *testing.T) {
+	raw, err := json.Marshal(&corev1.Pod{
+		Spec: corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{RunAsUser: new(int64)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger, hook := test.NewNullLogger()
+	dryRun := true
+	a := Admitter{
+		Logger: logrus.NewEntry(logger),
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("test"),
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Namespace: "team-a",
+			Object:    runtime.RawExtension{Raw: raw},
+			DryRun:    &dryRun,
+		},
+		Resolver: notFoundResolver{},
+		Modes:    ModePolicy{Default: ModeAudit},
+	}
+	assert.True(t, a.DryRun())
+
+	review, err := a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, review.Response.Allowed)
+
+	// audit entries of dry-run requests are tagged as such
+	entry := hook.LastEntry()
+	if assert.NotNil(t, entry) {
+		assert.Equal(t, outcomeDeny, entry.Data["audit"])
+		assert.Equal(t, true, entry.Data["dry_run"])
+	}
+}
+
+func TestLogRequestRedaction(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	req := &admissionv1.AdmissionRequest{
+		UID: types.UID("test"),
+		UserInfo: authenticationv1.UserInfo{
+			Username: "user1",
+			Extra:    map[string]authenticationv1.ExtraValue{"oidc-token": {"secret"}},
+		},
+	}
+	a := Admitter{Logger: logrus.NewEntry(logger), Request: req}
+
+	// requests are only dumped at debug level
+	a.logRequest()
+	assert.Empty(t, hook.AllEntries())
+
+	logger.SetLevel(logrus.DebugLevel)
+	a.logRequest()
+	entry := hook.LastEntry()
+	if assert.NotNil(t, entry) {
+		dump := entry.Data["request"].(string)
+		assert.Contains(t, dump, "user1")
+		assert.Contains(t, dump, "oidc-token")
+		assert.Contains(t, dump, redactedValue)
+		assert.NotContains(t, dump, "secret")
+	}
+	// the request itself is left untouched
+	assert.Equal(t, authenticationv1.ExtraValue{"secret"}, req.UserInfo.Extra["oidc-token"])
+}
+
+func TestValidatePodReviewTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	raw, err := json.Marshal(&corev1.Pod{
+		Spec: corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{RunAsUser: new(int64)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := Admitter{
+		Logger: logrus.NewEntry(logrus.New()),
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("test"),
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Namespace: "team-a",
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+		Resolver: notFoundResolver{},
+	}
+
+	ctx, span := tracing.Tracer().Start(context.TODO(), "admission validate")
+	_, err = a.ValidatePodReview(ctx)
+	span.End()
+	assert.NoError(t, err)
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 2) {
+		// the denying validator is a child span of the request span
+		assert.Equal(t, "validate uid_validator", spans[0].Name())
+		assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+		assert.Contains(t, spans[1].Attributes(), attribute.String("nfs.validator", "uid_validator"))
+		assert.Contains(t, spans[1].Attributes(), attribute.Bool("nfs.allowed", false))
+	}
+}
+
+func TestValidatePodReviewShadow(t *testing.T) {
+	uid := int64(1001)
+	raw, err := json.Marshal(&corev1.Pod{
+		Spec: corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{RunAsUser: &uid},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger, hook := test.NewNullLogger()
+	a := Admitter{
+		Logger: logrus.NewEntry(logger),
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("test"),
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Namespace: "team-a",
+			UserInfo:  authenticationv1.UserInfo{Username: "user1"},
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+		Resolver: userResolver{},
+		Shadow:   &Shadow{Resolver: notFoundResolver{}},
+	}
+
+	// the candidate denial is logged, the pod is still allowed
+	review, err := a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, review.Response.Allowed)
+	if assert.NotNil(t, hook.LastEntry()) {
+		assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+		assert.Equal(t, metrics.ShadowNewlyDenied, hook.LastEntry().Data["shadow"])
+	}
+
+	hook.Reset()
+	a.Resolver, a.Shadow.Resolver = notFoundResolver{}, userResolver{}
+	review, err = a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, review.Response.Allowed)
+	if assert.NotNil(t, hook.LastEntry()) {
+		assert.Equal(t, metrics.ShadowNewlyAllowed, hook.LastEntry().Data["shadow"])
+	}
+
+	// pods aren't evaluated while the candidate mappings aren't ready, nor on dry-run
+	hook.Reset()
+	a.Shadow.Ready = func() error { return errors.New("not synced") }
+	_, err = a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	a.Shadow.Ready = nil
+	dryRun := true
+	a.Request.DryRun = &dryRun
+	_, err = a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	for _, entry := range hook.AllEntries() {
+		assert.NotContains(t, entry.Data, "shadow")
+	}
+}
+
+func TestNotification(t *testing.T) {
+	controller := true
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		GenerateName:    "web-5d9c7-",
+		OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-5d9c7", Controller: &controller}},
+	}}
+	a := Admitter{Request: &admissionv1.AdmissionRequest{
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Namespace: "team-a",
+		UserInfo:  authenticationv1.UserInfo{Username: "system:serviceaccount:kube-system:replicaset-controller"},
+	}}
+
+	d := a.notification(pod, "Invalid uid in pod\nSuggested fix in the pod spec: ...", []validation.Finding{
+		{Validator: "uid_validator", Reason: "Invalid uid in pod\n", Details: map[string]string{"subject": "system:serviceaccount:team-a:web"}},
+		{Validator: "gid_validator", Reason: "Invalid gid in pod"},
+	})
+	assert.Equal(t, "team-a", d.Namespace)
+	assert.Equal(t, "system:serviceaccount:team-a:web", d.Subject)
+	assert.Equal(t, "ReplicaSet/web-5d9c7", d.Workload)
+	assert.Equal(t, "uid_validator", d.Validator)
+	assert.Equal(t, "Invalid uid in pod; Invalid gid in pod", d.Reason)
+
+	pod.OwnerReferences = nil
+	d = a.notification(pod, "Invalid uid in pod", nil)
+	assert.Equal(t, "Pod/web-5d9c7-", d.Workload)
+	assert.Equal(t, "Invalid uid in pod", d.Reason)
+}
+
+func TestValidatePodReviewAuditLog(t *testing.T) {
+	raw, err := json.Marshal(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "web-"},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: "web",
+			SecurityContext:    &corev1.PodSecurityContext{RunAsUser: new(int64)},
+			Containers:         []corev1.Container{{Name: "web"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	audit, err := auditlog.New(&out, auditlog.FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := Admitter{
+		Logger: logrus.NewEntry(logrus.New()),
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("test"),
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Namespace: "team-a",
+			Operation: admissionv1.Create,
+			UserInfo:  authenticationv1.UserInfo{Username: "system:serviceaccount:kube-system:replicaset-controller"},
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+		Resolver: notFoundResolver{},
+		AuditLog: audit,
+	}
+
+	review, err := a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, review.Response.Allowed)
+	assert.NoError(t, audit.Close(context.TODO()))
+
+	var r auditlog.Record
+	if assert.NoError(t, json.Unmarshal(out.Bytes(), &r)) {
+		assert.Equal(t, "test", r.RequestUID)
+		assert.Equal(t, "validate", r.Webhook)
+		assert.Equal(t, metrics.DecisionDenied, r.Decision)
+		assert.False(t, r.Allowed)
+		assert.Equal(t, "CREATE", r.Operation)
+		assert.Equal(t, "web-", r.Name)
+		assert.Equal(t, "system:serviceaccount:kube-system:replicaset-controller", r.User)
+		assert.Equal(t, "web", r.Subject)
+		assert.Equal(t, []int64{0}, r.IDs.RunAsUser)
+		assert.NotEmpty(t, r.Reason)
+		assert.NotEmpty(t, r.Validator)
+	}
+}
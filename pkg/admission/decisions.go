@@ -0,0 +1,140 @@
+package admission
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/sharedcache"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+)
+
+const (
+	// DefaultDecisionCacheSize is the default number of allowed pods remembered
+	DefaultDecisionCacheSize = 10000
+	// DefaultDecisionCacheTTL is the default time allowed pods are remembered for
+	DefaultDecisionCacheTTL = 10 * time.Second
+)
+
+// DecisionCache remembers the pods allowed by the validators, so that the identical
+// pods created by the same requester, e.g. during the scale-up of a ReplicaSet or
+// the fan-out of a Job, are only validated once. Pods are keyed by their requester,
+// namespace, kind, a hash of their spec and metadata and the version of the
+// mappings, and remembered for a TTL bounding the staleness of the other inputs of
+// the validators, e.g. namespace annotations or NFSAccessPolicies. Denials are
+// never cached.
+type DecisionCache struct {
+	cache *utilcache.LRUExpireCache
+	ttl   time.Duration
+	// Version returns the version of the mappings, nil leaves it out of the keys
+	Version func() string
+	// Shared shares the allowed pods with the other webhook replicas, nil keeps
+	// them local. Its keys are expected to be scoped to the version of the mappings.
+	Shared sharedcache.Cache
+}
+
+// NewDecisionCache returns a DecisionCache remembering at most size allowed pods
+// for ttl
+func NewDecisionCache(size int, ttl time.Duration) *DecisionCache {
+	return &DecisionCache{cache: utilcache.NewLRUExpireCache(size), ttl: ttl}
+}
+
+// Allowed returns true if the pod of request was allowed within the TTL, by this
+// replica or by another one through the shared cache
+func (c *DecisionCache) Allowed(ctx context.Context, request *admissionv1.AdmissionRequest, pod *corev1.Pod) bool {
+	if c == nil {
+		return false
+	}
+	hash := podHash(request, pod)
+	if _, ok := c.cache.Get(c.key(hash)); ok {
+		return true
+	}
+	if c.Shared == nil {
+		return false
+	}
+	_, found, err := c.Shared.Get(ctx, "decision:"+hash)
+	if err != nil {
+		logrus.Debugf("Error getting decision from the shared cache: %s", err)
+		return false
+	}
+	if found {
+		c.cache.Add(c.key(hash), struct{}{}, c.ttl)
+	}
+	return found
+}
+
+// Allow remembers that the pod of request is allowed
+func (c *DecisionCache) Allow(ctx context.Context, request *admissionv1.AdmissionRequest, pod *corev1.Pod) {
+	if c == nil {
+		return
+	}
+	hash := podHash(request, pod)
+	c.cache.Add(c.key(hash), struct{}{}, c.ttl)
+	if c.Shared != nil {
+		if err := c.Shared.Set(ctx, "decision:"+hash, []byte("allowed"), c.ttl); err != nil {
+			logrus.Debugf("Error storing decision in the shared cache: %s", err)
+		}
+	}
+}
+
+// Purge forgets every allowed pod, e.g. when the resolver backend changes
+func (c *DecisionCache) Purge() {
+	if c == nil {
+		return
+	}
+	c.cache.RemoveAll(func(any) bool { return true })
+}
+
+// Len returns the number of allowed pods remembered and not expired
+func (c *DecisionCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.cache.Keys())
+}
+
+// decisionInput is the part of an admission request the validators depend on,
+// the name and generated name of pods excluded
+type decisionInput struct {
+	Username        string                  `json:"username"`
+	Groups          []string                `json:"groups"`
+	Namespace       string                  `json:"namespace"`
+	Kind            string                  `json:"kind"`
+	Labels          map[string]string       `json:"labels"`
+	Annotations     map[string]string       `json:"annotations"`
+	OwnerReferences []metav1.OwnerReference `json:"ownerReferences"`
+	Spec            corev1.PodSpec          `json:"spec"`
+}
+
+// key returns the local cache key of the pod hash, scoped to the version of the mappings
+func (c *DecisionCache) key(hash string) string {
+	if c.Version == nil {
+		return hash
+	}
+	return hash + "/" + c.Version()
+}
+
+// podHash returns a hash of the pod of request and of its requester
+func podHash(request *admissionv1.AdmissionRequest, pod *corev1.Pod) string {
+	groups := append([]string(nil), request.UserInfo.Groups...)
+	sort.Strings(groups)
+	input, _ := json.Marshal(decisionInput{
+		Username:        request.UserInfo.Username,
+		Groups:          groups,
+		Namespace:       request.Namespace,
+		Kind:            request.Kind.Kind,
+		Labels:          pod.Labels,
+		Annotations:     pod.Annotations,
+		OwnerReferences: pod.OwnerReferences,
+		Spec:            pod.Spec,
+	})
+	sum := sha256.Sum256(input)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,121 @@
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// countingUIDResolver maps every subject to the same UID and counts the lookups
+type countingUIDResolver struct {
+	uid   int64
+	calls int
+}
+
+func (r *countingUIDResolver) Resolve(context.Context, string) (resolver.IdentitySpec, error) {
+	r.calls++
+	return resolver.IdentitySpec{UID: &r.uid, GIDs: []int64{r.uid}}, nil
+}
+
+func TestValidatePodReviewDecisionCache(t *testing.T) {
+	r := &countingUIDResolver{uid: 1001}
+	version := "1"
+	decisions := NewDecisionCache(10, time.Minute)
+	decisions.Version = func() string { return version }
+
+	validate := func(name string, uid int64) bool {
+		raw, err := json.Marshal(&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"app": "batch"}},
+			Spec:       corev1.PodSpec{SecurityContext: &corev1.PodSecurityContext{RunAsUser: &uid}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		a := Admitter{
+			Logger: logrus.NewEntry(logrus.New()),
+			Request: &admissionv1.AdmissionRequest{
+				UID:       types.UID(name),
+				Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+				Namespace: "team-a",
+				UserInfo:  authenticationv1.UserInfo{Username: "user1"},
+				Object:    runtime.RawExtension{Raw: raw},
+			},
+			Resolver:  r,
+			Decisions: decisions,
+		}
+		review, err := a.ValidatePodReview(context.TODO())
+		assert.NoError(t, err)
+		return review.Response.Allowed
+	}
+
+	assert.True(t, validate("batch-1", 1001))
+	calls := r.calls
+	// identical pods of the same requester are allowed without validation
+	assert.True(t, validate("batch-2", 1001))
+	assert.Equal(t, calls, r.calls)
+
+	// denials are not cached
+	assert.False(t, validate("batch-3", 2000))
+	calls = r.calls
+	assert.False(t, validate("batch-4", 2000))
+	assert.Greater(t, r.calls, calls)
+
+	// a new version of the mappings invalidates the allowed pods
+	version = "2"
+	calls = r.calls
+	assert.True(t, validate("batch-5", 1001))
+	assert.Greater(t, r.calls, calls)
+
+	assert.Greater(t, decisions.Len(), 0)
+	decisions.Purge()
+	assert.Zero(t, decisions.Len())
+	calls = r.calls
+	assert.True(t, validate("batch-6", 1001))
+	assert.Greater(t, r.calls, calls)
+}
+
+// mapCache is a shared cache in memory, ignoring TTLs
+type mapCache map[string][]byte
+
+func (m mapCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	value, ok := m[key]
+	return value, ok, nil
+}
+
+func (m mapCache) Set(_ context.Context, key string, value []byte, _ time.Duration) error {
+	m[key] = value
+	return nil
+}
+
+func TestDecisionCacheShared(t *testing.T) {
+	shared := mapCache{}
+	first, second := NewDecisionCache(10, time.Minute), NewDecisionCache(10, time.Minute)
+	first.Shared, second.Shared = shared, shared
+
+	request := &admissionv1.AdmissionRequest{
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Namespace: "team-a",
+		UserInfo:  authenticationv1.UserInfo{Username: "user1"},
+	}
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}}
+
+	assert.False(t, second.Allowed(context.TODO(), request, pod))
+	first.Allow(context.TODO(), request, pod)
+	// pods allowed by a replica are allowed by the others
+	assert.True(t, second.Allowed(context.TODO(), request, pod))
+
+	other := request.DeepCopy()
+	other.UserInfo.Username = "user2"
+	assert.False(t, second.Allowed(context.TODO(), other, pod))
+}
@@ -0,0 +1,95 @@
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/metrics"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// MappingAdmitter validates the mapping objects written to the API server, so
+// that a typo is rejected at write time rather than breaking the admission of
+// the pods of its subject
+type MappingAdmitter struct {
+	Logger  *logrus.Entry
+	Request *admissionv1.AdmissionRequest
+
+	// Source describes the mapping objects, others are admitted unchecked
+	Source mapping.Source
+	// NamespaceMappings validates the mapping objects of every namespace rather
+	// than only the ones of the source namespace
+	NamespaceMappings bool
+}
+
+// ValidateMappingReview validates the mapping object of an admission request and
+// returns an admission review denying it if any of its entries is malformed
+func (a MappingAdmitter) ValidateMappingReview() (review *admissionv1.AdmissionReview, err error) {
+	decision := metrics.DecisionError
+	defer func() {
+		allowed := review != nil && review.Response != nil && review.Response.Allowed
+		metrics.ObserveAdmission("validate-mappings", allowed, a.Request.DryRun != nil && *a.Request.DryRun, decision, "mapping_validator")
+	}()
+
+	if a.Request.Kind.Kind != a.Source.Kind ||
+		(!a.NamespaceMappings && a.Request.Namespace != a.Source.Namespace) {
+		decision = metrics.DecisionOutOfScope
+		return reviewResponse(a.Request.UID, true, http.StatusAccepted, "not a mapping object"), nil
+	}
+	name, data, err := a.object()
+	if err != nil {
+		e := fmt.Sprintf("could not parse %s: %v", a.Request.Kind.Kind, err)
+		return reviewResponse(a.Request.UID, false, http.StatusBadRequest, e), err
+	}
+
+	warnings, err := a.Source.Validate(name, data)
+	if err != nil {
+		decision = metrics.DecisionDenied
+		e := fmt.Sprintf("invalid mapping %s %s/%s: %v", a.Source.Kind, a.Request.Namespace, name, err)
+		a.Logger.Info(e)
+		review = reviewResponse(a.Request.UID, false, http.StatusUnprocessableEntity, e)
+		review.Response.Warnings = warnings
+		return review, nil
+	}
+
+	decision = metrics.DecisionAllowed
+	review = reviewResponse(a.Request.UID, true, http.StatusAccepted, "valid mapping")
+	review.Response.Warnings = warnings
+	return review, nil
+}
+
+// object returns the name and the data of the ConfigMap or Secret of the request
+func (a MappingAdmitter) object() (string, map[string]string, error) {
+	if a.Request.Kind.Kind == mapping.SecretKind {
+		var s corev1.Secret
+		if err := json.Unmarshal(a.Request.Object.Raw, &s); err != nil {
+			return "", nil, err
+		}
+		data := make(map[string]string, len(s.Data)+len(s.StringData))
+		for k, v := range s.Data {
+			data[k] = string(v)
+		}
+		for k, v := range s.StringData {
+			data[k] = v
+		}
+		return s.Name, data, nil
+	}
+
+	var cm corev1.ConfigMap
+	if err := json.Unmarshal(a.Request.Object.Raw, &cm); err != nil {
+		return "", nil, err
+	}
+	// data wins over binaryData like in the mapping cache
+	data := make(map[string]string, len(cm.Data)+len(cm.BinaryData))
+	for k, v := range cm.BinaryData {
+		data[k] = string(v)
+	}
+	for k, v := range cm.Data {
+		data[k] = v
+	}
+	return cm.Name, data, nil
+}
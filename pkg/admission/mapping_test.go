@@ -0,0 +1,119 @@
+package admission
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestValidateMappingReview(t *testing.T) {
+	source := mapping.Source{Kind: mapping.ConfigMapKind, Namespace: "nfs", UIDName: mapping.UIDConfigMapName, GIDName: mapping.GIDConfigMapName}
+	request := func(kind string, obj interface{}) *admissionv1.AdmissionRequest {
+		raw, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		meta := obj.(metav1.Object)
+		return &admissionv1.AdmissionRequest{
+			UID:       "test",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: kind},
+			Namespace: meta.GetNamespace(),
+			Operation: admissionv1.Update,
+			Object:    runtime.RawExtension{Raw: raw},
+		}
+	}
+	configMap := func(namespace, name string, data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}, Data: data}
+	}
+
+	tests := []struct {
+		name              string
+		request           *admissionv1.AdmissionRequest
+		namespaceMappings bool
+		allowed           bool
+		warnings          int
+	}{
+		{
+			name:    "valid",
+			request: request("ConfigMap", configMap("nfs", mapping.UIDConfigMapName, map[string]string{"user1": "1001"})),
+			allowed: true,
+		},
+		{
+			name:    "typo",
+			request: request("ConfigMap", configMap("nfs", mapping.UIDConfigMapName, map[string]string{"user1": "1OO1"})),
+			allowed: false,
+		},
+		{
+			name:     "shared uid",
+			request:  request("ConfigMap", configMap("nfs", mapping.UIDConfigMapName, map[string]string{"user1": "1001", "user2": "1001"})),
+			allowed:  true,
+			warnings: 1,
+		},
+		{
+			name:    "other ConfigMap",
+			request: request("ConfigMap", configMap("nfs", "other", map[string]string{"user1": "1OO1"})),
+			allowed: true,
+		},
+		{
+			name:    "other namespace",
+			request: request("ConfigMap", configMap("team-a", mapping.UIDConfigMapName, map[string]string{"user1": "1OO1"})),
+			allowed: true,
+		},
+		{
+			name:              "namespace mapping",
+			request:           request("ConfigMap", configMap("team-a", mapping.UIDConfigMapName, map[string]string{"user1": "1OO1"})),
+			namespaceMappings: true,
+			allowed:           false,
+		},
+		{
+			name: "binaryData",
+			request: request("ConfigMap", &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: mapping.GIDConfigMapName, Namespace: "nfs"},
+				BinaryData: map[string][]byte{"user1": []byte("1001,1001")},
+			}),
+			allowed: false,
+		},
+		{
+			name: "Secret",
+			request: request("Secret", &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: mapping.UIDConfigMapName, Namespace: "nfs"},
+				Data:       map[string][]byte{"user1": []byte("abc")},
+			}),
+			// the mappings are read from ConfigMaps
+			allowed: true,
+		},
+	}
+	for _, tt := range tests {
+		a := MappingAdmitter{
+			Logger:            logrus.WithField("test", tt.name),
+			Request:           tt.request,
+			Source:            source,
+			NamespaceMappings: tt.namespaceMappings,
+		}
+		review, err := a.ValidateMappingReview()
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.allowed, review.Response.Allowed, tt.name)
+		assert.Len(t, review.Response.Warnings, tt.warnings, tt.name)
+	}
+
+	secrets := source
+	secrets.Kind = mapping.SecretKind
+	a := MappingAdmitter{
+		Logger: logrus.NewEntry(logrus.New()),
+		Request: request("Secret", &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: mapping.UIDConfigMapName, Namespace: "nfs"},
+			StringData: map[string]string{"user1": "abc"},
+		}),
+		Source: secrets,
+	}
+	review, err := a.ValidateMappingReview()
+	assert.NoError(t, err)
+	assert.False(t, review.Response.Allowed)
+}
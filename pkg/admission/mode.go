@@ -0,0 +1,90 @@
+package admission
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Mode tells how the webhook acts on pods that fail validation
+type Mode string
+
+const (
+	// ModeEnforce denies invalid pods and applies mutations
+	ModeEnforce Mode = "enforce"
+	// ModeAudit admits every pod unmodified, recording would-be denials and mutations
+	ModeAudit Mode = "audit"
+	// ModeWarn is ModeAudit also returning would-be denials and mutations as
+	// admission warnings to the requester
+	ModeWarn Mode = "warn"
+)
+
+// ModePolicy holds the global Mode and the ones overriding it per namespace
+type ModePolicy struct {
+	// Default applies to namespaces without their own mode, enforce when empty
+	Default Mode
+	// Namespaces holds the modes of namespaces, the first matching pattern wins
+	Namespaces []NamespaceMode
+}
+
+// NamespaceMode is the mode of the namespaces matching Pattern, a namespace
+// name or path.Match pattern
+type NamespaceMode struct {
+	Pattern string
+	Mode    Mode
+}
+
+// ParseModePolicy returns the ModePolicy described by the global mode and a comma
+// separated list of namespace=mode pairs, e.g. "team-a=audit,ci-*=enforce"
+func ParseModePolicy(defaultMode, namespaceModes string) (ModePolicy, error) {
+	var policy ModePolicy
+	var err error
+	if policy.Default, err = parseMode(defaultMode); err != nil {
+		return policy, err
+	}
+
+	for _, pair := range strings.Split(namespaceModes, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		pattern, mode, ok := strings.Cut(pair, "=")
+		if !ok {
+			return policy, fmt.Errorf("invalid namespace mode %q, expected namespace=mode", pair)
+		}
+		nsMode := NamespaceMode{Pattern: strings.TrimSpace(pattern)}
+		if _, err := path.Match(nsMode.Pattern, ""); err != nil {
+			return policy, fmt.Errorf("invalid namespace pattern %q: %v", nsMode.Pattern, err)
+		}
+		if nsMode.Mode, err = parseMode(mode); err != nil {
+			return policy, err
+		}
+		policy.Namespaces = append(policy.Namespaces, nsMode)
+	}
+	return policy, nil
+}
+
+// For returns the mode applying to pods of namespace
+func (p ModePolicy) For(namespace string) Mode {
+	for _, nsMode := range p.Namespaces {
+		if ok, _ := path.Match(nsMode.Pattern, namespace); ok {
+			return nsMode.Mode
+		}
+	}
+	if p.Default == "" {
+		return ModeEnforce
+	}
+	return p.Default
+}
+
+// parseMode parses a mode name, an empty name is enforce
+func parseMode(value string) (Mode, error) {
+	switch mode := Mode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return ModeEnforce, nil
+	case ModeEnforce, ModeAudit, ModeWarn:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown mode %q, expected %s, %s or %s", value, ModeEnforce, ModeAudit, ModeWarn)
+	}
+}
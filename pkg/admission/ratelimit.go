@@ -0,0 +1,114 @@
+package admission
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tensorchord/nfs-pod-access-control/pkg/metrics"
+	"golang.org/x/time/rate"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Defaults of the rate of the admission requests of every namespace
+const (
+	DefaultRateLimitQPS   = 10
+	DefaultRateLimitBurst = 50
+)
+
+// rateLimitSweepInterval is the interval the idle buckets are removed at
+const rateLimitSweepInterval = time.Minute
+
+// RateLimiter bounds the rate of the admission requests of every namespace with a
+// token bucket per namespace and webhook, so that a namespace creating thousands
+// of pods doesn't delay the admission of the pods of the others
+type RateLimiter struct {
+	limit rate.Limit
+	burst int
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// bucket is the token bucket of a namespace and the last time it was used
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing qps requests per second to every
+// namespace, with bursts of up to burst requests
+func NewRateLimiter(qps float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		limit:   rate.Limit(qps),
+		burst:   burst,
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Allow takes a token from the bucket of namespace for webhook, it returns false
+// and the delay before the next token when the bucket is empty
+func (l *RateLimiter) Allow(webhook, namespace string) (bool, time.Duration) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	key := webhook + "/" + namespace
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	if b.limiter.AllowN(now, 1) {
+		return true, 0
+	}
+	r := b.limiter.ReserveN(now, 1)
+	delay := r.DelayFrom(now)
+	r.CancelAt(now)
+	return false, delay
+}
+
+// sweep removes the buckets refilled since they were last used, which are
+// identical to new ones
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	refill := time.Duration(float64(l.burst) / float64(l.limit) * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) >= refill {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// rateLimited returns whether the request exceeds the rate of its namespace for
+// webhook, with its review and decision: a 429 telling the requester when to
+// retry in enforce mode, an admission recording it in audit and warn modes, which
+// never block pods. Dry-run requests spend the tokens of the namespace too.
+func (a Admitter) rateLimited(webhook string) (*admissionv1.AdmissionReview, string, bool) {
+	if a.RateLimits == nil {
+		return nil, "", false
+	}
+	allowed, delay := a.RateLimits.Allow(webhook, a.Request.Namespace)
+	if allowed {
+		return nil, "", false
+	}
+	message := "too many pods admitted in namespace " + a.Request.Namespace + ", retry later"
+	if mode := a.Modes.For(a.Request.Namespace); mode != ModeEnforce {
+		return a.admitUnenforced(mode, outcomeDeny, message), modeDecision(mode), true
+	}
+	a.Logger.Warnf("too many admission requests in namespace %s, retry in %s", a.Request.Namespace, delay)
+	review := reviewResponse(a.Request.UID, false, http.StatusTooManyRequests, message)
+	review.Response.Result.Reason = metav1.StatusReasonTooManyRequests
+	review.Response.Result.Details = &metav1.StatusDetails{RetryAfterSeconds: int32(math.Ceil(delay.Seconds()))}
+	return review, metrics.DecisionRateLimited, true
+}
@@ -0,0 +1,95 @@
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	l := NewRateLimiter(1, 2)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		allowed, _ := l.Allow("validate", "team-a")
+		assert.True(t, allowed)
+	}
+	allowed, delay := l.Allow("validate", "team-a")
+	assert.False(t, allowed)
+	assert.Equal(t, time.Second, delay)
+
+	// namespaces and webhooks have their own bucket
+	allowed, _ = l.Allow("validate", "team-b")
+	assert.True(t, allowed)
+	allowed, _ = l.Allow("mutate", "team-a")
+	assert.True(t, allowed)
+
+	now = now.Add(time.Second)
+	allowed, _ = l.Allow("validate", "team-a")
+	assert.True(t, allowed)
+
+	// buckets refilled since they were last used are removed
+	now = now.Add(rateLimitSweepInterval)
+	l.Allow("validate", "team-c")
+	assert.Len(t, l.buckets, 1)
+}
+
+func TestValidatePodReviewRateLimited(t *testing.T) {
+	uid := int64(1001)
+	raw, err := json.Marshal(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "batch"},
+		Spec:       corev1.PodSpec{SecurityContext: &corev1.PodSecurityContext{RunAsUser: &uid}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := Admitter{
+		Logger: logrus.NewEntry(logrus.New()),
+		Request: &admissionv1.AdmissionRequest{
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Namespace: "team-a",
+			UserInfo:  authenticationv1.UserInfo{Username: "user1"},
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+		Resolver:   &countingUIDResolver{uid: 1001},
+		RateLimits: NewRateLimiter(0.5, 1),
+	}
+
+	review, err := a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, review.Response.Allowed)
+
+	review, err = a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, review.Response.Allowed)
+	assert.Equal(t, int32(http.StatusTooManyRequests), review.Response.Result.Code)
+	assert.Equal(t, metav1.StatusReasonTooManyRequests, review.Response.Result.Reason)
+	assert.Equal(t, int32(2), review.Response.Result.Details.RetryAfterSeconds)
+
+	// dry-run requests spend the tokens of the namespace like any other
+	dryRun := true
+	a.Request.DryRun = &dryRun
+	review, err = a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, review.Response.Allowed)
+	assert.Equal(t, int32(http.StatusTooManyRequests), review.Response.Result.Code)
+	a.Request.DryRun = nil
+
+	// pods beyond the rate are admitted in audit and warn modes
+	a.Modes = ModePolicy{Default: ModeWarn}
+	review, err = a.ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, review.Response.Allowed)
+	assert.Equal(t, []string{"pod would be rejected: too many pods admitted in namespace team-a, retry later"}, review.Response.Warnings)
+}
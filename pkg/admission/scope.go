@@ -0,0 +1,65 @@
+package admission
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// NamespaceScope selects the namespaces whose pods are validated and mutated,
+// independently of the namespaceSelector of the webhook configurations.
+// Entries are namespace names or path.Match patterns, e.g. ci-*.
+type NamespaceScope struct {
+	// Enforced lists the namespaces pods are admitted in, every namespace when empty
+	Enforced []string
+	// Excluded lists the namespaces skipped, it takes precedence over Enforced
+	Excluded []string
+}
+
+// ParseNamespaceScope returns the NamespaceScope described by comma separated
+// lists of enforced and excluded namespaces
+func ParseNamespaceScope(enforced, excluded string) (NamespaceScope, error) {
+	var scope NamespaceScope
+	var err error
+	if scope.Enforced, err = parseNamespaceList(enforced); err != nil {
+		return scope, err
+	}
+	if scope.Excluded, err = parseNamespaceList(excluded); err != nil {
+		return scope, err
+	}
+	return scope, nil
+}
+
+// Contains returns true if pods of namespace are validated and mutated
+func (s NamespaceScope) Contains(namespace string) bool {
+	if matchNamespace(s.Excluded, namespace) {
+		return false
+	}
+	return len(s.Enforced) == 0 || matchNamespace(s.Enforced, namespace)
+}
+
+// matchNamespace returns true if namespace matches one of patterns
+func matchNamespace(patterns []string, namespace string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNamespaceList parses a comma separated list of namespace patterns
+func parseNamespaceList(value string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid namespace pattern %q: %v", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
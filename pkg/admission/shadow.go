@@ -0,0 +1,78 @@
+package admission
+
+import (
+	"context"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/metrics"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/validation"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Shadow is a candidate validation policy and mappings the validated pods are
+// evaluated against besides the enforced ones, e.g. to measure the impact of a
+// mapping migration before switching to it. Its decisions are only recorded in
+// logs and metrics, they never change the decision about a pod.
+type Shadow struct {
+	ValidationPolicy validation.Policy
+	// Resolver resolves the identities of the candidate mappings, nil uses the
+	// resolver of the enforced policy
+	Resolver resolver.UIDResolver
+	// Ready returns an error while the candidate mappings can't be served, the
+	// pods aren't evaluated until then
+	Ready func() error
+}
+
+// compare validates pod with the candidate policy and mappings and records
+// whether the decision agrees with valid, the decision of the enforced policy
+// denied by validator, if any
+func (s *Shadow) compare(ctx context.Context, a Admitter, pod *corev1.Pod, valid bool, validator string) {
+	if s == nil || a.DryRun() {
+		return
+	}
+	if s.Ready != nil {
+		if err := s.Ready(); err != nil {
+			a.Logger.Debugf("candidate mappings not ready, skipping shadow evaluation: %v", err)
+			return
+		}
+	}
+
+	policy := s.ValidationPolicy
+	if a.isWorkload() {
+		// runAsUser is injected by the mutating webhook when pods are created
+		policy.RequireRunAsUser = false
+	}
+	uidResolver := s.Resolver
+	if uidResolver == nil {
+		uidResolver = a.Resolver
+	}
+	v := validation.NewValidator(a.Logger.WithField("shadow", true), policy, uidResolver)
+	val, err := v.ValidatePod(ctx, pod, a.podRequest(pod))
+	if err != nil {
+		a.Logger.Warnf("could not evaluate pod against the candidate policy: %v", err)
+		metrics.ObserveShadow(validator, metrics.ShadowError)
+		return
+	}
+
+	switch {
+	case val.Valid == valid:
+		if !valid {
+			validator = val.Validator
+		}
+		metrics.ObserveShadow(validator, metrics.ShadowAgreed)
+	case valid:
+		a.Logger.WithFields(logrus.Fields{
+			"shadow":           metrics.ShadowNewlyDenied,
+			"shadow_validator": val.Validator,
+		}).Warnf("pod would be denied by the candidate policy: %s", strings.ReplaceAll(strings.TrimSpace(val.Reason), "\n", " "))
+		metrics.ObserveShadow(val.Validator, metrics.ShadowNewlyDenied)
+	default:
+		a.Logger.WithFields(logrus.Fields{
+			"shadow":    metrics.ShadowNewlyAllowed,
+			"validator": validator,
+		}).Warn("pod would be allowed by the candidate policy")
+		metrics.ObserveShadow(validator, metrics.ShadowNewlyAllowed)
+	}
+}
@@ -0,0 +1,123 @@
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// workload is the part of the workload controllers used to validate their pods
+type workload struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Template          corev1.PodTemplateSpec
+}
+
+// workloadKinds are the kinds whose pod template is validated, by API group
+var workloadKinds = map[string]map[string]bool{
+	appsv1.GroupName:  {"Deployment": true, "StatefulSet": true, "DaemonSet": true},
+	batchv1.GroupName: {"Job": true, "CronJob": true},
+}
+
+// isWorkload returns true if the request is about a workload with a pod template
+func (a Admitter) isWorkload() bool {
+	return workloadKinds[a.Request.Kind.Group][a.Request.Kind.Kind]
+}
+
+// WorkloadPod extracts the pod of an admission request about a pod or the pod
+// template of a workload, in which case the returned pod is owned by the workload
+// and changed is false when an update leaves the pod template untouched
+func (a Admitter) WorkloadPod() (pod *corev1.Pod, changed bool, err error) {
+	if !a.isWorkload() {
+		pod, err := a.Pod()
+		return pod, true, err
+	}
+
+	w, err := decodeWorkload(a.Request.Object.Raw)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(a.Request.OldObject.Raw) > 0 {
+		old, err := decodeWorkload(a.Request.OldObject.Raw)
+		if err != nil {
+			return nil, false, err
+		}
+		if equality.Semantic.DeepEqual(old.Template, w.Template) {
+			return podFromTemplate(w), false, nil
+		}
+	}
+	return podFromTemplate(w), true, nil
+}
+
+// decodeWorkload decodes a workload, its pod template is read from spec.template
+// or, for CronJobs, from the template of their Jobs at spec.jobTemplate.spec.template
+func decodeWorkload(raw []byte) (*workload, error) {
+	var obj struct {
+		metav1.TypeMeta   `json:",inline"`
+		metav1.ObjectMeta `json:"metadata,omitempty"`
+		Spec              struct {
+			Template    *corev1.PodTemplateSpec `json:"template"`
+			JobTemplate *struct {
+				Spec struct {
+					Template *corev1.PodTemplateSpec `json:"template"`
+				} `json:"spec"`
+			} `json:"jobTemplate"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, err
+	}
+
+	template := obj.Spec.Template
+	if obj.Spec.JobTemplate != nil {
+		template = obj.Spec.JobTemplate.Spec.Template
+	}
+	if template == nil {
+		return nil, fmt.Errorf("%s %s has no pod template", obj.Kind, obj.Name)
+	}
+	return &workload{TypeMeta: obj.TypeMeta, ObjectMeta: obj.ObjectMeta, Template: *template}, nil
+}
+
+// podRequest returns the request pod is validated with: the request itself for
+// pods, and for the pod template of a workload the request its controller creates
+// the pods with, made by their serviceAccount rather than by the requester of the
+// workload, like the pods are admitted
+func (a Admitter) podRequest(pod *corev1.Pod) *admissionv1.AdmissionRequest {
+	if !a.isWorkload() {
+		return a.Request
+	}
+	request := a.Request.DeepCopy()
+	request.UserInfo = authenticationv1.UserInfo{Username: fmt.Sprintf("system:serviceaccount:%s:%s", a.Request.Namespace, pod.Spec.ServiceAccountName)}
+	return request
+}
+
+// podFromTemplate returns a pod made of the pod template of w, like the pods its
+// controller creates: named after w, owned by w and in the namespace of w, running
+// as the default serviceAccount unless the template sets one
+func podFromTemplate(w *workload) *corev1.Pod {
+	controller := true
+	pod := &corev1.Pod{
+		ObjectMeta: *w.Template.ObjectMeta.DeepCopy(),
+		Spec:       *w.Template.Spec.DeepCopy(),
+	}
+	pod.GenerateName = w.Name + "-"
+	pod.Namespace = w.Namespace
+	if pod.Spec.ServiceAccountName == "" {
+		pod.Spec.ServiceAccountName = "default"
+	}
+	pod.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: w.APIVersion,
+		Kind:       w.Kind,
+		Name:       w.Name,
+		UID:        w.UID,
+		Controller: &controller,
+	}}
+	return pod
+}
@@ -0,0 +1,149 @@
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// userResolver maps user1 and the web serviceAccount to UID 1001
+type userResolver struct{}
+
+func (userResolver) Resolve(_ context.Context, subject string) (resolver.IdentitySpec, error) {
+	if subject != "user1" && subject != "web" {
+		return resolver.IdentitySpec{}, resolver.ErrNotFound
+	}
+	uid := int64(1001)
+	return resolver.IdentitySpec{UID: &uid, GIDs: []int64{1001}}, nil
+}
+
+// deployment returns a raw Deployment whose pods run as uid with serviceAccount
+func deployment(t *testing.T, serviceAccount string, uid int64) []byte {
+	raw, err := json.Marshal(&appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "team-a"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					ServiceAccountName: serviceAccount,
+					SecurityContext:    &corev1.PodSecurityContext{RunAsUser: &uid},
+					Containers:         []corev1.Container{{Name: "web"}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestValidateWorkloadReview(t *testing.T) {
+	request := func(object, oldObject []byte) Admitter {
+		return Admitter{
+			Logger: logrus.NewEntry(logrus.New()),
+			Request: &admissionv1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+				Namespace: "team-a",
+				UserInfo:  authenticationv1.UserInfo{Username: "user1"},
+				Object:    runtime.RawExtension{Raw: object},
+				OldObject: runtime.RawExtension{Raw: oldObject},
+			},
+			Resolver: userResolver{},
+		}
+	}
+
+	review, err := request(deployment(t, "web", 1001), nil).ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, review.Response.Allowed, review.Response.Result.Message)
+
+	// the pods are created by the controller as the serviceAccount of the template,
+	// the default one when unset, whoever created the workload
+	review, err = request(deployment(t, "", 1001), nil).ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, review.Response.Allowed)
+	assert.Contains(t, review.Response.Result.Message, "User default has no UID associated with it")
+
+	review, err = request(deployment(t, "web", 0), nil).ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, review.Response.Allowed)
+	assert.Contains(t, review.Response.Result.Message, "Invalid uid")
+
+	// updates leaving the pod template untouched are admitted
+	review, err = request(deployment(t, "web", 0), deployment(t, "web", 0)).ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, review.Response.Allowed)
+	assert.Equal(t, "pod template unchanged", review.Response.Result.Message)
+
+	review, err = request(deployment(t, "web", 0), deployment(t, "web", 1001)).ValidatePodReview(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, review.Response.Allowed)
+}
+
+func TestWorkloadPod(t *testing.T) {
+	a := Admitter{Request: &admissionv1.AdmissionRequest{
+		Kind:   metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+		Object: runtime.RawExtension{Raw: deployment(t, "", 1001)},
+	}}
+
+	pod, changed, err := a.WorkloadPod()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, changed)
+	assert.Equal(t, "web-", pod.GenerateName)
+	assert.Equal(t, "team-a", pod.Namespace)
+	assert.Equal(t, "default", pod.Spec.ServiceAccountName)
+	if owner := metav1.GetControllerOf(pod); assert.NotNil(t, owner) {
+		assert.Equal(t, "Deployment", owner.Kind)
+		assert.Equal(t, "web", owner.Name)
+	}
+	assert.Equal(t, int64(1001), *pod.Spec.SecurityContext.RunAsUser)
+}
+
+func TestCronJobPod(t *testing.T) {
+	uid := int64(1001)
+	raw, err := json.Marshal(&batchv1.CronJob{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "CronJob"},
+		ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "team-a"},
+		Spec: batchv1.CronJobSpec{
+			Schedule: "@daily",
+			JobTemplate: batchv1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							SecurityContext: &corev1.PodSecurityContext{RunAsUser: &uid},
+							Containers:      []corev1.Container{{Name: "backup"}},
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := Admitter{Request: &admissionv1.AdmissionRequest{
+		Kind:   metav1.GroupVersionKind{Group: "batch", Version: "v1", Kind: "CronJob"},
+		Object: runtime.RawExtension{Raw: raw},
+	}}
+
+	pod, _, err := a.WorkloadPod()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "backup-", pod.GenerateName)
+	assert.Equal(t, "CronJob", metav1.GetControllerOf(pod).Kind)
+	assert.Equal(t, uid, *pod.Spec.SecurityContext.RunAsUser)
+}
@@ -0,0 +1,317 @@
+// Package allocator assigns UIDs to the serviceAccounts labeled for it, writing
+// the next free UID of a configured range to the UID mapping object so that
+// nobody has to keep track of the UIDs in use by hand
+package allocator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// AllocateLabel is the label of the serviceAccounts getting a UID allocated
+	AllocateLabel = "nfs-access-control/allocate"
+	// UIDAnnotation is set on the serviceAccounts to the UID allocated to them
+	UIDAnnotation = mapping.ServiceAccountUIDAnnotation
+
+	// resyncPeriod is the period at which the serviceAccounts are checked even without changes
+	resyncPeriod = 10 * time.Minute
+)
+
+// Allocator allocates a UID to every serviceAccount labeled with AllocateLabel
+// "true" that isn't mapped yet. ServiceAccounts are mapped by name like in the
+// mapping objects.
+type Allocator struct {
+	client   kubernetes.Interface
+	mappings *mapping.Store
+	factory  informers.SharedInformerFactory
+	informer cache.SharedIndexInformer
+	accounts corelisters.ServiceAccountLister
+
+	// UIDs is the range UIDs are allocated from
+	UIDs   mapping.IDRange
+	Logger *logrus.Entry
+}
+
+// NewAllocator returns an Allocator writing the UIDs allocated from uids to the
+// UID mapping object of mappings
+func NewAllocator(client kubernetes.Interface, mappings *mapping.Store, uids mapping.IDRange) *Allocator {
+	selector := labels.Set{AllocateLabel: "true"}.String()
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) { o.LabelSelector = selector }))
+	accounts := factory.Core().V1().ServiceAccounts()
+	return &Allocator{
+		client:   client,
+		mappings: mappings,
+		factory:  factory,
+		informer: accounts.Informer(),
+		accounts: accounts.Lister(),
+		UIDs:     uids,
+		Logger:   logrus.WithField("component", "allocator"),
+	}
+}
+
+// Run allocates UIDs once the serviceAccount cache is synced, then on every
+// serviceAccount change and every resyncPeriod until stopCh is closed. Failures
+// are logged and retried on the next change or resync. It blocks until the
+// serviceAccount cache is synced.
+func (a *Allocator) Run(stopCh <-chan struct{}) error {
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	_, err := a.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { notify() },
+		UpdateFunc: func(interface{}, interface{}) { notify() },
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch serviceAccounts: %v", err)
+	}
+	a.factory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, a.informer.HasSynced) {
+		return fmt.Errorf("failed to sync serviceAccount cache")
+	}
+
+	go func() {
+		ticker := time.NewTicker(resyncPeriod)
+		defer ticker.Stop()
+		for {
+			if err := a.Sync(context.Background()); err != nil {
+				a.Logger.Errorf("cannot allocate UIDs: %v", err)
+			}
+			select {
+			case <-stopCh:
+				return
+			case <-changed:
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// Sync allocates a UID to the labeled serviceAccounts without one, and annotates
+// every labeled serviceAccount with its UID
+func (a *Allocator) Sync(ctx context.Context) error {
+	accounts, err := a.accounts.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("Error listing serviceAccounts: %s\n", err)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].Namespace+"/"+accounts[i].Name < accounts[j].Namespace+"/"+accounts[j].Name
+	})
+
+	uids := map[string]int64{}
+	var pending []string
+	for _, sa := range accounts {
+		if _, seen := uids[sa.Name]; seen {
+			continue
+		}
+		ranges, found, err := a.mappings.UIDs(sa.Name)
+		if err != nil {
+			return err
+		}
+		if found {
+			uids[sa.Name] = ranges[0].Min
+			continue
+		}
+		uids[sa.Name] = -1
+		pending = append(pending, sa.Name)
+	}
+	if len(pending) > 0 {
+		allocated, err := a.allocate(ctx, pending)
+		for name, uid := range allocated {
+			uids[name] = uid
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, sa := range accounts {
+		uid := uids[sa.Name]
+		if uid < 0 || sa.Annotations[UIDAnnotation] == strconv.FormatInt(uid, 10) {
+			continue
+		}
+		patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, UIDAnnotation, strconv.FormatInt(uid, 10))
+		_, err := a.client.CoreV1().ServiceAccounts(sa.Namespace).Patch(ctx, sa.Name, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+		if err != nil {
+			return fmt.Errorf("Error annotating serviceAccount %s/%s: %s\n", sa.Namespace, sa.Name, err)
+		}
+	}
+	return nil
+}
+
+// allocate writes the next free UIDs to the UID mapping object for the subjects
+// of names and returns them. The mapping object is read again and the update
+// retried on conflicts, so that concurrent allocators never hand out a UID twice.
+func (a *Allocator) allocate(ctx context.Context, names []string) (map[string]int64, error) {
+	var allocated map[string]int64
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		allocated = map[string]int64{}
+		return a.updateMapping(ctx, func(data map[string]string) error {
+			used, mapped, err := a.used(data)
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				if mapped[name] {
+					continue
+				}
+				uid, err := nextFree(used, a.UIDs)
+				if err != nil {
+					return err
+				}
+				data[name] = strconv.FormatInt(uid, 10)
+				used = append(used, mapping.IDRange{Min: uid, Max: uid})
+				allocated[name] = uid
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	for name, uid := range allocated {
+		a.Logger.Infof("Allocated UID %d to serviceAccount %s", uid, name)
+	}
+	return allocated, nil
+}
+
+// used returns the UIDs mapped in data, the flat entries and the structured
+// document of the UID mapping object, and in the mapping cache, e.g. by
+// UIDMappings, as well as the subjects mapped in data
+func (a *Allocator) used(data map[string]string) (mapping.IDRanges, map[string]bool, error) {
+	var used mapping.IDRanges
+	mapped := map[string]bool{}
+	for subject, value := range data {
+		if subject == mapping.DocumentKey {
+			continue
+		}
+		mapped[subject] = true
+		if ranges, err := mapping.ParseIDRanges(value); err == nil {
+			used = append(used, ranges...)
+		}
+	}
+	if value, ok := data[mapping.DocumentKey]; ok {
+		document, err := mapping.ParseDocument([]byte(value))
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot allocate UIDs with an invalid %s: %v", mapping.DocumentKey, err)
+		}
+		for subject, entry := range document.Subjects {
+			mapped[subject] = true
+			if entry.UID != nil {
+				used = append(used, mapping.IDRange{Min: *entry.UID, Max: *entry.UID})
+			} else if ranges, err := mapping.ParseIDRanges(entry.UIDs); err == nil {
+				used = append(used, ranges...)
+			}
+		}
+	}
+
+	subjects, err := a.mappings.Subjects()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, subject := range subjects {
+		ranges, found, err := a.mappings.UIDs(subject)
+		if err != nil {
+			return nil, nil, err
+		}
+		if found {
+			used = append(used, ranges...)
+		}
+	}
+	return used, mapped, nil
+}
+
+// updateMapping applies update to the data of the UID mapping object, which must exist
+func (a *Allocator) updateMapping(ctx context.Context, update func(map[string]string) error) error {
+	source := a.mappings.Source()
+	if source.Kind == mapping.SecretKind {
+		secrets := a.client.CoreV1().Secrets(source.Namespace)
+		secret, err := secrets.Get(ctx, source.UIDName, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("Error getting Secret: %s\n", err)
+		}
+		data := make(map[string]string, len(secret.Data))
+		for k, v := range secret.Data {
+			data[k] = string(v)
+		}
+		if err := update(data); err != nil {
+			return err
+		}
+		secret.Data = make(map[string][]byte, len(data))
+		for k, v := range data {
+			secret.Data[k] = []byte(v)
+		}
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+		return err
+	}
+
+	configMaps := a.client.CoreV1().ConfigMaps(source.Namespace)
+	configMap, err := configMaps.Get(ctx, source.UIDName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("Error getting ConfigMap: %s\n", err)
+	}
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+	if err := update(configMap.Data); err != nil {
+		return err
+	}
+	_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+	return err
+}
+
+// nextFree returns the lowest UID of uids that is not part of used
+func nextFree(used mapping.IDRanges, uids mapping.IDRange) (int64, error) {
+	sorted := append(mapping.IDRanges(nil), used...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Min < sorted[j].Min })
+
+	candidate := uids.Min
+	for _, r := range sorted {
+		if r.Max < candidate {
+			continue
+		}
+		if r.Min > candidate {
+			break
+		}
+		candidate = r.Max + 1
+	}
+	if candidate > uids.Max {
+		return 0, fmt.Errorf("no free UID left in %s", mapping.IDRanges{uids})
+	}
+	return candidate, nil
+}
+
+// ParseRange parses the range UIDs are allocated from, e.g. "100000-199999"
+func ParseRange(value string) (mapping.IDRange, error) {
+	ranges, err := mapping.ParseIDRanges(value)
+	if err != nil {
+		return mapping.IDRange{}, err
+	}
+	if len(ranges) != 1 {
+		return mapping.IDRange{}, fmt.Errorf("expected a single UID range, got %q", value)
+	}
+	if ranges[0].Min < 0 || ranges[0].Max > mapping.MaxID {
+		return mapping.IDRange{}, fmt.Errorf("UID range %s is out of [0, %d]", ranges, int64(mapping.MaxID))
+	}
+	return ranges[0], nil
+}
@@ -0,0 +1,103 @@
+package allocator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAllocatorRun(t *testing.T) {
+	serviceAccount := func(namespace, name string, labeled bool) *corev1.ServiceAccount {
+		sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+		if labeled {
+			sa.Labels = map[string]string{AllocateLabel: "true"}
+		}
+		return sa
+	}
+	client := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: mapping.UIDConfigMapName, Namespace: "nfs"},
+			Data: map[string]string{
+				"user1":             "100000",
+				"group.eng":         "100002-100003",
+				"mapped":            "5000",
+				mapping.DocumentKey: "schemaVersion: v1\nsubjects:\n  user2:\n    uid: 100001",
+			},
+		},
+		serviceAccount("team-a", "builder", true),
+		serviceAccount("team-a", "mapped", true),
+		serviceAccount("team-b", "deployer", true),
+		serviceAccount("team-b", "ignored", false),
+	)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	s := mapping.NewStore(client, "nfs")
+	if err := s.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+	a := NewAllocator(client, s, mapping.IDRange{Min: 100000, Max: 100010})
+	if err := a.Run(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	uidMapping := func() map[string]string {
+		cm, err := client.CoreV1().ConfigMaps("nfs").Get(context.TODO(), mapping.UIDConfigMapName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cm.Data
+	}
+	annotation := func(namespace, name string) string {
+		sa, err := client.CoreV1().ServiceAccounts(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sa.Annotations[UIDAnnotation]
+	}
+
+	// UIDs of the flat entries, the document and group ranges are skipped
+	assert.Eventually(t, func() bool { return uidMapping()["deployer"] != "" }, time.Second, 10*time.Millisecond)
+	data := uidMapping()
+	assert.Equal(t, "100004", data["builder"])
+	assert.Equal(t, "100005", data["deployer"])
+	assert.Equal(t, "5000", data["mapped"])
+	assert.NotContains(t, data, "ignored")
+
+	assert.Eventually(t, func() bool { return annotation("team-b", "deployer") == "100005" }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "100004", annotation("team-a", "builder"))
+	assert.Equal(t, "5000", annotation("team-a", "mapped"))
+	assert.Empty(t, annotation("team-b", "ignored"))
+}
+
+func TestNextFree(t *testing.T) {
+	uids := mapping.IDRange{Min: 100, Max: 102}
+	uid, err := nextFree(nil, uids)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), uid)
+
+	uid, err = nextFree(mapping.IDRanges{{Min: 101, Max: 101}, {Min: 0, Max: 100}}, uids)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(102), uid)
+
+	_, err = nextFree(mapping.IDRanges{{Min: 50, Max: 200}}, uids)
+	assert.Error(t, err)
+}
+
+func TestParseRange(t *testing.T) {
+	r, err := ParseRange("100000-199999")
+	assert.NoError(t, err)
+	assert.Equal(t, mapping.IDRange{Min: 100000, Max: 199999}, r)
+
+	for _, value := range []string{"", "abc", "1-2,5-6", "0-4294967295"} {
+		_, err := ParseRange(value)
+		assert.Error(t, err, value)
+	}
+}
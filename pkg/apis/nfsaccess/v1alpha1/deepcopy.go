@@ -0,0 +1,220 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto copies the receiver into out
+func (in *UIDMapping) DeepCopyInto(out *UIDMapping) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy returns a deep copy of the receiver
+func (in *UIDMapping) DeepCopy() *UIDMapping {
+	if in == nil {
+		return nil
+	}
+	out := new(UIDMapping)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *UIDMapping) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *UIDMappingSpec) DeepCopyInto(out *UIDMappingSpec) {
+	*out = *in
+	if in.GIDs != nil {
+		out.GIDs = make([]int64, len(in.GIDs))
+		copy(out.GIDs, in.GIDs)
+	}
+	if in.Expiry != nil {
+		out.Expiry = in.Expiry.DeepCopy()
+	}
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *UIDMappingStatus) DeepCopyInto(out *UIDMappingStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		out.Conditions = make([]metav1.Condition, len(in.Conditions))
+		for i := range in.Conditions {
+			in.Conditions[i].DeepCopyInto(&out.Conditions[i])
+		}
+	}
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *UIDMappingList) DeepCopyInto(out *UIDMappingList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]UIDMapping, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy returns a deep copy of the receiver
+func (in *UIDMappingList) DeepCopy() *UIDMappingList {
+	if in == nil {
+		return nil
+	}
+	out := new(UIDMappingList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *UIDMappingList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *NFSAccessPolicy) DeepCopyInto(out *NFSAccessPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy returns a deep copy of the receiver
+func (in *NFSAccessPolicy) DeepCopy() *NFSAccessPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(NFSAccessPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *NFSAccessPolicy) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *NFSAccessPolicySpec) DeepCopyInto(out *NFSAccessPolicySpec) {
+	*out = *in
+	if in.Namespaces != nil {
+		out.Namespaces = make([]string, len(in.Namespaces))
+		copy(out.Namespaces, in.Namespaces)
+	}
+	if in.Rules != nil {
+		out.Rules = make([]NFSAccessRule, len(in.Rules))
+		copy(out.Rules, in.Rules)
+	}
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *NFSAccessPolicyList) DeepCopyInto(out *NFSAccessPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]NFSAccessPolicy, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy returns a deep copy of the receiver
+func (in *NFSAccessPolicyList) DeepCopy() *NFSAccessPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(NFSAccessPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *NFSAccessPolicyList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *NFSAccessReport) DeepCopyInto(out *NFSAccessReport) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Summary.DeepCopyInto(&out.Summary)
+	if in.Results != nil {
+		out.Results = make([]NFSAccessReportResult, len(in.Results))
+		for i := range in.Results {
+			in.Results[i].DeepCopyInto(&out.Results[i])
+		}
+	}
+}
+
+// DeepCopy returns a deep copy of the receiver
+func (in *NFSAccessReport) DeepCopy() *NFSAccessReport {
+	if in == nil {
+		return nil
+	}
+	out := new(NFSAccessReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *NFSAccessReport) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *NFSAccessReportSummary) DeepCopyInto(out *NFSAccessReportSummary) {
+	*out = *in
+	if in.LastDenial != nil {
+		out.LastDenial = in.LastDenial.DeepCopy()
+	}
+	if in.LastScan != nil {
+		out.LastScan = in.LastScan.DeepCopy()
+	}
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *NFSAccessReportResult) DeepCopyInto(out *NFSAccessReportResult) {
+	*out = *in
+	in.FirstSeen.DeepCopyInto(&out.FirstSeen)
+	in.LastSeen.DeepCopyInto(&out.LastSeen)
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *NFSAccessReportList) DeepCopyInto(out *NFSAccessReportList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]NFSAccessReport, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy returns a deep copy of the receiver
+func (in *NFSAccessReportList) DeepCopy() *NFSAccessReportList {
+	if in == nil {
+		return nil
+	}
+	out := new(NFSAccessReportList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *NFSAccessReportList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
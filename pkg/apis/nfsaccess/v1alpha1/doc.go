@@ -0,0 +1,4 @@
+// Package v1alpha1 contains the v1alpha1 API of the nfsaccess.io group,
+// used to declare the NFS identity of users and serviceAccounts and the policies
+// their pods must satisfy
+package v1alpha1
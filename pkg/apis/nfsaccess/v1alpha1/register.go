@@ -0,0 +1,43 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// GroupName is the API group of the NFS access resources
+const GroupName = "nfsaccess.io"
+
+// SchemeGroupVersion is the group version used to register these objects
+var SchemeGroupVersion = schema.GroupVersion{Group: GroupName, Version: "v1alpha1"}
+
+// UIDMappingsResource is the resource of UIDMapping objects
+var UIDMappingsResource = SchemeGroupVersion.WithResource("uidmappings")
+
+// NFSAccessPoliciesResource is the resource of NFSAccessPolicy objects
+var NFSAccessPoliciesResource = SchemeGroupVersion.WithResource("nfsaccesspolicies")
+
+// NFSAccessReportsResource is the resource of NFSAccessReport objects
+var NFSAccessReportsResource = SchemeGroupVersion.WithResource("nfsaccessreports")
+
+var (
+	// SchemeBuilder registers the types of this group version
+	SchemeBuilder = runtime.NewSchemeBuilder(addKnownTypes)
+	// AddToScheme adds the types of this group version to a scheme
+	AddToScheme = SchemeBuilder.AddToScheme
+)
+
+// addKnownTypes adds the list of known types to the given scheme
+func addKnownTypes(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(SchemeGroupVersion,
+		&UIDMapping{},
+		&UIDMappingList{},
+		&NFSAccessPolicy{},
+		&NFSAccessPolicyList{},
+		&NFSAccessReport{},
+		&NFSAccessReportList{},
+	)
+	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
+	return nil
+}
@@ -0,0 +1,141 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// UIDMapping maps a user or serviceAccount to the NFS identity its pods must run with
+type UIDMapping struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   UIDMappingSpec   `json:"spec"`
+	Status UIDMappingStatus `json:"status,omitempty"`
+}
+
+// UIDMappingSpec is the desired NFS identity of a subject
+type UIDMappingSpec struct {
+	// Subject is the name of the user or serviceAccount, as used as key in the
+	// UID mapping ConfigMap
+	Subject string `json:"subject"`
+	// UID is the runAsUser pods of the subject must run with
+	UID int64 `json:"uid"`
+	// GIDs are the groups pods of the subject may use as runAsGroup, fsGroup
+	// and supplementalGroups
+	GIDs []int64 `json:"gids,omitempty"`
+	// Expiry is the time after which the mapping is ignored
+	Expiry *metav1.Time `json:"expiry,omitempty"`
+}
+
+// UIDMappingStatus reports the state of a UIDMapping
+type UIDMappingStatus struct {
+	// ObservedGeneration is the generation last processed by the webhook
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions describe the state of the mapping, e.g. whether it is expired
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Expired returns true if the mapping has an expiry in the past
+func (m *UIDMapping) Expired(now metav1.Time) bool {
+	return m.Spec.Expiry != nil && !now.Before(m.Spec.Expiry)
+}
+
+// UIDMappingList is a list of UIDMapping
+type UIDMappingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []UIDMapping `json:"items"`
+}
+
+// NFSAccessPolicy holds CEL rules the pods of its namespaces must satisfy
+type NFSAccessPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec NFSAccessPolicySpec `json:"spec"`
+}
+
+// NFSAccessPolicySpec is the set of rules of an NFSAccessPolicy
+type NFSAccessPolicySpec struct {
+	// Namespaces are the namespaces or patterns (e.g. ci-*) of the pods the policy
+	// applies to, every namespace when empty
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Rules must all evaluate to true for a pod to be admitted
+	Rules []NFSAccessRule `json:"rules"`
+}
+
+// NFSAccessRule is a CEL expression evaluated against the pod, the subject
+// creating it and the mapping entry of the subject
+type NFSAccessRule struct {
+	// Name identifies the rule in denials
+	Name string `json:"name"`
+	// Expression is a CEL expression returning a bool, e.g.
+	// subject.uid in entry.allowedUids && !pod.spec.hostNetwork
+	Expression string `json:"expression"`
+	// Message is the reason of denials, a generic one naming the rule when empty
+	Message string `json:"message,omitempty"`
+}
+
+// NFSAccessPolicyList is a list of NFSAccessPolicy
+type NFSAccessPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []NFSAccessPolicy `json:"items"`
+}
+
+// NFSAccessReport summarizes the pods of its namespace denied by the webhook and
+// the running pods found in violation by the compliance scan
+type NFSAccessReport struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Summary NFSAccessReportSummary  `json:"summary"`
+	Results []NFSAccessReportResult `json:"results,omitempty"`
+}
+
+// NFSAccessReportSummary counts the results of an NFSAccessReport
+type NFSAccessReportSummary struct {
+	// Denials is the number of pods denied since the report was created
+	Denials int64 `json:"denials"`
+	// Violations is the number of running pods found in violation by the last scan
+	Violations int64 `json:"violations"`
+	// LastDenial is the time of the last denied pod
+	LastDenial *metav1.Time `json:"lastDenial,omitempty"`
+	// LastScan is the time of the last compliance scan of the namespace
+	LastScan *metav1.Time `json:"lastScan,omitempty"`
+}
+
+const (
+	// ResultDenial is the type of the results about pods denied by the webhook
+	ResultDenial = "Denial"
+	// ResultViolation is the type of the results about running pods found in
+	// violation by the compliance scan
+	ResultViolation = "Violation"
+)
+
+// NFSAccessReportResult is a denial, or a violation of a running pod, repeated
+// Count times between FirstSeen and LastSeen
+type NFSAccessReportResult struct {
+	// Type is either Denial or Violation
+	Type string `json:"type"`
+	// Subject is the user or serviceAccount the pod was evaluated as
+	Subject string `json:"subject"`
+	// Pod is the name (or generateName) of the last pod found
+	Pod       string      `json:"pod,omitempty"`
+	Validator string      `json:"validator,omitempty"`
+	Code      string      `json:"code,omitempty"`
+	Reason    string      `json:"reason"`
+	Count     int64       `json:"count"`
+	FirstSeen metav1.Time `json:"firstSeen"`
+	LastSeen  metav1.Time `json:"lastSeen"`
+}
+
+// NFSAccessReportList is a list of NFSAccessReport
+type NFSAccessReportList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []NFSAccessReport `json:"items"`
+}
@@ -0,0 +1,329 @@
+// Package auditlog writes an audit record of every admission decision, in JSON
+// or CEF, to a stream dedicated to SIEM ingestion and separate from the
+// operational logs, e.g. a file, syslog or stdout
+package auditlog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Formats of the audit records
+const (
+	FormatJSON = "json"
+	FormatCEF  = "cef"
+)
+
+// queueSize bounds the records waiting to be written, the ones beyond are
+// dropped rather than delaying admissions
+const queueSize = 4096
+
+// CEF header fields, cefVersion is the version of the layout of the records
+const (
+	cefVendor  = "nfs-pod-access-control"
+	cefProduct = "nfs-pod-access-control"
+	cefVersion = "1"
+)
+
+// IDs are the UIDs and GIDs of a pod, and the ones expected by the denying
+// validator, if any
+type IDs struct {
+	// RunAsUser and RunAsGroup are the distinct effective IDs of the containers
+	RunAsUser          []int64 `json:"runAsUser,omitempty"`
+	RunAsGroup         []int64 `json:"runAsGroup,omitempty"`
+	FSGroup            *int64  `json:"fsGroup,omitempty"`
+	SupplementalGroups []int64 `json:"supplementalGroups,omitempty"`
+	ExpectedUID        string  `json:"expectedUID,omitempty"`
+	ExpectedGIDs       string  `json:"expectedGIDs,omitempty"`
+}
+
+// Record is the audit record of an admission decision
+type Record struct {
+	Time       time.Time `json:"time"`
+	RequestUID string    `json:"requestUID"`
+	// Webhook is validate or mutate
+	Webhook string `json:"webhook"`
+	// Decision is the decision of the admission metrics, e.g. denied or audited
+	Decision  string `json:"decision"`
+	Allowed   bool   `json:"allowed"`
+	DryRun    bool   `json:"dryRun,omitempty"`
+	Operation string `json:"operation"`
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name,omitempty"`
+	// User is the requester, Subject the user/serviceAccount the pod is
+	// validated for
+	User           string `json:"user"`
+	Subject        string `json:"subject,omitempty"`
+	Validator      string `json:"validator,omitempty"`
+	Reason         string `json:"reason,omitempty"`
+	IDs            IDs    `json:"ids"`
+	MappingVersion string `json:"mappingVersion,omitempty"`
+}
+
+// Logger writes the audit records to its output in the background
+type Logger struct {
+	Format string
+	// MappingVersion returns the hash of the version of the mappings served,
+	// nil leaves it out of the records
+	MappingVersion func() string
+	Logger         logrus.FieldLogger
+
+	out   io.Writer
+	queue chan Record
+	done  chan struct{}
+
+	// mu guards queue against the sends of the admissions still running
+	// when the Logger is closed
+	mu     sync.Mutex
+	closed bool
+}
+
+// New returns a Logger writing the records to out in format, one per Write
+// call so that every syslog message holds one record
+func New(out io.Writer, format string) (*Logger, error) {
+	switch format {
+	case "":
+		format = FormatJSON
+	case FormatJSON, FormatCEF:
+	default:
+		return nil, fmt.Errorf("unknown audit log format %q, expected json or cef", format)
+	}
+	l := &Logger{
+		Format: format,
+		Logger: logrus.StandardLogger(),
+		out:    out,
+		queue:  make(chan Record, queueSize),
+		done:   make(chan struct{}),
+	}
+	go l.run()
+	return l, nil
+}
+
+// Log queues a record, it never blocks: the records are dropped while the
+// output is too slow to keep up, or once the Logger is closed
+func (l *Logger) Log(r Record) {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	if l.MappingVersion != nil {
+		r.MappingVersion = l.MappingVersion()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		metrics.ObserveAuditRecord("dropped")
+		return
+	}
+	select {
+	case l.queue <- r:
+	default:
+		metrics.ObserveAuditRecord("dropped")
+	}
+}
+
+// Close writes the queued records and stops the Logger, until ctx is done
+func (l *Logger) Close(ctx context.Context) error {
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.queue)
+	}
+	l.mu.Unlock()
+	select {
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run writes the queued records until the Logger is closed
+func (l *Logger) run() {
+	defer close(l.done)
+	for r := range l.queue {
+		line := l.format(r)
+		if _, err := l.out.Write(line); err != nil {
+			l.Logger.Warnf("cannot write audit record: %v", err)
+			metrics.ObserveAuditRecord("error")
+			continue
+		}
+		metrics.ObserveAuditRecord("written")
+	}
+}
+
+// format returns the line of a record in the format of the Logger
+func (l *Logger) format(r Record) []byte {
+	if l.Format == FormatCEF {
+		return []byte(cef(r) + "\n")
+	}
+	// a Record always marshals
+	line, _ := json.Marshal(r)
+	return append(line, '\n')
+}
+
+// severities are the CEF severities of the decisions, 1 when not listed
+var severities = map[string]int{
+	metrics.DecisionExempted:    3,
+	metrics.DecisionAudited:     3,
+	metrics.DecisionWarned:      3,
+	metrics.DecisionDenied:      5,
+	metrics.DecisionRateLimited: 5,
+	metrics.DecisionFailedOpen:  7,
+	metrics.DecisionTimedOut:    7,
+	metrics.DecisionError:       7,
+}
+
+// cef formats a record as a CEF event whose signature is the decision
+func cef(r Record) string {
+	severity, ok := severities[r.Decision]
+	if !ok {
+		severity = 1
+	}
+	outcome := "denied"
+	if r.Allowed {
+		outcome = "allowed"
+	}
+	name := fmt.Sprintf("%s %s %s", strings.ToLower(r.Kind), r.Webhook, r.Decision)
+
+	var ext []string
+	add := func(key, value string) {
+		if value != "" {
+			ext = append(ext, key+"="+cefValue(value))
+		}
+	}
+	add("rt", strconv.FormatInt(r.Time.UnixMilli(), 10))
+	add("externalId", r.RequestUID)
+	add("act", r.Decision)
+	add("outcome", outcome)
+	add("suser", r.User)
+	add("duser", r.Subject)
+	add("msg", r.Reason)
+	// custom fields are labeled, and left out with their label when empty
+	custom := func(key, label, value string) {
+		if value != "" {
+			add(key+"Label", label)
+			add(key, value)
+		}
+	}
+	custom("cs1", "namespace", r.Namespace)
+	custom("cs2", "object", r.Kind+"/"+r.Name)
+	custom("cs3", "validator", r.Validator)
+	custom("cs4", "mappingVersion", r.MappingVersion)
+	custom("cs5", "ids", r.IDs.String())
+	custom("cs6", "operation", r.Operation)
+	if r.DryRun {
+		custom("cn1", "dryRun", "1")
+	}
+
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		cefHeader(cefVendor), cefHeader(cefProduct), cefVersion, cefHeader(r.Decision), cefHeader(name), severity, strings.Join(ext, " "))
+}
+
+// cefHeader escapes a header field of a CEF event
+func cefHeader(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ").Replace(s)
+}
+
+// cefValue escapes an extension value of a CEF event
+func cefValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`).Replace(strings.TrimSpace(s))
+}
+
+// String formats the IDs as space separated key=value pairs, e.g.
+// "runAsUser=1001 fsGroup=1001 expectedUID=1001"
+func (ids IDs) String() string {
+	var pairs []string
+	add := func(key string, values []int64) {
+		if len(values) > 0 {
+			pairs = append(pairs, key+"="+formatIDs(values))
+		}
+	}
+	add("runAsUser", ids.RunAsUser)
+	add("runAsGroup", ids.RunAsGroup)
+	if ids.FSGroup != nil {
+		add("fsGroup", []int64{*ids.FSGroup})
+	}
+	add("supplementalGroups", ids.SupplementalGroups)
+	if ids.ExpectedUID != "" {
+		pairs = append(pairs, "expectedUID="+ids.ExpectedUID)
+	}
+	if ids.ExpectedGIDs != "" {
+		pairs = append(pairs, "expectedGIDs="+ids.ExpectedGIDs)
+	}
+	return strings.Join(pairs, " ")
+}
+
+// formatIDs formats IDs as a comma separated list
+func formatIDs(ids []int64) string {
+	formatted := make([]string, len(ids))
+	for i, id := range ids {
+		formatted[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(formatted, ",")
+}
+
+// PodIDs returns the effective UIDs and GIDs of the containers of pod, the
+// containers inheriting the ones of the pod unless they set their own
+func PodIDs(pod *corev1.Pod) IDs {
+	var ids IDs
+	var podUser, podGroup *int64
+	if sc := pod.Spec.SecurityContext; sc != nil {
+		podUser, podGroup = sc.RunAsUser, sc.RunAsGroup
+		ids.FSGroup = sc.FSGroup
+		ids.SupplementalGroups = sc.SupplementalGroups
+	}
+
+	users, groups := map[int64]bool{}, map[int64]bool{}
+	effective := func(sc *corev1.SecurityContext) {
+		user, group := podUser, podGroup
+		if sc != nil && sc.RunAsUser != nil {
+			user = sc.RunAsUser
+		}
+		if sc != nil && sc.RunAsGroup != nil {
+			group = sc.RunAsGroup
+		}
+		if user != nil {
+			users[*user] = true
+		}
+		if group != nil {
+			groups[*group] = true
+		}
+	}
+	for _, c := range pod.Spec.InitContainers {
+		effective(c.SecurityContext)
+	}
+	for _, c := range pod.Spec.Containers {
+		effective(c.SecurityContext)
+	}
+	for _, c := range pod.Spec.EphemeralContainers {
+		effective(c.SecurityContext)
+	}
+	ids.RunAsUser = sortedIDs(users)
+	ids.RunAsGroup = sortedIDs(groups)
+	return ids
+}
+
+// sortedIDs returns the IDs of a set in ascending order
+func sortedIDs(set map[int64]bool) []int64 {
+	if len(set) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,97 @@
+package auditlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func testRecord() Record {
+	return Record{
+		Time:       time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+		RequestUID: "705ab4f5",
+		Webhook:    "validate",
+		Decision:   "denied",
+		Operation:  "CREATE",
+		Namespace:  "team-a",
+		Kind:       "Pod",
+		Name:       "web-",
+		User:       "system:serviceaccount:kube-system:replicaset-controller",
+		Subject:    "web",
+		Validator:  "uid_validator",
+		Reason:     "Invalid uid in pod, expected: 1001, found: 0\nSuggested fix | runAsUser=1001",
+		IDs:        IDs{RunAsUser: []int64{0}, ExpectedUID: "1001"},
+	}
+}
+
+func TestLoggerJSON(t *testing.T) {
+	var out bytes.Buffer
+	l, err := New(&out, "")
+	require.NoError(t, err)
+	l.MappingVersion = func() string { return "abc" }
+
+	l.Log(testRecord())
+	l.Log(testRecord())
+	require.NoError(t, l.Close(context.TODO()))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	var r Record
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &r))
+	expected := testRecord()
+	expected.MappingVersion = "abc"
+	assert.Equal(t, expected, r)
+}
+
+func TestLoggerCEF(t *testing.T) {
+	var out bytes.Buffer
+	l, err := New(&out, FormatCEF)
+	require.NoError(t, err)
+
+	l.Log(testRecord())
+	require.NoError(t, l.Close(context.TODO()))
+	assert.Equal(t, `CEF:0|nfs-pod-access-control|nfs-pod-access-control|1|denied|pod validate denied|5|`+
+		`rt=1767268800000 externalId=705ab4f5 act=denied outcome=denied suser=system:serviceaccount:kube-system:replicaset-controller duser=web `+
+		`msg=Invalid uid in pod, expected: 1001, found: 0\nSuggested fix | runAsUser\=1001 `+
+		`cs1Label=namespace cs1=team-a cs2Label=object cs2=Pod/web- cs3Label=validator cs3=uid_validator `+
+		`cs5Label=ids cs5=runAsUser\=0 expectedUID\=1001 cs6Label=operation cs6=CREATE`+"\n", out.String())
+
+	_, err = New(&out, "leef")
+	assert.Error(t, err)
+}
+
+func TestLoggerLogAfterClose(t *testing.T) {
+	var out bytes.Buffer
+	l, err := New(&out, "")
+	require.NoError(t, err)
+
+	l.Log(testRecord())
+	require.NoError(t, l.Close(context.TODO()))
+	assert.NotPanics(t, func() { l.Log(testRecord()) })
+	require.NoError(t, l.Close(context.TODO()))
+	assert.Equal(t, 1, strings.Count(out.String(), "\n"))
+}
+
+func TestPodIDs(t *testing.T) {
+	uid, gid, root := int64(1001), int64(2000), int64(0)
+	pod := &corev1.Pod{Spec: corev1.PodSpec{
+		SecurityContext: &corev1.PodSecurityContext{RunAsUser: &uid, FSGroup: &gid, SupplementalGroups: []int64{3000}},
+		InitContainers:  []corev1.Container{{Name: "init", SecurityContext: &corev1.SecurityContext{RunAsUser: &root}}},
+		Containers: []corev1.Container{
+			{Name: "app"},
+			{Name: "sidecar", SecurityContext: &corev1.SecurityContext{RunAsGroup: &gid}},
+		},
+	}}
+
+	ids := PodIDs(pod)
+	assert.Equal(t, IDs{RunAsUser: []int64{0, 1001}, RunAsGroup: []int64{2000}, FSGroup: &gid, SupplementalGroups: []int64{3000}}, ids)
+	assert.Equal(t, "runAsUser=0,1001 runAsGroup=2000 fsGroup=2000 supplementalGroups=3000", ids.String())
+	assert.Equal(t, IDs{}, PodIDs(&corev1.Pod{}))
+}
@@ -0,0 +1,163 @@
+// Package certs manages the TLS serving certificate of the webhook: either it
+// issues a self-signed CA and a serving certificate, keeps them in a Secret, renews
+// them before they expire and patches the CA bundle into the webhook
+// configurations, or it reloads the certificate of a mounted Secret, e.g. issued
+// by cert-manager, whenever it is rotated
+package certs
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// KeyPair is a PEM encoded certificate and its PEM encoded private key
+type KeyPair struct {
+	Cert []byte
+	Key  []byte
+}
+
+// NewCA returns a self-signed CA valid from now for validity
+func NewCA(commonName string, now time.Time, validity time.Duration) (KeyPair, error) {
+	template, err := newTemplate(commonName, now, now.Add(validity))
+	if err != nil {
+		return KeyPair{}, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	return sign(template, nil, nil)
+}
+
+// NewServingCert returns a serving certificate for dnsNames signed by ca, valid
+// from now for validity but never beyond the expiry of ca
+func NewServingCert(ca KeyPair, dnsNames []string, now time.Time, validity time.Duration) (KeyPair, error) {
+	caCert, err := ParseCert(ca.Cert)
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("cannot parse CA certificate: %v", err)
+	}
+	caKey, err := parseKey(ca.Key)
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("cannot parse CA key: %v", err)
+	}
+	notAfter := now.Add(validity)
+	if notAfter.After(caCert.NotAfter) {
+		notAfter = caCert.NotAfter
+	}
+
+	commonName := ""
+	if len(dnsNames) > 0 {
+		commonName = dnsNames[0]
+	}
+	template, err := newTemplate(commonName, now, notAfter)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	template.DNSNames = dnsNames
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	return sign(template, caCert, caKey)
+}
+
+// ParseCert returns the first certificate of a PEM bundle
+func ParseCert(data []byte) (*x509.Certificate, error) {
+	certs, err := ParseCerts(data)
+	if err != nil {
+		return nil, err
+	}
+	return certs[0], nil
+}
+
+// ParseCerts returns every certificate of a PEM bundle
+func ParseCerts(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found")
+	}
+	return certs, nil
+}
+
+// encodeCerts returns the PEM bundle of certs
+func encodeCerts(certs ...*x509.Certificate) []byte {
+	var buf bytes.Buffer
+	for _, cert := range certs {
+		_ = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return buf.Bytes()
+}
+
+func newTemplate(commonName string, notBefore, notAfter time.Time) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate serial number: %v", err)
+	}
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		// tolerate clock skew between the webhook and the API server
+		NotBefore: notBefore.Add(-5 * time.Minute),
+		NotAfter:  notAfter,
+	}, nil
+}
+
+// sign generates a key for template and signs it with parentKey, template is
+// self-signed when parent is nil
+func sign(template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (KeyPair, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("cannot generate key: %v", err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("cannot create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("cannot encode key: %v", err)
+	}
+	return KeyPair{
+		Cert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		Key:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
+
+func parseKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	return ecKey, nil
+}
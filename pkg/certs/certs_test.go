@@ -0,0 +1,150 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestManager(t *testing.T, now *time.Time) (*Manager, *fake.Clientset) {
+	client := fake.NewSimpleClientset(
+		&admissionregistrationv1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "nfs.k8s.com"},
+			Webhooks:   []admissionregistrationv1.ValidatingWebhook{{Name: "nfs.k8s.com"}},
+		},
+		&admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "nfs.k8s.com"},
+			Webhooks:   []admissionregistrationv1.MutatingWebhook{{Name: "nfs.k8s.com"}},
+		},
+	)
+	m := NewManager(client, "nfs", "nfs-tls", "nfs-webhook")
+	m.ValidatingWebhooks = []string{"nfs.k8s.com"}
+	m.MutatingWebhooks = []string{"nfs.k8s.com", "missing"}
+	m.now = func() time.Time { return *now }
+	return m, client
+}
+
+func getSecret(t *testing.T, client *fake.Clientset) *corev1.Secret {
+	secret, err := client.CoreV1().Secrets("nfs").Get(context.Background(), "nfs-tls", metav1.GetOptions{})
+	require.NoError(t, err)
+	return secret
+}
+
+// verify checks that the served certificate is trusted by the CA bundle of the
+// webhook configurations for the service name, at now
+func verify(t *testing.T, m *Manager, client *fake.Clientset, now time.Time) *x509.Certificate {
+	validating, err := client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(context.Background(), "nfs.k8s.com", metav1.GetOptions{})
+	require.NoError(t, err)
+	mutating, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.Background(), "nfs.k8s.com", metav1.GetOptions{})
+	require.NoError(t, err)
+	caBundle := validating.Webhooks[0].ClientConfig.CABundle
+	assert.Equal(t, caBundle, mutating.Webhooks[0].ClientConfig.CABundle)
+
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(caBundle))
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	_, err = leaf.Verify(x509.VerifyOptions{DNSName: "nfs-webhook.nfs.svc", Roots: roots, CurrentTime: now})
+	require.NoError(t, err)
+	return leaf
+}
+
+func TestSync(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	m, client := newTestManager(t, &now)
+	assert.Error(t, m.Ready())
+	_, err := m.GetCertificate(&tls.ClientHelloInfo{})
+	assert.Error(t, err)
+
+	require.NoError(t, m.Sync(context.Background()))
+	assert.NoError(t, m.Ready())
+	secret := getSecret(t, client)
+	assert.Equal(t, corev1.SecretTypeTLS, secret.Type)
+	first := verify(t, m, client, now)
+
+	// nothing is renewed while the certificates are valid
+	now = now.Add(Validity - RenewBefore - time.Hour)
+	require.NoError(t, m.Sync(context.Background()))
+	assert.Equal(t, secret.Data, getSecret(t, client).Data)
+
+	// the serving certificate is renewed with the same CA
+	now = now.Add(2 * time.Hour)
+	require.NoError(t, m.Sync(context.Background()))
+	renewed := getSecret(t, client)
+	assert.Equal(t, secret.Data[corev1.ServiceAccountRootCAKey], renewed.Data[corev1.ServiceAccountRootCAKey])
+	assert.NotEqual(t, secret.Data[corev1.TLSCertKey], renewed.Data[corev1.TLSCertKey])
+	second := verify(t, m, client, now)
+	assert.False(t, first.Equal(second))
+}
+
+func TestSyncRotatesCA(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	m, client := newTestManager(t, &now)
+	m.CAValidity = 90 * 24 * time.Hour
+	require.NoError(t, m.Sync(context.Background()))
+	oldCA, err := ParseCert(getSecret(t, client).Data[corev1.ServiceAccountRootCAKey])
+	require.NoError(t, err)
+
+	// the previous CA stays in the bundle until it expires
+	now = now.Add(70 * 24 * time.Hour)
+	require.NoError(t, m.Sync(context.Background()))
+	bundle, err := ParseCerts(getSecret(t, client).Data[corev1.ServiceAccountRootCAKey])
+	require.NoError(t, err)
+	require.Len(t, bundle, 2)
+	assert.True(t, bundle[1].Equal(oldCA))
+	verify(t, m, client, now)
+
+	now = now.Add(30 * 24 * time.Hour)
+	require.NoError(t, m.Sync(context.Background()))
+	bundle, err = ParseCerts(getSecret(t, client).Data[corev1.ServiceAccountRootCAKey])
+	require.NoError(t, err)
+	assert.Len(t, bundle, 1)
+	verify(t, m, client, now)
+}
+
+func TestSyncReissuesInvalidCertificate(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	m, client := newTestManager(t, &now)
+	require.NoError(t, m.Sync(context.Background()))
+	secret := getSecret(t, client)
+
+	// a certificate issued for other names is replaced, the CA is kept
+	other := NewManager(client, "other", "other-tls", "other")
+	data, _, err := other.renew(nil)
+	require.NoError(t, err)
+	secret.Data[corev1.TLSCertKey] = data[corev1.TLSCertKey]
+	secret.Data[corev1.TLSPrivateKeyKey] = data[corev1.TLSPrivateKeyKey]
+	_, err = client.CoreV1().Secrets("nfs").Update(context.Background(), secret, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, m.Sync(context.Background()))
+	renewed := getSecret(t, client)
+	assert.Equal(t, secret.Data[corev1.ServiceAccountRootCAKey], renewed.Data[corev1.ServiceAccountRootCAKey])
+	assert.NotEqual(t, data[corev1.TLSCertKey], renewed.Data[corev1.TLSCertKey])
+	verify(t, m, client, now)
+}
+
+func TestNewServingCertCappedByCA(t *testing.T) {
+	now := time.Now()
+	ca, err := NewCA("ca", now, time.Hour)
+	require.NoError(t, err)
+	serving, err := NewServingCert(ca, []string{"svc.ns.svc"}, now, Validity)
+	require.NoError(t, err)
+	caCert, err := ParseCert(ca.Cert)
+	require.NoError(t, err)
+	cert, err := ParseCert(serving.Cert)
+	require.NoError(t, err)
+	assert.Equal(t, caCert.NotAfter, cert.NotAfter)
+	assert.Equal(t, []string{"svc.ns.svc"}, cert.DNSNames)
+}
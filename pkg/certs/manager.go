@@ -0,0 +1,273 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// CAKeyKey is the Secret key holding the private key of the CA, the CA bundle
+	// is held by the ca.crt key
+	CAKeyKey = "ca.key"
+
+	// CAValidity, Validity and RenewBefore are the default validity of the CA and of
+	// the serving certificate, and how long before expiry they are renewed
+	CAValidity  = 10 * 365 * 24 * time.Hour
+	Validity    = 365 * 24 * time.Hour
+	RenewBefore = 30 * 24 * time.Hour
+
+	// caCommonName is the common name of the generated CAs
+	caCommonName = "nfs-pod-access-control-ca"
+	// resyncPeriod is the period at which the certificates are checked for renewal
+	resyncPeriod = 10 * time.Minute
+)
+
+// Manager keeps the serving certificate of the webhook in a Secret, renewing it
+// before expiry, and patches the CA bundle into the webhook configurations
+type Manager struct {
+	client kubernetes.Interface
+
+	Namespace  string
+	SecretName string
+	// DNSNames are the names the serving certificate is issued for
+	DNSNames []string
+	// ValidatingWebhooks and MutatingWebhooks are the names of the webhook
+	// configurations whose caBundle is patched
+	ValidatingWebhooks []string
+	MutatingWebhooks   []string
+
+	CAValidity  time.Duration
+	Validity    time.Duration
+	RenewBefore time.Duration
+	Logger      *logrus.Entry
+
+	servingCert
+}
+
+// NewManager returns a Manager issuing the serving certificate of service in
+// namespace, stored in the secretName Secret
+func NewManager(client kubernetes.Interface, namespace, secretName, service string) *Manager {
+	return &Manager{
+		client:     client,
+		Namespace:  namespace,
+		SecretName: secretName,
+		DNSNames: []string{
+			service,
+			service + "." + namespace,
+			service + "." + namespace + ".svc",
+			service + "." + namespace + ".svc.cluster.local",
+		},
+		CAValidity:  CAValidity,
+		Validity:    Validity,
+		RenewBefore: RenewBefore,
+		Logger:      logrus.WithField("component", "certs"),
+		servingCert: servingCert{now: time.Now},
+	}
+}
+
+// Run syncs the certificates every resyncPeriod until stopCh is closed, the
+// first sync should be done with Sync before serving
+func (m *Manager) Run(stopCh <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(resyncPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+			}
+			if err := m.Sync(context.Background()); err != nil {
+				m.Logger.Errorf("cannot sync TLS certificate %s: %v", m.SecretName, err)
+			}
+		}
+	}()
+}
+
+// Sync creates the Secret or renews the certificates it holds when needed, patches
+// the CA bundle into the webhook configurations and loads the serving certificate.
+// Replicas share the Secret: the first one to write it wins and the others use it.
+func (m *Manager) Sync(ctx context.Context) error {
+	secrets := m.client.CoreV1().Secrets(m.Namespace)
+	secret, err := secrets.Get(ctx, m.SecretName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		data, _, err := m.renew(nil)
+		if err != nil {
+			return err
+		}
+		secret, err = secrets.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: m.SecretName, Namespace: m.Namespace},
+			Type:       corev1.SecretTypeTLS,
+			Data:       data,
+		}, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			secret, err = secrets.Get(ctx, m.SecretName, metav1.GetOptions{})
+		}
+		if err != nil {
+			return fmt.Errorf("Error creating Secret %s: %s\n", m.SecretName, err)
+		}
+		m.Logger.Infof("Created TLS certificate Secret %s", m.SecretName)
+	} else if err != nil {
+		return fmt.Errorf("Error getting Secret %s: %s\n", m.SecretName, err)
+	}
+
+	data, changed, err := m.renew(secret.Data)
+	if err != nil {
+		return err
+	}
+	if changed {
+		secret = secret.DeepCopy()
+		secret.Data = data
+		if secret, err = secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("Error updating Secret %s: %s\n", m.SecretName, err)
+		}
+		m.Logger.Infof("Renewed TLS certificate in Secret %s", m.SecretName)
+	}
+
+	// the CA bundle is patched before serving a certificate it may be needed for
+	if err := m.patchWebhooks(ctx, secret.Data[corev1.ServiceAccountRootCAKey]); err != nil {
+		return err
+	}
+	return m.load(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey], m.Logger)
+}
+
+// renew returns the Secret data holding a CA bundle and a serving certificate
+// valid for DNSNames, reusing what data holds unless it is due for renewal, and
+// whether it differs from data
+func (m *Manager) renew(data map[string][]byte) (map[string][]byte, bool, error) {
+	now := m.now()
+	due := func(cert *x509.Certificate) bool {
+		return now.After(cert.NotAfter.Add(-m.RenewBefore))
+	}
+
+	// the current CA comes first in the bundle, the previous ones are trusted until
+	// they expire since other replicas may still serve certificates they signed
+	bundle, _ := ParseCerts(data[corev1.ServiceAccountRootCAKey])
+	ca := KeyPair{Key: data[CAKeyKey]}
+	var caCert *x509.Certificate
+	if len(bundle) > 0 {
+		caCert = bundle[0]
+		ca.Cert = encodeCerts(caCert)
+	}
+	if _, err := tls.X509KeyPair(ca.Cert, ca.Key); caCert == nil || err != nil || due(caCert) {
+		var err error
+		if ca, err = NewCA(caCommonName, now, m.CAValidity); err != nil {
+			return nil, false, err
+		}
+		if caCert, err = ParseCert(ca.Cert); err != nil {
+			return nil, false, err
+		}
+		bundle = append([]*x509.Certificate{caCert}, bundle...)
+	}
+	var trusted []*x509.Certificate
+	for _, cert := range bundle {
+		if now.Before(cert.NotAfter) {
+			trusted = append(trusted, cert)
+		}
+	}
+
+	serving := KeyPair{Cert: data[corev1.TLSCertKey], Key: data[corev1.TLSPrivateKeyKey]}
+	if !m.valid(serving, caCert, due) {
+		var err error
+		if serving, err = NewServingCert(ca, m.DNSNames, now, m.Validity); err != nil {
+			return nil, false, err
+		}
+	}
+
+	renewed := map[string][]byte{
+		corev1.ServiceAccountRootCAKey: encodeCerts(trusted...),
+		CAKeyKey:                       ca.Key,
+		corev1.TLSCertKey:              serving.Cert,
+		corev1.TLSPrivateKeyKey:        serving.Key,
+	}
+	for key, value := range renewed {
+		if !bytes.Equal(value, data[key]) {
+			return renewed, true, nil
+		}
+	}
+	return renewed, false, nil
+}
+
+// valid returns whether serving is signed by ca, covers DNSNames and is not due
+func (m *Manager) valid(serving KeyPair, ca *x509.Certificate, due func(*x509.Certificate) bool) bool {
+	if _, err := tls.X509KeyPair(serving.Cert, serving.Key); err != nil {
+		return false
+	}
+	cert, err := ParseCert(serving.Cert)
+	if err != nil || due(cert) || cert.CheckSignatureFrom(ca) != nil {
+		return false
+	}
+	for _, name := range m.DNSNames {
+		if cert.VerifyHostname(name) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// patchWebhooks sets caBundle as the CA bundle of every webhook of the webhook
+// configurations, missing configurations are skipped
+func (m *Manager) patchWebhooks(ctx context.Context, caBundle []byte) error {
+	validating := m.client.AdmissionregistrationV1().ValidatingWebhookConfigurations()
+	for _, name := range m.ValidatingWebhooks {
+		config, err := validating.Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			m.Logger.Warnf("ValidatingWebhookConfiguration %s not found, its caBundle is not patched", name)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("Error getting ValidatingWebhookConfiguration %s: %s\n", name, err)
+		}
+		changed := false
+		for i := range config.Webhooks {
+			if !bytes.Equal(config.Webhooks[i].ClientConfig.CABundle, caBundle) {
+				config.Webhooks[i].ClientConfig.CABundle = caBundle
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		if _, err := validating.Update(ctx, config, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("Error updating ValidatingWebhookConfiguration %s: %s\n", name, err)
+		}
+		m.Logger.Infof("Patched caBundle of ValidatingWebhookConfiguration %s", name)
+	}
+
+	mutating := m.client.AdmissionregistrationV1().MutatingWebhookConfigurations()
+	for _, name := range m.MutatingWebhooks {
+		config, err := mutating.Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			m.Logger.Warnf("MutatingWebhookConfiguration %s not found, its caBundle is not patched", name)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("Error getting MutatingWebhookConfiguration %s: %s\n", name, err)
+		}
+		changed := false
+		for i := range config.Webhooks {
+			if !bytes.Equal(config.Webhooks[i].ClientConfig.CABundle, caBundle) {
+				config.Webhooks[i].ClientConfig.CABundle = caBundle
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		if _, err := mutating.Update(ctx, config, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("Error updating MutatingWebhookConfiguration %s: %s\n", name, err)
+		}
+		m.Logger.Infof("Patched caBundle of MutatingWebhookConfiguration %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package certs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// Reloader serves the certificate of a mounted Secret, e.g. issued by
+// cert-manager, and loads it again whenever the Secret is updated
+type Reloader struct {
+	certFile string
+	keyFile  string
+	Logger   *logrus.Entry
+	servingCert
+}
+
+// NewReloader returns a Reloader serving the certificate and key of certFile
+// and keyFile, which are loaded right away
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{
+		certFile:    certFile,
+		keyFile:     keyFile,
+		Logger:      logrus.WithField("component", "certs"),
+		servingCert: servingCert{now: time.Now},
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the certificate and key files, the previous certificate is still
+// served if they can't be loaded
+func (r *Reloader) Reload() error {
+	certPEM, err := os.ReadFile(r.certFile)
+	if err != nil {
+		return fmt.Errorf("cannot read TLS certificate: %v", err)
+	}
+	keyPEM, err := os.ReadFile(r.keyFile)
+	if err != nil {
+		return fmt.Errorf("cannot read TLS key: %v", err)
+	}
+	return r.load(certPEM, keyPEM, r.Logger)
+}
+
+// Run watches the directories of the certificate and key files until stopCh is
+// closed. The kubelet updates Secret volumes by swapping the symlink of their
+// ..data directory, so any change in the directories triggers a reload.
+func (r *Reloader) Run(stopCh <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("cannot watch TLS certificate: %v", err)
+	}
+	for _, dir := range []string{filepath.Dir(r.certFile), filepath.Dir(r.keyFile)} {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("cannot watch %s: %v", dir, err)
+		}
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op == fsnotify.Chmod {
+					continue
+				}
+				if err := r.Reload(); err != nil {
+					// the files may be half written, the next event reloads them
+					r.Logger.Debugf("cannot reload TLS certificate after %s: %v", event, err)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				r.Logger.Errorf("error watching TLS certificate: %v", err)
+			}
+		}
+	}()
+	return nil
+}
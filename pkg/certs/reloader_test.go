@@ -0,0 +1,70 @@
+package certs
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSecretVolume writes pair like the kubelet updates Secret volumes: into a
+// new directory atomically swapped with the ..data symlink
+func writeSecretVolume(t *testing.T, dir string, pair KeyPair) {
+	data, err := os.MkdirTemp(dir, "..data_")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(data, "tls.crt"), pair.Cert, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(data, "tls.key"), pair.Key, 0o600))
+
+	tmp := filepath.Join(dir, "..data_tmp")
+	require.NoError(t, os.Symlink(filepath.Base(data), tmp))
+	require.NoError(t, os.Rename(tmp, filepath.Join(dir, "..data")))
+	for _, name := range []string{"tls.crt", "tls.key"} {
+		if _, err := os.Lstat(filepath.Join(dir, name)); os.IsNotExist(err) {
+			require.NoError(t, os.Symlink(filepath.Join("..data", name), filepath.Join(dir, name)))
+		}
+	}
+}
+
+func newServingPair(t *testing.T) KeyPair {
+	ca, err := NewCA("ca", time.Now(), time.Hour)
+	require.NoError(t, err)
+	pair, err := NewServingCert(ca, []string{"svc.ns.svc"}, time.Now(), time.Hour)
+	require.NoError(t, err)
+	return pair
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	_, err := NewReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+	assert.Error(t, err)
+
+	first := newServingPair(t)
+	writeSecretVolume(t, dir, first)
+	r, err := NewReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+	require.NoError(t, err)
+	assert.NoError(t, r.Ready())
+	stop := make(chan struct{})
+	defer close(stop)
+	require.NoError(t, r.Run(stop))
+
+	served := func() []byte {
+		cert, err := r.GetCertificate(&tls.ClientHelloInfo{})
+		require.NoError(t, err)
+		return cert.Certificate[0]
+	}
+	firstCert, err := ParseCert(first.Cert)
+	require.NoError(t, err)
+	assert.Equal(t, firstCert.Raw, served())
+
+	second := newServingPair(t)
+	secondCert, err := ParseCert(second.Cert)
+	require.NoError(t, err)
+	writeSecretVolume(t, dir, second)
+	assert.Eventually(t, func() bool {
+		return string(served()) == string(secondCert.Raw)
+	}, 5*time.Second, 10*time.Millisecond)
+}
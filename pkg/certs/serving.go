@@ -0,0 +1,69 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// servingCert holds the serving certificate, swapped whenever it is renewed
+type servingCert struct {
+	now func() time.Time
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	leaf *x509.Certificate
+}
+
+// load makes the PEM encoded certPEM and keyPEM the served certificate
+func (s *servingCert) load(certPEM, keyPEM []byte, logger *logrus.Entry) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("cannot load TLS certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("cannot parse TLS certificate: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.leaf == nil || !s.leaf.Equal(leaf) {
+		logger.Infof("Serving TLS certificate %s valid until %s", leaf.SerialNumber, leaf.NotAfter)
+	}
+	s.cert, s.leaf = &cert, leaf
+	return nil
+}
+
+// GetCertificate returns the serving certificate, to be used as the
+// GetCertificate function of a tls.Config
+func (s *servingCert) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.cert == nil {
+		return nil, fmt.Errorf("no TLS certificate loaded")
+	}
+	return s.cert, nil
+}
+
+// Ready returns an error until a serving certificate valid at the current time
+// is loaded
+func (s *servingCert) Ready() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.leaf == nil {
+		return fmt.Errorf("no TLS certificate loaded")
+	}
+	now := s.now()
+	if now.Before(s.leaf.NotBefore) {
+		return fmt.Errorf("TLS certificate not valid before %s", s.leaf.NotBefore)
+	}
+	if now.After(s.leaf.NotAfter) {
+		return fmt.Errorf("TLS certificate expired on %s", s.leaf.NotAfter)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// TLSOptions are the TLS parameters of the admission server
+type TLSOptions struct {
+	// MinVersion is the minimum TLS version, 1.2 or 1.3, 1.2 when empty
+	MinVersion string
+	// CipherSuites are the IANA names of the TLS 1.2 cipher suites allowed, the
+	// secure suites of Go when empty. TLS 1.3 suites are not configurable.
+	CipherSuites []string
+	// ClientCAFile is the CA bundle the client certificates of the API server are
+	// verified against, no client certificate is requested when empty
+	ClientCAFile string
+}
+
+// ParseMinVersion returns the TLS version of 1.2 or 1.3, 1.2 when empty
+func ParseMinVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("invalid TLS minimum version %q, expected 1.2 or 1.3", version)
+	}
+}
+
+// ParseCipherSuites returns the IDs of the cipher suites of the given IANA names,
+// e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, only secure suites are accepted
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	secure := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		secure[suite.Name] = suite.ID
+	}
+	insecure := make(map[string]bool)
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.Name] = true
+	}
+
+	var ids []uint16
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		id, ok := secure[name]
+		if !ok {
+			if insecure[name] {
+				return nil, fmt.Errorf("insecure cipher suite %s", name)
+			}
+			return nil, fmt.Errorf("unknown cipher suite %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ServerConfig returns the TLS configuration of the admission server serving the
+// certificate of getCertificate with opts. Client certificates are verified
+// against the ClientCAFile of opts when presented, RequireClientCert rejecting the
+// requests without one, so that probes of the kubelet still succeed.
+func ServerConfig(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error), opts TLSOptions) (*tls.Config, error) {
+	minVersion, err := ParseMinVersion(opts.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	suites, err := ParseCipherSuites(opts.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		GetCertificate: getCertificate,
+		MinVersion:     minVersion,
+		CipherSuites:   suites,
+	}
+	if opts.ClientCAFile != "" {
+		data, err := os.ReadFile(opts.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read client CA: %v", err)
+		}
+		cas, err := ParseCerts(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse client CA: %v", err)
+		}
+		config.ClientCAs = x509.NewCertPool()
+		for _, ca := range cas {
+			config.ClientCAs.AddCert(ca)
+		}
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+// RequireClientCert rejects the requests without a verified client certificate
+// when the server verifies them, i.e. when config has ClientCAs
+func RequireClientCert(config *tls.Config, next http.HandlerFunc) http.HandlerFunc {
+	if config == nil || config.ClientCAs == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,95 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCipherSuites(t *testing.T) {
+	ids, err := ParseCipherSuites([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", " TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}, ids)
+	}
+	_, err = ParseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"})
+	assert.EqualError(t, err, "insecure cipher suite TLS_RSA_WITH_RC4_128_SHA")
+	_, err = ParseCipherSuites([]string{"TLS_UNKNOWN"})
+	assert.EqualError(t, err, "unknown cipher suite TLS_UNKNOWN")
+
+	version, err := ParseMinVersion("1.3")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), version)
+	_, err = ParseMinVersion("1.1")
+	assert.Error(t, err)
+}
+
+func TestRequireClientCert(t *testing.T) {
+	now := time.Now()
+	ca, err := NewCA("nfs-pod-access-control-ca", now, time.Hour)
+	require.NoError(t, err)
+	serving, err := NewServingCert(ca, []string{"nfs-webhook.nfs.svc"}, now, time.Hour)
+	require.NoError(t, err)
+	clientCA, err := NewCA("apiserver-client-ca", now, time.Hour)
+	require.NoError(t, err)
+	client := newClientCert(t, clientCA, now)
+	caFile := filepath.Join(t.TempDir(), "client-ca.crt")
+	require.NoError(t, os.WriteFile(caFile, clientCA.Cert, 0o600))
+
+	cert, err := tls.X509KeyPair(serving.Cert, serving.Key)
+	require.NoError(t, err)
+	config, err := ServerConfig(func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return &cert, nil },
+		TLSOptions{MinVersion: "1.3", ClientCAFile: caFile})
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/validate-pods", RequireClientCert(config, func(w http.ResponseWriter, r *http.Request) {}))
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewUnstartedServer(mux)
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.Cert)
+	get := func(path string, certs ...tls.Certificate) int {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "nfs-webhook.nfs.svc", Certificates: certs}}}
+		res, err := c.Get(server.URL + path)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	// probes don't present a client certificate
+	assert.Equal(t, http.StatusOK, get("/readyz"))
+	assert.Equal(t, http.StatusUnauthorized, get("/validate-pods"))
+	assert.Equal(t, http.StatusOK, get("/validate-pods", client))
+
+	// TLS 1.2 clients are rejected
+	c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "nfs-webhook.nfs.svc", MaxVersion: tls.VersionTLS12}}}
+	_, err = c.Get(server.URL + "/readyz")
+	assert.Error(t, err)
+}
+
+// newClientCert returns a client certificate signed by ca
+func newClientCert(t *testing.T, ca KeyPair, now time.Time) tls.Certificate {
+	caCert, err := ParseCert(ca.Cert)
+	require.NoError(t, err)
+	caKey, err := parseKey(ca.Key)
+	require.NoError(t, err)
+	template, err := newTemplate("kube-apiserver", now, now.Add(time.Hour))
+	require.NoError(t, err)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	pair, err := sign(template, caCert, caKey)
+	require.NoError(t, err)
+	cert, err := tls.X509KeyPair(pair.Cert, pair.Key)
+	require.NoError(t, err)
+	return cert
+}
@@ -0,0 +1,205 @@
+// Package collision detects UIDs mapped to several users and serviceAccounts,
+// which share the ownership of their files on the NFS share and defeat the
+// isolation the webhook enforces
+package collision
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/events"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/metrics"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+)
+
+// resyncPeriod is the period at which the mappings are checked even without changes
+const resyncPeriod = 10 * time.Minute
+
+// Collision is a range of UIDs mapped to two subjects
+type Collision struct {
+	// Subjects are the two subjects, sorted
+	Subjects [2]string
+	// UIDs is the range of UIDs both subjects are mapped to
+	UIDs mapping.IDRange
+}
+
+// String describes the collision
+func (c Collision) String() string {
+	if c.UIDs.Min == c.UIDs.Max {
+		return fmt.Sprintf("UID %d is mapped to both %s and %s", c.UIDs.Min, c.Subjects[0], c.Subjects[1])
+	}
+	return fmt.Sprintf("UIDs %d-%d are mapped to both %s and %s", c.UIDs.Min, c.UIDs.Max, c.Subjects[0], c.Subjects[1])
+}
+
+// Detect returns the collisions between the UIDs of subjects, sorted by UID
+func Detect(uids map[string]mapping.IDRanges) []Collision {
+	type entry struct {
+		subject string
+		uids    mapping.IDRange
+	}
+	var entries []entry
+	for subject, ranges := range uids {
+		for _, r := range ranges {
+			entries = append(entries, entry{subject: subject, uids: r})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].uids.Min != entries[j].uids.Min {
+			return entries[i].uids.Min < entries[j].uids.Min
+		}
+		return entries[i].subject < entries[j].subject
+	})
+
+	// sweep the ranges by lowest UID, active holds the ranges still overlapping
+	var collisions []Collision
+	var active []entry
+	for _, e := range entries {
+		kept := active[:0]
+		for _, a := range active {
+			if a.uids.Max >= e.uids.Min {
+				kept = append(kept, a)
+			}
+		}
+		active = kept
+
+		for _, a := range active {
+			if a.subject == e.subject {
+				continue
+			}
+			c := Collision{Subjects: [2]string{a.subject, e.subject}, UIDs: mapping.IDRange{Min: e.uids.Min, Max: min(a.uids.Max, e.uids.Max)}}
+			if c.Subjects[0] > c.Subjects[1] {
+				c.Subjects[0], c.Subjects[1] = c.Subjects[1], c.Subjects[0]
+			}
+			collisions = append(collisions, c)
+		}
+		active = append(active, e)
+	}
+	return collisions
+}
+
+// Detector checks the mappings for collisions whenever they change, reporting
+// them in the logs, the uid_collisions metric and Events
+type Detector struct {
+	mappings *mapping.Store
+
+	Logger *logrus.Entry
+	// Events emits an Event attached to the UID mapping object for every new
+	// collision, nil disables them
+	Events *events.Recorder
+
+	mu         sync.RWMutex
+	collisions []Collision
+}
+
+// NewDetector returns a Detector checking mappings
+func NewDetector(mappings *mapping.Store) *Detector {
+	return &Detector{
+		mappings: mappings,
+		Logger:   logrus.WithField("component", "collision"),
+	}
+}
+
+// Run checks the mappings on every mapping change and every resyncPeriod until
+// stopCh is closed, failures are logged and retried on the next change or resync.
+// The first check should be done with Sync at startup.
+func (d *Detector) Run(stopCh <-chan struct{}) error {
+	changed := make(chan struct{}, 1)
+	err := d.mappings.OnChange(func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(resyncPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-changed:
+			case <-ticker.C:
+			}
+			if err := d.Sync(context.Background()); err != nil {
+				d.Logger.Errorf("cannot check UID collisions: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Sync checks the UIDs of every user and serviceAccount of the mappings, group
+// mappings being meant to be shared
+func (d *Detector) Sync(_ context.Context) error {
+	subjects, err := d.mappings.Subjects()
+	if err != nil {
+		return err
+	}
+	uids := make(map[string]mapping.IDRanges, len(subjects))
+	for _, subject := range subjects {
+		if strings.HasPrefix(subject, resolver.GroupSubjectPrefix) {
+			continue
+		}
+		ranges, found, err := d.mappings.UIDs(subject)
+		if err != nil {
+			return err
+		}
+		if found {
+			uids[subject] = ranges
+		}
+	}
+	collisions := Detect(uids)
+
+	d.mu.Lock()
+	previous := d.collisions
+	d.collisions = collisions
+	d.mu.Unlock()
+	metrics.SetUIDCollisions(len(collisions))
+	if reflect.DeepEqual(previous, collisions) {
+		return nil
+	}
+
+	known := make(map[Collision]bool, len(previous))
+	for _, c := range previous {
+		known[c] = true
+	}
+	source := d.mappings.Source()
+	for _, c := range collisions {
+		if known[c] {
+			continue
+		}
+		d.Logger.Warn(c.String())
+		if d.Events != nil {
+			d.Events.UIDCollision(source.Kind, source.Namespace, source.UIDName, c.String())
+		}
+	}
+	if len(collisions) == 0 && len(previous) > 0 {
+		d.Logger.Info("UID collisions resolved")
+	}
+	return nil
+}
+
+// Collisions returns the description of the collisions of subject
+func (d *Detector) Collisions(subject string) []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var descriptions []string
+	for _, c := range d.collisions {
+		if c.Subjects[0] == subject || c.Subjects[1] == subject {
+			descriptions = append(descriptions, c.String())
+		}
+	}
+	return descriptions
+}
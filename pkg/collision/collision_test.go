@@ -0,0 +1,79 @@
+package collision
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDetect(t *testing.T) {
+	parse := func(value string) mapping.IDRanges {
+		ranges, err := mapping.ParseIDRanges(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ranges
+	}
+
+	tests := []struct {
+		name string
+		uids map[string]mapping.IDRanges
+		want []Collision
+	}{
+		{name: "no collision", uids: map[string]mapping.IDRanges{"user1": parse("1001"), "user2": parse("1002,2000-2099")}},
+		{name: "own ranges", uids: map[string]mapping.IDRanges{"user1": parse("1000-1999,1500")}},
+		{
+			name: "shared UID",
+			uids: map[string]mapping.IDRanges{"user2": parse("1001"), "user1": parse("1001")},
+			want: []Collision{{Subjects: [2]string{"user1", "user2"}, UIDs: mapping.IDRange{Min: 1001, Max: 1001}}},
+		},
+		{
+			name: "overlapping ranges",
+			uids: map[string]mapping.IDRanges{"user1": parse("1000-1999"), "user2": parse("1500-2499"), "user3": parse("1999,3000")},
+			want: []Collision{
+				{Subjects: [2]string{"user1", "user2"}, UIDs: mapping.IDRange{Min: 1500, Max: 1999}},
+				{Subjects: [2]string{"user1", "user3"}, UIDs: mapping.IDRange{Min: 1999, Max: 1999}},
+				{Subjects: [2]string{"user2", "user3"}, UIDs: mapping.IDRange{Min: 1999, Max: 1999}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Detect(tt.uids), tt.name)
+	}
+
+	c := Collision{Subjects: [2]string{"user1", "user2"}, UIDs: mapping.IDRange{Min: 1500, Max: 1999}}
+	assert.Equal(t, "UIDs 1500-1999 are mapped to both user1 and user2", c.String())
+}
+
+func TestDetectorSync(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: mapping.UIDConfigMapName, Namespace: "nfs"},
+		Data: map[string]string{
+			"user1": "1001",
+			"user2": "1001",
+			"user3": "1003",
+			// group mappings are meant to be shared
+			"group.eng": "1000-1099",
+		},
+	})
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	s := mapping.NewStore(client, "nfs")
+	if err := s.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDetector(s)
+	assert.NoError(t, d.Sync(context.Background()))
+
+	assert.Equal(t, []string{"UID 1001 is mapped to both user1 and user2"}, d.Collisions("user1"))
+	assert.Equal(t, []string{"UID 1001 is mapped to both user1 and user2"}, d.Collisions("user2"))
+	assert.Empty(t, d.Collisions("user3"))
+	assert.Empty(t, d.Collisions("group.eng"))
+}
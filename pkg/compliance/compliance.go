@@ -0,0 +1,318 @@
+// Package compliance re-evaluates the running pods mounting NFS against the
+// current policy and mappings, since admission only validates pods when they are
+// created and mapping changes leave the pods admitted before running
+package compliance
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/apis/nfsaccess/v1alpha1"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/events"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/metrics"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/nfs"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/report"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/validation"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// DefaultInterval is the default period of the scans
+	DefaultInterval = time.Hour
+	// ReportKey is the key of the report in the report ConfigMap
+	ReportKey = "report.yaml"
+
+	// listLimit is the number of pods listed per page
+	listLimit = 500
+)
+
+// Violation is a running pod the current policy and mappings would deny
+type Violation struct {
+	Namespace      string            `json:"namespace"`
+	Pod            string            `json:"pod"`
+	ServiceAccount string            `json:"serviceAccount"`
+	Validator      string            `json:"validator"`
+	Code           string            `json:"code"`
+	Reason         string            `json:"reason"`
+	Details        map[string]string `json:"details,omitempty"`
+	// Since is the first scan the violation was found by
+	Since metav1.Time `json:"since"`
+
+	uid types.UID
+}
+
+// Report is the outcome of a scan, written to the report ConfigMap
+type Report struct {
+	ScannedAt metav1.Time `json:"scannedAt"`
+	// Pods is the number of running pods mounting NFS evaluated
+	Pods       int         `json:"pods"`
+	Violations []Violation `json:"violations"`
+}
+
+// Scanner periodically evaluates the running pods mounting NFS with the
+// validators of the webhook. Pods are evaluated as created by their
+// serviceAccount, since the requester that created them is not known anymore.
+type Scanner struct {
+	client    kubernetes.Interface
+	detector  *nfs.Detector
+	validator func(*logrus.Entry) *validation.Validator
+
+	// Interval is the period of the scans
+	Interval time.Duration
+	// Scope tells whether the pods of a namespace are evaluated, nil evaluates
+	// every namespace
+	Scope func(namespace string) bool
+	// ReportNamespace and ReportName name the ConfigMap the report of the last
+	// scan is written to, an empty ReportName disables it
+	ReportNamespace, ReportName string
+	// Events emits an Event attached to every pod found in violation, nil
+	// disables them
+	Events *events.Recorder
+	// Reports records the violations in the NFSAccessReport of their namespace,
+	// nil disables them
+	Reports *report.Writer
+	// Remediator annotates or evicts the pods in violation for longer than its
+	// grace period, nil disables remediation
+	Remediator *Remediator
+	Logger     *logrus.Entry
+
+	mu         sync.Mutex
+	violations map[types.UID]Violation
+}
+
+// NewScanner returns a Scanner evaluating the pods mounting the NFS volumes of
+// detector with the validators returned by validator
+func NewScanner(client kubernetes.Interface, detector *nfs.Detector, validator func(*logrus.Entry) *validation.Validator) *Scanner {
+	return &Scanner{
+		client:     client,
+		detector:   detector,
+		validator:  validator,
+		Interval:   DefaultInterval,
+		Logger:     logrus.WithField("component", "compliance"),
+		violations: map[types.UID]Violation{},
+	}
+}
+
+// Run scans the running pods right away and then every Interval until stopCh is
+// closed, failures are logged and retried on the next scan
+func (s *Scanner) Run(stopCh <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+		for {
+			if _, err := s.Scan(context.Background()); err != nil {
+				s.Logger.Errorf("cannot scan running pods: %v", err)
+			}
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Scan evaluates the running pods mounting NFS, records the violations in the
+// noncompliant_pods metric and the report, and emits an Event about every pod
+// newly found in violation
+func (s *Scanner) Scan(ctx context.Context) (*Report, error) {
+	report := &Report{ScannedAt: metav1.Now(), Violations: []Violation{}}
+	options := metav1.ListOptions{FieldSelector: "status.phase=Running", Limit: listLimit}
+	var pods []corev1.Pod
+	for {
+		list, err := s.client.CoreV1().Pods("").List(ctx, options)
+		if err != nil {
+			return nil, fmt.Errorf("Error listing pods: %s\n", err)
+		}
+		pods = append(pods, list.Items...)
+		if list.Continue == "" {
+			break
+		}
+		options.Continue = list.Continue
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	violations := map[types.UID]Violation{}
+	var violating []*corev1.Pod
+	for i := range pods {
+		pod := &pods[i]
+		if s.Scope != nil && !s.Scope(pod.Namespace) {
+			continue
+		}
+		if nfs, _ := s.detector.MountsNFS(ctx, pod, pod.Namespace); !nfs {
+			continue
+		}
+		report.Pods++
+
+		denied, err := s.evaluate(ctx, pod)
+		if err != nil {
+			s.Logger.Warnf("cannot evaluate pod %s/%s: %v", pod.Namespace, pod.Name, err)
+			continue
+		}
+		if len(denied) == 0 {
+			continue
+		}
+		violating = append(violating, pod)
+		previous, known := s.violations[pod.UID]
+		for _, d := range denied {
+			v := Violation{
+				Namespace:      pod.Namespace,
+				Pod:            pod.Name,
+				ServiceAccount: pod.Spec.ServiceAccountName,
+				Validator:      d.Validator,
+				Code:           d.Code,
+				Reason:         strings.TrimSpace(d.Reason),
+				Details:        d.Details,
+				Since:          report.ScannedAt,
+				uid:            pod.UID,
+			}
+			if known {
+				v.Since = previous.Since
+			}
+			report.Violations = append(report.Violations, v)
+			violations[pod.UID] = v
+		}
+		if !known {
+			s.Logger.WithFields(logrus.Fields{
+				"namespace": pod.Namespace,
+				"pod":       pod.Name,
+				"validator": denied[0].Validator,
+			}).Warn("running pod would be rejected: ", strings.TrimSpace(denied[0].Reason))
+			if s.Events != nil {
+				s.Events.NonCompliant(pod, denied[0].Reason)
+			}
+		}
+	}
+	s.violations = violations
+	if s.Remediator != nil {
+		s.Remediator.remediate(ctx, violating, violations, report.ScannedAt.Time)
+	}
+
+	sort.SliceStable(report.Violations, func(i, j int) bool {
+		a, b := report.Violations[i], report.Violations[j]
+		return a.Namespace+"/"+a.Pod < b.Namespace+"/"+b.Pod
+	})
+	byValidator := map[string]int{}
+	counted := map[types.UID]map[string]bool{}
+	for _, v := range report.Violations {
+		if counted[v.uid] == nil {
+			counted[v.uid] = map[string]bool{}
+		}
+		if !counted[v.uid][v.Validator] {
+			counted[v.uid][v.Validator] = true
+			byValidator[v.Validator]++
+		}
+	}
+	metrics.SetNonCompliantPods(byValidator)
+	if s.Reports != nil {
+		s.Reports.Scanned(report.ScannedAt, results(report))
+	}
+
+	if err := s.writeReport(ctx, report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// results converts the violations of report into NFSAccessReport results, by
+// namespace
+func results(report *Report) map[string][]v1alpha1.NFSAccessReportResult {
+	byNamespace := map[string][]v1alpha1.NFSAccessReportResult{}
+	for _, v := range report.Violations {
+		serviceAccount := v.ServiceAccount
+		if serviceAccount == "" {
+			serviceAccount = "default"
+		}
+		byNamespace[v.Namespace] = append(byNamespace[v.Namespace], v1alpha1.NFSAccessReportResult{
+			Type:      v1alpha1.ResultViolation,
+			Subject:   fmt.Sprintf("system:serviceaccount:%s:%s", v.Namespace, serviceAccount),
+			Pod:       v.Pod,
+			Validator: v.Validator,
+			Code:      v.Code,
+			Reason:    v.Reason,
+			Count:     1,
+			FirstSeen: v.Since,
+			LastSeen:  report.ScannedAt,
+		})
+	}
+	return byNamespace
+}
+
+// evaluate returns the denials of pod by the validators, evaluated as created by
+// its serviceAccount with every denial collected
+func (s *Scanner) evaluate(ctx context.Context, pod *corev1.Pod) ([]validation.Finding, error) {
+	serviceAccount := pod.Spec.ServiceAccountName
+	if serviceAccount == "" {
+		serviceAccount = "default"
+	}
+	request := &admissionv1.AdmissionRequest{
+		UID:       types.UID("compliance-" + string(pod.UID)),
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+		Name:      pod.Name,
+		Namespace: pod.Namespace,
+		Operation: admissionv1.Create,
+		UserInfo:  authenticationv1.UserInfo{Username: fmt.Sprintf("system:serviceaccount:%s:%s", pod.Namespace, serviceAccount)},
+	}
+
+	v := s.validator(s.Logger.WithFields(logrus.Fields{"namespace": pod.Namespace, "pod": pod.Name}))
+	v.Policy.Aggregation = validation.AggregateAll
+	// time windows restrict the creation of pods, not running ones
+	v.Policy.TimeWindows = nil
+	val, err := v.ValidatePod(ctx, pod, request)
+	if err != nil {
+		return nil, err
+	}
+	if val.Valid {
+		return nil, nil
+	}
+	if len(val.Denied) == 0 {
+		return []validation.Finding{{Validator: val.Validator, Reason: val.Reason, Code: val.Code, Details: val.Details}}, nil
+	}
+	return val.Denied, nil
+}
+
+// writeReport writes report to the report ConfigMap, created if needed
+func (s *Scanner) writeReport(ctx context.Context, report *Report) error {
+	if s.ReportName == "" {
+		return nil
+	}
+	data, err := yaml.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	configMaps := s.client.CoreV1().ConfigMaps(s.ReportNamespace)
+	configMap, err := configMaps.Get(ctx, s.ReportName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: s.ReportName, Namespace: s.ReportNamespace},
+			Data:       map[string]string{ReportKey: string(data)},
+		}
+		if _, err := configMaps.Create(ctx, configMap, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("Error creating ConfigMap: %s\n", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error getting ConfigMap: %s\n", err)
+	}
+	configMap.Data = map[string]string{ReportKey: string(data)}
+	if _, err := configMaps.Update(ctx, configMap, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("Error updating ConfigMap: %s\n", err)
+	}
+	return nil
+}
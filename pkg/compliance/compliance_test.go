@@ -0,0 +1,93 @@
+package compliance
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/nfs"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/validation"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/yaml"
+)
+
+// uidResolver maps every subject to the same UID and GID
+type uidResolver int64
+
+func (r uidResolver) Resolve(context.Context, string) (resolver.IdentitySpec, error) {
+	uid := int64(r)
+	return resolver.IdentitySpec{UID: &uid, GIDs: []int64{uid}}, nil
+}
+
+func TestScan(t *testing.T) {
+	pod := func(name string, uid int64, nfsVolume bool) *corev1.Pod {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team-a", UID: types.UID(name)},
+			Spec: corev1.PodSpec{
+				ServiceAccountName: "builder",
+				SecurityContext:    &corev1.PodSecurityContext{RunAsUser: &uid},
+			},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+		if nfsVolume {
+			p.Spec.Volumes = []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{NFS: &corev1.NFSVolumeSource{Server: "nfs", Path: "/data"}}}}
+		}
+		return p
+	}
+	client := fake.NewSimpleClientset(
+		pod("compliant", 1001, true),
+		pod("stale", 2000, true),
+		pod("no-nfs", 2000, false),
+	)
+	stop := make(chan struct{})
+	defer close(stop)
+	detector := nfs.NewDetector(client)
+	if err := detector.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewScanner(client, detector, func(logger *logrus.Entry) *validation.Validator {
+		return validation.NewValidator(logger, validation.Policy{}, uidResolver(1001))
+	})
+	s.ReportNamespace, s.ReportName = "nfs", "compliance-report"
+
+	report, err := s.Scan(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Pods)
+	if assert.Len(t, report.Violations, 1) {
+		v := report.Violations[0]
+		assert.Equal(t, "stale", v.Pod)
+		assert.Equal(t, "builder", v.ServiceAccount)
+		assert.Equal(t, "uid_validator", v.Validator)
+		assert.Equal(t, "UIDMismatch", v.Code)
+		assert.Equal(t, "2000", v.Details["foundUID"])
+	}
+
+	// violations keep the time they were first found at
+	since := report.Violations[0].Since
+	report, err = s.Scan(context.TODO())
+	assert.NoError(t, err)
+	if assert.Len(t, report.Violations, 1) {
+		assert.Equal(t, since, report.Violations[0].Since)
+	}
+
+	cm, err := client.CoreV1().ConfigMaps("nfs").Get(context.TODO(), "compliance-report", metav1.GetOptions{})
+	if assert.NoError(t, err) {
+		var written Report
+		assert.NoError(t, yaml.Unmarshal([]byte(cm.Data[ReportKey]), &written))
+		assert.Equal(t, 2, written.Pods)
+		assert.Len(t, written.Violations, 1)
+	}
+
+	// out of scope namespaces are skipped
+	s.Scope = func(namespace string) bool { return namespace != "team-a" }
+	report, err = s.Scan(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, report.Pods)
+	assert.Empty(t, report.Violations)
+}
@@ -0,0 +1,149 @@
+package compliance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/events"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// RemediateLabel opts the pods of a namespace in remediation when set to
+	// "true" on the namespace
+	RemediateLabel = "nfs-access-control/remediate"
+	// NonCompliantAnnotation is set by the annotate action on the pods in
+	// violation, to the reason of the violation
+	NonCompliantAnnotation = "nfs-access-control/noncompliant"
+
+	// ActionAnnotate marks the pods in violation with NonCompliantAnnotation
+	ActionAnnotate = "annotate"
+	// ActionEvict evicts the pods in violation, honoring their
+	// PodDisruptionBudgets
+	ActionEvict = "evict"
+
+	// DefaultGracePeriod is the default time pods may run in violation before
+	// being remediated
+	DefaultGracePeriod = 24 * time.Hour
+)
+
+// Remediator annotates or evicts the running pods of the opted-in namespaces
+// that have been in violation for longer than a grace period, enforcing the
+// current policy and mappings on the pods admitted before they changed
+type Remediator struct {
+	client kubernetes.Interface
+	action string
+
+	// GracePeriod is the time pods may run in violation before being remediated
+	GracePeriod time.Duration
+	// Events emits an Event attached to the workload of every remediated pod,
+	// nil disables them
+	Events *events.Recorder
+	Logger *logrus.Entry
+}
+
+// NewRemediator returns a Remediator applying action, either ActionAnnotate or
+// ActionEvict
+func NewRemediator(client kubernetes.Interface, action string) (*Remediator, error) {
+	if action != ActionAnnotate && action != ActionEvict {
+		return nil, fmt.Errorf("unknown remediation action %q, expected %s or %s", action, ActionAnnotate, ActionEvict)
+	}
+	return &Remediator{
+		client:      client,
+		action:      action,
+		GracePeriod: DefaultGracePeriod,
+		Logger:      logrus.WithField("component", "remediation"),
+	}, nil
+}
+
+// remediate applies the action to the pods whose violation is older than the
+// grace period at now, if their namespace is opted in. Pods whose eviction is
+// refused by a PodDisruptionBudget are retried on the next scan.
+func (r *Remediator) remediate(ctx context.Context, pods []*corev1.Pod, violations map[types.UID]Violation, now time.Time) {
+	optedIn := map[string]bool{}
+	for _, pod := range pods {
+		v := violations[pod.UID]
+		if now.Sub(v.Since.Time) < r.GracePeriod {
+			continue
+		}
+		enabled, checked := optedIn[pod.Namespace]
+		if !checked {
+			enabled = r.optedIn(ctx, pod.Namespace)
+			optedIn[pod.Namespace] = enabled
+		}
+		if !enabled {
+			continue
+		}
+
+		logger := r.Logger.WithFields(logrus.Fields{"namespace": pod.Namespace, "pod": pod.Name, "action": r.action})
+		var err error
+		switch r.action {
+		case ActionAnnotate:
+			if pod.Annotations[NonCompliantAnnotation] == v.Reason {
+				continue
+			}
+			err = r.annotate(ctx, pod, v.Reason)
+		case ActionEvict:
+			err = r.evict(ctx, pod)
+		}
+		switch {
+		case apierrors.IsTooManyRequests(err):
+			logger.Info("eviction blocked by a PodDisruptionBudget, retrying on the next scan")
+			metrics.ObserveRemediation(r.action, "blocked")
+		case err != nil:
+			logger.Errorf("cannot remediate pod: %v", err)
+			metrics.ObserveRemediation(r.action, "error")
+		default:
+			logger.Warn("remediated pod in violation since ", v.Since.Format(time.RFC3339), ": ", v.Reason)
+			metrics.ObserveRemediation(r.action, "done")
+			if r.Events != nil {
+				r.Events.Remediated(ctx, pod, r.action, v.Reason)
+			}
+		}
+	}
+}
+
+// optedIn tells whether namespace carries the RemediateLabel
+func (r *Remediator) optedIn(ctx context.Context, namespace string) bool {
+	ns, err := r.client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err != nil {
+		r.Logger.Warnf("Error getting namespace %s: %s", namespace, err)
+		return false
+	}
+	return ns.Labels[RemediateLabel] == "true"
+}
+
+// annotate sets the NonCompliantAnnotation of pod to reason
+func (r *Remediator) annotate(ctx context.Context, pod *corev1.Pod, reason string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{NonCompliantAnnotation: reason},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.client.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// evict evicts pod through the Eviction API, which refuses evictions violating
+// a PodDisruptionBudget with a 429 status
+func (r *Remediator) evict(ctx context.Context, pod *corev1.Pod) error {
+	eviction := &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		DeleteOptions: &metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &pod.UID},
+		},
+	}
+	return r.client.PolicyV1().Evictions(pod.Namespace).Evict(ctx, eviction)
+}
@@ -0,0 +1,93 @@
+package compliance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRemediate(t *testing.T) {
+	now := time.Now()
+	namespace := func(name string, optedIn bool) *corev1.Namespace {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if optedIn {
+			ns.Labels = map[string]string{RemediateLabel: "true"}
+		}
+		return ns
+	}
+	pod := func(namespace, name string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, UID: types.UID(namespace + "/" + name)}}
+	}
+	pods := []*corev1.Pod{pod("team-a", "old"), pod("team-a", "recent"), pod("team-b", "old")}
+	violations := map[types.UID]Violation{}
+	for _, p := range pods {
+		since := now.Add(-48 * time.Hour)
+		if p.Name == "recent" {
+			since = now.Add(-time.Hour)
+		}
+		violations[p.UID] = Violation{Namespace: p.Namespace, Pod: p.Name, Reason: "Invalid uid in pod, expected: 1001, found: 2000", Since: metav1.NewTime(since)}
+	}
+	objects := []runtime.Object{namespace("team-a", true), namespace("team-b", false)}
+	for _, p := range pods {
+		objects = append(objects, p)
+	}
+
+	_, err := NewRemediator(fake.NewSimpleClientset(), "delete")
+	assert.Error(t, err)
+
+	t.Run("annotate", func(t *testing.T) {
+		client := fake.NewSimpleClientset(objects...)
+		r, err := NewRemediator(client, ActionAnnotate)
+		assert.NoError(t, err)
+		r.remediate(context.TODO(), pods, violations, now)
+
+		annotated := map[string]string{}
+		for _, p := range pods {
+			got, err := client.CoreV1().Pods(p.Namespace).Get(context.TODO(), p.Name, metav1.GetOptions{})
+			assert.NoError(t, err)
+			if reason, found := got.Annotations[NonCompliantAnnotation]; found {
+				annotated[p.Namespace+"/"+p.Name] = reason
+			}
+		}
+		assert.Equal(t, map[string]string{"team-a/old": "Invalid uid in pod, expected: 1001, found: 2000"}, annotated)
+	})
+
+	t.Run("evict", func(t *testing.T) {
+		client := fake.NewSimpleClientset(objects...)
+		var evicted []string
+		client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() != "eviction" {
+				return false, nil, nil
+			}
+			eviction := action.(k8stesting.CreateAction).GetObject().(*policyv1.Eviction)
+			evicted = append(evicted, eviction.Namespace+"/"+eviction.Name)
+			return true, nil, nil
+		})
+		r, err := NewRemediator(client, ActionEvict)
+		assert.NoError(t, err)
+		r.remediate(context.TODO(), pods, violations, now)
+		assert.Equal(t, []string{"team-a/old"}, evicted)
+	})
+
+	t.Run("evict blocked by a PodDisruptionBudget", func(t *testing.T) {
+		client := fake.NewSimpleClientset(objects...)
+		client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 0)
+		})
+		r, err := NewRemediator(client, ActionEvict)
+		assert.NoError(t, err)
+		r.remediate(context.TODO(), pods, violations, now)
+		_, err = client.CoreV1().Pods("team-a").Get(context.TODO(), "old", metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+}
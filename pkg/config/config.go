@@ -0,0 +1,218 @@
+// Package config loads the webhook configuration file. Every setting of the file
+// is the default of the env var of the same meaning, so that env vars (and the
+// command line flags setting them) override the file.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tensorchord/nfs-pod-access-control/pkg/admission"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/certs"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the webhook configuration file
+type Config struct {
+	// ListenAddress is the address of the admission server (LISTEN_ADDR)
+	ListenAddress string `json:"listenAddress,omitempty"`
+	// MetricsAddress is the address of the metrics server (METRICS_ADDR)
+	MetricsAddress string `json:"metricsAddress,omitempty"`
+	// LogLevel is the logrus level (LOG_LEVEL)
+	LogLevel string `json:"logLevel,omitempty"`
+	// LogJSON logs in JSON rather than text (LOG_JSON)
+	LogJSON *bool `json:"logJSON,omitempty"`
+	// Namespace is the namespace of the webhook (WEBHOOK_NAMESPACE)
+	Namespace string `json:"namespace,omitempty"`
+	// TLS configures the serving certificate
+	TLS TLS `json:"tls,omitempty"`
+	// Mapping selects the mapping objects and the resolver backend
+	Mapping Mapping `json:"mapping,omitempty"`
+	// EnforcementMode is enforce, audit or warn (ENFORCEMENT_MODE)
+	EnforcementMode string `json:"enforcementMode,omitempty"`
+	// NamespaceEnforcementModes maps namespace patterns to enforcement modes
+	// (NAMESPACE_ENFORCEMENT_MODES)
+	NamespaceEnforcementModes map[string]string `json:"namespaceEnforcementModes,omitempty"`
+	// EnforcedNamespaces are the namespace patterns validated and mutated
+	// (ENFORCED_NAMESPACES)
+	EnforcedNamespaces []string `json:"enforcedNamespaces,omitempty"`
+	// ExcludedNamespaces are the namespace patterns never validated nor mutated
+	// (EXCLUDED_NAMESPACES)
+	ExcludedNamespaces []string `json:"excludedNamespaces,omitempty"`
+	// FailurePolicy is Fail or Ignore (FAILURE_POLICY)
+	FailurePolicy string `json:"failurePolicy,omitempty"`
+	// Env sets any other env var, e.g. ENABLE_EXEMPTIONS
+	Env map[string]string `json:"env,omitempty"`
+}
+
+// TLS configures the serving certificate of the webhook
+type TLS struct {
+	// Enabled serves https with the certificate files (TLS)
+	Enabled *bool `json:"enabled,omitempty"`
+	// CertFile is the serving certificate (TLS_CERT_FILE)
+	CertFile string `json:"certFile,omitempty"`
+	// KeyFile is the key of the serving certificate (TLS_KEY_FILE)
+	KeyFile string `json:"keyFile,omitempty"`
+	// MinVersion is the minimum TLS version, 1.2 or 1.3 (TLS_MIN_VERSION)
+	MinVersion string `json:"minVersion,omitempty"`
+	// CipherSuites are the TLS 1.2 cipher suites allowed (TLS_CIPHER_SUITES)
+	CipherSuites []string `json:"cipherSuites,omitempty"`
+	// ClientCAFile verifies the client certificate of the API server (TLS_CLIENT_CA_FILE)
+	ClientCAFile string `json:"clientCAFile,omitempty"`
+}
+
+// Mapping selects the mapping objects and the resolver backend
+type Mapping struct {
+	// Backend is the resolver backend (MAPPING_BACKEND)
+	Backend string `json:"backend,omitempty"`
+	// SourceKind is ConfigMap or Secret (MAPPING_SOURCE_KIND)
+	SourceKind string `json:"sourceKind,omitempty"`
+	// SourceNamespace is the namespace of the mapping objects (MAPPING_SOURCE_NAMESPACE)
+	SourceNamespace string `json:"sourceNamespace,omitempty"`
+	// UIDName is the name of the UID mapping object (UID_MAPPING_NAME)
+	UIDName string `json:"uidName,omitempty"`
+	// GIDName is the name of the GID mapping object (GID_MAPPING_NAME)
+	GIDName string `json:"gidName,omitempty"`
+	// Krb5Name is the name of the Kerberos mapping object (KRB5_MAPPING_NAME)
+	Krb5Name string `json:"krb5Name,omitempty"`
+	// WindowsName is the name of the Windows user name mapping object (WINDOWS_MAPPING_NAME)
+	WindowsName string `json:"windowsName,omitempty"`
+}
+
+// envName matches the names of env vars
+var envName = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+
+// Load reads the configuration file at path, unknown fields are rejected
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading config file: %s\n", err)
+	}
+	var c Config
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("Error parsing config file %s: %s\n", path, err)
+	}
+	return &c, nil
+}
+
+// Settings returns the env vars set by the configuration, by name
+func (c *Config) Settings() map[string]string {
+	env := make(map[string]string, len(c.Env))
+	for k, v := range c.Env {
+		env[k] = v
+	}
+	set := func(name, value string) {
+		if value != "" {
+			env[name] = value
+		}
+	}
+	setBool := func(name string, value *bool) {
+		if value != nil {
+			env[name] = strconv.FormatBool(*value)
+		}
+	}
+
+	set("LISTEN_ADDR", c.ListenAddress)
+	set("METRICS_ADDR", c.MetricsAddress)
+	set("LOG_LEVEL", c.LogLevel)
+	setBool("LOG_JSON", c.LogJSON)
+	set(mapping.NamespaceEnv, c.Namespace)
+	setBool("TLS", c.TLS.Enabled)
+	set("TLS_CERT_FILE", c.TLS.CertFile)
+	set("TLS_KEY_FILE", c.TLS.KeyFile)
+	set("TLS_MIN_VERSION", c.TLS.MinVersion)
+	set("TLS_CIPHER_SUITES", strings.Join(c.TLS.CipherSuites, ","))
+	set("TLS_CLIENT_CA_FILE", c.TLS.ClientCAFile)
+	set("MAPPING_BACKEND", c.Mapping.Backend)
+	set("MAPPING_SOURCE_KIND", c.Mapping.SourceKind)
+	set("MAPPING_SOURCE_NAMESPACE", c.Mapping.SourceNamespace)
+	set("UID_MAPPING_NAME", c.Mapping.UIDName)
+	set("GID_MAPPING_NAME", c.Mapping.GIDName)
+	set("KRB5_MAPPING_NAME", c.Mapping.Krb5Name)
+	set("WINDOWS_MAPPING_NAME", c.Mapping.WindowsName)
+	set("ENFORCEMENT_MODE", c.EnforcementMode)
+	set("NAMESPACE_ENFORCEMENT_MODES", c.namespaceModes())
+	set("ENFORCED_NAMESPACES", strings.Join(c.EnforcedNamespaces, ","))
+	set("EXCLUDED_NAMESPACES", strings.Join(c.ExcludedNamespaces, ","))
+	set("FAILURE_POLICY", c.FailurePolicy)
+	return env
+}
+
+// namespaceModes returns NamespaceEnforcementModes as sorted namespace=mode pairs
+func (c *Config) namespaceModes() string {
+	pairs := make([]string, 0, len(c.NamespaceEnforcementModes))
+	for namespace, mode := range c.NamespaceEnforcementModes {
+		pairs = append(pairs, namespace+"="+mode)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Validate returns every invalid setting of the configuration
+func (c *Config) Validate() error {
+	var errs []error
+	for name := range c.Env {
+		if !envName.MatchString(name) {
+			errs = append(errs, fmt.Errorf("invalid env var name %q", name))
+		}
+	}
+	for name, addr := range map[string]string{"listenAddress": c.ListenAddress, "metricsAddress": c.MetricsAddress} {
+		if addr == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q: %v", name, addr, err))
+		}
+	}
+	if c.TLS.Enabled != nil && *c.TLS.Enabled && (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("tls.certFile and tls.keyFile must be set together"))
+	}
+	if _, err := certs.ParseMinVersion(c.TLS.MinVersion); err != nil {
+		errs = append(errs, fmt.Errorf("invalid tls.minVersion: %v", err))
+	}
+	if _, err := certs.ParseCipherSuites(c.TLS.CipherSuites); err != nil {
+		errs = append(errs, fmt.Errorf("invalid tls.cipherSuites: %v", err))
+	}
+	switch c.Mapping.SourceKind {
+	case "", mapping.ConfigMapKind, mapping.SecretKind:
+	default:
+		errs = append(errs, fmt.Errorf("invalid mapping.sourceKind %q, expected %s or %s", c.Mapping.SourceKind, mapping.ConfigMapKind, mapping.SecretKind))
+	}
+	if _, err := admission.ParseModePolicy(c.EnforcementMode, c.namespaceModes()); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := admission.ParseNamespaceScope(strings.Join(c.EnforcedNamespaces, ","), strings.Join(c.ExcludedNamespaces, ",")); err != nil {
+		errs = append(errs, err)
+	}
+	switch c.FailurePolicy {
+	case "", "Fail", "Ignore":
+	default:
+		errs = append(errs, fmt.Errorf("invalid failurePolicy %q, expected Fail or Ignore", c.FailurePolicy))
+	}
+	return errors.Join(errs...)
+}
+
+// Apply sets the env vars of the configuration that are not set in the
+// environment, env vars set to an empty string count as not set. It returns the
+// names of the env vars it set.
+func (c *Config) Apply() ([]string, error) {
+	var names []string
+	for name, value := range c.Settings() {
+		if os.Getenv(name) != "" {
+			continue
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return names, fmt.Errorf("cannot set %s: %v", name, err)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
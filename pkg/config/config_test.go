@@ -0,0 +1,86 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `
+listenAddress: ":8443"
+logJSON: true
+tls:
+  enabled: true
+  certFile: /certs/tls.crt
+  keyFile: /certs/tls.key
+  minVersion: "1.3"
+  cipherSuites: [TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384]
+mapping:
+  sourceKind: Secret
+  uidName: uids
+enforcementMode: audit
+namespaceEnforcementModes:
+  team-a: enforce
+  ci-*: warn
+excludedNamespaces: [kube-system, kube-public]
+env:
+  ENABLE_EXEMPTIONS: "true"
+`
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+
+	c, err := Load(path)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Validate())
+	assert.Equal(t, map[string]string{
+		"LISTEN_ADDR":                 ":8443",
+		"LOG_JSON":                    "true",
+		"TLS":                         "true",
+		"TLS_CERT_FILE":               "/certs/tls.crt",
+		"TLS_KEY_FILE":                "/certs/tls.key",
+		"TLS_MIN_VERSION":             "1.3",
+		"TLS_CIPHER_SUITES":           "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+		"MAPPING_SOURCE_KIND":         "Secret",
+		"UID_MAPPING_NAME":            "uids",
+		"ENFORCEMENT_MODE":            "audit",
+		"NAMESPACE_ENFORCEMENT_MODES": "ci-*=warn,team-a=enforce",
+		"EXCLUDED_NAMESPACES":         "kube-system,kube-public",
+		"ENABLE_EXEMPTIONS":           "true",
+	}, c.Settings())
+
+	// env vars win over the file, empty ones count as unset
+	for name := range c.Settings() {
+		t.Setenv(name, "")
+	}
+	t.Setenv("ENFORCEMENT_MODE", "warn")
+	names, err := c.Apply()
+	assert.NoError(t, err)
+	assert.NotContains(t, names, "ENFORCEMENT_MODE")
+	assert.Contains(t, names, "LISTEN_ADDR")
+	assert.Equal(t, "warn", os.Getenv("ENFORCEMENT_MODE"))
+	assert.Equal(t, ":8443", os.Getenv("LISTEN_ADDR"))
+
+	assert.NoError(t, os.WriteFile(path, []byte("listenAddres: :8443\n"), 0o644))
+	_, err = Load(path)
+	assert.Error(t, err, "unknown fields are rejected")
+}
+
+func TestValidate(t *testing.T) {
+	enabled := true
+	c := Config{
+		ListenAddress:      "8443",
+		TLS:                TLS{Enabled: &enabled, CertFile: "/certs/tls.crt", MinVersion: "1.0", CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		Mapping:            Mapping{SourceKind: "Deployment"},
+		EnforcementMode:    "permissive",
+		ExcludedNamespaces: []string{"kube-["},
+		FailurePolicy:      "Open",
+		Env:                map[string]string{"enable-opa": "true"},
+	}
+	err := c.Validate()
+	for _, want := range []string{"listenAddress", "tls.keyFile", "tls.minVersion", "tls.cipherSuites", "sourceKind", "permissive", "kube-[", "failurePolicy", "enable-opa"} {
+		assert.ErrorContains(t, err, want)
+	}
+}
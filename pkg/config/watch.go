@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// Change is a setting changed by a reload of the configuration file, Old or New
+// is empty when the setting was added or removed
+type Change struct {
+	Name string
+	Old  string
+	New  string
+}
+
+// Diff returns the settings changed from old to new, sorted by name
+func Diff(old, new map[string]string) []Change {
+	var changes []Change
+	for name, value := range new {
+		if old[name] != value {
+			changes = append(changes, Change{Name: name, Old: old[name], New: value})
+		}
+	}
+	for name, value := range old {
+		if _, ok := new[name]; !ok {
+			changes = append(changes, Change{Name: name, Old: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// Watcher loads the configuration file again whenever it changes and passes
+// the changed settings to OnChange. Invalid configurations are logged and
+// ignored, the previous one stays in effect.
+type Watcher struct {
+	path     string
+	OnChange func([]Change)
+	Logger   *logrus.Entry
+
+	mu      sync.Mutex
+	current map[string]string
+}
+
+// NewWatcher returns a Watcher of the configuration file at path, current is
+// the configuration in effect
+func NewWatcher(path string, current *Config, onChange func([]Change)) *Watcher {
+	return &Watcher{
+		path:     path,
+		OnChange: onChange,
+		Logger:   logrus.WithField("component", "config"),
+		current:  current.Settings(),
+	}
+}
+
+// Reload loads the configuration file and calls OnChange if any setting changed
+func (w *Watcher) Reload() error {
+	c, err := Load(w.path)
+	if err != nil {
+		return err
+	}
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("invalid config file %s: %v", w.path, err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	settings := c.Settings()
+	changes := Diff(w.current, settings)
+	w.current = settings
+	if len(changes) > 0 {
+		w.OnChange(changes)
+	}
+	return nil
+}
+
+// Run watches the directory of the configuration file until stopCh is closed.
+// The kubelet updates ConfigMap volumes by swapping the symlink of their ..data
+// directory, so any change in the directory triggers a reload.
+func (w *Watcher) Run(stopCh <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("cannot watch config file: %v", err)
+	}
+	if err := watcher.Add(filepath.Dir(w.path)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("cannot watch %s: %v", filepath.Dir(w.path), err)
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op == fsnotify.Chmod {
+					continue
+				}
+				if err := w.Reload(); err != nil {
+					// the file may be half written, the next event reloads it
+					w.Logger.Warnf("cannot reload config file after %s: %v", event, err)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				w.Logger.Errorf("error watching config file: %v", err)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	old := map[string]string{"ENFORCEMENT_MODE": "audit", "LOG_LEVEL": "debug", "LDAP_URL": "ldap://a"}
+	new := map[string]string{"ENFORCEMENT_MODE": "enforce", "LDAP_URL": "ldap://a", "EXCLUDED_NAMESPACES": "kube-system"}
+	assert.Equal(t, []Change{
+		{Name: "ENFORCEMENT_MODE", Old: "audit", New: "enforce"},
+		{Name: "EXCLUDED_NAMESPACES", New: "kube-system"},
+		{Name: "LOG_LEVEL", Old: "debug"},
+	}, Diff(old, new))
+	assert.Empty(t, Diff(old, old))
+}
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("enforcementMode: audit\n"), 0o644))
+	c, err := Load(path)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var got []Change
+	w := NewWatcher(path, c, func(changes []Change) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, changes...)
+	})
+	stop := make(chan struct{})
+	defer close(stop)
+	require.NoError(t, w.Run(stop))
+
+	// invalid configurations are ignored
+	require.NoError(t, w.Reload())
+	require.NoError(t, os.WriteFile(path, []byte("enforcementMode: permissive\n"), 0o644))
+	assert.Error(t, w.Reload())
+
+	require.NoError(t, os.WriteFile(path, []byte("enforcementMode: enforce\n"), 0o644))
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, Change{Name: "ENFORCEMENT_MODE", Old: "audit", New: "enforce"}, got[0])
+}
@@ -0,0 +1,109 @@
+// Package diagnostics serves the runtime diagnostics of the webhook on a debug
+// listener bound to the loopback interface: pprof profiles, expvar variables, the
+// effective configuration and the content of its caches, reachable with
+// `kubectl port-forward` only
+package diagnostics
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// secretNames are the substrings of the names of the env vars whose value is
+// redacted from the configuration, unless they name a file or an object
+var secretNames = []string{"PASSWORD", "TOKEN", "SECRET", "CREDENTIAL", "WEBHOOK_URL"}
+
+// Server serves the diagnostics of the webhook
+type Server struct {
+	// Environ returns the env vars of the webhook, as os.Environ
+	Environ func() []string
+	// Caches returns the content of the caches, serialized to JSON
+	Caches func() interface{}
+
+	Logger *logrus.Entry
+}
+
+// CheckLoopback returns an error unless addr is bound to the loopback interface,
+// e.g. localhost:6060 or 127.0.0.1:6060
+func CheckLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %v", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("address %q is not bound to the loopback interface", addr)
+}
+
+// Handler returns the handler of the diagnostics endpoints
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/config", func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, Config(s.Environ()))
+	})
+	mux.HandleFunc("/debug/caches", func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, s.Caches())
+	})
+	return mux
+}
+
+// writeJSON writes v as indented JSON
+func (s *Server) writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		s.Logger.Errorf("cannot serialize diagnostics: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
+
+// Config returns the env vars of environ with upper case names, i.e. the settings
+// of the webhook rather than the ones of its container, by name. The values of
+// passwords, tokens, secrets and webhook URLs are redacted.
+func Config(environ []string) map[string]string {
+	config := make(map[string]string)
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if name == "" || name != strings.ToUpper(name) {
+			continue
+		}
+		if value != "" && secret(name) {
+			value = "REDACTED"
+		}
+		config[name] = value
+	}
+	return config
+}
+
+// secret returns whether the env var name holds a secret rather than the path of
+// a file or the name of a Secret holding it
+func secret(name string) bool {
+	if strings.HasSuffix(name, "_FILE") || strings.HasSuffix(name, "_NAME") {
+		return false
+	}
+	for _, s := range secretNames {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckLoopback(t *testing.T) {
+	for _, addr := range []string{"localhost:6060", "127.0.0.1:6060", "[::1]:6060"} {
+		assert.NoError(t, CheckLoopback(addr), addr)
+	}
+	for _, addr := range []string{":6060", "0.0.0.0:6060", "10.0.0.1:6060", "6060"} {
+		assert.Error(t, CheckLoopback(addr), addr)
+	}
+}
+
+func TestServer(t *testing.T) {
+	s := &Server{
+		Environ: func() []string {
+			return []string{"MAPPING_BACKEND=ldap", "REDIS_PASSWORD=hunter2", "VAULT_TOKEN_FILE=/var/run/token", "CERT_SECRET_NAME=nfs-tls", "REDIS_KEY_PREFIX=nfs", "NOTIFY_WEBHOOK_URL=https://hooks.example.com/T0/B0/x", "home=/root"}
+		},
+		Caches: func() interface{} { return map[string]int{"allowedPods": 3} },
+		Logger: logrus.WithField("component", "diagnostics"),
+	}
+	get := func(path string, v interface{}) int {
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if v != nil {
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), v))
+		}
+		return w.Code
+	}
+
+	var config map[string]string
+	assert.Equal(t, http.StatusOK, get("/debug/config", &config))
+	assert.Equal(t, map[string]string{
+		"MAPPING_BACKEND":    "ldap",
+		"REDIS_PASSWORD":     "REDACTED",
+		"VAULT_TOKEN_FILE":   "/var/run/token",
+		"CERT_SECRET_NAME":   "nfs-tls",
+		"REDIS_KEY_PREFIX":   "nfs",
+		"NOTIFY_WEBHOOK_URL": "REDACTED",
+	}, config)
+
+	var caches map[string]int
+	assert.Equal(t, http.StatusOK, get("/debug/caches", &caches))
+	assert.Equal(t, 3, caches["allowedPods"])
+
+	assert.Equal(t, http.StatusOK, get("/debug/vars", nil))
+	assert.Equal(t, http.StatusOK, get("/debug/pprof/", nil))
+}
@@ -0,0 +1,96 @@
+package evaluation
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/tensorchord/nfs-pod-access-control/pkg/evaluation/evaluationpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// authenticate returns the caller of ctx, authenticated by the bearer token of
+// its authorization metadata with a TokenReview
+func (s *Server) authenticate(ctx context.Context) (authenticationv1.UserInfo, error) {
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, value := range md.Get("authorization") {
+			if t, ok := strings.CutPrefix(value, "Bearer "); ok {
+				token = strings.TrimSpace(t)
+			}
+		}
+	}
+	if token == "" {
+		return authenticationv1.UserInfo{}, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	review := &authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: token}}
+	res, err := s.client.AuthenticationV1().TokenReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return authenticationv1.UserInfo{}, status.Errorf(codes.Unavailable, "TokenReview failed: %v", err)
+	}
+	if !res.Status.Authenticated {
+		return authenticationv1.UserInfo{}, status.Error(codes.Unauthenticated, "invalid bearer token")
+	}
+	return res.Status.User, nil
+}
+
+// authorize checks with SubjectAccessReviews that caller may impersonate user
+// and its groups, like the impersonation of the API server, unless user is the
+// caller with some of its groups
+func (s *Server) authorize(ctx context.Context, caller, user authenticationv1.UserInfo) error {
+	self := user.Username == caller.Username
+	if !self {
+		attrs := authorizationv1.ResourceAttributes{Verb: "impersonate", Resource: "users", Name: user.Username}
+		if parts := strings.Split(user.Username, ":"); len(parts) == 4 && strings.HasPrefix(user.Username, "system:serviceaccount:") {
+			attrs = authorizationv1.ResourceAttributes{Verb: "impersonate", Resource: "serviceaccounts", Namespace: parts[2], Name: parts[3]}
+		}
+		if err := s.allowed(ctx, caller, attrs); err != nil {
+			return err
+		}
+	}
+	for _, group := range user.Groups {
+		if self && slices.Contains(caller.Groups, group) {
+			continue
+		}
+		attrs := authorizationv1.ResourceAttributes{Verb: "impersonate", Resource: "groups", Name: group}
+		if err := s.allowed(ctx, caller, attrs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allowed checks with a SubjectAccessReview that caller is allowed attrs
+func (s *Server) allowed(ctx context.Context, caller authenticationv1.UserInfo, attrs authorizationv1.ResourceAttributes) error {
+	extra := make(map[string]authorizationv1.ExtraValue, len(caller.Extra))
+	for k, v := range caller.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:               caller.Username,
+			UID:                caller.UID,
+			Groups:             caller.Groups,
+			Extra:              extra,
+			ResourceAttributes: &attrs,
+		},
+	}
+	res, err := s.client.AuthorizationV1().SubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "SubjectAccessReview failed: %v", err)
+	}
+	if !res.Status.Allowed {
+		return status.Errorf(codes.PermissionDenied, "%s cannot impersonate %s %s", caller.Username, strings.TrimSuffix(attrs.Resource, "s"), attrs.Name)
+	}
+	return nil
+}
+
+// userInfo returns the user of a request
+func userInfo(user *evaluationpb.UserInfo) authenticationv1.UserInfo {
+	return authenticationv1.UserInfo{Username: user.GetUsername(), Groups: user.GetGroups()}
+}
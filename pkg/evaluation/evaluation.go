@@ -0,0 +1,196 @@
+// Package evaluation serves the validation engine of the webhook as a gRPC
+// service, so that tools can ask whether a pod would be admitted without
+// crafting AdmissionReview payloads
+package evaluation
+
+//go:generate protoc -I evaluationpb --go_out=evaluationpb --go_opt=paths=source_relative --go-grpc_out=evaluationpb --go-grpc_opt=paths=source_relative evaluationpb/evaluation.proto
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/admission"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/evaluation/evaluationpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// resources are the resources of the kinds evaluated, by API group
+var resources = map[string]map[string]string{
+	"":      {"Pod": "pods"},
+	"apps":  {"Deployment": "deployments", "StatefulSet": "statefulsets", "DaemonSet": "daemonsets"},
+	"batch": {"Job": "jobs", "CronJob": "cronjobs"},
+}
+
+// Server evaluates pods with the Admitters returned by newAdmitter, i.e. with
+// the policy, the modes and the exemptions of the webhook. Callers are
+// authenticated by their bearer token with a TokenReview, and must be allowed to
+// impersonate the user they evaluate pods for with a SubjectAccessReview.
+type Server struct {
+	evaluationpb.UnimplementedPolicyEvaluationServer
+
+	client      kubernetes.Interface
+	newAdmitter func(*logrus.Entry, *admissionv1.AdmissionRequest) admission.Admitter
+
+	Logger *logrus.Entry
+}
+
+// NewServer returns a Server evaluating pods with the Admitters of newAdmitter,
+// authenticating and authorizing the callers with client
+func NewServer(client kubernetes.Interface, newAdmitter func(*logrus.Entry, *admissionv1.AdmissionRequest) admission.Admitter) *Server {
+	return &Server{
+		client:      client,
+		newAdmitter: newAdmitter,
+		Logger:      logrus.WithField("component", "evaluation"),
+	}
+}
+
+// EvaluatePod validates the object of req like a dry-run admission request of
+// its creation by the user of req, so that no Event is emitted. The object is
+// evaluated for the caller when req has no user.
+func (s *Server) EvaluatePod(ctx context.Context, req *evaluationpb.EvaluatePodRequest) (*evaluationpb.EvaluatePodResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	user := caller
+	if req.GetUser().GetUsername() != "" {
+		user = userInfo(req.GetUser())
+		if err := s.authorize(ctx, caller, user); err != nil {
+			return nil, err
+		}
+	}
+	return s.evaluate(ctx, req, user)
+}
+
+// evaluate validates the object of req like a dry-run admission request of its
+// creation by user
+func (s *Server) evaluate(ctx context.Context, req *evaluationpb.EvaluatePodRequest, user authenticationv1.UserInfo) (*evaluationpb.EvaluatePodResponse, error) {
+	request, err := admissionRequest(req, user)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := s.Logger.WithFields(logrus.Fields{"kind": request.Kind.Kind, "name": request.Name, "namespace": request.Namespace})
+	a := s.newAdmitter(logger, request)
+	// evaluations aren't admissions, they don't spend the tokens of the namespace
+	a.RateLimits = nil
+	review, err := a.ValidatePodReview(ctx)
+	if review == nil || review.Response == nil {
+		return nil, status.Errorf(codes.Internal, "cannot evaluate %s %s: %v", request.Kind.Kind, request.Name, err)
+	}
+	if err != nil {
+		logger.Debugf("evaluation failed: %v", err)
+	}
+
+	response := &evaluationpb.EvaluatePodResponse{
+		Allowed:  review.Response.Allowed,
+		Warnings: review.Response.Warnings,
+	}
+	if result := review.Response.Result; result != nil {
+		response.Message = strings.TrimSpace(result.Message)
+		response.Code = string(result.Reason)
+		response.Denials = denials(result)
+	}
+	return response, nil
+}
+
+// admissionRequest returns the dry-run admission request of the creation of the
+// object of req by user
+func admissionRequest(req *evaluationpb.EvaluatePodRequest, user authenticationv1.UserInfo) (*admissionv1.AdmissionRequest, error) {
+	if len(req.GetObject()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "object is required")
+	}
+	if user.Username == "" {
+		return nil, status.Error(codes.InvalidArgument, "user.username is required")
+	}
+	raw, err := yaml.YAMLToJSON(req.GetObject())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot parse object: %v", err)
+	}
+	var meta struct {
+		metav1.TypeMeta   `json:",inline"`
+		metav1.ObjectMeta `json:"metadata,omitempty"`
+	}
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot parse object: %v", err)
+	}
+	gvk := schema.FromAPIVersionAndKind(meta.APIVersion, meta.Kind)
+	resource, ok := resources[gvk.Group][gvk.Kind]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot evaluate %s objects, only pods and workloads", gvk.Kind)
+	}
+
+	namespace := req.GetNamespace()
+	if namespace == "" {
+		namespace = meta.Namespace
+	}
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	if gvk.Kind == "Pod" {
+		// pods get the default serviceAccount before the webhook is called
+		var pod corev1.Pod
+		if err := json.Unmarshal(raw, &pod); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "cannot parse pod: %v", err)
+		}
+		if pod.Spec.ServiceAccountName == "" {
+			pod.Spec.ServiceAccountName = "default"
+			if raw, err = json.Marshal(&pod); err != nil {
+				return nil, status.Errorf(codes.Internal, "cannot serialize pod: %v", err)
+			}
+		}
+	}
+
+	dryRun := true
+	return &admissionv1.AdmissionRequest{
+		UID:       "evaluate-pod",
+		Kind:      metav1.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind},
+		Resource:  metav1.GroupVersionResource{Group: gvk.Group, Version: gvk.Version, Resource: resource},
+		Name:      meta.Name,
+		Namespace: namespace,
+		Operation: admissionv1.Create,
+		UserInfo:  user,
+		Object:    runtime.RawExtension{Raw: raw},
+		DryRun:    &dryRun,
+	}, nil
+}
+
+// denials returns the denials described by the causes of the status of a denied
+// pod: a cause with the message of each denial, followed by its validator field
+// and its detail fields
+func denials(result *metav1.Status) []*evaluationpb.Denial {
+	if result.Details == nil {
+		return nil
+	}
+	var denials []*evaluationpb.Denial
+	for _, cause := range result.Details.Causes {
+		if cause.Field == "" {
+			denials = append(denials, &evaluationpb.Denial{Code: string(cause.Type), Reason: cause.Message})
+			continue
+		}
+		if len(denials) == 0 {
+			continue
+		}
+		d := denials[len(denials)-1]
+		if cause.Field == "validator" {
+			d.Validator = cause.Message
+			continue
+		}
+		if d.Details == nil {
+			d.Details = map[string]string{}
+		}
+		d.Details[cause.Field] = cause.Message
+	}
+	return denials
+}
@@ -0,0 +1,164 @@
+package evaluation
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/admission"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/evaluation/evaluationpb"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// uidResolver maps every subject to the same UID and GID
+type uidResolver int64
+
+func (r uidResolver) Resolve(context.Context, string) (resolver.IdentitySpec, error) {
+	uid := int64(r)
+	return resolver.IdentitySpec{UID: &uid, GIDs: []int64{uid}}, nil
+}
+
+// authClient authenticates the bearer tokens as the user named by them, except
+// "invalid", and only lets the "portal" user impersonate others
+func authClient() *fake.Clientset {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		review.Status.Authenticated = review.Spec.Token != "invalid"
+		review.Status.User = authenticationv1.UserInfo{Username: review.Spec.Token, Groups: []string{"system:authenticated"}}
+		return true, review, nil
+	})
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		review.Status.Allowed = review.Spec.User == "portal" && review.Spec.ResourceAttributes.Verb == "impersonate"
+		return true, review, nil
+	})
+	return client
+}
+
+// withToken returns a context sending token as bearer token
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.TODO(), "authorization", "Bearer "+token)
+}
+
+func TestEvaluatePod(t *testing.T) {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	// evaluations don't spend the tokens of the namespaces
+	rateLimits := admission.NewRateLimiter(0.001, 1)
+	evaluationpb.RegisterPolicyEvaluationServer(server, NewServer(authClient(), func(logger *logrus.Entry, request *admissionv1.AdmissionRequest) admission.Admitter {
+		return admission.Admitter{Logger: logger, Request: request, Resolver: uidResolver(1001), RateLimits: rateLimits}
+	}))
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := evaluationpb.NewPolicyEvaluationClient(conn)
+	user := &evaluationpb.UserInfo{Username: "system:serviceaccount:team-a:builder"}
+
+	res, err := client.EvaluatePod(withToken("portal"), &evaluationpb.EvaluatePodRequest{
+		Object: []byte("apiVersion: v1\nkind: Pod\nmetadata:\n  name: app\nspec:\n  securityContext:\n    runAsUser: 2000\n  containers:\n  - name: app\n    image: busybox"),
+		User:   user,
+	})
+	if assert.NoError(t, err) {
+		assert.False(t, res.Allowed)
+		assert.Equal(t, "UIDMismatch", res.Code)
+		if assert.Len(t, res.Denials, 1) {
+			assert.Equal(t, "uid_validator", res.Denials[0].Validator)
+			assert.Equal(t, "UIDMismatch", res.Denials[0].Code)
+			assert.Equal(t, "1001", res.Denials[0].Details["expectedUID"])
+			assert.Equal(t, "2000", res.Denials[0].Details["foundUID"])
+			// pods without serviceAccountName are evaluated as the default serviceAccount
+			assert.Equal(t, "default", res.Denials[0].Details["subject"])
+		}
+	}
+
+	res, err = client.EvaluatePod(withToken("portal"), &evaluationpb.EvaluatePodRequest{
+		Object:    []byte(`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web"},"spec":{"template":{"spec":{"securityContext":{"runAsUser":1001}}}}}`),
+		Namespace: "team-a",
+		User:      user,
+	})
+	if assert.NoError(t, err) {
+		assert.True(t, res.Allowed)
+		assert.Empty(t, res.Denials)
+	}
+
+	_, err = client.EvaluatePod(withToken("portal"), &evaluationpb.EvaluatePodRequest{
+		Object: []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: svc"),
+		User:   user,
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// callers are authenticated
+	pod := []byte("apiVersion: v1\nkind: Pod\nmetadata:\n  name: app\nspec:\n  securityContext:\n    runAsUser: 1001")
+	_, err = client.EvaluatePod(context.TODO(), &evaluationpb.EvaluatePodRequest{Object: pod, User: user})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.EvaluatePod(withToken("invalid"), &evaluationpb.EvaluatePodRequest{Object: pod, User: user})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// other users are only evaluated for callers allowed to impersonate them
+	_, err = client.EvaluatePod(withToken("alice"), &evaluationpb.EvaluatePodRequest{Object: pod, User: user})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.EvaluatePod(withToken("alice"), &evaluationpb.EvaluatePodRequest{
+		Object: pod,
+		User:   &evaluationpb.UserInfo{Username: "alice", Groups: []string{"system:masters"}},
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// the caller is evaluated without user
+	res, err = client.EvaluatePod(withToken("alice"), &evaluationpb.EvaluatePodRequest{Object: pod})
+	if assert.NoError(t, err) {
+		assert.True(t, res.Allowed)
+	}
+	_, err = client.EvaluatePod(withToken("alice"), &evaluationpb.EvaluatePodRequest{
+		Object: pod,
+		User:   &evaluationpb.UserInfo{Username: "alice", Groups: []string{"system:authenticated"}},
+	})
+	assert.NoError(t, err)
+}
+
+func TestSelfTest(t *testing.T) {
+	resolved := uidResolver(1001)
+	server := NewServer(nil, func(logger *logrus.Entry, request *admissionv1.AdmissionRequest) admission.Admitter {
+		return admission.Admitter{Logger: logger, Request: request, Resolver: resolved}
+	})
+	selfTest := &SelfTest{
+		Server: server,
+		Request: &evaluationpb.EvaluatePodRequest{
+			Object:    SyntheticPod("nfs.example.com", 1001),
+			Namespace: "default",
+			User:      &evaluationpb.UserInfo{Username: "system:serviceaccount:default:default"},
+		},
+		Allowed: true,
+	}
+
+	resolved = 2000
+	assert.ErrorContains(t, selfTest.Check(), "self-test pod denied, expected allowed")
+
+	resolved = 1001
+	assert.NoError(t, selfTest.Check())
+
+	// the check passes for good once the expected decision is returned
+	resolved = 2000
+	assert.NoError(t, selfTest.Check())
+}
@@ -0,0 +1,65 @@
+package evaluation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/tensorchord/nfs-pod-access-control/pkg/evaluation/evaluationpb"
+)
+
+// DefaultSelfTestTimeout is the default timeout of an evaluation of the self-test,
+// below the timeout of the readiness probe it runs in
+const DefaultSelfTestTimeout = 4 * time.Second
+
+// SelfTest is a readiness check evaluating a synthetic pod created by a known
+// user, so that a replica unable to admit pods, e.g. because its identity
+// backend is unreachable, doesn't receive admission requests. Once the expected
+// decision has been returned the check always passes: it only gates the startup.
+type SelfTest struct {
+	Server  *Server
+	Request *evaluationpb.EvaluatePodRequest
+	// Allowed is the expected decision about the pod of Request
+	Allowed bool
+	Timeout time.Duration
+
+	passed atomic.Bool
+}
+
+// SyntheticPod returns a pod mounting an NFS volume of server and running as uid
+func SyntheticPod(server string, uid int64) []byte {
+	return []byte(fmt.Sprintf(`{"apiVersion":"v1","kind":"Pod","metadata":{"name":"nfs-pod-access-control-self-test"},`+
+		`"spec":{"securityContext":{"runAsUser":%d,"runAsGroup":%d},"containers":[{"name":"self-test","image":"busybox",`+
+		`"volumeMounts":[{"name":"nfs","mountPath":"/mnt"}]}],"volumes":[{"name":"nfs","nfs":{"server":%q,"path":"/"}}]}}`,
+		uid, uid, server))
+}
+
+// Check evaluates the pod of the self-test until the expected decision is returned
+func (t *SelfTest) Check() error {
+	if t.passed.Load() {
+		return nil
+	}
+	timeout := t.Timeout
+	if timeout == 0 {
+		timeout = DefaultSelfTestTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// the self-test isn't a caller of the service, it needs no authorization
+	res, err := t.Server.evaluate(ctx, t.Request, userInfo(t.Request.GetUser()))
+	if err != nil {
+		return fmt.Errorf("cannot evaluate self-test pod: %v", err)
+	}
+	if res.Allowed != t.Allowed {
+		if res.Allowed {
+			return fmt.Errorf("self-test pod allowed, expected denied")
+		}
+		return fmt.Errorf("self-test pod denied, expected allowed: %s", strings.TrimSpace(res.Message))
+	}
+	t.passed.Store(true)
+	t.Server.Logger.Info("Self-test pod evaluated as expected")
+	return nil
+}
@@ -0,0 +1,153 @@
+// Package events emits Kubernetes Events about the pods rejected by the webhook,
+// attached to the workload owning them so that users see why their pods are not
+// created with `kubectl describe` or `kubectl get events`
+package events
+
+import (
+	"context"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// ReasonDenied is the reason of the Events of rejected pods
+	ReasonDenied = "NFSUIDDenied"
+	// ReasonFailedOpen is the reason of the Events of pods admitted without
+	// enforcement while the identity backend is unavailable
+	ReasonFailedOpen = "NFSFailedOpen"
+	// ReasonUIDCollision is the reason of the Events of UIDs mapped to several
+	// users or serviceAccounts
+	ReasonUIDCollision = "NFSUIDCollision"
+	// ReasonMappingExpired is the reason of the Events of expired mapping entries
+	ReasonMappingExpired = "NFSMappingExpired"
+	// ReasonNonCompliant is the reason of the Events of running pods the current
+	// policy and mappings would deny
+	ReasonNonCompliant = "NFSNonCompliant"
+	// ReasonRemediated is the reason of the Events of running pods annotated or
+	// evicted for violating the current policy and mappings
+	ReasonRemediated = "NFSRemediated"
+
+	// Component is the source component of the Events
+	Component = "nfs-pod-access-control"
+)
+
+// Recorder is a container for emitting Events
+type Recorder struct {
+	client   kubernetes.Interface
+	recorder record.EventRecorder
+	Logger   logrus.FieldLogger
+}
+
+// NewRecorder returns a Recorder sending Events to the API server in the background
+func NewRecorder(client kubernetes.Interface) *Recorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+
+	return &Recorder{
+		client:   client,
+		recorder: broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: Component}),
+		Logger:   logrus.StandardLogger(),
+	}
+}
+
+// Denied emits a warning Event with the ReasonDenied reason about a pod rejected
+// in namespace, attached to the workload owning the pod when it can be resolved
+// and to the pod itself otherwise
+func (r *Recorder) Denied(ctx context.Context, pod *corev1.Pod, namespace, message string) {
+	ref := r.owner(ctx, pod, namespace)
+	r.recorder.Event(ref, corev1.EventTypeWarning, ReasonDenied, strings.TrimSpace(message))
+}
+
+// FailedOpen emits a warning Event with the ReasonFailedOpen reason about a pod
+// admitted in namespace although it would have been rejected, attached like the
+// Events of rejected pods
+func (r *Recorder) FailedOpen(ctx context.Context, pod *corev1.Pod, namespace, message string) {
+	ref := r.owner(ctx, pod, namespace)
+	r.recorder.Event(ref, corev1.EventTypeWarning, ReasonFailedOpen, "admitted while the identity backend is unavailable: "+strings.TrimSpace(message))
+}
+
+// UIDCollision emits a warning Event with the ReasonUIDCollision reason about a UID
+// mapped to several users or serviceAccounts, attached to the mapping object of
+// the given kind holding them
+func (r *Recorder) UIDCollision(kind, namespace, name, message string) {
+	ref := &corev1.ObjectReference{APIVersion: "v1", Kind: kind, Namespace: namespace, Name: name}
+	r.recorder.Event(ref, corev1.EventTypeWarning, ReasonUIDCollision, strings.TrimSpace(message))
+}
+
+// MappingExpired emits a warning Event with the ReasonMappingExpired reason about
+// an expired mapping entry, attached to the object of the given API version and
+// kind holding it
+func (r *Recorder) MappingExpired(apiVersion, kind, namespace, name, message string) {
+	ref := &corev1.ObjectReference{APIVersion: apiVersion, Kind: kind, Namespace: namespace, Name: name}
+	r.recorder.Event(ref, corev1.EventTypeWarning, ReasonMappingExpired, strings.TrimSpace(message))
+}
+
+// NonCompliant emits a warning Event with the ReasonNonCompliant reason about a
+// running pod that would be rejected if created now, attached to the pod
+func (r *Recorder) NonCompliant(pod *corev1.Pod, message string) {
+	ref := &corev1.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name, UID: pod.UID}
+	r.recorder.Event(ref, corev1.EventTypeWarning, ReasonNonCompliant, "running pod would be rejected: "+strings.TrimSpace(message))
+}
+
+// Remediated emits a warning Event with the ReasonRemediated reason about a running
+// pod annotated or evicted by action, attached to the workload owning the pod so
+// that it outlives evicted pods
+func (r *Recorder) Remediated(ctx context.Context, pod *corev1.Pod, action, message string) {
+	ref := r.owner(ctx, pod, pod.Namespace)
+	r.recorder.Eventf(ref, corev1.EventTypeWarning, ReasonRemediated, "%s pod %s: %s", action, pod.Name, strings.TrimSpace(message))
+}
+
+// owner returns a reference to the top-level workload owning pod, i.e. the
+// Deployment of a ReplicaSet or the CronJob of a Job, falling back to the direct
+// controller of the pod and to the pod itself
+func (r *Recorder) owner(ctx context.Context, pod *corev1.Pod, namespace string) *corev1.ObjectReference {
+	controller := metav1.GetControllerOf(pod)
+	if controller == nil {
+		name := pod.Name
+		if name == "" {
+			name = pod.GenerateName
+		}
+		return &corev1.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: namespace, Name: name}
+	}
+
+	ref := reference(namespace, *controller)
+	var parent *metav1.OwnerReference
+	switch controller.Kind {
+	case "ReplicaSet":
+		rs, err := r.client.AppsV1().ReplicaSets(namespace).Get(ctx, controller.Name, metav1.GetOptions{})
+		if err != nil {
+			r.Logger.Debugf("Error getting ReplicaSet %s/%s: %s", namespace, controller.Name, err)
+			return ref
+		}
+		parent = metav1.GetControllerOf(rs)
+	case "Job":
+		job, err := r.client.BatchV1().Jobs(namespace).Get(ctx, controller.Name, metav1.GetOptions{})
+		if err != nil {
+			r.Logger.Debugf("Error getting Job %s/%s: %s", namespace, controller.Name, err)
+			return ref
+		}
+		parent = metav1.GetControllerOf(job)
+	}
+	if parent != nil {
+		return reference(namespace, *parent)
+	}
+	return ref
+}
+
+// reference converts an owner reference into an object reference in namespace
+func reference(namespace string, owner metav1.OwnerReference) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		APIVersion: owner.APIVersion,
+		Kind:       owner.Kind,
+		Namespace:  namespace,
+		Name:       owner.Name,
+		UID:        owner.UID,
+	}
+}
@@ -0,0 +1,62 @@
+package events
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+// controllerRef returns a controller owner reference to the given object
+func controllerRef(apiVersion, kind, name string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{APIVersion: apiVersion, Kind: kind, Name: name, Controller: &controller}}
+}
+
+func TestOwner(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Name: "web-5d4f", Namespace: "team-a", OwnerReferences: controllerRef("apps/v1", "Deployment", "web"),
+		}},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+			Name: "backup-2891", Namespace: "team-a", OwnerReferences: controllerRef("batch/v1", "CronJob", "backup"),
+		}},
+	)
+	r := &Recorder{client: client, Logger: logrus.New()}
+
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		kind string
+		want string
+	}{
+		{name: "bare pod", pod: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "debug"}}, kind: "Pod", want: "debug"},
+		{name: "deployment", pod: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{OwnerReferences: controllerRef("apps/v1", "ReplicaSet", "web-5d4f")}}, kind: "Deployment", want: "web"},
+		{name: "cronjob", pod: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{OwnerReferences: controllerRef("batch/v1", "Job", "backup-2891")}}, kind: "CronJob", want: "backup"},
+		{name: "statefulset", pod: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{OwnerReferences: controllerRef("apps/v1", "StatefulSet", "db")}}, kind: "StatefulSet", want: "db"},
+		{name: "unknown replicaset", pod: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{OwnerReferences: controllerRef("apps/v1", "ReplicaSet", "gone")}}, kind: "ReplicaSet", want: "gone"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref := r.owner(context.TODO(), tt.pod, "team-a")
+			assert.Equal(t, tt.kind, ref.Kind)
+			assert.Equal(t, tt.want, ref.Name)
+			assert.Equal(t, "team-a", ref.Namespace)
+		})
+	}
+}
+
+func TestDenied(t *testing.T) {
+	recorder := record.NewFakeRecorder(1)
+	r := &Recorder{client: fake.NewSimpleClientset(), recorder: recorder, Logger: logrus.New()}
+
+	r.Denied(context.TODO(), &corev1.Pod{}, "team-a", "Invalid uid in pod, expected: 1001, found: 0\n")
+	assert.Equal(t, "Warning NFSUIDDenied Invalid uid in pod, expected: 1001, found: 0", <-recorder.Events)
+}
@@ -0,0 +1,215 @@
+// Package exemption decides whether pods are exempted from validation and
+// mutation, e.g. for emergency deploys or break-glass overrides, and checks that
+// the requester is allowed to exempt them
+package exemption
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/retry"
+	admissionv1 "k8s.io/api/admission/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// EnforceKey is the label or annotation exempting pods when set to "false",
+	// on the pod itself or on its namespace
+	EnforceKey = "nfs-access-control/enforce"
+
+	// OverrideKey is the annotation holding the reason of a break-glass override
+	OverrideKey = "nfs-access-control/override"
+
+	// Group, ExemptionsResource, OverrideResource and UseVerb describe the virtual
+	// resources the requester must be allowed to use to exempt pods, e.g. with a
+	// Role granting `use` on `exemptions.nfsaccess.io`
+	Group              = "nfsaccess.io"
+	ExemptionsResource = "exemptions"
+	OverrideResource   = "uidoverride"
+	UseVerb            = "use"
+)
+
+// Checker is a container for exemption checks
+type Checker struct {
+	client     kubernetes.Interface
+	factory    informers.SharedInformerFactory
+	informer   cache.SharedIndexInformer
+	namespaces corelisters.NamespaceLister
+
+	// Logger receives the audit entries of break-glass overrides
+	Logger logrus.FieldLogger
+	// Labels honors the EnforceKey label or annotation of pods and namespaces
+	Labels bool
+	// RequireAuthorization only honors labels of requesters allowed to use the
+	// exemptions resource in the pod namespace
+	RequireAuthorization bool
+	// BreakGlass honors the OverrideKey annotation of pods, only for requesters
+	// allowed to use the uidoverride resource in the pod namespace
+	BreakGlass bool
+	// Backoff retries the SubjectAccessReviews failing with a transient error
+	Backoff retry.Backoff
+}
+
+// NewChecker returns a Checker reading namespace labels from an informer cache,
+// the cache is only filled once Start is called. Every check is disabled until
+// enabled through the Checker fields.
+func NewChecker(client kubernetes.Interface) *Checker {
+	factory := informers.NewSharedInformerFactory(client, 0)
+	namespaces := factory.Core().V1().Namespaces()
+
+	return &Checker{
+		client:     client,
+		factory:    factory,
+		informer:   namespaces.Informer(),
+		namespaces: namespaces.Lister(),
+		Logger:     logrus.StandardLogger(),
+		Backoff:    retry.Backoff{Operation: "subject_access_review"},
+	}
+}
+
+// Start starts watching namespaces and blocks until the cache is synced
+func (c *Checker) Start(stopCh <-chan struct{}) error {
+	c.factory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, c.informer.HasSynced) {
+		return fmt.Errorf("failed to sync Namespace cache")
+	}
+	return nil
+}
+
+// Exempt returns true with a reason if pod is exempted from validation and mutation,
+// either by a break-glass override or through the EnforceKey label or annotation of
+// the pod or its namespace
+func (c *Checker) Exempt(ctx context.Context, pod *corev1.Pod, request *admissionv1.AdmissionRequest) (exempt bool, reason string, err error) {
+	if c.BreakGlass {
+		exempt, reason, err := c.override(ctx, pod, request)
+		if err != nil || exempt {
+			return exempt, reason, err
+		}
+	}
+	if c.Labels {
+		return c.labeled(ctx, pod, request)
+	}
+	return false, "", nil
+}
+
+// override returns true if pod carries a break-glass override annotation and the
+// requester may use the uidoverride resource, every use is audited
+func (c *Checker) override(ctx context.Context, pod *corev1.Pod, request *admissionv1.AdmissionRequest) (bool, string, error) {
+	overrideReason := strings.TrimSpace(pod.Annotations[OverrideKey])
+	if overrideReason == "" {
+		return false, "", nil
+	}
+
+	allowed, err := c.Authorized(ctx, request, OverrideResource, "")
+	if err != nil {
+		return false, "", err
+	}
+
+	audit := c.Logger.WithFields(logrus.Fields{
+		"audit":     "break-glass",
+		"user":      request.UserInfo.Username,
+		"namespace": request.Namespace,
+		"pod":       podName(pod),
+		"reason":    overrideReason,
+		"allowed":   allowed,
+		"dry_run":   request.DryRun != nil && *request.DryRun,
+	})
+	if !allowed {
+		audit.Warn("break-glass override denied, requester may not use uidoverride")
+		return false, "", nil
+	}
+	audit.Warn("break-glass override used")
+	return true, fmt.Sprintf("break-glass override by %s: %s", request.UserInfo.Username, overrideReason), nil
+}
+
+// labeled returns true if the pod or its namespace disable enforcement through the
+// EnforceKey label or annotation and, if required, the requester may use the
+// exemptions resource
+func (c *Checker) labeled(ctx context.Context, pod *corev1.Pod, request *admissionv1.AdmissionRequest) (bool, string, error) {
+	var reason string
+	switch {
+	case disabled(pod.ObjectMeta):
+		reason = "pod"
+	default:
+		namespace, err := c.namespaces.Get(request.Namespace)
+		if err != nil {
+			return false, "", fmt.Errorf("Error getting Namespace: %s\n", err)
+		}
+		if !disabled(namespace.ObjectMeta) {
+			return false, "", nil
+		}
+		reason = "namespace " + namespace.Name
+	}
+
+	if c.RequireAuthorization {
+		allowed, err := c.Authorized(ctx, request, ExemptionsResource, "")
+		if err != nil {
+			return false, "", err
+		}
+		if !allowed {
+			return false, "", nil
+		}
+	}
+	return true, fmt.Sprintf("enforcement disabled by %s=false on %s", EnforceKey, reason), nil
+}
+
+// Authorized returns true if the requester may use the given virtual resource of
+// the nfsaccess.io group in the pod namespace, checked with a SubjectAccessReview
+func (c *Checker) Authorized(ctx context.Context, request *admissionv1.AdmissionRequest, resource, name string) (bool, error) {
+	userInfo := request.UserInfo
+	extra := make(map[string]authorizationv1.ExtraValue, len(userInfo.Extra))
+	for k, v := range userInfo.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   userInfo.Username,
+			UID:    userInfo.UID,
+			Groups: userInfo.Groups,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: request.Namespace,
+				Verb:      UseVerb,
+				Group:     Group,
+				Resource:  resource,
+				Name:      name,
+			},
+		},
+	}
+	var res *authorizationv1.SubjectAccessReview
+	err := c.Backoff.Do(ctx, func() error {
+		var err error
+		res, err = c.client.AuthorizationV1().SubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("SubjectAccessReview failed: %w", err)
+	}
+	return res.Status.Allowed, nil
+}
+
+// podName returns the name of pod, or its generateName when not named yet
+func podName(pod *corev1.Pod) string {
+	if pod.Name != "" {
+		return pod.Name
+	}
+	return pod.GenerateName
+}
+
+// disabled returns true if enforcement is disabled by the labels or annotations of meta
+func disabled(meta metav1.ObjectMeta) bool {
+	if v, ok := meta.Labels[EnforceKey]; ok && strings.EqualFold(v, "false") {
+		return true
+	}
+	v, ok := meta.Annotations[EnforceKey]
+	return ok && strings.EqualFold(v, "false")
+}
@@ -0,0 +1,121 @@
+package exemption
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newClient returns a fake client answering SubjectAccessReviews with allowed
+// for the given user
+func newClient(allowedUser string, objects ...runtime.Object) *fake.Clientset {
+	client := fake.NewSimpleClientset(objects...)
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attrs := review.Spec.ResourceAttributes
+		review.Status.Allowed = review.Spec.User == allowedUser &&
+			attrs.Verb == UseVerb && attrs.Group == Group &&
+			(attrs.Resource == ExemptionsResource || attrs.Resource == OverrideResource)
+		return true, review, nil
+	})
+	return client
+}
+
+func TestExempt(t *testing.T) {
+	client := newClient("oncall",
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "emergency", Labels: map[string]string{EnforceKey: "false"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+	)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	c := NewChecker(client)
+	c.Labels = true
+	c.RequireAuthorization = true
+	if err := c.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	exemptPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{EnforceKey: "false"}}}
+	tests := []struct {
+		name      string
+		pod       *corev1.Pod
+		namespace string
+		user      string
+		exempt    bool
+	}{
+		{name: "pod annotation", pod: exemptPod, namespace: "default", user: "oncall", exempt: true},
+		{name: "namespace label", pod: &corev1.Pod{}, namespace: "emergency", user: "oncall", exempt: true},
+		{name: "not exempted", pod: &corev1.Pod{}, namespace: "default", user: "oncall", exempt: false},
+		{name: "unauthorized user", pod: exemptPod, namespace: "default", user: "dev", exempt: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &admissionv1.AdmissionRequest{
+				Namespace: tt.namespace,
+				UserInfo:  authenticationv1.UserInfo{Username: tt.user},
+			}
+			exempt, reason, err := c.Exempt(context.Background(), tt.pod, req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.exempt, exempt, reason)
+		})
+	}
+
+	// without authorization every exemption is honored
+	c.RequireAuthorization = false
+	exempt, _, err := c.Exempt(context.Background(), exemptPod, &admissionv1.AdmissionRequest{Namespace: "default"})
+	assert.NoError(t, err)
+	assert.True(t, exempt)
+}
+
+func TestBreakGlass(t *testing.T) {
+	client := newClient("oncall", &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}})
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	c := NewChecker(client)
+	c.BreakGlass = true
+	if err := c.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	overridden := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:        "restore",
+		Annotations: map[string]string{OverrideKey: "INC-1234 restore backups"},
+	}}
+
+	exempt, reason, err := c.Exempt(context.Background(), overridden, &admissionv1.AdmissionRequest{
+		Namespace: "default",
+		UserInfo:  authenticationv1.UserInfo{Username: "oncall"},
+	})
+	assert.NoError(t, err)
+	assert.True(t, exempt)
+	assert.Contains(t, reason, "INC-1234")
+
+	exempt, _, err = c.Exempt(context.Background(), overridden, &admissionv1.AdmissionRequest{
+		Namespace: "default",
+		UserInfo:  authenticationv1.UserInfo{Username: "dev"},
+	})
+	assert.NoError(t, err)
+	assert.False(t, exempt)
+
+	// pods without override annotation are not exempted, labels being disabled
+	exempt, _, err = c.Exempt(context.Background(), &corev1.Pod{}, &admissionv1.AdmissionRequest{
+		Namespace: "default",
+		UserInfo:  authenticationv1.UserInfo{Username: "oncall"},
+	})
+	assert.NoError(t, err)
+	assert.False(t, exempt)
+}
@@ -0,0 +1,105 @@
+// Package expiry reports the mapping entries that expired, which are ignored but
+// stay in the mappings until someone prunes them, e.g. the entries of contractors
+// that left
+package expiry
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/events"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/metrics"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// checkPeriod is the period at which the mappings are checked even without
+// changes, entries expiring as time goes by
+const checkPeriod = time.Minute
+
+// Reporter checks the mappings for expired entries, reporting them in the logs,
+// the expired_mappings metric and Events
+type Reporter struct {
+	mappings *mapping.Store
+
+	Logger *logrus.Entry
+	// Events emits an Event attached to the object holding every newly expired
+	// entry, nil disables them
+	Events *events.Recorder
+
+	mu      sync.Mutex
+	expired map[string]bool
+}
+
+// NewReporter returns a Reporter checking mappings
+func NewReporter(mappings *mapping.Store) *Reporter {
+	return &Reporter{
+		mappings: mappings,
+		Logger:   logrus.WithField("component", "expiry"),
+	}
+}
+
+// Run checks the mappings on every mapping change and every checkPeriod until
+// stopCh is closed, failures are logged and retried on the next check
+func (r *Reporter) Run(stopCh <-chan struct{}) error {
+	changed := make(chan struct{}, 1)
+	err := r.mappings.OnChange(func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(checkPeriod)
+		defer ticker.Stop()
+		for {
+			if _, err := r.Check(context.Background()); err != nil {
+				r.Logger.Errorf("cannot check expired mappings: %v", err)
+			}
+			select {
+			case <-stopCh:
+				return
+			case <-changed:
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// Check returns the expired entries of the mappings, records them in the
+// expired_mappings metric and reports the newly expired ones
+func (r *Reporter) Check(_ context.Context) ([]mapping.ExpiredEntry, error) {
+	entries, err := r.mappings.ExpiredEntries(metav1.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	byKind := map[string]int{}
+	expired := make(map[string]bool, len(entries))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range entries {
+		byKind[e.Kind]++
+		key := fmt.Sprintf("%s/%s/%s/%s", e.Kind, e.Namespace, e.Name, e.Subject)
+		expired[key] = true
+		if r.expired[key] {
+			continue
+		}
+		message := fmt.Sprintf("Mapping of %s expired at %s, prune it from %s %s", e.Subject, e.Expires.UTC().Format(time.RFC3339), e.Kind, e.Name)
+		r.Logger.WithFields(logrus.Fields{"subject": e.Subject, "kind": e.Kind, "name": e.Name}).Warn(message)
+		if r.Events != nil {
+			r.Events.MappingExpired(e.APIVersion, e.Kind, e.Namespace, e.Name, message)
+		}
+	}
+	r.expired = expired
+	metrics.SetExpiredMappings(byKind)
+	return entries, nil
+}
@@ -0,0 +1,59 @@
+package expiry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestReporterCheck(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: mapping.UIDConfigMapName, Namespace: "nfs"},
+		Data: map[string]string{
+			mapping.DocumentKey: `
+schemaVersion: v1
+subjects:
+  user1:
+    uid: 1001
+    expires: "2100-01-01T00:00:00Z"
+  contractor2:
+    uid: 1002
+    expires: "2001-01-01T00:00:00Z"
+  contractor1:
+    uid: 1003
+    expires: "2000-01-01T00:00:00Z"
+`,
+			// expired subjects don't fall back to their flat entry
+			"contractor1": "1003",
+		},
+	})
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	s := mapping.NewStore(client, "nfs")
+	if err := s.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+	r := NewReporter(s)
+	expired, err := r.Check(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, expired, 2) {
+		assert.Equal(t, "contractor1", expired[0].Subject)
+		assert.Equal(t, "contractor2", expired[1].Subject)
+		assert.Equal(t, mapping.ConfigMapKind, expired[0].Kind)
+		assert.Equal(t, mapping.UIDConfigMapName, expired[0].Name)
+	}
+
+	_, found, err := s.UIDs("contractor1")
+	assert.NoError(t, err)
+	assert.False(t, found)
+	subjects, err := s.Subjects()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"user1"}, subjects)
+}
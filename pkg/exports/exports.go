@@ -0,0 +1,201 @@
+// Package exports holds per-export policies, restricting the UIDs and GIDs allowed
+// to mount NFS exports and whether they must be mounted read-only
+package exports
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	"sigs.k8s.io/yaml"
+)
+
+// Rule restricts the access to the exports of Server under Path
+type Rule struct {
+	Server string
+	Path   string
+	// UIDs and GIDs allowed to mount the export, any when both are empty
+	UIDs mapping.IDRanges
+	GIDs mapping.IDRanges
+	// ReadOnly requires the export to be mounted read-only
+	ReadOnly bool
+	// RequireKerberos requires the export to be mounted with a Kerberos security
+	// flavor (sec=krb5, krb5i or krb5p), rejecting AUTH_SYS mounts
+	RequireKerberos bool
+}
+
+// Policy is a list of export rules, the rule with the longest path matching an
+// export applies to it
+type Policy struct {
+	Rules []Rule
+	// ReadOnlyPatterns are server:/path patterns of exports that must be mounted
+	// read-only, along with their subdirectories
+	ReadOnlyPatterns []string
+}
+
+// file is the format of export policy files, e.g.
+//
+//	exports:
+//	- export: nfs.example.com:/exports/teamA
+//	  uids: "2000-2099"
+//	  gids: "3000"
+//	  readOnly: false
+//	  requireKerberos: true
+type file struct {
+	Exports []struct {
+		Export          string `json:"export"`
+		UIDs            string `json:"uids,omitempty"`
+		GIDs            string `json:"gids,omitempty"`
+		ReadOnly        bool   `json:"readOnly,omitempty"`
+		RequireKerberos bool   `json:"requireKerberos,omitempty"`
+	} `json:"exports"`
+}
+
+// LoadFile reads a Policy from a YAML or JSON file
+func LoadFile(name string) (*Policy, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading export policy file: %s\n", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses a Policy in the YAML or JSON format of export policy files
+func Parse(data []byte) (*Policy, error) {
+	var f file
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, fmt.Errorf("Error parsing export policy: %s\n", err)
+	}
+
+	p := &Policy{}
+	for _, e := range f.Exports {
+		server, exportPath, ok := strings.Cut(e.Export, ":")
+		if !ok || server == "" || !path.IsAbs(exportPath) {
+			return nil, fmt.Errorf("invalid export %q, expected server:/path", e.Export)
+		}
+		rule := Rule{Server: server, Path: path.Clean(exportPath), ReadOnly: e.ReadOnly, RequireKerberos: e.RequireKerberos}
+
+		var err error
+		if e.UIDs != "" {
+			if rule.UIDs, err = mapping.ParseIDRanges(e.UIDs); err != nil {
+				return nil, fmt.Errorf("invalid uids of export %s: %v", e.Export, err)
+			}
+		}
+		if e.GIDs != "" {
+			if rule.GIDs, err = mapping.ParseIDRanges(e.GIDs); err != nil {
+				return nil, fmt.Errorf("invalid gids of export %s: %v", e.Export, err)
+			}
+		}
+		p.Rules = append(p.Rules, rule)
+	}
+	return p, nil
+}
+
+// Match returns the rule with the longest path prefix of exportPath on server,
+// nil if no rule matches
+func (p *Policy) Match(server, exportPath string) *Rule {
+	exportPath = path.Clean(exportPath)
+
+	var match *Rule
+	for i, rule := range p.Rules {
+		if !strings.EqualFold(rule.Server, server) || !hasPathPrefix(exportPath, rule.Path) {
+			continue
+		}
+		if match == nil || len(rule.Path) > len(match.Path) {
+			match = &p.Rules[i]
+		}
+	}
+	return match
+}
+
+// ReadOnly returns true with the matching rule or pattern if the export at
+// exportPath on server must be mounted read-only
+func (p *Policy) ReadOnly(server, exportPath string) (string, bool) {
+	if rule := p.Match(server, exportPath); rule != nil && rule.ReadOnly {
+		return rule.String(), true
+	}
+
+	// subdirectories of read-only exports are read-only as well
+	for dir := path.Clean(exportPath); ; dir = path.Dir(dir) {
+		for _, pattern := range p.ReadOnlyPatterns {
+			if ok, _ := path.Match(pattern, server+":"+dir); ok {
+				return pattern, true
+			}
+		}
+		if dir == "/" || dir == "." {
+			return "", false
+		}
+	}
+}
+
+// ParseReadOnlyPatterns parses a comma separated list of server:/path patterns,
+// e.g. "nfs.example.com:/exports/archive,*:/backup/*"
+func ParseReadOnlyPatterns(value string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if server, _, ok := strings.Cut(pattern, ":"); !ok || server == "" {
+			return nil, fmt.Errorf("invalid read-only export pattern %q, expected server:/path", pattern)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid read-only export pattern %q: %v", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// hasPathPrefix returns true if p is prefix or one of its subdirectories
+func hasPathPrefix(p, prefix string) bool {
+	return prefix == "/" || p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// Allows returns true if a process running as uid (nil if unknown) with gids
+// may mount the export
+func (r Rule) Allows(uid *int64, gids []int64) bool {
+	if len(r.UIDs) == 0 && len(r.GIDs) == 0 {
+		return true
+	}
+	if uid != nil && r.UIDs.Contains(*uid) {
+		return true
+	}
+	for _, gid := range gids {
+		if r.GIDs.Contains(gid) {
+			return true
+		}
+	}
+	return false
+}
+
+// kerberosFlavors are the NFS security flavors using Kerberos
+var kerberosFlavors = map[string]bool{"krb5": true, "krb5i": true, "krb5p": true}
+
+// AllowsSecurity returns true if the export may be mounted with the security
+// flavors of the sec mount option, none when sec isn't set
+func (r Rule) AllowsSecurity(flavors []string) bool {
+	return !r.RequireKerberos || IsKerberos(flavors)
+}
+
+// IsKerberos returns true if every security flavor of the sec mount option uses
+// Kerberos, false when sec isn't set
+func IsKerberos(flavors []string) bool {
+	if len(flavors) == 0 {
+		return false
+	}
+	for _, flavor := range flavors {
+		if !kerberosFlavors[flavor] {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the server:/path of the exports matched by r
+func (r Rule) String() string {
+	return r.Server + ":" + r.Path
+}
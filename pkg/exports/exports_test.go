@@ -0,0 +1,121 @@
+package exports
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+)
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte(`
+exports:
+- export: nfs.example.com:/exports/teamA/
+  uids: "2000-2099"
+  gids: "3000"
+- export: nfs.example.com:/exports/archive
+  readOnly: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []Rule{
+		{Server: "nfs.example.com", Path: "/exports/teamA", UIDs: mapping.IDRanges{{Min: 2000, Max: 2099}}, GIDs: mapping.SingleID(3000)},
+		{Server: "nfs.example.com", Path: "/exports/archive", ReadOnly: true},
+	}, p.Rules)
+
+	for _, invalid := range []string{
+		"exports:\n- export: /exports/teamA\n",
+		"exports:\n- export: nfs.example.com:exports\n",
+		"exports:\n- export: nfs.example.com:/exports\n  uids: abc\n",
+		"exports:\n- export: nfs.example.com:/exports\n  uid: 1000\n",
+	} {
+		_, err := Parse([]byte(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	p := &Policy{Rules: []Rule{
+		{Server: "nfs.example.com", Path: "/exports"},
+		{Server: "nfs.example.com", Path: "/exports/teamA", UIDs: mapping.SingleID(2000)},
+		{Server: "nfs.example.com", Path: "/exports/teamB", UIDs: mapping.SingleID(2001)},
+	}}
+
+	tests := []struct {
+		server string
+		path   string
+		want   string
+	}{
+		{server: "nfs.example.com", path: "/exports/teamA", want: "nfs.example.com:/exports/teamA"},
+		{server: "NFS.example.com", path: "/exports/teamA/data/", want: "nfs.example.com:/exports/teamA"},
+		{server: "nfs.example.com", path: "/exports/teamAB", want: "nfs.example.com:/exports"},
+		{server: "nfs.example.com", path: "/home", want: ""},
+		{server: "other.example.com", path: "/exports/teamA", want: ""},
+	}
+	for _, tt := range tests {
+		rule := p.Match(tt.server, tt.path)
+		if tt.want == "" {
+			assert.Nil(t, rule, tt.path)
+			continue
+		}
+		if assert.NotNil(t, rule, tt.path) {
+			assert.Equal(t, tt.want, rule.String())
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	patterns, err := ParseReadOnlyPatterns("nfs.example.com:/exports/archive, *:/backup/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Policy{
+		Rules:            []Rule{{Server: "nfs.example.com", Path: "/exports/legal", ReadOnly: true}},
+		ReadOnlyPatterns: patterns,
+	}
+
+	tests := []struct {
+		server   string
+		path     string
+		readOnly bool
+	}{
+		{server: "nfs.example.com", path: "/exports/archive", readOnly: true},
+		{server: "nfs.example.com", path: "/exports/archive/2023/", readOnly: true},
+		{server: "nfs.example.com", path: "/exports/archived", readOnly: false},
+		{server: "other.example.com", path: "/backup/db", readOnly: true},
+		{server: "other.example.com", path: "/backup", readOnly: false},
+		{server: "nfs.example.com", path: "/exports/legal/contracts", readOnly: true},
+		{server: "nfs.example.com", path: "/exports/teamA", readOnly: false},
+	}
+	for _, tt := range tests {
+		_, readOnly := p.ReadOnly(tt.server, tt.path)
+		assert.Equal(t, tt.readOnly, readOnly, tt.server+":"+tt.path)
+	}
+
+	_, err = ParseReadOnlyPatterns("/exports/archive")
+	assert.Error(t, err)
+	_, err = ParseReadOnlyPatterns("nfs:/exports/[")
+	assert.Error(t, err)
+}
+
+func TestAllowsSecurity(t *testing.T) {
+	rule := Rule{RequireKerberos: true}
+	assert.True(t, rule.AllowsSecurity([]string{"krb5"}))
+	assert.True(t, rule.AllowsSecurity([]string{"krb5i", "krb5p"}))
+	assert.False(t, rule.AllowsSecurity([]string{"krb5", "sys"}))
+	assert.False(t, rule.AllowsSecurity(nil))
+	assert.True(t, Rule{}.AllowsSecurity([]string{"sys"}))
+}
+
+func TestAllows(t *testing.T) {
+	uid := func(id int64) *int64 { return &id }
+	rule := Rule{UIDs: mapping.SingleID(2000), GIDs: mapping.SingleID(3000)}
+
+	assert.True(t, rule.Allows(uid(2000), nil))
+	assert.True(t, rule.Allows(uid(1000), []int64{1000, 3000}))
+	assert.True(t, rule.Allows(nil, []int64{3000}))
+	assert.False(t, rule.Allows(uid(2001), []int64{2001}))
+	assert.False(t, rule.Allows(nil, nil))
+	assert.True(t, Rule{ReadOnly: true}.Allows(nil, nil))
+}
@@ -0,0 +1,52 @@
+package ganesha
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	// dbusName, dbusPath and updateExport address the export manager of NFS-Ganesha
+	dbusName     = "org.ganesha.nfsd"
+	dbusPath     = "/org/ganesha/nfsd/ExportMgr"
+	updateExport = "org.ganesha.nfsd.exportmgr.UpdateExport"
+)
+
+// DBusManager updates exports with the D-Bus export manager of NFS-Ganesha: the
+// EXPORT block is written to a file of ConfigDir, a directory shared with the
+// NFS-Ganesha server, which is then told to reload the export from it
+type DBusManager struct {
+	conn *dbus.Conn
+	// ConfigDir is the directory export blocks are written to
+	ConfigDir string
+}
+
+// NewDBusManager connects to the D-Bus of NFS-Ganesha at address, e.g.
+// unix:path=/run/dbus/system_bus_socket
+func NewDBusManager(address, configDir string) (*DBusManager, error) {
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		return nil, fmt.Errorf("Error connecting to D-Bus: %s\n", err)
+	}
+	return &DBusManager{conn: conn, ConfigDir: configDir}, nil
+}
+
+// UpdateExport writes the EXPORT block of e granting access to clients and
+// reloads it in NFS-Ganesha
+func (m *DBusManager) UpdateExport(ctx context.Context, e Export, clients []string) error {
+	name := filepath.Join(m.ConfigDir, fmt.Sprintf("export-%d.conf", e.ID))
+	if err := os.WriteFile(name, []byte(e.Block(clients)), 0o644); err != nil {
+		return fmt.Errorf("Error writing export %d: %s\n", e.ID, err)
+	}
+
+	var message string
+	call := m.conn.Object(dbusName, dbusPath).CallWithContext(ctx, updateExport, 0, name, fmt.Sprintf("EXPORT(Export_Id=%d)", e.ID))
+	if err := call.Store(&message); err != nil {
+		return fmt.Errorf("Error updating export %d: %s\n", e.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// Package ganesha keeps the client lists of NFS-Ganesha exports in sync with the
+// nodes running admitted pods that mount them, through the D-Bus export manager
+// of NFS-Ganesha
+package ganesha
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Export is an NFS-Ganesha export managed by the webhook
+type Export struct {
+	// ID is the Export_Id of the export in the NFS-Ganesha configuration
+	ID int `json:"id"`
+	// Path is the exported path, as mounted by pods
+	Path string `json:"path"`
+	// Pseudo is the NFSv4 pseudo path of the export, Path when empty
+	Pseudo string `json:"pseudo,omitempty"`
+	// ReadOnly exports only grant read-only access to clients
+	ReadOnly bool `json:"readOnly,omitempty"`
+	// AnonymousUID is the UID root is squashed to, NFS-Ganesha's default when nil
+	AnonymousUID *int64 `json:"anonymousUid,omitempty"`
+	// FSAL is the name of the FSAL backing the export, VFS when empty
+	FSAL string `json:"fsal,omitempty"`
+}
+
+// Config is the format of the Ganesha integration file, e.g.
+//
+//	server: nfs.example.com
+//	exports:
+//	- id: 10
+//	  path: /exports/teamA
+//	  pseudo: /teamA
+type Config struct {
+	// Server is the NFS server name or address pods mount the exports from
+	Server  string   `json:"server"`
+	Exports []Export `json:"exports"`
+}
+
+// LoadConfig reads a Config from a YAML or JSON file
+func LoadConfig(name string) (*Config, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading Ganesha config file: %s\n", err)
+	}
+	var c Config
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("Error parsing Ganesha config: %s\n", err)
+	}
+	if c.Server == "" {
+		return nil, fmt.Errorf("invalid Ganesha config, server is not set")
+	}
+	for i, e := range c.Exports {
+		if e.ID <= 0 || !path.IsAbs(e.Path) {
+			return nil, fmt.Errorf("invalid Ganesha export %d, expected a positive id and an absolute path", i)
+		}
+		c.Exports[i].Path = path.Clean(e.Path)
+	}
+	return &c, nil
+}
+
+// Block renders the EXPORT block of e granting access to clients, root is
+// squashed so that pods can only act as the UIDs they were admitted with
+func (e Export) Block(clients []string) string {
+	pseudo := e.Pseudo
+	if pseudo == "" {
+		pseudo = e.Path
+	}
+	fsal := e.FSAL
+	if fsal == "" {
+		fsal = "VFS"
+	}
+	access := "RW"
+	if e.ReadOnly {
+		access = "RO"
+	}
+	clients = append([]string(nil), clients...)
+	sort.Strings(clients)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "EXPORT {\n")
+	fmt.Fprintf(&b, "\tExport_Id = %d;\n\tPath = %q;\n\tPseudo = %q;\n", e.ID, e.Path, pseudo)
+	fmt.Fprintf(&b, "\tAccess_Type = None;\n\tSquash = Root_Squash;\n")
+	if e.AnonymousUID != nil {
+		fmt.Fprintf(&b, "\tAnonymous_Uid = %d;\n", *e.AnonymousUID)
+	}
+	fmt.Fprintf(&b, "\tFSAL {\n\t\tName = %s;\n\t}\n", fsal)
+	if len(clients) > 0 {
+		fmt.Fprintf(&b, "\tCLIENT {\n\t\tClients = %s;\n\t\tAccess_Type = %s;\n\t}\n", strings.Join(clients, ", "), access)
+	}
+	fmt.Fprintf(&b, "}\n")
+	return b.String()
+}
+
+// Manager updates the exports of an NFS-Ganesha server
+type Manager interface {
+	UpdateExport(ctx context.Context, e Export, clients []string) error
+}
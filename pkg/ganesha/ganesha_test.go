@@ -0,0 +1,98 @@
+package ganesha
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/nfs"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// recordingManager records the clients of every updated export
+type recordingManager map[int][]string
+
+func (m recordingManager) UpdateExport(_ context.Context, e Export, clients []string) error {
+	m[e.ID] = clients
+	return nil
+}
+
+func TestLoadConfig(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "ganesha.yaml")
+	err := os.WriteFile(name, []byte("server: nfs.example.com\nexports:\n- id: 10\n  path: /exports/teamA/\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadConfig(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &Config{Server: "nfs.example.com", Exports: []Export{{ID: 10, Path: "/exports/teamA"}}}, c)
+
+	if err := os.WriteFile(name, []byte("server: nfs.example.com\nexports:\n- path: /exports/teamA\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadConfig(name)
+	assert.Error(t, err)
+}
+
+func TestBlock(t *testing.T) {
+	anonymous := int64(65534)
+	block := Export{ID: 10, Path: "/exports/archive", ReadOnly: true, AnonymousUID: &anonymous}.Block([]string{"10.0.0.2", "10.0.0.1"})
+
+	assert.Contains(t, block, "Export_Id = 10;")
+	assert.Contains(t, block, `Pseudo = "/exports/archive";`)
+	assert.Contains(t, block, "Squash = Root_Squash;")
+	assert.Contains(t, block, "Anonymous_Uid = 65534;")
+	assert.Contains(t, block, "Clients = 10.0.0.1, 10.0.0.2;\n\t\tAccess_Type = RO;")
+
+	assert.NotContains(t, Export{ID: 11, Path: "/exports/teamA"}.Block(nil), "CLIENT")
+}
+
+func TestSync(t *testing.T) {
+	pod := func(name, hostIP string, phase corev1.PodPhase, path string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team-a"},
+			Spec: corev1.PodSpec{Volumes: []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{
+				NFS: &corev1.NFSVolumeSource{Server: "nfs.example.com", Path: path},
+			}}}},
+			Status: corev1.PodStatus{HostIP: hostIP, Phase: phase},
+		}
+	}
+	client := fake.NewSimpleClientset(
+		pod("a", "10.0.0.2", corev1.PodRunning, "/exports/teamA"),
+		pod("b", "10.0.0.1", corev1.PodRunning, "/exports/teamA/data"),
+		pod("c", "10.0.0.3", corev1.PodSucceeded, "/exports/teamA"),
+		pod("d", "", corev1.PodPending, "/exports/teamA"),
+		pod("e", "10.0.0.4", corev1.PodRunning, "/exports/teamB"),
+	)
+	manager := recordingManager{}
+	config := &Config{Server: "nfs.example.com", Exports: []Export{{ID: 10, Path: "/exports/teamA"}, {ID: 11, Path: "/exports/archive"}}}
+	c := NewController(client, nfs.NewDetector(client), manager, config)
+	c.Logger = logrus.New()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	if err := c.nodes.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Sync(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, manager[10])
+	assert.Contains(t, manager, 11)
+	assert.Empty(t, manager[11])
+
+	// unchanged exports are not updated again
+	delete(manager, 10)
+	if err := c.Sync(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotContains(t, manager, 10)
+}
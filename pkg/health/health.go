@@ -0,0 +1,105 @@
+// Package health serves the liveness and readiness endpoints of the webhook,
+// readiness is made of named checks registered at startup
+package health
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Check returns an error while the webhook is not able to admit pods
+type Check func() error
+
+// namedCheck is a readiness check and the name it is reported with
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker is a container for the readiness checks
+type Checker struct {
+	mu     sync.RWMutex
+	checks []namedCheck
+
+	shuttingDown atomic.Bool
+}
+
+// NewChecker returns a Checker without readiness checks
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// AddReadinessCheck registers a readiness check under name
+func (c *Checker) AddReadinessCheck(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Shutdown makes the webhook unready for good, so that it is removed from the
+// endpoints of its Service before it stops serving
+func (c *Checker) Shutdown() {
+	c.shuttingDown.Store(true)
+}
+
+// Ready returns the error of the first failing readiness check
+func (c *Checker) Ready() error {
+	if c.shuttingDown.Load() {
+		return fmt.Errorf("shutting down")
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, nc := range c.checks {
+		if err := nc.check(); err != nil {
+			return fmt.Errorf("%s: %v", nc.name, err)
+		}
+	}
+	return nil
+}
+
+// ServeHealthz returns 200 as long as the webhook server is answering
+func (c *Checker) ServeHealthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "ok")
+}
+
+// ServeReadyz returns 200 when every readiness check passes, 503 otherwise
+func (c *Checker) ServeReadyz(w http.ResponseWriter, r *http.Request) {
+	if err := c.Ready(); err != nil {
+		logrus.WithField("uri", r.RequestURI).Warnf("not ready: %v", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprint(w, "ok")
+}
+
+// CertificateCheck returns a Check failing when the TLS serving certificate
+// can't be loaded or is not valid at the current time. The files are read on
+// every check so that renewed certificates are picked up.
+func CertificateCheck(certFile, keyFile string) Check {
+	return func() error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("cannot load TLS certificate: %v", err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("cannot parse TLS certificate: %v", err)
+		}
+		now := time.Now()
+		if now.Before(leaf.NotBefore) {
+			return fmt.Errorf("TLS certificate not valid before %s", leaf.NotBefore)
+		}
+		if now.After(leaf.NotAfter) {
+			return fmt.Errorf("TLS certificate expired on %s", leaf.NotAfter)
+		}
+		return nil
+	}
+}
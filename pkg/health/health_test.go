@@ -0,0 +1,83 @@
+package health
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeReadyz(t *testing.T) {
+	c := NewChecker()
+
+	readyz := func() int {
+		w := httptest.NewRecorder()
+		c.ServeReadyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return w.Code
+	}
+
+	var mappingErr error
+	c.AddReadinessCheck("mapping", func() error { return mappingErr })
+	c.AddReadinessCheck("certificate", func() error { return nil })
+	assert.Equal(t, http.StatusOK, readyz())
+
+	mappingErr = errors.New("not loaded")
+	assert.Equal(t, http.StatusServiceUnavailable, readyz())
+	assert.EqualError(t, c.Ready(), "mapping: not loaded")
+
+	mappingErr = nil
+	c.Shutdown()
+	assert.Equal(t, http.StatusServiceUnavailable, readyz())
+	assert.EqualError(t, c.Ready(), "shutting down")
+}
+
+func TestCertificateCheck(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	valid := writeCertificate(t, dir, "valid", now.Add(-time.Hour), now.Add(time.Hour))
+	assert.NoError(t, CertificateCheck(valid+".crt", valid+".key")())
+
+	expired := writeCertificate(t, dir, "expired", now.Add(-2*time.Hour), now.Add(-time.Hour))
+	assert.ErrorContains(t, CertificateCheck(expired+".crt", expired+".key")(), "expired")
+
+	assert.Error(t, CertificateCheck(filepath.Join(dir, "missing.crt"), filepath.Join(dir, "missing.key"))())
+}
+
+// writeCertificate writes a self-signed certificate and its key to <dir>/<name>.crt
+// and <dir>/<name>.key, it returns <dir>/<name>
+func writeCertificate(t *testing.T, dir, name string, notBefore, notAfter time.Time) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: notBefore, NotAfter: notAfter}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path+".crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+".key", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
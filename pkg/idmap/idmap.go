@@ -0,0 +1,185 @@
+// Package idmap renders the UID and GID mappings into a ConfigMap consumable on
+// nodes as idmapd.conf static entries or nfsidmap keyring entries, keeping the
+// Kubernetes and node side identity mappings in sync
+package idmap
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// ConfigMapName is the name of the rendered ConfigMap by default
+	ConfigMapName = "nfs-pod-access-control-idmap"
+	// IdmapdKey holds an idmapd.conf file with a static entry per user/serviceAccount
+	IdmapdKey = "idmapd.conf"
+	// KeyringKey holds nfsidmap keyring entries, one "uid:name@domain uid" and one
+	// "gid:name@domain gid" line per user/serviceAccount
+	KeyringKey = "nfsidmap.keys"
+
+	// resyncPeriod is the period at which the ConfigMap is rendered even without changes
+	resyncPeriod = 10 * time.Minute
+)
+
+// Identity is the NFS identity of a user/serviceAccount
+type Identity struct {
+	Name string
+	UID  int64
+	// GID is the primary group, nil if the user/serviceAccount has no GID
+	GID *int64
+}
+
+// Render returns the ConfigMap data of identities in the NFSv4 domain
+func Render(domain string, identities []Identity) map[string]string {
+	var idmapd, keys strings.Builder
+	fmt.Fprintf(&idmapd, "# Rendered by nfs-pod-access-control from the UID mapping, do not edit\n")
+	fmt.Fprintf(&idmapd, "[General]\nDomain = %s\n\n[Translation]\nMethod = static,nsswitch\n\n[Static]\n", domain)
+	for _, id := range identities {
+		fmt.Fprintf(&idmapd, "%s@%s = %s\n", id.Name, domain, id.Name)
+		fmt.Fprintf(&keys, "uid:%s@%s %d\n", id.Name, domain, id.UID)
+		if id.GID != nil {
+			fmt.Fprintf(&keys, "gid:%s@%s %d\n", id.Name, domain, *id.GID)
+		}
+	}
+	return map[string]string{IdmapdKey: idmapd.String(), KeyringKey: keys.String()}
+}
+
+// Controller renders the mappings into a ConfigMap whenever they change
+type Controller struct {
+	client   kubernetes.Interface
+	mappings *mapping.Store
+
+	Logger logrus.FieldLogger
+	// Namespace and Name of the rendered ConfigMap
+	Namespace string
+	Name      string
+	// Domain is the NFSv4 domain of the identities
+	Domain string
+}
+
+// NewController returns a Controller rendering mappings into the ConfigMap
+// ConfigMapName of namespace, with the identities of the NFSv4 domain
+func NewController(client kubernetes.Interface, mappings *mapping.Store, namespace, domain string) *Controller {
+	return &Controller{
+		client:    client,
+		mappings:  mappings,
+		Logger:    logrus.StandardLogger(),
+		Namespace: namespace,
+		Name:      ConfigMapName,
+		Domain:    domain,
+	}
+}
+
+// Run renders the ConfigMap on every mapping change and every resyncPeriod until
+// stopCh is closed, failures are logged and retried on the next change or resync
+func (c *Controller) Run(stopCh <-chan struct{}) error {
+	changed := make(chan struct{}, 1)
+	err := c.mappings.OnChange(func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(resyncPeriod)
+		defer ticker.Stop()
+		for {
+			if err := c.Sync(context.Background()); err != nil {
+				c.Logger.Errorf("cannot render idmap ConfigMap %s: %v", c.Name, err)
+			}
+			select {
+			case <-stopCh:
+				return
+			case <-changed:
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// Sync renders the mappings into the ConfigMap, creating it if needed
+func (c *Controller) Sync(ctx context.Context) error {
+	identities, err := c.identities()
+	if err != nil {
+		return err
+	}
+	data := Render(c.Domain, identities)
+
+	configMaps := c.client.CoreV1().ConfigMaps(c.Namespace)
+	current, err := configMaps.Get(ctx, c.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = configMaps.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: c.Name, Namespace: c.Namespace},
+			Data:       data,
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("Error creating ConfigMap: %s\n", err)
+		}
+		c.Logger.Infof("Rendered %d identities into ConfigMap %s", len(identities), c.Name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error getting ConfigMap: %s\n", err)
+	}
+	if reflect.DeepEqual(current.Data, data) {
+		return nil
+	}
+
+	updated := current.DeepCopy()
+	updated.Data = data
+	if _, err := configMaps.Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("Error updating ConfigMap: %s\n", err)
+	}
+	c.Logger.Infof("Rendered %d identities into ConfigMap %s", len(identities), c.Name)
+	return nil
+}
+
+// identities returns the identity of every user/serviceAccount of the mappings,
+// skipping the ones without UID and the names idmapd can't parse
+func (c *Controller) identities() ([]Identity, error) {
+	subjects, err := c.mappings.Subjects()
+	if err != nil {
+		return nil, err
+	}
+
+	var identities []Identity
+	for _, subject := range subjects {
+		if strings.ContainsAny(subject, " \t=@#") {
+			c.Logger.Warnf("skipping %q, it can't be rendered as an idmap entry", subject)
+			continue
+		}
+		uid, found, err := c.mappings.UID(subject)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+		id := Identity{Name: subject, UID: uid}
+
+		gids, found, err := c.mappings.GIDs(subject)
+		if err != nil {
+			return nil, err
+		}
+		if found && len(gids) > 0 {
+			id.GID = &gids[0]
+		}
+		identities = append(identities, id)
+	}
+	return identities, nil
+}
@@ -0,0 +1,55 @@
+package idmap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRender(t *testing.T) {
+	gid := int64(3000)
+	data := Render("example.com", []Identity{{Name: "user1", UID: 1001, GID: &gid}, {Name: "backup", UID: 2000}})
+
+	assert.Contains(t, data[IdmapdKey], "Domain = example.com\n")
+	assert.Contains(t, data[IdmapdKey], "[Static]\nuser1@example.com = user1\nbackup@example.com = backup\n")
+	assert.Equal(t, "uid:user1@example.com 1001\ngid:user1@example.com 3000\nuid:backup@example.com 2000\n", data[KeyringKey])
+}
+
+func TestSync(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: mapping.UIDConfigMapName, Namespace: "nfs"},
+			Data:       map[string]string{"user1": "1001", "user2": "1002-1005", "bad name": "1006"},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: mapping.GIDConfigMapName, Namespace: "nfs"},
+			Data:       map[string]string{"user1": "3000,3001"},
+		},
+	)
+	mappings := mapping.NewStore(client, "nfs")
+	stop := make(chan struct{})
+	defer close(stop)
+	if err := mappings.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewController(client, mappings, "nfs", "example.com")
+	c.Logger = logrus.New()
+	for i := 0; i < 2; i++ {
+		if err := c.Sync(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rendered, err := client.CoreV1().ConfigMaps("nfs").Get(context.TODO(), ConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "uid:user1@example.com 1001\ngid:user1@example.com 3000\nuid:user2@example.com 1002\n", rendered.Data[KeyringKey])
+}
@@ -0,0 +1,225 @@
+package mapping
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// DocumentKey is the key of the structured mapping document of the UID
+	// mapping object, holding the UIDs and GIDs of every subject
+	DocumentKey = "mapping.yaml"
+
+	// SchemaVersion is the schemaVersion of the documents read by the Store
+	SchemaVersion = "v1"
+)
+
+// Document is the structured mapping document, e.g.
+//
+//	schemaVersion: v1
+//	subjects:
+//	  user1:
+//	    uid: 1001
+//	    gids: [1001, 3000]
+//	  system:serviceaccount:ci:builder:
+//	    uids: "2000-2099,2500"
+//	    expires: "2025-12-31T00:00:00Z"
+//	    comment: CI builders, see INFRA-123
+//	  sa-tenant-a:
+//	    uid: 3000
+//	    seLinux:
+//	      level: "s0:c123,c456"
+//	  nightly-batch:
+//	    uid: 4000
+//	    windows:
+//	    - days: [Mon, Tue, Wed, Thu, Fri]
+//	      start: "22:00"
+//	      end: "06:00"
+//	      timeZone: Europe/Paris
+type Document struct {
+	SchemaVersion string           `json:"schemaVersion"`
+	Subjects      map[string]Entry `json:"subjects,omitempty"`
+}
+
+// Entry is the identity of a subject in a Document
+type Entry struct {
+	// UID is a single UID, shorthand for UIDs
+	UID *int64 `json:"uid,omitempty"`
+	// UIDs lists UIDs and inclusive UID ranges, e.g. "1000-1999,2500"
+	UIDs string `json:"uids,omitempty"`
+	// GIDs are the groups of the subject
+	GIDs []int64 `json:"gids,omitempty"`
+	// Expires is the time from which the entry is ignored, it never expires when unset
+	Expires *metav1.Time `json:"expires,omitempty"`
+	// Comment documents the entry, e.g. its owner or the ticket granting it
+	Comment string `json:"comment,omitempty"`
+	// SELinux are the seLinuxOptions the pods of the subject mounting NFS must
+	// run with, only the fields set are required, e.g. the MCS level
+	SELinux *corev1.SELinuxOptions `json:"seLinux,omitempty"`
+	// Windows are the time windows during which the pods of the subject mounting
+	// NFS may be created, any time when empty
+	Windows []TimeWindow `json:"windows,omitempty"`
+}
+
+// ParseDocument parses and validates a structured mapping document, unknown fields
+// and schema versions are rejected
+func ParseDocument(data []byte) (*Document, error) {
+	var d Document
+	if err := yaml.UnmarshalStrict(data, &d); err != nil {
+		return nil, err
+	}
+	if d.SchemaVersion != SchemaVersion {
+		return nil, fmt.Errorf("unsupported schemaVersion %q, expected %s", d.SchemaVersion, SchemaVersion)
+	}
+	for subject, entry := range d.Subjects {
+		if entry.UID != nil && entry.UIDs != "" {
+			return nil, fmt.Errorf("subject %s sets both uid and uids", subject)
+		}
+		if entry.UIDs != "" {
+			if _, err := ParseIDRanges(entry.UIDs); err != nil {
+				return nil, fmt.Errorf("invalid uids of %s: %v", subject, err)
+			}
+		}
+		if entry.SELinux != nil && *entry.SELinux == (corev1.SELinuxOptions{}) {
+			return nil, fmt.Errorf("seLinux of %s sets no option", subject)
+		}
+		for _, w := range entry.Windows {
+			if err := w.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid window of %s: %v", subject, err)
+			}
+		}
+	}
+	return &d, nil
+}
+
+// NewDocument converts the flat entries of the UID and GID mapping objects into
+// a Document, e.g. to migrate from the legacy format
+func NewDocument(uids, gids map[string]string) (*Document, error) {
+	d := &Document{SchemaVersion: SchemaVersion, Subjects: map[string]Entry{}}
+	for subject, value := range uids {
+		if subject == DocumentKey {
+			continue
+		}
+		ranges, err := ParseIDRanges(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UIDs of %s: %v", subject, err)
+		}
+		entry := d.Subjects[subject]
+		if len(ranges) == 1 && ranges[0].Min == ranges[0].Max {
+			entry.UID = &ranges[0].Min
+		} else {
+			entry.UIDs = ranges.String()
+		}
+		d.Subjects[subject] = entry
+	}
+	for subject, value := range gids {
+		if subject == DocumentKey {
+			continue
+		}
+		ids, err := ParseIDList(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GIDs of %s: %v", subject, err)
+		}
+		entry := d.Subjects[subject]
+		entry.GIDs = ids
+		d.Subjects[subject] = entry
+	}
+	return d, nil
+}
+
+// entry returns the entry of subject, expired entries are ignored. A nil Document
+// has no entry.
+func (d *Document) entry(subject string, now time.Time) (Entry, bool) {
+	if d == nil {
+		return Entry{}, false
+	}
+	entry, ok := d.Subjects[subject]
+	if !ok || (entry.Expires != nil && !now.Before(entry.Expires.Time)) {
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+// expired returns true if subject has an entry that expired at now. A nil
+// Document has no entry.
+func (d *Document) expired(subject string, now time.Time) bool {
+	if d == nil {
+		return false
+	}
+	entry, ok := d.Subjects[subject]
+	return ok && entry.Expires != nil && !now.Before(entry.Expires.Time)
+}
+
+// subjects returns the subjects of the Document whose entry is not expired
+func (d *Document) subjects(now time.Time) []string {
+	if d == nil {
+		return nil
+	}
+	var subjects []string
+	for subject := range d.Subjects {
+		if _, ok := d.entry(subject, now); ok {
+			subjects = append(subjects, subject)
+		}
+	}
+	sort.Strings(subjects)
+	return subjects
+}
+
+// uidValue returns the UIDs of the entry in the format of the flat entries
+func (e Entry) uidValue() string {
+	if e.UID != nil {
+		return strconv.FormatInt(*e.UID, 10)
+	}
+	return e.UIDs
+}
+
+// gidValue returns the GIDs of the entry in the format of the flat entries
+func (e Entry) gidValue() string {
+	fields := make([]string, len(e.GIDs))
+	for i, gid := range e.GIDs {
+		fields[i] = strconv.FormatInt(gid, 10)
+	}
+	return strings.Join(fields, ",")
+}
+
+// cachedDocument is the Document parsed from a version of a mapping object
+type cachedDocument struct {
+	resourceVersion string
+	document        *Document
+	err             error
+}
+
+// document returns the Document of a cached mapping object, nil if the object is
+// nil or has no DocumentKey entry. Documents are parsed once per object version.
+func (s *Store) document(obj interface{}) (*Document, error) {
+	if obj == nil {
+		return nil, nil
+	}
+	value, ok := objectData(obj)[DocumentKey]
+	if !ok {
+		return nil, nil
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	key := accessor.GetNamespace() + "/" + accessor.GetName()
+	if cached, ok := s.documents.Load(key); ok && cached.(cachedDocument).resourceVersion == accessor.GetResourceVersion() {
+		return cached.(cachedDocument).document, cached.(cachedDocument).err
+	}
+	document, err := ParseDocument([]byte(value))
+	if err != nil {
+		err = fmt.Errorf("Failed to parse mapping document of %s %s: %s\n", s.source.Kind, key, err)
+	}
+	s.documents.Store(key, cachedDocument{resourceVersion: accessor.GetResourceVersion(), document: document, err: err})
+	return document, err
+}
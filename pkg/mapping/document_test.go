@@ -0,0 +1,143 @@
+package mapping
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/yaml"
+)
+
+func TestParseDocument(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{name: "valid", data: `
+schemaVersion: v1
+# user1 owns the project share
+subjects:
+  user1:
+    uid: 1001
+    gids: [1001, 3000]
+  system:serviceaccount:ci:builder:
+    uids: "2000-2099,2500"
+    expires: "2030-01-01T00:00:00Z"
+    comment: CI builders
+  sa-tenant-a:
+    uid: 3000
+    seLinux:
+      level: "s0:c123,c456"
+`},
+		{name: "empty seLinux", data: "schemaVersion: v1\nsubjects:\n  user1:\n    seLinux: {}", wantErr: true},
+		{name: "unknown seLinux field", data: "schemaVersion: v1\nsubjects:\n  user1:\n    seLinux:\n      categories: c1", wantErr: true},
+		{name: "no subjects", data: "schemaVersion: v1"},
+		{name: "missing schemaVersion", data: "subjects: {}", wantErr: true},
+		{name: "unknown schemaVersion", data: "schemaVersion: v2", wantErr: true},
+		{name: "unknown field", data: "schemaVersion: v1\nsubjects:\n  user1:\n    guid: 1", wantErr: true},
+		{name: "uid and uids", data: "schemaVersion: v1\nsubjects:\n  user1:\n    uid: 1\n    uids: \"2-3\"", wantErr: true},
+		{name: "invalid uids", data: "schemaVersion: v1\nsubjects:\n  user1:\n    uids: \"3-2\"", wantErr: true},
+	}
+	for _, tt := range tests {
+		_, err := ParseDocument([]byte(tt.data))
+		assert.Equal(t, tt.wantErr, err != nil, "%s: %v", tt.name, err)
+	}
+}
+
+func TestNewDocument(t *testing.T) {
+	d, err := NewDocument(
+		map[string]string{"user1": "1001", "user2": "2000-2099", DocumentKey: "ignored"},
+		map[string]string{"user1": "1001, 3000", "user3": "4000"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uid := int64(1001)
+	assert.Equal(t, map[string]Entry{
+		"user1": {UID: &uid, GIDs: []int64{1001, 3000}},
+		"user2": {UIDs: "2000-2099"},
+		"user3": {GIDs: []int64{4000}},
+	}, d.Subjects)
+
+	// the converted document parses back
+	data, err := yaml.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ParseDocument(data)
+	assert.NoError(t, err)
+
+	_, err = NewDocument(map[string]string{"user1": "abc"}, nil)
+	assert.Error(t, err)
+}
+
+func TestStoreDocument(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: UIDConfigMapName, Namespace: "nfs"},
+			Data: map[string]string{
+				DocumentKey: `
+schemaVersion: v1
+subjects:
+  user1:
+    uid: 1001
+    gids: [1001, 3000]
+  user2:
+    uids: "2000-2099"
+  expired:
+    uid: 1003
+    expires: "2000-01-01T00:00:00Z"
+`,
+				// legacy flat entries are still read, the document wins
+				"user1":  "9999",
+				"legacy": "1004",
+			},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: GIDConfigMapName, Namespace: "nfs"},
+			Data:       map[string]string{"user2": "2000", "legacy": "1004"},
+		},
+	)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	s := NewStore(client, "nfs")
+	if err := s.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		subject string
+		uids    string
+		gids    []int64
+	}{
+		{subject: "user1", uids: "1001", gids: []int64{1001, 3000}},
+		// GIDs missing from the document fall back to the flat entries
+		{subject: "user2", uids: "2000-2099", gids: []int64{2000}},
+		{subject: "legacy", uids: "1004", gids: []int64{1004}},
+		{subject: "expired"},
+		{subject: DocumentKey},
+	}
+	for _, tt := range tests {
+		uids, found, err := s.UIDs(tt.subject)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.uids != "", found, tt.subject)
+		if found {
+			assert.Equal(t, tt.uids, uids.String(), tt.subject)
+		}
+
+		gids, found, err := s.GIDs(tt.subject)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.gids != nil, found, tt.subject)
+		assert.Equal(t, tt.gids, gids, tt.subject)
+	}
+
+	subjects, err := s.Subjects()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"legacy", "user1", "user2"}, subjects)
+}
@@ -0,0 +1,72 @@
+package mapping
+
+import (
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ExpiredEntry is a mapping entry ignored since it expired, left in the mappings
+// until someone prunes it
+type ExpiredEntry struct {
+	Subject string
+	Expires metav1.Time
+	// APIVersion, Kind, Namespace and Name identify the object holding the entry,
+	// i.e. the UID mapping object or a UIDMapping
+	APIVersion, Kind, Namespace, Name string
+}
+
+// ExpiredEntries returns the expired entries of the structured document of the UID
+// mapping object and the expired UIDMappings, sorted by expiry
+func (s *Store) ExpiredEntries(now metav1.Time) ([]ExpiredEntry, error) {
+	obj, err := s.object(s.source.UIDName)
+	if err != nil {
+		return nil, err
+	}
+	document, err := s.document(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []ExpiredEntry
+	if document != nil {
+		for subject, entry := range document.Subjects {
+			if document.expired(subject, now.Time) {
+				expired = append(expired, ExpiredEntry{
+					Subject:    subject,
+					Expires:    *entry.Expires,
+					APIVersion: "v1",
+					Kind:       s.source.Kind,
+					Namespace:  s.source.Namespace,
+					Name:       s.source.UIDName,
+				})
+			}
+		}
+	}
+
+	if s.uidMappings != nil {
+		for _, obj := range s.uidMappings.GetIndexer().List() {
+			m, err := toUIDMapping(obj)
+			if err != nil {
+				return nil, err
+			}
+			if m.Expired(now) {
+				expired = append(expired, ExpiredEntry{
+					Subject:    m.Spec.Subject,
+					Expires:    *m.Spec.Expiry,
+					APIVersion: m.APIVersion,
+					Kind:       m.Kind,
+					Name:       m.Name,
+				})
+			}
+		}
+	}
+
+	sort.Slice(expired, func(i, j int) bool {
+		if !expired[i].Expires.Equal(&expired[j].Expires) {
+			return expired[i].Expires.Before(&expired[j].Expires)
+		}
+		return expired[i].Subject < expired[j].Subject
+	})
+	return expired, nil
+}
@@ -0,0 +1,66 @@
+package mapping
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Krb5ConfigMapName is the name of the ConfigMap mapping users to Kerberos principals
+const Krb5ConfigMapName = "nfs-pod-access-control-krb5-mapping"
+
+// Principal is the Kerberos principal of a user/serviceAccount
+type Principal struct {
+	// Name is the principal name, e.g. team-a@EXAMPLE.COM
+	Name string
+	// KeytabSecret is the name of the Secret holding the keytab of the principal, if any
+	KeytabSecret string
+}
+
+// Principal returns the Kerberos principal mapped to subject in the Kerberos
+// mapping object. Values are a principal optionally followed by the name of its
+// keytab Secret, e.g. "team-a@EXAMPLE.COM,team-a-keytab". Namespace mapping
+// objects are ignored, so that tenants can't claim the keytab of another team.
+// found is false if subject has no principal associated with it.
+func (s *Store) Principal(subject string) (p Principal, found bool, err error) {
+	data, err := s.data(s.source.Krb5Name)
+	if err != nil {
+		return Principal{}, false, err
+	}
+	value := strings.TrimSpace(data[subject])
+	if value == "" {
+		return Principal{}, false, nil
+	}
+	p, err = parsePrincipal(value)
+	if err != nil {
+		return Principal{}, false, err
+	}
+	return p, true, nil
+}
+
+// Principals returns every Kerberos principal of the Kerberos mapping object, by subject
+func (s *Store) Principals() (map[string]Principal, error) {
+	data, err := s.data(s.source.Krb5Name)
+	if err != nil {
+		return nil, err
+	}
+	principals := make(map[string]Principal, len(data))
+	for subject, value := range data {
+		p, err := parsePrincipal(strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+		principals[subject] = p
+	}
+	return principals, nil
+}
+
+// parsePrincipal parses a principal optionally followed by the name of its keytab
+// Secret, e.g. "team-a@EXAMPLE.COM,team-a-keytab"
+func parsePrincipal(value string) (Principal, error) {
+	name, secret, _ := strings.Cut(value, ",")
+	p := Principal{Name: strings.TrimSpace(name), KeytabSecret: strings.TrimSpace(secret)}
+	if p.Name == "" || strings.ContainsAny(p.Name, " \t") {
+		return Principal{}, fmt.Errorf("Failed to parse Kerberos principal: %q\n", value)
+	}
+	return p, nil
+}
@@ -0,0 +1,45 @@
+package mapping
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStorePrincipal(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: Krb5ConfigMapName, Namespace: "nfs"},
+		Data: map[string]string{
+			"backup": "backup@EXAMPLE.COM, backup-keytab",
+			"user1":  "user1@EXAMPLE.COM",
+		},
+	})
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	s := NewStore(client, "nfs")
+	if err := s.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	p, found, err := s.Principal("backup")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, Principal{Name: "backup@EXAMPLE.COM", KeytabSecret: "backup-keytab"}, p)
+
+	_, found, err = s.Principal("user2")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	principals, err := s.Principals()
+	assert.NoError(t, err)
+	assert.Len(t, principals, 2)
+	assert.Equal(t, "user1@EXAMPLE.COM", principals["user1"].Name)
+
+	_, err = parsePrincipal(",keytab")
+	assert.Error(t, err)
+}
@@ -0,0 +1,523 @@
+// Package mapping serves the UID and GID mapping ConfigMaps (or Secrets) and
+// UIDMapping resources from an in-memory cache, kept up to date by informers
+// started at webhook startup
+package mapping
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	rest "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// UIDConfigMapName is the name of the ConfigMap mapping users to UIDs
+	UIDConfigMapName = "nfs-pod-access-control-uid-mapping"
+	// GIDConfigMapName is the name of the ConfigMap mapping users to GIDs
+	GIDConfigMapName = "nfs-pod-access-control-gid-mapping"
+
+	// ConfigMapKind and SecretKind are the kinds of objects the mappings can be read from
+	ConfigMapKind = "ConfigMap"
+	SecretKind    = "Secret"
+
+	// NamespaceEnv is the env var setting the namespace of the webhook when it
+	// runs outside of the cluster
+	NamespaceEnv = "WEBHOOK_NAMESPACE"
+)
+
+var (
+	// namespaceFile is the file containing the namespace of the webhook pod
+	namespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// Source describes the objects holding the UID and GID mappings
+type Source struct {
+	// Kind is either ConfigMap or Secret
+	Kind      string
+	Namespace string
+	// UIDName and GIDName are the names of the UID and GID mapping objects
+	UIDName string
+	GIDName string
+	// Krb5Name is the name of the Kerberos principal mapping object
+	Krb5Name string
+	// WindowsName is the name of the Windows user name mapping object
+	WindowsName string
+}
+
+// Store is a container for the cached mapping ConfigMaps or Secrets and UIDMappings
+type Store struct {
+	source   Source
+	factory  informers.SharedInformerFactory
+	informer cache.SharedIndexInformer
+	// only the lister matching the source kind is set
+	lister  corelisters.ConfigMapNamespaceLister
+	secrets corelisters.SecretNamespaceLister
+
+	// namespacedFactories and namespaced are only set when namespace mappings are
+	// enabled, namespaced holds an informer per mapping object name
+	namespacedFactories []informers.SharedInformerFactory
+	namespaced          map[string]cache.SharedIndexInformer
+
+	// dynamicFactory and uidMappings are only set when UIDMappings are enabled
+	dynamicFactory dynamicinformer.DynamicSharedInformerFactory
+	uidMappings    cache.SharedIndexInformer
+
+	// serviceAccountFactory and serviceAccounts are only set when serviceAccount
+	// annotations are enabled
+	serviceAccountFactory   informers.SharedInformerFactory
+	serviceAccounts         cache.SharedIndexInformer
+	serviceAccountsOverride bool
+
+	// documents caches the parsed structured documents by object key
+	documents sync.Map
+
+	// snapshotPath is the file the mapping objects are persisted to, empty when
+	// snapshots are disabled, snapshotSavedAt is the time the snapshot loaded at
+	// startup was saved at
+	snapshotPath    string
+	snapshotMaxAge  time.Duration
+	snapshotSavedAt time.Time
+}
+
+// NewStore returns a Store caching the mapping ConfigMaps of namespace, the cache
+// is only filled once Start is called
+func NewStore(client kubernetes.Interface, namespace string) *Store {
+	s, _ := NewStoreFromSource(client, Source{Kind: ConfigMapKind, Namespace: namespace})
+	return s
+}
+
+// NewStoreFromSource returns a Store caching the mapping objects described by
+// source, unset names default to the mapping ConfigMap names. The cache is only
+// filled once Start is called.
+func NewStoreFromSource(client kubernetes.Interface, source Source) (*Store, error) {
+	if source.UIDName == "" {
+		source.UIDName = UIDConfigMapName
+	}
+	if source.GIDName == "" {
+		source.GIDName = GIDConfigMapName
+	}
+	if source.Krb5Name == "" {
+		source.Krb5Name = Krb5ConfigMapName
+	}
+	if source.WindowsName == "" {
+		source.WindowsName = WindowsConfigMapName
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0, informers.WithNamespace(source.Namespace))
+	s := &Store{source: source, factory: factory}
+
+	switch source.Kind {
+	case ConfigMapKind, "":
+		s.source.Kind = ConfigMapKind
+		configMaps := factory.Core().V1().ConfigMaps()
+		s.informer = configMaps.Informer()
+		s.lister = configMaps.Lister().ConfigMaps(source.Namespace)
+	case SecretKind:
+		secrets := factory.Core().V1().Secrets()
+		s.informer = secrets.Informer()
+		s.secrets = secrets.Lister().Secrets(source.Namespace)
+	default:
+		return nil, fmt.Errorf("unknown mapping source kind %q, expected %s or %s", source.Kind, ConfigMapKind, SecretKind)
+	}
+	return s, nil
+}
+
+// Start starts watching the mapping objects (and namespace mappings and UIDMappings
+// if enabled) and blocks until the cache is synced. When a snapshot was loaded, it
+// only waits for the API server for a while and then serves the snapshot until the
+// cache is synced.
+func (s *Store) Start(stopCh <-chan struct{}) error {
+	s.factory.Start(stopCh)
+	for _, factory := range s.namespacedFactories {
+		factory.Start(stopCh)
+	}
+	if s.dynamicFactory != nil {
+		s.dynamicFactory.Start(stopCh)
+	}
+	if s.serviceAccountFactory != nil {
+		s.serviceAccountFactory.Start(stopCh)
+	}
+
+	waitCh := stopCh
+	if !s.snapshotSavedAt.IsZero() {
+		timeout := make(chan struct{})
+		var once sync.Once
+		stop := func() { once.Do(func() { close(timeout) }) }
+		timer := time.AfterFunc(snapshotSyncTimeout, stop)
+		defer timer.Stop()
+		defer stop()
+		go func() {
+			select {
+			case <-stopCh:
+				stop()
+			case <-timeout:
+			}
+		}()
+		waitCh = timeout
+	}
+	if !cache.WaitForCacheSync(waitCh, s.informer.HasSynced) {
+		return s.syncFailed(stopCh, fmt.Errorf("failed to sync %s cache in namespace %s", s.source.Kind, s.source.Namespace))
+	}
+	for name, informer := range s.namespaced {
+		if !cache.WaitForCacheSync(waitCh, informer.HasSynced) {
+			return s.syncFailed(stopCh, fmt.Errorf("failed to sync %s cache of namespace mappings %s", s.source.Kind, name))
+		}
+	}
+	if s.uidMappings != nil && !cache.WaitForCacheSync(waitCh, s.uidMappings.HasSynced) {
+		return s.syncFailed(stopCh, fmt.Errorf("failed to sync UIDMapping cache"))
+	}
+	if s.serviceAccounts != nil && !cache.WaitForCacheSync(waitCh, s.serviceAccounts.HasSynced) {
+		return s.syncFailed(stopCh, fmt.Errorf("failed to sync ServiceAccount cache"))
+	}
+	if s.snapshotPath != "" {
+		s.saveSnapshot()
+		go s.refreshSnapshot(stopCh)
+	}
+	return nil
+}
+
+// syncFailed returns err unless the caches can be served from the snapshot until
+// they are synced
+func (s *Store) syncFailed(stopCh <-chan struct{}, err error) error {
+	select {
+	case <-stopCh:
+		return err
+	default:
+	}
+	if !s.servingSnapshot() {
+		return err
+	}
+	logrus.Warnf("%v, serving the mapping snapshot saved at %s until the API server answers", err, s.snapshotSavedAt.Format(time.RFC3339))
+	go s.reportSnapshot(stopCh)
+	return nil
+}
+
+// synced returns true once every cache is synced with the API server
+func (s *Store) synced() bool {
+	if !s.informer.HasSynced() {
+		return false
+	}
+	for _, informer := range s.namespaced {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	if s.uidMappings != nil && !s.uidMappings.HasSynced() {
+		return false
+	}
+	return s.serviceAccounts == nil || s.serviceAccounts.HasSynced()
+}
+
+// Ready returns an error until the cache is synced and the UID mapping object
+// exists, UIDMappings replace the UID mapping object when they are enabled. A
+// snapshot not older than its maximum age stands in for the API server.
+func (s *Store) Ready() error {
+	if s.servingSnapshot() {
+		return nil
+	}
+	if !s.informer.HasSynced() {
+		return fmt.Errorf("%s cache in namespace %s not synced", s.source.Kind, s.source.Namespace)
+	}
+	for name, informer := range s.namespaced {
+		if !informer.HasSynced() {
+			return fmt.Errorf("%s cache of namespace mappings %s not synced", s.source.Kind, name)
+		}
+	}
+	if s.serviceAccounts != nil && !s.serviceAccounts.HasSynced() {
+		return fmt.Errorf("ServiceAccount cache not synced")
+	}
+	if s.uidMappings != nil {
+		if !s.uidMappings.HasSynced() {
+			return fmt.Errorf("UIDMapping cache not synced")
+		}
+		return nil
+	}
+
+	var err error
+	if s.secrets != nil {
+		_, err = s.secrets.Get(s.source.UIDName)
+	} else {
+		_, err = s.lister.Get(s.source.UIDName)
+	}
+	if err != nil {
+		return fmt.Errorf("UID mapping %s %s/%s not loaded: %v", s.source.Kind, s.source.Namespace, s.source.UIDName, err)
+	}
+	return nil
+}
+
+// Source returns the description of the mapping objects cached by the Store
+func (s *Store) Source() Source {
+	return s.source
+}
+
+// ConfigMap returns the cached ConfigMap with the given name, the returned object
+// is shared with the cache and must not be modified
+func (s *Store) ConfigMap(name string) (*corev1.ConfigMap, error) {
+	if s.lister == nil {
+		return nil, fmt.Errorf("Error getting ConfigMap: mappings are read from %ss\n", s.source.Kind)
+	}
+	configMap, err := s.lister.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting ConfigMap: %s\n", err)
+	}
+	return configMap, nil
+}
+
+// UID returns the UID mapped to subject, i.e. the first ID of its UIDs.
+// found is false if subject has no UID associated with it.
+func (s *Store) UID(subject string) (uid int64, found bool, err error) {
+	uids, found, err := s.UIDs(subject)
+	if err != nil || !found {
+		return 0, false, err
+	}
+	return uids[0].Min, true, nil
+}
+
+// UIDs returns the UIDs mapped to subject, UIDMappings take precedence over the UID
+// mapping object. Values of the UID mapping object are lists of UIDs and UID ranges,
+// e.g. "1000-1999,2500". found is false if subject has no UID associated with it.
+func (s *Store) UIDs(subject string) (uids IDRanges, found bool, err error) {
+	return s.NamespaceUIDs("", subject)
+}
+
+// NamespaceUIDs is UIDs for a subject of namespace, the UID mapping object of
+// namespace overrides the source one when namespace mappings are enabled, and the
+// annotation of a serviceAccount subject of namespace (see ServiceAccountSubject)
+// is used when serviceAccount annotations are enabled
+func (s *Store) NamespaceUIDs(namespace, subject string) (uids IDRanges, found bool, err error) {
+	m, found, err := s.UIDMapping(SubjectName(subject))
+	if err != nil {
+		return nil, false, err
+	}
+	if found {
+		return SingleID(m.Spec.UID), true, nil
+	}
+
+	value, err := s.mappedValue(namespace, s.source.UIDName, ServiceAccountUIDAnnotation, subject)
+	if err != nil || value == "" {
+		return nil, false, err
+	}
+	uids, err = ParseIDRanges(value)
+	if err != nil {
+		return nil, false, fmt.Errorf("Failed to parse UIDs: %s\n", err)
+	}
+	return uids, true, nil
+}
+
+// GIDs returns the GIDs mapped to subject, UIDMappings take precedence over the GID
+// mapping object. found is false if subject has no GID associated with it.
+func (s *Store) GIDs(subject string) (gids []int64, found bool, err error) {
+	return s.NamespaceGIDs("", subject)
+}
+
+// NamespaceGIDs is GIDs for a subject of namespace, the GID mapping object of
+// namespace overrides the source one when namespace mappings are enabled, and the
+// annotation of a serviceAccount subject of namespace (see ServiceAccountSubject)
+// is used when serviceAccount annotations are enabled
+func (s *Store) NamespaceGIDs(namespace, subject string) (gids []int64, found bool, err error) {
+	m, found, err := s.UIDMapping(SubjectName(subject))
+	if err != nil {
+		return nil, false, err
+	}
+	if found {
+		return m.Spec.GIDs, len(m.Spec.GIDs) > 0, nil
+	}
+
+	value, err := s.mappedValue(namespace, s.source.GIDName, ServiceAccountGIDAnnotation, subject)
+	if err != nil || value == "" {
+		return nil, false, err
+	}
+	gids, err = ParseIDList(value)
+	if err != nil {
+		return nil, false, fmt.Errorf("Failed to parse GIDs: %s\n", err)
+	}
+	return gids, true, nil
+}
+
+// data returns the data of the cached mapping object with the given name, a missing
+// object has no data
+func (s *Store) data(name string) (map[string]string, error) {
+	obj, err := s.object(name)
+	if err != nil {
+		return nil, err
+	}
+	return objectData(obj), nil
+}
+
+// object returns the cached mapping object with the given name, nil if it is missing
+func (s *Store) object(name string) (interface{}, error) {
+	var obj interface{}
+	var err error
+	if s.secrets != nil {
+		obj, err = s.secrets.Get(name)
+	} else {
+		obj, err = s.lister.Get(name)
+	}
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error getting %s: %s\n", s.source.Kind, err)
+	}
+	return obj, nil
+}
+
+// objectData returns the data of a cached ConfigMap or Secret, binaryData entries
+// of ConfigMaps are included and data wins on duplicate keys
+func objectData(obj interface{}) map[string]string {
+	switch o := obj.(type) {
+	case *corev1.ConfigMap:
+		if len(o.BinaryData) == 0 {
+			return o.Data
+		}
+		return bytesData(o.BinaryData, o.Data)
+	case *corev1.Secret:
+		return bytesData(o.Data, nil)
+	}
+	return nil
+}
+
+// bytesData returns binary merged with data as strings, data wins on duplicate keys
+func bytesData(binary map[string][]byte, data map[string]string) map[string]string {
+	merged := make(map[string]string, len(binary)+len(data))
+	for k, v := range binary {
+		merged[k] = string(v)
+	}
+	for k, v := range data {
+		merged[k] = v
+	}
+	return merged
+}
+
+// ParseIDList parses a comma separated list of numeric IDs, e.g. "1001,2000"
+func ParseIDList(value string) ([]int64, error) {
+	var ids []int64
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no IDs found in %q", value)
+	}
+	return ids, nil
+}
+
+// NewConfig returns the configuration to reach the API server from inside the
+// webhook pod, or from the kubeconfig file when kubeconfig or the KUBECONFIG env
+// var is set, e.g. to run the webhook locally against a kind cluster
+func NewConfig(kubeconfig string) (*rest.Config, error) {
+	if kubeconfig == "" && os.Getenv(clientcmd.RecommendedConfigPathEnvVar) == "" {
+		config, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("Error getting in-cluster config: %s\n", err)
+		}
+		return config, nil
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting kubeconfig: %s\n", err)
+	}
+	return config, nil
+}
+
+// Namespace returns the namespace of the webhook, where the mapping ConfigMaps
+// live: the one set by the WEBHOOK_NAMESPACE env var, or the namespace of the
+// webhook pod
+func Namespace() (string, error) {
+	if namespace := os.Getenv(NamespaceEnv); namespace != "" {
+		return namespace, nil
+	}
+	namespaceBytes, err := os.ReadFile(namespaceFile)
+	if err != nil {
+		return "", fmt.Errorf("%v, set %s when running outside of the cluster", err, NamespaceEnv)
+	}
+	return strings.TrimSpace(string(namespaceBytes)), nil
+}
+
+// Subjects returns the users and serviceAccounts of the UID mapping object, of its
+// structured document and of the UIDMappings that are not expired, sorted and
+// without duplicates
+func (s *Store) Subjects() ([]string, error) {
+	obj, err := s.object(s.source.UIDName)
+	if err != nil {
+		return nil, err
+	}
+	document, err := s.document(obj)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	seen := map[string]bool{}
+	for subject := range objectData(obj) {
+		if subject != DocumentKey && !document.expired(subject, now) {
+			seen[subject] = true
+		}
+	}
+	for _, subject := range document.subjects(now) {
+		seen[subject] = true
+	}
+
+	if s.uidMappings != nil {
+		now := metav1.Now()
+		for _, obj := range s.uidMappings.GetIndexer().List() {
+			m, err := toUIDMapping(obj)
+			if err != nil {
+				return nil, err
+			}
+			if !m.Expired(now) && m.Spec.Subject != "" {
+				seen[m.Spec.Subject] = true
+			}
+		}
+	}
+
+	subjects := make([]string, 0, len(seen))
+	for subject := range seen {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+	return subjects, nil
+}
+
+// OnChange calls f whenever a mapping object or a UIDMapping is added, updated
+// or deleted, namespace mapping objects excluded
+func (s *Store) OnChange(f func()) error {
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { f() },
+		UpdateFunc: func(interface{}, interface{}) { f() },
+		DeleteFunc: func(interface{}) { f() },
+	}
+	if _, err := s.informer.AddEventHandler(handler); err != nil {
+		return fmt.Errorf("failed to watch mapping %ss: %v", s.source.Kind, err)
+	}
+	if s.uidMappings != nil {
+		if _, err := s.uidMappings.AddEventHandler(handler); err != nil {
+			return fmt.Errorf("failed to watch UIDMappings: %v", err)
+		}
+	}
+	return nil
+}
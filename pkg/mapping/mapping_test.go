@@ -0,0 +1,182 @@
+package mapping
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStoreConfigMap(t *testing.T) {
+	want := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: UIDConfigMapName, Namespace: "nfs"},
+		Data:       map[string]string{"user1": "1001"},
+	}
+	client := fake.NewSimpleClientset(want)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	s := NewStore(client, "nfs")
+	if err := s.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.ConfigMap(UIDConfigMapName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, want.Data, got.Data)
+
+	_, err = s.ConfigMap(GIDConfigMapName)
+	assert.Error(t, err)
+}
+
+func TestStoreReady(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	s := NewStore(client, "nfs")
+	assert.Error(t, s.Ready(), "cache not synced")
+	if err := s.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, s.Ready(), "UID mapping missing")
+
+	_, err := client.CoreV1().ConfigMaps("nfs").Create(context.TODO(), &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: UIDConfigMapName, Namespace: "nfs"},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Eventually(t, func() bool { return s.Ready() == nil }, time.Second, 10*time.Millisecond)
+}
+
+func TestStoreSecretSource(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "uids", Namespace: "mappings"},
+			Data:       map[string][]byte{"user1": []byte("1001")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "gids", Namespace: "mappings"},
+			Data:       map[string][]byte{"user1": []byte("1001,3000")},
+		},
+		// ConfigMaps are ignored when reading from Secrets
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "uids", Namespace: "mappings"},
+			Data:       map[string]string{"user2": "1002"},
+		},
+	)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	s, err := NewStoreFromSource(client, Source{Kind: SecretKind, Namespace: "mappings", UIDName: "uids", GIDName: "gids"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	uid, found, err := s.UID("user1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(1001), uid)
+
+	gids, found, err := s.GIDs("user1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []int64{1001, 3000}, gids)
+
+	_, found, err = s.UID("user2")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	_, err = NewStoreFromSource(client, Source{Kind: "Pod"})
+	assert.Error(t, err)
+}
+
+func TestStoreBinaryData(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: UIDConfigMapName, Namespace: "nfs"},
+		Data:       map[string]string{"user1": "1001"},
+		BinaryData: map[string][]byte{"user1": []byte("9999"), "user2": []byte("1002")},
+	})
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	s := NewStore(client, "nfs")
+	if err := s.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	// data takes precedence over binaryData
+	uid, found, err := s.UID("user1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(1001), uid)
+
+	uid, found, err = s.UID("user2")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(1002), uid)
+}
+
+func TestParseIDList(t *testing.T) {
+	got, err := ParseIDList("1001, 2000,,3000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []int64{1001, 2000, 3000}, got)
+
+	_, err = ParseIDList("1001,abc")
+	assert.Error(t, err)
+
+	_, err = ParseIDList(" , ")
+	assert.Error(t, err)
+}
+
+func TestParseIDRanges(t *testing.T) {
+	got, err := ParseIDRanges("1000-1999, 2500")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, IDRanges{{Min: 1000, Max: 1999}, {Min: 2500, Max: 2500}}, got)
+	assert.Equal(t, "1000-1999,2500", got.String())
+	assert.True(t, got.Contains(1000))
+	assert.True(t, got.Contains(2500))
+	assert.False(t, got.Contains(2000))
+
+	_, err = ParseIDRanges("1999-1000")
+	assert.Error(t, err)
+
+	_, err = ParseIDRanges("1000-abc")
+	assert.Error(t, err)
+}
+
+func TestNamespace(t *testing.T) {
+	namespaceFile = filepath.Join(t.TempDir(), "namespace")
+	_, err := Namespace()
+	assert.ErrorContains(t, err, NamespaceEnv)
+
+	assert.NoError(t, os.WriteFile(namespaceFile, []byte("nfs\n"), 0o644))
+	namespace, err := Namespace()
+	assert.NoError(t, err)
+	assert.Equal(t, "nfs", namespace)
+
+	t.Setenv(NamespaceEnv, "dev")
+	namespace, err = Namespace()
+	assert.NoError(t, err)
+	assert.Equal(t, "dev", namespace)
+}
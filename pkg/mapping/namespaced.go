@@ -0,0 +1,106 @@
+package mapping
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// EnableNamespaceMappings makes the Store watch the mapping objects of every
+// namespace, i.e. the objects named like the source ones, so that tenants can map
+// the users and serviceAccounts of their namespaces. It must be called before Start.
+func (s *Store) EnableNamespaceMappings(client kubernetes.Interface) {
+	s.namespaced = map[string]cache.SharedIndexInformer{}
+	for _, name := range []string{s.source.UIDName, s.source.GIDName} {
+		selector := fields.OneTermEqualSelector("metadata.name", name).String()
+		factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+			informers.WithTweakListOptions(func(o *metav1.ListOptions) { o.FieldSelector = selector }))
+
+		if s.source.Kind == SecretKind {
+			s.namespaced[name] = factory.Core().V1().Secrets().Informer()
+		} else {
+			s.namespaced[name] = factory.Core().V1().ConfigMaps().Informer()
+		}
+		s.namespacedFactories = append(s.namespacedFactories, factory)
+	}
+}
+
+// value returns the value mapped to subject in the mapping object with the given
+// name. Entries of the object in namespace override the ones of the source object,
+// subjects missing from the former fall back to the latter.
+func (s *Store) value(namespace, name, subject string) (string, error) {
+	if _, ok := s.namespaced[name]; ok && namespace != "" && namespace != s.source.Namespace {
+		value, err := s.objectValue(func(name string) (interface{}, error) {
+			return s.namespacedObject(namespace, name)
+		}, name, subject)
+		if err != nil || value != "" {
+			return value, err
+		}
+	}
+	return s.objectValue(s.object, name, subject)
+}
+
+// objectValue returns the value mapped to subject in the mapping object with the
+// given name, as returned by get. The entry of the structured document of the UID
+// mapping object wins over the flat entry of the named object, and a subject whose
+// document entry expired is not mapped at all.
+func (s *Store) objectValue(get func(name string) (interface{}, error), name, subject string) (string, error) {
+	uidObj, err := get(s.source.UIDName)
+	if err != nil {
+		return "", err
+	}
+	document, err := s.document(uidObj)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	if document.expired(subject, now) {
+		return "", nil
+	}
+	if entry, ok := document.entry(subject, now); ok {
+		var value string
+		switch name {
+		case s.source.UIDName:
+			value = entry.uidValue()
+		case s.source.GIDName:
+			value = entry.gidValue()
+		}
+		if value != "" {
+			return value, nil
+		}
+	}
+
+	if subject == DocumentKey {
+		return "", nil
+	}
+	obj := uidObj
+	if name != s.source.UIDName {
+		if obj, err = get(name); err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSpace(objectData(obj)[subject]), nil
+}
+
+// namespacedObject returns the cached mapping object with the given name in
+// namespace, nil if it is missing or namespace mappings of name are disabled
+func (s *Store) namespacedObject(namespace, name string) (interface{}, error) {
+	informer, ok := s.namespaced[name]
+	if !ok {
+		return nil, nil
+	}
+	obj, exists, err := informer.GetIndexer().GetByKey(namespace + "/" + name)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting %s: %s\n", s.source.Kind, err)
+	}
+	if !exists {
+		return nil, nil
+	}
+	return obj, nil
+}
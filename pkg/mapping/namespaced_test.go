@@ -0,0 +1,57 @@
+package mapping
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStoreNamespaceMappings(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: UIDConfigMapName, Namespace: "nfs"},
+			Data:       map[string]string{"user1": "1001", "user2": "1002"},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: UIDConfigMapName, Namespace: "team-a"},
+			Data:       map[string]string{"user1": "5001", "user3": "5003"},
+		},
+	)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	s := NewStore(client, "nfs")
+	s.EnableNamespaceMappings(client)
+	if err := s.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		namespace string
+		subject   string
+		uid       int64
+		found     bool
+	}{
+		// entries of the namespace override the cluster-wide ones
+		{namespace: "team-a", subject: "user1", uid: 5001, found: true},
+		// and fall back to them when missing
+		{namespace: "team-a", subject: "user2", uid: 1002, found: true},
+		{namespace: "team-a", subject: "user3", uid: 5003, found: true},
+		// namespace entries don't leak to other namespaces
+		{namespace: "team-b", subject: "user1", uid: 1001, found: true},
+		{namespace: "team-b", subject: "user3", found: false},
+		{namespace: "", subject: "user1", uid: 1001, found: true},
+	}
+	for _, tt := range tests {
+		uids, found, err := s.NamespaceUIDs(tt.namespace, tt.subject)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.found, found, "%s/%s", tt.namespace, tt.subject)
+		if tt.found {
+			assert.Equal(t, SingleID(tt.uid), uids, "%s/%s", tt.namespace, tt.subject)
+		}
+	}
+}
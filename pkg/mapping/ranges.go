@@ -0,0 +1,77 @@
+package mapping
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IDRange is an inclusive range of numeric IDs, Min equals Max for single IDs
+type IDRange struct {
+	Min int64
+	Max int64
+}
+
+// IDRanges is a list of ID ranges, e.g. parsed from "1000-1999,2500"
+type IDRanges []IDRange
+
+// SingleID returns the IDRanges holding only id
+func SingleID(id int64) IDRanges {
+	return IDRanges{{Min: id, Max: id}}
+}
+
+// Contains returns true if id is part of one of the ranges
+func (r IDRanges) Contains(id int64) bool {
+	for _, idRange := range r {
+		if id >= idRange.Min && id <= idRange.Max {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats the ranges the way ParseIDRanges reads them
+func (r IDRanges) String() string {
+	fields := make([]string, 0, len(r))
+	for _, idRange := range r {
+		if idRange.Min == idRange.Max {
+			fields = append(fields, strconv.FormatInt(idRange.Min, 10))
+		} else {
+			fields = append(fields, fmt.Sprintf("%d-%d", idRange.Min, idRange.Max))
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// ParseIDRanges parses a comma separated list of IDs and inclusive ID ranges,
+// e.g. "1000-1999,2500"
+func ParseIDRanges(value string) (IDRanges, error) {
+	var ranges IDRanges
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		min, max, isRange := strings.Cut(field, "-")
+		if !isRange {
+			max = min
+		}
+		minID, err := strconv.ParseInt(strings.TrimSpace(min), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		maxID, err := strconv.ParseInt(strings.TrimSpace(max), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if minID > maxID {
+			return nil, fmt.Errorf("invalid range %q, %d is greater than %d", field, minID, maxID)
+		}
+		ranges = append(ranges, IDRange{Min: minID, Max: maxID})
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no IDs found in %q", value)
+	}
+	return ranges, nil
+}
@@ -0,0 +1,27 @@
+package mapping
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SELinuxOptions returns the seLinuxOptions required for subject by its entry in
+// the structured document of the source UID mapping object. Namespace mapping
+// objects are ignored, so that tenants can't claim the MCS categories of another
+// team. found is false if the subject requires no seLinuxOptions.
+func (s *Store) SELinuxOptions(subject string) (options corev1.SELinuxOptions, found bool, err error) {
+	obj, err := s.object(s.source.UIDName)
+	if err != nil {
+		return corev1.SELinuxOptions{}, false, err
+	}
+	document, err := s.document(obj)
+	if err != nil {
+		return corev1.SELinuxOptions{}, false, err
+	}
+	entry, ok := document.entry(subject, time.Now())
+	if !ok || entry.SELinux == nil {
+		return corev1.SELinuxOptions{}, false, nil
+	}
+	return *entry.SELinux, true, nil
+}
@@ -0,0 +1,38 @@
+package mapping
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStoreSELinuxOptions(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: UIDConfigMapName, Namespace: "nfs"},
+		Data: map[string]string{
+			DocumentKey: "schemaVersion: v1\nsubjects:\n  sa-tenant-a:\n    uid: 3000\n    seLinux:\n      level: \"s0:c123,c456\"\n  user1:\n    uid: 1001",
+		},
+	})
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	s := NewStore(client, "nfs")
+	if err := s.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	options, found, err := s.SELinuxOptions("sa-tenant-a")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, corev1.SELinuxOptions{Level: "s0:c123,c456"}, options)
+
+	for _, subject := range []string{"user1", "user2"} {
+		_, found, err = s.SELinuxOptions(subject)
+		assert.NoError(t, err)
+		assert.False(t, found, subject)
+	}
+}
@@ -0,0 +1,103 @@
+package mapping
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// ServiceAccountUIDAnnotation holds the UIDs of a serviceAccount, in the format
+	// of the UID mapping object, e.g. "1234" or "1000-1999,2500"
+	ServiceAccountUIDAnnotation = "nfs-access-control/uid"
+	// ServiceAccountGIDAnnotation holds the comma separated GIDs of a serviceAccount
+	ServiceAccountGIDAnnotation = "nfs-access-control/gids"
+)
+
+// serviceAccountPrefix prefixes the usernames of serviceAccounts
+const serviceAccountPrefix = "system:serviceaccount:"
+
+// ServiceAccountSubject returns the subject of the serviceAccount name of
+// namespace, i.e. its username, e.g. system:serviceaccount:team-a:builder. Only
+// such subjects are mapped by the annotations of serviceAccounts, the mapping
+// objects map them by name.
+func ServiceAccountSubject(namespace, name string) string {
+	return serviceAccountPrefix + namespace + ":" + name
+}
+
+// SubjectName returns the name subject is mapped by in the mapping objects, i.e.
+// the name of a serviceAccount subject, the subject itself otherwise
+func SubjectName(subject string) string {
+	if _, name, ok := splitServiceAccount(subject); ok {
+		return name
+	}
+	return subject
+}
+
+// splitServiceAccount returns the namespace and the name of a serviceAccount
+// subject, ok is false for other subjects
+func splitServiceAccount(subject string) (namespace, name string, ok bool) {
+	parts := strings.Split(subject, ":")
+	if len(parts) != 4 || !strings.HasPrefix(subject, serviceAccountPrefix) {
+		return "", "", false
+	}
+	return parts[2], parts[3], true
+}
+
+// EnableServiceAccountAnnotations makes the Store watch the serviceAccounts of
+// every namespace and map them to the UIDs and GIDs of their annotations, so that
+// the mappings can be managed alongside the serviceAccounts. Annotations override
+// the mapping objects when override is true, and only map the serviceAccounts
+// missing from them otherwise. UIDMappings still take precedence. It must be
+// called before Start.
+func (s *Store) EnableServiceAccountAnnotations(client kubernetes.Interface, override bool) {
+	s.serviceAccountFactory = informers.NewSharedInformerFactory(client, 0)
+	s.serviceAccounts = s.serviceAccountFactory.Core().V1().ServiceAccounts().Informer()
+	s.serviceAccountsOverride = override
+}
+
+// mappedValue returns the value mapped to subject in namespace by the mapping
+// object with the given name or, for a serviceAccount subject of namespace, by
+// its annotation according to the precedence of serviceAccount annotations. The
+// annotations never map other subjects, e.g. a user named like a serviceAccount.
+func (s *Store) mappedValue(namespace, name, annotation, subject string) (string, error) {
+	saNamespace, saName, ok := splitServiceAccount(subject)
+	if !ok || saNamespace != namespace {
+		return s.value(namespace, name, SubjectName(subject))
+	}
+
+	if s.serviceAccountsOverride {
+		value, err := s.serviceAccountValue(namespace, saName, annotation)
+		if err != nil || value != "" {
+			return value, err
+		}
+	}
+	value, err := s.value(namespace, name, saName)
+	if err != nil || value != "" || s.serviceAccountsOverride {
+		return value, err
+	}
+	return s.serviceAccountValue(namespace, saName, annotation)
+}
+
+// serviceAccountValue returns the annotation of the cached serviceAccount name of
+// namespace, empty if the serviceAccount is missing or annotations are disabled
+func (s *Store) serviceAccountValue(namespace, name, annotation string) (string, error) {
+	if s.serviceAccounts == nil || namespace == "" {
+		return "", nil
+	}
+	obj, exists, err := s.serviceAccounts.GetIndexer().GetByKey(namespace + "/" + name)
+	if err != nil {
+		return "", fmt.Errorf("Error getting ServiceAccount: %s\n", err)
+	}
+	if !exists {
+		return "", nil
+	}
+	serviceAccount, ok := obj.(*corev1.ServiceAccount)
+	if !ok {
+		return "", fmt.Errorf("unexpected ServiceAccount object type %T", obj)
+	}
+	return strings.TrimSpace(serviceAccount.Annotations[annotation]), nil
+}
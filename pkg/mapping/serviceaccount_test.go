@@ -0,0 +1,78 @@
+package mapping
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStoreServiceAccountAnnotations(t *testing.T) {
+	serviceAccount := func(namespace, name string, annotations map[string]string) *corev1.ServiceAccount {
+		return &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Annotations: annotations}}
+	}
+	client := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: UIDConfigMapName, Namespace: "nfs"},
+			Data:       map[string]string{"builder": "1001"},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: GIDConfigMapName, Namespace: "nfs"},
+			Data:       map[string]string{"builder": "1001"},
+		},
+		serviceAccount("team-a", "builder", map[string]string{ServiceAccountUIDAnnotation: "5001", ServiceAccountGIDAnnotation: "5001,6000"}),
+		serviceAccount("team-a", "runner", map[string]string{ServiceAccountUIDAnnotation: "5100-5199"}),
+		serviceAccount("team-a", "default", nil),
+	)
+
+	tests := []struct {
+		override  bool
+		namespace string
+		subject   string
+		uids      IDRanges
+		gids      []int64
+	}{
+		// annotations only map the serviceAccounts missing from the mapping objects
+		{namespace: "team-a", subject: ServiceAccountSubject("team-a", "builder"), uids: SingleID(1001), gids: []int64{1001}},
+		{namespace: "team-a", subject: ServiceAccountSubject("team-a", "runner"), uids: IDRanges{{Min: 5100, Max: 5199}}},
+		{namespace: "team-a", subject: ServiceAccountSubject("team-a", "default")},
+		// serviceAccounts are looked up in the namespace of the pod only
+		{namespace: "team-b", subject: ServiceAccountSubject("team-b", "runner")},
+		{namespace: "team-b", subject: ServiceAccountSubject("team-a", "runner")},
+		{namespace: "", subject: ServiceAccountSubject("team-a", "runner")},
+		// and never map users named like serviceAccounts
+		{namespace: "team-a", subject: "runner"},
+		// unless they override them
+		{override: true, namespace: "team-a", subject: ServiceAccountSubject("team-a", "builder"), uids: SingleID(5001), gids: []int64{5001, 6000}},
+		{override: true, namespace: "team-b", subject: ServiceAccountSubject("team-b", "builder"), uids: SingleID(1001), gids: []int64{1001}},
+		{override: true, namespace: "team-a", subject: "builder", uids: SingleID(1001), gids: []int64{1001}},
+		{override: true, namespace: "team-a", subject: "runner"},
+	}
+	for _, override := range []bool{false, true} {
+		stop := make(chan struct{})
+		s := NewStore(client, "nfs")
+		s.EnableServiceAccountAnnotations(client, override)
+		if err := s.Start(stop); err != nil {
+			t.Fatal(err)
+		}
+		assert.NoError(t, s.Ready())
+
+		for _, tt := range tests {
+			if tt.override != override {
+				continue
+			}
+			uids, found, err := s.NamespaceUIDs(tt.namespace, tt.subject)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.uids != nil, found, "%s/%s", tt.namespace, tt.subject)
+			assert.Equal(t, tt.uids, uids, "%s/%s", tt.namespace, tt.subject)
+
+			gids, found, err := s.NamespaceGIDs(tt.namespace, tt.subject)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.gids != nil, found, "%s/%s", tt.namespace, tt.subject)
+			assert.Equal(t, tt.gids, gids, "%s/%s", tt.namespace, tt.subject)
+		}
+		close(stop)
+	}
+}
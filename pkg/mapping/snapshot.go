@@ -0,0 +1,253 @@
+package mapping
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DefaultSnapshotMaxAge is the default age beyond which a snapshot isn't served
+const DefaultSnapshotMaxAge = 24 * time.Hour
+
+// snapshotSyncTimeout is how long Start waits for the API server before serving
+// the mappings of the snapshot
+var snapshotSyncTimeout = 30 * time.Second
+
+// Roles of the informers caching the objects of a snapshot
+const (
+	roleSource          = "source"
+	roleNamespaced      = "namespaced/"
+	roleUIDMappings     = "uidmappings"
+	roleServiceAccounts = "serviceaccounts"
+)
+
+// snapshot is the file the mapping objects are persisted to
+type snapshot struct {
+	SavedAt time.Time        `json:"savedAt"`
+	Kind    string           `json:"kind"`
+	Objects []snapshotObject `json:"objects"`
+}
+
+// snapshotObject is a mapping object and the role of the informer caching it
+type snapshotObject struct {
+	Role   string          `json:"role"`
+	Object json.RawMessage `json:"object"`
+}
+
+// watchedObject is a cached object holding mappings
+type watchedObject struct {
+	kind string
+	role string
+	obj  interface{}
+}
+
+// watchedObjects returns the cached mapping objects, namespace mapping objects,
+// UIDMappings and annotated serviceAccounts
+func (s *Store) watchedObjects() []watchedObject {
+	var objects []watchedObject
+	names := map[string]bool{s.source.UIDName: true, s.source.GIDName: true, s.source.Krb5Name: true, s.source.WindowsName: true}
+	for _, obj := range s.informer.GetStore().List() {
+		if accessor, err := meta.Accessor(obj); err == nil && names[accessor.GetName()] {
+			objects = append(objects, watchedObject{kind: s.source.Kind, role: roleSource, obj: obj})
+		}
+	}
+	for name, informer := range s.namespaced {
+		for _, obj := range informer.GetStore().List() {
+			objects = append(objects, watchedObject{kind: s.source.Kind, role: roleNamespaced + name, obj: obj})
+		}
+	}
+	if s.uidMappings != nil {
+		for _, obj := range s.uidMappings.GetStore().List() {
+			objects = append(objects, watchedObject{kind: "UIDMapping", role: roleUIDMappings, obj: obj})
+		}
+	}
+	if s.serviceAccounts != nil {
+		for _, obj := range s.serviceAccounts.GetStore().List() {
+			if sa, ok := obj.(*corev1.ServiceAccount); ok && (sa.Annotations[ServiceAccountUIDAnnotation] != "" || sa.Annotations[ServiceAccountGIDAnnotation] != "") {
+				objects = append(objects, watchedObject{kind: "ServiceAccount", role: roleServiceAccounts, obj: obj})
+			}
+		}
+	}
+	return objects
+}
+
+// EnableSnapshot persists the mapping objects to the file at path whenever they
+// change, and every maxAge/4 while the caches are synced, so that a webhook
+// restarted while the API server is unreachable serves them from this file
+// instead of never getting ready. A snapshot older than maxAge is not served. It must be called after enabling the other sources and before
+// Start.
+func (s *Store) EnableSnapshot(path string, maxAge time.Duration) error {
+	s.snapshotPath, s.snapshotMaxAge = path, maxAge
+
+	saved, err := s.loadSnapshot()
+	switch {
+	case err != nil:
+		logrus.Warnf("Ignoring mapping snapshot %s: %v", path, err)
+	case !saved.IsZero():
+		s.snapshotSavedAt = saved
+		logrus.Infof("Loaded mapping snapshot %s saved at %s", path, saved.Format(time.RFC3339))
+	}
+
+	return s.OnVersionChange(func(Version) {
+		if s.synced() {
+			s.saveSnapshot()
+		}
+	})
+}
+
+// loadSnapshot fills the caches with the objects of the snapshot file and returns
+// the time it was saved at, zero if there is no snapshot
+func (s *Store) loadSnapshot() (time.Time, error) {
+	data, err := os.ReadFile(s.snapshotPath)
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return time.Time{}, fmt.Errorf("cannot parse snapshot: %v", err)
+	}
+	if snap.Kind != s.source.Kind {
+		return time.Time{}, fmt.Errorf("snapshot of %ss, mappings are read from %ss", snap.Kind, s.source.Kind)
+	}
+	if age := time.Since(snap.SavedAt); age > s.snapshotMaxAge {
+		return time.Time{}, fmt.Errorf("snapshot saved %s ago, older than %s", age.Round(time.Second), s.snapshotMaxAge)
+	}
+
+	for _, o := range snap.Objects {
+		informer, obj := s.snapshotInformer(o.Role)
+		if informer == nil {
+			// the source of the object is disabled
+			continue
+		}
+		if err := json.Unmarshal(o.Object, obj); err != nil {
+			return time.Time{}, fmt.Errorf("cannot parse snapshot object: %v", err)
+		}
+		if err := informer.GetIndexer().Add(obj); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return snap.SavedAt, nil
+}
+
+// snapshotInformer returns the informer caching the objects of role and a new
+// object of their type, a nil informer if the source of role is disabled
+func (s *Store) snapshotInformer(role string) (cache.SharedIndexInformer, interface{}) {
+	var newObject func() interface{} = func() interface{} { return &corev1.ConfigMap{} }
+	if s.source.Kind == SecretKind {
+		newObject = func() interface{} { return &corev1.Secret{} }
+	}
+	switch {
+	case role == roleSource:
+		return s.informer, newObject()
+	case strings.HasPrefix(role, roleNamespaced):
+		if informer, ok := s.namespaced[strings.TrimPrefix(role, roleNamespaced)]; ok {
+			return informer, newObject()
+		}
+	case role == roleUIDMappings && s.uidMappings != nil:
+		return s.uidMappings, &unstructured.Unstructured{}
+	case role == roleServiceAccounts && s.serviceAccounts != nil:
+		return s.serviceAccounts, &corev1.ServiceAccount{}
+	}
+	return nil, nil
+}
+
+// saveSnapshot writes the cached mapping objects to the snapshot file, replaced
+// atomically so that a crash never leaves a partial snapshot
+func (s *Store) saveSnapshot() {
+	snap := snapshot{SavedAt: time.Now().UTC(), Kind: s.source.Kind}
+	for _, o := range s.watchedObjects() {
+		raw, err := json.Marshal(o.obj)
+		if err != nil {
+			logrus.Errorf("Error saving mapping snapshot: %s", err)
+			return
+		}
+		snap.Objects = append(snap.Objects, snapshotObject{Role: o.role, Object: raw})
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		logrus.Errorf("Error saving mapping snapshot: %s", err)
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.snapshotPath), ".mapping-snapshot-")
+	if err != nil {
+		logrus.Errorf("Error saving mapping snapshot: %s", err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		logrus.Errorf("Error saving mapping snapshot: %s", err)
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		logrus.Errorf("Error saving mapping snapshot: %s", err)
+		return
+	}
+	if err := os.Rename(tmp.Name(), s.snapshotPath); err != nil {
+		logrus.Errorf("Error saving mapping snapshot: %s", err)
+		return
+	}
+	logrus.Debugf("Saved mapping snapshot %s", s.snapshotPath)
+}
+
+// servingSnapshot returns true while the caches are not synced and filled from a
+// snapshot that is not older than the maximum age
+func (s *Store) servingSnapshot() bool {
+	return !s.snapshotSavedAt.IsZero() && !s.synced() && time.Since(s.snapshotSavedAt) <= s.snapshotMaxAge
+}
+
+// reportSnapshot records the age of the snapshot served in the
+// mapping_snapshot_age_seconds metric until the caches are synced, then saves a
+// new snapshot
+func (s *Store) reportSnapshot(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for !s.synced() {
+		age := time.Since(s.snapshotSavedAt)
+		metrics.SetMappingSnapshotAge(age)
+		if age > s.snapshotMaxAge {
+			logrus.Errorf("Mapping snapshot older than %s and API server still unreachable, not ready", s.snapshotMaxAge)
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+	metrics.SetMappingSnapshotAge(0)
+	logrus.Info("Mapping caches synced with the API server, not serving the snapshot anymore")
+	s.saveSnapshot()
+	s.refreshSnapshot(stopCh)
+}
+
+// refreshSnapshot saves the snapshot every quarter of its maximum age while the
+// caches are synced, so that the snapshot of mappings that don't change is
+// still served after a restart
+func (s *Store) refreshSnapshot(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(max(s.snapshotMaxAge/4, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if s.synced() {
+				s.saveSnapshot()
+			}
+		}
+	}
+}
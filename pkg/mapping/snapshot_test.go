@@ -0,0 +1,104 @@
+package mapping
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestStoreSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapping-snapshot.json")
+	client := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: UIDConfigMapName, Namespace: "nfs"},
+		Data:       map[string]string{"user1": "1001"},
+	}, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: "nfs"},
+	})
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	s := NewStore(client, "nfs")
+	assert.NoError(t, s.EnableSnapshot(path, time.Hour))
+	if err := s.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), UIDConfigMapName)
+	assert.NotContains(t, string(data), "unrelated")
+
+	// a webhook restarted while the API server is unreachable serves the snapshot
+	defer func(timeout time.Duration) { snapshotSyncTimeout = timeout }(snapshotSyncTimeout)
+	snapshotSyncTimeout = 100 * time.Millisecond
+	unreachable := fake.NewSimpleClientset()
+	unreachable.PrependReactor("list", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+
+	restarted := NewStore(unreachable, "nfs")
+	assert.NoError(t, restarted.EnableSnapshot(path, time.Hour))
+	assert.NoError(t, restarted.Start(stop))
+	assert.NoError(t, restarted.Ready())
+	uid, found, err := restarted.UID("user1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(1001), uid)
+
+	// snapshots older than the maximum age are not served
+	stale := NewStore(unreachable, "nfs")
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, stale.EnableSnapshot(path, time.Millisecond))
+	assert.True(t, stale.snapshotSavedAt.IsZero())
+	assert.Error(t, stale.Ready())
+}
+
+func TestStoreSnapshotRefresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapping-snapshot.json")
+	client := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: UIDConfigMapName, Namespace: "nfs"},
+		Data:       map[string]string{"user1": "1001"},
+	})
+	stop, done := make(chan struct{}), make(chan struct{})
+
+	s := NewStore(client, "nfs")
+	if err := s.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+	s.snapshotPath, s.snapshotMaxAge = path, 200*time.Millisecond
+	s.saveSnapshot()
+	go func() {
+		s.refreshSnapshot(stop)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	savedAt := func() time.Time {
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		var snap snapshot
+		assert.NoError(t, json.Unmarshal(data, &snap))
+		return snap.SavedAt
+	}
+	first := savedAt()
+
+	// the snapshot of unchanged mappings is saved again before it gets too old
+	assert.Eventually(t, func() bool { return savedAt().After(first) }, time.Second, 10*time.Millisecond)
+	time.Sleep(time.Until(first.Add(250 * time.Millisecond)))
+	restarted := NewStore(client, "nfs")
+	assert.NoError(t, restarted.EnableSnapshot(path, 200*time.Millisecond))
+	assert.False(t, restarted.snapshotSavedAt.IsZero())
+}
@@ -0,0 +1,133 @@
+package mapping
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeWindow is a recurring period during which the pods of a subject may be
+// created, e.g. a nightly batch processing window
+type TimeWindow struct {
+	// Days are the days the window starts on, e.g. [Mon, Tue], every day when empty
+	Days []string `json:"days,omitempty"`
+	// Start and End are the times of day the window starts and ends at, e.g.
+	// "22:00" and "06:00", End before Start spans midnight
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// TimeZone is the IANA time zone of Start and End, e.g. Europe/Paris, UTC
+	// when empty
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// weekdays maps the abbreviated day names to their weekday
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Validate returns an error if the window is malformed
+func (w TimeWindow) Validate() error {
+	_, _, _, err := w.parse()
+	return err
+}
+
+// Contains returns true if t falls within the window
+func (w TimeWindow) Contains(t time.Time) (bool, error) {
+	start, end, location, err := w.parse()
+	if err != nil {
+		return false, err
+	}
+	local := t.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	day := local.Weekday()
+	if start < end {
+		return minute >= start && minute < end && w.startsOn(day), nil
+	}
+	// the window spans midnight, the early hours belong to the window of the day before
+	return (minute >= start && w.startsOn(day)) || (minute < end && w.startsOn((day+6)%7)), nil
+}
+
+// String describes the window, e.g. "Mon,Tue 22:00-06:00 Europe/Paris"
+func (w TimeWindow) String() string {
+	s := w.Start + "-" + w.End
+	if len(w.Days) > 0 {
+		s = strings.Join(w.Days, ",") + " " + s
+	}
+	if w.TimeZone != "" {
+		s += " " + w.TimeZone
+	}
+	return s
+}
+
+// startsOn returns true if the window starts on day
+func (w TimeWindow) startsOn(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if weekdays[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parse returns the minutes of the day of the start and end of the window, and
+// its location
+func (w TimeWindow) parse() (start, end int, location *time.Location, err error) {
+	if start, err = parseTimeOfDay(w.Start); err != nil {
+		return 0, 0, nil, fmt.Errorf("invalid start %q: %v", w.Start, err)
+	}
+	if end, err = parseTimeOfDay(w.End); err != nil {
+		return 0, 0, nil, fmt.Errorf("invalid end %q: %v", w.End, err)
+	}
+	if start == end {
+		return 0, 0, nil, fmt.Errorf("window %s is empty", w)
+	}
+	for _, d := range w.Days {
+		if _, ok := weekdays[strings.ToLower(d)]; !ok {
+			return 0, 0, nil, fmt.Errorf("invalid day %q, expected one of Mon, Tue, Wed, Thu, Fri, Sat or Sun", d)
+		}
+	}
+	location = time.UTC
+	if w.TimeZone != "" {
+		if location, err = time.LoadLocation(w.TimeZone); err != nil {
+			return 0, 0, nil, fmt.Errorf("invalid time zone %q: %v", w.TimeZone, err)
+		}
+	}
+	return start, end, location, nil
+}
+
+// parseTimeOfDay returns the minutes of the day of a "15:04" time, "24:00"
+// being the end of the day
+func parseTimeOfDay(value string) (int, error) {
+	if value == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM")
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// TimeWindows returns the windows during which the pods of subject may be
+// created, from its entry in the structured document of the source UID mapping
+// object. Namespace mapping objects are ignored, so that tenants can't lift the
+// windows of their subjects. found is false if the subject is not restricted.
+func (s *Store) TimeWindows(subject string) (windows []TimeWindow, found bool, err error) {
+	obj, err := s.object(s.source.UIDName)
+	if err != nil {
+		return nil, false, err
+	}
+	document, err := s.document(obj)
+	if err != nil {
+		return nil, false, err
+	}
+	entry, ok := document.entry(subject, time.Now())
+	if !ok || len(entry.Windows) == 0 {
+		return nil, false, nil
+	}
+	return entry.Windows, true, nil
+}
@@ -0,0 +1,90 @@
+package mapping
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestTimeWindowContains(t *testing.T) {
+	// 2026-10-16 is a Friday
+	at := func(value string) time.Time {
+		tm, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	tests := []struct {
+		name   string
+		window TimeWindow
+		time   string
+		within bool
+	}{
+		{name: "within", window: TimeWindow{Start: "09:00", End: "17:00"}, time: "2026-10-16T12:00:00Z", within: true},
+		{name: "end excluded", window: TimeWindow{Start: "09:00", End: "17:00"}, time: "2026-10-16T17:00:00Z", within: false},
+		{name: "end of day", window: TimeWindow{Start: "20:00", End: "24:00"}, time: "2026-10-16T23:59:00Z", within: true},
+		{name: "wrong day", window: TimeWindow{Days: []string{"Mon"}, Start: "09:00", End: "17:00"}, time: "2026-10-16T12:00:00Z", within: false},
+		{name: "day", window: TimeWindow{Days: []string{"Mon", "fri"}, Start: "09:00", End: "17:00"}, time: "2026-10-16T12:00:00Z", within: true},
+		{name: "overnight before midnight", window: TimeWindow{Days: []string{"Fri"}, Start: "22:00", End: "06:00"}, time: "2026-10-16T23:00:00Z", within: true},
+		{name: "overnight after midnight", window: TimeWindow{Days: []string{"Fri"}, Start: "22:00", End: "06:00"}, time: "2026-10-17T05:00:00Z", within: true},
+		{name: "overnight started the day before", window: TimeWindow{Days: []string{"Sat"}, Start: "22:00", End: "06:00"}, time: "2026-10-17T05:00:00Z", within: false},
+		{name: "time zone", window: TimeWindow{Start: "09:00", End: "17:00", TimeZone: "Europe/Paris"}, time: "2026-10-16T07:30:00Z", within: true},
+		{name: "outside time zone", window: TimeWindow{Start: "09:00", End: "17:00", TimeZone: "Europe/Paris"}, time: "2026-10-16T15:30:00Z", within: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			within, err := tt.window.Contains(at(tt.time))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.within, within)
+		})
+	}
+}
+
+func TestTimeWindowValidate(t *testing.T) {
+	for _, w := range []TimeWindow{
+		{Start: "9am", End: "17:00"},
+		{Start: "09:00", End: "25:00"},
+		{Start: "09:00", End: "09:00"},
+		{Days: []string{"Monday"}, Start: "09:00", End: "17:00"},
+		{Start: "09:00", End: "17:00", TimeZone: "Mars/Olympus"},
+	} {
+		assert.Error(t, w.Validate(), w.String())
+	}
+	assert.NoError(t, TimeWindow{Days: []string{"Sat", "Sun"}, Start: "22:00", End: "06:00", TimeZone: "America/New_York"}.Validate())
+
+	_, err := ParseDocument([]byte("schemaVersion: v1\nsubjects:\n  batch:\n    uid: 4000\n    windows:\n    - start: \"22:00\"\n      end: \"22:00\""))
+	assert.Error(t, err)
+}
+
+func TestStoreTimeWindows(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: UIDConfigMapName, Namespace: "nfs"},
+		Data: map[string]string{
+			DocumentKey: "schemaVersion: v1\nsubjects:\n  batch:\n    uid: 4000\n    windows:\n    - days: [Sat, Sun]\n      start: \"22:00\"\n      end: \"06:00\"\n  user1:\n    uid: 1001",
+		},
+	})
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	s := NewStore(client, "nfs")
+	if err := s.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	windows, found, err := s.TimeWindows("batch")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []TimeWindow{{Days: []string{"Sat", "Sun"}, Start: "22:00", End: "06:00"}}, windows)
+
+	for _, subject := range []string{"user1", "user2"} {
+		_, found, err = s.TimeWindows(subject)
+		assert.NoError(t, err)
+		assert.False(t, found, subject)
+	}
+}
@@ -0,0 +1,92 @@
+package mapping
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/tensorchord/nfs-pod-access-control/pkg/apis/nfsaccess/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// subjectIndex is the name of the index of UIDMappings by spec.subject
+const subjectIndex = "subject"
+
+// EnableUIDMappings makes the Store watch UIDMapping resources, which take
+// precedence over the mapping ConfigMaps. It must be called before Start.
+func (s *Store) EnableUIDMappings(client dynamic.Interface) error {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	informer := factory.ForResource(v1alpha1.UIDMappingsResource).Informer()
+
+	err := informer.AddIndexers(cache.Indexers{subjectIndex: indexBySubject})
+	if err != nil {
+		return fmt.Errorf("failed to index UIDMappings: %v", err)
+	}
+
+	s.dynamicFactory = factory
+	s.uidMappings = informer
+	return nil
+}
+
+// UIDMapping returns the UIDMapping of subject, ignoring expired ones. When several
+// UIDMappings share a subject the first one by name is returned. found is false if
+// no UIDMapping exists for subject or UIDMappings are not enabled.
+func (s *Store) UIDMapping(subject string) (mapping *v1alpha1.UIDMapping, found bool, err error) {
+	if s.uidMappings == nil {
+		return nil, false, nil
+	}
+
+	objs, err := s.uidMappings.GetIndexer().ByIndex(subjectIndex, subject)
+	if err != nil {
+		return nil, false, fmt.Errorf("Error getting UIDMapping: %s\n", err)
+	}
+
+	var mappings []*v1alpha1.UIDMapping
+	now := metav1.Now()
+	for _, obj := range objs {
+		m, err := toUIDMapping(obj)
+		if err != nil {
+			return nil, false, err
+		}
+		if !m.Expired(now) {
+			mappings = append(mappings, m)
+		}
+	}
+	if len(mappings) == 0 {
+		return nil, false, nil
+	}
+
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].Name < mappings[j].Name })
+	return mappings[0], true, nil
+}
+
+// indexBySubject indexes UIDMappings by spec.subject
+func indexBySubject(obj interface{}) ([]string, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, nil
+	}
+	subject, _, err := unstructured.NestedString(u.Object, "spec", "subject")
+	if err != nil || subject == "" {
+		return nil, nil
+	}
+	return []string{subject}, nil
+}
+
+// toUIDMapping converts a cached unstructured object into a UIDMapping
+func toUIDMapping(obj interface{}) (*v1alpha1.UIDMapping, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected UIDMapping object type %T", obj)
+	}
+
+	m := &v1alpha1.UIDMapping{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, m); err != nil {
+		return nil, fmt.Errorf("failed to parse UIDMapping %s: %v", u.GetName(), err)
+	}
+	return m, nil
+}
@@ -0,0 +1,78 @@
+package mapping
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/apis/nfsaccess/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStoreUIDMappingPrecedence(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: UIDConfigMapName, Namespace: "nfs"},
+			Data:       map[string]string{"user1": "1001", "user2": "1002"},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: GIDConfigMapName, Namespace: "nfs"},
+			Data:       map[string]string{"user1": "1001,3000"},
+		},
+	)
+
+	expired := metav1.NewTime(time.Now().Add(-time.Hour))
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme,
+		map[schema.GroupVersionResource]string{v1alpha1.UIDMappingsResource: "UIDMappingList"},
+		&v1alpha1.UIDMapping{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "nfsaccess.io/v1alpha1", Kind: "UIDMapping"},
+			ObjectMeta: metav1.ObjectMeta{Name: "user1"},
+			Spec:       v1alpha1.UIDMappingSpec{Subject: "user1", UID: 2001, GIDs: []int64{2001}},
+		},
+		&v1alpha1.UIDMapping{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "nfsaccess.io/v1alpha1", Kind: "UIDMapping"},
+			ObjectMeta: metav1.ObjectMeta{Name: "user2"},
+			Spec:       v1alpha1.UIDMappingSpec{Subject: "user2", UID: 2002, Expiry: &expired},
+		},
+	)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	s := NewStore(client, "nfs")
+	if err := s.EnableUIDMappings(dynamicClient); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	uid, found, err := s.UID("user1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(2001), uid)
+
+	gids, found, err := s.GIDs("user1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []int64{2001}, gids)
+
+	// expired UIDMappings fall back to the ConfigMap
+	uid, found, err = s.UID("user2")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(1002), uid)
+
+	_, found, err = s.UID("user3")
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
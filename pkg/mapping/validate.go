@@ -0,0 +1,157 @@
+package mapping
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MaxID is the greatest valid UID or GID, (uid_t)-1 being reserved
+const MaxID = 1<<32 - 2
+
+// Validate checks the data of the mapping object with the given name before it is
+// written, so that malformed entries are rejected rather than failing the
+// admission of the pods of their subject. It returns an error listing every
+// malformed entry (non-numeric, out of range or duplicate IDs), and warnings
+// about entries that are valid but likely mistakes, e.g. a UID mapped to several
+// subjects. Objects other than the UID and GID mapping objects are not checked.
+func (s Source) Validate(name string, data map[string]string) (warnings []string, err error) {
+	var errs []error
+	switch name {
+	case s.UIDName:
+		owners := map[int64][]string{}
+		for _, subject := range sortedKeys(data) {
+			if subject == DocumentKey {
+				continue
+			}
+			ranges, err := ParseIDRanges(data[subject])
+			if err == nil {
+				err = checkRanges(ranges)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid UIDs of %s: %v", subject, err))
+				continue
+			}
+			addOwner(owners, ranges, subject)
+		}
+		if value, ok := data[DocumentKey]; ok {
+			errs = append(errs, validateDocument(value, owners)...)
+		}
+		warnings = append(warnings, sharedIDs(owners)...)
+	case s.GIDName:
+		for _, subject := range sortedKeys(data) {
+			if subject == DocumentKey {
+				warnings = append(warnings, fmt.Sprintf("%s is only read from the UID mapping object %s", DocumentKey, s.UIDName))
+				continue
+			}
+			ids, err := ParseIDList(data[subject])
+			if err == nil {
+				err = checkIDs(ids)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid GIDs of %s: %v", subject, err))
+			}
+		}
+	}
+	return warnings, errors.Join(errs...)
+}
+
+// validateDocument returns the problems of a structured mapping document, and
+// adds the UIDs of its subjects to owners
+func validateDocument(value string, owners map[int64][]string) []error {
+	document, err := ParseDocument([]byte(value))
+	if err != nil {
+		return []error{fmt.Errorf("invalid %s: %v", DocumentKey, err)}
+	}
+	var errs []error
+	for _, subject := range sortedKeys(document.Subjects) {
+		entry := document.Subjects[subject]
+		if uids := entry.uidValue(); uids != "" {
+			ranges, err := ParseIDRanges(uids)
+			if err == nil {
+				err = checkRanges(ranges)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid uids of %s in %s: %v", subject, DocumentKey, err))
+			} else {
+				addOwner(owners, ranges, subject)
+			}
+		}
+		if err := checkIDs(entry.GIDs); err != nil {
+			errs = append(errs, fmt.Errorf("invalid gids of %s in %s: %v", subject, DocumentKey, err))
+		}
+	}
+	return errs
+}
+
+// checkRanges returns an error if ranges are out of [0, MaxID] or overlap
+func checkRanges(ranges IDRanges) error {
+	sorted := append(IDRanges(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Min < sorted[j].Min })
+	for i, r := range sorted {
+		if r.Min < 0 || r.Max > MaxID {
+			return fmt.Errorf("%s is out of range [0, %d]", IDRanges{r}, int64(MaxID))
+		}
+		if i > 0 && r.Min <= sorted[i-1].Max {
+			return fmt.Errorf("%s overlaps %s", IDRanges{r}, IDRanges{sorted[i-1]})
+		}
+	}
+	return nil
+}
+
+// checkIDs returns an error if ids are out of [0, MaxID] or listed twice
+func checkIDs(ids []int64) error {
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if id < 0 || id > MaxID {
+			return fmt.Errorf("%d is out of range [0, %d]", id, int64(MaxID))
+		}
+		if seen[id] {
+			return fmt.Errorf("%d is listed twice", id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// addOwner records subject as an owner of the single UIDs of ranges, UID ranges
+// are meant to be shared and not recorded
+func addOwner(owners map[int64][]string, ranges IDRanges, subject string) {
+	for _, r := range ranges {
+		if r.Min == r.Max && !contains(owners[r.Min], subject) {
+			owners[r.Min] = append(owners[r.Min], subject)
+		}
+	}
+}
+
+// contains returns true if subjects holds subject
+func contains(subjects []string, subject string) bool {
+	for _, s := range subjects {
+		if s == subject {
+			return true
+		}
+	}
+	return false
+}
+
+// sharedIDs returns a warning for every UID owned by several subjects
+func sharedIDs(owners map[int64][]string) []string {
+	var warnings []string
+	for _, id := range sortedKeys(owners) {
+		if subjects := owners[id]; len(subjects) > 1 {
+			warnings = append(warnings, fmt.Sprintf("UID %d is mapped to several subjects: %s", id, strings.Join(subjects, ", ")))
+		}
+	}
+	return warnings
+}
+
+// sortedKeys returns the keys of m in ascending order
+func sortedKeys[K string | int64, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,48 @@
+package mapping
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceValidate(t *testing.T) {
+	source := Source{Kind: ConfigMapKind, Namespace: "nfs", UIDName: UIDConfigMapName, GIDName: GIDConfigMapName}
+
+	tests := []struct {
+		name     string
+		object   string
+		data     map[string]string
+		wantErr  bool
+		warnings int
+	}{
+		{name: "valid uids", object: UIDConfigMapName, data: map[string]string{"user1": "1001", "user2": "2000-2099,2500"}},
+		{name: "non-numeric uid", object: UIDConfigMapName, data: map[string]string{"user1": "10O1"}, wantErr: true},
+		{name: "empty uid", object: UIDConfigMapName, data: map[string]string{"user1": ""}, wantErr: true},
+		{name: "negative uid", object: UIDConfigMapName, data: map[string]string{"user1": "-1"}, wantErr: true},
+		{name: "uid out of range", object: UIDConfigMapName, data: map[string]string{"user1": "4294967295"}, wantErr: true},
+		{name: "duplicate uid", object: UIDConfigMapName, data: map[string]string{"user1": "1001,1001"}, wantErr: true},
+		{name: "overlapping ranges", object: UIDConfigMapName, data: map[string]string{"user1": "1000-1999,1500"}, wantErr: true},
+		{name: "shared uid", object: UIDConfigMapName, data: map[string]string{"user1": "1001", "user2": "1001"}, warnings: 1},
+		{name: "valid document", object: UIDConfigMapName, data: map[string]string{
+			DocumentKey: "schemaVersion: v1\nsubjects:\n  user1:\n    uid: 1001\n    gids: [1001, 3000]",
+			// the legacy entry of the same subject isn't a shared UID
+			"user1": "1001",
+		}},
+		{name: "invalid document", object: UIDConfigMapName, data: map[string]string{DocumentKey: "schemaVersion: v2"}, wantErr: true},
+		{name: "duplicate document gid", object: UIDConfigMapName, data: map[string]string{
+			DocumentKey: "schemaVersion: v1\nsubjects:\n  user1:\n    uid: 1001\n    gids: [3000, 3000]",
+		}, wantErr: true},
+		{name: "valid gids", object: GIDConfigMapName, data: map[string]string{"user1": "1001, 3000"}},
+		{name: "non-numeric gid", object: GIDConfigMapName, data: map[string]string{"user1": "1001,abc"}, wantErr: true},
+		{name: "duplicate gid", object: GIDConfigMapName, data: map[string]string{"user1": "1001,3000,1001"}, wantErr: true},
+		{name: "gid ranges", object: GIDConfigMapName, data: map[string]string{"user1": "1000-1999"}, wantErr: true},
+		{name: "document in gid object", object: GIDConfigMapName, data: map[string]string{DocumentKey: "schemaVersion: v1"}, warnings: 1},
+		{name: "other object", object: "other", data: map[string]string{"user1": "abc"}},
+	}
+	for _, tt := range tests {
+		warnings, err := source.Validate(tt.object, tt.data)
+		assert.Equal(t, tt.wantErr, err != nil, "%s: %v", tt.name, err)
+		assert.Len(t, warnings, tt.warnings, tt.name)
+	}
+}
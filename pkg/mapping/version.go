@@ -0,0 +1,85 @@
+package mapping
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Version identifies the revision of the mappings served by a Store, so that the
+// revision enforced by every webhook replica can be compared
+type Version struct {
+	// Hash is a digest of the resourceVersions of the objects, identical on the
+	// replicas serving the same revision
+	Hash string `json:"hash"`
+	// ResourceVersions maps the objects holding the mappings, e.g.
+	// "ConfigMap nfs/nfs-pod-access-control-uid-mapping", to their resourceVersion
+	ResourceVersions map[string]string `json:"resourceVersions"`
+}
+
+// Version returns the revision of the cached mapping objects, namespace mapping
+// objects, UIDMappings and annotated serviceAccounts
+func (s *Store) Version() Version {
+	versions := map[string]string{}
+	for _, o := range s.watchedObjects() {
+		if accessor, err := meta.Accessor(o.obj); err == nil {
+			versions[fmt.Sprintf("%s %s/%s", o.kind, accessor.GetNamespace(), accessor.GetName())] = accessor.GetResourceVersion()
+		}
+	}
+
+	keys := make([]string, 0, len(versions))
+	for key := range versions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s=%s\n", key, versions[key])
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return Version{Hash: hex.EncodeToString(sum[:])[:16], ResourceVersions: versions}
+}
+
+// OnVersionChange calls f with the new Version whenever it changes, as observed
+// by the watches of the mapping objects, namespace mapping objects, UIDMappings
+// and serviceAccounts. It must be called after enabling them.
+func (s *Store) OnVersionChange(f func(Version)) error {
+	var mu sync.Mutex
+	var last string
+	changed := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if v := s.Version(); v.Hash != last {
+			last = v.Hash
+			f(v)
+		}
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { changed() },
+		UpdateFunc: func(interface{}, interface{}) { changed() },
+		DeleteFunc: func(interface{}) { changed() },
+	}
+
+	informers := []cache.SharedIndexInformer{s.informer}
+	for _, informer := range s.namespaced {
+		informers = append(informers, informer)
+	}
+	if s.uidMappings != nil {
+		informers = append(informers, s.uidMappings)
+	}
+	if s.serviceAccounts != nil {
+		informers = append(informers, s.serviceAccounts)
+	}
+	for _, informer := range informers {
+		if _, err := informer.AddEventHandler(handler); err != nil {
+			return fmt.Errorf("failed to watch mapping objects: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package mapping
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStoreVersion(t *testing.T) {
+	uids := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: UIDConfigMapName, Namespace: "nfs", ResourceVersion: "1"},
+		Data:       map[string]string{"user1": "1001"},
+	}
+	other := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "nfs", ResourceVersion: "2"}}
+	client := fake.NewSimpleClientset(uids, other)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	s := NewStore(client, "nfs")
+	versions := make(chan Version, 10)
+	assert.NoError(t, s.OnVersionChange(func(v Version) { versions <- v }))
+	if err := s.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	v := s.Version()
+	assert.Equal(t, map[string]string{"ConfigMap nfs/" + UIDConfigMapName: "1"}, v.ResourceVersions)
+	assert.Len(t, v.Hash, 16)
+	next := func() Version {
+		select {
+		case v := <-versions:
+			return v
+		case <-time.After(5 * time.Second):
+			t.Fatal("version not updated")
+			return Version{}
+		}
+	}
+	// the initial objects may be notified one by one
+	for next().Hash != v.Hash {
+	}
+
+	uids.ResourceVersion = "3"
+	uids.Data["user2"] = "1002"
+	if _, err := client.CoreV1().ConfigMaps("nfs").Update(context.Background(), uids, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	updated := next()
+	assert.NotEqual(t, v.Hash, updated.Hash)
+	assert.Equal(t, "3", updated.ResourceVersions["ConfigMap nfs/"+UIDConfigMapName])
+	assert.Equal(t, updated, s.Version())
+}
@@ -0,0 +1,26 @@
+package mapping
+
+import (
+	"strings"
+)
+
+// WindowsConfigMapName is the name of the ConfigMap mapping users to Windows user names
+const WindowsConfigMapName = "nfs-pod-access-control-windows-mapping"
+
+// WindowsUserNames returns the Windows user names, i.e. the runAsUserName of the
+// windowsOptions of pods, mapped to subject in the Windows mapping object. Values
+// are a comma separated list of user names, e.g. "ContainerUser,EXAMPLE\team-a".
+// Namespace mapping objects are ignored like for Kerberos principals. found is
+// false if subject has no Windows user name associated with it.
+func (s *Store) WindowsUserNames(subject string) (names []string, found bool, err error) {
+	data, err := s.data(s.source.WindowsName)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, name := range strings.Split(data[subject], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, len(names) > 0, nil
+}
@@ -0,0 +1,36 @@
+package mapping
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStoreWindowsUserNames(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: WindowsConfigMapName, Namespace: "nfs"},
+		Data:       map[string]string{"user1": `ContainerUser, EXAMPLE\user1`, "user2": " "},
+	})
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	s := NewStore(client, "nfs")
+	if err := s.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	names, found, err := s.WindowsUserNames("user1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []string{"ContainerUser", `EXAMPLE\user1`}, names)
+
+	for _, subject := range []string{"user2", "user3"} {
+		_, found, err = s.WindowsUserNames(subject)
+		assert.NoError(t, err)
+		assert.False(t, found, subject)
+	}
+}
@@ -0,0 +1,121 @@
+// Package messages renders the denial messages returned to users from templates
+// configured by cluster admins, e.g. to point them to an internal runbook
+package messages
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Data are the variables of denial message templates
+type Data struct {
+	// Code is the code of the denial, e.g. UIDMismatch
+	Code string
+	// Validator is the name of the denying validator, e.g. uid_validator
+	Validator string
+	// Message is the default message of the denial
+	Message string
+	// Subject is the user/serviceAccount the pod is validated for
+	Subject string
+	// Namespace and Pod are the namespace and the name of the pod
+	Namespace string
+	Pod       string
+	// Details are the values of the denial, e.g. expectedUID and foundUID
+	Details map[string]string
+	// DocsURL is the URL of the documentation set in the template file
+	DocsURL string
+}
+
+// Templates renders denial messages, the template of the code of a denial or
+// the default one
+type Templates struct {
+	DocsURL string
+	Default *template.Template
+	Codes   map[string]*template.Template
+}
+
+// file is the YAML or JSON format of template files, e.g.
+//
+//	docsURL: https://runbooks.example.com/nfs
+//	default: "{{ .Message }} See {{ .DocsURL }}"
+//	codes:
+//	  UIDMismatch: "{{ .Subject }} may only run as UID {{ .Details.expectedUID }}, see {{ .DocsURL }}#uids"
+type file struct {
+	DocsURL string            `json:"docsURL,omitempty"`
+	Default string            `json:"default,omitempty"`
+	Codes   map[string]string `json:"codes,omitempty"`
+}
+
+// LoadFile reads Templates from a YAML or JSON file
+func LoadFile(name string) (*Templates, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading denial message template file: %s\n", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses Templates in the format of template files. Templates are checked
+// against sample data so that a typo in a variable fails at startup rather than
+// when a pod is denied.
+func Parse(data []byte) (*Templates, error) {
+	var f file
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, fmt.Errorf("Error parsing denial message templates: %s\n", err)
+	}
+
+	t := &Templates{DocsURL: f.DocsURL, Codes: make(map[string]*template.Template, len(f.Codes))}
+	var err error
+	if f.Default != "" {
+		if t.Default, err = parse("default", f.Default); err != nil {
+			return nil, err
+		}
+	}
+	for code, text := range f.Codes {
+		if t.Codes[code], err = parse(code, text); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// parse parses the template text named name and checks it against sample data
+func parse(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid denial message template %s: %v", name, err)
+	}
+	sample := Data{Code: name, Message: "denied", Details: map[string]string{}}
+	if err := tmpl.Execute(&bytes.Buffer{}, sample); err != nil {
+		return nil, fmt.Errorf("invalid denial message template %s: %v", name, err)
+	}
+	return tmpl, nil
+}
+
+// Render returns the message of a denial, the default message when no template
+// applies or the template fails
+func (t *Templates) Render(data Data) (string, error) {
+	if t == nil {
+		return data.Message, nil
+	}
+	tmpl := t.Codes[data.Code]
+	if tmpl == nil {
+		tmpl = t.Default
+	}
+	if tmpl == nil {
+		return data.Message, nil
+	}
+
+	data.DocsURL = t.DocsURL
+	data.Message = strings.TrimSpace(data.Message)
+	var message bytes.Buffer
+	if err := tmpl.Execute(&message, data); err != nil {
+		return data.Message + "\n", fmt.Errorf("cannot render denial message template %s: %v", tmpl.Name(), err)
+	}
+	return strings.TrimSpace(message.String()) + "\n", nil
+}
@@ -0,0 +1,48 @@
+package messages
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	_, err := Parse([]byte(`default: "{{ .Message }"`))
+	assert.Error(t, err)
+	_, err = Parse([]byte(`codes: {UIDMismatch: "{{ .Sbject }}"}`))
+	assert.Error(t, err)
+	_, err = Parse([]byte(`defaults: "{{ .Message }}"`))
+	assert.Error(t, err)
+}
+
+func TestRender(t *testing.T) {
+	templates, err := Parse([]byte(`
+docsURL: https://runbooks.example.com/nfs
+default: "{{ .Message }}, see {{ .DocsURL }}"
+codes:
+  UIDMismatch: "{{ .Subject }} may only run as UID {{ .Details.expectedUID }}, found {{ .Details.foundUID }}. See {{ .DocsURL }}#uids"
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	data := Data{
+		Code:    "UIDMismatch",
+		Message: "Invalid uid in pod, expected: 1001, found: 0\n",
+		Subject: "user1",
+		Details: map[string]string{"expectedUID": "1001", "foundUID": "0"},
+	}
+	message, err := templates.Render(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "user1 may only run as UID 1001, found 0. See https://runbooks.example.com/nfs#uids\n", message)
+
+	data.Code = "GIDMismatch"
+	message, err = templates.Render(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "Invalid uid in pod, expected: 1001, found: 0, see https://runbooks.example.com/nfs\n", message)
+
+	var none *Templates
+	message, err = none.Render(data)
+	assert.NoError(t, err)
+	assert.Equal(t, data.Message, message)
+}
@@ -0,0 +1,319 @@
+// Package metrics holds the Prometheus metrics of the webhook,
+// they are served on the /metrics endpoint of the metrics listener
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the name of every metric
+const namespace = "nfs_pod_access_control"
+
+// Decisions recorded by ObserveAdmission, they are kept coarse as the reasons
+// returned to requesters hold UIDs and GIDs
+const (
+	DecisionAllowed    = "allowed"
+	DecisionDenied     = "denied"
+	DecisionMutated    = "mutated"
+	DecisionError      = "error"
+	DecisionOutOfScope = "out_of_scope"
+	DecisionExempted   = "exempted"
+	DecisionAudited    = "audited"
+	DecisionWarned     = "warned"
+	DecisionFailedOpen = "failed_open"
+	DecisionTimedOut   = "timed_out"
+	// DecisionRateLimited is the decision about requests exceeding the rate of
+	// their namespace
+	DecisionRateLimited = "rate_limited"
+)
+
+// Results of the shadow evaluations of pods against the candidate policy and
+// mappings, compared to the decisions of the enforced ones
+const (
+	ShadowAgreed       = "agreed"
+	ShadowNewlyDenied  = "newly_denied"
+	ShadowNewlyAllowed = "newly_allowed"
+	ShadowError        = "error"
+)
+
+// Results of identity lookups
+const (
+	ResultFound    = "found"
+	ResultNotFound = "not_found"
+	ResultError    = "error"
+)
+
+var (
+	admissionRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "admission_requests_total",
+		Help:      "Admission requests answered by the webhook.",
+	}, []string{"webhook", "allowed", "dry_run"})
+
+	admissionDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "admission_decisions_total",
+		Help:      "Admission decisions by validator and reason, dry-run requests excluded.",
+	}, []string{"webhook", "decision", "validator"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "admission_request_duration_seconds",
+		Help:      "Time taken to answer admission requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"webhook"})
+
+	lookupDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "identity_lookup_duration_seconds",
+		Help:      "Time taken to resolve the identity of a subject, by backend and result.",
+		Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"backend", "result"})
+
+	failOpen = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "fail_open",
+		Help:      "1 while the identity backend is unavailable and pods are admitted without enforcement, 0 otherwise.",
+	})
+
+	uidCollisions = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "uid_collisions",
+		Help:      "UIDs or UID ranges mapped to several users or serviceAccounts, by pair of subjects.",
+	})
+
+	expiredMappings = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "expired_mappings",
+		Help:      "Mapping entries ignored since they expired but not pruned yet, by kind of the object holding them.",
+	}, []string{"kind"})
+
+	mappingVersion = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "mapping_version_info",
+		Help:      "Always 1, labeled by the hash of the version of the mappings served.",
+	}, []string{"hash"})
+
+	mappingSnapshotAge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "mapping_snapshot_age_seconds",
+		Help:      "Age of the mapping snapshot served while the API server is unreachable, 0 while the mappings are synced with the API server.",
+	})
+
+	throttledRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "throttled_requests_total",
+		Help:      "Admission requests rejected as the maximum number of requests in flight was reached, by webhook.",
+	}, []string{"webhook"})
+
+	shadowEvaluations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "shadow_evaluations_total",
+		Help:      "Pods evaluated against the candidate policy and mappings, by result (agreed, newly_denied, newly_allowed or error) compared to the enforced ones.",
+	}, []string{"validator", "result"})
+
+	notifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "denial_notifications_total",
+		Help:      "Summaries of denied pods posted to the notification webhook, by result (sent or error).",
+	}, []string{"result"})
+
+	auditRecords = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "audit_records_total",
+		Help:      "Audit records of admission decisions, by result (written, dropped as the output is too slow, or error).",
+	}, []string{"result"})
+
+	retries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retries_total",
+		Help:      "Retries of operations failed with a transient error, by operation.",
+	}, []string{"operation"})
+
+	validatorAudits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "validator_audits_total",
+		Help:      "Pods that validators in audit mode would have denied, dry-run requests excluded.",
+	}, []string{"validator"})
+
+	nonCompliantPods = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "noncompliant_pods",
+		Help:      "Running pods the current policy and mappings would deny, by denying validator, as of the last compliance scan.",
+	}, []string{"validator"})
+
+	remediations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "remediations_total",
+		Help:      "Remediations of running pods found in violation, by action (annotate or evict) and result (done, blocked or error).",
+	}, []string{"action", "result"})
+
+	decisionCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "decision_cache_requests_total",
+		Help:      "Lookups of the cache of allowed pods, by result (hit or miss).",
+	}, []string{"result"})
+
+	sharedCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "shared_cache_requests_total",
+		Help:      "Operations on the Redis cache shared by the replicas, by operation (get or set) and result (hit, miss, done or error).",
+	}, []string{"operation", "result"})
+
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "identity_cache_requests_total",
+		Help:      "Lookups of the identity cache of the ldap, rest and vault backends, by result (hit, miss or shared, a miss waiting for the lookup of a concurrent request).",
+	}, []string{"result"})
+)
+
+// ObserveAdmission records an admission review answered by webhook (validate or mutate),
+// validator is the name of the validator that denied the pod, if any
+func ObserveAdmission(webhook string, allowed, dryRun bool, decision, validator string) {
+	admissionRequests.WithLabelValues(webhook, strconv.FormatBool(allowed), strconv.FormatBool(dryRun)).Inc()
+	if dryRun {
+		return
+	}
+	admissionDecisions.WithLabelValues(webhook, decision, validator).Inc()
+}
+
+// ObserveValidatorAudit records a pod that validator, in audit mode, would have denied
+func ObserveValidatorAudit(validator string, dryRun bool) {
+	if dryRun {
+		return
+	}
+	validatorAudits.WithLabelValues(validator).Inc()
+}
+
+// ObserveRequestDuration records the time taken to answer an admission request
+// received at start
+func ObserveRequestDuration(webhook string, start time.Time) {
+	requestDuration.WithLabelValues(webhook).Observe(time.Since(start).Seconds())
+}
+
+// ObserveLookup records the time taken by backend to resolve an identity
+func ObserveLookup(backend, result string, start time.Time) {
+	lookupDuration.WithLabelValues(backend, result).Observe(time.Since(start).Seconds())
+}
+
+// ObserveCache records a hit or a miss of the identity cache
+func ObserveCache(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheRequests.WithLabelValues(result).Inc()
+}
+
+// ObserveDecisionCache records a hit or a miss of the cache of allowed pods
+func ObserveDecisionCache(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	decisionCacheRequests.WithLabelValues(result).Inc()
+}
+
+// ObserveSharedCache records an operation on the cache shared by the replicas
+func ObserveSharedCache(operation, result string) {
+	sharedCacheRequests.WithLabelValues(operation, result).Inc()
+}
+
+// ObserveSharedLookup records a miss of the identity cache answered by the lookup
+// of a concurrent request
+func ObserveSharedLookup() {
+	cacheRequests.WithLabelValues("shared").Inc()
+}
+
+// ObserveThrottled records an admission request of webhook rejected as too many
+// requests were in flight
+func ObserveThrottled(webhook string) {
+	throttledRequests.WithLabelValues(webhook).Inc()
+}
+
+// ObserveShadow records the result of the shadow evaluation of a pod, validator
+// is the name of the validator that denied the pod with either policy, if any
+func ObserveShadow(validator, result string) {
+	shadowEvaluations.WithLabelValues(validator, result).Inc()
+}
+
+// ObserveNotification records a summary of denied pods posted to the notification
+// webhook, sent or failed
+func ObserveNotification(sent bool) {
+	result := "error"
+	if sent {
+		result = "sent"
+	}
+	notifications.WithLabelValues(result).Inc()
+}
+
+// ObserveAuditRecord records an audit record written, dropped or failed
+func ObserveAuditRecord(result string) {
+	auditRecords.WithLabelValues(result).Inc()
+}
+
+// ObserveRetry records a retry of operation after a transient error
+func ObserveRetry(operation string) {
+	retries.WithLabelValues(operation).Inc()
+}
+
+// SetFailOpen records whether pods are admitted without enforcement because the
+// identity backend is unavailable
+func SetFailOpen(open bool) {
+	if open {
+		failOpen.Set(1)
+	} else {
+		failOpen.Set(0)
+	}
+}
+
+// SetUIDCollisions records the number of UID collisions between subjects of the mappings
+func SetUIDCollisions(collisions int) {
+	uidCollisions.Set(float64(collisions))
+}
+
+// SetExpiredMappings records the number of expired mapping entries, by kind of
+// the object holding them
+func SetExpiredMappings(entries map[string]int) {
+	expiredMappings.Reset()
+	for kind, n := range entries {
+		expiredMappings.WithLabelValues(kind).Set(float64(n))
+	}
+}
+
+// SetMappingVersion records the hash of the version of the mappings served
+func SetMappingVersion(hash string) {
+	mappingVersion.Reset()
+	mappingVersion.WithLabelValues(hash).Set(1)
+}
+
+// SetMappingSnapshotAge records the age of the mapping snapshot served, 0 when
+// the mappings are synced with the API server
+func SetMappingSnapshotAge(age time.Duration) {
+	mappingSnapshotAge.Set(age.Seconds())
+}
+
+// SetNonCompliantPods records the number of running pods the current policy would
+// deny, by validator
+func SetNonCompliantPods(pods map[string]int) {
+	nonCompliantPods.Reset()
+	for validator, n := range pods {
+		nonCompliantPods.WithLabelValues(validator).Set(float64(n))
+	}
+}
+
+// ObserveRemediation records a remediation of a running pod found in violation
+func ObserveRemediation(action, result string) {
+	remediations.WithLabelValues(action, result).Inc()
+}
+
+// Handler returns the http.Handler serving the metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
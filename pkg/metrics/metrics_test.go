@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveAdmission(t *testing.T) {
+	ObserveAdmission("validate", false, false, DecisionDenied, "uid_validator")
+	ObserveAdmission("validate", false, true, DecisionDenied, "uid_validator")
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(admissionRequests.WithLabelValues("validate", "false", "false")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(admissionRequests.WithLabelValues("validate", "false", "true")))
+	// dry-run requests are not counted as decisions
+	assert.Equal(t, 1.0, testutil.ToFloat64(admissionDecisions.WithLabelValues("validate", DecisionDenied, "uid_validator")))
+}
+
+func TestObserveCache(t *testing.T) {
+	ObserveCache(true)
+	ObserveCache(true)
+	ObserveCache(false)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(cacheRequests.WithLabelValues("hit")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(cacheRequests.WithLabelValues("miss")))
+}
+
+func TestSetMappingVersion(t *testing.T) {
+	SetMappingVersion("a")
+	SetMappingVersion("b")
+
+	assert.Equal(t, 1, testutil.CollectAndCount(mappingVersion))
+	assert.Equal(t, 1.0, testutil.ToFloat64(mappingVersion.WithLabelValues("b")))
+}
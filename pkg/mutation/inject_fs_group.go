@@ -0,0 +1,96 @@
+package mutation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/nfs"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// injectFSGroup is a container for the fsGroup injection mutation
+type injectFSGroup struct {
+	Logger   logrus.FieldLogger
+	Resolver resolver.UIDResolver
+	// NFS detects NFS volumes provided by PersistentVolumeClaims, nil only
+	// recognizes inline NFS volumes
+	NFS *nfs.Detector
+	// ChangePolicy is applied as fsGroupChangePolicy when not empty
+	ChangePolicy corev1.PodFSGroupChangePolicy
+}
+
+// injectFSGroup implements the podMutator interface
+var _ podMutator = (*injectFSGroup)(nil)
+
+// Name returns the injectFSGroup short name
+func (ifg injectFSGroup) Name() string {
+	return "inject_fs_group"
+}
+
+// Mutate returns a new mutated pod with fsGroup set to the first GID mapped to the
+// requesting user/serviceAccount. Only pods mounting NFS volumes and not already
+// setting fsGroup are mutated, users without a GID mapping are left untouched.
+func (ifg injectFSGroup) Mutate(ctx context.Context, pod *corev1.Pod, a *admissionv1.AdmissionRequest) (*corev1.Pod, error) {
+	ifg.Logger = ifg.Logger.WithField("mutation", ifg.Name())
+
+	if !ifg.mountsNFS(ctx, pod, a.Namespace) {
+		return pod, nil
+	}
+	if sc := pod.Spec.SecurityContext; sc != nil && sc.FSGroup != nil {
+		return pod, nil
+	}
+
+	user := getUser(ifg.Logger, a, pod)
+	gid, found, err := getGID(ctx, ifg.Resolver, a.Namespace, resolvedSubject(a, user), getGroups(a))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to set fsGroup: %s\n", err)
+	}
+	if !found {
+		ifg.Logger.Infof("User %s has no GID associated with it, fsGroup not injected", user)
+		return pod, nil
+	}
+
+	ifg.Logger.Infof("No fsGroup found, applying GID %d of User %s", gid, user)
+	mpod := pod.DeepCopy()
+	if mpod.Spec.SecurityContext == nil {
+		mpod.Spec.SecurityContext = &corev1.PodSecurityContext{}
+	}
+	mpod.Spec.SecurityContext.FSGroup = &gid
+	if ifg.ChangePolicy != "" && mpod.Spec.SecurityContext.FSGroupChangePolicy == nil {
+		policy := ifg.ChangePolicy
+		mpod.Spec.SecurityContext.FSGroupChangePolicy = &policy
+	}
+	return mpod, nil
+}
+
+// getGID returns the first GID associated with user,
+// found is false when the user has no GID associated with it
+func getGID(ctx context.Context, r resolver.UIDResolver, namespace, user string, groups []string) (gid int64, found bool, err error) {
+	identity, err := resolver.ResolveUser(ctx, r, namespace, user, groups)
+	if err != nil && !errors.Is(err, resolver.ErrNotFound) {
+		return 0, false, err
+	}
+	if len(identity.GIDs) == 0 {
+		return 0, false, nil
+	}
+	return identity.GIDs[0], true, nil
+}
+
+// mountsNFS returns true if the pod mounts at least one NFS volume, inline or
+// through a PersistentVolumeClaim when NFS detection is enabled
+func (ifg injectFSGroup) mountsNFS(ctx context.Context, pod *corev1.Pod, namespace string) bool {
+	if ifg.NFS != nil {
+		mounts, _ := ifg.NFS.MountsNFS(ctx, pod, namespace)
+		return mounts
+	}
+	for _, v := range pod.Spec.Volumes {
+		if v.NFS != nil {
+			return true
+		}
+	}
+	return false
+}
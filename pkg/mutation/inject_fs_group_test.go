@@ -0,0 +1,80 @@
+package mutation
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestInjectFSGroup(t *testing.T) {
+	identities := staticResolver{
+		"user1": {UID: int64Ptr(1001), GIDs: []int64{3000, 1001}},
+		"user3": {UID: int64Ptr(1003)},
+	}
+	nfs := []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{NFS: &corev1.NFSVolumeSource{Server: "nfs.example.com", Path: "/data"}}}}
+	emptyDir := []corev1.Volume{{Name: "cache", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}}
+	always := corev1.FSGroupChangeAlways
+
+	tests := []struct {
+		name         string
+		user         string
+		changePolicy corev1.PodFSGroupChangePolicy
+		pod          corev1.PodSpec
+		patch        string
+	}{
+		{
+			name:  "nfs volume",
+			user:  "user1",
+			pod:   corev1.PodSpec{Volumes: nfs},
+			patch: `[{"op":"add","path":"/spec/securityContext","value":{"fsGroup":3000}}]`,
+		},
+		{
+			name:  "no nfs volume",
+			user:  "user1",
+			pod:   corev1.PodSpec{Volumes: emptyDir},
+			patch: `null`,
+		},
+		{
+			name:  "fsGroup already set",
+			user:  "user1",
+			pod:   corev1.PodSpec{Volumes: nfs, SecurityContext: &corev1.PodSecurityContext{FSGroup: int64Ptr(1001)}},
+			patch: `null`,
+		},
+		{
+			name:         "fsGroupChangePolicy",
+			user:         "user1",
+			changePolicy: corev1.FSGroupChangeOnRootMismatch,
+			pod:          corev1.PodSpec{Volumes: nfs, SecurityContext: &corev1.PodSecurityContext{RunAsUser: int64Ptr(1001)}},
+			patch:        `[{"op":"add","path":"/spec/securityContext/fsGroup","value":3000},{"op":"add","path":"/spec/securityContext/fsGroupChangePolicy","value":"OnRootMismatch"}]`,
+		},
+		{
+			name:         "fsGroupChangePolicy already set",
+			user:         "user1",
+			changePolicy: corev1.FSGroupChangeOnRootMismatch,
+			pod:          corev1.PodSpec{Volumes: nfs, SecurityContext: &corev1.PodSecurityContext{FSGroupChangePolicy: &always}},
+			patch:        `[{"op":"add","path":"/spec/securityContext/fsGroup","value":3000}]`,
+		},
+		{
+			name:  "unmapped user",
+			user:  "user2",
+			pod:   corev1.PodSpec{Volumes: nfs},
+			patch: `null`,
+		},
+		{
+			name:  "user without gid",
+			user:  "user3",
+			pod:   corev1.PodSpec{Volumes: nfs},
+			patch: `null`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := injectFSGroup{Logger: logrus.New(), Resolver: identities, ChangePolicy: tt.changePolicy}
+			got, err := patch(t, m, &corev1.Pod{Spec: tt.pod}, tt.user)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.patch, got)
+		})
+	}
+}
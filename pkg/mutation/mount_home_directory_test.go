@@ -0,0 +1,122 @@
+package mutation
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	"github.com/wI2L/jsondiff"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// staticResolver resolves the identities of a map, by subject
+type staticResolver map[string]resolver.IdentitySpec
+
+func (s staticResolver) Resolve(_ context.Context, subject string) (resolver.IdentitySpec, error) {
+	id, ok := s[subject]
+	if !ok {
+		return id, resolver.ErrNotFound
+	}
+	return id, nil
+}
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
+// patch returns the JSON patch of the mutation of pod by m, as created by user
+func patch(t *testing.T, m podMutator, pod *corev1.Pod, user string) (string, error) {
+	req := &admissionv1.AdmissionRequest{Namespace: "team-a", UserInfo: authenticationv1.UserInfo{Username: user}}
+	mpod, err := m.Mutate(context.TODO(), pod, req)
+	if err != nil {
+		return "", err
+	}
+	ops, err := jsondiff.Compare(pod, mpod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(raw), nil
+}
+
+func TestMountHomeDirectory(t *testing.T) {
+	identities := staticResolver{
+		"user1": {UID: int64Ptr(1001), GIDs: []int64{1001}},
+		"web":   {UID: int64Ptr(2001)},
+	}
+	home := corev1.Volume{Name: "home", VolumeSource: corev1.VolumeSource{NFS: &corev1.NFSVolumeSource{Server: "nfs.example.com", Path: "/home/user1"}}}
+	mount := corev1.VolumeMount{Name: "home", MountPath: "/home/user1"}
+
+	tests := []struct {
+		name  string
+		user  string
+		pod   corev1.PodSpec
+		patch string
+		err   string
+	}{
+		{
+			name:  "no securityContext",
+			user:  "user1",
+			pod:   corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+			patch: `[{"op":"add","path":"/spec/securityContext","value":{"runAsUser":1001}}]`,
+		},
+		{
+			name:  "securityContext without runAsUser",
+			user:  "user1",
+			pod:   corev1.PodSpec{SecurityContext: &corev1.PodSecurityContext{FSGroup: int64Ptr(1001)}, Containers: []corev1.Container{{Name: "app"}}},
+			patch: `[{"op":"add","path":"/spec/securityContext/runAsUser","value":1001}]`,
+		},
+		{
+			// the volumes and the containers, even without securityContext, are left untouched
+			name: "volume already mounted",
+			user: "user1",
+			pod: corev1.PodSpec{
+				Volumes:    []corev1.Volume{home},
+				Containers: []corev1.Container{{Name: "app", VolumeMounts: []corev1.VolumeMount{mount}}, {Name: "sidecar"}},
+			},
+			patch: `[{"op":"add","path":"/spec/securityContext","value":{"runAsUser":1001}}]`,
+		},
+		{
+			name:  "runAsUser already set",
+			user:  "user1",
+			pod:   corev1.PodSpec{SecurityContext: &corev1.PodSecurityContext{RunAsUser: int64Ptr(0)}, Containers: []corev1.Container{{Name: "app"}}},
+			patch: `null`,
+		},
+		{
+			name:  "serviceAccount",
+			user:  "system:serviceaccount:team-a:web",
+			pod:   corev1.PodSpec{ServiceAccountName: "web", Containers: []corev1.Container{{Name: "app"}}},
+			patch: `[{"op":"add","path":"/spec/securityContext","value":{"runAsUser":2001}}]`,
+		},
+		{
+			name: "unmapped user",
+			user: "user2",
+			pod:  corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+			err:  "User user2 has no UID associated with it",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: tt.pod}
+			m := mountHomeDirectory{Logger: logrus.New(), Resolver: identities}
+			got, err := patch(t, m, pod, tt.user)
+			if tt.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tt.err)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.patch, got)
+			assert.Nil(t, pod.Spec.Containers[0].SecurityContext)
+		})
+	}
+}
@@ -1,33 +1,51 @@
 package mutation
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/nfs"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/tracing"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/validation"
 	"github.com/wI2L/jsondiff"
+	"go.opentelemetry.io/otel/codes"
 	admissionv1 "k8s.io/api/admission/v1"
 	corev1 "k8s.io/api/core/v1"
 )
 
 // Mutator is a container for mutation
 type Mutator struct {
-	Logger *logrus.Entry
+	Logger   *logrus.Entry
+	Policy   Policy
+	Resolver resolver.UIDResolver
+	// NFS detects the pods mounting NFS storage through PersistentVolumeClaims,
+	// nil only recognizes inline NFS volumes
+	NFS *nfs.Detector
+}
+
+// Policy holds the settings tuning how pods are mutated
+type Policy struct {
+	// FSGroupChangePolicy is injected alongside fsGroup when not empty,
+	// e.g. OnRootMismatch to skip recursive chowns of already owned volumes
+	FSGroupChangePolicy corev1.PodFSGroupChangePolicy
 }
 
 // NewMutator returns an initialised instance of Mutator
-func NewMutator(logger *logrus.Entry) *Mutator {
-	return &Mutator{Logger: logger}
+func NewMutator(logger *logrus.Entry, policy Policy, r resolver.UIDResolver) *Mutator {
+	return &Mutator{Logger: logger, Policy: policy, Resolver: r}
 }
 
 // podMutators is an interface used to group functions mutating pods
 type podMutator interface {
-	Mutate(*corev1.Pod, *admissionv1.AdmissionRequest) (*corev1.Pod, error)
+	Mutate(context.Context, *corev1.Pod, *admissionv1.AdmissionRequest) (*corev1.Pod, error)
 	Name() string
 }
 
 // MutatePodPatch returns a json patch containing all the mutations needed for
-// a given pod
-func (m *Mutator) MutatePodPatch(pod *corev1.Pod, a *admissionv1.AdmissionRequest) ([]byte, error) {
+// a given pod, every mutation is traced as a child span of ctx
+func (m *Mutator) MutatePodPatch(ctx context.Context, pod *corev1.Pod, a *admissionv1.AdmissionRequest) ([]byte, error) {
 	var podName string
 	if pod.Name != "" {
 		podName = pod.Name
@@ -38,9 +56,16 @@ func (m *Mutator) MutatePodPatch(pod *corev1.Pod, a *admissionv1.AdmissionReques
 	}
 	log := logrus.WithField("pod_name", podName)
 
-	// list of all mutations to be applied to the pod
-	mutations := []podMutator{
-		mountHomeDirectory{Logger: log},
+	// list of all mutations to be applied to the pod, the API server rejects the
+	// runAsUser and fsGroup of pods targeting Windows nodes
+	var mutations []podMutator
+	if validation.IsWindowsPod(pod) {
+		log.Info("pod targets Windows nodes, skipping the injection of runAsUser and fsGroup")
+	} else {
+		mutations = append(mutations,
+			mountHomeDirectory{Logger: log, Resolver: m.Resolver},
+			injectFSGroup{Logger: log, Resolver: m.Resolver, NFS: m.NFS, ChangePolicy: m.Policy.FSGroupChangePolicy},
+		)
 	}
 
 	mpod := pod.DeepCopy()
@@ -48,7 +73,7 @@ func (m *Mutator) MutatePodPatch(pod *corev1.Pod, a *admissionv1.AdmissionReques
 	// apply all mutations
 	for _, m := range mutations {
 		var err error
-		mpod, err = m.Mutate(mpod, a)
+		mpod, err = mutate(ctx, m, mpod, a)
 		if err != nil {
 			return nil, err
 		}
@@ -67,3 +92,16 @@ func (m *Mutator) MutatePodPatch(pod *corev1.Pod, a *admissionv1.AdmissionReques
 
 	return patchb, nil
 }
+
+// mutate applies a mutation to the pod within its own span
+func mutate(ctx context.Context, m podMutator, pod *corev1.Pod, a *admissionv1.AdmissionRequest) (*corev1.Pod, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "mutate "+m.Name())
+	defer span.End()
+
+	mpod, err := m.Mutate(ctx, pod, a)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return mpod, err
+}
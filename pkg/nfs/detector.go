@@ -0,0 +1,217 @@
+// Package nfs detects pods mounting NFS storage, so that the UID policy is only
+// enforced on pods that actually touch an NFS share
+package nfs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	storagelisters "k8s.io/client-go/listers/storage/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DefaultCSIDrivers are the CSI drivers providing NFS volumes by default
+var DefaultCSIDrivers = []string{"nfs.csi.k8s.io"}
+
+// defaultClassAnnotation marks the default StorageClass of the cluster
+const defaultClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+
+// Detector is a container for NFS volume detection, PersistentVolumeClaims,
+// PersistentVolumes and StorageClasses are read from an in-memory cache kept up
+// to date by informers
+type Detector struct {
+	factory   informers.SharedInformerFactory
+	informers []cache.SharedIndexInformer
+
+	claims  corelisters.PersistentVolumeClaimLister
+	volumes corelisters.PersistentVolumeLister
+	classes storagelisters.StorageClassLister
+
+	Logger logrus.FieldLogger
+	// CSIDrivers are the names of the CSI drivers providing NFS volumes
+	CSIDrivers []string
+}
+
+// NewDetector returns a Detector watching PersistentVolumeClaims, PersistentVolumes
+// and StorageClasses with client, recognizing the DefaultCSIDrivers. The cache is
+// only filled once Start is called.
+func NewDetector(client kubernetes.Interface) *Detector {
+	factory := informers.NewSharedInformerFactory(client, 0)
+	claims := factory.Core().V1().PersistentVolumeClaims()
+	volumes := factory.Core().V1().PersistentVolumes()
+	classes := factory.Storage().V1().StorageClasses()
+
+	return &Detector{
+		factory:    factory,
+		informers:  []cache.SharedIndexInformer{claims.Informer(), volumes.Informer(), classes.Informer()},
+		claims:     claims.Lister(),
+		volumes:    volumes.Lister(),
+		classes:    classes.Lister(),
+		Logger:     logrus.StandardLogger(),
+		CSIDrivers: DefaultCSIDrivers,
+	}
+}
+
+// Start starts watching PersistentVolumeClaims, PersistentVolumes and StorageClasses
+// and blocks until the cache is synced
+func (d *Detector) Start(stopCh <-chan struct{}) error {
+	d.factory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, d.synced) {
+		return fmt.Errorf("failed to sync PersistentVolumeClaim, PersistentVolume and StorageClass caches")
+	}
+	return nil
+}
+
+// Ready returns an error until the cache is synced
+func (d *Detector) Ready() error {
+	if !d.synced() {
+		return fmt.Errorf("PersistentVolumeClaim, PersistentVolume and StorageClass caches not synced")
+	}
+	return nil
+}
+
+// synced returns true once every informer is synced
+func (d *Detector) synced() bool {
+	for _, informer := range d.informers {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// MountsNFS returns true with the name of the volume if pod, created in namespace,
+// mounts an `nfs:` volume, an inline volume of an NFS CSI driver or a
+// PersistentVolumeClaim backed by NFS, either bound to an NFS PersistentVolume or
+// provisioned by an NFS CSI driver through its StorageClass. Generic ephemeral
+// volumes are resolved through the StorageClass of their claim template. Volumes
+// that can't be resolved are considered NFS volumes, so that the policy is
+// enforced on them.
+func (d *Detector) MountsNFS(ctx context.Context, pod *corev1.Pod, namespace string) (bool, string) {
+	for _, v := range pod.Spec.Volumes {
+		nfs, err := d.isNFS(v, namespace)
+		if err != nil {
+			d.Logger.Warnf("cannot tell whether volume %s is NFS, enforcing: %v", v.Name, err)
+			return true, v.Name
+		}
+		if nfs {
+			return true, v.Name
+		}
+	}
+	return false, ""
+}
+
+// isNFS returns true if the volume v of a pod of namespace is backed by NFS
+func (d *Detector) isNFS(v corev1.Volume, namespace string) (bool, error) {
+	switch {
+	case v.NFS != nil:
+		return true, nil
+	case v.CSI != nil:
+		return d.isNFSDriver(v.CSI.Driver), nil
+	case v.PersistentVolumeClaim != nil:
+		return d.claimIsNFS(namespace, v.PersistentVolumeClaim.ClaimName)
+	case v.Ephemeral != nil && v.Ephemeral.VolumeClaimTemplate != nil:
+		return d.classIsNFS(v.Ephemeral.VolumeClaimTemplate.Spec.StorageClassName)
+	}
+	return false, nil
+}
+
+// claimIsNFS returns true if the PersistentVolumeClaim is bound to an NFS
+// PersistentVolume or, until it is bound, if its StorageClass provisions NFS volumes
+func (d *Detector) claimIsNFS(namespace, name string) (bool, error) {
+	pvc, err := d.claims.PersistentVolumeClaims(namespace).Get(name)
+	if err != nil {
+		return false, fmt.Errorf("Error getting PersistentVolumeClaim: %s\n", err)
+	}
+	if pvc.Spec.VolumeName == "" {
+		return d.classIsNFS(pvc.Spec.StorageClassName)
+	}
+
+	pv, err := d.volumes.Get(pvc.Spec.VolumeName)
+	if err != nil {
+		return false, fmt.Errorf("Error getting PersistentVolume: %s\n", err)
+	}
+	return d.volumeIsNFS(pv), nil
+}
+
+// volumeIsNFS returns true if pv is an NFS volume or a volume of an NFS CSI driver
+func (d *Detector) volumeIsNFS(pv *corev1.PersistentVolume) bool {
+	if pv.Spec.NFS != nil {
+		return true
+	}
+	return pv.Spec.CSI != nil && d.isNFSDriver(pv.Spec.CSI.Driver)
+}
+
+// classIsNFS returns true if the StorageClass named name, or the default
+// StorageClass when name is nil, is provisioned by an NFS CSI driver. Claims
+// explicitly without StorageClass ("") are only bound to existing volumes.
+func (d *Detector) classIsNFS(name *string) (bool, error) {
+	if name != nil && *name == "" {
+		return false, nil
+	}
+
+	var class *storagev1.StorageClass
+	if name != nil {
+		c, err := d.classes.Get(*name)
+		if err != nil {
+			return false, fmt.Errorf("Error getting StorageClass: %s\n", err)
+		}
+		class = c
+	} else {
+		c, err := d.defaultClass()
+		if err != nil {
+			return false, err
+		}
+		class = c
+	}
+	return class != nil && d.isNFSDriver(class.Provisioner), nil
+}
+
+// defaultClass returns the default StorageClass, nil if there is none
+func (d *Detector) defaultClass() (*storagev1.StorageClass, error) {
+	classes, err := d.classes.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("Error listing StorageClasses: %s\n", err)
+	}
+	for _, class := range classes {
+		if class.Annotations[defaultClassAnnotation] == "true" {
+			return class, nil
+		}
+	}
+	return nil, nil
+}
+
+// ParseCSIDrivers parses a comma separated list of CSI driver names, the
+// DefaultCSIDrivers are returned when the list is empty
+func ParseCSIDrivers(value string) []string {
+	var drivers []string
+	for _, driver := range strings.Split(value, ",") {
+		driver = strings.TrimSpace(driver)
+		if driver == "" {
+			continue
+		}
+		drivers = append(drivers, driver)
+	}
+	if len(drivers) == 0 {
+		return DefaultCSIDrivers
+	}
+	return drivers
+}
+
+// isNFSDriver returns true if driver is one of the NFS CSI drivers
+func (d *Detector) isNFSDriver(driver string) bool {
+	for _, name := range d.CSIDrivers {
+		if name == driver {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package nfs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseCSIDrivers(t *testing.T) {
+	assert.Equal(t, DefaultCSIDrivers, ParseCSIDrivers(""))
+	assert.Equal(t, DefaultCSIDrivers, ParseCSIDrivers(" , "))
+	assert.Equal(t, []string{"nfs.csi.k8s.io", "csi.trident.netapp.io"}, ParseCSIDrivers("nfs.csi.k8s.io, csi.trident.netapp.io"))
+}
+
+func TestMountsNFS(t *testing.T) {
+	nfsClass, blockClass, missingClass := "nfs", "gp3", "missing"
+	client := fake.NewSimpleClientset(
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "home", Namespace: "team-a"},
+			Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: "pv-nfs"},
+		},
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "team-a"},
+			Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: "pv-csi"},
+		},
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "scratch", Namespace: "team-a"},
+			Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: "pv-block"},
+		},
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "pending-nfs", Namespace: "team-a"},
+			Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: &nfsClass},
+		},
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "pending-default", Namespace: "team-a"},
+		},
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "pending-static", Namespace: "team-a"},
+			Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: new(string)},
+		},
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: nfsClass},
+			Provisioner: "nfs.csi.k8s.io",
+		},
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: blockClass, Annotations: map[string]string{defaultClassAnnotation: "true"}},
+			Provisioner: "ebs.csi.aws.com",
+		},
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-nfs"},
+			Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{
+				NFS: &corev1.NFSVolumeSource{Server: "nfs.example.com", Path: "/exports/home"},
+			}},
+		},
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-csi"},
+			Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: "nfs.csi.k8s.io", VolumeHandle: "data"},
+			}},
+		},
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-block"},
+			Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: "ebs.csi.aws.com", VolumeHandle: "vol-1"},
+			}},
+		},
+	)
+	d := NewDetector(client)
+	stop := make(chan struct{})
+	defer close(stop)
+	if err := d.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, d.Ready())
+
+	claim := func(name string) corev1.VolumeSource {
+		return corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: name}}
+	}
+	ephemeral := func(class *string) corev1.VolumeSource {
+		return corev1.VolumeSource{Ephemeral: &corev1.EphemeralVolumeSource{
+			VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
+				Spec: corev1.PersistentVolumeClaimSpec{StorageClassName: class},
+			},
+		}}
+	}
+	tests := []struct {
+		name   string
+		volume corev1.VolumeSource
+		nfs    bool
+	}{
+		{name: "nfs volume", volume: corev1.VolumeSource{NFS: &corev1.NFSVolumeSource{Server: "nfs", Path: "/"}}, nfs: true},
+		{name: "nfs csi inline volume", volume: corev1.VolumeSource{CSI: &corev1.CSIVolumeSource{Driver: "nfs.csi.k8s.io"}}, nfs: true},
+		{name: "other csi inline volume", volume: corev1.VolumeSource{CSI: &corev1.CSIVolumeSource{Driver: "secrets-store.csi.k8s.io"}}, nfs: false},
+		{name: "emptyDir", volume: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}, nfs: false},
+		{name: "nfs pv", volume: claim("home"), nfs: true},
+		{name: "nfs csi pv", volume: claim("data"), nfs: true},
+		{name: "block pv", volume: claim("scratch"), nfs: false},
+		{name: "missing pvc is enforced", volume: claim("missing"), nfs: true},
+		{name: "pending nfs class pvc", volume: claim("pending-nfs"), nfs: true},
+		{name: "pending default class pvc", volume: claim("pending-default"), nfs: false},
+		{name: "pending pvc without class", volume: claim("pending-static"), nfs: false},
+		{name: "nfs class ephemeral volume", volume: ephemeral(&nfsClass), nfs: true},
+		{name: "block class ephemeral volume", volume: ephemeral(&blockClass), nfs: false},
+		{name: "ephemeral volume without class", volume: ephemeral(new(string)), nfs: false},
+		{name: "missing class ephemeral volume is enforced", volume: ephemeral(&missingClass), nfs: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Volumes: []corev1.Volume{{Name: "v", VolumeSource: tt.volume}}}}
+			nfs, _ := d.MountsNFS(context.TODO(), pod, "team-a")
+			assert.Equal(t, tt.nfs, nfs)
+		})
+	}
+}
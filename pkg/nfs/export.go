@@ -0,0 +1,110 @@
+package nfs
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Export is an NFS export mounted by a volume of a pod
+type Export struct {
+	Server string
+	Path   string
+	// ReadOnly is true when the volume itself is read-only, its volumeMounts may still be
+	ReadOnly bool
+	// MountOptions are the NFS mount options of the volume, e.g. ["nfsvers=4.1", "sec=krb5"]
+	MountOptions []string
+}
+
+// InlineExport returns the export of an `nfs:` volume, nil for other volumes
+func InlineExport(v corev1.Volume) *Export {
+	if v.NFS == nil {
+		return nil
+	}
+	return &Export{Server: v.NFS.Server, Path: v.NFS.Path, ReadOnly: v.NFS.ReadOnly}
+}
+
+// Export returns the export mounted by the volume v of a pod of namespace: the
+// export of an `nfs:` volume, of an inline volume of an NFS CSI driver or of the
+// PersistentVolume bound to a PersistentVolumeClaim. It returns nil for volumes
+// that don't mount NFS and claims not bound yet.
+func (d *Detector) Export(namespace string, v corev1.Volume) (*Export, error) {
+	switch {
+	case v.NFS != nil:
+		return InlineExport(v), nil
+	case v.CSI != nil:
+		if !d.isNFSDriver(v.CSI.Driver) {
+			return nil, nil
+		}
+		readOnly := v.CSI.ReadOnly != nil && *v.CSI.ReadOnly
+		return csiExport(v.CSI.VolumeAttributes, readOnly, nil), nil
+	case v.PersistentVolumeClaim != nil:
+		return d.claimExport(namespace, v.PersistentVolumeClaim)
+	}
+	return nil, nil
+}
+
+// claimExport returns the export of the PersistentVolume bound to a claim
+func (d *Detector) claimExport(namespace string, claim *corev1.PersistentVolumeClaimVolumeSource) (*Export, error) {
+	pvc, err := d.claims.PersistentVolumeClaims(namespace).Get(claim.ClaimName)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting PersistentVolumeClaim: %s\n", err)
+	}
+	if pvc.Spec.VolumeName == "" {
+		return nil, nil
+	}
+	pv, err := d.volumes.Get(pvc.Spec.VolumeName)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting PersistentVolume: %s\n", err)
+	}
+
+	switch {
+	case pv.Spec.NFS != nil:
+		return &Export{
+			Server:       pv.Spec.NFS.Server,
+			Path:         pv.Spec.NFS.Path,
+			ReadOnly:     claim.ReadOnly || pv.Spec.NFS.ReadOnly,
+			MountOptions: pv.Spec.MountOptions,
+		}, nil
+	case pv.Spec.CSI != nil && d.isNFSDriver(pv.Spec.CSI.Driver):
+		return csiExport(pv.Spec.CSI.VolumeAttributes, claim.ReadOnly || pv.Spec.CSI.ReadOnly, pv.Spec.MountOptions), nil
+	}
+	return nil, nil
+}
+
+// csiExport returns the export described by the volume attributes of an NFS CSI
+// volume, the `server` and `share` attributes of the nfs.csi.k8s.io driver. The
+// `mountOptions` attribute is comma separated and appended to mountOptions.
+func csiExport(attributes map[string]string, readOnly bool, mountOptions []string) *Export {
+	e := &Export{
+		Server:       attributes["server"],
+		Path:         attributes["share"],
+		ReadOnly:     readOnly,
+		MountOptions: mountOptions,
+	}
+	if options := attributes["mountOptions"]; options != "" {
+		e.MountOptions = append(append([]string(nil), mountOptions...), options)
+	}
+	return e
+}
+
+// SecurityFlavors returns the security flavors of the sec mount option, e.g.
+// ["krb5", "krb5i"] for sec=krb5:krb5i, the last sec option wins. It returns nil
+// when no sec option is set, letting the client negotiate it.
+func (e *Export) SecurityFlavors() []string {
+	var flavors []string
+	for _, options := range e.MountOptions {
+		for _, option := range strings.Split(options, ",") {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(option), "sec="); ok {
+				flavors = strings.Split(value, ":")
+			}
+		}
+	}
+	return flavors
+}
+
+// String returns the server:/path of the export
+func (e *Export) String() string {
+	return e.Server + ":" + e.Path
+}
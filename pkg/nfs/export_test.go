@@ -0,0 +1,89 @@
+package nfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestExport(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "home", Namespace: "team-a"},
+			Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: "pv-nfs"},
+		},
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "team-a"},
+			Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: "pv-csi"},
+		},
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "team-a"},
+		},
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-nfs"},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					NFS: &corev1.NFSVolumeSource{Server: "nfs.example.com", Path: "/exports/home"},
+				},
+				MountOptions: []string{"nfsvers=4.1", "sec=krb5"},
+			},
+		},
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-csi"},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{
+					Driver:           "nfs.csi.k8s.io",
+					VolumeHandle:     "data",
+					VolumeAttributes: map[string]string{"server": "nfs.example.com", "share": "/exports/data", "mountOptions": "sec=sys"},
+				}},
+				MountOptions: []string{"nfsvers=4.1"},
+			},
+		},
+	)
+	d := NewDetector(client)
+	stop := make(chan struct{})
+	defer close(stop)
+	if err := d.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	claim := func(name string, readOnly bool) corev1.Volume {
+		return corev1.Volume{Name: name, VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: name, ReadOnly: readOnly},
+		}}
+	}
+
+	e, err := d.Export("team-a", claim("home", true))
+	if assert.NoError(t, err) && assert.NotNil(t, e) {
+		assert.Equal(t, "nfs.example.com:/exports/home", e.String())
+		assert.True(t, e.ReadOnly)
+		assert.Equal(t, []string{"krb5"}, e.SecurityFlavors())
+	}
+
+	e, err = d.Export("team-a", claim("data", false))
+	if assert.NoError(t, err) && assert.NotNil(t, e) {
+		assert.Equal(t, "nfs.example.com:/exports/data", e.String())
+		assert.False(t, e.ReadOnly)
+		assert.Equal(t, []string{"sys"}, e.SecurityFlavors())
+	}
+
+	e, err = d.Export("team-a", claim("pending", false))
+	assert.NoError(t, err)
+	assert.Nil(t, e)
+
+	_, err = d.Export("team-a", claim("missing", false))
+	assert.Error(t, err)
+
+	e, err = d.Export("team-a", corev1.Volume{VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}})
+	assert.NoError(t, err)
+	assert.Nil(t, e)
+}
+
+func TestSecurityFlavors(t *testing.T) {
+	assert.Nil(t, (&Export{}).SecurityFlavors())
+	assert.Equal(t, []string{"krb5", "krb5i"}, (&Export{MountOptions: []string{"sec=krb5:krb5i"}}).SecurityFlavors())
+	assert.Equal(t, []string{"krb5p"}, (&Export{MountOptions: []string{"sec=sys", "hard,sec=krb5p"}}).SecurityFlavors())
+}
@@ -0,0 +1,136 @@
+package nfs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// resyncPeriod is the period at which NodeWatcher syncs even without pod changes
+const resyncPeriod = 10 * time.Minute
+
+// NodeWatcher watches pods to find the nodes running pods that mount NFS exports,
+// so that storage side export policies can follow them
+type NodeWatcher struct {
+	factory  informers.SharedInformerFactory
+	informer cache.SharedIndexInformer
+	pods     corelisters.PodLister
+	detector *Detector
+
+	Logger logrus.FieldLogger
+}
+
+// NewNodeWatcher returns a NodeWatcher watching pods with client and resolving
+// their exports with detector
+func NewNodeWatcher(client kubernetes.Interface, detector *Detector) *NodeWatcher {
+	factory := informers.NewSharedInformerFactory(client, 0)
+	pods := factory.Core().V1().Pods()
+	return &NodeWatcher{
+		factory:  factory,
+		informer: pods.Informer(),
+		pods:     pods.Lister(),
+		detector: detector,
+		Logger:   logrus.StandardLogger(),
+	}
+}
+
+// Run calls sync once the pod cache is synced, then on every pod change and
+// every resyncPeriod until stopCh is closed. Failures of sync are logged and
+// retried on the next change or resync. It blocks until the pod cache is synced.
+func (w *NodeWatcher) Run(stopCh <-chan struct{}, name string, sync func(context.Context) error) error {
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	_, err := w.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { notify() },
+		UpdateFunc: func(interface{}, interface{}) { notify() },
+		DeleteFunc: func(interface{}) { notify() },
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch pods: %v", err)
+	}
+	if err := w.Start(stopCh); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(resyncPeriod)
+		defer ticker.Stop()
+		for {
+			if err := sync(context.Background()); err != nil {
+				w.Logger.Errorf("cannot sync %s: %v", name, err)
+			}
+			select {
+			case <-stopCh:
+				return
+			case <-changed:
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// Start starts watching pods and blocks until the pod cache is synced
+func (w *NodeWatcher) Start(stopCh <-chan struct{}) error {
+	w.factory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, w.informer.HasSynced) {
+		return fmt.Errorf("failed to sync pod cache")
+	}
+	return nil
+}
+
+// Nodes returns the sorted IPs of the nodes running pods that mount exports, by
+// the index match returns for the exports, exports it returns -1 for are skipped.
+// Pods that are not scheduled yet or terminated are ignored.
+func (w *NodeWatcher) Nodes(match func(*Export) int) (map[int][]string, error) {
+	pods, err := w.pods.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("Error listing pods: %s\n", err)
+	}
+
+	nodes := map[int]map[string]bool{}
+	for _, pod := range pods {
+		if pod.Status.HostIP == "" || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		for _, v := range pod.Spec.Volumes {
+			export, err := w.detector.Export(pod.Namespace, v)
+			if err != nil {
+				w.Logger.Debugf("cannot resolve volume %s of pod %s/%s: %v", v.Name, pod.Namespace, pod.Name, err)
+				continue
+			}
+			if export == nil {
+				continue
+			}
+			if i := match(export); i >= 0 {
+				if nodes[i] == nil {
+					nodes[i] = map[string]bool{}
+				}
+				nodes[i][pod.Status.HostIP] = true
+			}
+		}
+	}
+
+	ips := map[int][]string{}
+	for i, set := range nodes {
+		for ip := range set {
+			ips[i] = append(ips[i], ip)
+		}
+		sort.Strings(ips[i])
+	}
+	return ips, nil
+}
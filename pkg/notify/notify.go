@@ -0,0 +1,259 @@
+// Package notify posts summaries of the pods denied by the webhook to a Slack,
+// Microsoft Teams or generic webhook, so that platform and storage teams see
+// the attempts to access NFS storage with the wrong identity in near real time
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/metrics"
+)
+
+// Formats of the payloads posted to the webhook
+const (
+	// FormatSlack posts {"text": ...}, the payload of Slack and Mattermost
+	// incoming webhooks
+	FormatSlack = "slack"
+	// FormatTeams posts an Adaptive Card, the payload of the Microsoft Teams
+	// workflows triggered by a webhook request
+	FormatTeams = "teams"
+	// FormatJSON posts the text and the denials, for generic webhooks
+	FormatJSON = "json"
+)
+
+const (
+	// DefaultTemplate renders the line of a denial in the summaries
+	DefaultTemplate = "{{ .Namespace }}/{{ .Workload }} as {{ .Subject }}: {{ .Reason }}{{ if gt .Count 1 }} ({{ .Count }} times){{ end }}"
+	// DefaultInterval is the default minimum interval between two summaries
+	DefaultInterval = time.Minute
+	// DefaultMaxDenials is the default maximum number of denials listed in a summary
+	DefaultMaxDenials = 20
+)
+
+// maxPending bounds the distinct denials waiting for the next summary, the
+// ones beyond are only counted
+const maxPending = 1000
+
+// Denial is a denied pod, identical denials are merged in the summaries
+type Denial struct {
+	Namespace string `json:"namespace"`
+	// Subject is the user/serviceAccount the pod is validated for
+	Subject string `json:"subject"`
+	// Workload is the kind and name of the object denied or of the controller
+	// of the pod, e.g. ReplicaSet/web-5d9c7
+	Workload string `json:"workload"`
+	// Validator is the name of the denying validator, if any
+	Validator string `json:"validator,omitempty"`
+	Reason    string `json:"reason"`
+	// Count is the number of identical denials since the previous summary
+	Count int `json:"count"`
+	// Time is the time of the first of them
+	Time time.Time `json:"time"`
+}
+
+// key identifies identical denials
+type key struct {
+	namespace, subject, workload, reason string
+}
+
+// Notifier collects the denials and posts them to URL as a summary every
+// Interval at most, listing up to MaxDenials of them
+type Notifier struct {
+	URL        string
+	Format     string
+	Template   *template.Template
+	Interval   time.Duration
+	MaxDenials int
+	Client     *http.Client
+	Logger     logrus.FieldLogger
+
+	now     func() time.Time
+	mu      sync.Mutex
+	pending []*Denial
+	index   map[key]*Denial
+	dropped int
+}
+
+// New returns a Notifier posting to endpoint in format, the lines of the denials
+// being rendered by the text/template tmpl, DefaultTemplate when empty
+func New(endpoint, format, tmpl string) (*Notifier, error) {
+	switch format {
+	case "":
+		format = FormatSlack
+	case FormatSlack, FormatTeams, FormatJSON:
+	default:
+		return nil, fmt.Errorf("unknown notification format %q, expected slack, teams or json", format)
+	}
+	if tmpl == "" {
+		tmpl = DefaultTemplate
+	}
+	t, err := template.New("denial").Option("missingkey=zero").Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse notification template: %v", err)
+	}
+	return &Notifier{
+		URL:        endpoint,
+		Format:     format,
+		Template:   t,
+		Interval:   DefaultInterval,
+		MaxDenials: DefaultMaxDenials,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		Logger:     logrus.StandardLogger(),
+		now:        time.Now,
+		index:      make(map[key]*Denial),
+	}, nil
+}
+
+// Denied queues a denial for the next summary, it never blocks on the webhook
+func (n *Notifier) Denied(d Denial) {
+	d.Reason = strings.Join(strings.Fields(d.Reason), " ")
+	k := key{d.Namespace, d.Subject, d.Workload, d.Reason}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if pending, ok := n.index[k]; ok {
+		pending.Count++
+		return
+	}
+	if len(n.pending) >= maxPending {
+		n.dropped++
+		return
+	}
+	d.Count = 1
+	d.Time = n.now()
+	n.pending = append(n.pending, &d)
+	n.index[k] = &d
+}
+
+// Run posts the pending denials every Interval until ctx is done
+func (n *Notifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(n.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := n.Flush(ctx); err != nil {
+				n.Logger.Warnf("cannot post denial notification: %v", err)
+			}
+		}
+	}
+}
+
+// Flush posts the pending denials, if any. They are dropped when the webhook
+// fails, so that a broken webhook doesn't grow the summaries forever.
+func (n *Notifier) Flush(ctx context.Context) error {
+	n.mu.Lock()
+	denials, dropped := n.pending, n.dropped
+	n.pending, n.index, n.dropped = nil, make(map[key]*Denial), 0
+	n.mu.Unlock()
+	if len(denials) == 0 {
+		return nil
+	}
+
+	body, err := n.payload(denials, dropped)
+	if err != nil {
+		metrics.ObserveNotification(false)
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		metrics.ObserveNotification(false)
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		metrics.ObserveNotification(false)
+		// the URL of the webhook is a credential, keep it out of the logs
+		return fmt.Errorf("cannot reach notification webhook: %v", errorWithoutURL(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		metrics.ObserveNotification(false)
+		return fmt.Errorf("notification webhook answered %s", resp.Status)
+	}
+	metrics.ObserveNotification(true)
+	return nil
+}
+
+// text renders the summary of denials, dropped more denials being only counted
+func (n *Notifier) text(denials []*Denial, dropped int) (string, error) {
+	total := dropped
+	for _, d := range denials {
+		total += d.Count
+	}
+	var text strings.Builder
+	if total == 1 {
+		text.WriteString("1 pod denied by nfs-pod-access-control:\n")
+	} else {
+		fmt.Fprintf(&text, "%d pods denied by nfs-pod-access-control:\n", total)
+	}
+	listed := denials
+	if len(listed) > n.MaxDenials {
+		listed = listed[:n.MaxDenials]
+	}
+	for _, d := range listed {
+		text.WriteString("- ")
+		if err := n.Template.Execute(&text, d); err != nil {
+			return "", fmt.Errorf("cannot render notification template: %v", err)
+		}
+		text.WriteString("\n")
+	}
+	if more := len(denials) - len(listed) + dropped; more > 0 {
+		fmt.Fprintf(&text, "and %d more\n", more)
+	}
+	return text.String(), nil
+}
+
+// payload returns the body posted for denials in the format of the webhook
+func (n *Notifier) payload(denials []*Denial, dropped int) ([]byte, error) {
+	text, err := n.text(denials, dropped)
+	if err != nil {
+		return nil, err
+	}
+	switch n.Format {
+	case FormatTeams:
+		return json.Marshal(map[string]interface{}{
+			"type": "message",
+			"attachments": []map[string]interface{}{{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]interface{}{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"body":    []map[string]interface{}{{"type": "TextBlock", "text": text, "wrap": true}},
+				},
+			}},
+		})
+	case FormatJSON:
+		return json.Marshal(struct {
+			Text    string    `json:"text"`
+			Denials []*Denial `json:"denials"`
+			Dropped int       `json:"dropped,omitempty"`
+		}{text, denials, dropped})
+	default:
+		return json.Marshal(map[string]string{"text": text})
+	}
+}
+
+// errorWithoutURL returns the error of a request without the URL it was sent to
+func errorWithoutURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
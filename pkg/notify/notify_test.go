@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhook records the bodies posted to it
+func webhook(t *testing.T, status int) (*httptest.Server, *[]string) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, &bodies
+}
+
+func TestNotifier(t *testing.T) {
+	server, bodies := webhook(t, http.StatusOK)
+	n, err := New(server.URL, FormatSlack, "")
+	require.NoError(t, err)
+
+	// nothing is posted without denials
+	assert.NoError(t, n.Flush(context.TODO()))
+	assert.Empty(t, *bodies)
+
+	denial := Denial{Namespace: "team-a", Subject: "alice", Workload: "ReplicaSet/web-5d9c7", Reason: "Invalid uid in pod,\n expected: 1001, found: 0"}
+	n.Denied(denial)
+	n.Denied(denial)
+	n.Denied(Denial{Namespace: "team-b", Subject: "bob", Workload: "Pod/debug", Reason: "no mapping"})
+	assert.NoError(t, n.Flush(context.TODO()))
+	require.Len(t, *bodies, 1)
+	var payload map[string]string
+	require.NoError(t, json.Unmarshal([]byte((*bodies)[0]), &payload))
+	assert.Equal(t, "3 pods denied by nfs-pod-access-control:\n"+
+		"- team-a/ReplicaSet/web-5d9c7 as alice: Invalid uid in pod, expected: 1001, found: 0 (2 times)\n"+
+		"- team-b/Pod/debug as bob: no mapping\n", payload["text"])
+
+	// the denials are posted once
+	assert.NoError(t, n.Flush(context.TODO()))
+	assert.Len(t, *bodies, 1)
+}
+
+func TestNotifierMaxDenials(t *testing.T) {
+	server, bodies := webhook(t, http.StatusOK)
+	n, err := New(server.URL, FormatJSON, "{{ .Workload }}")
+	require.NoError(t, err)
+	n.MaxDenials = 2
+
+	for i := 0; i < 3; i++ {
+		n.Denied(Denial{Namespace: "team-a", Workload: fmt.Sprintf("Pod/p%d", i)})
+	}
+	assert.NoError(t, n.Flush(context.TODO()))
+	require.Len(t, *bodies, 1)
+	var payload struct {
+		Text    string   `json:"text"`
+		Denials []Denial `json:"denials"`
+	}
+	require.NoError(t, json.Unmarshal([]byte((*bodies)[0]), &payload))
+	assert.Equal(t, "3 pods denied by nfs-pod-access-control:\n- Pod/p0\n- Pod/p1\nand 1 more\n", payload.Text)
+	assert.Len(t, payload.Denials, 3)
+}
+
+func TestNotifierTeams(t *testing.T) {
+	server, bodies := webhook(t, http.StatusOK)
+	n, err := New(server.URL, FormatTeams, "")
+	require.NoError(t, err)
+
+	n.Denied(Denial{Namespace: "team-a", Subject: "alice", Workload: "Pod/web", Reason: "denied"})
+	assert.NoError(t, n.Flush(context.TODO()))
+	require.Len(t, *bodies, 1)
+	assert.Contains(t, (*bodies)[0], `"contentType":"application/vnd.microsoft.card.adaptive"`)
+	assert.Contains(t, (*bodies)[0], "team-a/Pod/web as alice: denied")
+}
+
+func TestNotifierErrors(t *testing.T) {
+	_, err := New("http://localhost", "irc", "")
+	assert.Error(t, err)
+	_, err = New("http://localhost", "", "{{ .Unclosed")
+	assert.Error(t, err)
+
+	server, bodies := webhook(t, http.StatusForbidden)
+	n, err := New(server.URL+"/T0/B0/secret", "", "")
+	require.NoError(t, err)
+	n.Denied(Denial{Namespace: "team-a"})
+	assert.EqualError(t, n.Flush(context.TODO()), "notification webhook answered 403 Forbidden")
+	assert.Len(t, *bodies, 1)
+
+	// the URL of the webhook isn't part of the errors
+	server.Close()
+	n.Denied(Denial{Namespace: "team-a"})
+	err = n.Flush(context.TODO())
+	if assert.Error(t, err) {
+		assert.False(t, strings.Contains(err.Error(), "secret"), err.Error())
+	}
+}
@@ -0,0 +1,170 @@
+package ontap
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client manages export policies with the ONTAP REST API, authenticating with
+// HTTP basic auth
+type Client struct {
+	baseURL string
+	svm     string
+	client  *http.Client
+
+	// UsernameFile and PasswordFile hold the credentials of the ONTAP user, they are
+	// read on every request so that rotated credentials are picked up
+	UsernameFile string
+	PasswordFile string
+
+	mu sync.Mutex
+	// ids are the IDs of the export policies, by name
+	ids map[string]int64
+}
+
+// Client implements the PolicyManager interface
+var _ PolicyManager = (*Client)(nil)
+
+// NewClient returns a Client managing the export policies of svm on the cluster
+// at baseURL
+func NewClient(baseURL, svm string, tlsConfig *tls.Config) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		svm:     svm,
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		},
+		ids: map[string]int64{},
+	}
+}
+
+// TLSConfig returns the TLS config trusting the certificates of caFile, the
+// system pool when empty
+func TLSConfig(caFile string, insecure bool) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: insecure}
+	if caFile == "" {
+		return config, nil
+	}
+	ca, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read ONTAP_CA_FILE: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificate found in ONTAP_CA_FILE %s", caFile)
+	}
+	config.RootCAs = pool
+	return config, nil
+}
+
+// SetClients replaces the rules of the export policy of e, the policy must exist
+func (c *Client) SetClients(ctx context.Context, e Export, clients []string) error {
+	id, err := c.policyID(ctx, e.Policy)
+	if err != nil {
+		return err
+	}
+	body := map[string]interface{}{"rules": e.Rules(clients)}
+	if err := c.do(ctx, http.MethodPatch, fmt.Sprintf("/api/protocols/nfs/export-policies/%d", id), body, nil); err != nil {
+		return fmt.Errorf("cannot update export policy %s: %v", e.Policy, err)
+	}
+	return nil
+}
+
+// policyID returns the ID of the export policy named name, IDs are cached as
+// they don't change for the lifetime of a policy
+func (c *Client) policyID(ctx context.Context, name string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if id, ok := c.ids[name]; ok {
+		return id, nil
+	}
+
+	query := url.Values{"name": {name}, "svm.name": {c.svm}, "fields": {"id"}}
+	var res struct {
+		Records []struct {
+			ID int64 `json:"id"`
+		} `json:"records"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/protocols/nfs/export-policies?"+query.Encode(), nil, &res); err != nil {
+		return 0, fmt.Errorf("cannot get export policy %s: %v", name, err)
+	}
+	if len(res.Records) == 0 {
+		return 0, fmt.Errorf("export policy %s not found on SVM %s", name, c.svm)
+	}
+	c.ids[name] = res.Records[0].ID
+	return res.Records[0].ID, nil
+}
+
+// do sends a request to the ONTAP REST API, decoding the answer into out if set
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if err := c.authenticate(req); err != nil {
+		return err
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		var e struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&e) == nil && e.Error.Message != "" {
+			return fmt.Errorf("ONTAP answered %s: %s", res.Status, e.Error.Message)
+		}
+		return fmt.Errorf("ONTAP answered %s", res.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(out)
+}
+
+// authenticate sets the basic auth credentials of req
+func (c *Client) authenticate(req *http.Request) error {
+	if c.UsernameFile == "" {
+		return nil
+	}
+	username, err := os.ReadFile(c.UsernameFile)
+	if err != nil {
+		return fmt.Errorf("cannot read ONTAP_USERNAME_FILE: %v", err)
+	}
+	password, err := os.ReadFile(c.PasswordFile)
+	if err != nil {
+		return fmt.Errorf("cannot read ONTAP_PASSWORD_FILE: %v", err)
+	}
+	req.SetBasicAuth(strings.TrimSpace(string(username)), strings.TrimSpace(string(password)))
+	return nil
+}
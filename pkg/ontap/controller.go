@@ -0,0 +1,87 @@
+package ontap
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/nfs"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Controller grants the nodes running pods that mount a managed export access to
+// it through its export policy, and revokes it once they don't run any
+type Controller struct {
+	nodes   *nfs.NodeWatcher
+	manager PolicyManager
+	config  *Config
+	// clients are the clients of every export policy the last time it was updated, by name
+	clients map[string][]string
+
+	Logger logrus.FieldLogger
+}
+
+// NewController returns a Controller watching pods with client, resolving their
+// exports with detector and updating the export policies of config with manager
+func NewController(client kubernetes.Interface, detector *nfs.Detector, manager PolicyManager, config *Config) *Controller {
+	return &Controller{
+		nodes:   nfs.NewNodeWatcher(client, detector),
+		manager: manager,
+		config:  config,
+		clients: map[string][]string{},
+		Logger:  logrus.StandardLogger(),
+	}
+}
+
+// Run updates the export policies on every pod change until stopCh is closed, it
+// blocks until the pod cache is synced
+func (c *Controller) Run(stopCh <-chan struct{}) error {
+	return c.nodes.Run(stopCh, "ONTAP export policies", c.Sync)
+}
+
+// Sync updates the export policies whose clients changed since their last update
+func (c *Controller) Sync(ctx context.Context) error {
+	clients, err := c.nodes.Nodes(c.match)
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	for i, e := range c.config.Exports {
+		if last, updated := c.clients[e.Policy]; updated && reflect.DeepEqual(last, clients[i]) {
+			continue
+		}
+		if err := c.manager.SetClients(ctx, e, clients[i]); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		c.clients[e.Policy] = clients[i]
+		c.Logger.Infof("Granted %d nodes access to ONTAP export policy %s (%s)", len(clients[i]), e.Policy, e.Path)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// match returns the index of the managed export serving export, -1 if there is
+// none. Nested junction paths match the longest managed path.
+func (c *Controller) match(export *nfs.Export) int {
+	if !strings.EqualFold(export.Server, c.config.Server) {
+		return -1
+	}
+	exportPath := path.Clean(export.Path)
+	match := -1
+	for i, e := range c.config.Exports {
+		if exportPath != e.Path && !strings.HasPrefix(exportPath, e.Path+"/") {
+			continue
+		}
+		if match < 0 || len(e.Path) > len(c.config.Exports[match].Path) {
+			match = i
+		}
+	}
+	return match
+}
@@ -0,0 +1,126 @@
+// Package ontap keeps the rules of NetApp ONTAP export policies in sync with the
+// nodes running admitted pods that mount their volumes, through the ONTAP REST API,
+// so that the storage side can't grant access the webhook wouldn't
+package ontap
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Export is an ONTAP volume or qtree whose export policy is managed by the webhook
+type Export struct {
+	// Path is the junction path of the volume or qtree, as mounted by pods
+	Path string `json:"path"`
+	// Policy is the name of the export policy of the volume, the webhook owns its
+	// rules and replaces them on every change
+	Policy string `json:"policy"`
+	// ReadOnly exports only grant read-only access to clients
+	ReadOnly bool `json:"readOnly,omitempty"`
+	// Security are the security flavors accepted by the rules, ["sys"] when empty
+	Security []string `json:"security,omitempty"`
+	// AnonymousUser is the user ID root and unknown users are mapped to, ONTAP's
+	// default when empty
+	AnonymousUser string `json:"anonymousUser,omitempty"`
+	// Protocols are the protocols of the rules, ["nfs"] when empty
+	Protocols []string `json:"protocols,omitempty"`
+}
+
+// Config is the format of the ONTAP integration file, e.g.
+//
+//	url: https://ontap.example.com
+//	svm: svm1
+//	server: nfs.example.com
+//	exports:
+//	- path: /teamA
+//	  policy: k8s-teamA
+type Config struct {
+	// URL is the base URL of the cluster management interface
+	URL string `json:"url"`
+	// SVM is the name of the storage VM owning the export policies
+	SVM string `json:"svm"`
+	// Server is the NFS server name or data LIF address pods mount the exports from
+	Server  string   `json:"server"`
+	Exports []Export `json:"exports"`
+}
+
+// LoadConfig reads a Config from a YAML or JSON file
+func LoadConfig(name string) (*Config, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading ONTAP config file: %s\n", err)
+	}
+	var c Config
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("Error parsing ONTAP config: %s\n", err)
+	}
+	if c.URL == "" || c.SVM == "" || c.Server == "" {
+		return nil, fmt.Errorf("invalid ONTAP config, url, svm and server are required")
+	}
+	for i, e := range c.Exports {
+		if e.Policy == "" || !path.IsAbs(e.Path) {
+			return nil, fmt.Errorf("invalid ONTAP export %d, expected a policy and an absolute path", i)
+		}
+		c.Exports[i].Path = path.Clean(e.Path)
+	}
+	return &c, nil
+}
+
+// Rule is an export policy rule, as sent to the ONTAP REST API
+type Rule struct {
+	Clients       []RuleClient `json:"clients"`
+	Protocols     []string     `json:"protocols"`
+	RORule        []string     `json:"ro_rule"`
+	RWRule        []string     `json:"rw_rule"`
+	Superuser     []string     `json:"superuser"`
+	AnonymousUser string       `json:"anonymous_user,omitempty"`
+}
+
+// RuleClient is a client match of a Rule, an IP address here
+type RuleClient struct {
+	Match string `json:"match"`
+}
+
+// Rules returns the rules of the export policy of e granting access to clients,
+// none when there is no client. Superusers are squashed so that pods can only act
+// as the UIDs they were admitted with.
+func (e Export) Rules(clients []string) []Rule {
+	if len(clients) == 0 {
+		return []Rule{}
+	}
+	security := e.Security
+	if len(security) == 0 {
+		security = []string{"sys"}
+	}
+	protocols := e.Protocols
+	if len(protocols) == 0 {
+		protocols = []string{"nfs"}
+	}
+	rw := security
+	if e.ReadOnly {
+		rw = []string{"never"}
+	}
+
+	rule := Rule{
+		Protocols:     protocols,
+		RORule:        security,
+		RWRule:        rw,
+		Superuser:     []string{"none"},
+		AnonymousUser: e.AnonymousUser,
+	}
+	for _, client := range clients {
+		rule.Clients = append(rule.Clients, RuleClient{Match: client})
+	}
+	return []Rule{rule}
+}
+
+// PolicyManager replaces the rules of the export policies of exports
+type PolicyManager interface {
+	// SetClients replaces the rules of the export policy of e with rules granting
+	// access to clients only
+	SetClients(ctx context.Context, e Export, clients []string) error
+}
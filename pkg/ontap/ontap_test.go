@@ -0,0 +1,141 @@
+package ontap
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/nfs"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// recordingManager records the clients of every updated export policy
+type recordingManager map[string][]string
+
+func (m recordingManager) SetClients(_ context.Context, e Export, clients []string) error {
+	m[e.Policy] = clients
+	return nil
+}
+
+func TestLoadConfig(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "ontap.yaml")
+	err := os.WriteFile(name, []byte("url: https://ontap\nsvm: svm1\nserver: nfs.example.com\nexports:\n- path: /teamA/\n  policy: k8s-teamA\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadConfig(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []Export{{Path: "/teamA", Policy: "k8s-teamA"}}, c.Exports)
+
+	if err := os.WriteFile(name, []byte("url: https://ontap\nsvm: svm1\nserver: nfs.example.com\nexports:\n- path: /teamA\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadConfig(name)
+	assert.Error(t, err)
+}
+
+func TestRules(t *testing.T) {
+	rules := Export{Path: "/archive", Policy: "archive", ReadOnly: true, AnonymousUser: "65534"}.Rules([]string{"10.0.0.1"})
+	assert.Equal(t, []Rule{{
+		Clients:       []RuleClient{{Match: "10.0.0.1"}},
+		Protocols:     []string{"nfs"},
+		RORule:        []string{"sys"},
+		RWRule:        []string{"never"},
+		Superuser:     []string{"none"},
+		AnonymousUser: "65534",
+	}}, rules)
+
+	assert.Empty(t, Export{Path: "/teamA", Policy: "teamA"}.Rules(nil))
+}
+
+func TestClientSetClients(t *testing.T) {
+	var patched map[string][]Rule
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, _ := r.BasicAuth(); user != "admin" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/protocols/nfs/export-policies":
+			if r.URL.Query().Get("name") != "k8s-teamA" || r.URL.Query().Get("svm.name") != "svm1" {
+				w.Write([]byte(`{"records": [], "num_records": 0}`))
+				return
+			}
+			w.Write([]byte(`{"records": [{"id": 42, "name": "k8s-teamA"}], "num_records": 1}`))
+		case r.Method == http.MethodPatch && r.URL.Path == "/api/protocols/nfs/export-policies/42":
+			if err := json.NewDecoder(r.Body).Decode(&patched); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"message": "entry doesn't exist", "code": "4"}}`))
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	client := NewClient(server.URL, "svm1", nil)
+	client.UsernameFile, client.PasswordFile = filepath.Join(dir, "username"), filepath.Join(dir, "password")
+	os.WriteFile(client.UsernameFile, []byte("admin\n"), 0o600)
+	os.WriteFile(client.PasswordFile, []byte("secret\n"), 0o600)
+
+	err := client.SetClients(context.TODO(), Export{Path: "/teamA", Policy: "k8s-teamA"}, []string{"10.0.0.1", "10.0.0.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, patched["rules"], 1) {
+		assert.Equal(t, []RuleClient{{Match: "10.0.0.1"}, {Match: "10.0.0.2"}}, patched["rules"][0].Clients)
+	}
+
+	err = client.SetClients(context.TODO(), Export{Path: "/teamB", Policy: "k8s-teamB"}, nil)
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestSync(t *testing.T) {
+	pod := func(name, hostIP, path string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team-a"},
+			Spec: corev1.PodSpec{Volumes: []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{
+				NFS: &corev1.NFSVolumeSource{Server: "nfs.example.com", Path: path},
+			}}}},
+			Status: corev1.PodStatus{HostIP: hostIP, Phase: corev1.PodRunning},
+		}
+	}
+	client := fake.NewSimpleClientset(
+		pod("a", "10.0.0.2", "/teamA"),
+		pod("b", "10.0.0.1", "/teamA/projects/x"),
+		pod("c", "10.0.0.3", "/teamA/projects"),
+	)
+	manager := recordingManager{}
+	config := &Config{Server: "nfs.example.com", Exports: []Export{
+		{Path: "/teamA", Policy: "teamA"},
+		{Path: "/teamA/projects", Policy: "projects"},
+		{Path: "/archive", Policy: "archive"},
+	}}
+	c := NewController(client, nfs.NewDetector(client), manager, config)
+	c.Logger = logrus.New()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	if err := c.nodes.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Sync(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"10.0.0.2"}, manager["teamA"])
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.3"}, manager["projects"])
+	assert.Contains(t, manager, "archive")
+	assert.Empty(t, manager["archive"])
+}
@@ -0,0 +1,71 @@
+package opa
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/sdk"
+)
+
+// EmbeddedEngine evaluates decisions with the OPA SDK, configured like an OPA
+// server: bundles (from a bundle server or a file:// directory or archive),
+// decision logs and status reporting are set in the OPA config file
+type EmbeddedEngine struct {
+	opa   *sdk.OPA
+	path  string
+	ready chan struct{}
+}
+
+// EmbeddedEngine implements the Engine interface
+var _ Engine = (*EmbeddedEngine)(nil)
+
+// NewEmbeddedEngine returns an EmbeddedEngine configured by the OPA config file
+// named configFile, evaluating the decision at path. Bundles are loaded in the
+// background, the engine isn't ready until they are activated.
+func NewEmbeddedEngine(ctx context.Context, configFile, path string) (*EmbeddedEngine, error) {
+	config, err := os.Open(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading OPA config file: %s\n", err)
+	}
+	defer config.Close()
+
+	e := &EmbeddedEngine{path: strings.Trim(path, "/"), ready: make(chan struct{})}
+	e.opa, err = sdk.New(ctx, sdk.Options{ID: "nfs-pod-access-control", Config: config, Ready: e.ready})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start OPA: %v", err)
+	}
+	return e, nil
+}
+
+// Ready returns an error until the bundles are activated
+func (e *EmbeddedEngine) Ready() error {
+	select {
+	case <-e.ready:
+		return nil
+	default:
+		return fmt.Errorf("OPA bundles not activated")
+	}
+}
+
+// Decide evaluates the decision for input, decisions are logged as configured
+// in the decision_logs section of the OPA config
+func (e *EmbeddedEngine) Decide(ctx context.Context, input Input) (Decision, error) {
+	if err := e.Ready(); err != nil {
+		return Decision{}, err
+	}
+	result, err := e.opa.Decision(ctx, sdk.DecisionOptions{Path: e.path, Input: input})
+	if sdk.IsUndefinedErr(err) {
+		return parseResult("", nil)
+	}
+	if err != nil {
+		return Decision{}, fmt.Errorf("OPA decision failed: %v", err)
+	}
+	return parseResult(result.ID, result.Result)
+}
+
+// Stop stops the bundle downloads and flushes the decision logs
+func (e *EmbeddedEngine) Stop(ctx context.Context) {
+	e.opa.Stop(ctx)
+}
@@ -0,0 +1,87 @@
+// Package opa forwards admission requests, along with the resolved identity of
+// the user or serviceAccount creating the pod, to Open Policy Agent, either
+// embedded through the OPA SDK or running as a remote server
+package opa
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultDecisionPath is the path of the decision evaluated by default, i.e. the
+// admission rule of the nfs package
+const DefaultDecisionPath = "nfs/admission"
+
+// Input is the input document of decisions
+type Input struct {
+	// Request is the admission request, whose object is a workload for pod templates
+	Request *admissionv1.AdmissionRequest `json:"request"`
+	// Pod is the pod being validated, built from the template of workloads
+	Pod      *corev1.Pod `json:"pod"`
+	Identity Identity    `json:"identity"`
+}
+
+// Identity is the identity resolved for the user or serviceAccount creating the pod
+type Identity struct {
+	Subject string   `json:"subject"`
+	Groups  []string `json:"groups,omitempty"`
+	// Found is false when the subject isn't mapped
+	Found bool    `json:"found"`
+	UID   *int64  `json:"uid,omitempty"`
+	UIDs  string  `json:"uids,omitempty"`
+	GIDs  []int64 `json:"gids,omitempty"`
+}
+
+// NewIdentity returns the Identity of subject, id is nil when it isn't mapped
+func NewIdentity(subject string, groups []string, id *resolver.IdentitySpec) Identity {
+	identity := Identity{Subject: subject, Groups: groups, Found: id != nil}
+	if id != nil {
+		identity.UID = id.UID
+		identity.UIDs = id.AllowedUIDs().String()
+		identity.GIDs = id.GIDs
+	}
+	return identity
+}
+
+// Decision is the result of a decision, the policy returns either a bool or an
+// object like {"allowed": true, "exempt": false, "reason": "..."}
+type Decision struct {
+	// ID identifies the decision in the OPA decision logs, if any
+	ID      string
+	Allowed bool
+	// Exempt admits the pod without running the other validators, so that
+	// exceptions can be written as policies
+	Exempt bool
+	Reason string
+}
+
+// Engine evaluates decisions
+type Engine interface {
+	Decide(ctx context.Context, input Input) (Decision, error)
+}
+
+// parseResult parses the result of a decision
+func parseResult(id string, result interface{}) (Decision, error) {
+	d := Decision{ID: id}
+	switch r := result.(type) {
+	case bool:
+		d.Allowed = r
+	case map[string]interface{}:
+		allowed, ok := r["allowed"].(bool)
+		if !ok {
+			return d, fmt.Errorf("invalid OPA decision, allowed is not a bool: %v", r["allowed"])
+		}
+		d.Allowed = allowed
+		d.Exempt, _ = r["exempt"].(bool)
+		d.Reason, _ = r["reason"].(string)
+	case nil:
+		return d, fmt.Errorf("OPA decision is undefined, is the policy loaded?")
+	default:
+		return d, fmt.Errorf("invalid OPA decision %v, expected a bool or an object", result)
+	}
+	return d, nil
+}
@@ -0,0 +1,122 @@
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const policy = `package nfs
+
+default admission := {"allowed": false, "reason": "unmapped subject"}
+
+admission := {"allowed": true, "exempt": true, "reason": "backup exception"} if {
+	input.identity.subject == "backup"
+}
+
+admission := {"allowed": true} if {
+	input.identity.found
+	not input.pod.spec.hostNetwork
+}
+`
+
+func TestEmbeddedEngine(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "bundle"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bundle", "policy.rego"), []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(dir, "opa.yaml")
+	err := os.WriteFile(config, []byte("bundles:\n  nfs:\n    resource: file://"+filepath.Join(dir, "bundle")+"\ndecision_logs:\n  console: false\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := NewEmbeddedEngine(context.TODO(), config, DefaultDecisionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Stop(context.TODO())
+	assert.Eventually(t, func() bool { return e.Ready() == nil }, 10*time.Second, 10*time.Millisecond)
+
+	uid := int64(1001)
+	mapped := &resolver.IdentitySpec{UID: &uid}
+	tests := []struct {
+		name     string
+		identity Identity
+		pod      *corev1.Pod
+		decision Decision
+	}{
+		{name: "mapped", identity: NewIdentity("user1", nil, mapped), pod: &corev1.Pod{}, decision: Decision{Allowed: true}},
+		{name: "host network", identity: NewIdentity("user1", nil, mapped), pod: &corev1.Pod{Spec: corev1.PodSpec{HostNetwork: true}}, decision: Decision{Reason: "unmapped subject"}},
+		{name: "unmapped", identity: NewIdentity("user2", nil, nil), pod: &corev1.Pod{}, decision: Decision{Reason: "unmapped subject"}},
+		{name: "exception", identity: NewIdentity("backup", nil, nil), pod: &corev1.Pod{}, decision: Decision{Allowed: true, Exempt: true, Reason: "backup exception"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := e.Decide(context.TODO(), Input{Request: &admissionv1.AdmissionRequest{}, Pod: tt.pod, Identity: tt.identity})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.NotEmpty(t, d.ID)
+			d.ID = ""
+			assert.Equal(t, tt.decision, d)
+		})
+	}
+}
+
+func TestRemoteEngine(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/data/nfs/admission" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var body struct {
+			Input Input `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if body.Input.Identity.Subject == "undefined" {
+			w.Write([]byte(`{"decision_id": "2"}`))
+			return
+		}
+		w.Write([]byte(`{"decision_id": "1", "result": ` + map[bool]string{true: "true", false: "false"}[body.Input.Identity.UIDs == "1000-1999"] + `}`))
+	}))
+	defer server.Close()
+
+	e := NewRemoteEngine(server.URL+"/", "/nfs/admission", time.Second)
+	ranges := &resolver.IdentitySpec{UIDs: mapping.IDRanges{{Min: 1000, Max: 1999}}}
+
+	d, err := e.Decide(context.TODO(), Input{Identity: NewIdentity("user1", nil, ranges)})
+	assert.NoError(t, err)
+	assert.Equal(t, Decision{ID: "1", Allowed: true}, d)
+
+	d, err = e.Decide(context.TODO(), Input{Identity: NewIdentity("user2", nil, nil)})
+	assert.NoError(t, err)
+	assert.False(t, d.Allowed)
+
+	_, err = e.Decide(context.TODO(), Input{Identity: Identity{Subject: "undefined"}})
+	assert.ErrorContains(t, err, "undefined")
+}
+
+func TestParseResult(t *testing.T) {
+	_, err := parseResult("", map[string]interface{}{"reason": "no allowed"})
+	assert.Error(t, err)
+	_, err = parseResult("", "yes")
+	assert.Error(t, err)
+}
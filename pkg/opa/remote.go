@@ -0,0 +1,62 @@
+package opa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RemoteEngine evaluates decisions with the Data API of an OPA server, which
+// loads the bundles and logs the decisions itself
+type RemoteEngine struct {
+	url    string
+	client *http.Client
+}
+
+// RemoteEngine implements the Engine interface
+var _ Engine = (*RemoteEngine)(nil)
+
+// NewRemoteEngine returns a RemoteEngine evaluating the decision at path on the
+// OPA server at baseURL, giving up on requests after timeout
+func NewRemoteEngine(baseURL, path string, timeout time.Duration) *RemoteEngine {
+	return &RemoteEngine{
+		url:    strings.TrimSuffix(baseURL, "/") + "/v1/data/" + strings.Trim(path, "/"),
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Decide evaluates the decision for input with POST /v1/data/<path>
+func (e *RemoteEngine) Decide(ctx context.Context, input Input) (Decision, error) {
+	body, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return Decision{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return Decision{}, fmt.Errorf("OPA request failed: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return Decision{}, fmt.Errorf("OPA answered %s", res.Status)
+	}
+
+	var out struct {
+		DecisionID string      `json:"decision_id"`
+		Result     interface{} `json:"result"`
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&out); err != nil {
+		return Decision{}, fmt.Errorf("cannot decode OPA decision: %v", err)
+	}
+	return parseResult(out.DecisionID, out.Result)
+}
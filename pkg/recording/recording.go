@@ -0,0 +1,239 @@
+// Package recording writes the admission requests of pods and the responses of
+// the webhook to daily JSON lines files, sanitized of the values that may hold
+// credentials, so that they can be replayed against new policies or mappings
+// with `kubectl nfs-access replay`
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+// DefaultMaxFiles is the default number of daily files kept
+const DefaultMaxFiles = 7
+
+// redactedValue replaces the values of redacted fields
+const redactedValue = "[REDACTED]"
+
+// lastAppliedAnnotation holds a copy of the whole object applied by kubectl,
+// including the values redacted from the object itself
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// filePattern matches the names of the daily files
+const filePattern = "admissions-*.jsonl"
+
+// Entry is a recorded admission request and the response of the webhook
+type Entry struct {
+	Time           time.Time                      `json:"time"`
+	Webhook        string                         `json:"webhook"`
+	MappingVersion string                         `json:"mappingVersion,omitempty"`
+	Request        *admissionv1.AdmissionRequest  `json:"request"`
+	Response       *admissionv1.AdmissionResponse `json:"response"`
+}
+
+// Recorder appends the entries to the admissions-<date>.jsonl file of the day
+// in Dir, removing the oldest files beyond MaxFiles
+type Recorder struct {
+	Dir      string
+	MaxFiles int
+	Logger   logrus.FieldLogger
+
+	now  func() time.Time
+	mu   sync.Mutex
+	file *os.File
+	name string
+}
+
+// NewRecorder returns a Recorder writing to dir, created if missing
+func NewRecorder(dir string, maxFiles int) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	if maxFiles <= 0 {
+		maxFiles = DefaultMaxFiles
+	}
+	return &Recorder{Dir: dir, MaxFiles: maxFiles, Logger: logrus.StandardLogger(), now: time.Now}, nil
+}
+
+// Record sanitizes and appends the request and response of webhook, evaluated
+// with the mappings of mappingVersion. Errors are logged, they never fail the
+// admission of the pod.
+func (r *Recorder) Record(webhook, mappingVersion string, request *admissionv1.AdmissionRequest, response *admissionv1.AdmissionResponse) {
+	entry := Entry{
+		Time:           r.now().UTC(),
+		Webhook:        webhook,
+		MappingVersion: mappingVersion,
+		Request:        Sanitize(request),
+		Response:       response,
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		r.Logger.Warnf("cannot record admission request: %v", err)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.open(entry.Time); err != nil {
+		r.Logger.Warnf("cannot record admission request: %v", err)
+		return
+	}
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		r.Logger.Warnf("cannot record admission request: %v", err)
+	}
+}
+
+// Close closes the file of the day
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file, r.name = nil, ""
+	return err
+}
+
+// open opens the file of the day of t, switching from the file of the previous
+// day and removing the oldest ones
+func (r *Recorder) open(t time.Time) error {
+	name := filepath.Join(r.Dir, "admissions-"+t.Format("2006-01-02")+".jsonl")
+	if r.file != nil && r.name == name {
+		return nil
+	}
+	if r.file != nil {
+		r.file.Close()
+		r.file, r.name = nil, ""
+	}
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	r.file, r.name = f, name
+	r.prune()
+	return nil
+}
+
+// prune removes the oldest files beyond MaxFiles
+func (r *Recorder) prune() {
+	files, err := Files(r.Dir)
+	if err != nil {
+		r.Logger.Warnf("cannot list recordings: %v", err)
+		return
+	}
+	for len(files) > r.MaxFiles {
+		if err := os.Remove(files[0]); err != nil && !errors.Is(err, os.ErrNotExist) {
+			r.Logger.Warnf("cannot remove recording %s: %v", files[0], err)
+		}
+		files = files[1:]
+	}
+}
+
+// Files returns the recording files of dir, oldest first
+func Files(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, filePattern))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Read reads the entries of a recording file
+func Read(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if entry.Request == nil {
+			return nil, fmt.Errorf("line %d: no request", line)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// Sanitize returns a copy of the admission request with the values of the
+// UserInfo extra fields and of the env vars of the containers redacted, and the
+// last applied configuration and managed fields of the objects removed. The
+// objects that cannot be parsed are dropped.
+func Sanitize(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionRequest {
+	sanitized := *req
+	if len(req.UserInfo.Extra) > 0 {
+		sanitized.UserInfo.Extra = make(map[string]authenticationv1.ExtraValue, len(req.UserInfo.Extra))
+		for key := range req.UserInfo.Extra {
+			sanitized.UserInfo.Extra[key] = authenticationv1.ExtraValue{redactedValue}
+		}
+	}
+	sanitized.Object.Raw = sanitizeObject(req.Object.Raw)
+	sanitized.Object.Object = nil
+	sanitized.OldObject.Raw = sanitizeObject(req.OldObject.Raw)
+	sanitized.OldObject.Object = nil
+	return &sanitized
+}
+
+// sanitizeObject sanitizes a JSON object, nil when it cannot be parsed
+func sanitizeObject(raw []byte) []byte {
+	if len(raw) == 0 {
+		return nil
+	}
+	var obj interface{}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil
+	}
+	sanitizeValue(obj)
+	sanitized, err := json.Marshal(obj)
+	if err != nil {
+		return nil
+	}
+	return sanitized
+}
+
+// sanitizeValue redacts the env var values and removes the last applied
+// configuration and managed fields found in v, at any depth so that the pod
+// templates of workloads are sanitized too
+func sanitizeValue(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		delete(v, "managedFields")
+		if annotations, ok := v["annotations"].(map[string]interface{}); ok {
+			delete(annotations, lastAppliedAnnotation)
+		}
+		if vars, ok := v["env"].([]interface{}); ok {
+			for _, envVar := range vars {
+				if envVar, ok := envVar.(map[string]interface{}); ok {
+					if _, ok := envVar["value"]; ok {
+						envVar["value"] = redactedValue
+					}
+				}
+			}
+		}
+		for _, value := range v {
+			sanitizeValue(value)
+		}
+	case []interface{}:
+		for _, item := range v {
+			sanitizeValue(item)
+		}
+	}
+}
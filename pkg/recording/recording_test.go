@@ -0,0 +1,105 @@
+package recording
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func testRequest(t *testing.T) *admissionv1.AdmissionRequest {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:          "web",
+			Namespace:     "team-a",
+			Annotations:   map[string]string{lastAppliedAnnotation: `{"env":"secret"}`, "team": "a"},
+			ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "kubectl"}},
+		},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: "web",
+			Env: []corev1.EnvVar{
+				{Name: "PASSWORD", Value: "hunter2"},
+				{Name: "TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{Key: "token"}}},
+			},
+		}}},
+	}
+	raw, err := json.Marshal(pod)
+	require.NoError(t, err)
+	return &admissionv1.AdmissionRequest{
+		UID:       "1",
+		Namespace: "team-a",
+		Operation: admissionv1.Create,
+		UserInfo: authenticationv1.UserInfo{
+			Username: "alice",
+			Extra:    map[string]authenticationv1.ExtraValue{"token": {"secret"}},
+		},
+		Object: runtime.RawExtension{Raw: raw},
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	req := testRequest(t)
+	original := string(req.Object.Raw)
+	sanitized := Sanitize(req)
+
+	assert.Equal(t, authenticationv1.ExtraValue{redactedValue}, sanitized.UserInfo.Extra["token"])
+	assert.Equal(t, authenticationv1.ExtraValue{"secret"}, req.UserInfo.Extra["token"], "the request must not be modified")
+	assert.Equal(t, original, string(req.Object.Raw), "the request must not be modified")
+	assert.Nil(t, sanitized.OldObject.Raw)
+
+	var pod corev1.Pod
+	require.NoError(t, json.Unmarshal(sanitized.Object.Raw, &pod))
+	assert.Equal(t, map[string]string{"team": "a"}, pod.Annotations)
+	assert.Empty(t, pod.ManagedFields)
+	assert.Equal(t, redactedValue, pod.Spec.Containers[0].Env[0].Value)
+	assert.Empty(t, pod.Spec.Containers[0].Env[1].Value)
+	assert.Equal(t, "token", pod.Spec.Containers[0].Env[1].ValueFrom.SecretKeyRef.Key)
+
+	req.Object.Raw = []byte("not json")
+	assert.Nil(t, Sanitize(req).Object.Raw)
+}
+
+func TestRecorder(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewRecorder(dir, 2)
+	require.NoError(t, err)
+	defer r.Close()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	response := &admissionv1.AdmissionResponse{UID: "1", Allowed: false, Result: &metav1.Status{Code: 403, Message: "denied"}}
+	for day := 0; day < 3; day++ {
+		r.Record("validate", "abc", testRequest(t), response)
+		now = now.Add(24 * time.Hour)
+	}
+	r.Record("mutate", "abc", testRequest(t), &admissionv1.AdmissionResponse{UID: "1", Allowed: true})
+
+	files, err := Files(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "admissions-2026-01-03.jsonl"),
+		filepath.Join(dir, "admissions-2026-01-04.jsonl"),
+	}, files)
+
+	f, err := os.Open(files[0])
+	require.NoError(t, err)
+	defer f.Close()
+	entries, err := Read(f)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "validate", entries[0].Webhook)
+	assert.Equal(t, "abc", entries[0].MappingVersion)
+	assert.Equal(t, time.Date(2026, 1, 3, 12, 0, 0, 0, time.UTC), entries[0].Time)
+	assert.Equal(t, "alice", entries[0].Request.UserInfo.Username)
+	assert.NotContains(t, string(entries[0].Request.Object.Raw), "hunter2")
+	assert.Equal(t, "denied", entries[0].Response.Result.Message)
+}
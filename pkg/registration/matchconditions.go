@@ -0,0 +1,106 @@
+package registration
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+)
+
+// MatchOptions describe the requests the webhook admits without looking at them,
+// which the API server can skip through matchConditions
+type MatchOptions struct {
+	// EnforcedNamespaces and ExcludedNamespaces are the namespace patterns of the
+	// namespace scope of the webhook
+	EnforcedNamespaces []string
+	ExcludedNamespaces []string
+	// NFSOnly is set when only pods mounting NFS storage are enforced, NFS volumes
+	// being provided by CSIDrivers
+	NFSOnly    bool
+	CSIDrivers []string
+}
+
+// volumesExpression returns the volumes of the pod or of the pod template of the
+// object of the request
+const volumesExpression = "request.kind.kind == 'Pod' ? (has(object.spec.volumes) ? object.spec.volumes : []) : " +
+	"request.kind.kind == 'CronJob' ? (has(object.spec.jobTemplate.spec.template.spec.volumes) ? object.spec.jobTemplate.spec.template.spec.volumes : []) : " +
+	"(has(object.spec.template.spec.volumes) ? object.spec.template.spec.volumes : [])"
+
+// MatchConditions returns the matchConditions sending only the requests the
+// webhook may act on. Conditions only ever let more requests through than the
+// webhook acts on: excluded namespace patterns that can't be expressed in CEL are
+// left to the webhook, and enforced namespaces are only pre-filtered when all of
+// their patterns can be expressed. Since PersistentVolumeClaims can't be resolved
+// at the API server, pods with claims or ephemeral volumes are always sent.
+func MatchConditions(opts MatchOptions) []admissionregistrationv1.MatchCondition {
+	var conditions []admissionregistrationv1.MatchCondition
+	if excluded, _ := namespaceExpression(opts.ExcludedNamespaces); excluded != "" {
+		conditions = append(conditions, admissionregistrationv1.MatchCondition{
+			Name:       "exclude-namespaces",
+			Expression: "!(" + excluded + ")",
+		})
+	}
+	if enforced, ok := namespaceExpression(opts.EnforcedNamespaces); enforced != "" && ok {
+		conditions = append(conditions, admissionregistrationv1.MatchCondition{
+			Name:       "enforce-namespaces",
+			Expression: enforced,
+		})
+	}
+	if opts.NFSOnly {
+		drivers := make([]string, 0, len(opts.CSIDrivers))
+		for _, driver := range opts.CSIDrivers {
+			drivers = append(drivers, strconv.Quote(driver))
+		}
+		conditions = append(conditions, admissionregistrationv1.MatchCondition{
+			Name: "nfs-volumes",
+			Expression: "(" + volumesExpression + ").exists(v, has(v.nfs) || has(v.persistentVolumeClaim) || has(v.ephemeral) || " +
+				"(has(v.csi) && v.csi.driver in [" + strings.Join(drivers, ", ") + "]))",
+		})
+	}
+	return conditions
+}
+
+// namespaceExpression returns the expression matching the namespace of the
+// request against patterns, and false if some patterns couldn't be expressed
+func namespaceExpression(patterns []string) (string, bool) {
+	var names, terms []string
+	ok := true
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, `*?[\`) {
+			names = append(names, strconv.Quote(pattern))
+			continue
+		}
+		re, converted := globRegexp(pattern)
+		if !converted {
+			ok = false
+			continue
+		}
+		terms = append(terms, "request.namespace.matches("+strconv.Quote(re)+")")
+	}
+	if len(names) > 0 {
+		terms = append([]string{"request.namespace in [" + strings.Join(names, ", ") + "]"}, terms...)
+	}
+	return strings.Join(terms, " || "), ok
+}
+
+// globRegexp converts a path.Match pattern made of literals, * and ? into an
+// anchored regular expression, character classes and escapes are not converted
+func globRegexp(pattern string) (string, bool) {
+	var re strings.Builder
+	re.WriteString("^")
+	for _, c := range pattern {
+		switch c {
+		case '*':
+			re.WriteString(".*")
+		case '?':
+			re.WriteString(".")
+		case '[', '\\':
+			return "", false
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return re.String(), true
+}
@@ -0,0 +1,94 @@
+package registration
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// matches evaluates conditions like the API server does, the request is sent to
+// the webhook when every condition is true
+func matches(t *testing.T, conditions []admissionregistrationv1.MatchCondition, kind, namespace string, obj interface{}) bool {
+	env, err := cel.NewEnv(cel.Variable("object", cel.DynType), cel.Variable("request", cel.DynType))
+	require.NoError(t, err)
+	object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	require.NoError(t, err)
+	activation := map[string]interface{}{
+		"object":  object,
+		"request": map[string]interface{}{"namespace": namespace, "kind": map[string]interface{}{"kind": kind}},
+	}
+
+	for _, condition := range conditions {
+		ast, issues := env.Compile(condition.Expression)
+		require.NoError(t, issues.Err(), condition.Expression)
+		program, err := env.Program(ast)
+		require.NoError(t, err)
+		out, _, err := program.Eval(activation)
+		require.NoError(t, err, condition.Expression)
+		if !out.Value().(bool) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMatchConditionsNamespaces(t *testing.T) {
+	pod := &corev1.Pod{}
+	conditions := MatchConditions(MatchOptions{
+		EnforcedNamespaces: []string{"team-*", "shared"},
+		ExcludedNamespaces: []string{"kube-system", "team-?-ci", "[ab]*"},
+	})
+	require.Len(t, conditions, 2)
+	assert.True(t, matches(t, conditions, "Pod", "team-a", pod))
+	assert.True(t, matches(t, conditions, "Pod", "shared", pod))
+	assert.False(t, matches(t, conditions, "Pod", "kube-system", pod))
+	assert.False(t, matches(t, conditions, "Pod", "team-a-ci", pod))
+	assert.False(t, matches(t, conditions, "Pod", "default", pod))
+	// character classes are left to the webhook
+	assert.True(t, matches(t, conditions, "Pod", "team-b", pod))
+
+	// enforced namespaces aren't pre-filtered unless every pattern is expressed
+	conditions = MatchConditions(MatchOptions{EnforcedNamespaces: []string{"team-*", "[ab]*"}})
+	assert.Empty(t, conditions)
+	assert.Empty(t, MatchConditions(MatchOptions{}))
+}
+
+func TestMatchConditionsNFS(t *testing.T) {
+	conditions := MatchConditions(MatchOptions{NFSOnly: true, CSIDrivers: []string{"nfs.csi.k8s.io"}})
+	require.Len(t, conditions, 1)
+
+	podWith := func(volumes ...corev1.Volume) *corev1.Pod {
+		return &corev1.Pod{Spec: corev1.PodSpec{Volumes: volumes}}
+	}
+	nfs := corev1.Volume{Name: "home", VolumeSource: corev1.VolumeSource{NFS: &corev1.NFSVolumeSource{Server: "nfs", Path: "/home"}}}
+	claim := corev1.Volume{Name: "data", VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data"}}}
+	csi := func(driver string) corev1.Volume {
+		return corev1.Volume{Name: "csi", VolumeSource: corev1.VolumeSource{CSI: &corev1.CSIVolumeSource{Driver: driver}}}
+	}
+	emptyDir := corev1.Volume{Name: "tmp", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}
+
+	assert.False(t, matches(t, conditions, "Pod", "default", podWith()))
+	assert.False(t, matches(t, conditions, "Pod", "default", podWith(emptyDir, csi("ebs.csi.aws.com"))))
+	assert.True(t, matches(t, conditions, "Pod", "default", podWith(emptyDir, nfs)))
+	assert.True(t, matches(t, conditions, "Pod", "default", podWith(claim)))
+	assert.True(t, matches(t, conditions, "Pod", "default", podWith(csi("nfs.csi.k8s.io"))))
+
+	deployment := &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: podWith(nfs).Spec}}}
+	assert.True(t, matches(t, conditions, "Deployment", "default", deployment))
+	deployment.Spec.Template.Spec.Volumes = nil
+	assert.False(t, matches(t, conditions, "Deployment", "default", deployment))
+}
+
+func TestGlobRegexp(t *testing.T) {
+	re, ok := globRegexp("ci-*.x?")
+	assert.True(t, ok)
+	assert.Equal(t, `^ci-.*\.x.$`, re)
+	_, ok = globRegexp("[a-z]*")
+	assert.False(t, ok)
+}
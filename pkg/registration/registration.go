@@ -0,0 +1,201 @@
+// Package registration creates and updates the ValidatingWebhookConfiguration of
+// the webhook from its own config file, so that the deployment and the
+// registration of the webhook can't drift apart
+package registration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// resyncPeriod is the period at which the configuration is reconciled, reverting
+// manual changes
+const resyncPeriod = 10 * time.Minute
+
+// Config describes the ValidatingWebhookConfiguration of the webhook, holding a
+// single webhook named like the configuration
+type Config struct {
+	Name        string            `json:"name"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Service is the Service of the webhook the API server calls
+	Service           admissionregistrationv1.ServiceReference     `json:"service"`
+	Rules             []admissionregistrationv1.RuleWithOperations `json:"rules"`
+	FailurePolicy     *admissionregistrationv1.FailurePolicyType   `json:"failurePolicy,omitempty"`
+	NamespaceSelector *metav1.LabelSelector                        `json:"namespaceSelector,omitempty"`
+	ObjectSelector    *metav1.LabelSelector                        `json:"objectSelector,omitempty"`
+	MatchConditions   []admissionregistrationv1.MatchCondition     `json:"matchConditions,omitempty"`
+	SideEffects       *admissionregistrationv1.SideEffectClass     `json:"sideEffects,omitempty"`
+	TimeoutSeconds    *int32                                       `json:"timeoutSeconds,omitempty"`
+	MatchPolicy       *admissionregistrationv1.MatchPolicyType     `json:"matchPolicy,omitempty"`
+}
+
+// LoadConfig reads the webhook registration config file
+func LoadConfig(name string) (*Config, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading webhook registration config file: %s\n", err)
+	}
+	var c Config
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("Error parsing webhook registration config: %s\n", err)
+	}
+	if c.Name == "" || c.Service.Name == "" || c.Service.Namespace == "" || len(c.Rules) == 0 {
+		return nil, fmt.Errorf("invalid webhook registration config, name, service and rules are required")
+	}
+	return &c, nil
+}
+
+// Webhook returns the desired ValidatingWebhookConfiguration. Unset fields are
+// set to the defaults of the API server so that the configuration is only updated
+// when it actually differs.
+func (c *Config) Webhook() *admissionregistrationv1.ValidatingWebhookConfiguration {
+	failurePolicy := admissionregistrationv1.Fail
+	if c.FailurePolicy != nil {
+		failurePolicy = *c.FailurePolicy
+	}
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	if c.SideEffects != nil {
+		sideEffects = *c.SideEffects
+	}
+	timeoutSeconds := int32(10)
+	if c.TimeoutSeconds != nil {
+		timeoutSeconds = *c.TimeoutSeconds
+	}
+	matchPolicy := admissionregistrationv1.Equivalent
+	if c.MatchPolicy != nil {
+		matchPolicy = *c.MatchPolicy
+	}
+	namespaceSelector, objectSelector := &metav1.LabelSelector{}, &metav1.LabelSelector{}
+	if c.NamespaceSelector != nil {
+		namespaceSelector = c.NamespaceSelector.DeepCopy()
+	}
+	if c.ObjectSelector != nil {
+		objectSelector = c.ObjectSelector.DeepCopy()
+	}
+	port := int32(443)
+	if c.Service.Port != nil {
+		port = *c.Service.Port
+	}
+	service := c.Service.DeepCopy()
+	service.Port = &port
+
+	rules := make([]admissionregistrationv1.RuleWithOperations, len(c.Rules))
+	for i, rule := range c.Rules {
+		rules[i] = *rule.DeepCopy()
+		if rules[i].Scope == nil {
+			scope := admissionregistrationv1.AllScopes
+			rules[i].Scope = &scope
+		}
+	}
+	var matchConditions []admissionregistrationv1.MatchCondition
+	if len(c.MatchConditions) > 0 {
+		matchConditions = append(matchConditions, c.MatchConditions...)
+	}
+
+	return &admissionregistrationv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: c.Name, Annotations: c.Annotations},
+		Webhooks: []admissionregistrationv1.ValidatingWebhook{{
+			Name:                    c.Name,
+			ClientConfig:            admissionregistrationv1.WebhookClientConfig{Service: service},
+			Rules:                   rules,
+			FailurePolicy:           &failurePolicy,
+			MatchPolicy:             &matchPolicy,
+			NamespaceSelector:       namespaceSelector,
+			ObjectSelector:          objectSelector,
+			SideEffects:             &sideEffects,
+			TimeoutSeconds:          &timeoutSeconds,
+			AdmissionReviewVersions: []string{"v1"},
+			MatchConditions:         matchConditions,
+		}},
+	}
+}
+
+// Reconciler keeps the ValidatingWebhookConfiguration in line with its Config
+type Reconciler struct {
+	client kubernetes.Interface
+	config *Config
+	Logger *logrus.Entry
+}
+
+// NewReconciler returns a Reconciler registering the webhook described by config
+func NewReconciler(client kubernetes.Interface, config *Config) *Reconciler {
+	return &Reconciler{
+		client: client,
+		config: config,
+		Logger: logrus.WithField("component", "registration"),
+	}
+}
+
+// Run reconciles the configuration every resyncPeriod until stopCh is closed,
+// the first reconciliation should be done with Reconcile at startup
+func (r *Reconciler) Run(stopCh <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(resyncPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+			}
+			if err := r.Reconcile(context.Background()); err != nil {
+				r.Logger.Errorf("cannot register ValidatingWebhookConfiguration %s: %v", r.config.Name, err)
+			}
+		}
+	}()
+}
+
+// Reconcile creates the ValidatingWebhookConfiguration or updates it when it
+// differs from the config. The CA bundle is left untouched since it is injected
+// by cert-manager or by the certificate manager of the webhook.
+func (r *Reconciler) Reconcile(ctx context.Context) error {
+	configurations := r.client.AdmissionregistrationV1().ValidatingWebhookConfigurations()
+	desired := r.config.Webhook()
+
+	current, err := configurations.Get(ctx, desired.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err := configurations.Create(ctx, desired, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("Error creating ValidatingWebhookConfiguration %s: %s\n", desired.Name, err)
+		}
+		r.Logger.Infof("Created ValidatingWebhookConfiguration %s", desired.Name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error getting ValidatingWebhookConfiguration %s: %s\n", desired.Name, err)
+	}
+
+	for _, webhook := range current.Webhooks {
+		if webhook.Name == desired.Webhooks[0].Name {
+			desired.Webhooks[0].ClientConfig.CABundle = webhook.ClientConfig.CABundle
+		}
+	}
+	annotations := make(map[string]string, len(current.Annotations)+len(desired.Annotations))
+	for key, value := range current.Annotations {
+		annotations[key] = value
+	}
+	for key, value := range desired.Annotations {
+		annotations[key] = value
+	}
+	if equality.Semantic.DeepEqual(current.Webhooks, desired.Webhooks) && equality.Semantic.DeepEqual(current.Annotations, annotations) {
+		return nil
+	}
+
+	updated := current.DeepCopy()
+	updated.Annotations = annotations
+	updated.Webhooks = desired.Webhooks
+	if _, err := configurations.Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("Error updating ValidatingWebhookConfiguration %s: %s\n", desired.Name, err)
+	}
+	r.Logger.Infof("Updated ValidatingWebhookConfiguration %s", desired.Name)
+	return nil
+}
@@ -0,0 +1,116 @@
+package registration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testConfig = `
+name: nfs.k8s.com
+annotations:
+  cert-manager.io/inject-ca-from: nfs/nfs-certificate
+service:
+  namespace: nfs
+  name: nfs-webhook
+  path: /validate-pods
+rules:
+- apiGroups: [""]
+  apiVersions: ["v1"]
+  operations: ["CREATE"]
+  resources: ["pods"]
+failurePolicy: Ignore
+namespaceSelector:
+  matchLabels:
+    admission-webhook: enabled
+matchConditions:
+- name: exclude-kubelet
+  expression: "!request.userInfo.username.startsWith('system:node:')"
+timeoutSeconds: 2
+`
+
+func loadTestConfig(t *testing.T, content string) *Config {
+	file := filepath.Join(t.TempDir(), "registration.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+	c, err := LoadConfig(file)
+	require.NoError(t, err)
+	return c
+}
+
+func TestLoadConfig(t *testing.T) {
+	c := loadTestConfig(t, testConfig)
+	webhook := c.Webhook().Webhooks[0]
+	assert.Equal(t, "nfs.k8s.com", webhook.Name)
+	assert.Equal(t, admissionregistrationv1.Ignore, *webhook.FailurePolicy)
+	assert.Equal(t, admissionregistrationv1.SideEffectClassNone, *webhook.SideEffects)
+	assert.Equal(t, int32(443), *webhook.ClientConfig.Service.Port)
+	assert.Equal(t, admissionregistrationv1.AllScopes, *webhook.Rules[0].Scope)
+	assert.Equal(t, "exclude-kubelet", webhook.MatchConditions[0].Name)
+
+	file := filepath.Join(t.TempDir(), "registration.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("name: nfs.k8s.com\nunknown: true\n"), 0o600))
+	_, err := LoadConfig(file)
+	assert.Error(t, err)
+	require.NoError(t, os.WriteFile(file, []byte("name: nfs.k8s.com\n"), 0o600))
+	_, err = LoadConfig(file)
+	assert.Error(t, err)
+}
+
+func countUpdates(client *fake.Clientset) *int {
+	updates := 0
+	client.PrependReactor("update", "validatingwebhookconfigurations", func(k8stesting.Action) (bool, runtime.Object, error) {
+		updates++
+		return false, nil, nil
+	})
+	return &updates
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	updates := countUpdates(client)
+	r := NewReconciler(client, loadTestConfig(t, testConfig))
+	configurations := client.AdmissionregistrationV1().ValidatingWebhookConfigurations()
+
+	require.NoError(t, r.Reconcile(ctx))
+	created, err := configurations.Get(ctx, "nfs.k8s.com", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "nfs/nfs-certificate", created.Annotations["cert-manager.io/inject-ca-from"])
+	require.Len(t, created.Webhooks, 1)
+
+	// nothing is updated while the configuration is in line with the config
+	require.NoError(t, r.Reconcile(ctx))
+	assert.Equal(t, 0, *updates)
+
+	// drift is reverted, keeping the injected CA bundle and other annotations
+	drifted := created.DeepCopy()
+	drifted.Annotations["owner"] = "platform"
+	drifted.Webhooks[0].ClientConfig.CABundle = []byte("ca")
+	fail := admissionregistrationv1.Fail
+	drifted.Webhooks[0].FailurePolicy = &fail
+	drifted.Webhooks[0].MatchConditions = nil
+	_, err = configurations.Update(ctx, drifted, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	*updates = 0
+
+	require.NoError(t, r.Reconcile(ctx))
+	assert.Equal(t, 1, *updates)
+	reconciled, err := configurations.Get(ctx, "nfs.k8s.com", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("ca"), reconciled.Webhooks[0].ClientConfig.CABundle)
+	assert.Equal(t, admissionregistrationv1.Ignore, *reconciled.Webhooks[0].FailurePolicy)
+	assert.Len(t, reconciled.Webhooks[0].MatchConditions, 1)
+	assert.Equal(t, "platform", reconciled.Annotations["owner"])
+
+	require.NoError(t, r.Reconcile(ctx))
+	assert.Equal(t, 1, *updates)
+}
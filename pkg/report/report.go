@@ -0,0 +1,269 @@
+// Package report writes the NFSAccessReport of every namespace, summarizing the
+// pods denied by the webhook and the running pods found in violation by the
+// compliance scan, so that tenants can check their compliance with kubectl
+package report
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/apis/nfsaccess/v1alpha1"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/validation"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// DefaultName is the default name of the NFSAccessReport of every namespace
+	DefaultName = "nfs-access"
+	// DefaultMaxDenials is the default number of distinct denials kept per report
+	DefaultMaxDenials = 50
+	// DefaultFlushInterval is the default period the pending results are written at
+	DefaultFlushInterval = 30 * time.Second
+)
+
+// Writer accumulates the denials and violations of every namespace and writes
+// them to their NFSAccessReport periodically, so that admission requests don't
+// wait for the API server
+type Writer struct {
+	client dynamic.Interface
+
+	// Name is the name of the NFSAccessReport of every namespace
+	Name string
+	// MaxDenials is the number of distinct denials kept per report, the least
+	// recent ones are dropped first
+	MaxDenials int
+	// FlushInterval is the period the pending results are written at
+	FlushInterval time.Duration
+	Logger        *logrus.Entry
+
+	mu sync.Mutex
+	// denials are the pending denials by namespace
+	denials map[string][]v1alpha1.NFSAccessReportResult
+	// scans are the pending violations by namespace
+	scans map[string]*scan
+	// violating are the namespaces whose report holds violations
+	violating map[string]bool
+}
+
+// scan is the outcome of a compliance scan for a namespace
+type scan struct {
+	at         metav1.Time
+	violations []v1alpha1.NFSAccessReportResult
+}
+
+// NewWriter returns a Writer of NFSAccessReports
+func NewWriter(client dynamic.Interface) *Writer {
+	return &Writer{
+		client:        client,
+		Name:          DefaultName,
+		MaxDenials:    DefaultMaxDenials,
+		FlushInterval: DefaultFlushInterval,
+		Logger:        logrus.WithField("component", "report"),
+		denials:       map[string][]v1alpha1.NFSAccessReportResult{},
+		scans:         map[string]*scan{},
+		violating:     map[string]bool{},
+	}
+}
+
+// Denied records a pod of namespace denied when created by subject, with a
+// result per finding or a single one with reason when there is none
+func (w *Writer) Denied(namespace, subject, pod, reason string, findings []validation.Finding) {
+	now := metav1.Now()
+	result := func(validator, code, reason string) v1alpha1.NFSAccessReportResult {
+		return v1alpha1.NFSAccessReportResult{
+			Type:      v1alpha1.ResultDenial,
+			Subject:   subject,
+			Pod:       pod,
+			Validator: validator,
+			Code:      code,
+			Reason:    strings.TrimSpace(reason),
+			Count:     1,
+			FirstSeen: now,
+			LastSeen:  now,
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(findings) == 0 {
+		w.denials[namespace] = append(w.denials[namespace], result("", "", reason))
+		return
+	}
+	for _, f := range findings {
+		w.denials[namespace] = append(w.denials[namespace], result(f.Validator, f.Code, f.Reason))
+	}
+}
+
+// Scanned records the violations found by the compliance scan at at, by
+// namespace. The violations of the namespaces missing from violations are
+// cleared.
+func (w *Writer) Scanned(at metav1.Time, violations map[string][]v1alpha1.NFSAccessReportResult) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for namespace := range w.violating {
+		if _, found := violations[namespace]; !found {
+			w.scans[namespace] = &scan{at: at}
+			delete(w.violating, namespace)
+		}
+	}
+	for namespace, results := range violations {
+		w.scans[namespace] = &scan{at: at, violations: results}
+		w.violating[namespace] = true
+	}
+}
+
+// Run writes the pending results every FlushInterval until stopCh is closed,
+// failures are logged and retried on the next flush
+func (w *Writer) Run(stopCh <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(w.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				if err := w.Flush(context.Background()); err != nil {
+					w.Logger.Errorf("cannot write NFSAccessReports: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Flush writes the pending results to the reports of their namespaces, the
+// results of the namespaces that failed are kept for the next flush
+func (w *Writer) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	denials, scans := w.denials, w.scans
+	w.denials, w.scans = map[string][]v1alpha1.NFSAccessReportResult{}, map[string]*scan{}
+	w.mu.Unlock()
+
+	namespaces := map[string]bool{}
+	for namespace := range denials {
+		namespaces[namespace] = true
+	}
+	for namespace := range scans {
+		namespaces[namespace] = true
+	}
+	var failed []string
+	for namespace := range namespaces {
+		if err := w.write(ctx, namespace, denials[namespace], scans[namespace]); err != nil {
+			w.Logger.WithField("namespace", namespace).Warn(err)
+			failed = append(failed, namespace)
+			w.requeue(namespace, denials[namespace], scans[namespace])
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("cannot write the reports of namespaces %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// requeue adds back the results of namespace that could not be written, unless
+// a newer scan superseded them
+func (w *Writer) requeue(namespace string, denials []v1alpha1.NFSAccessReportResult, s *scan) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.denials[namespace] = append(denials, w.denials[namespace]...)
+	if _, found := w.scans[namespace]; !found && s != nil {
+		w.scans[namespace] = s
+	}
+}
+
+// write merges denials and the outcome of s into the report of namespace,
+// created if needed
+func (w *Writer) write(ctx context.Context, namespace string, denials []v1alpha1.NFSAccessReportResult, s *scan) error {
+	reports := w.client.Resource(v1alpha1.NFSAccessReportsResource).Namespace(namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		report := &v1alpha1.NFSAccessReport{
+			TypeMeta:   metav1.TypeMeta{APIVersion: v1alpha1.SchemeGroupVersion.String(), Kind: "NFSAccessReport"},
+			ObjectMeta: metav1.ObjectMeta{Name: w.Name, Namespace: namespace},
+		}
+		u, err := reports.Get(ctx, w.Name, metav1.GetOptions{})
+		found := err == nil
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("Error getting NFSAccessReport: %s\n", err)
+		}
+		if found {
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, report); err != nil {
+				return fmt.Errorf("failed to parse NFSAccessReport %s/%s: %v", namespace, w.Name, err)
+			}
+		}
+
+		merge(report, denials, s, w.MaxDenials)
+		object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(report)
+		if err != nil {
+			return err
+		}
+		if found {
+			_, err = reports.Update(ctx, &unstructured.Unstructured{Object: object}, metav1.UpdateOptions{})
+		} else {
+			_, err = reports.Create(ctx, &unstructured.Unstructured{Object: object}, metav1.CreateOptions{})
+		}
+		return err
+	})
+}
+
+// merge adds denials to report, counting the repeated ones, replaces its
+// violations with those of s when not nil, and keeps the maxDenials most recent
+// denials
+func merge(report *v1alpha1.NFSAccessReport, denials []v1alpha1.NFSAccessReportResult, s *scan, maxDenials int) {
+	var results, violations []v1alpha1.NFSAccessReportResult
+	for _, r := range report.Results {
+		if r.Type == v1alpha1.ResultViolation {
+			violations = append(violations, r)
+		} else {
+			results = append(results, r)
+		}
+	}
+
+	for _, d := range denials {
+		report.Summary.Denials += d.Count
+		if report.Summary.LastDenial == nil || report.Summary.LastDenial.Before(&d.LastSeen) {
+			last := d.LastSeen
+			report.Summary.LastDenial = &last
+		}
+		merged := false
+		for i := range results {
+			r := &results[i]
+			if r.Subject == d.Subject && r.Validator == d.Validator && r.Code == d.Code && r.Reason == d.Reason {
+				r.Count += d.Count
+				r.Pod = d.Pod
+				r.LastSeen = d.LastSeen
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			results = append(results, d)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[j].LastSeen.Before(&results[i].LastSeen) })
+	if maxDenials > 0 && len(results) > maxDenials {
+		results = results[:maxDenials]
+	}
+
+	if s != nil {
+		at := s.at
+		report.Summary.LastScan = &at
+		violations = s.violations
+	}
+	pods := map[string]bool{}
+	for _, v := range violations {
+		pods[v.Pod] = true
+	}
+	report.Summary.Violations = int64(len(pods))
+	report.Results = append(violations, results...)
+}
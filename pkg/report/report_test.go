@@ -0,0 +1,92 @@
+package report
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/apis/nfsaccess/v1alpha1"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestWriter(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme,
+		map[schema.GroupVersionResource]string{v1alpha1.NFSAccessReportsResource: "NFSAccessReportList"})
+	w := NewWriter(client)
+	get := func(namespace string) *v1alpha1.NFSAccessReport {
+		u, err := client.Resource(v1alpha1.NFSAccessReportsResource).Namespace(namespace).Get(context.TODO(), DefaultName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &v1alpha1.NFSAccessReport{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	mismatch := []validation.Finding{{Validator: "uid", Code: "UIDMismatch", Reason: "Invalid uid in pod, expected: 1001, found: 0\n"}}
+	w.Denied("team-a", "alice", "web-", "denied", mismatch)
+	w.Denied("team-a", "alice", "web-", "denied", mismatch)
+	w.Denied("team-a", "bob", "", "could not validate pod: lookup failed", nil)
+	scannedAt := metav1.Now()
+	w.Scanned(scannedAt, map[string][]v1alpha1.NFSAccessReportResult{
+		"team-b": {{Type: v1alpha1.ResultViolation, Subject: "system:serviceaccount:team-b:default", Pod: "db-0", Reason: "stale", Count: 1}},
+	})
+	assert.NoError(t, w.Flush(context.TODO()))
+
+	r := get("team-a")
+	assert.Equal(t, int64(3), r.Summary.Denials)
+	assert.Equal(t, int64(0), r.Summary.Violations)
+	assert.NotNil(t, r.Summary.LastDenial)
+	assert.Nil(t, r.Summary.LastScan)
+	if assert.Len(t, r.Results, 2) {
+		counts := map[string]int64{}
+		for _, result := range r.Results {
+			assert.Equal(t, v1alpha1.ResultDenial, result.Type)
+			counts[result.Subject] = result.Count
+		}
+		assert.Equal(t, map[string]int64{"alice": 2, "bob": 1}, counts)
+	}
+
+	r = get("team-b")
+	assert.Equal(t, int64(1), r.Summary.Violations)
+	assert.Equal(t, int64(0), r.Summary.Denials)
+	assert.Len(t, r.Results, 1)
+
+	// denials accumulate and violations no longer found are cleared
+	w.Denied("team-b", "carol", "db-0", "denied", mismatch)
+	w.Scanned(metav1.Now(), nil)
+	assert.NoError(t, w.Flush(context.TODO()))
+	r = get("team-b")
+	assert.Equal(t, int64(0), r.Summary.Violations)
+	assert.Equal(t, int64(1), r.Summary.Denials)
+	if assert.Len(t, r.Results, 1) {
+		assert.Equal(t, "carol", r.Results[0].Subject)
+		assert.Equal(t, "Invalid uid in pod, expected: 1001, found: 0", r.Results[0].Reason)
+	}
+}
+
+func TestMergeKeepsRecentDenials(t *testing.T) {
+	report := &v1alpha1.NFSAccessReport{}
+	var denials []v1alpha1.NFSAccessReportResult
+	for i, subject := range []string{"alice", "bob", "carol"} {
+		seen := metav1.Unix(int64(i), 0)
+		denials = append(denials, v1alpha1.NFSAccessReportResult{Type: v1alpha1.ResultDenial, Subject: subject, Reason: "denied", Count: 1, FirstSeen: seen, LastSeen: seen})
+	}
+	merge(report, denials, nil, 2)
+
+	assert.Equal(t, int64(3), report.Summary.Denials)
+	if assert.Len(t, report.Results, 2) {
+		assert.Equal(t, "carol", report.Results[0].Subject)
+		assert.Equal(t, "bob", report.Results[1].Subject)
+	}
+}
@@ -0,0 +1,105 @@
+package resolver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/metrics"
+)
+
+// CircuitBreaker tracks the availability of the backend it wraps: the circuit is
+// open once every lookup has failed for longer than Window, and closed again by
+// the first lookup the backend answers (found or not). Lookups answered from the
+// cache of a backend count as answered.
+type CircuitBreaker struct {
+	next   UIDResolver
+	Window time.Duration
+	Logger logrus.FieldLogger
+	now    func() time.Time
+
+	mu sync.Mutex
+	// failingSince is the time of the first failed lookup since the last answered
+	// one, zero while the backend answers
+	failingSince time.Time
+	open         bool
+}
+
+// CircuitBreaker implements the UIDResolver and namespacedResolver interfaces
+var (
+	_ UIDResolver        = (*CircuitBreaker)(nil)
+	_ namespacedResolver = (*CircuitBreaker)(nil)
+)
+
+// NewCircuitBreaker wraps next with a CircuitBreaker opening after window
+func NewCircuitBreaker(next UIDResolver, window time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		next:   next,
+		Window: window,
+		Logger: logrus.StandardLogger(),
+		now:    time.Now,
+	}
+}
+
+// Resolve resolves subject with the wrapped backend
+func (b *CircuitBreaker) Resolve(ctx context.Context, subject string) (IdentitySpec, error) {
+	return b.resolveInNamespace(ctx, "", subject)
+}
+
+// resolveInNamespace resolves subject with the namespace mappings of the wrapped
+// backend if any, recording whether the backend answered
+func (b *CircuitBreaker) resolveInNamespace(ctx context.Context, namespace, subject string) (IdentitySpec, error) {
+	id, err := resolveInNamespace(ctx, b.next, namespace, subject)
+	b.record(lookupResult(err) != metrics.ResultError)
+	return id, err
+}
+
+// record updates the state of the circuit after a lookup
+func (b *CircuitBreaker) record(answered bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if answered {
+		b.failingSince = time.Time{}
+		b.setOpen(false)
+		return
+	}
+	if b.failingSince.IsZero() {
+		b.failingSince = b.now()
+	}
+	b.update()
+}
+
+// Open returns true while the backend has been failing for longer than Window
+func (b *CircuitBreaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.update()
+	return b.open
+}
+
+// update opens the circuit once the backend has been failing for longer than Window
+func (b *CircuitBreaker) update() {
+	if !b.failingSince.IsZero() && b.now().Sub(b.failingSince) > b.Window {
+		b.setOpen(true)
+	}
+}
+
+func (b *CircuitBreaker) setOpen(open bool) {
+	if open == b.open {
+		return
+	}
+	b.open = open
+	metrics.SetFailOpen(open)
+	if open {
+		b.Logger.Errorf("identity backend failing since %s, failing open: pods are admitted without enforcement", b.failingSince.Format(time.RFC3339))
+	} else {
+		b.Logger.Warn("identity backend answering again, enforcement resumed")
+	}
+}
+
+// unwrap returns the wrapped resolver
+func (b *CircuitBreaker) unwrap() UIDResolver {
+	return b.next
+}
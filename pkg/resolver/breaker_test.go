@@ -0,0 +1,49 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	next := &countingResolver{}
+	now := time.Now()
+	b := NewCircuitBreaker(next, time.Minute)
+	b.now = func() time.Time { return now }
+	logger, hook := test.NewNullLogger()
+	b.Logger = logger
+	ctx := context.Background()
+
+	_, err := b.Resolve(ctx, "user2")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.False(t, b.Open())
+
+	// the circuit opens once lookups have failed for longer than the window
+	next.err = errors.New("connection refused")
+	_, err = b.Resolve(ctx, "user1")
+	assert.Error(t, err)
+	assert.False(t, b.Open())
+	now = now.Add(30 * time.Second)
+	_, _ = b.Resolve(ctx, "user1")
+	assert.False(t, b.Open())
+	now = now.Add(31 * time.Second)
+	assert.True(t, b.Open())
+	assert.Contains(t, hook.LastEntry().Message, "failing open")
+
+	// and closes on the first answered lookup
+	next.err = nil
+	_, err = b.Resolve(ctx, "user2")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.False(t, b.Open())
+
+	// the failure window starts again from the next failure
+	next.err = errors.New("connection refused")
+	now = now.Add(time.Hour)
+	_, _ = b.Resolve(ctx, "user1")
+	assert.False(t, b.Open())
+}
@@ -0,0 +1,232 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/metrics"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/sharedcache"
+	"golang.org/x/sync/singleflight"
+)
+
+// cachedResolver caches the identities resolved by another resolver for a TTL,
+// subjects without identity are cached as well while errors are not. Concurrent
+// lookups of a subject missing from the cache share a single lookup, so that a
+// burst of pod creations, e.g. a node drain, doesn't flood the backend.
+type cachedResolver struct {
+	next UIDResolver
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	lookups singleflight.Group
+
+	// shared caches the identities for the other webhook replicas too under keys
+	// prefixed by sharedPrefix, nil keeps them local
+	shared       sharedcache.Cache
+	sharedPrefix string
+}
+
+// sharedEntry is a resolved identity stored in the shared cache
+type sharedEntry struct {
+	Identity IdentitySpec `json:"identity"`
+	NotFound bool         `json:"notFound,omitempty"`
+}
+
+// cacheEntry is a resolved identity and its expiration time
+type cacheEntry struct {
+	identity IdentitySpec
+	notFound bool
+	expires  time.Time
+}
+
+// leasedResolver is implemented by resolvers whose results carry their own
+// lifetime, e.g. Vault leases. A zero lease falls back to the cache TTL.
+type leasedResolver interface {
+	resolveLeased(ctx context.Context, subject string) (IdentitySpec, time.Duration, error)
+}
+
+// cachedResolver implements the UIDResolver interface
+var _ UIDResolver = (*cachedResolver)(nil)
+
+// newCachedResolver wraps next with a cache, a zero ttl disables caching but
+// concurrent lookups of a subject are still shared
+func newCachedResolver(next UIDResolver, ttl time.Duration) UIDResolver {
+	return &cachedResolver{
+		next:    next,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[string]cacheEntry{},
+	}
+}
+
+// Resolve returns the cached identity of subject, resolving it on cache misses.
+// The shared lookup of a subject isn't canceled with the context of the request
+// that started it, the others still wait for it, but every request stops waiting
+// when its own context is done.
+func (c *cachedResolver) Resolve(ctx context.Context, subject string) (IdentitySpec, error) {
+	if c.ttl > 0 {
+		c.mu.Lock()
+		entry, ok := c.entries[subject]
+		c.mu.Unlock()
+		if ok && c.now().Before(entry.expires) {
+			metrics.ObserveCache(true)
+			if entry.notFound {
+				return IdentitySpec{}, ErrNotFound
+			}
+			return entry.identity, nil
+		}
+	}
+
+	var leader bool
+	ch := c.lookups.DoChan(subject, func() (interface{}, error) {
+		leader = true
+		return c.resolve(context.WithoutCancel(ctx), subject)
+	})
+	select {
+	case <-ctx.Done():
+		return IdentitySpec{}, ctx.Err()
+	case res := <-ch:
+		if c.ttl > 0 {
+			if leader {
+				metrics.ObserveCache(false)
+			} else {
+				metrics.ObserveSharedLookup()
+			}
+		}
+		identity, _ := res.Val.(IdentitySpec)
+		return identity, res.Err
+	}
+}
+
+// cache wraps the backend next with a cache expiring after ttl, shared with the
+// other webhook replicas when a shared cache is set
+func (o Options) cache(backend string, next UIDResolver, ttl time.Duration) UIDResolver {
+	c := newCachedResolver(next, ttl).(*cachedResolver)
+	if o.SharedCache != nil && ttl > 0 {
+		c.shared, c.sharedPrefix = o.SharedCache, "identity:"+backend+":"
+	}
+	return c
+}
+
+// resolve resolves the identity of subject from the shared cache or with the next
+// resolver, and caches it
+func (c *cachedResolver) resolve(ctx context.Context, subject string) (IdentitySpec, error) {
+	now := c.now()
+	if c.shared != nil {
+		if entry, found := c.sharedGet(ctx, subject); found {
+			c.mu.Lock()
+			c.entries[subject] = cacheEntry{identity: entry.Identity, notFound: entry.NotFound, expires: now.Add(c.ttl)}
+			c.mu.Unlock()
+			if entry.NotFound {
+				return IdentitySpec{}, ErrNotFound
+			}
+			return entry.Identity, nil
+		}
+	}
+
+	ttl := c.ttl
+	var identity IdentitySpec
+	var err error
+	if leased, ok := c.next.(leasedResolver); ok {
+		var lease time.Duration
+		identity, lease, err = leased.resolveLeased(ctx, subject)
+		if lease > 0 && lease < ttl {
+			ttl = lease
+		}
+	} else {
+		identity, err = c.next.Resolve(ctx, subject)
+	}
+	notFound := errors.Is(err, ErrNotFound)
+	if err != nil && !notFound || ttl <= 0 {
+		return identity, err
+	}
+
+	c.mu.Lock()
+	c.entries[subject] = cacheEntry{identity: identity, notFound: notFound, expires: now.Add(ttl)}
+	c.mu.Unlock()
+	if c.shared != nil {
+		c.sharedSet(ctx, subject, sharedEntry{Identity: identity, NotFound: notFound}, ttl)
+	}
+	return identity, err
+}
+
+// sharedGet returns the identity of subject from the shared cache, found is false
+// if it is missing or the shared cache is unavailable
+func (c *cachedResolver) sharedGet(ctx context.Context, subject string) (entry sharedEntry, found bool) {
+	value, found, err := c.shared.Get(ctx, c.sharedPrefix+subject)
+	if err != nil {
+		logrus.Debugf("Error getting identity of %s from the shared cache: %s", subject, err)
+		return entry, false
+	}
+	if !found {
+		return entry, false
+	}
+	if err := json.Unmarshal(value, &entry); err != nil {
+		logrus.Debugf("Error decoding identity of %s from the shared cache: %s", subject, err)
+		return entry, false
+	}
+	return entry, true
+}
+
+// sharedSet stores the identity of subject in the shared cache for ttl
+func (c *cachedResolver) sharedSet(ctx context.Context, subject string, entry sharedEntry, ttl time.Duration) {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := c.shared.Set(ctx, c.sharedPrefix+subject, value, ttl); err != nil {
+		logrus.Debugf("Error storing identity of %s in the shared cache: %s", subject, err)
+	}
+}
+
+// CachedIdentity is an identity held by the cache of a backend
+type CachedIdentity struct {
+	Subject  string       `json:"subject"`
+	Identity IdentitySpec `json:"identity"`
+	NotFound bool         `json:"notFound,omitempty"`
+	Expires  time.Time    `json:"expires"`
+}
+
+// wrapper is implemented by the resolvers wrapping another one
+type wrapper interface {
+	unwrap() UIDResolver
+}
+
+// CachedIdentities returns the unexpired identities cached by the backend of r,
+// sorted by subject, none when its backend has no cache
+func CachedIdentities(r UIDResolver) []CachedIdentity {
+	for {
+		if c, ok := r.(*cachedResolver); ok {
+			return c.cached()
+		}
+		w, ok := r.(wrapper)
+		if !ok {
+			return nil
+		}
+		r = w.unwrap()
+	}
+}
+
+// cached returns the unexpired entries of the cache sorted by subject
+func (c *cachedResolver) cached() []CachedIdentity {
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	identities := make([]CachedIdentity, 0, len(c.entries))
+	for subject, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			continue
+		}
+		identities = append(identities, CachedIdentity{Subject: subject, Identity: entry.identity, NotFound: entry.notFound, Expires: entry.expires})
+	}
+	sort.Slice(identities, func(i, j int) bool { return identities[i].Subject < identities[j].Subject })
+	return identities
+}
@@ -0,0 +1,211 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingResolver counts the lookups of subjects
+type countingResolver struct {
+	calls int
+	err   error
+}
+
+func (c *countingResolver) Resolve(_ context.Context, subject string) (IdentitySpec, error) {
+	c.calls++
+	if c.err != nil {
+		return IdentitySpec{}, c.err
+	}
+	if subject != "user1" {
+		return IdentitySpec{}, ErrNotFound
+	}
+	uid := int64(1001)
+	return IdentitySpec{UID: &uid}, nil
+}
+
+func TestCachedResolver(t *testing.T) {
+	next := &countingResolver{}
+	now := time.Now()
+	c := newCachedResolver(next, time.Minute).(*cachedResolver)
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		id, err := c.Resolve(context.Background(), "user1")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1001), *id.UID)
+
+		_, err = c.Resolve(context.Background(), "user2")
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+	assert.Equal(t, 2, next.calls)
+
+	// entries expire after the TTL
+	now = now.Add(2 * time.Minute)
+	_, err := c.Resolve(context.Background(), "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, next.calls)
+
+	// errors are not cached
+	next.err = errors.New("unreachable")
+	now = now.Add(2 * time.Minute)
+	for i := 0; i < 2; i++ {
+		_, err = c.Resolve(context.Background(), "user1")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 5, next.calls)
+}
+
+// leasedCountingResolver is a countingResolver returning a lease with its results
+type leasedCountingResolver struct {
+	countingResolver
+	lease time.Duration
+}
+
+func (l *leasedCountingResolver) resolveLeased(ctx context.Context, subject string) (IdentitySpec, time.Duration, error) {
+	id, err := l.Resolve(ctx, subject)
+	return id, l.lease, err
+}
+
+func TestCachedResolverLease(t *testing.T) {
+	next := &leasedCountingResolver{lease: 10 * time.Second}
+	now := time.Now()
+	c := newCachedResolver(next, time.Minute).(*cachedResolver)
+	c.now = func() time.Time { return now }
+
+	_, err := c.Resolve(context.Background(), "user1")
+	assert.NoError(t, err)
+
+	// entries expire with their lease when it is shorter than the TTL
+	now = now.Add(5 * time.Second)
+	_, err = c.Resolve(context.Background(), "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, next.calls)
+
+	now = now.Add(10 * time.Second)
+	_, err = c.Resolve(context.Background(), "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, next.calls)
+}
+
+// blockingResolver counts the lookups of subjects, each blocking until release is closed
+type blockingResolver struct {
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (b *blockingResolver) Resolve(ctx context.Context, _ string) (IdentitySpec, error) {
+	b.calls.Add(1)
+	<-b.release
+	uid := int64(1001)
+	return IdentitySpec{UID: &uid}, nil
+}
+
+func TestCachedResolverSharedLookups(t *testing.T) {
+	for _, ttl := range []time.Duration{time.Minute, 0} {
+		next := &blockingResolver{release: make(chan struct{})}
+		c := newCachedResolver(next, ttl)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				id, err := c.Resolve(context.Background(), "user1")
+				assert.NoError(t, err)
+				assert.Equal(t, int64(1001), *id.UID)
+			}()
+		}
+		// let the requests join the lookup of the first one
+		time.Sleep(100 * time.Millisecond)
+		close(next.release)
+		wg.Wait()
+		assert.Equal(t, int32(1), next.calls.Load(), ttl)
+	}
+
+	// requests stop waiting for the shared lookup when their context is done
+	next := &blockingResolver{release: make(chan struct{})}
+	defer close(next.release)
+	c := newCachedResolver(next, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := c.Resolve(ctx, "user1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// mapCache is a shared cache in memory, ignoring TTLs
+type mapCache struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+}
+
+func (m *mapCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.entries[key]
+	return value, ok, nil
+}
+
+func (m *mapCache) Set(_ context.Context, key string, value []byte, _ time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = value
+	return nil
+}
+
+func TestCachedResolverSharedCache(t *testing.T) {
+	shared := &mapCache{entries: map[string][]byte{}}
+	opts := Options{SharedCache: shared}
+	// two replicas of the same backend
+	first, second := &countingResolver{}, &countingResolver{}
+	a := opts.cache("rest", first, time.Minute)
+	b := opts.cache("rest", second, time.Minute)
+
+	id, err := a.Resolve(context.Background(), "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1001), *id.UID)
+	_, err = a.Resolve(context.Background(), "user2")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, 2, first.calls)
+	assert.Contains(t, shared.entries, "identity:rest:user1")
+
+	// the second replica reads the identities resolved by the first one
+	id, err = b.Resolve(context.Background(), "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1001), *id.UID)
+	_, err = b.Resolve(context.Background(), "user2")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, 0, second.calls)
+
+	// errors are not shared
+	first.err = errors.New("unreachable")
+	_, err = a.Resolve(context.Background(), "user3")
+	assert.Error(t, err)
+	assert.NotContains(t, shared.entries, "identity:rest:user3")
+}
+
+func TestCachedIdentities(t *testing.T) {
+	now := time.Now()
+	c := newCachedResolver(&countingResolver{}, time.Minute).(*cachedResolver)
+	c.now = func() time.Time { return now }
+	r := NewRetryResolver(&instrumentedResolver{backend: "ldap", next: c}, 1, time.Millisecond)
+
+	_, _ = r.Resolve(context.Background(), "user2")
+	_, _ = r.Resolve(context.Background(), "user1")
+	identities := CachedIdentities(NewCircuitBreaker(r, time.Minute))
+	if assert.Len(t, identities, 2) {
+		assert.Equal(t, "user1", identities[0].Subject)
+		assert.Equal(t, int64(1001), *identities[0].Identity.UID)
+		assert.Equal(t, now.Add(time.Minute), identities[0].Expires)
+		assert.True(t, identities[1].NotFound)
+	}
+
+	now = now.Add(2 * time.Minute)
+	assert.Empty(t, CachedIdentities(r), "expired identities are left out")
+	assert.Nil(t, CachedIdentities(&countingResolver{}))
+}
@@ -0,0 +1,66 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+)
+
+func init() {
+	Register("configmap", newConfigMapResolver)
+}
+
+// configMapResolver resolves identities from the mapping ConfigMaps, or from
+// UIDMapping resources when they are enabled
+type configMapResolver struct {
+	mappings *mapping.Store
+}
+
+// configMapResolver implements the UIDResolver and namespacedResolver interfaces
+var (
+	_ UIDResolver        = (*configMapResolver)(nil)
+	_ namespacedResolver = (*configMapResolver)(nil)
+)
+
+// newConfigMapResolver returns a configMapResolver reading from opts.Mappings
+func newConfigMapResolver(opts Options) (UIDResolver, error) {
+	if opts.Mappings == nil {
+		return nil, fmt.Errorf("configmap backend requires the mapping cache")
+	}
+	return &configMapResolver{mappings: opts.Mappings}, nil
+}
+
+// Resolve returns the UIDs and GIDs mapped to subject
+func (c *configMapResolver) Resolve(ctx context.Context, subject string) (IdentitySpec, error) {
+	return c.resolveInNamespace(ctx, "", subject)
+}
+
+// resolveInNamespace returns the UIDs and GIDs mapped to subject, taking the
+// mapping objects of namespace into account when namespace mappings are enabled
+func (c *configMapResolver) resolveInNamespace(_ context.Context, namespace, subject string) (IdentitySpec, error) {
+	var id IdentitySpec
+
+	uids, found, err := c.mappings.NamespaceUIDs(namespace, subject)
+	if err != nil {
+		return id, err
+	}
+	if found {
+		uid := uids[0].Min
+		id.UID = &uid
+		id.UIDs = uids
+	}
+
+	gids, found, err := c.mappings.NamespaceGIDs(namespace, subject)
+	if err != nil {
+		return id, err
+	}
+	if found {
+		id.GIDs = gids
+	}
+
+	if id.UID == nil && len(id.GIDs) == 0 {
+		return id, ErrNotFound
+	}
+	return id, nil
+}
@@ -0,0 +1,68 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+)
+
+// NamespaceDefaults returns the identity of the subjects without a mapping
+// creating pods in a namespace
+type NamespaceDefaults interface {
+	NamespaceDefault(namespace string) (uids mapping.IDRanges, gids []int64, found bool, err error)
+}
+
+// namespaceDefaultResolver resolves the subjects unknown to a backend to the
+// default identity of the namespace of the pod, group subjects excluded so that
+// the mapping of the user itself is still looked up
+type namespaceDefaultResolver struct {
+	next     UIDResolver
+	defaults NamespaceDefaults
+}
+
+// namespaceDefaultResolver implements the UIDResolver and namespacedResolver interfaces
+var (
+	_ UIDResolver        = (*namespaceDefaultResolver)(nil)
+	_ namespacedResolver = (*namespaceDefaultResolver)(nil)
+)
+
+// NewNamespaceDefaultResolver returns a resolver falling back to the namespace
+// defaults of defaults for the subjects next has no identity for
+func NewNamespaceDefaultResolver(next UIDResolver, defaults NamespaceDefaults) UIDResolver {
+	return &namespaceDefaultResolver{next: next, defaults: defaults}
+}
+
+// Resolve resolves subject with the backend, no namespace default applies
+func (n *namespaceDefaultResolver) Resolve(ctx context.Context, subject string) (IdentitySpec, error) {
+	return n.next.Resolve(ctx, subject)
+}
+
+// resolveInNamespace resolves subject with the backend, falling back to the
+// default identity of namespace
+func (n *namespaceDefaultResolver) resolveInNamespace(ctx context.Context, namespace, subject string) (IdentitySpec, error) {
+	id, err := resolveInNamespace(ctx, n.next, namespace, subject)
+	if !errors.Is(err, ErrNotFound) || namespace == "" || strings.HasPrefix(subject, GroupSubjectPrefix) {
+		return id, err
+	}
+
+	uids, gids, found, derr := n.defaults.NamespaceDefault(namespace)
+	if derr != nil {
+		return id, derr
+	}
+	if !found {
+		return id, err
+	}
+	id = IdentitySpec{UIDs: uids, GIDs: gids}
+	if len(uids) > 0 {
+		uid := uids[0].Min
+		id.UID = &uid
+	}
+	return id, nil
+}
+
+// unwrap returns the wrapped resolver
+func (n *namespaceDefaultResolver) unwrap() UIDResolver {
+	return n.next
+}
@@ -0,0 +1,56 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+)
+
+// staticDefaults holds the default identity of namespaces, malformed ones fail
+type staticDefaults map[string]IdentitySpec
+
+func (s staticDefaults) NamespaceDefault(namespace string) (mapping.IDRanges, []int64, bool, error) {
+	if namespace == "malformed" {
+		return nil, nil, false, fmt.Errorf("invalid annotation")
+	}
+	id, found := s[namespace]
+	return id.UIDs, id.GIDs, found, nil
+}
+
+func TestNamespaceDefaultResolver(t *testing.T) {
+	uid := func(i int64) *int64 { return &i }
+	r := NewNamespaceDefaultResolver(mapResolver{
+		"builder":      {UID: uid(1001), GIDs: []int64{1001}},
+		"group.eng-ml": {UID: uid(4000), GIDs: []int64{4000}},
+	}, staticDefaults{
+		"team-a": {UIDs: mapping.IDRanges{{Min: 3000, Max: 3099}}, GIDs: []int64{3000}},
+	})
+
+	// explicit mappings take precedence
+	id, err := ResolveUser(context.Background(), r, "team-a", "builder", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1001), *id.UID)
+	id, err = ResolveUser(context.Background(), r, "team-a", "alice", []string{"eng-ml"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4000), *id.UID)
+
+	// unmapped subjects get the namespace default, even with unmapped groups
+	id, err = ResolveUser(context.Background(), r, "team-a", "runner", []string{"unmapped"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3000), *id.UID)
+	assert.Equal(t, mapping.IDRanges{{Min: 3000, Max: 3099}}, id.AllowedUIDs())
+	assert.Equal(t, []int64{3000}, id.GIDs)
+
+	// namespaces without defaults and lookups without namespace are not defaulted
+	_, err = ResolveUser(context.Background(), r, "team-b", "runner", nil)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = r.Resolve(context.Background(), "runner")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = ResolveUser(context.Background(), r, "malformed", "runner", nil)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,79 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+)
+
+// GroupSubjectPrefix prefixes the subjects of group mappings, e.g. group.eng-data
+// maps the members of the eng-data group. A dot is used since ConfigMap keys
+// cannot contain colons.
+const GroupSubjectPrefix = "group."
+
+// namespacedResolver is implemented by resolvers whose mappings can be scoped to
+// the namespace of the pod
+type namespacedResolver interface {
+	resolveInNamespace(ctx context.Context, namespace, subject string) (IdentitySpec, error)
+}
+
+// ResolveUser resolves the identity of a user creating a pod in namespace through
+// the mappings of its groups, falling back to the mapping of the user itself when
+// none of its groups is mapped. The identities of every mapped group are merged,
+// UID is the one of the first mapped group in groups order.
+func ResolveUser(ctx context.Context, r UIDResolver, namespace, user string, groups []string) (IdentitySpec, error) {
+	var merged IdentitySpec
+	for _, group := range groups {
+		id, err := resolveInNamespace(ctx, r, namespace, GroupSubjectPrefix+group)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return IdentitySpec{}, err
+		}
+		merged = mergeIdentities(merged, id)
+	}
+	if merged.UID != nil || len(merged.GIDs) > 0 {
+		return merged, nil
+	}
+	return resolveInNamespace(ctx, r, namespace, user)
+}
+
+// resolveInNamespace resolves subject with the namespace mappings of r if any,
+// the other resolvers resolve serviceAccounts by name
+func resolveInNamespace(ctx context.Context, r UIDResolver, namespace, subject string) (IdentitySpec, error) {
+	if n, ok := r.(namespacedResolver); ok {
+		return n.resolveInNamespace(ctx, namespace, subject)
+	}
+	return r.Resolve(ctx, mapping.SubjectName(subject))
+}
+
+// mergeIdentities returns the union of the UIDs and GIDs of a and b, the UID of a
+// takes precedence
+func mergeIdentities(a, b IdentitySpec) IdentitySpec {
+	merged := IdentitySpec{UID: a.UID}
+	if merged.UID == nil {
+		merged.UID = b.UID
+	}
+	merged.UIDs = append(append(merged.UIDs, a.AllowedUIDs()...), b.AllowedUIDs()...)
+
+	for _, gids := range [][]int64{a.GIDs, b.GIDs} {
+		for _, gid := range gids {
+			if !containsGID(merged.GIDs, gid) {
+				merged.GIDs = append(merged.GIDs, gid)
+			}
+		}
+	}
+	return merged
+}
+
+// containsGID returns true if gid is part of gids
+func containsGID(gids []int64, gid int64) bool {
+	for _, g := range gids {
+		if g == gid {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package resolver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+)
+
+// mapResolver resolves identities from a map
+type mapResolver map[string]IdentitySpec
+
+func (m mapResolver) Resolve(_ context.Context, subject string) (IdentitySpec, error) {
+	id, ok := m[subject]
+	if !ok {
+		return id, ErrNotFound
+	}
+	return id, nil
+}
+
+func TestResolveUser(t *testing.T) {
+	uid := func(i int64) *int64 { return &i }
+	r := mapResolver{
+		"group.eng-data": {UID: uid(3000), UIDs: mapping.IDRanges{{Min: 3000, Max: 3099}}, GIDs: []int64{3000}},
+		"group.eng-ml":   {UID: uid(4000), GIDs: []int64{3000, 4000}},
+		"alice":          {UID: uid(1001), GIDs: []int64{1001}},
+	}
+
+	// identities of every mapped group are merged
+	id, err := ResolveUser(context.Background(), r, "default", "alice", []string{"eng-data", "unmapped", "eng-ml"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3000), *id.UID)
+	assert.Equal(t, mapping.IDRanges{{Min: 3000, Max: 3099}, {Min: 4000, Max: 4000}}, id.AllowedUIDs())
+	assert.Equal(t, []int64{3000, 4000}, id.GIDs)
+
+	// users without mapped groups fall back to their own mapping
+	id, err = ResolveUser(context.Background(), r, "default", "alice", []string{"unmapped"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1001), *id.UID)
+
+	_, err = ResolveUser(context.Background(), r, "default", "bob", nil)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
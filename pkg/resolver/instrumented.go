@@ -0,0 +1,69 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/tensorchord/nfs-pod-access-control/pkg/metrics"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentedResolver records the latency and result of the lookups of a backend,
+// as metrics and as spans
+type instrumentedResolver struct {
+	backend string
+	next    UIDResolver
+}
+
+// instrumentedResolver implements the UIDResolver and namespacedResolver interfaces
+var (
+	_ UIDResolver        = (*instrumentedResolver)(nil)
+	_ namespacedResolver = (*instrumentedResolver)(nil)
+)
+
+// Resolve resolves subject with the backend
+func (i *instrumentedResolver) Resolve(ctx context.Context, subject string) (IdentitySpec, error) {
+	return i.resolveInNamespace(ctx, "", subject)
+}
+
+// resolveInNamespace resolves subject with the namespace mappings of the backend if any
+func (i *instrumentedResolver) resolveInNamespace(ctx context.Context, namespace, subject string) (IdentitySpec, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "resolve "+i.backend, trace.WithAttributes(
+		attribute.String("nfs.backend", i.backend),
+		attribute.String("nfs.subject", subject),
+		attribute.String("nfs.namespace", namespace),
+	))
+	defer span.End()
+
+	start := time.Now()
+	id, err := resolveInNamespace(ctx, i.next, namespace, subject)
+	result := lookupResult(err)
+	metrics.ObserveLookup(i.backend, result, start)
+
+	span.SetAttributes(attribute.String("nfs.result", result))
+	if result == metrics.ResultError {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return id, err
+}
+
+// lookupResult returns the metrics result of a lookup returning err
+func lookupResult(err error) string {
+	switch {
+	case err == nil:
+		return metrics.ResultFound
+	case errors.Is(err, ErrNotFound):
+		return metrics.ResultNotFound
+	}
+	return metrics.ResultError
+}
+
+// unwrap returns the wrapped resolver
+func (i *instrumentedResolver) unwrap() UIDResolver {
+	return i.next
+}
@@ -0,0 +1,180 @@
+package resolver
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+func init() {
+	Register("ldap", newLDAPResolver)
+}
+
+// ldapResolver resolves identities from posixAccount entries of an LDAP or
+// Active Directory server
+type ldapResolver struct {
+	url        string
+	baseDN     string
+	filter     string
+	uidAttr    string
+	gidAttr    string
+	groupsAttr string
+	startTLS   bool
+	tlsConfig  *tls.Config
+	timeout    time.Duration
+
+	// bind credentials are read from a Secret in the webhook namespace
+	client     kubernetes.Interface
+	namespace  string
+	bindSecret string
+}
+
+// ldapResolver implements the UIDResolver interface
+var _ UIDResolver = (*ldapResolver)(nil)
+
+// newLDAPResolver returns an ldapResolver configured by the LDAP_* settings,
+// wrapped in a cache expiring after LDAP_CACHE_TTL
+func newLDAPResolver(opts Options) (UIDResolver, error) {
+	l := &ldapResolver{
+		url:        opts.setting("LDAP_URL", ""),
+		baseDN:     opts.setting("LDAP_BASE_DN", ""),
+		filter:     opts.setting("LDAP_USER_FILTER", "(&(objectClass=posixAccount)(uid=%s))"),
+		uidAttr:    opts.setting("LDAP_UID_ATTRIBUTE", "uidNumber"),
+		gidAttr:    opts.setting("LDAP_GID_ATTRIBUTE", "gidNumber"),
+		groupsAttr: opts.setting("LDAP_GROUPS_ATTRIBUTE", ""),
+		client:     opts.Client,
+		namespace:  opts.Namespace,
+		bindSecret: opts.setting("LDAP_BIND_SECRET", ""),
+	}
+	if l.url == "" || l.baseDN == "" {
+		return nil, fmt.Errorf("ldap backend requires LDAP_URL and LDAP_BASE_DN")
+	}
+	if l.bindSecret != "" && l.client == nil {
+		return nil, fmt.Errorf("ldap backend requires a Kubernetes client to read LDAP_BIND_SECRET")
+	}
+
+	var err error
+	if l.startTLS, err = opts.boolSetting("LDAP_START_TLS", false); err != nil {
+		return nil, err
+	}
+	if l.tlsConfig, err = opts.tlsConfig("LDAP"); err != nil {
+		return nil, err
+	}
+	if l.timeout, err = opts.durationSetting("LDAP_TIMEOUT", 5*time.Second); err != nil {
+		return nil, err
+	}
+	ttl, err := opts.durationSetting("LDAP_CACHE_TTL", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	return opts.cache("ldap", l, ttl), nil
+}
+
+// Resolve searches the posixAccount entry of subject and returns its uidNumber
+// and gidNumber, plus the GIDs found in LDAP_GROUPS_ATTRIBUTE if set. The search
+// times out after LDAP_TIMEOUT or at the deadline of ctx, whichever comes first.
+func (l *ldapResolver) Resolve(ctx context.Context, subject string) (IdentitySpec, error) {
+	timeout := l.timeout
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+	if timeout <= 0 {
+		return IdentitySpec{}, fmt.Errorf("LDAP search not attempted: %w", context.DeadlineExceeded)
+	}
+	conn, err := l.connect(ctx, timeout)
+	if err != nil {
+		return IdentitySpec{}, err
+	}
+	defer conn.Close()
+
+	attributes := []string{l.uidAttr, l.gidAttr}
+	if l.groupsAttr != "" {
+		attributes = append(attributes, l.groupsAttr)
+	}
+	req := ldap.NewSearchRequest(
+		l.baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(timeout.Seconds()), false,
+		fmt.Sprintf(l.filter, ldap.EscapeFilter(subject)), attributes, nil,
+	)
+	res, err := conn.Search(req)
+	if err != nil {
+		return IdentitySpec{}, fmt.Errorf("LDAP search failed: %w", err)
+	}
+	if len(res.Entries) == 0 {
+		return IdentitySpec{}, ErrNotFound
+	}
+	if len(res.Entries) > 1 {
+		return IdentitySpec{}, fmt.Errorf("LDAP search returned several entries for %s", subject)
+	}
+	return l.identity(res.Entries[0])
+}
+
+// identity converts an LDAP entry into an IdentitySpec
+func (l *ldapResolver) identity(entry *ldap.Entry) (IdentitySpec, error) {
+	var id IdentitySpec
+
+	if v := entry.GetAttributeValue(l.uidAttr); v != "" {
+		uid, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return id, fmt.Errorf("invalid %s %q of %s: %v", l.uidAttr, v, entry.DN, err)
+		}
+		id.UID = &uid
+	}
+
+	values := []string{entry.GetAttributeValue(l.gidAttr)}
+	if l.groupsAttr != "" {
+		values = append(values, entry.GetAttributeValues(l.groupsAttr)...)
+	}
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		gid, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return id, fmt.Errorf("invalid GID %q of %s: %v", v, entry.DN, err)
+		}
+		id.GIDs = append(id.GIDs, gid)
+	}
+
+	if id.UID == nil && len(id.GIDs) == 0 {
+		return id, ErrNotFound
+	}
+	return id, nil
+}
+
+// connect dials the LDAP server and binds with the credentials of the bind Secret,
+// every operation of the connection times out after timeout
+func (l *ldapResolver) connect(ctx context.Context, timeout time.Duration) (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(l.url, ldap.DialWithTLSConfig(l.tlsConfig), ldap.DialWithDialer(&net.Dialer{Timeout: timeout}))
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to LDAP server: %w", err)
+	}
+	conn.SetTimeout(timeout)
+
+	if l.startTLS {
+		if err := conn.StartTLS(l.tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP StartTLS failed: %w", err)
+		}
+	}
+
+	if l.bindSecret == "" {
+		return conn, nil
+	}
+	secret, err := l.client.CoreV1().Secrets(l.namespace).Get(ctx, l.bindSecret, metav1.GetOptions{})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("cannot read LDAP bind Secret: %w", err)
+	}
+	if err := conn.Bind(string(secret.Data["username"]), string(secret.Data["password"])); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("LDAP bind failed: %w", err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,104 @@
+// Package resolver resolves the NFS identity of users and serviceAccounts,
+// backends are registered by name and selected through the webhook settings
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/sharedcache"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ErrNotFound is returned by resolvers when a subject has no identity mapped to it
+var ErrNotFound = errors.New("no identity associated with subject")
+
+// IdentitySpec is the NFS identity mapped to a subject
+type IdentitySpec struct {
+	// UID is the runAsUser injected for the subject, nil if the subject has no UID
+	UID *int64
+	// UIDs are the runAsUser values the subject may use, only UID when empty
+	UIDs mapping.IDRanges
+	// GIDs are the groups the subject may use as runAsGroup, fsGroup and supplementalGroups
+	GIDs []int64
+}
+
+// AllowedUIDs returns the runAsUser values the subject may use
+func (i IdentitySpec) AllowedUIDs() mapping.IDRanges {
+	if len(i.UIDs) == 0 && i.UID != nil {
+		return mapping.SingleID(*i.UID)
+	}
+	return i.UIDs
+}
+
+// UIDResolver resolves the identity of a subject, a user or serviceAccount name
+type UIDResolver interface {
+	Resolve(ctx context.Context, subject string) (IdentitySpec, error)
+}
+
+// Options are the dependencies and settings passed to backend factories
+type Options struct {
+	// Mappings is the informer cache of the mapping ConfigMaps and UIDMappings
+	Mappings *mapping.Store
+	// Client is the Kubernetes client of the webhook
+	Client kubernetes.Interface
+	// Namespace is the namespace of the webhook
+	Namespace string
+	// Getenv returns backend specific settings by name, e.g. LDAP_URL
+	Getenv func(string) string
+	// SharedCache shares the identities cached by the ldap, rest and vault backends
+	// with the other webhook replicas, nil keeps them local
+	SharedCache sharedcache.Cache
+}
+
+// Factory creates a backend from the given options
+type Factory func(opts Options) (UIDResolver, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes a backend available by name, it panics if name is already taken
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("resolver backend %q registered twice", name))
+	}
+	registry[name] = factory
+}
+
+// New creates the backend registered with name
+func New(name string, opts Options) (UIDResolver, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown resolver backend %q, available: %v", name, Backends())
+	}
+	r, err := factory(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedResolver{backend: name, next: r}, nil
+}
+
+// Backends returns the names of the registered backends
+func Backends() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,17 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New("configmap", Options{})
+	assert.Error(t, err, "configmap backend requires the mapping cache")
+
+	_, err = New("unknown", Options{})
+	assert.Error(t, err)
+
+	assert.Contains(t, Backends(), "configmap")
+}
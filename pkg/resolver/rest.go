@@ -0,0 +1,149 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+)
+
+func init() {
+	Register("rest", newRESTResolver)
+}
+
+// restResolver resolves identities by calling an external identity service,
+// GET <REST_URL>/identity/<subject> is expected to answer with
+// {"uid": 1001, "gids": [1001, 3000]} or 404 when the subject is unknown.
+// Subjects allowed to use several UIDs are answered with UID ranges instead of
+// uid, e.g. {"uids": "1000-1999,2500"}.
+type restResolver struct {
+	baseURL   string
+	client    *http.Client
+	retries   int
+	backoff   time.Duration
+	tokenFile string
+}
+
+// restIdentity is the body returned by the identity service
+type restIdentity struct {
+	UID  *int64  `json:"uid"`
+	UIDs string  `json:"uids"`
+	GIDs []int64 `json:"gids"`
+}
+
+// restResolver implements the UIDResolver interface
+var _ UIDResolver = (*restResolver)(nil)
+
+// newRESTResolver returns a restResolver configured by the REST_* settings,
+// wrapped in a cache expiring after REST_CACHE_TTL
+func newRESTResolver(opts Options) (UIDResolver, error) {
+	r := &restResolver{
+		baseURL:   strings.TrimSuffix(opts.setting("REST_URL", ""), "/"),
+		tokenFile: opts.setting("REST_BEARER_TOKEN_FILE", ""),
+	}
+	if r.baseURL == "" {
+		return nil, fmt.Errorf("rest backend requires REST_URL")
+	}
+
+	timeout, err := opts.durationSetting("REST_TIMEOUT", 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := opts.tlsConfig("REST")
+	if err != nil {
+		return nil, err
+	}
+	r.client = &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+	}
+
+	if r.retries, err = opts.intSetting("REST_RETRIES", 3); err != nil {
+		return nil, err
+	}
+	if r.backoff, err = opts.durationSetting("REST_RETRY_BACKOFF", 100*time.Millisecond); err != nil {
+		return nil, err
+	}
+	ttl, err := opts.durationSetting("REST_CACHE_TTL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	return opts.cache("rest", r, ttl), nil
+}
+
+// Resolve fetches the identity of subject, retrying with exponential backoff on
+// network errors, 429 and 5xx answers
+func (r *restResolver) Resolve(ctx context.Context, subject string) (IdentitySpec, error) {
+	backoff := r.backoff
+	for attempt := 0; ; attempt++ {
+		id, retry, err := r.fetch(ctx, subject)
+		if err == nil || !retry || attempt >= r.retries {
+			return id, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return IdentitySpec{}, fmt.Errorf("%v (giving up: %v)", err, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// fetch performs a single identity request, retry is true if the error is transient
+func (r *restResolver) fetch(ctx context.Context, subject string) (id IdentitySpec, retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.baseURL+"/identity/"+url.PathEscape(subject), nil)
+	if err != nil {
+		return id, false, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	if r.tokenFile != "" {
+		// the token is read on every request so that rotated tokens are picked up
+		token, err := os.ReadFile(r.tokenFile)
+		if err != nil {
+			return id, false, fmt.Errorf("cannot read REST_BEARER_TOKEN_FILE: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return id, true, fmt.Errorf("identity request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return id, false, ErrNotFound
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500:
+		return id, true, fmt.Errorf("identity service answered %s", res.Status)
+	case res.StatusCode != http.StatusOK:
+		return id, false, fmt.Errorf("identity service answered %s", res.Status)
+	}
+
+	var body restIdentity
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&body); err != nil {
+		return id, false, fmt.Errorf("cannot decode identity of %s: %v", subject, err)
+	}
+	id = IdentitySpec{UID: body.UID, GIDs: body.GIDs}
+	if body.UIDs != "" {
+		if id.UIDs, err = mapping.ParseIDRanges(body.UIDs); err != nil {
+			return IdentitySpec{}, false, fmt.Errorf("invalid uids of %s: %v", subject, err)
+		}
+		if id.UID == nil {
+			id.UID = &id.UIDs[0].Min
+		}
+	}
+	if id.UID == nil && len(id.GIDs) == 0 {
+		return id, false, ErrNotFound
+	}
+	return id, false, nil
+}
@@ -0,0 +1,61 @@
+package resolver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRESTResolver(t *testing.T) {
+	failures := 2
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+		switch r.URL.Path {
+		case "/identity/flaky":
+			if failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{"uid": 1002}`))
+		case "/identity/user1":
+			w.Write([]byte(`{"uid": 1001, "gids": [1001, 3000]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	settings := map[string]string{
+		"REST_URL":               srv.URL,
+		"REST_BEARER_TOKEN_FILE": tokenFile,
+		"REST_RETRY_BACKOFF":     "1ms",
+		"REST_CACHE_TTL":         "0s",
+	}
+	r, err := New("rest", Options{Getenv: func(k string) string { return settings[k] }})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := r.Resolve(context.Background(), "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1001), *id.UID)
+	assert.Equal(t, []int64{1001, 3000}, id.GIDs)
+
+	id, err = r.Resolve(context.Background(), "flaky")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1002), *id.UID)
+
+	_, err = r.Resolve(context.Background(), "user2")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
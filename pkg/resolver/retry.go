@@ -0,0 +1,73 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/retry"
+)
+
+// retryResolver retries the lookups of another resolver failing with a transient
+// error, within the deadline of the admission request
+type retryResolver struct {
+	next    UIDResolver
+	backoff retry.Backoff
+}
+
+// retryResolver implements the UIDResolver and namespacedResolver interfaces
+var (
+	_ UIDResolver        = (*retryResolver)(nil)
+	_ namespacedResolver = (*retryResolver)(nil)
+)
+
+// NewRetryResolver wraps next so that lookups failing with a transient error are
+// retried up to retries times, after delay then twice as long after each retry.
+// retries <= 0 returns next unchanged.
+func NewRetryResolver(next UIDResolver, retries int, delay time.Duration) UIDResolver {
+	if retries <= 0 {
+		return next
+	}
+	return &retryResolver{
+		next: next,
+		backoff: retry.Backoff{
+			Operation: "identity_lookup",
+			Retries:   retries,
+			Delay:     delay,
+			Retryable: transient,
+		},
+	}
+}
+
+// Resolve resolves subject with the wrapped resolver
+func (r *retryResolver) Resolve(ctx context.Context, subject string) (IdentitySpec, error) {
+	return r.resolveInNamespace(ctx, "", subject)
+}
+
+// resolveInNamespace resolves subject with the namespace mappings of the wrapped
+// resolver if any
+func (r *retryResolver) resolveInNamespace(ctx context.Context, namespace, subject string) (IdentitySpec, error) {
+	var id IdentitySpec
+	err := r.backoff.Do(ctx, func() error {
+		var err error
+		id, err = resolveInNamespace(ctx, r.next, namespace, subject)
+		return err
+	})
+	return id, err
+}
+
+// transient returns true if a lookup failed with an error worth retrying, subjects
+// without identity never are
+func transient(err error) bool {
+	if errors.Is(err, ErrNotFound) {
+		return false
+	}
+	return retry.Transient(err) ||
+		ldap.IsErrorAnyOf(err, ldap.ErrorNetwork, ldap.LDAPResultBusy, ldap.LDAPResultUnavailable)
+}
+
+// unwrap returns the wrapped resolver
+func (r *retryResolver) unwrap() UIDResolver {
+	return r.next
+}
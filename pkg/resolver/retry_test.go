@@ -0,0 +1,70 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var secrets = schema.GroupResource{Resource: "secrets"}
+
+func TestRetryResolver(t *testing.T) {
+	ctx := context.Background()
+
+	// transient errors are retried up to the number of retries
+	next := &countingResolver{err: apierrors.NewTooManyRequests("slow down", 1)}
+	r := NewRetryResolver(next, 2, time.Millisecond)
+	_, err := r.Resolve(ctx, "user1")
+	assert.Error(t, err)
+	assert.Equal(t, 3, next.calls)
+
+	// other errors and subjects without identity are not
+	next = &countingResolver{err: errors.New("invalid uidNumber")}
+	r = NewRetryResolver(next, 2, time.Millisecond)
+	_, err = r.Resolve(ctx, "user1")
+	assert.Error(t, err)
+	assert.Equal(t, 1, next.calls)
+
+	next = &countingResolver{}
+	r = NewRetryResolver(next, 2, time.Millisecond)
+	_, err = r.Resolve(ctx, "user2")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, 1, next.calls)
+
+	// no retry is attempted past the deadline of the request
+	next = &countingResolver{err: apierrors.NewServerTimeout(secrets, "get", 1)}
+	r = NewRetryResolver(next, 2, time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, err = r.Resolve(ctx, "user1")
+	assert.Error(t, err)
+	assert.Equal(t, 1, next.calls)
+
+	// zero retries leave the resolver unchanged
+	assert.Same(t, next, NewRetryResolver(next, 0, time.Second))
+}
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{apierrors.NewTooManyRequests("slow down", 1), true},
+		{apierrors.NewServiceUnavailable("unavailable"), true},
+		{fmt.Errorf("cannot read LDAP bind Secret: %w", apierrors.NewTimeoutError("timeout", 1)), true},
+		{fmt.Errorf("LDAP search failed: %w", ldap.NewError(ldap.ErrorNetwork, errors.New("connection closed"))), true},
+		{fmt.Errorf("cannot read LDAP bind Secret: %w", apierrors.NewForbidden(secrets, "ldap", errors.New("denied"))), false},
+		{fmt.Errorf("LDAP bind failed: %w", ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))), false},
+		{ErrNotFound, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, transient(tt.err), tt.err.Error())
+	}
+}
@@ -0,0 +1,95 @@
+package resolver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// setting returns the backend setting named key, or def when it is unset
+func (o Options) setting(key, def string) string {
+	if o.Getenv == nil {
+		return def
+	}
+	if v := o.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// durationSetting returns the backend setting named key parsed as a duration
+func (o Options) durationSetting(key string, def time.Duration) (time.Duration, error) {
+	v := o.setting(key, "")
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("cannot set %s to %q: %v", key, v, err)
+	}
+	return d, nil
+}
+
+// intSetting returns the backend setting named key parsed as an int
+func (o Options) intSetting(key string, def int) (int, error) {
+	v := o.setting(key, "")
+	if v == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("cannot set %s to %q: %v", key, v, err)
+	}
+	return i, nil
+}
+
+// boolSetting returns the backend setting named key parsed as a bool
+func (o Options) boolSetting(key string, def bool) (bool, error) {
+	v := o.setting(key, "")
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("cannot set %s to %q: %v", key, v, err)
+	}
+	return b, nil
+}
+
+// tlsConfig returns the TLS configuration described by the <prefix>_CA_FILE,
+// <prefix>_CERT_FILE, <prefix>_KEY_FILE and <prefix>_INSECURE_SKIP_VERIFY settings
+func (o Options) tlsConfig(prefix string) (*tls.Config, error) {
+	insecure, err := o.boolSetting(prefix+"_INSECURE_SKIP_VERIFY", false)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: insecure,
+	}
+
+	if caFile := o.setting(prefix+"_CA_FILE", ""); caFile != "" {
+		ca, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s_CA_FILE: %v", prefix, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in %s_CA_FILE %s", prefix, caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	certFile, keyFile := o.setting(prefix+"_CERT_FILE", ""), o.setting(prefix+"_KEY_FILE", "")
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load %s client certificate: %v", prefix, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
@@ -0,0 +1,296 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+)
+
+func init() {
+	Register("vault", newVaultResolver)
+}
+
+// vaultResolver resolves identities from a HashiCorp Vault KV secret per subject,
+// e.g. `vault kv put secret/nfs-pod-access-control/user1 uid=1001 gids=1001,3000`.
+// The webhook logs in with its service account token through the Kubernetes auth method.
+type vaultResolver struct {
+	addr       string
+	namespace  string
+	authMount  string
+	role       string
+	tokenFile  string
+	kvMount    string
+	kvVersion  int
+	pathPrefix string
+	client     *http.Client
+
+	// mu guards the Vault client token and its expiration time
+	mu           sync.Mutex
+	token        string
+	tokenExpires time.Time
+	now          func() time.Time
+}
+
+// vaultResponse is the part of the Vault API responses used by the resolver
+type vaultResponse struct {
+	LeaseDuration int             `json:"lease_duration"`
+	Data          json.RawMessage `json:"data"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+	} `json:"auth"`
+}
+
+// vaultResolver implements the UIDResolver and leasedResolver interfaces
+var (
+	_ UIDResolver    = (*vaultResolver)(nil)
+	_ leasedResolver = (*vaultResolver)(nil)
+)
+
+// newVaultResolver returns a vaultResolver configured by the VAULT_* settings,
+// wrapped in a cache expiring after the lease of the secret or VAULT_CACHE_TTL,
+// whichever comes first
+func newVaultResolver(opts Options) (UIDResolver, error) {
+	v := &vaultResolver{
+		addr:       strings.TrimSuffix(opts.setting("VAULT_ADDR", ""), "/"),
+		namespace:  opts.setting("VAULT_NAMESPACE", ""),
+		authMount:  opts.setting("VAULT_AUTH_MOUNT", "kubernetes"),
+		role:       opts.setting("VAULT_ROLE", ""),
+		tokenFile:  opts.setting("VAULT_TOKEN_FILE", "/var/run/secrets/kubernetes.io/serviceaccount/token"),
+		kvMount:    opts.setting("VAULT_KV_MOUNT", "secret"),
+		pathPrefix: opts.setting("VAULT_PATH_PREFIX", "nfs-pod-access-control"),
+		now:        time.Now,
+	}
+	if v.addr == "" || v.role == "" {
+		return nil, fmt.Errorf("vault backend requires VAULT_ADDR and VAULT_ROLE")
+	}
+
+	var err error
+	if v.kvVersion, err = opts.intSetting("VAULT_KV_VERSION", 2); err != nil {
+		return nil, err
+	}
+	if v.kvVersion != 1 && v.kvVersion != 2 {
+		return nil, fmt.Errorf("cannot set VAULT_KV_VERSION to %d: expected 1 or 2", v.kvVersion)
+	}
+	timeout, err := opts.durationSetting("VAULT_TIMEOUT", 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := opts.tlsConfig("VAULT")
+	if err != nil {
+		return nil, err
+	}
+	v.client = &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+	}
+
+	ttl, err := opts.durationSetting("VAULT_CACHE_TTL", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	return opts.cache("vault", v, ttl), nil
+}
+
+// Resolve reads the secret of subject and returns the identity stored in its
+// `uid` and `gids` keys
+func (v *vaultResolver) Resolve(ctx context.Context, subject string) (IdentitySpec, error) {
+	id, _, err := v.resolveLeased(ctx, subject)
+	return id, err
+}
+
+// resolveLeased is Resolve also returning the lease duration of the secret
+func (v *vaultResolver) resolveLeased(ctx context.Context, subject string) (IdentitySpec, time.Duration, error) {
+	secretPath := path.Join(v.kvMount, v.pathPrefix, subject)
+	if v.kvVersion == 2 {
+		secretPath = path.Join(v.kvMount, "data", v.pathPrefix, subject)
+	}
+
+	res, status, err := v.read(ctx, secretPath)
+	if status == http.StatusForbidden {
+		// the client token may have been revoked, log in again once
+		v.mu.Lock()
+		v.token = ""
+		v.mu.Unlock()
+		res, status, err = v.read(ctx, secretPath)
+	}
+	if status == http.StatusNotFound {
+		return IdentitySpec{}, 0, ErrNotFound
+	}
+	if err != nil {
+		return IdentitySpec{}, 0, err
+	}
+
+	data := res.Data
+	if v.kvVersion == 2 {
+		var kv2 struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(res.Data, &kv2); err != nil {
+			return IdentitySpec{}, 0, fmt.Errorf("cannot decode Vault secret %s: %v", secretPath, err)
+		}
+		data = kv2.Data
+	}
+
+	id, err := vaultIdentity(data)
+	if err != nil {
+		return IdentitySpec{}, 0, fmt.Errorf("invalid Vault secret %s: %v", secretPath, err)
+	}
+	return id, time.Duration(res.LeaseDuration) * time.Second, nil
+}
+
+// read performs an authenticated read of secretPath, returning the HTTP status
+func (v *vaultResolver) read(ctx context.Context, secretPath string) (*vaultResponse, int, error) {
+	token, err := v.clientToken(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return v.do(ctx, http.MethodGet, "/v1/"+secretPath, token, nil)
+}
+
+// clientToken returns the current Vault client token, logging in with the
+// Kubernetes auth method when there is none or it is about to expire
+func (v *vaultResolver) clientToken(ctx context.Context) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.token != "" && v.now().Before(v.tokenExpires) {
+		return v.token, nil
+	}
+
+	jwt, err := os.ReadFile(v.tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("cannot read VAULT_TOKEN_FILE: %v", err)
+	}
+	body, err := json.Marshal(map[string]string{"role": v.role, "jwt": strings.TrimSpace(string(jwt))})
+	if err != nil {
+		return "", err
+	}
+	res, _, err := v.do(ctx, http.MethodPost, "/v1/auth/"+v.authMount+"/login", "", body)
+	if err != nil {
+		return "", fmt.Errorf("Vault login failed: %v", err)
+	}
+	if res.Auth == nil || res.Auth.ClientToken == "" {
+		return "", fmt.Errorf("Vault login failed: no client token returned")
+	}
+
+	// renew the token a bit before its lease expires
+	lease := time.Duration(res.Auth.LeaseDuration) * time.Second
+	v.token = res.Auth.ClientToken
+	v.tokenExpires = v.now().Add(lease - lease/10)
+	return v.token, nil
+}
+
+// do sends a request to the Vault API and decodes its response
+func (v *vaultResolver) do(ctx context.Context, method, uri, token string, body []byte) (*vaultResponse, int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, v.addr+uri, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+
+	res, err := v.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Vault request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, res.StatusCode, fmt.Errorf("Vault answered %s to %s %s", res.Status, method, uri)
+	}
+	var out vaultResponse
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&out); err != nil {
+		return nil, res.StatusCode, fmt.Errorf("cannot decode Vault response: %v", err)
+	}
+	return &out, res.StatusCode, nil
+}
+
+// vaultIdentity converts the key/value pairs of a secret into an IdentitySpec,
+// values are either numbers or strings, uid may hold UID ranges (e.g. "1000-1999,2500")
+// and gids may be a list or a comma separated string
+func vaultIdentity(data json.RawMessage) (IdentitySpec, error) {
+	var kv struct {
+		UID  interface{} `json:"uid"`
+		GIDs interface{} `json:"gids"`
+	}
+	var id IdentitySpec
+	if err := json.Unmarshal(data, &kv); err != nil {
+		return id, err
+	}
+
+	switch uid := kv.UID.(type) {
+	case nil:
+	case float64:
+		id.UIDs = mapping.SingleID(int64(uid))
+	case string:
+		uids, err := mapping.ParseIDRanges(uid)
+		if err != nil {
+			return id, fmt.Errorf("uid: %v", err)
+		}
+		id.UIDs = uids
+	default:
+		return id, fmt.Errorf("uid: unexpected value %v", uid)
+	}
+	if len(id.UIDs) > 0 {
+		id.UID = &id.UIDs[0].Min
+	}
+	var err error
+	if id.GIDs, err = vaultIDs(kv.GIDs); err != nil {
+		return id, fmt.Errorf("gids: %v", err)
+	}
+
+	if id.UID == nil && len(id.GIDs) == 0 {
+		return id, ErrNotFound
+	}
+	return id, nil
+}
+
+// vaultIDs parses a secret value holding one or more numeric IDs
+func vaultIDs(value interface{}) ([]int64, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case float64:
+		return []int64{int64(value)}, nil
+	case string:
+		var ids []int64
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field == "" {
+				continue
+			}
+			id, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+		return ids, nil
+	case []interface{}:
+		var ids []int64
+		for _, v := range value {
+			parsed, err := vaultIDs(v)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, parsed...)
+		}
+		return ids, nil
+	}
+	return nil, fmt.Errorf("unexpected value %v", value)
+}
@@ -0,0 +1,74 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVaultResolver(t *testing.T) {
+	logins := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/kubernetes/login":
+			var body map[string]string
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Equal(t, "webhook", body["role"])
+			assert.Equal(t, "sa-token", body["jwt"])
+			logins++
+			w.Write([]byte(`{"auth": {"client_token": "s.token", "lease_duration": 3600}}`))
+			return
+		}
+
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/nfs-pod-access-control/user1":
+			w.Write([]byte(`{"lease_duration": 0, "data": {"data": {"uid": "1001", "gids": "1001,3000"}}}`))
+		case "/v1/secret/data/nfs-pod-access-control/user2":
+			w.Write([]byte(`{"lease_duration": 0, "data": {"data": {"uid": 1002, "gids": [1002]}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("sa-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	settings := map[string]string{
+		"VAULT_ADDR":       srv.URL,
+		"VAULT_ROLE":       "webhook",
+		"VAULT_TOKEN_FILE": tokenFile,
+		"VAULT_CACHE_TTL":  "0s",
+	}
+	r, err := New("vault", Options{Getenv: func(k string) string { return settings[k] }})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := r.Resolve(context.Background(), "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1001), *id.UID)
+	assert.Equal(t, []int64{1001, 3000}, id.GIDs)
+
+	id, err = r.Resolve(context.Background(), "user2")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1002), *id.UID)
+	assert.Equal(t, []int64{1002}, id.GIDs)
+
+	_, err = r.Resolve(context.Background(), "user3")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// the client token is reused until its lease expires
+	assert.Equal(t, 1, logins)
+}
@@ -0,0 +1,82 @@
+// Package retry retries operations failing with transient errors, e.g. API server
+// timeouts, throttling and connection resets, with exponential backoff bounded by
+// the deadline of the admission request
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/tensorchord/nfs-pod-access-control/pkg/metrics"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Backoff retries an operation with exponentially growing delays
+type Backoff struct {
+	// Operation names the retried operation in the retries_total metric
+	Operation string
+	// Retries is the number of retries after the first attempt, 0 disables them
+	Retries int
+	// Delay is the delay before the first retry, doubled after every retry
+	Delay time.Duration
+	// Retryable returns true if an error is worth retrying, Transient when nil
+	Retryable func(error) bool
+}
+
+// Do calls fn until it succeeds, fails with an error that is not retryable or
+// Retries are exhausted, and returns its last error. Do gives up early, returning
+// the last error of fn, when ctx is done or its deadline would pass before the
+// next attempt.
+func (b Backoff) Do(ctx context.Context, fn func() error) error {
+	delay := b.Delay
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= b.Retries || ctx.Err() != nil || !b.retryable(err) {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		metrics.ObserveRetry(b.Operation)
+		delay *= 2
+	}
+}
+
+// retryable returns true if err is worth retrying
+func (b Backoff) retryable(err error) bool {
+	if b.Retryable != nil {
+		return b.Retryable(err)
+	}
+	return Transient(err)
+}
+
+// Transient returns true if err is likely to go away on its own: API server
+// timeouts, throttling and unavailability, network timeouts, refused or reset
+// connections and truncated responses
+func Transient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if apierrors.IsTimeout(err) || apierrors.IsServerTimeout(err) ||
+		apierrors.IsTooManyRequests(err) || apierrors.IsServiceUnavailable(err) {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,80 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+func TestBackoffDo(t *testing.T) {
+	b := Backoff{Operation: "test", Retries: 3, Delay: time.Millisecond}
+
+	// transient errors are retried until fn succeeds
+	calls := 0
+	err := b.Do(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return syscall.ECONNRESET
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	// or the retries are exhausted, returning the last error
+	calls = 0
+	err = b.Do(context.Background(), func() error {
+		calls++
+		return apierrors.NewTooManyRequests("slow down", 1)
+	})
+	assert.True(t, apierrors.IsTooManyRequests(err))
+	assert.Equal(t, 4, calls)
+
+	// other errors are returned right away
+	calls = 0
+	err = b.Do(context.Background(), func() error {
+		calls++
+		return errors.New("forbidden")
+	})
+	assert.EqualError(t, err, "forbidden")
+	assert.Equal(t, 1, calls)
+
+	// no retry is attempted when the deadline would pass before it
+	b.Delay = time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	calls = 0
+	err = b.Do(ctx, func() error {
+		calls++
+		return syscall.ECONNREFUSED
+	})
+	assert.ErrorIs(t, err, syscall.ECONNREFUSED)
+	assert.Equal(t, 1, calls)
+}
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{apierrors.NewTimeoutError("timeout", 1), true},
+		{apierrors.NewServiceUnavailable("unavailable"), true},
+		{fmt.Errorf("SubjectAccessReview failed: %w", apierrors.NewTooManyRequests("slow down", 1)), true},
+		{&net.OpError{Op: "read", Err: syscall.ECONNRESET}, true},
+		{&net.DNSError{IsTimeout: true}, true},
+		{apierrors.NewBadRequest("invalid"), false},
+		{apierrors.NewInternalError(errors.New("panic")), false},
+		{errors.New("connection refused"), false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Transient(tt.err), fmt.Sprint(tt.err))
+	}
+}
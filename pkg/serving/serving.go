@@ -0,0 +1,97 @@
+// Package serving tunes the HTTP server of the webhooks: its timeouts, the size
+// of request headers, HTTP/2 and the number of admission requests answered
+// concurrently, so that a burst of requests can't pile up goroutines
+package serving
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/metrics"
+)
+
+// Defaults of the Options, the write timeout is the maximum webhook timeout
+const (
+	DefaultReadTimeout    = 10 * time.Second
+	DefaultWriteTimeout   = 30 * time.Second
+	DefaultIdleTimeout    = 90 * time.Second
+	DefaultMaxHeaderBytes = http.DefaultMaxHeaderBytes
+)
+
+// Options tune the HTTP server of the webhooks
+type Options struct {
+	// ReadTimeout bounds the time to read a request, body included
+	ReadTimeout time.Duration
+	// WriteTimeout bounds the time from the end of the request headers to the
+	// end of the answer, it must exceed the webhook timeout
+	WriteTimeout time.Duration
+	// IdleTimeout bounds the time keep-alive connections wait for the next request
+	IdleTimeout time.Duration
+	// MaxHeaderBytes bounds the size of request headers
+	MaxHeaderBytes int
+	// DisableHTTP2 serves HTTP/1.1 only
+	DisableHTTP2 bool
+}
+
+// DefaultOptions returns the Options of a server tuned with the defaults
+func DefaultOptions() Options {
+	return Options{
+		ReadTimeout:    DefaultReadTimeout,
+		WriteTimeout:   DefaultWriteTimeout,
+		IdleTimeout:    DefaultIdleTimeout,
+		MaxHeaderBytes: DefaultMaxHeaderBytes,
+	}
+}
+
+// Apply sets the timeouts, the maximum header size and the protocols of server
+func (o Options) Apply(server *http.Server) {
+	server.ReadTimeout = o.ReadTimeout
+	server.WriteTimeout = o.WriteTimeout
+	server.IdleTimeout = o.IdleTimeout
+	server.MaxHeaderBytes = o.MaxHeaderBytes
+	if o.DisableHTTP2 {
+		// a non-nil empty map disables the automatic HTTP/2 support
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+}
+
+// Limiter bounds the number of requests handled concurrently, requests beyond
+// the limit are answered right away with a 429 rather than queued
+type Limiter struct {
+	slots chan struct{}
+
+	Logger *logrus.Entry
+}
+
+// NewLimiter returns a Limiter handling up to max requests concurrently, nil
+// (no limit) when max is not positive
+func NewLimiter(max int) *Limiter {
+	if max <= 0 {
+		return nil
+	}
+	return &Limiter{
+		slots:  make(chan struct{}, max),
+		Logger: logrus.WithField("component", "serving"),
+	}
+}
+
+// Limit returns next handling the requests of webhook within the limit
+func (l *Limiter) Limit(webhook string, next http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			metrics.ObserveThrottled(webhook)
+			l.Logger.WithField("uri", r.RequestURI).Debug("too many admission requests in flight, rejecting request")
+			http.Error(w, "too many admission requests in flight", http.StatusTooManyRequests)
+			return
+		}
+		defer func() { <-l.slots }()
+		next(w, r)
+	}
+}
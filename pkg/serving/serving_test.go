@@ -0,0 +1,52 @@
+package serving
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	assert.Nil(t, NewLimiter(0))
+
+	l := NewLimiter(2)
+	release, started := make(chan struct{}), make(chan struct{})
+	handler := l.Limit("validate", func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+	serve := func() int {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/validate-pods", nil))
+		return w.Code
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, http.StatusOK, serve())
+		}()
+		<-started
+	}
+	assert.Equal(t, http.StatusTooManyRequests, serve())
+
+	close(release)
+	wg.Wait()
+	go func() { <-started }()
+	assert.Equal(t, http.StatusOK, serve(), "slots are released once requests are answered")
+}
+
+func TestApply(t *testing.T) {
+	server := &http.Server{}
+	opts := DefaultOptions()
+	opts.DisableHTTP2 = true
+	opts.Apply(server)
+	assert.Equal(t, DefaultWriteTimeout, server.WriteTimeout)
+	assert.NotNil(t, server.TLSNextProto)
+	assert.Empty(t, server.TLSNextProto)
+}
@@ -0,0 +1,147 @@
+// Package sharedcache shares the identities resolved by the webhook and its
+// admission decisions between its replicas through Redis, so that every replica
+// doesn't query the identity backend on its own
+package sharedcache
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/metrics"
+)
+
+const (
+	// DefaultPrefix is the default prefix of the keys
+	DefaultPrefix = "nfs-pod-access-control"
+	// DefaultTimeout is the default timeout of Redis operations
+	DefaultTimeout = 100 * time.Millisecond
+)
+
+// Cache is a cache shared by the webhook replicas
+type Cache interface {
+	// Get returns the value of key, found is false if it is missing or expired
+	Get(ctx context.Context, key string) (value []byte, found bool, err error)
+	// Set stores the value of key for ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// Options configure the connection to Redis
+type Options struct {
+	// Addr is the host:port address of the Redis server
+	Addr     string
+	Password string
+	DB       int
+	// TLS connects to Redis over TLS, verified with the CA bundle of CAFile if set
+	TLS    bool
+	CAFile string
+	// Prefix prefixes every key, so that several deployments can share a Redis
+	Prefix string
+	// Timeout bounds every Redis operation, so that an unavailable Redis slows
+	// down admission requests by at most Timeout
+	Timeout time.Duration
+}
+
+// Redis is a Cache stored in Redis. Its keys are scoped to the version of the
+// mappings, so that the entries of the previous versions are not read anymore
+// once the mappings change, and expire with their TTL.
+type Redis struct {
+	client  *redis.Client
+	prefix  string
+	timeout time.Duration
+	// Version returns the version of the mappings, nil leaves it out of the keys
+	Version func() string
+}
+
+// Redis implements the Cache interface
+var _ Cache = (*Redis)(nil)
+
+// NewRedis returns a Redis cache connecting to the server of opts, the connection
+// is only established by the first operation
+func NewRedis(opts Options) (*Redis, error) {
+	if opts.Addr == "" {
+		return nil, fmt.Errorf("shared cache requires the address of a Redis server")
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = DefaultPrefix
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	redisOpts := &redis.Options{
+		Addr:         opts.Addr,
+		Password:     opts.Password,
+		DB:           opts.DB,
+		DialTimeout:  opts.Timeout,
+		ReadTimeout:  opts.Timeout,
+		WriteTimeout: opts.Timeout,
+		MaxRetries:   -1,
+	}
+	if opts.TLS {
+		redisOpts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		if opts.CAFile != "" {
+			ca, err := os.ReadFile(opts.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read Redis CA file: %v", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("no certificate found in Redis CA file %s", opts.CAFile)
+			}
+			redisOpts.TLSConfig.RootCAs = pool
+		}
+	}
+	return &Redis{client: redis.NewClient(redisOpts), prefix: opts.Prefix, timeout: opts.Timeout}, nil
+}
+
+// Ping checks that the Redis server answers
+func (r *Redis) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	return r.client.Ping(ctx).Err()
+}
+
+// Get returns the value of key, found is false if it is missing or expired
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	value, err := r.client.Get(ctx, r.key(key)).Bytes()
+	switch {
+	case errors.Is(err, redis.Nil):
+		metrics.ObserveSharedCache("get", "miss")
+		return nil, false, nil
+	case err != nil:
+		metrics.ObserveSharedCache("get", "error")
+		return nil, false, fmt.Errorf("Error getting shared cache entry: %s\n", err)
+	}
+	metrics.ObserveSharedCache("get", "hit")
+	return value, true, nil
+}
+
+// Set stores the value of key for ttl
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	if err := r.client.Set(ctx, r.key(key), value, ttl).Err(); err != nil {
+		metrics.ObserveSharedCache("set", "error")
+		return fmt.Errorf("Error setting shared cache entry: %s\n", err)
+	}
+	metrics.ObserveSharedCache("set", "done")
+	return nil
+}
+
+// key returns the Redis key of key, scoped to the prefix and the version of the
+// mappings, e.g. "nfs-pod-access-control:5f0c1e9a2b7d4c38:identity:ldap:user1"
+func (r *Redis) key(key string) string {
+	version := ""
+	if r.Version != nil {
+		version = r.Version()
+	}
+	return r.prefix + ":" + version + ":" + key
+}
@@ -0,0 +1,36 @@
+package sharedcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisKey(t *testing.T) {
+	r, err := NewRedis(Options{Addr: "redis:6379"})
+	assert.NoError(t, err)
+	assert.Equal(t, "nfs-pod-access-control::identity:ldap:user1", r.key("identity:ldap:user1"))
+
+	// keys are scoped to the version of the mappings
+	r.Version = func() string { return "5f0c1e9a2b7d4c38" }
+	assert.Equal(t, "nfs-pod-access-control:5f0c1e9a2b7d4c38:identity:ldap:user1", r.key("identity:ldap:user1"))
+
+	_, err = NewRedis(Options{})
+	assert.Error(t, err)
+}
+
+func TestRedisUnavailable(t *testing.T) {
+	r, err := NewRedis(Options{Addr: "127.0.0.1:1", Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, found, err := r.Get(context.Background(), "identity:ldap:user1")
+	assert.Error(t, err)
+	assert.False(t, found)
+	assert.Error(t, r.Set(context.Background(), "identity:ldap:user1", []byte("{}"), time.Minute))
+	// an unavailable server only delays requests by the timeout
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
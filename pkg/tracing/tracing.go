@@ -0,0 +1,94 @@
+// Package tracing sets up OpenTelemetry tracing of admission requests, spans
+// are exported over OTLP to the collector configured by the standard
+// OTEL_EXPORTER_OTLP_* env vars
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+const (
+	// ServiceName is the default service.name of the spans, overridden by OTEL_SERVICE_NAME
+	ServiceName = "nfs-pod-access-control"
+
+	// instrumentationName names the tracer of the webhook
+	instrumentationName = "github.com/tensorchord/nfs-pod-access-control"
+)
+
+// Tracer returns the tracer of the webhook, spans are dropped until Setup is called
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Setup installs a tracer provider exporting spans over OTLP, using gRPC unless
+// OTEL_EXPORTER_OTLP_TRACES_PROTOCOL or OTEL_EXPORTER_OTLP_PROTOCOL is set to
+// http/protobuf. The endpoint, headers, TLS settings and sampler are read by the
+// OpenTelemetry SDK from the standard OTEL_* env vars. The returned function
+// flushes pending spans and must be called before exiting.
+func Setup(ctx context.Context, getenv func(string) string) (func(context.Context) error, error) {
+	protocol := getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch protocol {
+	case "", "grpc":
+		exporter, err = otlptracegrpc.New(ctx)
+	case "http/protobuf":
+		exporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q, expected grpc or http/protobuf", protocol)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot create OTLP exporter: %v", err)
+	}
+
+	res, err := resource.Merge(
+		resource.NewSchemaless(semconv.ServiceName(ServiceName)),
+		resource.Environment(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create tracing resource: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// StartAdmission starts the server span of an admission request sent to webhook,
+// continuing the trace of the API server when it propagates one
+func StartAdmission(r *http.Request, webhook string) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return Tracer().Start(ctx, "admission "+webhook, trace.WithSpanKind(trace.SpanKindServer))
+}
+
+// AdmissionAttributes returns the span attributes identifying an admission request
+func AdmissionAttributes(req *admissionv1.AdmissionRequest) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("k8s.admission.uid", string(req.UID)),
+		attribute.String("k8s.namespace.name", req.Namespace),
+		attribute.String("k8s.admission.operation", string(req.Operation)),
+		attribute.String("k8s.admission.user", req.UserInfo.Username),
+		attribute.Bool("k8s.admission.dry_run", req.DryRun != nil && *req.DryRun),
+	}
+}
@@ -0,0 +1,42 @@
+package uidrange
+
+import (
+	"fmt"
+
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// DefaultUIDAnnotation is the namespace annotation holding the UIDs of the
+	// users and serviceAccounts without a mapping creating pods in the namespace,
+	// e.g. "3000" or "3000-3099", the first UID is injected as runAsUser
+	DefaultUIDAnnotation = "nfs-access-control/default-uid"
+	// DefaultGIDAnnotation is the namespace annotation holding the comma separated
+	// GIDs of the users and serviceAccounts without a mapping, e.g. "3000,4000"
+	DefaultGIDAnnotation = "nfs-access-control/default-gids"
+)
+
+// NamespaceDefault returns the default UIDs and GIDs of namespace, found is false
+// if the namespace has neither annotation. A malformed annotation is an error.
+func (r *Ranges) NamespaceDefault(namespace string) (uids mapping.IDRanges, gids []int64, found bool, err error) {
+	ns, err := r.namespaces.Get(namespace)
+	if apierrors.IsNotFound(err) {
+		return nil, nil, false, nil
+	}
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("Error getting namespace %s: %s\n", namespace, err)
+	}
+
+	if value, ok := ns.Annotations[DefaultUIDAnnotation]; ok {
+		if uids, err = mapping.ParseIDRanges(value); err != nil {
+			return nil, nil, false, fmt.Errorf("invalid %s annotation of namespace %s: %v", DefaultUIDAnnotation, namespace, err)
+		}
+	}
+	if value, ok := ns.Annotations[DefaultGIDAnnotation]; ok {
+		if gids, err = mapping.ParseIDList(value); err != nil {
+			return nil, nil, false, fmt.Errorf("invalid %s annotation of namespace %s: %v", DefaultGIDAnnotation, namespace, err)
+		}
+	}
+	return uids, gids, len(uids) > 0 || len(gids) > 0, nil
+}
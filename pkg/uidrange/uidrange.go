@@ -0,0 +1,107 @@
+// Package uidrange reads the UID range namespaces are restricted to, carving the
+// UIDs up between tenants like OpenShift does with its namespace UID ranges
+package uidrange
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Annotation is the namespace annotation holding the UIDs its pods may run as,
+// e.g. "3000-3999", a comma separated list of UIDs and ranges, or the OpenShift
+// "<first UID>/<size>" notation, e.g. "1000060000/10000"
+const Annotation = "nfs-access-control/uid-range"
+
+// OpenShiftAnnotation is the namespace annotation holding the UID range OpenShift
+// allocates to a namespace, which its SecurityContextConstraints assign UIDs from
+const OpenShiftAnnotation = "openshift.io/sa.scc.uid-range"
+
+// Ranges reads the UID ranges of namespaces from an informer cache
+type Ranges struct {
+	factory    informers.SharedInformerFactory
+	informer   cache.SharedIndexInformer
+	namespaces corelisters.NamespaceLister
+}
+
+// NewRanges returns Ranges reading namespace annotations from an informer cache,
+// the cache is only filled once Start is called
+func NewRanges(client kubernetes.Interface) *Ranges {
+	factory := informers.NewSharedInformerFactory(client, 0)
+	namespaces := factory.Core().V1().Namespaces()
+
+	return &Ranges{
+		factory:    factory,
+		informer:   namespaces.Informer(),
+		namespaces: namespaces.Lister(),
+	}
+}
+
+// Start starts watching namespaces and blocks until the cache is synced
+func (r *Ranges) Start(stopCh <-chan struct{}) error {
+	r.factory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, r.informer.HasSynced) {
+		return fmt.Errorf("failed to sync Namespace cache")
+	}
+	return nil
+}
+
+// UIDRange returns the UIDs the pods of namespace may run as, found is false if
+// the namespace doesn't restrict them. A malformed annotation is an error, so that
+// a typo doesn't lift the restriction.
+func (r *Ranges) UIDRange(namespace string) (uids mapping.IDRanges, found bool, err error) {
+	return r.annotated(namespace, Annotation)
+}
+
+// SCCRange returns the UID range OpenShift allocated to namespace, found is false
+// outside of OpenShift or if the namespace has no range yet
+func (r *Ranges) SCCRange(namespace string) (uids mapping.IDRanges, found bool, err error) {
+	return r.annotated(namespace, OpenShiftAnnotation)
+}
+
+// annotated returns the UID range of the annotation key of namespace
+func (r *Ranges) annotated(namespace, key string) (uids mapping.IDRanges, found bool, err error) {
+	ns, err := r.namespaces.Get(namespace)
+	if apierrors.IsNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("Error getting namespace %s: %s\n", namespace, err)
+	}
+	value, ok := ns.Annotations[key]
+	if !ok {
+		return nil, false, nil
+	}
+	uids, err = Parse(value)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid %s annotation of namespace %s: %v", key, namespace, err)
+	}
+	return uids, true, nil
+}
+
+// Parse parses a UID range annotation, either a comma separated list of UIDs and
+// ranges like the UID mappings, or the OpenShift "<first UID>/<size>" notation
+func Parse(value string) (mapping.IDRanges, error) {
+	if first, size, ok := strings.Cut(strings.TrimSpace(value), "/"); ok {
+		min, err := strconv.ParseInt(strings.TrimSpace(first), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid first UID %q: %v", first, err)
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(size), 10, 64)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid range size %q", size)
+		}
+		if min < 0 || min+n-1 > mapping.MaxID {
+			return nil, fmt.Errorf("UID range %s is out of [0, %d]", value, int64(mapping.MaxID))
+		}
+		return mapping.IDRanges{{Min: min, Max: min + n - 1}}, nil
+	}
+	return mapping.ParseIDRanges(value)
+}
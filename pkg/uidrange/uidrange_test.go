@@ -0,0 +1,72 @@
+package uidrange
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    mapping.IDRanges
+		wantErr bool
+	}{
+		{value: "3000-3999", want: mapping.IDRanges{{Min: 3000, Max: 3999}}},
+		{value: "3000-3999,5000", want: mapping.IDRanges{{Min: 3000, Max: 3999}, {Min: 5000, Max: 5000}}},
+		{value: "1000060000/10000", want: mapping.IDRanges{{Min: 1000060000, Max: 1000069999}}},
+		{value: "1000060000/0", wantErr: true},
+		{value: "4294967290/10", wantErr: true},
+		{value: "abc/10", wantErr: true},
+		{value: "3000-39OO", wantErr: true},
+		{value: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.value)
+		assert.Equal(t, tt.wantErr, err != nil, "%q: %v", tt.value, err)
+		assert.Equal(t, tt.want, got, tt.value)
+	}
+}
+
+func TestNamespaceDefault(t *testing.T) {
+	namespace := func(name string, annotations map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: annotations}}
+	}
+	client := fake.NewSimpleClientset(
+		namespace("team-a", map[string]string{DefaultUIDAnnotation: "3000-3099", DefaultGIDAnnotation: "3000, 4000"}),
+		namespace("team-b", map[string]string{DefaultGIDAnnotation: "5000"}),
+		namespace("team-c", nil),
+		namespace("malformed", map[string]string{DefaultUIDAnnotation: "abc"}),
+	)
+	stop := make(chan struct{})
+	defer close(stop)
+	r := NewRanges(client)
+	if err := r.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	uids, gids, found, err := r.NamespaceDefault("team-a")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, mapping.IDRanges{{Min: 3000, Max: 3099}}, uids)
+	assert.Equal(t, []int64{3000, 4000}, gids)
+
+	uids, gids, found, err = r.NamespaceDefault("team-b")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Empty(t, uids)
+	assert.Equal(t, []int64{5000}, gids)
+
+	for _, ns := range []string{"team-c", "missing"} {
+		_, _, found, err = r.NamespaceDefault(ns)
+		assert.NoError(t, err)
+		assert.False(t, found, ns)
+	}
+
+	_, _, _, err = r.NamespaceDefault("malformed")
+	assert.Error(t, err)
+}
@@ -0,0 +1,55 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/accesspolicy"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// AccessPolicyEvaluator evaluates the rules of NFSAccessPolicies against pods
+type AccessPolicyEvaluator interface {
+	Evaluate(ctx context.Context, in accesspolicy.Input) (allowed bool, reason string)
+}
+
+// accessPolicyValidator is a container for validating pods against NFSAccessPolicies
+type accessPolicyValidator struct {
+	Logger   logrus.FieldLogger
+	Resolver resolver.UIDResolver
+	Policies AccessPolicyEvaluator
+}
+
+// accessPolicyValidator implements the podValidator interface
+var _ podValidator = (*accessPolicyValidator)(nil)
+
+// Name returns the name of accessPolicyValidator
+func (p accessPolicyValidator) Name() string {
+	return "access_policy_validator"
+}
+
+// Validate evaluates the rules of the NFSAccessPolicies of the pod namespace.
+// The returned validation is only valid if every rule returns true for the pod,
+// the user/serviceAccount creating it and its mapping entry.
+func (p accessPolicyValidator) Validate(ctx context.Context, pod *corev1.Pod, a *admissionv1.AdmissionRequest) (validation, error) {
+	user := getUser(p.Logger, a, pod)
+	groups := getGroups(a)
+
+	in := accesspolicy.Input{Pod: pod, Namespace: a.Namespace, Subject: user, Groups: groups}
+	identity, err := resolver.ResolveUser(ctx, p.Resolver, a.Namespace, resolvedSubject(a, user), groups)
+	switch {
+	case err == nil:
+		in.Identity = &identity
+	case !errors.Is(err, resolver.ErrNotFound):
+		return lookupFailed(fmt.Sprintf("Failed resolving identity: %s\n", err)), nil
+	}
+
+	if allowed, reason := p.Policies.Evaluate(ctx, in); !allowed {
+		return validation{Valid: false, Reason: reason, Code: CodeAccessPolicyDenied, Details: map[string]string{"subject": user}}, nil
+	}
+	return validation{Valid: true, Reason: "Valid access policies"}, nil
+}
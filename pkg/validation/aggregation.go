@@ -0,0 +1,88 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Aggregation tells which denials of the validator chain are returned
+type Aggregation string
+
+const (
+	// AggregateFirstDeny returns the first denial of the chain, without waiting
+	// for the next validators
+	AggregateFirstDeny Aggregation = "first-deny"
+	// AggregateAll applies every validator of the chain and returns all of their
+	// denials, so that users can fix them at once
+	AggregateAll Aggregation = "collect-all"
+)
+
+// ParseAggregation returns the Aggregation named by value, AggregateFirstDeny when empty
+func ParseAggregation(value string) (Aggregation, error) {
+	switch a := Aggregation(strings.ToLower(strings.TrimSpace(value))); a {
+	case "":
+		return AggregateFirstDeny, nil
+	case AggregateFirstDeny, AggregateAll:
+		return a, nil
+	default:
+		return "", fmt.Errorf("unknown validator aggregation %q, expected %s or %s", value, AggregateFirstDeny, AggregateAll)
+	}
+}
+
+// result is the outcome of a validator
+type result struct {
+	validation validation
+	err        error
+}
+
+// run applies validators to pod and returns a function returning the result of
+// the i-th one, waiting for it. Validators are applied concurrently when the
+// Policy is Parallel, otherwise one after the other as their results are asked
+// for, so that the ones after a denial are not applied with AggregateFirstDeny.
+// The validators not applied yet when ctx is done are interrupted.
+func (v *Validator) run(ctx context.Context, validators []podValidator, pod *corev1.Pod, a *admissionv1.AdmissionRequest) func(int) (validation, error) {
+	apply := func(validator podValidator) result {
+		if err := ctx.Err(); err != nil {
+			return result{err: fmt.Errorf("validation interrupted before %s: %w", validator.Name(), err)}
+		}
+		vp, err := validate(ctx, validator, pod, a)
+		return result{validation: vp, err: err}
+	}
+
+	if !v.Policy.Parallel || len(validators) < 2 {
+		return func(i int) (validation, error) {
+			r := apply(validators[i])
+			return r.validation, r.err
+		}
+	}
+
+	results := make([]chan result, len(validators))
+	for i, validator := range validators {
+		results[i] = make(chan result, 1)
+		go func(i int, validator podValidator) {
+			results[i] <- apply(validator)
+		}(i, validator)
+	}
+	return func(i int) (validation, error) {
+		r := <-results[i]
+		return r.validation, r.err
+	}
+}
+
+// denial returns the validation denying a pod for the denials of the chain, the
+// first denial being reported as the Validator, Code and Details
+func denial(denied, audited []Finding) validation {
+	var reason strings.Builder
+	for i, d := range denied {
+		if i > 0 && !strings.HasSuffix(denied[i-1].Reason, "\n") {
+			reason.WriteString("\n")
+		}
+		reason.WriteString(d.Reason)
+	}
+	first := denied[0]
+	return validation{Valid: false, Reason: reason.String(), Validator: first.Validator, Code: first.Code, Details: first.Details, Denied: denied, Audited: audited}
+}
@@ -0,0 +1,62 @@
+package validation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestParseAggregation(t *testing.T) {
+	a, err := ParseAggregation("")
+	assert.NoError(t, err)
+	assert.Equal(t, AggregateFirstDeny, a)
+	a, err = ParseAggregation("Collect-All")
+	assert.NoError(t, err)
+	assert.Equal(t, AggregateAll, a)
+	_, err = ParseAggregation("all")
+	assert.Error(t, err)
+}
+
+func TestValidatePodAggregation(t *testing.T) {
+	identities := staticResolver{"user1": {UID: int64Ptr(1001), GIDs: []int64{1001}}}
+	sc := &corev1.PodSecurityContext{RunAsUser: int64Ptr(2000), RunAsGroup: int64Ptr(2000), FSGroup: int64Ptr(1001)}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		denied []string
+	}{
+		{name: "first deny", policy: Policy{}, denied: []string{"uid_validator"}},
+		{name: "parallel first deny", policy: Policy{Parallel: true}, denied: []string{"uid_validator"}},
+		{name: "collect all", policy: Policy{Aggregation: AggregateAll}, denied: []string{"uid_validator", "gid_validator"}},
+		{name: "parallel collect all", policy: Policy{Parallel: true, Aggregation: AggregateAll}, denied: []string{"uid_validator", "gid_validator"}},
+		{
+			name:   "collect all but audited",
+			policy: Policy{Parallel: true, Aggregation: AggregateAll, Chain: Chain{Modes: map[string]ValidatorMode{"uid_validator": ValidatorAudit}}},
+			denied: []string{"gid_validator"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{SecurityContext: sc, Containers: []corev1.Container{{Name: "app"}}}}
+			req := &admissionv1.AdmissionRequest{Namespace: "user1", UserInfo: authenticationv1.UserInfo{Username: "user1"}}
+
+			v := NewValidator(logrus.NewEntry(logrus.New()), tt.policy, identities)
+			got, err := v.ValidatePod(context.TODO(), pod, req)
+			assert.NoError(t, err)
+			assert.False(t, got.Valid)
+			assert.Equal(t, tt.denied[0], got.Validator)
+			var denied []string
+			for _, d := range got.Denied {
+				denied = append(denied, d.Validator)
+				assert.Contains(t, got.Reason, d.Reason)
+			}
+			assert.Equal(t, tt.denied, denied)
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package validation
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Codes of the denials of pods, returned as the reason of the admission status
+// so that tooling can tell why a pod is denied without parsing the message
+const (
+	CodeDenied                     = "PodDenied"
+	CodeLookupFailed               = "LookupFailed"
+	CodeUnmappedUser               = "UnmappedUser"
+	CodeUnmappedGID                = "UnmappedGID"
+	CodeRunAsUserRequired          = "RunAsUserRequired"
+	CodeUIDMismatch                = "UIDMismatch"
+	CodeGIDMismatch                = "GIDMismatch"
+	CodeFSGroupMismatch            = "FSGroupMismatch"
+	CodeSupplementalGroupMismatch  = "SupplementalGroupMismatch"
+	CodeRootUID                    = "RootUID"
+	CodeUIDBelowMinimum            = "UIDBelowMinimum"
+	CodeUIDOutOfNamespaceRange     = "UIDOutOfNamespaceRange"
+	CodeRunAsNonRootRequired       = "RunAsNonRootRequired"
+	CodeUserNamespaceRequired      = "UserNamespaceRequired"
+	CodeHostNamespace              = "HostNamespace"
+	CodeReadOnlyExport             = "ReadOnlyExport"
+	CodeExportSecurityFlavor       = "ExportSecurityFlavor"
+	CodeExportIDMismatch           = "ExportIDMismatch"
+	CodeForeignKeytab              = "ForeignKeytab"
+	CodeUnmappedPrincipal          = "UnmappedPrincipal"
+	CodePrincipalMismatch          = "PrincipalMismatch"
+	CodeMissingKerberosCredentials = "MissingKerberosCredentials"
+	CodeSELinuxMismatch            = "SELinuxMismatch"
+	CodeOutsideTimeWindow          = "OutsideTimeWindow"
+	CodeAccessPolicyDenied         = "AccessPolicyDenied"
+	CodeOPADenied                  = "OPADenied"
+	CodeUIDCollision               = "UIDCollision"
+	CodeWindowsPod                 = "WindowsPod"
+	CodeUnmappedWindowsUser        = "UnmappedWindowsUser"
+	CodeWindowsUserNameMismatch    = "WindowsUserNameMismatch"
+)
+
+// lookupFailed returns the validation denying a pod because err prevented its validation
+func lookupFailed(reason string) validation {
+	return validation{Valid: false, Reason: reason, Code: CodeLookupFailed}
+}
+
+// formatIDs formats ids as a comma separated list, e.g. "1001,3000"
+func formatIDs(ids []int64) string {
+	fields := make([]string, len(ids))
+	for i, id := range ids {
+		fields[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(fields, ",")
+}
@@ -0,0 +1,50 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// CollisionChecker reports the UIDs users and serviceAccounts share with others
+type CollisionChecker interface {
+	Collisions(subject string) []string
+}
+
+// collisionValidator is a container for refusing the pods of users and
+// serviceAccounts whose UIDs are mapped to someone else too
+type collisionValidator struct {
+	Logger     logrus.FieldLogger
+	Collisions CollisionChecker
+}
+
+// collisionValidator implements the podValidator interface
+var _ podValidator = (*collisionValidator)(nil)
+
+// Name returns the name of collisionValidator
+func (c collisionValidator) Name() string {
+	return "collision_validator"
+}
+
+// Validate returns an invalid validation if the UIDs of the user/serviceAccount
+// creating the pod collide with the ones of another subject, until the mappings
+// are fixed
+func (c collisionValidator) Validate(_ context.Context, pod *corev1.Pod, a *admissionv1.AdmissionRequest) (validation, error) {
+	user := getUser(c.Logger, a, pod)
+	if collisions := c.Collisions.Collisions(user); len(collisions) > 0 {
+		v := validation{
+			Valid:  false,
+			Reason: fmt.Sprintf("UID mapping of %s is ambiguous until resolved: %s\n", user, strings.Join(collisions, "; ")),
+			Code:   CodeUIDCollision,
+			Details: map[string]string{
+				"subject": user,
+			},
+		}
+		return v, nil
+	}
+	return validation{Valid: true, Reason: "no UID collision"}, nil
+}
@@ -0,0 +1,33 @@
+package validation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// collisionChecker maps subjects to their collisions
+type collisionChecker map[string][]string
+
+func (c collisionChecker) Collisions(subject string) []string {
+	return c[subject]
+}
+
+func TestCollisionValidator(t *testing.T) {
+	c := collisionValidator{
+		Logger:     logrus.New(),
+		Collisions: collisionChecker{"user1": {"UID 1001 is mapped to both user1 and user2"}},
+	}
+
+	for user, valid := range map[string]bool{"user1": false, "user3": true} {
+		request := &admissionv1.AdmissionRequest{UserInfo: authenticationv1.UserInfo{Username: user}}
+		v, err := c.Validate(context.Background(), &corev1.Pod{}, request)
+		assert.NoError(t, err)
+		assert.Equal(t, valid, v.Valid, user)
+	}
+}
@@ -0,0 +1,223 @@
+package validation
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// securityContextID is an ID set in the securityContext of a pod or of one of its containers
+type securityContextID struct {
+	// Source describes where the ID has been set, e.g. "pod" or "container app"
+	Source string
+	ID     int64
+}
+
+// containerSecurityContext is the securityContext of a single container of a pod
+type containerSecurityContext struct {
+	// Source describes the container, e.g. "init container setup"
+	Source          string
+	SecurityContext *corev1.SecurityContext
+}
+
+// containerSecurityContexts returns the securityContexts of all containers, init containers
+// and ephemeral containers of a pod, skipping the ones that don't set any
+func containerSecurityContexts(pod *corev1.Pod) []containerSecurityContext {
+	var scs []containerSecurityContext
+	for _, c := range pod.Spec.InitContainers {
+		if c.SecurityContext != nil {
+			scs = append(scs, containerSecurityContext{Source: fmt.Sprintf("init container %s", c.Name), SecurityContext: c.SecurityContext})
+		}
+	}
+	for _, c := range pod.Spec.Containers {
+		if c.SecurityContext != nil {
+			scs = append(scs, containerSecurityContext{Source: fmt.Sprintf("container %s", c.Name), SecurityContext: c.SecurityContext})
+		}
+	}
+	for _, c := range pod.Spec.EphemeralContainers {
+		if c.SecurityContext != nil {
+			scs = append(scs, containerSecurityContext{Source: fmt.Sprintf("ephemeral container %s", c.Name), SecurityContext: c.SecurityContext})
+		}
+	}
+	return scs
+}
+
+// runAsUsers returns every runAsUser set at pod or container level
+func runAsUsers(pod *corev1.Pod) []securityContextID {
+	var ids []securityContextID
+	if sc := pod.Spec.SecurityContext; sc != nil && sc.RunAsUser != nil {
+		ids = append(ids, securityContextID{Source: "pod", ID: *sc.RunAsUser})
+	}
+	for _, c := range containerSecurityContexts(pod) {
+		if c.SecurityContext.RunAsUser != nil {
+			ids = append(ids, securityContextID{Source: c.Source, ID: *c.SecurityContext.RunAsUser})
+		}
+	}
+	return ids
+}
+
+// runAsGroups returns every runAsGroup set at pod or container level
+func runAsGroups(pod *corev1.Pod) []securityContextID {
+	var ids []securityContextID
+	if sc := pod.Spec.SecurityContext; sc != nil && sc.RunAsGroup != nil {
+		ids = append(ids, securityContextID{Source: "pod", ID: *sc.RunAsGroup})
+	}
+	for _, c := range containerSecurityContexts(pod) {
+		if c.SecurityContext.RunAsGroup != nil {
+			ids = append(ids, securityContextID{Source: c.Source, ID: *c.SecurityContext.RunAsGroup})
+		}
+	}
+	return ids
+}
+
+// containersWithoutRunAsUser returns the description of every container, init container
+// and ephemeral container that runs with the image default UID, i.e. neither the pod
+// nor the container set runAsUser
+func containersWithoutRunAsUser(pod *corev1.Pod) []string {
+	if sc := pod.Spec.SecurityContext; sc != nil && sc.RunAsUser != nil {
+		return nil
+	}
+
+	var missing []string
+	check := func(source string, sc *corev1.SecurityContext) {
+		if sc == nil || sc.RunAsUser == nil {
+			missing = append(missing, source)
+		}
+	}
+	for _, c := range pod.Spec.InitContainers {
+		check(fmt.Sprintf("init container %s", c.Name), c.SecurityContext)
+	}
+	for _, c := range pod.Spec.Containers {
+		check(fmt.Sprintf("container %s", c.Name), c.SecurityContext)
+	}
+	for _, c := range pod.Spec.EphemeralContainers {
+		check(fmt.Sprintf("ephemeral container %s", c.Name), c.SecurityContext)
+	}
+	return missing
+}
+
+// containersWithoutRunAsNonRoot returns the description of every container, init
+// container and ephemeral container that may run as root, i.e. runAsNonRoot is
+// neither true on the container nor, unless the container overrides it, on the pod
+func containersWithoutRunAsNonRoot(pod *corev1.Pod) []string {
+	podNonRoot := false
+	if sc := pod.Spec.SecurityContext; sc != nil && sc.RunAsNonRoot != nil {
+		podNonRoot = *sc.RunAsNonRoot
+	}
+
+	var missing []string
+	check := func(source string, sc *corev1.SecurityContext) {
+		nonRoot := podNonRoot
+		if sc != nil && sc.RunAsNonRoot != nil {
+			nonRoot = *sc.RunAsNonRoot
+		}
+		if !nonRoot {
+			missing = append(missing, source)
+		}
+	}
+	for _, c := range pod.Spec.InitContainers {
+		check(fmt.Sprintf("init container %s", c.Name), c.SecurityContext)
+	}
+	for _, c := range pod.Spec.Containers {
+		check(fmt.Sprintf("container %s", c.Name), c.SecurityContext)
+	}
+	for _, c := range pod.Spec.EphemeralContainers {
+		check(fmt.Sprintf("ephemeral container %s", c.Name), c.SecurityContext)
+	}
+	return missing
+}
+
+// windowsUserName is a runAsUserName set in the windowsOptions of a pod or of one of its containers
+type windowsUserName struct {
+	// Source describes where the user name has been set, e.g. "pod" or "container app"
+	Source string
+	Name   string
+}
+
+// runAsUserNames returns every Windows runAsUserName set at pod or container level
+func runAsUserNames(pod *corev1.Pod) []windowsUserName {
+	var names []windowsUserName
+	if sc := pod.Spec.SecurityContext; sc != nil && sc.WindowsOptions != nil && sc.WindowsOptions.RunAsUserName != nil {
+		names = append(names, windowsUserName{Source: "pod", Name: *sc.WindowsOptions.RunAsUserName})
+	}
+	for _, c := range containerSecurityContexts(pod) {
+		if o := c.SecurityContext.WindowsOptions; o != nil && o.RunAsUserName != nil {
+			names = append(names, windowsUserName{Source: c.Source, Name: *o.RunAsUserName})
+		}
+	}
+	return names
+}
+
+// IsWindowsPod returns true if the pod targets Windows nodes, i.e. sets its OS to
+// windows, on which runAsUser and the other Linux IDs don't apply. A runAsUserName
+// alone doesn't make a pod a Windows one, Linux nodes ignore it.
+func IsWindowsPod(pod *corev1.Pod) bool {
+	return pod.Spec.OS != nil && pod.Spec.OS.Name == corev1.Windows
+}
+
+// usesUserNamespace returns true if the pod runs in a user namespace, i.e. sets
+// hostUsers to false, the kubelet then maps its UIDs and GIDs to other host IDs
+func usesUserNamespace(pod *corev1.Pod) bool {
+	return pod.Spec.HostUsers != nil && !*pod.Spec.HostUsers
+}
+
+// containerMount describes a container mounting a volume of a pod, with the UID
+// and GIDs the container runs as
+type containerMount struct {
+	// Source describes the container, e.g. "init container setup"
+	Source   string
+	ReadOnly bool
+	// UID is nil when the container runs with the image default UID
+	UID  *int64
+	GIDs []int64
+}
+
+// volumeMounts returns every container, init container and ephemeral container
+// of a pod mounting the volume named volume
+func volumeMounts(pod *corev1.Pod, volume string) []containerMount {
+	var mounts []containerMount
+	add := func(source string, sc *corev1.SecurityContext, vms []corev1.VolumeMount) {
+		for _, vm := range vms {
+			if vm.Name == volume {
+				uid, gids := containerIDs(pod, sc)
+				mounts = append(mounts, containerMount{Source: source, ReadOnly: vm.ReadOnly, UID: uid, GIDs: gids})
+			}
+		}
+	}
+	for _, c := range pod.Spec.InitContainers {
+		add(fmt.Sprintf("init container %s", c.Name), c.SecurityContext, c.VolumeMounts)
+	}
+	for _, c := range pod.Spec.Containers {
+		add(fmt.Sprintf("container %s", c.Name), c.SecurityContext, c.VolumeMounts)
+	}
+	for _, c := range pod.Spec.EphemeralContainers {
+		add(fmt.Sprintf("ephemeral container %s", c.Name), c.SecurityContext, c.VolumeMounts)
+	}
+	return mounts
+}
+
+// containerIDs returns the UID (nil if unset) and the GIDs of a container with
+// securityContext sc: its runAsGroup, the fsGroup and the supplementalGroups of the pod
+func containerIDs(pod *corev1.Pod, sc *corev1.SecurityContext) (*int64, []int64) {
+	var uid, runAsGroup *int64
+	var gids []int64
+	if psc := pod.Spec.SecurityContext; psc != nil {
+		uid, runAsGroup = psc.RunAsUser, psc.RunAsGroup
+		if psc.FSGroup != nil {
+			gids = append(gids, *psc.FSGroup)
+		}
+		gids = append(gids, psc.SupplementalGroups...)
+	}
+	if sc != nil {
+		if sc.RunAsUser != nil {
+			uid = sc.RunAsUser
+		}
+		if sc.RunAsGroup != nil {
+			runAsGroup = sc.RunAsGroup
+		}
+	}
+	if runAsGroup != nil {
+		gids = append([]int64{*runAsGroup}, gids...)
+	}
+	return uid, gids
+}
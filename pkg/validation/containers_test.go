@@ -0,0 +1,74 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestRunAsUsers(t *testing.T) {
+	podUID, containerUID, initUID, debugUID := int64(1001), int64(0), int64(1002), int64(1003)
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{RunAsUser: &podUID},
+			InitContainers: []corev1.Container{
+				{Name: "setup", SecurityContext: &corev1.SecurityContext{RunAsUser: &initUID}},
+			},
+			Containers: []corev1.Container{
+				{Name: "app"},
+				{Name: "sidecar", SecurityContext: &corev1.SecurityContext{RunAsUser: &containerUID}},
+			},
+			EphemeralContainers: []corev1.EphemeralContainer{{
+				EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+					Name:            "debugger",
+					SecurityContext: &corev1.SecurityContext{RunAsUser: &debugUID},
+				},
+			}},
+		},
+	}
+
+	want := []securityContextID{
+		{Source: "pod", ID: 1001},
+		{Source: "init container setup", ID: 1002},
+		{Source: "container sidecar", ID: 0},
+		{Source: "ephemeral container debugger", ID: 1003},
+	}
+	assert.Equal(t, want, runAsUsers(pod))
+	assert.Empty(t, runAsGroups(pod))
+}
+
+func TestContainersWithoutRunAsUser(t *testing.T) {
+	uid := int64(1001)
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "setup"}},
+			Containers: []corev1.Container{
+				{Name: "app", SecurityContext: &corev1.SecurityContext{RunAsUser: &uid}},
+				{Name: "sidecar", SecurityContext: &corev1.SecurityContext{}},
+			},
+		},
+	}
+	assert.Equal(t, []string{"init container setup", "container sidecar"}, containersWithoutRunAsUser(pod))
+
+	pod.Spec.SecurityContext = &corev1.PodSecurityContext{RunAsUser: &uid}
+	assert.Empty(t, containersWithoutRunAsUser(pod))
+}
+
+func TestContainersWithoutRunAsNonRoot(t *testing.T) {
+	yes, no := true, false
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{RunAsNonRoot: &yes},
+			InitContainers:  []corev1.Container{{Name: "setup", SecurityContext: &corev1.SecurityContext{RunAsNonRoot: &no}}},
+			Containers: []corev1.Container{
+				{Name: "app"},
+				{Name: "sidecar", SecurityContext: &corev1.SecurityContext{RunAsNonRoot: &yes}},
+			},
+		},
+	}
+	assert.Equal(t, []string{"init container setup"}, containersWithoutRunAsNonRoot(pod))
+
+	pod.Spec.SecurityContext = nil
+	assert.Equal(t, []string{"init container setup", "container app"}, containersWithoutRunAsNonRoot(pod))
+}
@@ -0,0 +1,157 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/exports"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/nfs"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ExportResolver resolves the NFS export mounted by a volume of a pod created in namespace
+type ExportResolver interface {
+	Export(namespace string, v corev1.Volume) (*nfs.Export, error)
+}
+
+// exportValidator is a container for validating the NFS exports mounted by pods
+type exportValidator struct {
+	Logger  logrus.FieldLogger
+	Exports *exports.Policy
+	// Volumes resolves the exports of volumes, only `nfs:` volumes are validated when nil
+	Volumes ExportResolver
+}
+
+// exportValidator implements the podValidator interface
+var _ podValidator = (*exportValidator)(nil)
+
+// Name returns the name of exportValidator
+func (e exportValidator) Name() string {
+	return "export_validator"
+}
+
+// Validate inspects the NFS volumes of the Pod Spec.
+// The returned validation is only valid if every container mounting an export
+// covered by the export policy runs as one of the UIDs or with one of the GIDs
+// allowed by the policy, if read-only exports (or exports matching one of the
+// read-only patterns) are mounted read-only and if exports requiring Kerberos
+// are mounted with a Kerberos security flavor.
+func (e exportValidator) Validate(_ context.Context, pod *corev1.Pod, a *admissionv1.AdmissionRequest) (validation, error) {
+	for _, v := range pod.Spec.Volumes {
+		export, err := e.export(a.Namespace, v)
+		if err != nil {
+			return lookupFailed(err.Error()), nil
+		}
+		if export == nil {
+			continue
+		}
+
+		mounts := volumeMounts(pod, v.Name)
+		if protected, readOnly := e.Exports.ReadOnly(export.Server, export.Path); readOnly && !export.ReadOnly {
+			for _, m := range mounts {
+				if !m.ReadOnly {
+					v := validation{
+						Valid:  false,
+						Reason: fmt.Sprintf("Invalid mount of read-only export %s in %s, volume %s must be mounted read-only\n", protected, m.Source, v.Name),
+						Code:   CodeReadOnlyExport,
+						Details: map[string]string{
+							"export": protected,
+							"volume": v.Name,
+							"source": m.Source,
+						},
+					}
+					return v, nil
+				}
+			}
+		}
+
+		rule := e.Exports.Match(export.Server, export.Path)
+		if rule == nil {
+			continue
+		}
+
+		if flavors := export.SecurityFlavors(); !rule.AllowsSecurity(flavors) {
+			v := validation{
+				Valid:  false,
+				Reason: fmt.Sprintf("Invalid mount options of export %s, volume %s must be mounted with sec=krb5, krb5i or krb5p, found: %s\n", rule, v.Name, formatFlavors(flavors)),
+				Code:   CodeExportSecurityFlavor,
+				Details: map[string]string{
+					"export":       rule.String(),
+					"volume":       v.Name,
+					"foundFlavors": formatFlavors(flavors),
+				},
+			}
+			return v, nil
+		}
+
+		for _, m := range mounts {
+			if !rule.Allows(m.UID, m.GIDs) {
+				v := validation{
+					Valid:  false,
+					Reason: fmt.Sprintf("Invalid uid for export %s in %s, expected uids: %s or gids: %s, found uid: %s, gids: %v\n", rule, m.Source, rule.UIDs, rule.GIDs, formatUID(m.UID), m.GIDs),
+					Code:   CodeExportIDMismatch,
+					Details: map[string]string{
+						"export":       rule.String(),
+						"volume":       v.Name,
+						"source":       m.Source,
+						"expectedUIDs": rule.UIDs.String(),
+						"expectedGIDs": rule.GIDs.String(),
+						"foundUID":     formatUID(m.UID),
+						"foundGIDs":    formatIDs(m.GIDs),
+					},
+				}
+				return v, nil
+			}
+		}
+		e.Logger.Debugf("volume %s mounts export %s", v.Name, rule)
+	}
+
+	return validation{Valid: true, Reason: "Valid exports"}, nil
+}
+
+// export returns the NFS export mounted by the volume v, nil if it doesn't mount NFS
+func (e exportValidator) export(namespace string, v corev1.Volume) (*nfs.Export, error) {
+	if e.Volumes == nil {
+		return nfs.InlineExport(v), nil
+	}
+	return e.Volumes.Export(namespace, v)
+}
+
+// nfsVolume returns the name of the first volume of the pod mounting an NFS export,
+// "" if there is none. Only `nfs:` volumes are inspected when volumes is nil.
+func nfsVolume(volumes ExportResolver, namespace string, pod *corev1.Pod) (string, error) {
+	for _, v := range pod.Spec.Volumes {
+		var export *nfs.Export
+		if volumes == nil {
+			export = nfs.InlineExport(v)
+		} else {
+			var err error
+			if export, err = volumes.Export(namespace, v); err != nil {
+				return "", err
+			}
+		}
+		if export != nil {
+			return v.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// formatUID formats a UID that may be unset
+func formatUID(uid *int64) string {
+	if uid == nil {
+		return "unset"
+	}
+	return fmt.Sprint(*uid)
+}
+
+// formatFlavors formats the security flavors of the sec mount option
+func formatFlavors(flavors []string) string {
+	if len(flavors) == 0 {
+		return "unset"
+	}
+	return "sec=" + strings.Join(flavors, ":")
+}
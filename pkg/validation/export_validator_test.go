@@ -0,0 +1,91 @@
+package validation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/exports"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/nfs"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// exportResolver resolves every volume to the same export
+type exportResolver nfs.Export
+
+func (r exportResolver) Export(_ string, _ corev1.Volume) (*nfs.Export, error) {
+	e := nfs.Export(r)
+	return &e, nil
+}
+
+func TestExportValidatorMountOptions(t *testing.T) {
+	policy := &exports.Policy{Rules: []exports.Rule{{Server: "nfs", Path: "/exports/secure", RequireKerberos: true}}}
+	uid := int64(1000)
+	pod := &corev1.Pod{Spec: corev1.PodSpec{
+		SecurityContext: &corev1.PodSecurityContext{RunAsUser: &uid},
+		Volumes: []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "secure"},
+		}}},
+	}}
+
+	for options, valid := range map[string]bool{
+		"nfsvers=4.1,sec=krb5p": true,
+		"sec=krb5:krb5i":        true,
+		"nfsvers=4.1,sec=sys":   false,
+		"nfsvers=4.1":           false,
+	} {
+		e := exportValidator{Logger: logrus.New(), Exports: policy, Volumes: exportResolver{
+			Server: "nfs", Path: "/exports/secure", MountOptions: []string{options},
+		}}
+		v, err := e.Validate(context.TODO(), pod, &admissionv1.AdmissionRequest{Namespace: "team-a"})
+		assert.NoError(t, err)
+		assert.Equal(t, valid, v.Valid, options)
+	}
+}
+
+func TestExportValidator(t *testing.T) {
+	e := exportValidator{Logger: logrus.New(), Exports: &exports.Policy{Rules: []exports.Rule{
+		{Server: "nfs", Path: "/exports/teamA", UIDs: mapping.SingleID(2000), GIDs: mapping.SingleID(3000)},
+		{Server: "nfs", Path: "/exports/archive", ReadOnly: true},
+		{Server: "nfs", Path: "/exports/secure", RequireKerberos: true},
+	}, ReadOnlyPatterns: []string{"nfs:/exports/backup-*"}}}
+
+	pod := func(path string, uid int64, readOnly bool, groups ...int64) *corev1.Pod {
+		return &corev1.Pod{Spec: corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{RunAsUser: &uid, SupplementalGroups: groups},
+			Volumes: []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{
+				NFS: &corev1.NFSVolumeSource{Server: "nfs", Path: path},
+			}}},
+			Containers: []corev1.Container{{
+				Name:         "app",
+				VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: "/data", ReadOnly: readOnly}},
+			}},
+		}}
+	}
+
+	tests := []struct {
+		name  string
+		pod   *corev1.Pod
+		valid bool
+	}{
+		{name: "allowed uid", pod: pod("/exports/teamA/data", 2000, false), valid: true},
+		{name: "allowed gid", pod: pod("/exports/teamA", 1000, false, 3000), valid: true},
+		{name: "denied uid", pod: pod("/exports/teamA", 2001, false), valid: false},
+		{name: "export without rule", pod: pod("/exports/teamB", 2001, false), valid: true},
+		{name: "read-only export mounted read-only", pod: pod("/exports/archive", 1000, true), valid: true},
+		{name: "read-only export mounted read-write", pod: pod("/exports/archive", 1000, false), valid: false},
+		{name: "read-only pattern mounted read-only", pod: pod("/exports/backup-db/2024", 1000, true), valid: true},
+		{name: "read-only pattern mounted read-write", pod: pod("/exports/backup-db/2024", 1000, false), valid: false},
+		{name: "kerberos export mounted without sec", pod: pod("/exports/secure", 1000, false), valid: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := e.Validate(context.TODO(), tt.pod, &admissionv1.AdmissionRequest{})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.valid, v.Valid, v.Reason)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// fsGroupValidator is a container for validating the fsGroup of pods
+type fsGroupValidator struct {
+	Logger   logrus.FieldLogger
+	Resolver resolver.UIDResolver
+}
+
+// fsGroupValidator implements the podValidator interface
+var _ podValidator = (*fsGroupValidator)(nil)
+
+// Name returns the name of fsGroupValidator
+func (f fsGroupValidator) Name() string {
+	return "fsgroup_validator"
+}
+
+// Validate inspects the Pod Spec.
+// NFS volumes get chowned according to fsGroup, so the returned validation is only
+// valid if the Pod doesn't set fsGroup with a GID that is not associated with the user
+// in the GID mapping ConfigMap.
+func (f fsGroupValidator) Validate(ctx context.Context, pod *corev1.Pod, a *admissionv1.AdmissionRequest) (validation, error) {
+	securityContext := pod.Spec.SecurityContext
+	if securityContext == nil || securityContext.FSGroup == nil {
+		return validation{Valid: true, Reason: "Valid fsGroup"}, nil
+	}
+
+	user := getUser(f.Logger, a, pod)
+	found := *securityContext.FSGroup
+
+	allowed, err := getGIDs(ctx, f.Resolver, a.Namespace, resolvedSubject(a, user), getGroups(a))
+	if err != nil {
+		return lookupFailed(fmt.Sprintf("Failed resolving identity: %s\n", err)), nil
+	}
+	if len(allowed) == 0 {
+		return unmappedGID(user), nil
+	}
+
+	if !containsID(allowed, found) {
+		v := validation{
+			Valid:  false,
+			Reason: fmt.Sprintf("Invalid fsGroup, expected one of: %v, found: %d\n", allowed, found),
+			Code:   CodeFSGroupMismatch,
+			Details: map[string]string{
+				"subject":      user,
+				"expectedGIDs": formatIDs(allowed),
+				"foundFSGroup": strconv.FormatInt(found, 10),
+			},
+		}
+		return v, nil
+	}
+
+	return validation{Valid: true, Reason: "Valid fsGroup"}, nil
+}
@@ -0,0 +1,53 @@
+package validation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestFSGroupValidator(t *testing.T) {
+	identities := staticResolver{"user1": {UID: int64Ptr(1001), GIDs: []int64{1001, 3000}}}
+
+	tests := []struct {
+		name     string
+		resolver resolver.UIDResolver
+		user     string
+		fsGroup  *int64
+		valid    bool
+		code     string
+	}{
+		{name: "no fsGroup", resolver: identities, user: "user2", valid: true},
+		{name: "mapped gid", resolver: identities, user: "user1", fsGroup: int64Ptr(3000), valid: true},
+		{name: "wrong gid", resolver: identities, user: "user1", fsGroup: int64Ptr(0), valid: false, code: CodeFSGroupMismatch},
+		{name: "unmapped user", resolver: identities, user: "user2", fsGroup: int64Ptr(1001), valid: false, code: CodeUnmappedGID},
+		{name: "resolver error", resolver: failingResolver{}, user: "user1", fsGroup: int64Ptr(1001), valid: false, code: CodeLookupFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{
+				SecurityContext: &corev1.PodSecurityContext{FSGroup: tt.fsGroup},
+				Containers:      []corev1.Container{{Name: "app"}},
+			}}
+			req := &admissionv1.AdmissionRequest{Namespace: "team-a", UserInfo: authenticationv1.UserInfo{Username: tt.user}}
+
+			f := fsGroupValidator{Logger: logrus.New(), Resolver: tt.resolver}
+			got, err := f.Validate(context.TODO(), pod, req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.valid, got.Valid, got.Reason)
+			assert.Equal(t, tt.code, got.Code)
+		})
+	}
+
+	// pods without securityContext don't set fsGroup
+	req := &admissionv1.AdmissionRequest{UserInfo: authenticationv1.UserInfo{Username: "user2"}}
+	got, err := fsGroupValidator{Logger: logrus.New(), Resolver: identities}.Validate(context.TODO(), &corev1.Pod{}, req)
+	assert.NoError(t, err)
+	assert.True(t, got.Valid, got.Reason)
+}
@@ -0,0 +1,99 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// gidValidator is a container for validating the group of pods
+type gidValidator struct {
+	Logger   logrus.FieldLogger
+	Resolver resolver.UIDResolver
+}
+
+// gidValidator implements the podValidator interface
+var _ podValidator = (*gidValidator)(nil)
+
+// Name returns the name of gidValidator
+func (g gidValidator) Name() string {
+	return "gid_validator"
+}
+
+// Validate inspects the Pod Spec.
+// The returned validation is only valid if neither the Pod nor any of its containers
+// set runAsGroup with a GID that is not associated with the user in the GID mapping ConfigMap.
+func (g gidValidator) Validate(ctx context.Context, pod *corev1.Pod, a *admissionv1.AdmissionRequest) (validation, error) {
+	found := runAsGroups(pod)
+	if len(found) == 0 {
+		return validation{Valid: true, Reason: "Valid gid"}, nil
+	}
+
+	user := getUser(g.Logger, a, pod)
+
+	allowed, err := getGIDs(ctx, g.Resolver, a.Namespace, resolvedSubject(a, user), getGroups(a))
+	if err != nil {
+		return lookupFailed(fmt.Sprintf("Failed resolving identity: %s\n", err)), nil
+	}
+	if len(allowed) == 0 {
+		return unmappedGID(user), nil
+	}
+
+	for _, f := range found {
+		if !containsID(allowed, f.ID) {
+			v := validation{
+				Valid:  false,
+				Reason: fmt.Sprintf("Invalid gid in %s, expected one of: %v, found: %d\n", f.Source, allowed, f.ID),
+				Code:   CodeGIDMismatch,
+				Details: map[string]string{
+					"subject":      user,
+					"source":       f.Source,
+					"expectedGIDs": formatIDs(allowed),
+					"foundGID":     strconv.FormatInt(f.ID, 10),
+				},
+			}
+			return v, nil
+		}
+	}
+
+	return validation{Valid: true, Reason: "Valid gid"}, nil
+}
+
+// getGIDs returns the GIDs associated with user, none when it has no GID
+// associated with it. The error is the failure of the resolver.
+func getGIDs(ctx context.Context, r resolver.UIDResolver, namespace, user string, groups []string) ([]int64, error) {
+	identity, err := resolver.ResolveUser(ctx, r, namespace, user, groups)
+	if err != nil && !errors.Is(err, resolver.ErrNotFound) {
+		return nil, err
+	}
+	return identity.GIDs, nil
+}
+
+// unmappedGID returns the validation denying a pod because user has no GID
+// associated with it
+func unmappedGID(user string) validation {
+	return validation{
+		Valid:  false,
+		Reason: fmt.Sprintf("User %s has no GID associated with it\n", user),
+		Code:   CodeUnmappedGID,
+		Details: map[string]string{
+			"subject": user,
+		},
+	}
+}
+
+// containsID returns true if id is part of ids
+func containsID(ids []int64, id int64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
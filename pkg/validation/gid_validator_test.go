@@ -0,0 +1,65 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// failingResolver fails to resolve every subject
+type failingResolver struct{}
+
+func (failingResolver) Resolve(_ context.Context, _ string) (resolver.IdentitySpec, error) {
+	return resolver.IdentitySpec{}, errors.New("connection refused")
+}
+
+func TestGIDValidator(t *testing.T) {
+	identities := staticResolver{
+		"user1": {UID: int64Ptr(1001), GIDs: []int64{1001, 3000}},
+		"user3": {UID: int64Ptr(1003)},
+	}
+
+	tests := []struct {
+		name       string
+		resolver   resolver.UIDResolver
+		user       string
+		runAsGroup *int64
+		valid      bool
+		code       string
+	}{
+		{name: "image default gid", resolver: identities, user: "user2", valid: true},
+		{name: "mapped gid", resolver: identities, user: "user1", runAsGroup: int64Ptr(3000), valid: true},
+		{name: "wrong gid", resolver: identities, user: "user1", runAsGroup: int64Ptr(0), valid: false, code: CodeGIDMismatch},
+		{name: "unmapped user", resolver: identities, user: "user2", runAsGroup: int64Ptr(1001), valid: false, code: CodeUnmappedGID},
+		{name: "user without gid", resolver: identities, user: "user3", runAsGroup: int64Ptr(1003), valid: false, code: CodeUnmappedGID},
+		{name: "resolver error", resolver: failingResolver{}, user: "user1", runAsGroup: int64Ptr(1001), valid: false, code: CodeLookupFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{
+				SecurityContext: &corev1.PodSecurityContext{RunAsGroup: tt.runAsGroup},
+				Containers:      []corev1.Container{{Name: "app"}},
+			}}
+			req := &admissionv1.AdmissionRequest{Namespace: "team-a", UserInfo: authenticationv1.UserInfo{Username: tt.user}}
+
+			g := gidValidator{Logger: logrus.New(), Resolver: tt.resolver}
+			got, err := g.Validate(context.TODO(), pod, req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.valid, got.Valid, got.Reason)
+			assert.Equal(t, tt.code, got.Code)
+		})
+	}
+}
+
+func TestContainsID(t *testing.T) {
+	assert.True(t, containsID([]int64{1, 2, 3}, 2))
+	assert.False(t, containsID([]int64{1, 2, 3}, 4))
+	assert.False(t, containsID(nil, 0))
+}
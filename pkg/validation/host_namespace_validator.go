@@ -0,0 +1,64 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// hostNamespaceValidator is a container for denying pods mounting NFS in the
+// network, PID or IPC namespace of their node
+type hostNamespaceValidator struct {
+	Logger logrus.FieldLogger
+	// Volumes resolves the exports of volumes, only `nfs:` volumes are inspected when nil
+	Volumes ExportResolver
+}
+
+// hostNamespaceValidator implements the podValidator interface
+var _ podValidator = (*hostNamespaceValidator)(nil)
+
+// Name returns the name of hostNamespaceValidator
+func (h hostNamespaceValidator) Name() string {
+	return "host_namespace_validator"
+}
+
+// Validate returns an invalid validation if the pod mounts NFS and sets hostNetwork,
+// hostPID or hostIPC: hostNetwork pods can spoof the source IPs export rules rely
+// on, and the others can reach the processes and credentials of other pods
+func (h hostNamespaceValidator) Validate(_ context.Context, pod *corev1.Pod, a *admissionv1.AdmissionRequest) (validation, error) {
+	var host []string
+	if pod.Spec.HostNetwork {
+		host = append(host, "hostNetwork")
+	}
+	if pod.Spec.HostPID {
+		host = append(host, "hostPID")
+	}
+	if pod.Spec.HostIPC {
+		host = append(host, "hostIPC")
+	}
+	if len(host) == 0 {
+		return validation{Valid: true, Reason: "no host namespace"}, nil
+	}
+
+	volume, err := nfsVolume(h.Volumes, a.Namespace, pod)
+	if err != nil {
+		return lookupFailed(err.Error()), nil
+	}
+	if volume == "" {
+		return validation{Valid: true, Reason: "no NFS volume"}, nil
+	}
+	v := validation{
+		Valid:  false,
+		Reason: fmt.Sprintf("%s is not allowed for pods mounting NFS, found volume %s\n", strings.Join(host, ", "), volume),
+		Code:   CodeHostNamespace,
+		Details: map[string]string{
+			"hostNamespaces": strings.Join(host, ","),
+			"volume":         volume,
+		},
+	}
+	return v, nil
+}
@@ -0,0 +1,36 @@
+package validation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestHostNamespaceValidator(t *testing.T) {
+	nfsVolume := corev1.Volume{Name: "data", VolumeSource: corev1.VolumeSource{NFS: &corev1.NFSVolumeSource{Server: "nfs", Path: "/exports"}}}
+	emptyDir := corev1.Volume{Name: "tmp", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}
+
+	tests := []struct {
+		name  string
+		spec  corev1.PodSpec
+		valid bool
+	}{
+		{name: "hostNetwork", spec: corev1.PodSpec{HostNetwork: true, Volumes: []corev1.Volume{emptyDir, nfsVolume}}, valid: false},
+		{name: "hostPID", spec: corev1.PodSpec{HostPID: true, Volumes: []corev1.Volume{nfsVolume}}, valid: false},
+		{name: "hostIPC", spec: corev1.PodSpec{HostIPC: true, Volumes: []corev1.Volume{nfsVolume}}, valid: false},
+		{name: "no host namespace", spec: corev1.PodSpec{Volumes: []corev1.Volume{nfsVolume}}, valid: true},
+		{name: "no NFS volume", spec: corev1.PodSpec{HostNetwork: true, Volumes: []corev1.Volume{emptyDir}}, valid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := hostNamespaceValidator{Logger: logrus.New()}
+			v, err := h.Validate(context.Background(), &corev1.Pod{Spec: tt.spec}, &admissionv1.AdmissionRequest{Namespace: "team-a"})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.valid, v.Valid, v.Reason)
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/exports"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/nfs"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Krb5PrincipalAnnotation is the pod annotation naming the Kerberos principal
+// whose tickets are provided to the pod, e.g. by a ticket renewal sidecar
+const Krb5PrincipalAnnotation = "nfs-access-control/krb5-principal"
+
+// PrincipalResolver resolves the Kerberos principals mapped to users and serviceAccounts
+type PrincipalResolver interface {
+	Principal(subject string) (mapping.Principal, bool, error)
+	Principals() (map[string]mapping.Principal, error)
+}
+
+// krb5Validator is a container for validating the Kerberos credentials of pods
+type krb5Validator struct {
+	Logger     logrus.FieldLogger
+	Principals PrincipalResolver
+	// Volumes resolves the exports of volumes, only `nfs:` volumes are inspected when nil
+	Volumes ExportResolver
+}
+
+// krb5Validator implements the podValidator interface
+var _ podValidator = (*krb5Validator)(nil)
+
+// Name returns the name of krb5Validator
+func (k krb5Validator) Name() string {
+	return "krb5_validator"
+}
+
+// Validate inspects the Secret volumes, the annotations and the NFS volumes of the Pod.
+// The returned validation is only valid if the pod doesn't mount the keytab Secret
+// of a principal mapped to another user/serviceAccount and, when it mounts an
+// export with sec=krb5, krb5i or krb5p, if it references the principal mapped to
+// the user/serviceAccount: by mounting its keytab Secret or by naming it in the
+// nfs-access-control/krb5-principal annotation.
+func (k krb5Validator) Validate(_ context.Context, pod *corev1.Pod, a *admissionv1.AdmissionRequest) (validation, error) {
+	user := getUser(k.Logger, a, pod)
+
+	principals, err := k.Principals.Principals()
+	if err != nil {
+		return lookupFailed(err.Error()), nil
+	}
+	secrets := podSecrets(pod)
+	for subject, p := range principals {
+		if subject != user && p.KeytabSecret != "" && secrets[p.KeytabSecret] {
+			v := validation{
+				Valid:  false,
+				Reason: fmt.Sprintf("Invalid keytab Secret %s, it belongs to principal %s of %s\n", p.KeytabSecret, p.Name, subject),
+				Code:   CodeForeignKeytab,
+				Details: map[string]string{
+					"subject":      user,
+					"keytabSecret": p.KeytabSecret,
+				},
+			}
+			return v, nil
+		}
+	}
+
+	annotation, annotated := pod.Annotations[Krb5PrincipalAnnotation]
+	volume, err := k.krb5Volume(a.Namespace, pod)
+	if err != nil {
+		return lookupFailed(err.Error()), nil
+	}
+	if volume == "" && !annotated {
+		return validation{Valid: true, Reason: "Valid Kerberos credentials"}, nil
+	}
+
+	p, found, err := k.Principals.Principal(user)
+	if err != nil {
+		return lookupFailed(err.Error()), nil
+	}
+	if !found {
+		v := validation{
+			Valid:  false,
+			Reason: fmt.Sprintf("User %s has no Kerberos principal associated with it\n", user),
+			Code:   CodeUnmappedPrincipal,
+			Details: map[string]string{
+				"subject": user,
+			},
+		}
+		return v, nil
+	}
+	if annotated && annotation != p.Name {
+		v := validation{
+			Valid:  false,
+			Reason: fmt.Sprintf("Invalid Kerberos principal in annotation %s, expected: %s, found: %s\n", Krb5PrincipalAnnotation, p.Name, annotation),
+			Code:   CodePrincipalMismatch,
+			Details: map[string]string{
+				"subject":           user,
+				"expectedPrincipal": p.Name,
+				"foundPrincipal":    annotation,
+			},
+		}
+		return v, nil
+	}
+	if !annotated && (p.KeytabSecret == "" || !secrets[p.KeytabSecret]) {
+		v := validation{
+			Valid:  false,
+			Reason: fmt.Sprintf("Missing Kerberos credentials for volume %s, expected keytab Secret %q or annotation %s: %s\n", volume, p.KeytabSecret, Krb5PrincipalAnnotation, p.Name),
+			Code:   CodeMissingKerberosCredentials,
+			Details: map[string]string{
+				"subject":           user,
+				"volume":            volume,
+				"expectedPrincipal": p.Name,
+			},
+		}
+		return v, nil
+	}
+
+	return validation{Valid: true, Reason: "Valid Kerberos credentials"}, nil
+}
+
+// krb5Volume returns the name of the first volume mounting an export with a
+// Kerberos security flavor, "" if there is none
+func (k krb5Validator) krb5Volume(namespace string, pod *corev1.Pod) (string, error) {
+	for _, v := range pod.Spec.Volumes {
+		var export *nfs.Export
+		if k.Volumes == nil {
+			export = nfs.InlineExport(v)
+		} else {
+			var err error
+			if export, err = k.Volumes.Export(namespace, v); err != nil {
+				return "", err
+			}
+		}
+		if export != nil && exports.IsKerberos(export.SecurityFlavors()) {
+			return v.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// podSecrets returns the names of the Secrets mounted by the volumes of a pod,
+// including the Secret sources of projected volumes
+func podSecrets(pod *corev1.Pod) map[string]bool {
+	secrets := map[string]bool{}
+	for _, v := range pod.Spec.Volumes {
+		if v.Secret != nil {
+			secrets[v.Secret.SecretName] = true
+		}
+		if v.Projected != nil {
+			for _, source := range v.Projected.Sources {
+				if source.Secret != nil {
+					secrets[source.Secret.Name] = true
+				}
+			}
+		}
+	}
+	return secrets
+}
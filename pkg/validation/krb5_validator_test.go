@@ -0,0 +1,82 @@
+package validation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// principalResolver maps subjects to Kerberos principals
+type principalResolver map[string]mapping.Principal
+
+func (r principalResolver) Principal(subject string) (mapping.Principal, bool, error) {
+	p, found := r[subject]
+	return p, found, nil
+}
+
+func (r principalResolver) Principals() (map[string]mapping.Principal, error) {
+	return r, nil
+}
+
+func TestKrb5Validator(t *testing.T) {
+	k := krb5Validator{
+		Logger: logrus.New(),
+		Principals: principalResolver{
+			"user1": {Name: "user1@EXAMPLE.COM", KeytabSecret: "user1-keytab"},
+			"user2": {Name: "user2@EXAMPLE.COM", KeytabSecret: "user2-keytab"},
+		},
+		Volumes: exportResolver{Server: "nfs", Path: "/exports/secure", MountOptions: []string{"sec=krb5p"}},
+	}
+
+	pod := func(annotation string, secrets ...string) *corev1.Pod {
+		pod := &corev1.Pod{Spec: corev1.PodSpec{Volumes: []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "secure"},
+		}}}}}
+		if annotation != "" {
+			pod.ObjectMeta = metav1.ObjectMeta{Annotations: map[string]string{Krb5PrincipalAnnotation: annotation}}
+		}
+		for _, secret := range secrets {
+			pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{Name: secret, VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{SecretName: secret},
+			}})
+		}
+		return pod
+	}
+
+	tests := []struct {
+		name  string
+		user  string
+		pod   *corev1.Pod
+		valid bool
+	}{
+		{name: "own keytab", user: "user1", pod: pod("", "user1-keytab"), valid: true},
+		{name: "own principal annotation", user: "user1", pod: pod("user1@EXAMPLE.COM"), valid: true},
+		{name: "keytab of another team", user: "user1", pod: pod("", "user1-keytab", "user2-keytab"), valid: false},
+		{name: "principal of another team", user: "user1", pod: pod("user2@EXAMPLE.COM"), valid: false},
+		{name: "missing credentials", user: "user1", pod: pod(""), valid: false},
+		{name: "unmapped user", user: "user3", pod: pod("", "user1-keytab"), valid: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &admissionv1.AdmissionRequest{Namespace: "team-a", UserInfo: authenticationv1.UserInfo{Username: tt.user}}
+			v, err := k.Validate(context.TODO(), tt.pod, a)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.valid, v.Valid, v.Reason)
+		})
+	}
+
+	// pods without Kerberos exports only need to keep away from other keytabs
+	k.Volumes = nil
+	a := &admissionv1.AdmissionRequest{Namespace: "team-a", UserInfo: authenticationv1.UserInfo{Username: "user3"}}
+	v, _ := k.Validate(context.TODO(), pod(""), a)
+	assert.True(t, v.Valid, v.Reason)
+	v, _ = k.Validate(context.TODO(), pod("", "user2-keytab"), a)
+	assert.False(t, v.Valid)
+}
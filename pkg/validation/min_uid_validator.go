@@ -0,0 +1,63 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// minUIDValidator is a container for denying pods running as root or as a system
+// UID, whatever the UIDs mapped to their user/serviceAccount
+type minUIDValidator struct {
+	Logger logrus.FieldLogger
+	// MinUID is the lowest UID pods may run as, 0 disables the threshold
+	MinUID int64
+	// BlockRootUID denies pods running as UID 0
+	BlockRootUID bool
+}
+
+// minUIDValidator implements the podValidator interface
+var _ podValidator = (*minUIDValidator)(nil)
+
+// Name returns the name of minUIDValidator
+func (m minUIDValidator) Name() string {
+	return "min_uid_validator"
+}
+
+// Validate returns an invalid validation if the pod or any of its containers sets
+// runAsUser to 0 or below the minimum UID, even if the UID is mapped to the
+// user/serviceAccount, e.g. by mistake
+func (m minUIDValidator) Validate(_ context.Context, pod *corev1.Pod, _ *admissionv1.AdmissionRequest) (validation, error) {
+	for _, f := range runAsUsers(pod) {
+		if m.BlockRootUID && f.ID == 0 {
+			v := validation{
+				Valid:  false,
+				Reason: fmt.Sprintf("Invalid uid in %s, running as root is not allowed\n", f.Source),
+				Code:   CodeRootUID,
+				Details: map[string]string{
+					"source":   f.Source,
+					"foundUID": "0",
+				},
+			}
+			return v, nil
+		}
+		if f.ID < m.MinUID {
+			v := validation{
+				Valid:  false,
+				Reason: fmt.Sprintf("Invalid uid in %s, expected at least: %d, found: %d\n", f.Source, m.MinUID, f.ID),
+				Code:   CodeUIDBelowMinimum,
+				Details: map[string]string{
+					"source":   f.Source,
+					"minUID":   strconv.FormatInt(m.MinUID, 10),
+					"foundUID": strconv.FormatInt(f.ID, 10),
+				},
+			}
+			return v, nil
+		}
+	}
+	return validation{Valid: true, Reason: "uid above minimum"}, nil
+}
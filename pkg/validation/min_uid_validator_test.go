@@ -0,0 +1,42 @@
+package validation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestMinUIDValidator(t *testing.T) {
+	tests := []struct {
+		name         string
+		minUID       int64
+		blockRoot    bool
+		runAsUser    *int64
+		containerUID *int64
+		valid        bool
+	}{
+		{name: "uid above minimum", minUID: 1000, runAsUser: int64Ptr(1001), valid: true},
+		{name: "system uid", minUID: 1000, runAsUser: int64Ptr(999), valid: false},
+		{name: "container system uid", minUID: 1000, runAsUser: int64Ptr(1001), containerUID: int64Ptr(33), valid: false},
+		{name: "image default uid", minUID: 1000, valid: true},
+		{name: "root blocked", blockRoot: true, runAsUser: int64Ptr(0), valid: false},
+		{name: "root allowed", runAsUser: int64Ptr(0), valid: true},
+		{name: "no minimum", blockRoot: true, runAsUser: int64Ptr(1), valid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{
+				SecurityContext: &corev1.PodSecurityContext{RunAsUser: tt.runAsUser},
+				Containers:      []corev1.Container{{Name: "app", SecurityContext: &corev1.SecurityContext{RunAsUser: tt.containerUID}}},
+			}}
+			m := minUIDValidator{Logger: logrus.New(), MinUID: tt.minUID, BlockRootUID: tt.blockRoot}
+			v, err := m.Validate(context.Background(), pod, &admissionv1.AdmissionRequest{})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.valid, v.Valid, v.Reason)
+		})
+	}
+}
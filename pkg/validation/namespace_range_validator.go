@@ -0,0 +1,68 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NamespaceRangeResolver returns the UIDs the pods of a namespace may run as
+type NamespaceRangeResolver interface {
+	UIDRange(namespace string) (uids mapping.IDRanges, found bool, err error)
+}
+
+// namespaceRangeValidator is a container for validating the runAsUser of pods
+// against the UID range of their namespace
+type namespaceRangeValidator struct {
+	Logger logrus.FieldLogger
+	Ranges NamespaceRangeResolver
+}
+
+// namespaceRangeValidator implements the podValidator interface
+var _ podValidator = (*namespaceRangeValidator)(nil)
+
+// Name returns the name of namespaceRangeValidator
+func (n namespaceRangeValidator) Name() string {
+	return "namespace_uid_range_validator"
+}
+
+// Validate returns an invalid validation if the pod or any of its containers sets
+// runAsUser outside of the UID range of the pod namespace, whether the UID is
+// mapped to the user/serviceAccount or not. Namespaces without a range are not
+// restricted.
+func (n namespaceRangeValidator) Validate(_ context.Context, pod *corev1.Pod, a *admissionv1.AdmissionRequest) (validation, error) {
+	namespace := a.Namespace
+	if namespace == "" {
+		namespace = pod.Namespace
+	}
+	expected, found, err := n.Ranges.UIDRange(namespace)
+	if err != nil {
+		return lookupFailed(fmt.Sprintf("Failed getting UID range of namespace %s: %s\n", namespace, err)), nil
+	}
+	if !found {
+		return validation{Valid: true, Reason: "no namespace UID range"}, nil
+	}
+
+	for _, f := range runAsUsers(pod) {
+		if !expected.Contains(f.ID) {
+			v := validation{
+				Valid:  false,
+				Reason: fmt.Sprintf("Invalid uid in %s, namespace %s is restricted to UIDs %s, found: %d\n", f.Source, namespace, expected, f.ID),
+				Code:   CodeUIDOutOfNamespaceRange,
+				Details: map[string]string{
+					"namespace":   namespace,
+					"source":      f.Source,
+					"expectedUID": expected.String(),
+					"foundUID":    strconv.FormatInt(f.ID, 10),
+				},
+			}
+			return v, nil
+		}
+	}
+	return validation{Valid: true, Reason: "uid within namespace UID range"}, nil
+}
@@ -0,0 +1,66 @@
+package validation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/uidrange"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNamespaceRangeValidator(t *testing.T) {
+	namespace := func(name, uidRange string) *corev1.Namespace {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if uidRange != "" {
+			ns.Annotations = map[string]string{uidrange.Annotation: uidRange}
+		}
+		return ns
+	}
+	client := fake.NewSimpleClientset(
+		namespace("team-a", "3000-3999"),
+		namespace("team-b", "1000060000/10000"),
+		namespace("typo", "3000-39OO"),
+		namespace("open", ""),
+	)
+	stop := make(chan struct{})
+	defer close(stop)
+	ranges := uidrange.NewRanges(client)
+	if err := ranges.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+	n := namespaceRangeValidator{Logger: logrus.New(), Ranges: ranges}
+
+	tests := []struct {
+		name         string
+		namespace    string
+		runAsUser    *int64
+		containerUID *int64
+		valid        bool
+	}{
+		{name: "uid in range", namespace: "team-a", runAsUser: int64Ptr(3500), valid: true},
+		{name: "uid out of range", namespace: "team-a", runAsUser: int64Ptr(1001), valid: false},
+		{name: "container uid out of range", namespace: "team-a", runAsUser: int64Ptr(3500), containerUID: int64Ptr(4000), valid: false},
+		{name: "image default uid", namespace: "team-a", valid: true},
+		{name: "openshift notation", namespace: "team-b", runAsUser: int64Ptr(1000069999), valid: true},
+		{name: "openshift notation out of range", namespace: "team-b", runAsUser: int64Ptr(1000070000), valid: false},
+		{name: "malformed range", namespace: "typo", runAsUser: int64Ptr(3500), valid: false},
+		{name: "no range", namespace: "open", runAsUser: int64Ptr(0), valid: true},
+		{name: "unknown namespace", namespace: "other", runAsUser: int64Ptr(0), valid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{
+				SecurityContext: &corev1.PodSecurityContext{RunAsUser: tt.runAsUser},
+				Containers:      []corev1.Container{{Name: "app", SecurityContext: &corev1.SecurityContext{RunAsUser: tt.containerUID}}},
+			}}
+			v, err := n.Validate(context.Background(), pod, &admissionv1.AdmissionRequest{Namespace: tt.namespace})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.valid, v.Valid, v.Reason)
+		})
+	}
+}
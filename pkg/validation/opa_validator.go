@@ -0,0 +1,68 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/opa"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// opaValidator is a container for validating pods with Open Policy Agent
+type opaValidator struct {
+	Logger   logrus.FieldLogger
+	Resolver resolver.UIDResolver
+	Engine   opa.Engine
+}
+
+// opaValidator implements the podValidator interface
+var _ podValidator = (*opaValidator)(nil)
+
+// Name returns the name of opaValidator
+func (o opaValidator) Name() string {
+	return "opa_validator"
+}
+
+// Validate evaluates the OPA decision for the admission request, the pod and the
+// identity resolved for the user/serviceAccount. The returned validation is only
+// valid if the decision allows the pod, it is exempt from the other validators
+// when the decision says so.
+func (o opaValidator) Validate(ctx context.Context, pod *corev1.Pod, a *admissionv1.AdmissionRequest) (validation, error) {
+	user := getUser(o.Logger, a, pod)
+	groups := getGroups(a)
+
+	var id *resolver.IdentitySpec
+	identity, err := resolver.ResolveUser(ctx, o.Resolver, a.Namespace, resolvedSubject(a, user), groups)
+	switch {
+	case err == nil:
+		id = &identity
+	case !errors.Is(err, resolver.ErrNotFound):
+		return lookupFailed(fmt.Sprintf("Failed resolving identity: %s\n", err)), nil
+	}
+
+	d, err := o.Engine.Decide(ctx, opa.Input{Request: a, Pod: pod, Identity: opa.NewIdentity(user, groups, id)})
+	if err != nil {
+		return lookupFailed(err.Error()), nil
+	}
+	o.Logger.WithFields(logrus.Fields{
+		"decision_id": d.ID,
+		"allowed":     d.Allowed,
+		"exempt":      d.Exempt,
+	}).Info("OPA decision")
+
+	if !d.Allowed {
+		reason := d.Reason
+		if reason == "" {
+			reason = "Denied by OPA policy\n"
+		}
+		return validation{Valid: false, Reason: reason, Code: CodeOPADenied, Details: map[string]string{"decisionID": d.ID}}, nil
+	}
+	if d.Exempt {
+		return validation{Valid: true, Exempt: true, Reason: fmt.Sprintf("Exempted by OPA policy: %s", d.Reason)}, nil
+	}
+	return validation{Valid: true, Reason: "Allowed by OPA policy"}, nil
+}
@@ -0,0 +1,59 @@
+package validation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/opa"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// subjectEngine returns the decision of the subject of the input
+type subjectEngine map[string]opa.Decision
+
+func (e subjectEngine) Decide(_ context.Context, input opa.Input) (opa.Decision, error) {
+	return e[input.Identity.Subject], nil
+}
+
+func TestOPAValidator(t *testing.T) {
+	identities := staticResolver{"user1": {UID: int64Ptr(1001)}}
+	engine := subjectEngine{
+		"user1":  {Allowed: true},
+		"user2":  {Allowed: false, Reason: "user2 is suspended"},
+		"backup": {Allowed: true, Exempt: true, Reason: "backup exception"},
+	}
+	pod := &corev1.Pod{Spec: corev1.PodSpec{
+		SecurityContext: &corev1.PodSecurityContext{RunAsUser: int64Ptr(0)},
+		Containers:      []corev1.Container{{Name: "app"}},
+	}}
+
+	tests := []struct {
+		user      string
+		valid     bool
+		validator string
+		reason    string
+	}{
+		// the uid validator still denies pods allowed by OPA
+		{user: "user1", valid: false, validator: "uid_validator"},
+		{user: "user2", valid: false, validator: "opa_validator", reason: "user2 is suspended"},
+		{user: "user3", valid: false, validator: "opa_validator", reason: "Denied by OPA policy\n"},
+		{user: "backup", valid: true, reason: "Exempted by OPA policy: backup exception"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.user, func(t *testing.T) {
+			req := &admissionv1.AdmissionRequest{Namespace: "team-a", UserInfo: authenticationv1.UserInfo{Username: tt.user}}
+			v := NewValidator(logrus.NewEntry(logrus.New()), Policy{OPA: engine}, identities)
+			got, err := v.ValidatePod(context.TODO(), pod, req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.valid, got.Valid, got.Reason)
+			assert.Equal(t, tt.validator, got.Validator)
+			if tt.reason != "" {
+				assert.Equal(t, tt.reason, got.Reason)
+			}
+		})
+	}
+}
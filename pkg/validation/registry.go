@@ -0,0 +1,251 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ValidatorMode tells how the denials of a validator are acted on
+type ValidatorMode string
+
+const (
+	// ValidatorEnforce denies the pods the validator finds invalid
+	ValidatorEnforce ValidatorMode = "enforce"
+	// ValidatorAudit admits the pods the validator finds invalid, recording the
+	// would-be denial, and runs the next validators
+	ValidatorAudit ValidatorMode = "audit"
+)
+
+// Chain selects the validators applied to pods, their order and their mode.
+// Validators are only applied when enabled by the Policy too, e.g. the export
+// validator requires an export policy.
+type Chain struct {
+	// Names are the names of the validators applied, in order, every registered
+	// validator in its default order when empty
+	Names []string
+	// Modes holds the modes of validators by name, enforce when unset
+	Modes map[string]ValidatorMode
+}
+
+// validatorFactory returns the validator of a pod set up by the Policy of v, nil
+// if the Policy disables it or it doesn't apply to the pod
+type validatorFactory func(v *Validator, logger *logrus.Entry, pod *corev1.Pod) podValidator
+
+// registration is a validator registered by name
+type registration struct {
+	name string
+	new  validatorFactory
+}
+
+// registry holds the validators in their default order. OPA goes first so that
+// its policies can exempt pods from the others.
+var registry = []registration{
+	{name: "opa_validator", new: func(v *Validator, logger *logrus.Entry, _ *corev1.Pod) podValidator {
+		if v.Policy.OPA == nil {
+			return nil
+		}
+		return opaValidator{Logger: logger, Resolver: v.Resolver, Engine: v.Policy.OPA}
+	}},
+	{name: "collision_validator", new: func(v *Validator, logger *logrus.Entry, _ *corev1.Pod) podValidator {
+		if v.Policy.Collisions == nil {
+			return nil
+		}
+		return collisionValidator{Logger: logger, Collisions: v.Policy.Collisions}
+	}},
+	{name: "windows_validator", new: func(v *Validator, logger *logrus.Entry, pod *corev1.Pod) podValidator {
+		if !IsWindowsPod(pod) || (v.Policy.WindowsPods != WindowsValidate && v.Policy.WindowsPods != WindowsDeny) {
+			return nil
+		}
+		return windowsValidator{Logger: logger, Policy: v.Policy.WindowsPods, UserNames: v.Policy.WindowsUserNames}
+	}},
+	{name: "user_namespace_validator", new: linux(func(v *Validator, logger *logrus.Entry, _ *corev1.Pod) podValidator {
+		if !v.Policy.RequireUserNamespaces {
+			return nil
+		}
+		return userNamespaceValidator{Logger: logger}
+	})},
+	{name: "run_as_non_root_validator", new: linux(func(v *Validator, logger *logrus.Entry, _ *corev1.Pod) podValidator {
+		if !v.Policy.RequireRunAsNonRoot {
+			return nil
+		}
+		return runAsNonRootValidator{Logger: logger}
+	})},
+	{name: "min_uid_validator", new: linux(func(v *Validator, logger *logrus.Entry, _ *corev1.Pod) podValidator {
+		if v.Policy.MinUID <= 0 && !v.Policy.BlockRootUID {
+			return nil
+		}
+		return minUIDValidator{Logger: logger, MinUID: v.Policy.MinUID, BlockRootUID: v.Policy.BlockRootUID}
+	})},
+	{name: "namespace_uid_range_validator", new: linux(func(v *Validator, logger *logrus.Entry, _ *corev1.Pod) podValidator {
+		if v.Policy.NamespaceRanges == nil {
+			return nil
+		}
+		return namespaceRangeValidator{Logger: logger, Ranges: v.Policy.NamespaceRanges}
+	})},
+	{name: "uid_validator", new: mapped(func(v *Validator, logger *logrus.Entry, _ *corev1.Pod) podValidator {
+		return uidValidator{Logger: logger, Resolver: v.Resolver, RequireRunAsUser: v.Policy.RequireRunAsUser, SCCRanges: v.Policy.SCCRanges}
+	})},
+	{name: "gid_validator", new: mapped(func(v *Validator, logger *logrus.Entry, _ *corev1.Pod) podValidator {
+		return gidValidator{Logger: logger, Resolver: v.Resolver}
+	})},
+	{name: "fsgroup_validator", new: mapped(func(v *Validator, logger *logrus.Entry, _ *corev1.Pod) podValidator {
+		return fsGroupValidator{Logger: logger, Resolver: v.Resolver}
+	})},
+	{name: "supplemental_groups_validator", new: mapped(func(v *Validator, logger *logrus.Entry, _ *corev1.Pod) podValidator {
+		return supplementalGroupsValidator{Logger: logger, Resolver: v.Resolver}
+	})},
+	{name: "host_namespace_validator", new: func(v *Validator, logger *logrus.Entry, _ *corev1.Pod) podValidator {
+		if !v.Policy.DenyHostNamespaces {
+			return nil
+		}
+		return hostNamespaceValidator{Logger: logger, Volumes: v.Policy.Volumes}
+	}},
+	{name: "export_validator", new: func(v *Validator, logger *logrus.Entry, _ *corev1.Pod) podValidator {
+		if v.Policy.Exports == nil {
+			return nil
+		}
+		return exportValidator{Logger: logger, Exports: v.Policy.Exports, Volumes: v.Policy.Volumes}
+	}},
+	{name: "krb5_validator", new: func(v *Validator, logger *logrus.Entry, _ *corev1.Pod) podValidator {
+		if v.Policy.Principals == nil {
+			return nil
+		}
+		return krb5Validator{Logger: logger, Principals: v.Policy.Principals, Volumes: v.Policy.Volumes}
+	}},
+	{name: "selinux_validator", new: func(v *Validator, logger *logrus.Entry, _ *corev1.Pod) podValidator {
+		if v.Policy.SELinux == nil {
+			return nil
+		}
+		return seLinuxValidator{Logger: logger, SELinux: v.Policy.SELinux, Volumes: v.Policy.Volumes}
+	}},
+	{name: "time_window_validator", new: func(v *Validator, logger *logrus.Entry, _ *corev1.Pod) podValidator {
+		if v.Policy.TimeWindows == nil {
+			return nil
+		}
+		return timeWindowValidator{Logger: logger, TimeWindows: v.Policy.TimeWindows, Volumes: v.Policy.Volumes}
+	}},
+	{name: "access_policy_validator", new: func(v *Validator, logger *logrus.Entry, _ *corev1.Pod) podValidator {
+		if v.Policy.AccessPolicies == nil {
+			return nil
+		}
+		return accessPolicyValidator{Logger: logger, Resolver: v.Resolver, Policies: v.Policy.AccessPolicies}
+	}},
+}
+
+// linux restricts a validator of Linux IDs to the pods not targeting Windows nodes,
+// on which runAsUser and the other Linux IDs don't apply
+func linux(f validatorFactory) validatorFactory {
+	return func(v *Validator, logger *logrus.Entry, pod *corev1.Pod) podValidator {
+		if IsWindowsPod(pod) {
+			return nil
+		}
+		return f(v, logger, pod)
+	}
+}
+
+// mapped restricts a validator of the IDs mapped to users and serviceAccounts to
+// the Linux pods, skipping the ones running in a user namespace when relaxed
+func mapped(f validatorFactory) validatorFactory {
+	return linux(func(v *Validator, logger *logrus.Entry, pod *corev1.Pod) podValidator {
+		if v.Policy.RelaxUserNamespaces && usesUserNamespace(pod) {
+			return nil
+		}
+		return f(v, logger, pod)
+	})
+}
+
+// Validators returns the names of the registered validators, in their default order
+func Validators() []string {
+	names := make([]string, len(registry))
+	for i, r := range registry {
+		names[i] = r.name
+	}
+	return names
+}
+
+// registered returns the registration of the validator name
+func registered(name string) (registration, bool) {
+	for _, r := range registry {
+		if r.name == name {
+			return r, true
+		}
+	}
+	return registration{}, false
+}
+
+// validators returns the validators of the chain of the Policy of v applying to pod
+func (v *Validator) validators(logger *logrus.Entry, pod *corev1.Pod) []podValidator {
+	names := v.Policy.Chain.Names
+	if len(names) == 0 {
+		names = Validators()
+	}
+	var validators []podValidator
+	for _, name := range names {
+		r, ok := registered(name)
+		if !ok {
+			continue
+		}
+		if validator := r.new(v, logger, pod); validator != nil {
+			validators = append(validators, validator)
+		}
+	}
+	return validators
+}
+
+// mode returns the mode of the validator name
+func (c Chain) mode(name string) ValidatorMode {
+	if mode, ok := c.Modes[name]; ok {
+		return mode
+	}
+	return ValidatorEnforce
+}
+
+// ParseChain returns the Chain described by a comma separated list of validator
+// names, e.g. "opa_validator,uid_validator", and a comma separated list of
+// name=mode pairs, e.g. "gid_validator=audit". Unknown validators are rejected.
+func ParseChain(names, modes string) (Chain, error) {
+	var chain Chain
+	seen := map[string]bool{}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := registered(name); !ok {
+			return Chain{}, fmt.Errorf("unknown validator %q, expected one of %s", name, strings.Join(Validators(), ", "))
+		}
+		if seen[name] {
+			return Chain{}, fmt.Errorf("validator %s is listed twice", name)
+		}
+		seen[name] = true
+		chain.Names = append(chain.Names, name)
+	}
+
+	for _, pair := range strings.Split(modes, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, mode, ok := strings.Cut(pair, "=")
+		if !ok {
+			return Chain{}, fmt.Errorf("invalid validator mode %q, expected validator=mode", pair)
+		}
+		name = strings.TrimSpace(name)
+		if _, ok := registered(name); !ok {
+			return Chain{}, fmt.Errorf("unknown validator %q, expected one of %s", name, strings.Join(Validators(), ", "))
+		}
+		switch m := ValidatorMode(strings.ToLower(strings.TrimSpace(mode))); m {
+		case ValidatorEnforce, ValidatorAudit:
+			if chain.Modes == nil {
+				chain.Modes = map[string]ValidatorMode{}
+			}
+			chain.Modes[name] = m
+		default:
+			return Chain{}, fmt.Errorf("unknown mode %q of validator %s, expected %s or %s", mode, name, ValidatorEnforce, ValidatorAudit)
+		}
+	}
+	return chain, nil
+}
@@ -0,0 +1,95 @@
+package validation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestParseChain(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   string
+		modes   string
+		want    Chain
+		wantErr bool
+	}{
+		{name: "default"},
+		{name: "names", names: "gid_validator, uid_validator", want: Chain{Names: []string{"gid_validator", "uid_validator"}}},
+		{name: "modes", modes: "gid_validator=audit,uid_validator=Enforce", want: Chain{Modes: map[string]ValidatorMode{"gid_validator": ValidatorAudit, "uid_validator": ValidatorEnforce}}},
+		{name: "unknown validator", names: "uid_validator,gid_check", wantErr: true},
+		{name: "duplicate validator", names: "uid_validator,uid_validator", wantErr: true},
+		{name: "unknown validator mode", modes: "gid_check=audit", wantErr: true},
+		{name: "unknown mode", modes: "gid_validator=warn", wantErr: true},
+		{name: "missing mode", modes: "gid_validator", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseChain(tt.names, tt.modes)
+		assert.Equal(t, tt.wantErr, err != nil, "%s: %v", tt.name, err)
+		assert.Equal(t, tt.want, got, tt.name)
+	}
+}
+
+func TestValidatePodChain(t *testing.T) {
+	identities := staticResolver{"user1": {UID: int64Ptr(1001), GIDs: []int64{1001}}}
+
+	tests := []struct {
+		name      string
+		chain     Chain
+		sc        *corev1.PodSecurityContext
+		valid     bool
+		validator string
+		audited   []string
+	}{
+		{name: "default chain", sc: &corev1.PodSecurityContext{RunAsUser: int64Ptr(1001), RunAsGroup: int64Ptr(2000)}, valid: false, validator: "gid_validator"},
+		{
+			name:    "audited gid",
+			chain:   Chain{Modes: map[string]ValidatorMode{"gid_validator": ValidatorAudit}},
+			sc:      &corev1.PodSecurityContext{RunAsUser: int64Ptr(1001), RunAsGroup: int64Ptr(2000)},
+			valid:   true,
+			audited: []string{"gid_validator"},
+		},
+		{
+			name:      "audited gid and enforced uid",
+			chain:     Chain{Modes: map[string]ValidatorMode{"gid_validator": ValidatorAudit}},
+			sc:        &corev1.PodSecurityContext{RunAsUser: int64Ptr(2000), RunAsGroup: int64Ptr(2000)},
+			valid:     false,
+			validator: "uid_validator",
+		},
+		{
+			name:      "ordered chain",
+			chain:     Chain{Names: []string{"gid_validator", "uid_validator"}},
+			sc:        &corev1.PodSecurityContext{RunAsUser: int64Ptr(2000), RunAsGroup: int64Ptr(2000)},
+			valid:     false,
+			validator: "gid_validator",
+		},
+		{
+			name:  "validator left out",
+			chain: Chain{Names: []string{"uid_validator"}},
+			sc:    &corev1.PodSecurityContext{RunAsUser: int64Ptr(1001), RunAsGroup: int64Ptr(2000)},
+			valid: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{SecurityContext: tt.sc, Containers: []corev1.Container{{Name: "app"}}}}
+			req := &admissionv1.AdmissionRequest{Namespace: "user1", UserInfo: authenticationv1.UserInfo{Username: "user1"}}
+
+			v := NewValidator(logrus.NewEntry(logrus.New()), Policy{Chain: tt.chain}, identities)
+			got, err := v.ValidatePod(context.TODO(), pod, req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.valid, got.Valid, got.Reason)
+			assert.Equal(t, tt.validator, got.Validator)
+			var audited []string
+			for _, f := range got.Audited {
+				audited = append(audited, f.Validator)
+			}
+			assert.Equal(t, tt.audited, audited)
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package validation
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+)
+
+// containerLists are the pod spec lists of the containers described by the
+// sources of denials, e.g. "init container setup", longest prefix first
+var containerLists = []struct {
+	prefix, list string
+}{
+	{prefix: "init container ", list: "initContainers"},
+	{prefix: "ephemeral container ", list: "ephemeralContainers"},
+	{prefix: "container ", list: "containers"},
+}
+
+// setting is a field of a YAML flow mapping
+type setting struct {
+	key, value string
+}
+
+// settings is a YAML flow mapping keeping the order of its fields
+type settings []setting
+
+// set sets key to value, unless already set
+func (s *settings) set(key, value string) {
+	for _, f := range *s {
+		if f.key == key {
+			return
+		}
+	}
+	*s = append(*s, setting{key: key, value: value})
+}
+
+// String formats s as a YAML flow mapping, e.g. "{runAsUser: 1001}"
+func (s settings) String() string {
+	fields := make([]string, len(s))
+	for i, f := range s {
+		fields[i] = f.key + ": " + f.value
+	}
+	return "{" + strings.Join(fields, ", ") + "}"
+}
+
+// Remediation returns the YAML lines of the pod spec fixing the denials, e.g.
+// "securityContext: {runAsUser: 1001, fsGroup: 1001}", none when the denials
+// can't be fixed by setting a field, e.g. because the user has no UID mapped
+func Remediation(denied []Finding) []string {
+	var spec, pod settings
+	containers := map[string]*settings{}
+	var order []string
+	securityContext := func(source string) *settings {
+		for _, c := range containerLists {
+			if name, ok := strings.CutPrefix(source, c.prefix); ok {
+				key := c.list + "/" + name
+				if containers[key] == nil {
+					containers[key] = &settings{}
+					order = append(order, key)
+				}
+				return containers[key]
+			}
+		}
+		return &pod
+	}
+
+	for _, d := range denied {
+		switch d.Code {
+		case CodeUIDMismatch, CodeUIDOutOfNamespaceRange:
+			if uid, ok := firstID(d.Details["expectedUID"]); ok {
+				securityContext(d.Details["source"]).set("runAsUser", uid)
+			}
+		case CodeGIDMismatch:
+			if gid, ok := firstID(d.Details["expectedGIDs"]); ok {
+				securityContext(d.Details["source"]).set("runAsGroup", gid)
+			}
+		case CodeFSGroupMismatch:
+			if gid, ok := firstID(d.Details["expectedGIDs"]); ok {
+				pod.set("fsGroup", gid)
+			}
+		case CodeSupplementalGroupMismatch:
+			if gids := d.Details["expectedGIDs"]; gids != "" {
+				pod.set("supplementalGroups", "["+strings.ReplaceAll(gids, ",", ", ")+"]")
+			}
+		case CodeRunAsNonRootRequired:
+			pod.set("runAsNonRoot", "true")
+		case CodeUserNamespaceRequired:
+			spec.set("hostUsers", "false")
+		case CodeHostNamespace:
+			for _, host := range strings.Split(d.Details["hostNamespaces"], ",") {
+				if host != "" {
+					spec.set(host, "false")
+				}
+			}
+		}
+	}
+
+	var lines []string
+	for _, f := range spec {
+		lines = append(lines, f.key+": "+f.value)
+	}
+	if len(pod) > 0 {
+		lines = append(lines, "securityContext: "+pod.String())
+	}
+	lists := map[string][]string{}
+	var listOrder []string
+	for _, key := range order {
+		list, name, _ := strings.Cut(key, "/")
+		if lists[list] == nil {
+			listOrder = append(listOrder, list)
+		}
+		lists[list] = append(lists[list], fmt.Sprintf("{name: %s, securityContext: %s}", name, containers[key]))
+	}
+	for _, list := range listOrder {
+		lines = append(lines, list+": ["+strings.Join(lists[list], ", ")+"]")
+	}
+	return lines
+}
+
+// firstID returns the lowest ID of a list of IDs and ranges, e.g. "1000-1999,2500"
+func firstID(value string) (string, bool) {
+	ranges, err := mapping.ParseIDRanges(value)
+	if err != nil || len(ranges) == 0 {
+		return "", false
+	}
+	return strconv.FormatInt(ranges[0].Min, 10), true
+}
@@ -0,0 +1,48 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemediation(t *testing.T) {
+	tests := []struct {
+		name   string
+		denied []Finding
+		want   []string
+	}{
+		{name: "none"},
+		{
+			name:   "unmapped user",
+			denied: []Finding{{Code: CodeUnmappedUser, Details: map[string]string{"subject": "user1"}}},
+		},
+		{
+			name: "pod",
+			denied: []Finding{
+				{Code: CodeUIDMismatch, Details: map[string]string{"source": "pod", "expectedUID": "1000-1999,2500", "foundUID": "0"}},
+				{Code: CodeFSGroupMismatch, Details: map[string]string{"expectedGIDs": "1001,3000", "foundFSGroup": "0"}},
+				{Code: CodeSupplementalGroupMismatch, Details: map[string]string{"expectedGIDs": "1001,3000", "foundGID": "0"}},
+			},
+			want: []string{"securityContext: {runAsUser: 1000, fsGroup: 1001, supplementalGroups: [1001, 3000]}"},
+		},
+		{
+			name: "containers",
+			denied: []Finding{
+				{Code: CodeUIDMismatch, Details: map[string]string{"source": "container app", "expectedUID": "1001"}},
+				{Code: CodeGIDMismatch, Details: map[string]string{"source": "container app", "expectedGIDs": "1001"}},
+				{Code: CodeGIDMismatch, Details: map[string]string{"source": "init container setup", "expectedGIDs": "1001"}},
+				{Code: CodeHostNamespace, Details: map[string]string{"hostNamespaces": "hostNetwork,hostPID"}},
+			},
+			want: []string{
+				"hostNetwork: false",
+				"hostPID: false",
+				"containers: [{name: app, securityContext: {runAsUser: 1001, runAsGroup: 1001}}]",
+				"initContainers: [{name: setup, securityContext: {runAsGroup: 1001}}]",
+			},
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Remediation(tt.denied), tt.name)
+	}
+}
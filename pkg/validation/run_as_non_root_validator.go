@@ -0,0 +1,42 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// runAsNonRootValidator is a container for denying pods that may run as root,
+// which root squashing doesn't protect the exports from when it is disabled
+type runAsNonRootValidator struct {
+	Logger logrus.FieldLogger
+}
+
+// runAsNonRootValidator implements the podValidator interface
+var _ podValidator = (*runAsNonRootValidator)(nil)
+
+// Name returns the name of runAsNonRootValidator
+func (r runAsNonRootValidator) Name() string {
+	return "run_as_non_root_validator"
+}
+
+// Validate returns an invalid validation if any container of the pod runs without
+// runAsNonRoot set to true, on the container or on the pod
+func (r runAsNonRootValidator) Validate(_ context.Context, pod *corev1.Pod, _ *admissionv1.AdmissionRequest) (validation, error) {
+	if missing := containersWithoutRunAsNonRoot(pod); len(missing) > 0 {
+		v := validation{
+			Valid:  false,
+			Reason: fmt.Sprintf("runAsNonRoot: true is required, not set for: %s\n", strings.Join(missing, ", ")),
+			Code:   CodeRunAsNonRootRequired,
+			Details: map[string]string{
+				"containers": strings.Join(missing, ","),
+			},
+		}
+		return v, nil
+	}
+	return validation{Valid: true, Reason: "runAsNonRoot set"}, nil
+}
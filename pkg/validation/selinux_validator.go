@@ -0,0 +1,153 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SELinuxResolver resolves the seLinuxOptions required for users and serviceAccounts
+type SELinuxResolver interface {
+	SELinuxOptions(subject string) (options corev1.SELinuxOptions, found bool, err error)
+}
+
+// seLinuxValidator is a container for validating the SELinux labels of pods
+// mounting NFS, e.g. the MCS categories separating tenants on the storage nodes
+type seLinuxValidator struct {
+	Logger  logrus.FieldLogger
+	SELinux SELinuxResolver
+	// Volumes resolves the exports of volumes, only `nfs:` volumes are inspected when nil
+	Volumes ExportResolver
+}
+
+// seLinuxValidator implements the podValidator interface
+var _ podValidator = (*seLinuxValidator)(nil)
+
+// Name returns the name of seLinuxValidator
+func (s seLinuxValidator) Name() string {
+	return "selinux_validator"
+}
+
+// Validate inspects the seLinuxOptions of pods mounting NFS. The returned validation
+// is only valid if every container runs with the seLinuxOptions required for the
+// user/serviceAccount, set on the container or on the pod. Only the options set in
+// the mapping are compared, MCS levels regardless of the order of their categories.
+func (s seLinuxValidator) Validate(_ context.Context, pod *corev1.Pod, a *admissionv1.AdmissionRequest) (validation, error) {
+	user := getUser(s.Logger, a, pod)
+	required, found, err := s.SELinux.SELinuxOptions(user)
+	if err != nil {
+		return lookupFailed(err.Error()), nil
+	}
+	if !found {
+		return validation{Valid: true, Reason: "Valid seLinuxOptions"}, nil
+	}
+
+	volume, err := nfsVolume(s.Volumes, a.Namespace, pod)
+	if err != nil {
+		return lookupFailed(err.Error()), nil
+	}
+	if volume == "" {
+		return validation{Valid: true, Reason: "Valid seLinuxOptions"}, nil
+	}
+
+	for _, c := range containerSELinuxOptions(pod) {
+		if field, expected, found := seLinuxMismatch(required, c.Options); field != "" {
+			v := validation{
+				Valid:  false,
+				Reason: fmt.Sprintf("Invalid seLinuxOptions %s in %s, expected: %s, found: %s\n", field, c.Source, expected, found),
+				Code:   CodeSELinuxMismatch,
+				Details: map[string]string{
+					"subject":  user,
+					"source":   c.Source,
+					"field":    field,
+					"expected": expected,
+					"found":    found,
+				},
+			}
+			return v, nil
+		}
+	}
+	return validation{Valid: true, Reason: "Valid seLinuxOptions"}, nil
+}
+
+// containerSELinux is the effective seLinuxOptions of a container of a pod
+type containerSELinux struct {
+	// Source describes the container, e.g. "init container setup"
+	Source  string
+	Options corev1.SELinuxOptions
+}
+
+// containerSELinuxOptions returns the effective seLinuxOptions of every container,
+// init container and ephemeral container of a pod: the ones of the container
+// replace the ones of the pod like in the kubelet
+func containerSELinuxOptions(pod *corev1.Pod) []containerSELinux {
+	var podOptions corev1.SELinuxOptions
+	if sc := pod.Spec.SecurityContext; sc != nil && sc.SELinuxOptions != nil {
+		podOptions = *sc.SELinuxOptions
+	}
+
+	var options []containerSELinux
+	add := func(source string, sc *corev1.SecurityContext) {
+		o := podOptions
+		if sc != nil && sc.SELinuxOptions != nil {
+			o = *sc.SELinuxOptions
+		}
+		options = append(options, containerSELinux{Source: source, Options: o})
+	}
+	for _, c := range pod.Spec.InitContainers {
+		add(fmt.Sprintf("init container %s", c.Name), c.SecurityContext)
+	}
+	for _, c := range pod.Spec.Containers {
+		add(fmt.Sprintf("container %s", c.Name), c.SecurityContext)
+	}
+	for _, c := range pod.Spec.EphemeralContainers {
+		add(fmt.Sprintf("ephemeral container %s", c.Name), c.SecurityContext)
+	}
+	return options
+}
+
+// seLinuxMismatch returns the name, expected and found values of the first option
+// set in required that options doesn't match, an empty name if all of them match
+func seLinuxMismatch(required, options corev1.SELinuxOptions) (field, expected, found string) {
+	for _, f := range []struct{ name, expected, found string }{
+		{"user", required.User, options.User},
+		{"role", required.Role, options.Role},
+		{"type", required.Type, options.Type},
+	} {
+		if f.expected != "" && f.expected != f.found {
+			return f.name, f.expected, formatSELinux(f.found)
+		}
+	}
+	if required.Level != "" && normalizeLevel(required.Level) != normalizeLevel(options.Level) {
+		return "level", required.Level, formatSELinux(options.Level)
+	}
+	return "", "", ""
+}
+
+// normalizeLevel sorts the categories of an MCS level, e.g. "s0:c456,c123" becomes
+// "s0:c123,c456"
+func normalizeLevel(level string) string {
+	sensitivity, categories, ok := strings.Cut(strings.TrimSpace(level), ":")
+	if !ok {
+		return sensitivity
+	}
+	fields := strings.Split(categories, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	sort.Strings(fields)
+	return sensitivity + ":" + strings.Join(fields, ",")
+}
+
+// formatSELinux formats an SELinux option that may be unset
+func formatSELinux(value string) string {
+	if value == "" {
+		return "unset"
+	}
+	return value
+}
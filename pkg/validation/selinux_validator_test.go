@@ -0,0 +1,61 @@
+package validation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// seLinuxOptions maps subjects to their required seLinuxOptions
+type seLinuxOptions map[string]corev1.SELinuxOptions
+
+func (s seLinuxOptions) SELinuxOptions(subject string) (corev1.SELinuxOptions, bool, error) {
+	options, found := s[subject]
+	return options, found, nil
+}
+
+func TestSELinuxValidator(t *testing.T) {
+	s := seLinuxValidator{
+		Logger:  logrus.New(),
+		SELinux: seLinuxOptions{"user1": {Level: "s0:c123,c456"}, "user2": {Type: "tenant_t", Level: "s0:c1"}},
+	}
+	nfsVolume := corev1.Volume{Name: "data", VolumeSource: corev1.VolumeSource{NFS: &corev1.NFSVolumeSource{Server: "nfs", Path: "/exports"}}}
+	level := func(l string) *corev1.SELinuxOptions { return &corev1.SELinuxOptions{Level: l} }
+
+	tests := []struct {
+		name      string
+		user      string
+		volumes   []corev1.Volume
+		pod       *corev1.SELinuxOptions
+		container *corev1.SELinuxOptions
+		valid     bool
+	}{
+		{name: "pod level", user: "user1", volumes: []corev1.Volume{nfsVolume}, pod: level("s0:c123,c456"), valid: true},
+		{name: "categories order", user: "user1", volumes: []corev1.Volume{nfsVolume}, container: level("s0:c456,c123"), valid: true},
+		{name: "wrong level", user: "user1", volumes: []corev1.Volume{nfsVolume}, pod: level("s0:c1,c2"), valid: false},
+		{name: "container overrides pod", user: "user1", volumes: []corev1.Volume{nfsVolume}, pod: level("s0:c123,c456"), container: &corev1.SELinuxOptions{Type: "spc_t"}, valid: false},
+		{name: "unset", user: "user1", volumes: []corev1.Volume{nfsVolume}, valid: false},
+		{name: "no NFS volume", user: "user1", valid: true},
+		{name: "wrong type", user: "user2", volumes: []corev1.Volume{nfsVolume}, pod: level("s0:c1"), valid: false},
+		{name: "type and level", user: "user2", volumes: []corev1.Volume{nfsVolume}, pod: &corev1.SELinuxOptions{User: "system_u", Type: "tenant_t", Level: "s0:c1"}, valid: true},
+		{name: "no requirement", user: "user3", volumes: []corev1.Volume{nfsVolume}, valid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{
+				Volumes:         tt.volumes,
+				SecurityContext: &corev1.PodSecurityContext{SELinuxOptions: tt.pod},
+				Containers:      []corev1.Container{{Name: "app", SecurityContext: &corev1.SecurityContext{SELinuxOptions: tt.container}}},
+			}}
+			req := &admissionv1.AdmissionRequest{Namespace: "team-a", UserInfo: authenticationv1.UserInfo{Username: tt.user}}
+			v, err := s.Validate(context.Background(), pod, req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.valid, v.Valid, v.Reason)
+		})
+	}
+}
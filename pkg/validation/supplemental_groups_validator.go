@@ -0,0 +1,65 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// supplementalGroupsValidator is a container for validating the supplemental groups of pods
+type supplementalGroupsValidator struct {
+	Logger   logrus.FieldLogger
+	Resolver resolver.UIDResolver
+}
+
+// supplementalGroupsValidator implements the podValidator interface
+var _ podValidator = (*supplementalGroupsValidator)(nil)
+
+// Name returns the name of supplementalGroupsValidator
+func (s supplementalGroupsValidator) Name() string {
+	return "supplemental_groups_validator"
+}
+
+// Validate inspects the Pod Spec.
+// NFS exports using AUTH_SYS trust the group list sent by the client, so the returned
+// validation is only valid if every supplemental group of the Pod is one of the GIDs
+// associated with the user in the GID mapping ConfigMap.
+func (s supplementalGroupsValidator) Validate(ctx context.Context, pod *corev1.Pod, a *admissionv1.AdmissionRequest) (validation, error) {
+	securityContext := pod.Spec.SecurityContext
+	if securityContext == nil || len(securityContext.SupplementalGroups) == 0 {
+		return validation{Valid: true, Reason: "Valid supplementalGroups"}, nil
+	}
+
+	user := getUser(s.Logger, a, pod)
+
+	allowed, err := getGIDs(ctx, s.Resolver, a.Namespace, resolvedSubject(a, user), getGroups(a))
+	if err != nil {
+		return lookupFailed(fmt.Sprintf("Failed resolving identity: %s\n", err)), nil
+	}
+	if len(allowed) == 0 {
+		return unmappedGID(user), nil
+	}
+
+	for _, found := range securityContext.SupplementalGroups {
+		if !containsID(allowed, found) {
+			v := validation{
+				Valid:  false,
+				Reason: fmt.Sprintf("Invalid supplemental group, expected one of: %v, found: %d\n", allowed, found),
+				Code:   CodeSupplementalGroupMismatch,
+				Details: map[string]string{
+					"subject":      user,
+					"expectedGIDs": formatIDs(allowed),
+					"foundGID":     strconv.FormatInt(found, 10),
+				},
+			}
+			return v, nil
+		}
+	}
+
+	return validation{Valid: true, Reason: "Valid supplementalGroups"}, nil
+}
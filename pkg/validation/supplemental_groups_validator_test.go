@@ -0,0 +1,49 @@
+package validation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSupplementalGroupsValidator(t *testing.T) {
+	identities := staticResolver{"user1": {UID: int64Ptr(1001), GIDs: []int64{1001, 3000}}}
+
+	tests := []struct {
+		name     string
+		resolver resolver.UIDResolver
+		user     string
+		groups   []int64
+		valid    bool
+		code     string
+		foundGID string
+	}{
+		{name: "no supplemental groups", resolver: identities, user: "user2", groups: []int64{}, valid: true},
+		{name: "mapped gids", resolver: identities, user: "user1", groups: []int64{3000, 1001}, valid: true},
+		{name: "wrong gid", resolver: identities, user: "user1", groups: []int64{1001, 0, 3000}, valid: false, code: CodeSupplementalGroupMismatch, foundGID: "0"},
+		{name: "unmapped user", resolver: identities, user: "user2", groups: []int64{1001}, valid: false, code: CodeUnmappedGID},
+		{name: "resolver error", resolver: failingResolver{}, user: "user1", groups: []int64{1001}, valid: false, code: CodeLookupFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{
+				SecurityContext: &corev1.PodSecurityContext{SupplementalGroups: tt.groups},
+				Containers:      []corev1.Container{{Name: "app"}},
+			}}
+			req := &admissionv1.AdmissionRequest{Namespace: "team-a", UserInfo: authenticationv1.UserInfo{Username: tt.user}}
+
+			s := supplementalGroupsValidator{Logger: logrus.New(), Resolver: tt.resolver}
+			got, err := s.Validate(context.TODO(), pod, req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.valid, got.Valid, got.Reason)
+			assert.Equal(t, tt.code, got.Code)
+			assert.Equal(t, tt.foundGID, got.Details["foundGID"])
+		})
+	}
+}
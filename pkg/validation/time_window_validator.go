@@ -0,0 +1,93 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// TimeWindowResolver resolves the time windows during which the pods mounting NFS
+// of users and serviceAccounts may be created
+type TimeWindowResolver interface {
+	TimeWindows(subject string) (windows []mapping.TimeWindow, found bool, err error)
+}
+
+// timeWindowValidator is a container for validating that pods mounting NFS are
+// created during a time window of their user/serviceAccount, e.g. the nightly
+// window of a batch serviceAccount
+type timeWindowValidator struct {
+	Logger      logrus.FieldLogger
+	TimeWindows TimeWindowResolver
+	// Volumes resolves the exports of volumes, only `nfs:` volumes are inspected when nil
+	Volumes ExportResolver
+	// now returns the current time, time.Now when nil
+	now func() time.Time
+}
+
+// timeWindowValidator implements the podValidator interface
+var _ podValidator = (*timeWindowValidator)(nil)
+
+// Name returns the name of timeWindowValidator
+func (t timeWindowValidator) Name() string {
+	return "time_window_validator"
+}
+
+// Validate inspects the creation time of pods mounting NFS. The returned validation
+// is only valid if the user/serviceAccount has no time windows or if the current
+// time falls within one of them. Only pods are inspected: the templates of
+// workloads, e.g. the CronJob scheduling the pods, may be created at any time.
+func (t timeWindowValidator) Validate(_ context.Context, pod *corev1.Pod, a *admissionv1.AdmissionRequest) (validation, error) {
+	if a.Kind.Kind != "" && a.Kind.Kind != "Pod" {
+		return validation{Valid: true, Reason: "Valid time window"}, nil
+	}
+
+	user := getUser(t.Logger, a, pod)
+	windows, found, err := t.TimeWindows.TimeWindows(user)
+	if err != nil {
+		return lookupFailed(err.Error()), nil
+	}
+	if !found {
+		return validation{Valid: true, Reason: "Valid time window"}, nil
+	}
+
+	volume, err := nfsVolume(t.Volumes, a.Namespace, pod)
+	if err != nil {
+		return lookupFailed(err.Error()), nil
+	}
+	if volume == "" {
+		return validation{Valid: true, Reason: "Valid time window"}, nil
+	}
+
+	now := time.Now
+	if t.now != nil {
+		now = t.now
+	}
+	current := now()
+	descriptions := make([]string, len(windows))
+	for i, w := range windows {
+		ok, err := w.Contains(current)
+		if err != nil {
+			return lookupFailed(fmt.Sprintf("invalid window of %s: %v", user, err)), nil
+		}
+		if ok {
+			return validation{Valid: true, Reason: "Valid time window"}, nil
+		}
+		descriptions[i] = w.String()
+	}
+	v := validation{
+		Valid:  false,
+		Reason: fmt.Sprintf("Pods of %s mounting NFS can only be created during: %s, current time: %s\n", user, strings.Join(descriptions, "; "), current.UTC().Format(time.RFC3339)),
+		Code:   CodeOutsideTimeWindow,
+		Details: map[string]string{
+			"subject": user,
+			"windows": strings.Join(descriptions, "; "),
+		},
+	}
+	return v, nil
+}
@@ -0,0 +1,67 @@
+package validation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// timeWindows maps subjects to their time windows
+type timeWindows map[string][]mapping.TimeWindow
+
+func (w timeWindows) TimeWindows(subject string) ([]mapping.TimeWindow, bool, error) {
+	windows, found := w[subject]
+	return windows, found, nil
+}
+
+func TestTimeWindowValidator(t *testing.T) {
+	nfsVolume := corev1.Volume{Name: "data", VolumeSource: corev1.VolumeSource{NFS: &corev1.NFSVolumeSource{Server: "nfs", Path: "/exports"}}}
+	night := []mapping.TimeWindow{{Start: "22:00", End: "06:00"}}
+
+	tests := []struct {
+		name    string
+		user    string
+		kind    string
+		volumes []corev1.Volume
+		time    time.Time
+		valid   bool
+		code    string
+	}{
+		{name: "within", user: "batch", volumes: []corev1.Volume{nfsVolume}, time: time.Date(2026, 10, 16, 23, 0, 0, 0, time.UTC), valid: true},
+		{name: "outside", user: "batch", volumes: []corev1.Volume{nfsVolume}, time: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC), valid: false, code: CodeOutsideTimeWindow},
+		{name: "workload template", user: "batch", kind: "CronJob", volumes: []corev1.Volume{nfsVolume}, time: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC), valid: true},
+		{name: "no NFS volume", user: "batch", time: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC), valid: true},
+		{name: "no window", user: "user1", volumes: []corev1.Volume{nfsVolume}, time: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC), valid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := timeWindowValidator{
+				Logger:      logrus.New(),
+				TimeWindows: timeWindows{"batch": night},
+				now:         func() time.Time { return tt.time },
+			}
+			kind := tt.kind
+			if kind == "" {
+				kind = "Pod"
+			}
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Volumes: tt.volumes, Containers: []corev1.Container{{Name: "app"}}}}
+			req := &admissionv1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Version: "v1", Kind: kind},
+				Namespace: "team-a",
+				UserInfo:  authenticationv1.UserInfo{Username: tt.user},
+			}
+			val, err := v.Validate(context.Background(), pod, req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.valid, val.Valid, val.Reason)
+			assert.Equal(t, tt.code, val.Code)
+		})
+	}
+}
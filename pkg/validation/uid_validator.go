@@ -2,28 +2,32 @@ package validation
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 
-	"encoding/json"
-
-	"os"
-
 	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
 	admissionv1 "k8s.io/api/admission/v1"
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	rest "k8s.io/client-go/rest"
 )
 
-var configMapName = "nfs-pod-access-control-uid-mapping"
-var namespace string
-
 // uidValidator is a container for validating the name of pods
 type uidValidator struct {
-	Logger logrus.FieldLogger
+	Logger   logrus.FieldLogger
+	Resolver resolver.UIDResolver
+	// RequireRunAsUser denies pods running any container with the image default UID
+	RequireRunAsUser bool
+	// SCCRanges allows the UIDs of the OpenShift range of the pod namespace to
+	// users and serviceAccounts without a mapping, nil denies them
+	SCCRanges SCCRangeResolver
+}
+
+// SCCRangeResolver returns the UID range OpenShift allocated to a namespace
+type SCCRangeResolver interface {
+	SCCRange(namespace string) (uids mapping.IDRanges, found bool, err error)
 }
 
 // uidValidator implements the podValidator interface
@@ -34,80 +38,75 @@ func (n uidValidator) Name() string {
 	return "uid_validator"
 }
 
-// setPodNamespace retrieves the namespace of the pod by reading the file containing the namespace information
-func setPodNamespace() error {
-	// Path to the file containing the pod's namespace
-	namespaceFile := "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
-
-	// Read the namespace file
-	namespaceBytes, err := os.ReadFile(namespaceFile)
-	if err != nil {
-		return err
-	}
-
-	// Set namespace variable
-	namespace = string(namespaceBytes)
-	return nil
-}
-
 // Validate inspects the Pod Spec.
-// The returned validation is only valid if the Pod doesn't set runAsUser with an unappropriate UID.
+// The returned validation is only valid if neither the Pod nor any of its containers
+// set runAsUser with an unappropriate UID, i.e. outside of the UIDs mapped to the user.
 // UID is associated with Pod through ServiceAccount
-func (n uidValidator) Validate(pod *corev1.Pod, a *admissionv1.AdmissionRequest) (validation, error) {
-
-	err := setPodNamespace()
-	if err != nil {
-		v := validation{
-			Valid:  false,
-			Reason: fmt.Sprintf("Failed retrieving some env variables client: %s\n", err),
-		}
-		return v, nil
-	}
-
-	securityContext := pod.Spec.SecurityContext
-	user := getUser(n, a, pod)
-
-	if securityContext.RunAsUser != nil {
-		found := securityContext.RunAsUser
-		client, err := initClient()
-		if err != nil {
+func (n uidValidator) Validate(ctx context.Context, pod *corev1.Pod, a *admissionv1.AdmissionRequest) (validation, error) {
+	if n.RequireRunAsUser {
+		if missing := containersWithoutRunAsUser(pod); len(missing) > 0 {
 			v := validation{
 				Valid:  false,
-				Reason: fmt.Sprintf("Failed initializing Kubernetes client: %s\n", err),
+				Reason: fmt.Sprintf("runAsUser is required, not set for: %s\n", strings.Join(missing, ", ")),
+				Code:   CodeRunAsUserRequired,
+				Details: map[string]string{
+					"containers": strings.Join(missing, ","),
+				},
 			}
 			return v, nil
 		}
-		configMap, err := getConfigMap(client)
-		if err != nil {
-			v := validation{
-				Valid:  false,
-				Reason: fmt.Sprintf("Failed getting ConfigMap: %s\n", err),
-			}
-			return v, nil
-		}
-		data := configMap.Data
-		expected, err := strconv.ParseInt(data[user], 10, 64)
+	}
 
-		if data[user] == "" {
-			v := validation{
-				Valid:  false,
-				Reason: fmt.Sprintf("User %s has no UID associated with it %s\n", user, err),
-			}
-			return v, nil
-		}
+	found := runAsUsers(pod)
+	if len(found) == 0 {
+		return validation{Valid: true, Reason: "Valid uid"}, nil
+	}
+
+	user := getUser(n.Logger, a, pod)
+
+	identity, err := resolver.ResolveUser(ctx, n.Resolver, a.Namespace, resolvedSubject(a, user), getGroups(a))
+	if err != nil && !errors.Is(err, resolver.ErrNotFound) {
+		return lookupFailed(fmt.Sprintf("Failed resolving identity: %s\n", err)), nil
+	}
 
+	var expected mapping.IDRanges
+	if identity.UID != nil {
+		expected = identity.AllowedUIDs()
+	} else if n.SCCRanges != nil {
+		// compose with the UIDs assigned by the OpenShift SecurityContextConstraints
+		sccRange, found, err := n.SCCRanges.SCCRange(a.Namespace)
 		if err != nil {
-			v := validation{
-				Valid:  false,
-				Reason: fmt.Sprintf("Failed to convert UID to int64\n: %s", err),
-			}
-			return v, nil
+			return lookupFailed(fmt.Sprintf("Failed getting OpenShift UID range: %s\n", err)), nil
+		}
+		expected = sccRange
+		if found {
+			n.Logger.Debugf("User %s has no UID associated with it, using the OpenShift UID range %s of namespace %s", user, sccRange, a.Namespace)
 		}
+	}
+	if len(expected) == 0 {
+		v := validation{
+			Valid:  false,
+			Reason: fmt.Sprintf("User %s has no UID associated with it\n", user),
+			Code:   CodeUnmappedUser,
+			Details: map[string]string{
+				"subject": user,
+			},
+		}
+		return v, nil
+	}
 
-		if expected != *found {
+	for _, f := range found {
+		if !expected.Contains(f.ID) {
 			v := validation{
 				Valid:  false,
-				Reason: fmt.Sprintf("Invalid uid, expected: %d, found: %d\n", expected, *found),
+				Reason: fmt.Sprintf("Invalid uid in %s, expected: %s, found: %d\n", f.Source, expected, f.ID),
+				Code:   CodeUIDMismatch,
+				Details: map[string]string{
+					"subject":     user,
+					"source":      f.Source,
+					"expectedUID": expected.String(),
+					"foundUID":    strconv.FormatInt(f.ID, 10),
+				},
 			}
 			return v, nil
 		}
@@ -116,60 +115,58 @@ func (n uidValidator) Validate(pod *corev1.Pod, a *admissionv1.AdmissionRequest)
 	return validation{Valid: true, Reason: "Valid uid"}, nil
 }
 
-// Init Kubernetes Client to interact with the API
-func initClient() (*kubernetes.Clientset, error) {
-	// Init client from inside pod
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		logMessage := fmt.Sprintf("Error getting in-cluster config: %s\n", err)
-		return nil, fmt.Errorf(logMessage)
+// Subject returns the user/serviceAccount pod is validated for without logging
+// it, like the validators do: the serviceAccount of the pod when requested by a
+// serviceAccount, e.g. the controller of its workload, the requester otherwise
+func Subject(request *admissionv1.AdmissionRequest, pod *corev1.Pod) string {
+	username := request.UserInfo.Username
+	if strings.HasPrefix(username, "system:serviceaccount:") && len(strings.Split(username, ":")) == 4 {
+		return pod.Spec.ServiceAccountName
 	}
+	return username
+}
 
-	// Creating client
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		logMessage := fmt.Sprintf("Error starting Kubernetes client from config: %s\n", err)
-		return nil, fmt.Errorf(logMessage)
+// Get ServiceAccount or Username from API request
+func getUser(logger logrus.FieldLogger, request *admissionv1.AdmissionRequest, pod *corev1.Pod) string {
+	user := Subject(request, pod)
+	// Subject differs from the requester only when it is a serviceAccount
+	if username := request.UserInfo.Username; user != username {
+		parts := strings.Split(username, ":")
+		logger.WithFields(logrus.Fields{
+			"service_account": parts[3],
+			"namespace":       parts[2],
+		}).Info("Request made by ServiceAccount")
+		return user
 	}
-	return clientset, nil
+
+	logger.WithFields(logrus.Fields{
+		"user":      user,
+		"namespace": request.Namespace,
+	}).Info("Request made by User")
+	return user
 }
 
-// Retrieve ConfigMap based on name and namespaces
-func getConfigMap(client *kubernetes.Clientset) (*corev1.ConfigMap, error) {
-	// Get ConfigMap
-	configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), configMapName, metav1.GetOptions{})
-	if err != nil {
-		logMessage := fmt.Sprintf("Error getting ConfigMap: %s\n", err)
-		return nil, fmt.Errorf(logMessage)
+// resolvedSubject returns the subject user is resolved as: the username of a
+// serviceAccount, so that the annotations of serviceAccounts never map users
+func resolvedSubject(request *admissionv1.AdmissionRequest, user string) string {
+	username := request.UserInfo.Username
+	if strings.HasPrefix(username, "system:serviceaccount:") && len(strings.Split(username, ":")) == 4 {
+		return mapping.ServiceAccountSubject(request.Namespace, user)
 	}
-	return configMap, nil
+	return user
 }
 
-// Get ServiceAccount or Username from API request
-func getUser(mhd uidValidator, request *admissionv1.AdmissionRequest, pod *corev1.Pod) string {
-	requestJSON, err := json.MarshalIndent(request, "", "  ")
-	if err != nil {
-		fmt.Printf("Error serializing AdmissionRequest: %v\n", err)
-		return ""
+// getGroups returns the groups of a human user making the API request, used to
+// resolve group mappings. ServiceAccounts and built-in system: groups are ignored.
+func getGroups(request *admissionv1.AdmissionRequest) []string {
+	if strings.HasPrefix(request.UserInfo.Username, "system:serviceaccount:") {
+		return nil
 	}
-
-	// Print the JSON string
-	fmt.Println(string(requestJSON))
-
-	userInfo := request.UserInfo
-	if userInfo.Username != "" && strings.HasPrefix(userInfo.Username, "system:serviceaccount:") {
-		parts := strings.Split(userInfo.Username, ":")
-		if len(parts) == 4 {
-			namespace := parts[2]
-			serviceAccountName := parts[3]
-			logMessage := fmt.Sprintf("Request made by ServiceAccount: %s in namespace: %s", serviceAccountName, namespace)
-			mhd.Logger.Info(logMessage)
-
-			return pod.Spec.ServiceAccountName
+	var groups []string
+	for _, group := range request.UserInfo.Groups {
+		if !strings.HasPrefix(group, "system:") {
+			groups = append(groups, group)
 		}
 	}
-
-	logMessage := fmt.Sprintf("Request made by User: %s in namespace: %s", userInfo.Username, namespace)
-	mhd.Logger.Info(logMessage)
-	return userInfo.Username
+	return groups
 }
@@ -0,0 +1,172 @@
+package validation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestUIDValidatorConfigMap validates pods against the UID mapping ConfigMap of
+// a fake clientset, as resolved by the configmap backend
+func TestUIDValidatorConfigMap(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: mapping.UIDConfigMapName, Namespace: "nfs"},
+		Data:       map[string]string{"user1": "1001", "user3": "1000-1999", "sa-sidecar": "1001,1002,1005"},
+	})
+	stop := make(chan struct{})
+	defer close(stop)
+	mappings := mapping.NewStore(client, "nfs")
+	if err := mappings.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+	r, err := resolver.New("configmap", resolver.Options{Mappings: mappings})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		user      string
+		runAsUser *int64
+		valid     bool
+	}{
+		{name: "mapped uid", user: "user1", runAsUser: int64Ptr(1001), valid: true},
+		{name: "wrong uid", user: "user1", runAsUser: int64Ptr(0), valid: false},
+		{name: "uid in range", user: "user3", runAsUser: int64Ptr(1500), valid: true},
+		{name: "unmapped user", user: "user2", runAsUser: int64Ptr(1001), valid: false},
+		{name: "image default uid", user: "user2", valid: true},
+		{name: "uid in list", user: "sa-sidecar", runAsUser: int64Ptr(1005), valid: true},
+		{name: "uid out of list", user: "sa-sidecar", runAsUser: int64Ptr(1003), valid: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{
+				SecurityContext: &corev1.PodSecurityContext{RunAsUser: tt.runAsUser},
+				Containers:      []corev1.Container{{Name: "app"}},
+			}}
+			req := &admissionv1.AdmissionRequest{
+				Namespace: "team-a",
+				UserInfo:  authenticationv1.UserInfo{Username: tt.user},
+			}
+
+			u := uidValidator{Logger: logrus.New(), Resolver: r}
+			got, err := u.Validate(context.TODO(), pod, req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.valid, got.Valid, got.Reason)
+		})
+	}
+
+	// sidecars may run under another UID of the list than the main container
+	pod := &corev1.Pod{Spec: corev1.PodSpec{
+		SecurityContext: &corev1.PodSecurityContext{RunAsUser: int64Ptr(1001)},
+		Containers: []corev1.Container{
+			{Name: "app"},
+			{Name: "sidecar", SecurityContext: &corev1.SecurityContext{RunAsUser: int64Ptr(1002)}},
+		},
+	}}
+	req := &admissionv1.AdmissionRequest{UserInfo: authenticationv1.UserInfo{Username: "sa-sidecar"}}
+	got, err := uidValidator{Logger: logrus.New(), Resolver: r}.Validate(context.TODO(), pod, req)
+	assert.NoError(t, err)
+	assert.True(t, got.Valid, got.Reason)
+}
+
+// TestUIDValidatorServiceAccountAnnotations validates pods against the
+// annotations of serviceAccounts, which never map the users named like them
+func TestUIDValidatorServiceAccountAnnotations(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: mapping.UIDConfigMapName, Namespace: "nfs"}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+			Name:        "alice",
+			Namespace:   "team-a",
+			Annotations: map[string]string{mapping.ServiceAccountUIDAnnotation: "0"},
+		}},
+	)
+	stop := make(chan struct{})
+	defer close(stop)
+	mappings := mapping.NewStore(client, "nfs")
+	mappings.EnableServiceAccountAnnotations(client, true)
+	if err := mappings.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+	r, err := resolver.New("configmap", resolver.Options{Mappings: mappings})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pod := &corev1.Pod{Spec: corev1.PodSpec{
+		ServiceAccountName: "alice",
+		SecurityContext:    &corev1.PodSecurityContext{RunAsUser: int64Ptr(0)},
+		Containers:         []corev1.Container{{Name: "app"}},
+	}}
+	for user, valid := range map[string]bool{"system:serviceaccount:team-a:alice": true, "alice": false} {
+		req := &admissionv1.AdmissionRequest{Namespace: "team-a", UserInfo: authenticationv1.UserInfo{Username: user}}
+		got, err := uidValidator{Logger: logrus.New(), Resolver: r}.Validate(context.TODO(), pod, req)
+		assert.NoError(t, err)
+		assert.Equal(t, valid, got.Valid, "%s: %s", user, got.Reason)
+	}
+}
+
+// sccRanges maps namespaces to their OpenShift UID range
+type sccRanges map[string]mapping.IDRanges
+
+func (s sccRanges) SCCRange(namespace string) (mapping.IDRanges, bool, error) {
+	uids, found := s[namespace]
+	return uids, found, nil
+}
+
+func TestUIDValidatorSCCRanges(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: mapping.UIDConfigMapName, Namespace: "nfs"},
+		Data:       map[string]string{"user1": "1001"},
+	})
+	stop := make(chan struct{})
+	defer close(stop)
+	mappings := mapping.NewStore(client, "nfs")
+	if err := mappings.Start(stop); err != nil {
+		t.Fatal(err)
+	}
+	r, err := resolver.New("configmap", resolver.Options{Mappings: mappings})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := uidValidator{
+		Logger:    logrus.New(),
+		Resolver:  r,
+		SCCRanges: sccRanges{"team-a": {{Min: 1000060000, Max: 1000069999}}},
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		user      string
+		runAsUser int64
+		valid     bool
+	}{
+		{name: "scc uid", namespace: "team-a", user: "user2", runAsUser: 1000060000, valid: true},
+		{name: "uid out of scc range", namespace: "team-a", user: "user2", runAsUser: 1001, valid: false},
+		{name: "namespace without range", namespace: "team-b", user: "user2", runAsUser: 1000060000, valid: false},
+		{name: "mapping takes precedence", namespace: "team-a", user: "user1", runAsUser: 1000060000, valid: false},
+	}
+	for _, tt := range tests {
+		pod := &corev1.Pod{Spec: corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{RunAsUser: int64Ptr(tt.runAsUser)},
+			Containers:      []corev1.Container{{Name: "app"}},
+		}}
+		req := &admissionv1.AdmissionRequest{
+			Namespace: tt.namespace,
+			UserInfo:  authenticationv1.UserInfo{Username: tt.user},
+		}
+		v, err := u.Validate(context.Background(), pod, req)
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.valid, v.Valid, "%s: %s", tt.name, v.Reason)
+	}
+}
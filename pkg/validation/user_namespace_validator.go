@@ -0,0 +1,32 @@
+package validation
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// userNamespaceValidator is a container for denying pods that share the user
+// namespace of the host
+type userNamespaceValidator struct {
+	Logger logrus.FieldLogger
+}
+
+// userNamespaceValidator implements the podValidator interface
+var _ podValidator = (*userNamespaceValidator)(nil)
+
+// Name returns the name of userNamespaceValidator
+func (u userNamespaceValidator) Name() string {
+	return "user_namespace_validator"
+}
+
+// Validate returns an invalid validation unless the pod sets hostUsers to false,
+// so that its UIDs are mapped to unprivileged host UIDs
+func (u userNamespaceValidator) Validate(_ context.Context, pod *corev1.Pod, _ *admissionv1.AdmissionRequest) (validation, error) {
+	if !usesUserNamespace(pod) {
+		return validation{Valid: false, Reason: "hostUsers: false is required\n", Code: CodeUserNamespaceRequired}, nil
+	}
+	return validation{Valid: true, Reason: "pod runs in a user namespace"}, nil
+}
@@ -1,61 +1,195 @@
 package validation
 
 import (
+	"context"
+
 	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/exports"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/opa"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	admissionv1 "k8s.io/api/admission/v1"
 	corev1 "k8s.io/api/core/v1"
 )
 
 // Validator is a container for mutation
 type Validator struct {
-	Logger *logrus.Entry
+	Logger   *logrus.Entry
+	Policy   Policy
+	Resolver resolver.UIDResolver
+}
+
+// Policy holds the settings tuning how strictly pods are validated
+type Policy struct {
+	// RequireRunAsUser denies pods that don't explicitly set runAsUser,
+	// either at pod level or on every container
+	RequireRunAsUser bool
+	// RequireRunAsNonRoot denies pods that don't set runAsNonRoot to true, either
+	// at pod level or on every container
+	RequireRunAsNonRoot bool
+	// RequireUserNamespaces denies pods that don't set hostUsers to false, i.e.
+	// that don't run in a user namespace
+	RequireUserNamespaces bool
+	// RelaxUserNamespaces skips the validation of the UIDs and GIDs of pods
+	// running in a user namespace against the mappings, since the IDs they use on
+	// the wire are remapped by the kubelet
+	RelaxUserNamespaces bool
+	// WindowsPods is how pods targeting Windows nodes are validated instead of
+	// validating their Linux IDs, WindowsSkip when empty
+	WindowsPods WindowsPolicy
+	// WindowsUserNames resolves the Windows user names mapped to users and
+	// serviceAccounts, required by WindowsValidate
+	WindowsUserNames WindowsUserNameResolver
+	// MinUID denies pods running as a UID below it, even if mapped to their
+	// user/serviceAccount, 0 disables the threshold
+	MinUID int64
+	// BlockRootUID denies pods running as UID 0, even if mapped to their
+	// user/serviceAccount
+	BlockRootUID bool
+	// DenyHostNamespaces denies pods mounting NFS that set hostNetwork, hostPID
+	// or hostIPC
+	DenyHostNamespaces bool
+	// Exports restricts the UIDs and GIDs mounting NFS exports, nil disables export policies
+	Exports *exports.Policy
+	// Volumes resolves the NFS exports mounted by PersistentVolumeClaims and CSI
+	// volumes for the export policies, only `nfs:` volumes are validated when nil
+	Volumes ExportResolver
+	// Principals maps users and serviceAccounts to Kerberos principals, nil disables
+	// the validation of Kerberos credentials
+	Principals PrincipalResolver
+	// SELinux resolves the seLinuxOptions required for the pods mounting NFS of
+	// users and serviceAccounts, nil disables the validation of SELinux labels
+	SELinux SELinuxResolver
+	// TimeWindows resolves the time windows during which the pods mounting NFS of
+	// users and serviceAccounts may be created, nil disables time windows
+	TimeWindows TimeWindowResolver
+	// AccessPolicies evaluates the rules of NFSAccessPolicies, nil disables them
+	AccessPolicies AccessPolicyEvaluator
+	// OPA evaluates the decisions of Open Policy Agent before the other validators,
+	// nil disables them
+	OPA opa.Engine
+	// Collisions refuses the pods of subjects whose UIDs are mapped to another
+	// subject too, nil admits them
+	Collisions CollisionChecker
+	// NamespaceRanges restricts the runAsUser of pods to the UID range of their
+	// namespace, nil disables namespace UID ranges
+	NamespaceRanges NamespaceRangeResolver
+	// SCCRanges allows users and serviceAccounts without a UID mapping to run as
+	// the UIDs of the OpenShift range of their namespace, nil denies them
+	SCCRanges SCCRangeResolver
+	// Chain selects the validators applied, their order and their mode, every
+	// validator in enforce mode when empty
+	Chain Chain
+	// Parallel applies the validators of the chain concurrently rather than one
+	// after the other, their results are still handled in the order of the chain
+	Parallel bool
+	// Aggregation tells whether the first denial of the chain or all of them are
+	// returned, AggregateFirstDeny when empty
+	Aggregation Aggregation
 }
 
 // NewValidator returns an initialised instance of Validator
-func NewValidator(logger *logrus.Entry) *Validator {
-	return &Validator{Logger: logger}
+func NewValidator(logger *logrus.Entry, policy Policy, r resolver.UIDResolver) *Validator {
+	return &Validator{Logger: logger, Policy: policy, Resolver: r}
 }
 
 // podValidators is an interface used to group functions mutating pods
 type podValidator interface {
-	Validate(*corev1.Pod, *admissionv1.AdmissionRequest) (validation, error)
+	Validate(context.Context, *corev1.Pod, *admissionv1.AdmissionRequest) (validation, error)
 	Name() string
 }
 
 type validation struct {
 	Valid  bool
 	Reason string
+	// Validator is the name of the validator that denied the pod, if any
+	Validator string
+	// Exempt admits the pod without running the remaining validators
+	Exempt bool
+	// Code tells why the pod is denied, e.g. CodeUIDMismatch, CodeDenied when unset
+	Code string
+	// Details are the values the denial is about, e.g. expectedUID and foundUID
+	Details map[string]string
+	// Audited are the denials of the validators in audit mode
+	Audited []Finding
+	// Denied are the denials of the validators in enforce mode, only the first
+	// one unless the Policy aggregates them all
+	Denied []Finding
 }
 
-// ValidatePod returns true if a pod is valid
-func (v *Validator) ValidatePod(pod *corev1.Pod, a *admissionv1.AdmissionRequest) (validation, error) {
-	var podName string
-	if pod.Name != "" {
-		podName = pod.Name
-	} else {
-		if pod.ObjectMeta.GenerateName != "" {
-			podName = pod.ObjectMeta.GenerateName
-		}
-	}
-	log := logrus.WithField("pod_name", podName)
-	log.Print("delete me")
+// Finding is the denial of a pod by a validator in audit mode
+type Finding struct {
+	Validator string
+	Reason    string
+	Code      string
+	Details   map[string]string
+}
 
-	// list of all validations to be applied to the pod
-	validations := []podValidator{
-		uidValidator{v.Logger},
+// ValidatePod returns true if a pod is valid, every validator is traced as a child span of ctx
+func (v *Validator) ValidatePod(ctx context.Context, pod *corev1.Pod, a *admissionv1.AdmissionRequest) (validation, error) {
+	podName := pod.Name
+	if podName == "" {
+		podName = pod.GenerateName
 	}
+	logger := v.Logger.WithField("pod_name", podName)
 
-	// apply all validations
-	for _, v := range validations {
-		var err error
-		vp, err := v.Validate(pod, a)
-		if err != nil {
-			return validation{Valid: false, Reason: err.Error()}, err
+	// apply the validators of the chain, the denials of the ones in audit mode are
+	// recorded and the next validators applied
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	validators := v.validators(logger, pod)
+	results := v.run(ctx, validators, pod, a)
+	var audited, denied []Finding
+	for i, validator := range validators {
+		vp, err := results(i)
+		if err != nil || !vp.Valid {
+			finding := Finding{Validator: validator.Name(), Reason: vp.Reason, Code: vp.Code, Details: vp.Details}
+			if err != nil {
+				finding.Reason, finding.Code = err.Error(), CodeLookupFailed
+			}
+			if finding.Code == "" {
+				finding.Code = CodeDenied
+			}
+			if v.Policy.Chain.mode(validator.Name()) == ValidatorAudit {
+				audited = append(audited, finding)
+				continue
+			}
+			if err != nil {
+				return validation{Valid: false, Reason: finding.Reason, Validator: validator.Name(), Code: finding.Code, Denied: denied, Audited: audited}, err
+			}
+			denied = append(denied, finding)
+			if v.Policy.Aggregation != AggregateAll {
+				break
+			}
+			continue
 		}
-		if !vp.Valid {
-			return validation{Valid: false, Reason: vp.Reason}, err
+		if vp.Exempt {
+			// the pod is exempted from the next validators, not from former denials
+			if len(denied) == 0 {
+				return validation{Valid: true, Reason: vp.Reason, Audited: audited}, nil
+			}
+			break
 		}
 	}
 
-	return validation{Valid: true, Reason: "valid pod"}, nil
+	if len(denied) > 0 {
+		return denial(denied, audited), nil
+	}
+	return validation{Valid: true, Reason: "valid pod", Audited: audited}, nil
+}
+
+// validate applies a validator to the pod within its own span
+func validate(ctx context.Context, v podValidator, pod *corev1.Pod, a *admissionv1.AdmissionRequest) (validation, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "validate "+v.Name())
+	defer span.End()
+
+	vp, err := v.Validate(ctx, pod, a)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.SetAttributes(attribute.Bool("nfs.valid", vp.Valid))
+	return vp, err
 }
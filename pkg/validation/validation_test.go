@@ -0,0 +1,188 @@
+package validation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// staticResolver resolves identities from a map
+type staticResolver map[string]resolver.IdentitySpec
+
+func (s staticResolver) Resolve(_ context.Context, subject string) (resolver.IdentitySpec, error) {
+	id, ok := s[subject]
+	if !ok {
+		return id, resolver.ErrNotFound
+	}
+	return id, nil
+}
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
+func TestValidatePod(t *testing.T) {
+	identities := staticResolver{
+		"user1": {UID: int64Ptr(1001), GIDs: []int64{1001, 3000}},
+		"user3": {UID: int64Ptr(1000), UIDs: mapping.IDRanges{{Min: 1000, Max: 1999}, {Min: 2500, Max: 2500}}},
+
+		"group.eng-data": {UID: int64Ptr(3000), UIDs: mapping.IDRanges{{Min: 3000, Max: 3099}}, GIDs: []int64{3000}},
+	}
+
+	tests := []struct {
+		name   string
+		user   string
+		groups []string
+		sc     *corev1.PodSecurityContext
+		valid  bool
+	}{
+		{name: "no securityContext", user: "user1", valid: true},
+		{name: "mapped uid", user: "user1", sc: &corev1.PodSecurityContext{RunAsUser: int64Ptr(1001)}, valid: true},
+		{name: "wrong uid", user: "user1", sc: &corev1.PodSecurityContext{RunAsUser: int64Ptr(0)}, valid: false},
+		{name: "uid in range", user: "user3", sc: &corev1.PodSecurityContext{RunAsUser: int64Ptr(1500)}, valid: true},
+		{name: "uid in list", user: "user3", sc: &corev1.PodSecurityContext{RunAsUser: int64Ptr(2500)}, valid: true},
+		{name: "uid out of range", user: "user3", sc: &corev1.PodSecurityContext{RunAsUser: int64Ptr(2000)}, valid: false},
+		{name: "uid of group", user: "user1", groups: []string{"eng-data"}, sc: &corev1.PodSecurityContext{RunAsUser: int64Ptr(3050)}, valid: true},
+		{name: "group takes precedence", user: "user1", groups: []string{"eng-data"}, sc: &corev1.PodSecurityContext{RunAsUser: int64Ptr(1001)}, valid: false},
+		{name: "unmapped group", user: "user1", groups: []string{"eng-ml"}, sc: &corev1.PodSecurityContext{RunAsUser: int64Ptr(1001)}, valid: true},
+		{name: "gid of group", user: "user2", groups: []string{"eng-data"}, sc: &corev1.PodSecurityContext{RunAsGroup: int64Ptr(3000)}, valid: true},
+		{name: "unmapped user", user: "user2", sc: &corev1.PodSecurityContext{RunAsUser: int64Ptr(1001)}, valid: false},
+		{name: "mapped gid", user: "user1", sc: &corev1.PodSecurityContext{RunAsGroup: int64Ptr(3000)}, valid: true},
+		{name: "wrong gid", user: "user1", sc: &corev1.PodSecurityContext{RunAsGroup: int64Ptr(0)}, valid: false},
+		{name: "wrong fsGroup", user: "user1", sc: &corev1.PodSecurityContext{FSGroup: int64Ptr(4000)}, valid: false},
+		{name: "wrong supplementalGroups", user: "user1", sc: &corev1.PodSecurityContext{SupplementalGroups: []int64{1001, 4000}}, valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				Spec: corev1.PodSpec{
+					SecurityContext: tt.sc,
+					Containers:      []corev1.Container{{Name: "app"}},
+				},
+			}
+			req := &admissionv1.AdmissionRequest{
+				Namespace: "user1",
+				UserInfo:  authenticationv1.UserInfo{Username: tt.user, Groups: tt.groups},
+			}
+
+			v := NewValidator(logrus.NewEntry(logrus.New()), Policy{}, identities)
+			got, err := v.ValidatePod(context.TODO(), pod, req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.valid, got.Valid, got.Reason)
+			if !tt.valid {
+				assert.NotEmpty(t, got.Validator)
+			}
+		})
+	}
+}
+
+func TestValidatePodDeadline(t *testing.T) {
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}}
+	req := &admissionv1.AdmissionRequest{UserInfo: authenticationv1.UserInfo{Username: "user1"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	v := NewValidator(logrus.NewEntry(logrus.New()), Policy{}, staticResolver{"user1": {UID: int64Ptr(1001)}})
+	got, err := v.ValidatePod(ctx, pod, req)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.False(t, got.Valid)
+	assert.Equal(t, "uid_validator", got.Validator)
+}
+
+func TestValidatePodUserNamespaces(t *testing.T) {
+	identities := staticResolver{"user1": {UID: int64Ptr(1001), GIDs: []int64{1001}}}
+	yes, no := true, false
+
+	tests := []struct {
+		name      string
+		policy    Policy
+		hostUsers *bool
+		valid     bool
+		validator string
+	}{
+		{name: "host users", policy: Policy{RequireUserNamespaces: true}, valid: false, validator: "user_namespace_validator"},
+		{name: "explicit host users", policy: Policy{RequireUserNamespaces: true}, hostUsers: &yes, valid: false, validator: "user_namespace_validator"},
+		{name: "user namespace", policy: Policy{RequireUserNamespaces: true}, hostUsers: &no, valid: false, validator: "uid_validator"},
+		{name: "relaxed user namespace", policy: Policy{RequireUserNamespaces: true, RelaxUserNamespaces: true}, hostUsers: &no, valid: true},
+		{name: "relaxed host users", policy: Policy{RelaxUserNamespaces: true}, valid: false, validator: "uid_validator"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{
+				HostUsers:       tt.hostUsers,
+				SecurityContext: &corev1.PodSecurityContext{RunAsUser: int64Ptr(2000), RunAsGroup: int64Ptr(2000)},
+				Containers:      []corev1.Container{{Name: "app"}},
+			}}
+			req := &admissionv1.AdmissionRequest{Namespace: "user1", UserInfo: authenticationv1.UserInfo{Username: "user1"}}
+
+			v := NewValidator(logrus.NewEntry(logrus.New()), tt.policy, identities)
+			got, err := v.ValidatePod(context.TODO(), pod, req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.valid, got.Valid, got.Reason)
+			assert.Equal(t, tt.validator, got.Validator)
+		})
+	}
+}
+
+// windowsUserNames maps subjects to their Windows user names
+type windowsUserNames map[string][]string
+
+func (w windowsUserNames) WindowsUserNames(subject string) ([]string, bool, error) {
+	names, found := w[subject]
+	return names, found, nil
+}
+
+func TestValidatePodWindows(t *testing.T) {
+	identities := staticResolver{"user1": {UID: int64Ptr(1001)}}
+	userNames := windowsUserNames{"user1": {"ContainerUser", `EXAMPLE\user1`}}
+	name := func(n string) *corev1.WindowsSecurityContextOptions {
+		return &corev1.WindowsSecurityContextOptions{RunAsUserName: &n}
+	}
+
+	tests := []struct {
+		name      string
+		policy    WindowsPolicy
+		user      string
+		os        *corev1.PodOS
+		options   *corev1.WindowsSecurityContextOptions
+		valid     bool
+		validator string
+	}{
+		{name: "skipped", policy: WindowsSkip, user: "user2", os: &corev1.PodOS{Name: corev1.Windows}, options: name("ContainerAdministrator"), valid: true},
+		{name: "default policy", user: "user2", os: &corev1.PodOS{Name: corev1.Windows}, valid: true},
+		{name: "mapped user name", policy: WindowsValidate, user: "user1", os: &corev1.PodOS{Name: corev1.Windows}, options: name(`example\USER1`), valid: true},
+		{name: "wrong user name", policy: WindowsValidate, user: "user1", os: &corev1.PodOS{Name: corev1.Windows}, options: name("ContainerAdministrator"), valid: false, validator: "windows_validator"},
+		{name: "unmapped user", policy: WindowsValidate, user: "user2", os: &corev1.PodOS{Name: corev1.Windows}, options: name("ContainerUser"), valid: false, validator: "windows_validator"},
+		{name: "image default user", policy: WindowsValidate, user: "user2", os: &corev1.PodOS{Name: corev1.Windows}, valid: true},
+		{name: "denied", policy: WindowsDeny, user: "user1", os: &corev1.PodOS{Name: corev1.Windows}, valid: false, validator: "windows_validator"},
+		// a runAsUserName alone must not skip the validation of the Linux IDs
+		{name: "runAsUserName without OS", policy: WindowsSkip, user: "user1", options: name("ContainerUser"), valid: false, validator: "min_uid_validator"},
+		{name: "linux pod", policy: WindowsDeny, user: "user1", os: &corev1.PodOS{Name: corev1.Linux}, valid: false, validator: "min_uid_validator"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{
+				OS: tt.os,
+				// runAsUser is ignored on Windows nodes
+				SecurityContext: &corev1.PodSecurityContext{RunAsUser: int64Ptr(0)},
+				Containers:      []corev1.Container{{Name: "app", SecurityContext: &corev1.SecurityContext{WindowsOptions: tt.options}}},
+			}}
+			req := &admissionv1.AdmissionRequest{Namespace: "user1", UserInfo: authenticationv1.UserInfo{Username: tt.user}}
+
+			policy := Policy{WindowsPods: tt.policy, WindowsUserNames: userNames, BlockRootUID: true}
+			v := NewValidator(logrus.NewEntry(logrus.New()), policy, identities)
+			got, err := v.ValidatePod(context.TODO(), pod, req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.valid, got.Valid, got.Reason)
+			assert.Equal(t, tt.validator, got.Validator)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// WindowsPolicy is how pods targeting Windows nodes are validated
+type WindowsPolicy string
+
+const (
+	// WindowsSkip admits Windows pods without validating their user names
+	WindowsSkip WindowsPolicy = "skip"
+	// WindowsValidate validates the runAsUserName of Windows pods against the
+	// Windows user names mapped to the user/serviceAccount
+	WindowsValidate WindowsPolicy = "validate"
+	// WindowsDeny denies Windows pods
+	WindowsDeny WindowsPolicy = "deny"
+)
+
+// WindowsUserNameResolver resolves the Windows user names mapped to users and serviceAccounts
+type WindowsUserNameResolver interface {
+	WindowsUserNames(subject string) (names []string, found bool, err error)
+}
+
+// windowsValidator is a container for validating the user names of pods
+// targeting Windows nodes
+type windowsValidator struct {
+	Logger    logrus.FieldLogger
+	Policy    WindowsPolicy
+	UserNames WindowsUserNameResolver
+}
+
+// windowsValidator implements the podValidator interface
+var _ podValidator = (*windowsValidator)(nil)
+
+// Name returns the name of windowsValidator
+func (w windowsValidator) Name() string {
+	return "windows_validator"
+}
+
+// Validate denies Windows pods with WindowsDeny. Otherwise the returned validation
+// is only valid if neither the pod nor any of its containers sets a runAsUserName
+// other than the Windows user names mapped to the user/serviceAccount, compared
+// case-insensitively like Windows does. Pods without runAsUserName run as the
+// image default user and are valid.
+func (w windowsValidator) Validate(_ context.Context, pod *corev1.Pod, a *admissionv1.AdmissionRequest) (validation, error) {
+	if w.Policy == WindowsDeny {
+		return validation{Valid: false, Reason: "Windows pods are not allowed\n", Code: CodeWindowsPod}, nil
+	}
+
+	found := runAsUserNames(pod)
+	if len(found) == 0 {
+		return validation{Valid: true, Reason: "Valid Windows user name"}, nil
+	}
+
+	user := getUser(w.Logger, a, pod)
+	expected, mapped, err := w.UserNames.WindowsUserNames(user)
+	if err != nil {
+		return lookupFailed(err.Error()), nil
+	}
+	if !mapped {
+		v := validation{
+			Valid:  false,
+			Reason: fmt.Sprintf("User %s has no Windows user name associated with it\n", user),
+			Code:   CodeUnmappedWindowsUser,
+			Details: map[string]string{
+				"subject": user,
+			},
+		}
+		return v, nil
+	}
+
+	for _, f := range found {
+		if !containsFold(expected, f.Name) {
+			v := validation{
+				Valid:  false,
+				Reason: fmt.Sprintf("Invalid runAsUserName in %s, expected one of: %s, found: %s\n", f.Source, strings.Join(expected, ", "), f.Name),
+				Code:   CodeWindowsUserNameMismatch,
+				Details: map[string]string{
+					"subject":           user,
+					"source":            f.Source,
+					"expectedUserNames": strings.Join(expected, ","),
+					"foundUserName":     f.Name,
+				},
+			}
+			return v, nil
+		}
+	}
+	return validation{Valid: true, Reason: "Valid Windows user name"}, nil
+}
+
+// containsFold returns true if names contains name, ignoring case
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseWindowsPolicy parses how pods targeting Windows nodes are validated, skip
+// when empty
+func ParseWindowsPolicy(value string) (WindowsPolicy, error) {
+	switch p := WindowsPolicy(value); p {
+	case "":
+		return WindowsSkip, nil
+	case WindowsSkip, WindowsValidate, WindowsDeny:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid Windows pod policy %q, expected %s, %s or %s", value, WindowsSkip, WindowsValidate, WindowsDeny)
+	}
+}
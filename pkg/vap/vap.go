@@ -0,0 +1,149 @@
+// Package vap converts the UID mapping into a native ValidatingAdmissionPolicy and
+// its binding, so that clusters on Kubernetes 1.30+ can enforce the basic UID rule
+// without running the webhook
+package vap
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/resolver"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultName is the name of the generated policy and binding by default
+const DefaultName = "nfs-pod-access-control-uid"
+
+// Options tune the generated objects
+type Options struct {
+	// Name is the name of the policy and of its binding
+	Name string
+	// Actions are the validation actions of the binding, Deny when empty
+	Actions []admissionregistrationv1.ValidationAction
+	// ExcludedNamespaces are namespaces the policy doesn't apply to
+	ExcludedNamespaces []string
+}
+
+// Generate returns the ValidatingAdmissionPolicy enforcing that the runAsUser of
+// pods is one of the UIDs mapped to the user/serviceAccount creating them, and its
+// binding. uids are the UIDs of the users, serviceAccounts and groups (with the
+// group. prefix) of the UID mapping, which is embedded into the policy: it must be
+// generated again whenever the mapping changes.
+func Generate(uids map[string]mapping.IDRanges, opts Options) (*admissionregistrationv1.ValidatingAdmissionPolicy, *admissionregistrationv1.ValidatingAdmissionPolicyBinding) {
+	if opts.Name == "" {
+		opts.Name = DefaultName
+	}
+	if len(opts.Actions) == 0 {
+		opts.Actions = []admissionregistrationv1.ValidationAction{admissionregistrationv1.Deny}
+	}
+
+	users, groups := map[string]mapping.IDRanges{}, map[string]mapping.IDRanges{}
+	for subject, ranges := range uids {
+		if group, ok := strings.CutPrefix(subject, resolver.GroupSubjectPrefix); ok {
+			groups[group] = ranges
+		} else {
+			users[subject] = ranges
+		}
+	}
+
+	failurePolicy := admissionregistrationv1.Fail
+	policy := &admissionregistrationv1.ValidatingAdmissionPolicy{
+		TypeMeta:   metav1.TypeMeta{APIVersion: admissionregistrationv1.SchemeGroupVersion.String(), Kind: "ValidatingAdmissionPolicy"},
+		ObjectMeta: metav1.ObjectMeta{Name: opts.Name},
+		Spec: admissionregistrationv1.ValidatingAdmissionPolicySpec{
+			FailurePolicy: &failurePolicy,
+			MatchConstraints: &admissionregistrationv1.MatchResources{
+				ResourceRules: []admissionregistrationv1.NamedRuleWithOperations{
+					podRule(admissionregistrationv1.Create, "pods"),
+					podRule(admissionregistrationv1.Update, "pods/ephemeralcontainers"),
+				},
+			},
+			Variables: []admissionregistrationv1.Variable{
+				// the subject is resolved like the webhook does, the serviceAccount of
+				// the pod for requests of serviceAccounts
+				{Name: "subject", Expression: "request.userInfo.username.startsWith('system:serviceaccount:') ? " +
+					"(has(object.spec.serviceAccountName) ? object.spec.serviceAccountName : 'default') : request.userInfo.username"},
+				{Name: "uids", Expression: rangesMap(users)},
+				{Name: "groupUids", Expression: rangesMap(groups)},
+				// group mappings take precedence over the mapping of the user
+				{Name: "groups", Expression: "request.userInfo.username.startsWith('system:serviceaccount:') || !has(request.userInfo.groups) ? [] : " +
+					"request.userInfo.groups.filter(g, !g.startsWith('system:') && g in variables.groupUids)"},
+				{Name: "ranges", Expression: "variables.groups.size() > 0 ? variables.groups.map(g, variables.groupUids[g]) : " +
+					"(variables.subject in variables.uids ? [variables.uids[variables.subject]] : [])"},
+				{Name: "runAsUsers", Expression: runAsUsers},
+			},
+			Validations: []admissionregistrationv1.Validation{{
+				Expression:        "variables.runAsUsers.all(u, variables.ranges.exists(rs, rs.exists(r, u >= r[0] && u <= r[1])))",
+				MessageExpression: "'Invalid uid in pod, expected one of the UIDs mapped to ' + variables.subject",
+				Reason:            reasonPtr(metav1.StatusReasonForbidden),
+			}},
+		},
+	}
+
+	binding := &admissionregistrationv1.ValidatingAdmissionPolicyBinding{
+		TypeMeta:   metav1.TypeMeta{APIVersion: admissionregistrationv1.SchemeGroupVersion.String(), Kind: "ValidatingAdmissionPolicyBinding"},
+		ObjectMeta: metav1.ObjectMeta{Name: opts.Name},
+		Spec: admissionregistrationv1.ValidatingAdmissionPolicyBindingSpec{
+			PolicyName:        opts.Name,
+			ValidationActions: opts.Actions,
+		},
+	}
+	if len(opts.ExcludedNamespaces) > 0 {
+		binding.Spec.MatchResources = &admissionregistrationv1.MatchResources{
+			NamespaceSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{
+				Key:      "kubernetes.io/metadata.name",
+				Operator: metav1.LabelSelectorOpNotIn,
+				Values:   opts.ExcludedNamespaces,
+			}}},
+		}
+	}
+	return policy, binding
+}
+
+// runAsUsers lists every runAsUser set at pod or container level
+const runAsUsers = "(has(object.spec.securityContext) && has(object.spec.securityContext.runAsUser) ? [object.spec.securityContext.runAsUser] : []) + " +
+	"object.spec.containers.filter(c, has(c.securityContext) && has(c.securityContext.runAsUser)).map(c, c.securityContext.runAsUser) + " +
+	"(has(object.spec.initContainers) ? object.spec.initContainers.filter(c, has(c.securityContext) && has(c.securityContext.runAsUser)).map(c, c.securityContext.runAsUser) : []) + " +
+	"(has(object.spec.ephemeralContainers) ? object.spec.ephemeralContainers.filter(c, has(c.securityContext) && has(c.securityContext.runAsUser)).map(c, c.securityContext.runAsUser) : [])"
+
+// podRule returns the rule matching operation on the pod resource
+func podRule(operation admissionregistrationv1.OperationType, resource string) admissionregistrationv1.NamedRuleWithOperations {
+	return admissionregistrationv1.NamedRuleWithOperations{
+		RuleWithOperations: admissionregistrationv1.RuleWithOperations{
+			Operations: []admissionregistrationv1.OperationType{operation},
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   []string{""},
+				APIVersions: []string{"v1"},
+				Resources:   []string{resource},
+			},
+		},
+	}
+}
+
+// rangesMap returns the CEL map literal of ranges, e.g. {"user1": [[1000, 1999]]},
+// sorted by key so that the generated policy is stable
+func rangesMap(ranges map[string]mapping.IDRanges) string {
+	keys := make([]string, 0, len(ranges))
+	for key := range ranges {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	entries := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs := make([]string, 0, len(ranges[key]))
+		for _, r := range ranges[key] {
+			pairs = append(pairs, fmt.Sprintf("[%d, %d]", r.Min, r.Max))
+		}
+		entries = append(entries, strconv.Quote(key)+": ["+strings.Join(pairs, ", ")+"]")
+	}
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+
+func reasonPtr(reason metav1.StatusReason) *metav1.StatusReason {
+	return &reason
+}
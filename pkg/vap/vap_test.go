@@ -0,0 +1,125 @@
+package vap
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tensorchord/nfs-pod-access-control/pkg/mapping"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// evaluate evaluates the variables and validation of policy like the API server
+// does, against pod created by username
+func evaluate(t *testing.T, policy *admissionregistrationv1.ValidatingAdmissionPolicy, pod *corev1.Pod, username string, groups []string) bool {
+	env, err := cel.NewEnv(
+		cel.Variable("object", cel.DynType),
+		cel.Variable("request", cel.DynType),
+		cel.Variable("variables", cel.MapType(cel.StringType, cel.DynType)),
+	)
+	require.NoError(t, err)
+
+	object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pod)
+	require.NoError(t, err)
+	userInfo := map[string]interface{}{"username": username}
+	if groups != nil {
+		userInfo["groups"] = groups
+	}
+	vars := map[string]interface{}{}
+	activation := map[string]interface{}{
+		"object":    object,
+		"request":   map[string]interface{}{"userInfo": userInfo},
+		"variables": vars,
+	}
+
+	eval := func(expression string) interface{} {
+		ast, issues := env.Compile(expression)
+		require.NoError(t, issues.Err(), expression)
+		program, err := env.Program(ast)
+		require.NoError(t, err)
+		out, _, err := program.Eval(activation)
+		require.NoError(t, err, expression)
+		return out.Value()
+	}
+	for _, v := range policy.Spec.Variables {
+		vars[v.Name] = eval(v.Expression)
+	}
+	require.Len(t, policy.Spec.Validations, 1)
+	eval(policy.Spec.Validations[0].MessageExpression)
+	return eval(policy.Spec.Validations[0].Expression).(bool)
+}
+
+func podWithUIDs(serviceAccount string, podUID *int64, containerUIDs ...int64) *corev1.Pod {
+	pod := &corev1.Pod{Spec: corev1.PodSpec{ServiceAccountName: serviceAccount}}
+	if podUID != nil {
+		pod.Spec.SecurityContext = &corev1.PodSecurityContext{RunAsUser: podUID}
+	}
+	pod.Spec.Containers = []corev1.Container{{Name: "plain"}}
+	for _, uid := range containerUIDs {
+		uid := uid
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{SecurityContext: &corev1.SecurityContext{RunAsUser: &uid}})
+	}
+	return pod
+}
+
+func TestGenerate(t *testing.T) {
+	uids := map[string]mapping.IDRanges{
+		"alice":          mapping.SingleID(1000),
+		"builder":        {{Min: 2000, Max: 2099}},
+		"group.data-eng": mapping.SingleID(3000),
+	}
+	policy, binding := Generate(uids, Options{})
+	assert.Equal(t, DefaultName, policy.Name)
+	assert.Equal(t, DefaultName, binding.Spec.PolicyName)
+	assert.Equal(t, []admissionregistrationv1.ValidationAction{admissionregistrationv1.Deny}, binding.Spec.ValidationActions)
+	assert.Nil(t, binding.Spec.MatchResources)
+
+	uid := func(id int64) *int64 { return &id }
+	tests := []struct {
+		name     string
+		pod      *corev1.Pod
+		username string
+		groups   []string
+		valid    bool
+	}{
+		{name: "mapped user", pod: podWithUIDs("", uid(1000)), username: "alice", valid: true},
+		{name: "wrong uid", pod: podWithUIDs("", uid(1001)), username: "alice", valid: false},
+		{name: "wrong container uid", pod: podWithUIDs("", uid(1000), 1000, 0), username: "alice", valid: false},
+		{name: "unmapped user", pod: podWithUIDs("", uid(1000)), username: "bob", valid: false},
+		{name: "no runAsUser", pod: podWithUIDs("", nil), username: "bob", valid: true},
+		{name: "serviceAccount range", pod: podWithUIDs("builder", nil, 2050), username: "system:serviceaccount:ci:runner", valid: true},
+		{name: "serviceAccount out of range", pod: podWithUIDs("builder", nil, 2100), username: "system:serviceaccount:ci:runner", valid: false},
+		{name: "group precedence", pod: podWithUIDs("", uid(3000)), username: "alice", groups: []string{"system:authenticated", "data-eng"}, valid: true},
+		{name: "group replaces user", pod: podWithUIDs("", uid(1000)), username: "alice", groups: []string{"data-eng"}, valid: false},
+		{name: "unmapped group", pod: podWithUIDs("", uid(1000)), username: "alice", groups: []string{"ops"}, valid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.valid, evaluate(t, policy, tt.pod, tt.username, tt.groups))
+		})
+	}
+}
+
+func TestGenerateOptions(t *testing.T) {
+	policy, binding := Generate(nil, Options{
+		Name:               "uids",
+		Actions:            []admissionregistrationv1.ValidationAction{admissionregistrationv1.Warn, admissionregistrationv1.Audit},
+		ExcludedNamespaces: []string{"kube-system"},
+	})
+	assert.Equal(t, "uids", policy.Name)
+	assert.Equal(t, "uids", binding.Name)
+	assert.Equal(t, []admissionregistrationv1.ValidationAction{admissionregistrationv1.Warn, admissionregistrationv1.Audit}, binding.Spec.ValidationActions)
+	require.NotNil(t, binding.Spec.MatchResources)
+	assert.Equal(t, []string{"kube-system"}, binding.Spec.MatchResources.NamespaceSelector.MatchExpressions[0].Values)
+	assert.Equal(t, "{}", policy.Spec.Variables[1].Expression)
+}
+
+func TestRangesMap(t *testing.T) {
+	assert.Equal(t, `{"a": [[1, 1]], "b\"c": [[2, 5], [7, 7]]}`, rangesMap(map[string]mapping.IDRanges{
+		"b\"c": {{Min: 2, Max: 5}, {Min: 7, Max: 7}},
+		"a":    mapping.SingleID(1),
+	}))
+}